@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// the operations of bench
+const (
+	benchList   = "list"
+	benchGet    = "get"
+	benchUpload = "upload"
+)
+
+var benchOps = []string{benchList, benchGet, benchUpload}
+
+// benchStats are the latencies of the successful requests, the number of the failed ones
+// and the first error by operation
+type benchStats struct {
+	latencies map[string][]time.Duration
+	failures  map[string]int
+	errs      map[string]error
+}
+
+func newBenchStats() *benchStats {
+	return &benchStats{latencies: make(map[string][]time.Duration), failures: make(map[string]int), errs: make(map[string]error)}
+}
+
+func (s *benchStats) merge(o *benchStats) {
+	for k, v := range o.latencies {
+		s.latencies[k] = append(s.latencies[k], v...)
+	}
+	for k, v := range o.failures {
+		s.failures[k] += v
+	}
+	for k, v := range o.errs {
+		if s.errs[k] == nil {
+			s.errs[k] = v
+		}
+	}
+}
+
+// bencher sends the requests of bench to target
+type bencher struct {
+	target string
+	client *http.Client
+	ids    []string
+	size   int
+	n      int64
+	mu     sync.Mutex
+}
+
+// parseMix reads list=70,get=20,upload=10 into the cumulative weights of benchOps
+func parseMix(mix string) (cumulative []int, err error) {
+	weights := make(map[string]int, len(benchOps))
+	for _, part := range strings.Split(mix, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bench: -mix is op=weight,..., got %q", part)
+		}
+		var w int
+		w, err = strconv.Atoi(kv[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bench: the weight of %s is not a non-negative number", kv[0])
+		}
+		weights[kv[0]] = w
+	}
+	var total int
+	for _, op := range benchOps {
+		total += weights[op]
+		cumulative = append(cumulative, total)
+		delete(weights, op)
+	}
+	for op := range weights {
+		return nil, fmt.Errorf("bench: unknown operation %q, possible variants: %s", op, strings.Join(benchOps, ", "))
+	}
+	if total == 0 {
+		return nil, errors.New("bench: -mix has no operation to run")
+	}
+	return
+}
+
+// apiError is the error of the answer of the api
+func apiError(resp *http.Response) error {
+	model := &outModel{}
+	err := json.NewDecoder(resp.Body).Decode(model)
+	if err != nil {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if model.Error != nil {
+		return fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	return nil
+}
+
+func (b *bencher) list() (err error) {
+	q := url.Values{tokenQuery: {config.Token}}
+	resp, err := b.client.Get(b.target + routes["docs"] + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	return apiError(resp)
+}
+
+func (b *bencher) get(rnd *rand.Rand) (err error) {
+	if len(b.ids) == 0 {
+		return errors.New("no document to get, pass -ids or upload some")
+	}
+	q := url.Values{tokenQuery: {config.Token}}
+	resp, err := b.client.Get(b.target + routes["docsID"] + b.ids[rnd.Intn(len(b.ids))] + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if attachmentName(resp) == "" {
+		return apiError(resp)
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return
+}
+
+func (b *bencher) upload(rnd *rand.Rand) (err error) {
+	b.mu.Lock()
+	b.n++
+	name := fmt.Sprintf("bench-%d-%d.bin", time.Now().UnixNano(), b.n)
+	b.mu.Unlock()
+	content := make([]byte, b.size)
+	rnd.Read(content)
+	body, contentType, err := multipartDocument(newMeta(name, "false", ""), config.Token, bytes.NewReader(content))
+	if err != nil {
+		return
+	}
+	resp, err := b.client.Post(b.target+routes["docs"], contentType, body)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	return apiError(resp)
+}
+
+// multipartDocument builds the body of an upload in memory, unlike sendDocument which streams it
+func multipartDocument(meta *metaModel, token string, content io.Reader) (body *bytes.Buffer, contentType string, err error) {
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	body = new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	err = w.WriteField(metaQuery, string(metaJSON))
+	if err != nil {
+		return
+	}
+	err = w.WriteField(tokenQuery, token)
+	if err != nil {
+		return
+	}
+	part, err := specifyContent(w, meta.Mime, fileQuery, meta.Name)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(part, content)
+	if err != nil {
+		return
+	}
+	err = w.Close()
+	return body, w.FormDataContentType(), err
+}
+
+// listIDs takes the ids of the documents to get from a listing
+func (b *bencher) listIDs() (ids []string, err error) {
+	q := url.Values{tokenQuery: {config.Token}, limitQuery: {"100"}}
+	resp, err := b.client.Get(b.target + routes["docs"] + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var model struct {
+		Data struct {
+			Docs []struct {
+				ID string `json:"id"`
+			} `json:"docs"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&model)
+	if err != nil {
+		return
+	}
+	for _, d := range model.Data.Docs {
+		ids = append(ids, d.ID)
+	}
+	return
+}
+
+// percentile is the latency p of the sorted latencies is not greater than
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// benchCommand drives a mix of operations against the server with workers for the duration
+// and reports the latency percentiles and the error rate of every operation:
+//
+//	docscli bench -workers 8 -duration 30s -mix list=70,get=20,upload=10
+func benchCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	target := fs.String("target", host, "server to load")
+	workers := fs.Int("workers", 4, "number of concurrent workers")
+	duration := fs.Duration("duration", 10*time.Second, "how long to run")
+	mix := fs.String("mix", "list=70,get=20,upload=10", "weights of the operations: "+strings.Join(benchOps, ", "))
+	ids := fs.String("ids", "", "comma separated ids of the documents to get (default: the ids of a listing)")
+	size := fs.Int("size", 4096, "size of the uploaded documents in bytes")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if *workers < 1 || *duration <= 0 || *size < 0 {
+		return errors.New("bench: -workers, -duration and -size are to be positive")
+	}
+	cumulative, err := parseMix(*mix)
+	if err != nil {
+		return
+	}
+	b := &bencher{target: strings.TrimSuffix(*target, "/"), client: httpClient, size: *size}
+	if t, ok := transport.(*http.Transport); ok {
+		t = t.Clone()
+		t.MaxIdleConnsPerHost = *workers
+		b.client = &http.Client{Transport: t, Timeout: timeout}
+	}
+	if *ids != "" {
+		b.ids = strings.Split(*ids, ",")
+	} else if cumulative[1] > cumulative[0] {
+		b.ids, err = b.listIDs()
+		if err != nil {
+			return fmt.Errorf("bench: listing the documents to get: %v", err)
+		}
+	}
+	total := newBenchStats()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(*duration)
+	start := time.Now()
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			s := newBenchStats()
+			for time.Now().Before(deadline) {
+				n := rnd.Intn(cumulative[len(cumulative)-1])
+				op := benchOps[sort.SearchInts(cumulative, n+1)]
+				t := time.Now()
+				var err error
+				switch op {
+				case benchList:
+					err = b.list()
+				case benchGet:
+					err = b.get(rnd)
+				case benchUpload:
+					err = b.upload(rnd)
+				}
+				if err != nil {
+					s.failures[op]++
+					if s.errs[op] == nil {
+						s.errs[op] = err
+					}
+					continue
+				}
+				s.latencies[op] = append(s.latencies[op], time.Since(t))
+			}
+			mu.Lock()
+			total.merge(s)
+			mu.Unlock()
+		}(start.UnixNano() + int64(i))
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if total.latencies[benchUpload] != nil {
+		invalidateCache()
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\terrors\terror rate\trps\tp50\tp90\tp99\tmax\t")
+	for _, op := range benchOps {
+		l := total.latencies[op]
+		failed := total.failures[op]
+		n := len(l) + failed
+		if n == 0 {
+			continue
+		}
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%.1f\t%v\t%v\t%v\t%v\t\n", op, n, failed, 100*float64(failed)/float64(n),
+			float64(n)/elapsed.Seconds(), percentile(l, 0.5), percentile(l, 0.9), percentile(l, 0.99), percentile(l, 1))
+	}
+	err = tw.Flush()
+	if err != nil {
+		return
+	}
+	for _, op := range benchOps {
+		if total.errs[op] != nil {
+			fmt.Fprintf(os.Stderr, "first error of %s: %v\n", op, total.errs[op])
+		}
+	}
+	return
+}
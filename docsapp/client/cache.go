@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	cacheName  = "cache.db"
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+// listingCache keeps the last answers of the server on document listings
+// so they can be shown instantly or without the server at all
+type listingCache struct {
+	db *sql.DB
+}
+
+// cachedListing is one listing as the server has sent it
+type cachedListing struct {
+	Body    []byte
+	ETag    string
+	Fetched time.Time
+}
+
+func openCache(path string) (c *listingCache, err error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS Listing (query TEXT PRIMARY KEY, body BLOB NOT NULL, etag TEXT NOT NULL DEFAULT "", fetched TEXT NOT NULL)`)
+	if err != nil {
+		db.Close()
+		return
+	}
+	return &listingCache{db: db}, nil
+}
+
+// listingKey is the key the listing of query is cached by, the listings of a token are never shown to another one.
+// The token is hashed not to be kept in the cache
+func listingKey(query string) string {
+	h := sha256.Sum256([]byte(config.Token + "\n" + query))
+	return hex.EncodeToString(h[:])
+}
+
+// get returns nil without an error if the query has never been cached
+func (c *listingCache) get(query string) (l *cachedListing, err error) {
+	var fetched string
+	l = &cachedListing{}
+	err = c.db.QueryRow(`SELECT body, etag, fetched FROM Listing WHERE query=?`, query).Scan(&l.Body, &l.ETag, &fetched)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.Fetched, err = time.ParseInLocation(timeFormat, fetched, time.Local)
+	return
+}
+
+func (c *listingCache) put(query string, l *cachedListing) (err error) {
+	_, err = c.db.Exec(`INSERT OR REPLACE INTO Listing (query, body, etag, fetched) VALUES (?, ?, ?, ?)`,
+		query, l.Body, l.ETag, l.Fetched.Format(timeFormat))
+	return
+}
+
+// clear drops everything, any change of documents may affect any listing
+func (c *listingCache) clear() (err error) {
+	_, err = c.db.Exec(`DELETE FROM Listing`)
+	return
+}
+
+func (c *listingCache) close() {
+	c.db.Close()
+}
+
+// invalidateCache is called after the client has changed documents on the server and when the token changes
+func invalidateCache() {
+	if cache == nil {
+		return
+	}
+	err := cache.clear()
+	if err != nil {
+		log.Println("failed to clear the listing cache: " + err.Error())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -34,6 +35,7 @@ const (
 	fpathQuery    = "fpath"
 	grantQuery    = "grant"
 	publicQuery   = "public"
+	existsQuery   = "exists"
 
 	host             = "http://localhost:8080"
 	contentTypeJSON  = "application/json; charset=utf-8"
@@ -46,6 +48,14 @@ const (
 	maxOptionLength  = 6
 )
 
+// strategies for a downloaded document whose local file already exists
+const (
+	existsFail      = ""
+	existsOverwrite = "overwrite"
+	existsRename    = "rename"
+	existsSkip      = "skip"
+)
+
 const (
 	optionInitial  = 1
 	optionRegister = iota + optionInitial - 1
@@ -63,6 +73,11 @@ var (
 		"logout": "/auth/"}
 	basePath       string
 	config         *configuration
+	cache          *listingCache
+	transport      http.RoundTripper
+	debug          bool
+	debugLog       string
+	quiet          bool
 	errWrongMethod = errors.New("Wrong method")
 	isplit         bufio.SplitFunc
 	handlerCase    = map[int]handlerFunc{
@@ -86,7 +101,7 @@ var (
 		optionAuth:      {loginQuery: "", passwordQuery: ""},
 		optionLoadDoc:   {fpathQuery: "", idQuery: "", grantQuery: "", publicQuery: ""},
 		optionGetDocs:   {loginQuery: "", keyQuery: "", valueQuery: "", limitQuery: ""},
-		optionDocByID:   {idQuery: ""},
+		optionDocByID:   {idQuery: "", existsQuery: ""},
 		optionDeleteDoc: {idQuery: ""},
 		optionLogout:    {}}
 	actionCase = map[int]string{
@@ -107,6 +122,11 @@ type metaModel struct {
 	Public bool
 	Mime   string
 	Grant  []string
+	// Visibility is private, unlisted or public, the server takes it from Public if it is empty
+	Visibility string `json:",omitempty"`
+	// Groups and ExpiresAt are sent back as they are when a document is uploaded again
+	Groups    []string `json:",omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
 }
 
 type outModel struct {
@@ -161,9 +181,32 @@ func init() {
 		log.Fatal(err)
 	}
 	basePath = filepath.Join(basePath, dataPath)
+
+	flag.BoolVar(&debug, "debug", false, "dump requests and responses with timings to the debug log")
+	flag.StringVar(&debugLog, "debug-log", "debug.log", "file the debug output is appended to")
+	flag.StringVar(&proxyURL, "proxy", "", "proxy url, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected without it")
+	flag.DurationVar(&timeout, "timeout", 0, "time limit of a request with its body, 0 is none")
+	flag.BoolVar(&http2, "http2", false, "use HTTP/2 with https servers")
+
+	cache, err = openCache(cacheName)
+	if err != nil {
+		log.Println("the listing cache is disabled: " + err.Error())
+	}
 }
 
 func main() {
+	flag.Parse()
+	err := initClients()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if flag.NArg() > 0 {
+		err = runCommand(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	rw := bufio.NewReadWriter(bufio.NewReader(os.Stdin), bufio.NewWriter(os.Stdout))
 	for err := menu(rw); err != nil; {
 		log.Println(err.Error())
@@ -316,6 +359,7 @@ func updateConfig(con *configuration) (err error) {
 	return
 }
 
+// generateModel prints the answer unless quiet, the tui sets it to keep the screen
 func generateModel(respBody io.Reader) (model *outModel, err error) {
 	body := new(bytes.Buffer)
 	_, err = io.Copy(body, respBody)
@@ -332,13 +376,14 @@ func generateModel(respBody io.Reader) (model *outModel, err error) {
 	if err != nil {
 		return
 	}
-	fmt.Println("body\n", bodyIndent)
+	if !quiet {
+		fmt.Println("body\n", bodyIndent)
+	}
 	return
 }
 
 func sendRequest(req *http.Request) (resp *http.Response, model *outModel, err error) {
-	client := &http.Client{}
-	resp, err = client.Do(req)
+	resp, err = httpClient.Do(req)
 	if err != nil {
 		return
 	}
@@ -404,6 +449,7 @@ func authHandler(method string, params map[string]string) (err error) {
 			return
 		}
 		config.Token = token
+		invalidateCache()
 		err = updateConfig(config)
 		if err != nil {
 			return
@@ -430,70 +476,94 @@ func loadDocHandler(method string, params map[string]string) (err error) {
 	if err != nil {
 		fpath = absPath
 	}
-	body := new(bytes.Buffer)
-	bodyWriter := multipart.NewWriter(body)
-	wmeta, err := specifyContent(bodyWriter, contentTypeJSON, metaQuery, "")
-	if err != nil {
-		return
-	}
-	fileExt := filepath.Ext(fpath)
-	meta := &metaModel{}
-	meta.Name = fpath
+	meta := newMeta(fpath, params[publicQuery], params[grantQuery])
+	_, _, err = sendDocument(method, params[idQuery], meta, file)
+	return
+}
+
+// newMeta builds the meta part of an upload, the mime type is guessed from the name
+func newMeta(name string, public string, grant string) (meta *metaModel) {
+	var err error
+	meta = &metaModel{}
+	meta.Name = name
 	meta.File = true
-	meta.Public, err = strconv.ParseBool(params[publicQuery])
+	meta.Public, err = strconv.ParseBool(public)
 	if err != nil {
 		meta.Public = false
 	}
-	if params[grantQuery] != "" {
-		meta.Grant = strings.Split(params[grantQuery], " ")
+	if grant != "" {
+		meta.Grant = strings.Split(grant, " ")
 	}
-	meta.Mime = mime.TypeByExtension(fileExt)
+	meta.Mime = mime.TypeByExtension(filepath.Ext(name))
 	if meta.Mime == "" {
 		meta.Mime = contentTypeOctet
 	}
-	metaJSON, err := json.Marshal(&meta)
-	if err != nil {
-		return
-	}
-	_, err = wmeta.Write(metaJSON)
-	if err != nil {
-		return
-	}
-	wtoken, err := specifyContent(bodyWriter, contentTypeText, tokenQuery, "")
-	if err != nil {
-		return
-	}
-	_, err = wtoken.Write(bytes.NewBufferString(config.Token).Bytes())
-	if err != nil {
-		return
-	}
-	wfile, err := specifyContent(bodyWriter, meta.Mime, fileQuery, fpath)
-	if err != nil {
-		return
-	}
-	_, err = io.Copy(wfile, file)
+	return
+}
+
+// sendDocument streams content as the file part of a multipart request,
+// so neither a file nor stdin has to be read into memory before sending
+func sendDocument(method string, id string, meta *metaModel, content io.Reader) (resp *http.Response, model *outModel, err error) {
+	metaJSON, err := json.Marshal(meta)
 	if err != nil {
 		return
 	}
-	bodyWriter.Close()
+	pr, pw := io.Pipe()
+	bodyWriter := multipart.NewWriter(pw)
+	go func() {
+		wmeta, err := specifyContent(bodyWriter, contentTypeJSON, metaQuery, "")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = wmeta.Write(metaJSON)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		wtoken, err := specifyContent(bodyWriter, contentTypeText, tokenQuery, "")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.WriteString(wtoken, config.Token)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		wfile, err := specifyContent(bodyWriter, meta.Mime, fileQuery, meta.Name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(wfile, content)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(bodyWriter.Close())
+	}()
 	var req *http.Request
 	method = strings.ToUpper(method)
 	switch method {
 	case "POST":
-		req, err = http.NewRequest(method, host+routes["docs"], body)
+		req, err = http.NewRequest(method, host+routes["docs"], pr)
 	case "PUT":
-		req, err = http.NewRequest(method, host+routes["docsID"]+params[idQuery], body)
+		req, err = http.NewRequest(method, host+routes["docsID"]+id, pr)
 	default:
-		return errWrongMethod
+		pr.Close()
+		return nil, nil, errWrongMethod
 	}
 	if err != nil {
+		pr.Close()
 		return
 	}
 	req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
-	if err != nil {
-		return
+	resp, model, err = sendRequest(req)
+	pr.Close()
+	if err == nil && model.Error == nil {
+		invalidateCache()
 	}
-	_, _, err = sendRequest(req)
 	return
 }
 
@@ -518,9 +588,8 @@ func getDocsHandler(method string, params map[string]string) (err error) {
 			return
 		}
 	case "HEAD":
-		client := &http.Client{}
 		var resp *http.Response
-		resp, err = client.Do(req)
+		resp, err = httpClient.Do(req)
 		if err != nil {
 			return
 		}
@@ -533,32 +602,25 @@ func getDocsHandler(method string, params map[string]string) (err error) {
 }
 
 func docByIDHandler(method string, params map[string]string) (err error) {
-	client := &http.Client{}
-	var req *http.Request
 	var resp *http.Response
 	method = strings.ToUpper(method)
-	req, err = http.NewRequest(method, host+routes["docsID"]+params[idQuery], nil)
-	if err != nil {
-		return
-	}
-	req.Header.Set("Content-type", contentTypeURL)
-	req.URL.RawQuery = tokenQuery + "=" + config.Token
 	switch method {
 	case "GET":
-		resp, err = client.Do(req)
+		resp, err = requestDocument(method, params[idQuery])
 		if err != nil {
 			return
 		}
 		defer resp.Body.Close()
-		reg := regexp.MustCompile(`filename=(.*)$`)
-		res := reg.FindStringSubmatch(resp.Header.Get("Content-Disposition"))
-		if res != nil {
-			var f *os.File
-			fname := filepath.Join(dataPath, res[1])
-			os.MkdirAll(filepath.Dir(fname), os.ModeDir)
-			f, err = os.OpenFile(fname, os.O_EXCL|os.O_CREATE, 0777)
+		fname := attachmentName(resp)
+		if fname != "" {
+			fname, err = safeName(fname)
 			if err != nil {
-				return errors.New(fname + "already exists")
+				return
+			}
+			var f *os.File
+			f, err = createDownload(filepath.Join(dataPath, fname), params[existsQuery])
+			if err != nil || f == nil {
+				return
 			}
 			defer f.Close()
 			_, err = io.Copy(f, resp.Body)
@@ -566,7 +628,7 @@ func docByIDHandler(method string, params map[string]string) (err error) {
 		}
 		_, err = generateModel(resp.Body)
 	case "HEAD":
-		resp, err = client.Do(req)
+		resp, err = requestDocument(method, params[idQuery])
 		if err != nil {
 			return
 		}
@@ -578,6 +640,80 @@ func docByIDHandler(method string, params map[string]string) (err error) {
 	return
 }
 
+// requestDocument asks the server for the document, the caller is to close the body
+func requestDocument(method string, id string) (resp *http.Response, err error) {
+	var req *http.Request
+	req, err = http.NewRequest(method, host+routes["docsID"]+id, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-type", contentTypeURL)
+	req.URL.RawQuery = tokenQuery + "=" + config.Token
+	resp, err = httpClient.Do(req)
+	return
+}
+
+// attachmentName returns the file name the server has sent the document with
+// or "" if the response is not a document
+func attachmentName(resp *http.Response) string {
+	reg := regexp.MustCompile(`filename=(.*)$`)
+	res := reg.FindStringSubmatch(resp.Header.Get("Content-Disposition"))
+	if res == nil {
+		return ""
+	}
+	return res[1]
+}
+
+// safeName makes the file name given by the server relative and free of `..`,
+// so a document can never be written outside the data directory
+func safeName(name string) (string, error) {
+	name = strings.Trim(name, `"`)
+	name = filepath.Clean(filepath.FromSlash(strings.Replace(name, `\`, "/", -1)))
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || name == "." {
+		return "", fmt.Errorf("unsafe file name from the server: %q", name)
+	}
+	for _, part := range strings.Split(name, string(filepath.Separator)) {
+		if part == ".." {
+			return "", fmt.Errorf("unsafe file name from the server: %q", name)
+		}
+	}
+	return name, nil
+}
+
+// createDownload opens fname for writing according to the strategy for existing files,
+// f is nil without an error when the download is to be skipped
+func createDownload(fname string, strategy string) (f *os.File, err error) {
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return
+	}
+	switch strategy {
+	case existsOverwrite:
+		return os.OpenFile(fname, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	case existsFail, existsSkip, existsRename:
+	default:
+		return nil, fmt.Errorf("unknown strategy %q, possible variants: %s, %s, %s", strategy, existsOverwrite, existsRename, existsSkip)
+	}
+	f, err = os.OpenFile(fname, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil || !os.IsExist(err) {
+		return
+	}
+	switch strategy {
+	case existsSkip:
+		log.Println(fname + " already exists, skipped")
+		return nil, nil
+	case existsRename:
+		ext := filepath.Ext(fname)
+		base := strings.TrimSuffix(fname, ext)
+		for i := 1; os.IsExist(err); i++ {
+			f, err = os.OpenFile(fmt.Sprintf("%s_%d%s", base, i, ext), os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644)
+		}
+		return
+	}
+	return nil, errors.New(fname + " already exists, choose one of the strategies: " +
+		strings.Join([]string{existsOverwrite, existsRename, existsSkip}, ", "))
+}
+
 func deleteDocHandler(method string, params map[string]string) (err error) {
 	var req *http.Request
 	method = strings.ToUpper(method)
@@ -590,6 +726,7 @@ func deleteDocHandler(method string, params map[string]string) (err error) {
 	switch method {
 	case "DELETE":
 		_, _, err = sendRequest(req)
+		invalidateCache()
 	default:
 		return errWrongMethod
 	}
@@ -619,6 +756,7 @@ func logoutHandler(method string, params map[string]string) (err error) {
 		if cool {
 			log.Println("successively logged out")
 			config.Token = ""
+			invalidateCache()
 			updateConfig(config)
 			return
 		}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stdStream is the name which stands for stdin or stdout in the command arguments
+const stdStream = "-"
+
+type commandFunc func(args []string) error
+
+var commandCase = map[string]commandFunc{
+	"upload": uploadCommand,
+	"get":    getCommand,
+	"list":   listCommand,
+	"tui":    tuiCommand,
+	"share":  shareCommand,
+	"bench":  benchCommand,
+
+	"export-manifest": exportManifestCommand,
+	"import-manifest": importManifestCommand,
+}
+
+// runCommand runs a single command without the menu, so the client can be used in pipelines:
+//
+//	pg_dump mydb | docscli upload -name dump.sql -
+//	docscli get 1a2b3c -o - | gzip > dump.sql.gz
+func runCommand(args []string) (err error) {
+	command, ok := commandCase[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commandCase))
+		for k := range commandCase {
+			names = append(names, k)
+		}
+		return fmt.Errorf("unknown command %q, possible variants: %s", args[0], strings.Join(names, ", "))
+	}
+	return command(args[1:])
+}
+
+// splitPositional lets the positional argument go before the flags (get <id> -o -) as well as after them
+func splitPositional(fs *flag.FlagSet, args []string) (positional string, err error) {
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == stdStream) {
+		positional = args[0]
+		args = args[1:]
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if positional == "" {
+		positional = fs.Arg(0)
+	}
+	return
+}
+
+func uploadCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	name := fs.String("name", "", "document name, required when reading from stdin")
+	id := fs.String("id", "", "id of the document to replace (PUT instead of POST)")
+	public := fs.String("public", "false", "whether the document is public")
+	visibility := fs.String("visibility", "", "private, unlisted (read by the ones with its id) or public, instead of -public")
+	grant := fs.String("grant", "", "space separated logins to grant access to")
+	fpath, err := splitPositional(fs, args)
+	if err != nil {
+		return
+	}
+	if fpath == "" {
+		return errors.New("upload: file path or - for stdin is required")
+	}
+	var content io.Reader
+	if fpath == stdStream {
+		if *name == "" {
+			return errors.New("upload: -name is required when reading from stdin")
+		}
+		content = os.Stdin
+	} else {
+		var f *os.File
+		f, err = os.Open(filepath.Clean(fpath))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		content = f
+		if *name == "" {
+			*name = filepath.Base(fpath)
+		}
+	}
+	method := "POST"
+	if *id != "" {
+		method = "PUT"
+	}
+	meta := newMeta(*name, *public, *grant)
+	meta.Visibility = *visibility
+	_, model, err := sendDocument(method, *id, meta, content)
+	if err != nil {
+		return
+	}
+	if model.Error != nil {
+		return errors.New(model.Error.Text)
+	}
+	return
+}
+
+func getCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	out := fs.String("o", "", "output file, - for stdout (default: the server file name under "+dataPath+")")
+	overwrite := fs.Bool(existsOverwrite, false, "overwrite the file if it exists")
+	rename := fs.Bool(existsRename, false, "save under a suffixed name if the file exists")
+	skip := fs.Bool(existsSkip, false, "do nothing if the file exists")
+	id, err := splitPositional(fs, args)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return errors.New("get: document id is required")
+	}
+	var strategy string
+	for k, v := range map[string]bool{existsOverwrite: *overwrite, existsRename: *rename, existsSkip: *skip} {
+		if !v {
+			continue
+		}
+		if strategy != "" {
+			return errors.New("get: only one of -overwrite, -rename and -skip may be set")
+		}
+		strategy = k
+	}
+	resp, err := requestDocument("GET", id)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	fname := attachmentName(resp)
+	if fname == "" {
+		return responseError(resp)
+	}
+	var w io.Writer
+	switch *out {
+	case stdStream:
+		w = os.Stdout
+	case "":
+		fname, err = safeName(fname)
+		if err != nil {
+			return
+		}
+		*out = filepath.Join(dataPath, fname)
+		fallthrough
+	default:
+		var f *os.File
+		f, err = createDownload(*out, strategy)
+		if err != nil || f == nil {
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, resp.Body)
+	return
+}
+
+// responseError turns a json answer that came instead of a document into an error
+// without printing anything to stdout, which may be a pipe
+func responseError(resp *http.Response) (err error) {
+	model := &outModel{}
+	err = json.NewDecoder(resp.Body).Decode(model)
+	if err != nil {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if model.Error != nil {
+		return fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	return fmt.Errorf("unexpected response: %s", resp.Status)
+}
+
+func listCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	params := map[string]*string{
+		loginQuery: fs.String(loginQuery, "", "whose documents to list (admin only)"),
+		keyQuery:   fs.String(keyQuery, "", "column to filter by"),
+		valueQuery: fs.String(valueQuery, "", "value of the filter column"),
+		limitQuery: fs.String(limitQuery, "", "maximum number of documents"),
+	}
+	offline := fs.Bool("offline", false, "show the cached listing without asking the server")
+	maxAge := fs.Duration("max-age", 30*time.Second, "show the cached listing if it is not older than this")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	q := make(url.Values, len(params))
+	for k, v := range params {
+		q.Set(k, *v)
+	}
+	query := q.Encode()
+	key := listingKey(query)
+	var cached *cachedListing
+	if cache != nil {
+		cached, err = cache.get(key)
+		if err != nil {
+			return
+		}
+	}
+	if *offline {
+		if cached == nil {
+			return errors.New("list: the listing has never been fetched, nothing to show offline")
+		}
+		return printListing(cached)
+	}
+	if cached != nil && time.Since(cached.Fetched) <= *maxAge {
+		return printListing(cached)
+	}
+	req, err := http.NewRequest("GET", host+routes["docs"]+"?"+query, nil)
+	if err != nil {
+		return
+	}
+	q = req.URL.Query()
+	q.Set(tokenQuery, config.Token)
+	req.URL.RawQuery = q.Encode()
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		// the listing is the cached one, it is fresh for max-age again
+		cached.Fetched = time.Now()
+		err = cache.put(key, cached)
+		if err != nil {
+			return
+		}
+		return printListing(cached)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	model := &outModel{}
+	err = json.Unmarshal(body, model)
+	if err != nil {
+		return
+	}
+	if model.Error != nil {
+		return fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	cached = &cachedListing{Body: body, ETag: resp.Header.Get("ETag"), Fetched: time.Now()}
+	if cache != nil {
+		err = cache.put(key, cached)
+		if err != nil {
+			return
+		}
+	}
+	return printListing(cached)
+}
+
+func printListing(l *cachedListing) (err error) {
+	buf := new(bytes.Buffer)
+	err = json.Indent(buf, l.Body, "", "    ")
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "fetched at %s\n", l.Fetched.Format(timeFormat))
+	_, err = fmt.Println(buf)
+	return
+}
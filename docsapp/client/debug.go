@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"os"
+	"regexp"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var (
+	querySecretReg = regexp.MustCompile(`((?:token|password)=)[^&\s]*`)
+	jsonSecretReg  = regexp.MustCompile(`("(?:\w*token|password)"\s*:\s*")[^"]*`)
+	bearerReg      = regexp.MustCompile(`(Authorization: Bearer )\S*`)
+	// logoutPathReg is of the token in the path of the logout, DELETE /auth/{token}
+	logoutPathReg = regexp.MustCompile(`(/auth/)([^\s?/]+)`)
+)
+
+// debugTransport dumps every request and response with the timings of its phases,
+// it is switched on by --debug to have something to attach to a bug report
+type debugTransport struct {
+	next http.RoundTripper
+	log  *log.Logger
+}
+
+// newDebugTransport appends to the log file at path
+func newDebugTransport(next http.RoundTripper, path string) (t *debugTransport, err error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	return &debugTransport{next: next, log: log.New(f, "", log.LstdFlags|log.Lmicroseconds)}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *debugTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var start, dnsStart, connectStart, tlsStart time.Time
+	var dns, connect, handshake, ttfb time.Duration
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dns = time.Since(dnsStart) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connect = time.Since(connectStart) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { handshake = time.Since(tlsStart) },
+		GotFirstResponseByte: func() { ttfb = time.Since(start) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	// the uploads are streamed and may be binary, only the forms and the json are dumped with the body
+	dump, err := httputil.DumpRequestOut(req, dumpedBody(req.Header.Get("Content-Type")))
+	if err != nil {
+		t.log.Printf("failed to dump the request: %v", err)
+	} else {
+		t.log.Printf("request\n%s", redact(dump))
+	}
+	start = time.Now()
+	resp, err = t.next.RoundTrip(req)
+	total := time.Since(start)
+	if err != nil {
+		t.log.Printf("error after %v: %v", total, err)
+		return
+	}
+	dump, err = httputil.DumpResponse(resp, dumpedResponseBody(resp))
+	if err != nil {
+		t.log.Printf("failed to dump the response: %v", err)
+	} else {
+		t.log.Printf("response\n%s", redact(dump))
+	}
+	t.log.Printf("timings: dns %v, connect %v, tls %v, ttfb %v, total %v", dns, connect, handshake, ttfb, total)
+	return resp, nil
+}
+
+// dumpedBody reports whether the body of contentType is dumped: the forms and the json are, the files aren't
+func dumpedBody(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return contentType == "" || mediaType == "application/x-www-form-urlencoded" || mediaType == "application/json"
+}
+
+// dumpedResponseBody reports whether the body of resp is dumped: documents may be huge and binary
+// and the event feed never ends, only the other answers of the api are
+func dumpedResponseBody(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return resp.Header.Get("Content-Disposition") == "" && mediaType != "text/event-stream"
+}
+
+// redact hides the tokens and the password wherever they may appear: the headers, the query, the path of the logout, forms and json bodies
+func redact(dump []byte) []byte {
+	if config.Token != "" {
+		dump = bytes.Replace(dump, []byte(config.Token), []byte(redacted), -1)
+	}
+	dump = bearerReg.ReplaceAll(dump, []byte("${1}"+redacted))
+	dump = logoutPathReg.ReplaceAllFunc(dump, func(m []byte) []byte {
+		// /auth/refresh is a route of its own
+		if string(m) == "/auth/refresh" {
+			return m
+		}
+		return []byte("/auth/" + redacted)
+	})
+	dump = querySecretReg.ReplaceAll(dump, []byte("${1}"+redacted))
+	return jsonSecretReg.ReplaceAll(dump, []byte("${1}"+redacted))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactHidesTheSecrets(t *testing.T) {
+	dump := string(redact([]byte(`POST /auth HTTP/1.1
+Authorization: Bearer abc.def.ghi
+
+login=ann&password=secret1
+{"response":{"token":"t1","refresh_token":"r1","scope":["docs:read"]}}`)))
+	for _, secret := range []string{"abc.def.ghi", "secret1", `"t1"`, `"r1"`} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("%s is in the dump:\n%s", secret, dump)
+		}
+	}
+	if !strings.Contains(dump, "login=ann") || !strings.Contains(dump, "docs:read") {
+		t.Errorf("the dump has lost more than the secrets:\n%s", dump)
+	}
+}
+
+func TestRedactHidesTheTokenOfTheLogout(t *testing.T) {
+	dump := string(redact([]byte("DELETE /auth/abc.def.ghi HTTP/1.1\nPOST /auth/refresh HTTP/1.1")))
+	if strings.Contains(dump, "abc.def.ghi") || !strings.Contains(dump, "/auth/refresh") {
+		t.Errorf("the dump is\n%s", dump)
+	}
+}
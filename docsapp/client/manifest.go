@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestLimit is the limit of the listings of the manifest commands, all the documents of a user
+const manifestLimit = "1000000"
+
+// manifest describes the documents of a user on a server to move them to another one
+type manifest struct {
+	Server   string           `json:"server"`
+	Created  string           `json:"created"`
+	Settings manifestSettings `json:"settings"`
+	Docs     []*manifestEntry `json:"docs"`
+}
+
+// manifestSettings is the configuration of the client worth taking along, the token is not
+type manifestSettings struct {
+	DataPath string `json:"data_path"`
+}
+
+// manifestEntry is a document, Path is its local copy and SHA256 the hash of the copy, both empty without one
+type manifestEntry struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Mime   string   `json:"mime"`
+	Public bool     `json:"public"`
+	Grant  []string `json:"grant"`
+	Path   string   `json:"path,omitempty"`
+	SHA256 string   `json:"sha256,omitempty"`
+}
+
+// remote is a server with the token of the user there
+type remote struct {
+	target string
+	token  string
+	client *http.Client
+}
+
+func newRemote(target string, token string) *remote {
+	return &remote{target: strings.TrimSuffix(target, "/"), token: token, client: httpClient}
+}
+
+// list fetches all the documents of the user
+func (r *remote) list() (docs []*manifestEntry, err error) {
+	q := url.Values{tokenQuery: {r.token}, limitQuery: {manifestLimit}}
+	resp, err := r.client.Get(r.target + routes["docs"] + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var model struct {
+		Error *errorModel `json:"error"`
+		Data  struct {
+			Docs []*manifestEntry `json:"docs"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&model)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	// the server answers an empty listing with an error of the code 200
+	if model.Error != nil && model.Error.Code != http.StatusOK {
+		return nil, fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	return model.Data.Docs, nil
+}
+
+// download writes the document to w
+func (r *remote) download(id string, w io.Writer) (err error) {
+	q := url.Values{tokenQuery: {r.token}}
+	resp, err := r.client.Get(r.target + routes["docsID"] + id + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if attachmentName(resp) == "" {
+		return responseError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return
+}
+
+// upload posts the document under the base of its name, the server keeps the base of a uuid name
+// so the document is found by it on both servers
+func (r *remote) upload(e *manifestEntry, content io.Reader) (err error) {
+	meta := &metaModel{Name: docKey(e.Name), File: true,
+		Public: e.Public, Mime: e.Mime, Grant: e.Grant}
+	body, contentType, err := multipartDocument(meta, r.token, content)
+	if err != nil {
+		return
+	}
+	resp, err := r.client.Post(r.target+routes["docs"], contentType, body)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	return apiError(resp)
+}
+
+// docKey is the base of the name of the document, the same on both servers
+func docKey(name string) string {
+	return filepath.Base(filepath.FromSlash(strings.Replace(name, `\`, "/", -1)))
+}
+
+// hashFile is the hex sha256 of the file
+func hashFile(path string) (sum string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// exportManifestCommand writes the manifest of the documents of the user:
+//
+//	docscli export-manifest -fetch -o manifest.json
+func exportManifestCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("export-manifest", flag.ContinueOnError)
+	out := fs.String("o", stdStream, "output file, - for stdout")
+	fetch := fs.Bool("fetch", false, "download the documents without a local copy under "+dataPath)
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	r := newRemote(host, config.Token)
+	docs, err := r.list()
+	if err != nil {
+		return
+	}
+	m := &manifest{Server: host, Created: time.Now().Format(timeFormat), Settings: manifestSettings{DataPath: dataPath}, Docs: docs}
+	for _, e := range m.Docs {
+		var name string
+		name, err = safeName(e.Name)
+		if err != nil {
+			return
+		}
+		path := filepath.Join(dataPath, name)
+		_, err = os.Stat(path)
+		if os.IsNotExist(err) && *fetch {
+			err = fetchDocument(r, e.ID, path)
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		e.Path = filepath.ToSlash(path)
+		e.SHA256, err = hashFile(path)
+		if err != nil {
+			return
+		}
+	}
+	w := io.Writer(os.Stdout)
+	if *out != stdStream {
+		var f *os.File
+		f, err = os.Create(*out)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(m)
+}
+
+func fetchDocument(r *remote, id string, path string) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	err = r.download(id, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
+
+// importManifestCommand uploads the documents of the manifest the target server doesn't have
+// from their local copies and reports the ones it has and the ones without a copy:
+//
+//	docscli import-manifest -target http://new:8080 -token ... manifest.json
+func importManifestCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("import-manifest", flag.ContinueOnError)
+	target := fs.String("target", host, "server to import to")
+	token := fs.String("token", "", "token of the user on the target (default: the token of config.json)")
+	dryRun := fs.Bool("dry-run", false, "only report what would be uploaded")
+	verify := fs.Bool("verify", false, "download the documents the target has and compare their hashes")
+	in, err := splitPositional(fs, args)
+	if err != nil {
+		return
+	}
+	if in == "" {
+		return errors.New("import-manifest: manifest file or - for stdin is required")
+	}
+	var data []byte
+	if in == stdStream {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(in)
+	}
+	if err != nil {
+		return
+	}
+	m := &manifest{}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return fmt.Errorf("import-manifest: %v", err)
+	}
+	if *token == "" {
+		*token = config.Token
+	}
+	r := newRemote(*target, *token)
+	docs, err := r.list()
+	if err != nil {
+		return
+	}
+	existing := make(map[string]*manifestEntry, len(docs))
+	for _, d := range docs {
+		existing[docKey(d.Name)] = d
+	}
+	var uploaded, present, mismatched, missing, failed int
+	for _, e := range m.Docs {
+		if d, ok := existing[docKey(e.Name)]; ok {
+			present++
+			if *verify && e.SHA256 != "" {
+				h := sha256.New()
+				err = r.download(d.ID, h)
+				if err != nil {
+					return
+				}
+				if hex.EncodeToString(h.Sum(nil)) != e.SHA256 {
+					mismatched++
+					fmt.Fprintf(os.Stderr, "%s: differs on the target as %s\n", e.ID, d.ID)
+				}
+			}
+			continue
+		}
+		if e.Path == "" {
+			missing++
+			fmt.Fprintf(os.Stderr, "%s: no local copy, get it and export the manifest again\n", e.ID)
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("%s: would upload %s\n", e.ID, e.Path)
+			continue
+		}
+		err = importEntry(r, e)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", e.ID, err)
+			continue
+		}
+		uploaded++
+	}
+	if uploaded > 0 {
+		invalidateCache()
+	}
+	fmt.Printf("%d uploaded, %d already there (%d differ), %d without a local copy, %d failed\n", uploaded, present, mismatched, missing, failed)
+	if failed > 0 || mismatched > 0 {
+		return errors.New("import-manifest: the target doesn't match the manifest")
+	}
+	return nil
+}
+
+// importEntry uploads the local copy of e checking it has not changed since the export
+func importEntry(r *remote, e *manifestEntry) (err error) {
+	path := filepath.FromSlash(e.Path)
+	if e.SHA256 != "" {
+		var sum string
+		sum, err = hashFile(path)
+		if err != nil {
+			return
+		}
+		if sum != e.SHA256 {
+			return fmt.Errorf("%s has changed since the export", e.Path)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return r.upload(e, f)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+const (
+	signedURLRoute = "signed-url"
+	ttlQuery       = "ttl"
+	// qrQuiet is the white border of a qr code in modules, the scanners need it
+	qrQuiet = 2
+)
+
+// clipboards are the commands the text is piped to by copyToClipboard, the first one there is taken
+var clipboards = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux":   {{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}},
+}
+
+// shareCommand asks the server for a signed url of the document, the one anyone may download it by
+// until it expires, and prints it, puts it on the clipboard with -copy and draws it as a qr code with -qr:
+//
+//	docscli share 1a2b3c -ttl 1h -copy -qr
+func shareCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("share", flag.ContinueOnError)
+	ttl := fs.String(ttlQuery, "", "how long the url lives, 10m by default of the server")
+	copyURL := fs.Bool("copy", false, "put the url on the system clipboard")
+	qrCode := fs.Bool("qr", false, "print the url as a qr code to scan it with a phone")
+	id, err := splitPositional(fs, args)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return errors.New("share: document id is required")
+	}
+	quiet = true
+	u, err := signedURL(id, *ttl)
+	if err != nil {
+		return
+	}
+	fmt.Println(u)
+	if *qrCode {
+		err = printQR(os.Stdout, u)
+		if err != nil {
+			return
+		}
+	}
+	if *copyURL {
+		err = copyToClipboard(u)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "the url is copied to the clipboard")
+	}
+	return
+}
+
+// signedURL returns the url anyone may download the document with until ttl passes, "" is the default of the server
+func signedURL(id string, ttl string) (u string, err error) {
+	q := url.Values{tokenQuery: {config.Token}}
+	if ttl != "" {
+		q.Set(ttlQuery, ttl)
+	}
+	model, err := requestModel("GET", host+routes["docsID"]+id+"/"+signedURLRoute+"?"+q.Encode())
+	if err != nil {
+		return
+	}
+	u, _ = model.Response["url"].(string)
+	if u == "" {
+		return "", errors.New("the server has sent no url")
+	}
+	return
+}
+
+// copyToClipboard pipes text to the clipboard command of the system
+func copyToClipboard(text string) (err error) {
+	for _, c := range clipboards[runtime.GOOS] {
+		if _, err = exec.LookPath(c[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard command is found on %s", runtime.GOOS)
+}
+
+// printQR draws text as a qr code of half blocks, two rows of modules a line: the light modules
+// and the quiet border are the blocks, the dark ones are the background of the usual dark terminals
+func printQR(w io.Writer, text string) (err error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return
+	}
+	black := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+	var b strings.Builder
+	for y := -qrQuiet; y < code.Size+qrQuiet; y += 2 {
+		for x := -qrQuiet; x < code.Size+qrQuiet; x++ {
+			switch top, bottom := black(x, y), black(x, y+1); {
+			case top && bottom:
+				b.WriteString(" ")
+			case top:
+				b.WriteString("▄")
+			case bottom:
+				b.WriteString("▀")
+			default:
+				b.WriteString("█")
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return
+}
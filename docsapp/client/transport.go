@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	dialTimeout         = 10 * time.Second
+	keepAlive           = 30 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	maxIdleConns        = 100
+	maxIdleConnsPerHost = 10
+)
+
+var (
+	// httpClient is the one client of the requests, its transport keeps the connections to the server
+	httpClient *http.Client
+	// streamClient shares the transport of httpClient without its timeout, the event feed is endless
+	streamClient *http.Client
+	proxyURL     string
+	timeout      time.Duration
+	http2        bool
+)
+
+// newTransport makes the transport of the client: the proxy of -proxy or of HTTP_PROXY, HTTPS_PROXY and NO_PROXY,
+// idle connections kept for the next requests and HTTP/2 with the https servers if -http2 is set
+func newTransport() (t *http.Transport, err error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		var u *url.URL
+		u, err = url.Parse(proxyURL)
+		if err != nil {
+			return
+		}
+		proxy = http.ProxyURL(u)
+	}
+	t = &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		IdleConnTimeout:       idleConnTimeout,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     http2,
+	}
+	if !http2 {
+		// a non-nil empty map switches HTTP/2 off
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return
+}
+
+// initClients builds httpClient and streamClient on transport after the flags are parsed
+func initClients() (err error) {
+	transport, err = newTransport()
+	if err != nil {
+		return
+	}
+	if debug {
+		transport, err = newDebugTransport(transport, debugLog)
+		if err != nil {
+			return
+		}
+	}
+	httpClient = &http.Client{Transport: transport, Timeout: timeout}
+	streamClient = &http.Client{Transport: transport}
+	return
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	eventsRoute = "/events"
+	// tuiRetry is the pause before the event feed is opened again after it has broken
+	tuiRetry = 5 * time.Second
+	tuiHelp  = "[yellow]d[-] download  [yellow]x[-] delete  [yellow]s[-] share  [yellow]g[-] grants  [yellow]r[-] refresh  [yellow]q[-] quit"
+)
+
+// tuiDoc is a document of the listing of the server
+type tuiDoc struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Mime       string   `json:"mime"`
+	File       bool     `json:"file"`
+	Public     bool     `json:"public"`
+	Created    string   `json:"created"`
+	Grant      []string `json:"grant"`
+	Visibility string   `json:"visibility"`
+	Groups     []string `json:"groups"`
+	ExpiresAt  string   `json:"expires_at"`
+}
+
+// feedEvent is the data of an event of the feed, the fields of an upload and of a job together
+type feedEvent struct {
+	Kind    string `json:"kind"`
+	State   string `json:"state"`
+	Percent int64  `json:"percent"`
+	Doc     string `json:"doc"`
+	Error   string `json:"error"`
+}
+
+// browser is the full-screen document browser: the listing on the left, the meta of the current document
+// on the right and the state of the actions and the events below
+type browser struct {
+	app    *tview.Application
+	pages  *tview.Pages
+	list   *tview.List
+	meta   *tview.TextView
+	status *tview.TextView
+	docs   []tuiDoc
+	limit  string
+}
+
+// tuiCommand runs the browser until q, the listing follows the uploads and the jobs of the event feed
+func tuiCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	limit := fs.String(limitQuery, "", "maximum number of documents")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if config.Token == "" {
+		return errors.New("tui: authorize first")
+	}
+	// the screen is the tui's, the answers and the log would break it
+	quiet = true
+	log.SetOutput(ioutil.Discard)
+	b := newBrowser(*limit)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.follow(ctx)
+	go b.refresh("")
+	return b.app.Run()
+}
+
+func newBrowser(limit string) *browser {
+	b := &browser{app: tview.NewApplication(), pages: tview.NewPages(), list: tview.NewList(),
+		meta: tview.NewTextView(), status: tview.NewTextView(), limit: limit}
+	b.list.ShowSecondaryText(false)
+	b.list.SetBorder(true)
+	b.list.SetTitle(" documents ")
+	b.list.SetChangedFunc(func(i int, _ string, _ string, _ rune) { b.showMeta(i) })
+	b.list.SetInputCapture(b.keys)
+	b.meta.SetDynamicColors(true)
+	b.meta.SetBorder(true)
+	b.meta.SetTitle(" meta ")
+	b.status.SetDynamicColors(true)
+	help := tview.NewTextView().SetDynamicColors(true).SetText(tuiHelp)
+	panes := tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(b.list, 0, 1, true).
+		AddItem(b.meta, 0, 2, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(panes, 0, 1, true).
+		AddItem(b.status, 1, 0, false).
+		AddItem(help, 1, 0, false)
+	b.pages.AddPage("main", root, true, true)
+	b.app.SetRoot(b.pages, true)
+	return b
+}
+
+// keys are the actions on the current document
+func (b *browser) keys(e *tcell.EventKey) *tcell.EventKey {
+	if e.Key() != tcell.KeyRune {
+		return e
+	}
+	if e.Rune() == 'q' {
+		b.app.Stop()
+		return nil
+	}
+	if e.Rune() == 'r' {
+		go b.refresh("")
+		return nil
+	}
+	doc := b.current()
+	if doc == nil {
+		return e
+	}
+	switch e.Rune() {
+	case 'd':
+		go b.do("downloaded to ", func() (string, error) { return download(doc.ID) })
+	case 'x':
+		b.confirm("Delete "+doc.Name+"?", func() {
+			go b.do("deleted "+doc.Name, func() (string, error) {
+				err := deleteDocument(doc.ID)
+				if err == nil {
+					b.refresh("")
+				}
+				return "", err
+			})
+		})
+	case 's':
+		go b.do("", func() (string, error) { return signedURL(doc.ID, "") })
+	case 'g':
+		b.editGrants(*doc)
+	default:
+		return e
+	}
+	return nil
+}
+
+// current returns the document under the cursor or nil if the listing is empty
+func (b *browser) current() *tuiDoc {
+	i := b.list.GetCurrentItem()
+	if i < 0 || i >= len(b.docs) {
+		return nil
+	}
+	return &b.docs[i]
+}
+
+// do runs action away from the screen and shows prefix and its result or its error in the status line
+func (b *browser) do(prefix string, action func() (string, error)) {
+	b.setStatus("[yellow]…[-]")
+	res, err := action()
+	if err != nil {
+		b.setStatus("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	b.setStatus(tview.Escape(prefix + res))
+}
+
+func (b *browser) setStatus(text string) {
+	b.app.QueueUpdateDraw(func() { b.status.SetText(text) })
+}
+
+// refresh asks the server for the listing, the cursor stays on the document with id if it is still there
+func (b *browser) refresh(id string) {
+	docs, err := listDocuments(b.limit)
+	if err != nil {
+		b.setStatus("[red]" + tview.Escape(err.Error()) + "[-]")
+		return
+	}
+	b.app.QueueUpdateDraw(func() {
+		if id == "" {
+			if doc := b.current(); doc != nil {
+				id = doc.ID
+			}
+		}
+		b.docs = docs
+		b.list.Clear()
+		current := 0
+		for i, doc := range docs {
+			b.list.AddItem(tview.Escape(doc.Name), "", 0, nil)
+			if doc.ID == id {
+				current = i
+			}
+		}
+		b.list.SetCurrentItem(current)
+		b.showMeta(current)
+	})
+}
+
+func (b *browser) showMeta(i int) {
+	if i < 0 || i >= len(b.docs) {
+		b.meta.SetText("")
+		return
+	}
+	doc := b.docs[i]
+	lines := []string{
+		"[yellow]id[-]          " + doc.ID,
+		"[yellow]name[-]        " + tview.Escape(doc.Name),
+		"[yellow]mime[-]        " + doc.Mime,
+		"[yellow]file[-]        " + fmt.Sprint(doc.File),
+		"[yellow]visibility[-]  " + doc.Visibility,
+		"[yellow]created[-]     " + doc.Created,
+		"[yellow]grant[-]       " + tview.Escape(strings.Join(doc.Grant, " ")),
+	}
+	if len(doc.Groups) > 0 {
+		lines = append(lines, "[yellow]groups[-]      "+tview.Escape(strings.Join(doc.Groups, " ")))
+	}
+	if doc.ExpiresAt != "" {
+		lines = append(lines, "[yellow]expires at[-]  "+doc.ExpiresAt)
+	}
+	b.meta.SetText(strings.Join(lines, "\n"))
+}
+
+// confirm asks text with Yes and No, yes is called on Yes
+func (b *browser) confirm(text string, yes func()) {
+	modal := tview.NewModal().SetText(text).AddButtons([]string{"Yes", "No"}).
+		SetDoneFunc(func(i int, _ string) {
+			b.pages.RemovePage("confirm")
+			b.app.SetFocus(b.list)
+			if i == 0 {
+				yes()
+			}
+		})
+	b.pages.AddPage("confirm", modal, true, true)
+	b.app.SetFocus(modal)
+}
+
+// editGrants asks the space separated logins of the grant of doc, Esc leaves them as they are
+func (b *browser) editGrants(doc tuiDoc) {
+	if !doc.File {
+		b.status.SetText("[red]only the grants of files are changed here[-]")
+		return
+	}
+	input := tview.NewInputField().SetLabel("grant: ").SetText(strings.Join(doc.Grant, " "))
+	input.SetDoneFunc(func(key tcell.Key) {
+		b.pages.RemovePage("grants")
+		b.app.SetFocus(b.list)
+		if key != tcell.KeyEnter {
+			return
+		}
+		grant := input.GetText()
+		go b.do("the grants of "+doc.Name+" are changed", func() (string, error) {
+			err := changeGrants(doc, grant)
+			if err == nil {
+				b.refresh(doc.ID)
+			}
+			return "", err
+		})
+	})
+	input.SetBorder(true)
+	input.SetTitle(" " + tview.Escape(doc.Name) + " ")
+	form := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(input, 3, 0, true).
+		AddItem(nil, 0, 1, false)
+	b.pages.AddPage("grants", form, true, true)
+	b.app.SetFocus(input)
+}
+
+// follow reads the event feed until ctx is done, the listing is refreshed when an upload or a job is over
+func (b *browser) follow(ctx context.Context) {
+	for {
+		err := readEvents(ctx, func(typ string, e feedEvent) {
+			what := typ
+			if e.Kind != "" {
+				what += " " + e.Kind
+			}
+			switch e.State {
+			case "done":
+				b.setStatus(tview.Escape(what + " is done"))
+				b.refresh(e.Doc)
+			case "failed":
+				b.setStatus("[red]" + tview.Escape(what+" failed: "+e.Error) + "[-]")
+			default:
+				if typ == "upload" {
+					what += fmt.Sprintf(" %d%%", e.Percent)
+				}
+				b.setStatus(tview.Escape(what + " " + e.State))
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			b.setStatus("[red]the event feed is broken: " + tview.Escape(err.Error()) + "[-]")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(tuiRetry):
+		}
+	}
+}
+
+// readEvents calls handle with the events of the feed of the token until the feed or ctx is over
+func readEvents(ctx context.Context, handle func(typ string, e feedEvent)) (err error) {
+	req, err := http.NewRequest("GET", host+eventsRoute+"?"+tokenQuery+"="+url.QueryEscape(config.Token), nil)
+	if err != nil {
+		return
+	}
+	resp, err := streamClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	var typ, data string
+	s := bufio.NewScanner(resp.Body)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			typ = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && data != "":
+			var e feedEvent
+			if json.Unmarshal([]byte(data), &e) == nil {
+				handle(typ, e)
+			}
+			typ, data = "", ""
+		}
+	}
+	return s.Err()
+}
+
+// listDocuments returns the documents of the token
+func listDocuments(limit string) (docs []tuiDoc, err error) {
+	q := url.Values{tokenQuery: {config.Token}}
+	if limit != "" {
+		q.Set(limitQuery, limit)
+	}
+	model, err := requestModel("GET", host+routes["docs"]+"?"+q.Encode())
+	if err != nil {
+		return
+	}
+	// the listing is decoded once more into the documents
+	body, err := json.Marshal(model.Data["docs"])
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &docs)
+	return
+}
+
+// download saves the document under data/, renamed if the file is there already, and returns its path
+func download(id string) (fname string, err error) {
+	resp, err := requestDocument("GET", id)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	fname = attachmentName(resp)
+	if fname == "" {
+		return "", responseError(resp)
+	}
+	fname, err = safeName(fname)
+	if err != nil {
+		return
+	}
+	f, err := createDownload(filepath.Join(dataPath, fname), existsRename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	return f.Name(), err
+}
+
+func deleteDocument(id string) (err error) {
+	_, err = requestModel("DELETE", host+routes["docsID"]+id+"?"+tokenQuery+"="+url.QueryEscape(config.Token))
+	if err == nil {
+		invalidateCache()
+	}
+	return
+}
+
+// changeGrants uploads the file of doc again with grant, the file is streamed from the server back to it
+func changeGrants(doc tuiDoc, grant string) (err error) {
+	resp, err := requestDocument("GET", doc.ID)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if attachmentName(resp) == "" {
+		return responseError(resp)
+	}
+	meta := newMeta(doc.Name, fmt.Sprint(doc.Public), strings.TrimSpace(grant))
+	meta.Mime = doc.Mime
+	meta.Visibility = doc.Visibility
+	meta.Groups = doc.Groups
+	meta.ExpiresAt = doc.ExpiresAt
+	_, model, err := sendDocument("PUT", doc.ID, meta, resp.Body)
+	if err != nil {
+		return
+	}
+	if model.Error != nil {
+		return fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	return
+}
+
+// requestModel sends a request without a body and turns the error of the answer into an error
+func requestModel(method string, target string) (model *outModel, err error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return
+	}
+	_, model, err = sendRequest(req)
+	if err != nil {
+		return
+	}
+	if model.Error != nil {
+		return nil, fmt.Errorf("%d: %s", model.Error.Code, model.Error.Text)
+	}
+	return
+}
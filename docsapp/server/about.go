@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+)
+
+// brandConfig is what the users are shown of the instance
+type brandConfig struct {
+	Name    string `json:"name"`
+	LogoURL string `json:"logo_url"`
+	Contact string `json:"contact"`
+}
+
+// aboutConfig is the "about" of config.json, the brand of the instance and the ones of the tenants replacing it field by field
+type aboutConfig struct {
+	brandConfig
+	Tenants map[string]brandConfig `json:"tenants"`
+}
+
+// brandOf is the brand shown to the users of the tenant
+func brandOf(tenant string) brandConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	b := config.About.brandConfig
+	t, ok := config.About.Tenants[tenant]
+	if !ok {
+		return b
+	}
+	if t.Name != "" {
+		b.Name = t.Name
+	}
+	if t.LogoURL != "" {
+		b.LogoURL = t.LogoURL
+	}
+	if t.Contact != "" {
+		b.Contact = t.Contact
+	}
+	return b
+}
+
+// aboutHandler shows the brand of the instance to everyone and the one of their tenant to the users with a token
+func aboutHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	var tenant string
+	if token := r.Form.Get(tokenQuery); token != "" {
+		// a wrong token is not an error here, it only shows the brand of the instance
+		if login := tokenLogin(token); login != "" {
+			tenant, _ = myDB.GetUserTenant(r.Context(), login)
+		}
+	}
+	b := brandOf(tenant)
+	model := &outModel{}
+	model.Response = map[string]interface{}{"name": b.Name, "logo_url": b.LogoURL, "contact": b.Contact}
+	if tenant != "" {
+		model.Response[tenantQuery] = tenant
+	}
+	return sendJSON(w, model)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// accessConfig is the "access" of config.json, the lists are of CIDRs or single addresses.
+// Allow and Deny restrict the whole API, AdminAllow and AdminDeny the use of admin rights.
+// The address of a request is its remote address unless that is one of TrustedProxies,
+// then it is the last address of X-Forwarded-For not of TrustedProxies
+type accessConfig struct {
+	TrustedProxies []string `json:"trusted_proxies"`
+	Allow          []string `json:"allow"`
+	Deny           []string `json:"deny"`
+	AdminAllow     []string `json:"admin_allow"`
+	AdminDeny      []string `json:"admin_deny"`
+}
+
+// accessList denies the addresses of deny and, if allow is not empty, all but the ones of allow
+type accessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+var (
+	trustedProxies []*net.IPNet
+	apiAccess      = &accessList{}
+	adminAccess    = &accessList{}
+)
+
+// initAccess parses the lists of c, they replace the current ones under configLock only if all of them are right
+func initAccess(c accessConfig) (err error) {
+	proxies, err := parseNets(c.TrustedProxies)
+	if err != nil {
+		return
+	}
+	api, err := newAccessList(c.Allow, c.Deny)
+	if err != nil {
+		return
+	}
+	admin, err := newAccessList(c.AdminAllow, c.AdminDeny)
+	if err != nil {
+		return
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	trustedProxies = proxies
+	*apiAccess = *api
+	*adminAccess = *admin
+	return
+}
+
+func newAccessList(allow, deny []string) (l *accessList, err error) {
+	l = &accessList{}
+	l.allow, err = parseNets(allow)
+	if err != nil {
+		return
+	}
+	l.deny, err = parseNets(deny)
+	return
+}
+
+// parseNets parses CIDRs, an address without a mask is a network of itself
+func parseNets(list []string) (nets []*net.IPNet, err error) {
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		var n *net.IPNet
+		_, n, err = net.ParseCIDR(s)
+		if err != nil {
+			return
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *accessList) permits(ip net.IP) bool {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if ip == nil {
+		return len(l.allow) == 0 && len(l.deny) == 0
+	}
+	if contains(l.deny, ip) {
+		return false
+	}
+	return len(l.allow) == 0 || contains(l.allow, ip)
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// fromTrustedProxy reports whether the X-Forwarded headers of the request are to be believed
+func fromTrustedProxy(r *http.Request) bool {
+	ip := remoteIP(r)
+	return ip != nil && contains(proxies(), ip)
+}
+
+func proxies() []*net.IPNet {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return trustedProxies
+}
+
+// clientIP is the address the request came from, see accessConfig
+func clientIP(r *http.Request) net.IP {
+	ip := remoteIP(r)
+	if !fromTrustedProxy(r) {
+		return ip
+	}
+	trusted := proxies()
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// restrict answers 403 to the addresses apiAccess doesn't permit
+func restrict(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !apiAccess.permits(clientIP(r)) {
+			w.Header().Set("Content-Type", contentTypeJSON)
+			w.WriteHeader(statusAccessDenied)
+			json.NewEncoder(w).Encode(&outModel{Error: &errorModel{Code: statusAccessDenied, Text: statusText[statusAccessDenied] + ": your address is not allowed"}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin reports whether login has admin rights and uses them from an address adminAccess permits
+// with a token of the admin scope. The rights of the login signed in are the ones its token tells
+func isAdmin(r *http.Request, login string) (admin bool, err error) {
+	if !hasScope(r, scopeAdmin) {
+		return false, nil
+	}
+	if s, ok := r.Context().Value(scopeKey{}).(*tokenScope); ok && s.login != "" && s.login == login {
+		admin = s.admin
+	} else {
+		admin, err = myDB.IsAdmin(r.Context(), login)
+	}
+	if err != nil || !admin {
+		return
+	}
+	return adminAccess.permits(clientIP(r)), nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	auditRoute   = "audit"
+	confirmQuery = "confirm"
+	// deletionGraceDefault is how long a confirmed deletion waits without deletion.grace
+	deletionGraceDefault = 30 * 24 * time.Hour
+)
+
+// the actions of the audit log
+const (
+	auditDeletionRequested = "deletion requested"
+	auditDeletionConfirmed = "deletion confirmed"
+	auditDeletionCancelled = "deletion cancelled"
+	auditDeleted           = "deleted"
+	auditTakeout           = "takeout"
+)
+
+// deletionConfig is the "deletion" of config.json: Grace is how long the account is kept after its deletion
+// is confirmed, like "720h", for the user to change their mind
+type deletionConfig struct {
+	Grace string `json:"grace"`
+}
+
+var deletionGrace = deletionGraceDefault
+
+// initDeletion reads the deletion of config.json
+func initDeletion(c deletionConfig) (err error) {
+	if c.Grace != "" {
+		deletionGrace, err = time.ParseDuration(c.Grace)
+	}
+	return
+}
+
+// recordAudit adds what actor has done to the account of login to the audit log,
+// a failure is logged only as the change is made already. The actor of the server itself is empty
+func recordAudit(ctx context.Context, actor, login, action, detail string) {
+	a := &docsdb.Audit{Actor: actor, Login: login, Action: action, Detail: detail, Created: time.Now().Format(timeFormat)}
+	err := myDB.AddAudit(ctx, a)
+	if err != nil {
+		log.Printf("the audit %s of %s: %v", action, login, err)
+	}
+}
+
+// deleteAccount deletes login with its sessions, grants, group memberships, usage and the documents
+// granted to nobody else with their files, and records it for actor
+func deleteAccount(ctx context.Context, actor, login string) (err error) {
+	err = revokeLoginTokens(ctx, login)
+	if err != nil {
+		return
+	}
+	docs, err := myDB.DeleteUser(ctx, login)
+	if err != nil {
+		return
+	}
+	for _, doc := range docs {
+		err = store.Remove(previewName(doc.ID))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !doc.File {
+			continue
+		}
+		err = removeFile(ctx, doc.Name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	recordAudit(ctx, actor, login, auditDeleted, strconv.Itoa(len(docs))+" documents")
+	return nil
+}
+
+// meHandler starts the deletion of the account of the token on DELETE /me: it answers the code to confirm it with.
+// The code alone confirms nothing, the token it is answered to may be stolen: the password is asked with it
+func meHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "DELETE":
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	code := make([]byte, 16)
+	_, err = rand.Read(code)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	d := &docsdb.Deletion{Login: login, Code: hex.EncodeToString(code)}
+	err = myDB.SetDeletion(r.Context(), d)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	recordAudit(r.Context(), login, login, auditDeletionRequested, "")
+	model := &outModel{}
+	model.Response = map[string]interface{}{confirmQuery: d.Code}
+	return sendJSON(w, model)
+}
+
+// meDeletionHandler shows the deletion of the account of the token on GET /me/deletion,
+// confirms it on POST confirm=...&password=... for it to happen after deletionGrace and cancels it on DELETE
+func meDeletionHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "POST", "DELETE":
+	case "HEAD", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	d, err := myDB.GetDeletion(r.Context(), login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		start := time.Now()
+		var stored string
+		stored, err = myDB.GetPassword(r.Context(), login)
+		if err != nil && err != errNoRows {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		if match, _ := checkPassword(stored, r.PostForm.Get(passwordQuery)); stored == "" || !match {
+			authFailed(start, &err)
+			return
+		}
+		confirm := r.PostForm.Get(confirmQuery)
+		if d.Code == "" || subtle.ConstantTimeCompare([]byte(confirm), []byte(d.Code)) != 1 {
+			errorHandler(statusInvalidParameters, confirmQuery+" is the code DELETE "+routes["me"]+" has answered", &err)
+			return
+		}
+		d.Code, d.At = "", time.Now().Add(deletionGrace).Format(timeFormat)
+		err = myDB.SetDeletion(r.Context(), d)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		recordAudit(r.Context(), login, login, auditDeletionConfirmed, d.At)
+	case "DELETE":
+		if d.Code == "" && d.At == "" {
+			errorHandler(statusConflict, "the account is not being deleted", &err)
+			return
+		}
+		d.Code, d.At = "", ""
+		err = myDB.SetDeletion(r.Context(), d)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		recordAudit(r.Context(), login, login, auditDeletionCancelled, "")
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{"pending": d.Code != "", "at": d.At}
+	return sendJSON(w, model)
+}
+
+// adminUsersHandler deletes the user of the tenant of the admin at once on DELETE /admin/users/{login},
+// a super admin deletes the ones of any tenant
+func adminUsersHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "DELETE":
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	admin, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if !admin {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	user := path.Base(r.URL.Path)
+	if !isSuperAdmin(r, login) {
+		err = sameTenant(r, login, user)
+		if err != nil {
+			return
+		}
+	}
+	err = deleteAccount(r.Context(), login, user)
+	if err == errNoRows {
+		errorHandler(statusInvalidParameters, "there is no user "+user, &err)
+		return
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{user: true}
+	return sendJSON(w, model)
+}
+
+// auditHandler serves GET /admin/audit?after=...&limit=... to the super admins, the audit log of the accounts
+// the earliest first. A page goes on after the id of the last entry of the previous one,
+// its next is that id if there may be more
+func auditHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	if r.Method != "GET" {
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	if !isSuperAdmin(r, login) {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	var after int64
+	if v := r.Form.Get(afterQuery); v != "" {
+		after, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 0 {
+			errorHandler(statusInvalidParameters, afterQuery+" is the id of the last entry of the previous page", &err)
+			return
+		}
+	}
+	limit := activityLimitDefault
+	if v := r.Form.Get(limitQuery); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > activityLimitMax {
+			errorHandler(statusInvalidParameters, limitQuery+" is up to "+strconv.Itoa(activityLimitMax), &err)
+			return
+		}
+	}
+	audit, err := myDB.GetAudit(r.Context(), after, limit)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if audit == nil {
+		audit = make([]*docsdb.Audit, 0)
+	}
+	model := &outModel{}
+	model.Data = map[string]interface{}{auditRoute: audit}
+	if len(audit) == limit {
+		model.Data["next"] = audit[len(audit)-1].ID
+	}
+	return sendJSON(w, model)
+}
+
+// purgeDeletions deletes the accounts whose confirmed deletion is due
+func purgeDeletions(ctx context.Context) (n int, err error) {
+	deletions, err := myDB.GetDueDeletions(ctx, time.Now().Format(timeFormat))
+	if err != nil {
+		return
+	}
+	for _, d := range deletions {
+		err = deleteAccount(ctx, "", d.Login)
+		if err == errNoRows {
+			continue
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, "delete %s", d.Login)
+		}
+		n++
+	}
+	return n, nil
+}
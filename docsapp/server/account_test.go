@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestAccountIsDeletedAfterTheGrace(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	token := signIn(t, "leavinglogin")
+	other := signIn(t, "staylogin")
+	f, err := store.Create("leavinglogin/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "leavinglogin/a.txt", File: true, Grant: []string{"leavinglogin"}},
+		{ID: "2", Name: "shared", Grant: []string{"leavinglogin", "staylogin"}},
+	} {
+		if err = myDB.CreateDocument(ctx, d, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	model := do(t, routes["meDeletion"], meDeletionHandler, form("POST", routes["meDeletion"], url.Values{tokenQuery: {token}, confirmQuery: {"guess"}, passwordQuery: {"password1"}}))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("confirming a deletion not requested gets %+v", model.Error)
+	}
+	model = do(t, routes["me"], meHandler, httptest.NewRequest("DELETE", routes["me"]+"?token="+token, nil))
+	code, _ := model.Response[confirmQuery].(string)
+	if model.Error != nil || code == "" {
+		t.Fatalf("the deletion request is %+v", model)
+	}
+	model = do(t, routes["meDeletion"], meDeletionHandler, form("POST", routes["meDeletion"], url.Values{tokenQuery: {token}, confirmQuery: {code}}))
+	if model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("confirming a deletion without the password gets %+v", model.Error)
+	}
+	model = do(t, routes["meDeletion"], meDeletionHandler, form("POST", routes["meDeletion"], url.Values{tokenQuery: {token}, confirmQuery: {code}, passwordQuery: {"password1"}}))
+	at, _ := model.Response["at"].(string)
+	if model.Error != nil || at == "" {
+		t.Fatalf("the confirmation is %+v", model)
+	}
+	n, err := purgeDeletions(ctx)
+	if err != nil || n != 0 {
+		t.Errorf("the purge within the grace deletes %d, %v", n, err)
+	}
+	model = do(t, routes["meDeletion"], meDeletionHandler, httptest.NewRequest("DELETE", routes["meDeletion"]+"?token="+token, nil))
+	if model.Error != nil || model.Response["at"] != "" {
+		t.Errorf("the cancellation is %+v", model)
+	}
+	model = do(t, routes["meDeletion"], meDeletionHandler, httptest.NewRequest("DELETE", routes["meDeletion"]+"?token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusConflict {
+		t.Errorf("cancelling no deletion gets %+v", model.Error)
+	}
+
+	model = do(t, routes["me"], meHandler, httptest.NewRequest("DELETE", routes["me"]+"?token="+token, nil))
+	code, _ = model.Response[confirmQuery].(string)
+	deletionGrace = 0
+	defer func() { deletionGrace = deletionGraceDefault }()
+	model = do(t, routes["meDeletion"], meDeletionHandler, form("POST", routes["meDeletion"], url.Values{tokenQuery: {token}, confirmQuery: {code}, passwordQuery: {"password1"}}))
+	if model.Error != nil {
+		t.Fatalf("the second confirmation is %+v", model.Error)
+	}
+	n, err = purgeDeletions(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("the purge deletes %d, %v, want 1", n, err)
+	}
+	if tokenLogin(token) != "" {
+		t.Error("the session of a deleted user is there")
+	}
+	if _, err = myDB.GetDocument(ctx, "1"); err != errNoRows {
+		t.Errorf("the document of a deleted user is there: %v", err)
+	}
+	if _, err = store.Stat("leavinglogin/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("the file of a deleted user is there: %v", err)
+	}
+	doc, err := myDB.GetDocument(ctx, "2")
+	if err != nil || len(doc.Grant) != 1 || doc.Grant[0] != "staylogin" {
+		t.Errorf("the shared document is %+v, %v, want granted to staylogin", doc, err)
+	}
+	model = do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?token="+other, nil))
+	if model.Error != nil {
+		t.Errorf("the other user can't list: %+v", model.Error)
+	}
+
+	audit, err := myDB.GetAudit(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, a := range audit {
+		actions = append(actions, a.Action)
+	}
+	want := []string{auditDeletionRequested, auditDeletionConfirmed, auditDeletionCancelled, auditDeletionRequested, auditDeletionConfirmed, auditDeleted}
+	if len(actions) != len(want) {
+		t.Fatalf("the audit log is %q, want %q", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Errorf("the audit log is %q, want %q", actions, want)
+			break
+		}
+	}
+}
+
+func TestAdminDeletesAccount(t *testing.T) {
+	useDB(t, inmem.New())
+	values := url.Values{loginQuery: {"deleteradmin"}, passwordQuery: {"password1"}, tokenQuery: {config.AdminToken}}
+	if model := do(t, routes["register"], registerHandler, form("POST", routes["register"], values)); model.Error != nil {
+		t.Fatalf("register the admin: %+v", model.Error)
+	}
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], url.Values{loginQuery: {"deleteradmin"}, passwordQuery: {"password1"}}))
+	if model.Error != nil {
+		t.Fatalf("auth the admin: %+v", model.Error)
+	}
+	admin := model.Response[tokenQuery].(string)
+	user := signIn(t, "deletedlogin")
+	route := routes["adminUsers"] + "{login}"
+	model = do(t, route, adminUsersHandler, httptest.NewRequest("DELETE", routes["adminUsers"]+"deleteradmin?token="+user, nil))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a user deleting an admin gets %+v", model.Error)
+	}
+	model = do(t, route, adminUsersHandler, httptest.NewRequest("DELETE", routes["adminUsers"]+"deletedlogin?token="+admin, nil))
+	if model.Error != nil || model.Response["deletedlogin"] != true {
+		t.Fatalf("the admin deletion is %+v", model)
+	}
+	if tokenLogin(user) != "" {
+		t.Error("the session of a deleted user is there")
+	}
+	model = do(t, route, adminUsersHandler, httptest.NewRequest("DELETE", routes["adminUsers"]+"deletedlogin?token="+admin, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("deleting a deleted user gets %+v", model.Error)
+	}
+	audit, err := myDB.GetAudit(context.Background(), 0, -1)
+	if err != nil || len(audit) != 1 || audit[0].Actor != "deleteradmin" || audit[0].Login != "deletedlogin" || audit[0].Action != auditDeleted {
+		t.Errorf("the audit log is %v, %v, want the deletion by deleteradmin", audit, err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	activityRoute = "activity"
+	afterQuery    = "after"
+	// activityLimitDefault is the number of the entries of a page without limit, activityLimitMax the most of them
+	activityLimitDefault = 50
+	activityLimitMax     = 500
+	// groupMark marks the groups among the users in the details of the grant changes
+	groupMark = "@"
+)
+
+// the types of the activity of a document
+const (
+	activityCreated = "created"
+	activityUpdated = "updated"
+	activityGrant   = "grant"
+	activityMeta    = "meta"
+	activityLink    = "link"
+	activityExpiry  = "expiry"
+)
+
+// recordActivity adds what the login of the request has done to the document with id to its activity,
+// a failure is logged only as the change is made already
+func recordActivity(r *http.Request, id, typ, detail string) {
+	a := &docsdb.Activity{Doc: id, Login: signedIn(r), Type: typ, Detail: detail, Created: time.Now().Format(timeFormat)}
+	err := myDB.AddActivity(r.Context(), a)
+	if err != nil {
+		log.Printf("the activity %s of %s: %v", typ, id, err)
+	}
+}
+
+// recordUpdate adds the update of current to doc to the activity, with the grant changes if there are some
+func recordUpdate(r *http.Request, current, doc *docsdb.Doc) {
+	if current == nil {
+		recordActivity(r, doc.ID, activityCreated, doc.Name)
+		return
+	}
+	recordActivity(r, doc.ID, activityUpdated, doc.Name)
+	changes := append(grantChanges(current.Grant, doc.Grant, ""), grantChanges(current.Groups, doc.Groups, groupMark)...)
+	if len(changes) != 0 {
+		recordActivity(r, doc.ID, activityGrant, strings.Join(changes, " "))
+	}
+}
+
+// grantChanges are the granted ones of after not in before as +mark{name} and the ones of before not in after as -mark{name}
+func grantChanges(before, after []string, mark string) (changes []string) {
+	was := make(map[string]bool, len(before))
+	for _, v := range before {
+		was[v] = true
+	}
+	is := make(map[string]bool, len(after))
+	for _, v := range after {
+		is[v] = true
+		if !was[v] {
+			changes = append(changes, "+"+mark+v)
+		}
+	}
+	for _, v := range before {
+		if !is[v] {
+			changes = append(changes, "-"+mark+v)
+		}
+	}
+	return
+}
+
+// activityHandler serves GET /docs/{id}/activity?after=...&limit=..., the changes of the document the earliest first:
+// its versions, grants, keys, links and expiry. A page goes on after the id of the last entry of the previous one,
+// its next is that id if there may be more
+func activityHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	if r.Method != "GET" {
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	_, err = docAccess(r, id, false)
+	if err != nil {
+		return
+	}
+	var after int64
+	if v := r.Form.Get(afterQuery); v != "" {
+		after, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 0 {
+			errorHandler(statusInvalidParameters, afterQuery+" is the id of the last entry of the previous page", &err)
+			return
+		}
+	}
+	limit := activityLimitDefault
+	if v := r.Form.Get(limitQuery); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > activityLimitMax {
+			errorHandler(statusInvalidParameters, limitQuery+" is up to "+strconv.Itoa(activityLimitMax), &err)
+			return
+		}
+	}
+	activity, err := myDB.GetActivity(r.Context(), id, after, limit)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if activity == nil {
+		activity = make([]*docsdb.Activity, 0)
+	}
+	model := &outModel{}
+	model.Data = map[string]interface{}{activityRoute: activity}
+	if len(activity) == limit {
+		model.Data["next"] = activity[len(activity)-1].ID
+	}
+	return sendJSON(w, model)
+}
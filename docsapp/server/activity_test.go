@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestGrantChanges(t *testing.T) {
+	got := strings.Join(grantChanges([]string{"ann", "bob"}, []string{"bob", "eve"}, groupMark), " ")
+	if want := "+@eve -@ann"; got != want {
+		t.Errorf("the changes are %q, want %q", got, want)
+	}
+}
+
+func TestActivityIsPaged(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "activitylogin")
+	err := myDB.CreateDocument(context.Background(), &docsdb.Doc{ID: "1", Name: "notes", Grant: []string{"activitylogin"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := routes["docsID"] + "{id}"
+	model := do(t, route, docsIDHandler, httptest.NewRequest("PUT", routes["docsID"]+"1/"+metaRoute+"/pages?token="+token, strings.NewReader("3")))
+	if model.Error != nil {
+		t.Fatalf("setting a key: %+v", model.Error)
+	}
+	expiresAt := time.Now().Add(time.Hour).Format(timeFormat)
+	model = do(t, route, docsIDHandler, form("PUT", routes["docsID"]+"1/"+expiryRoute, url.Values{tokenQuery: {token}, expiresAtQuery: {expiresAt}}))
+	if model.Error != nil {
+		t.Fatalf("setting the expiry: %+v", model.Error)
+	}
+	model = do(t, route, docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/"+activityRoute+"?limit=1&token="+token, nil))
+	page, _ := model.Data[activityRoute].([]interface{})
+	if model.Error != nil || len(page) != 1 || model.Data["next"] == nil {
+		t.Fatalf("the first page is %v, %+v", model.Data, model.Error)
+	}
+	entry := page[0].(map[string]interface{})
+	if entry["type"] != activityMeta || entry["detail"] != "+pages" || entry["login"] != "activitylogin" {
+		t.Errorf("the first entry is %v, want +pages of activitylogin", entry)
+	}
+	next := fmt.Sprint(int64(model.Data["next"].(float64)))
+	model = do(t, route, docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/"+activityRoute+"?after="+next+"&token="+token, nil))
+	page, _ = model.Data[activityRoute].([]interface{})
+	if model.Error != nil || len(page) != 1 || model.Data["next"] != nil {
+		t.Fatalf("the second page is %v, %+v", model.Data, model.Error)
+	}
+	if entry = page[0].(map[string]interface{}); entry["type"] != activityExpiry || entry["detail"] != expiresAt {
+		t.Errorf("the second entry is %v, want the expiry", entry)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+// verifyPage is how many mappings -verify-storage reads at once
+const verifyPage = 500
+
+var (
+	migrateStorage = flag.Bool("migrate-storage", false, "move the files kept by the logins and the names into the contents kept by their hashes and exit")
+	verifyStorage  = flag.Bool("verify-storage", false, "check the contents of the files are of their hashes and exit")
+	// contentMu keeps a content from being removed while it is put, the puts share it
+	contentMu sync.RWMutex
+)
+
+// contentName is the name in store of the content of the file of name, the name of a document.
+// The files kept before -migrate-storage are under their names still
+func contentName(ctx context.Context, name string) (string, error) {
+	blob, err := myDB.GetBlob(ctx, name)
+	if err == errNoRows {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return storage.HashName(blob.Hash), nil
+}
+
+// openFile opens the content of the file of name for reading
+func openFile(ctx context.Context, name string) (*os.File, error) {
+	stored, err := contentName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(stored)
+}
+
+// statFile describes the content of the file of name
+func statFile(ctx context.Context, name string) (os.FileInfo, error) {
+	stored, err := contentName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return store.Stat(stored)
+}
+
+// putFile keeps src as the content of the file of name, the content the name had is removed
+// unless another file has it. Nothing is left of src if it fails
+func putFile(ctx context.Context, name string, src io.Reader) (n int64, err error) {
+	contentMu.RLock()
+	old, err := myDB.GetBlob(ctx, name)
+	if err != nil && err != errNoRows {
+		contentMu.RUnlock()
+		return
+	}
+	hash, n, err := store.Put(src)
+	if err == nil {
+		err = myDB.SetBlob(ctx, &docsdb.Blob{Name: name, Hash: hash, Size: n})
+	}
+	contentMu.RUnlock()
+	if err != nil || old == nil || old.Hash == hash {
+		return
+	}
+	return n, removeContent(ctx, old.Hash)
+}
+
+// removeFile removes the file of name, its content is removed if no other file has it
+func removeFile(ctx context.Context, name string) (err error) {
+	contentMu.Lock()
+	blob, err := myDB.DeleteBlob(ctx, name)
+	contentMu.Unlock()
+	if err == errNoRows {
+		return store.Remove(name)
+	}
+	if err != nil {
+		return
+	}
+	return removeContent(ctx, blob.Hash)
+}
+
+// removeContent removes the content of hash if no file has it
+func removeContent(ctx context.Context, hash string) (err error) {
+	contentMu.Lock()
+	defer contentMu.Unlock()
+	n, err := myDB.CountBlobs(ctx, hash)
+	if err != nil || n > 0 {
+		return
+	}
+	return store.Remove(storage.HashName(hash))
+}
+
+// runStorageCommand runs -migrate-storage or -verify-storage on the database of config.json
+func runStorageCommand() (err error) {
+	err = openDB(config.DB, false)
+	if err != nil {
+		return
+	}
+	defer myDB.Disconnect()
+	ctx := context.Background()
+	if *migrateStorage {
+		var n int
+		n, err = moveToContents(ctx)
+		log.Printf("%d files are kept by their contents", n)
+		if err != nil {
+			return
+		}
+	}
+	if *verifyStorage {
+		var bad []string
+		bad, err = verifyContents(ctx)
+		if err != nil {
+			return
+		}
+		if len(bad) > 0 {
+			return errors.Errorf("%d files are missing or corrupt: %s", len(bad), strings.Join(bad, ", "))
+		}
+		log.Println("the contents of all the files are of their hashes")
+	}
+	return
+}
+
+// moveToContents moves the files kept by the logins and the names into the contents kept by their hashes
+// and answers how many there were. It is run again after a failure, the files mapped already are dropped
+func moveToContents(ctx context.Context) (n int, err error) {
+	var names, dirs []string
+	err = filepath.Walk(string(store), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := store.Name(p)
+		if err == storage.ErrOutside {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir() && (name == storage.HashDir || name == previewDir):
+			return filepath.SkipDir
+		case fi.IsDir():
+			dirs = append(dirs, p)
+		case fi.Mode().IsRegular():
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		err = moveToContent(ctx, name)
+		if err != nil {
+			return n, errors.Wrapf(err, "move %s", name)
+		}
+		n++
+	}
+	// the directories of the logins are left empty, the deepest ones first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+	return
+}
+
+// moveToContent keeps the file of name by its content and removes it
+func moveToContent(ctx context.Context, name string) (err error) {
+	_, err = myDB.GetBlob(ctx, name)
+	if err == nil {
+		return store.Remove(name)
+	}
+	if err != errNoRows {
+		return
+	}
+	f, err := store.Open(name)
+	if err != nil {
+		return
+	}
+	_, err = putFile(ctx, name, f)
+	f.Close()
+	if err != nil {
+		return
+	}
+	return store.Remove(name)
+}
+
+// verifyContents checks the contents of all the mapped files and answers the names of the ones
+// which are missing or not of their hashes
+func verifyContents(ctx context.Context) (bad []string, err error) {
+	checked := make(map[string]error)
+	var after string
+	for {
+		var blobs []*docsdb.Blob
+		blobs, err = myDB.GetBlobs(ctx, after, verifyPage)
+		if err != nil {
+			return
+		}
+		for _, blob := range blobs {
+			e, ok := checked[blob.Hash]
+			if !ok {
+				e = store.Verify(blob.Hash)
+				checked[blob.Hash] = e
+			}
+			if e != nil {
+				log.Printf("%s: %v", blob.Name, e)
+				bad = append(bad, blob.Name)
+			}
+		}
+		if len(blobs) < verifyPage {
+			return
+		}
+		after = blobs[len(blobs)-1].Name
+	}
+}
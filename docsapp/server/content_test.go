@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestFilesAreKeptByTheirContents(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	for _, name := range []string{"ann/a.txt", "bob/b.txt"} {
+		if _, err := putFile(ctx, name, strings.NewReader("same")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := contentName(ctx, "ann/a.txt")
+	b, _ := contentName(ctx, "bob/b.txt")
+	if a != b || !strings.HasPrefix(a, storage.HashDir+"/") {
+		t.Errorf("the same content is kept as %q and %q", a, b)
+	}
+	if err := removeFile(ctx, "ann/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(b); err != nil {
+		t.Errorf("the content of another file is removed: %v", err)
+	}
+	if _, err := putFile(ctx, "bob/b.txt", strings.NewReader("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(b); !os.IsNotExist(err) {
+		t.Errorf("the content no file has is kept: %v", err)
+	}
+	f, err := openFile(ctx, "bob/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(content) != "changed" {
+		t.Errorf("the file is %q", content)
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	for name, content := range map[string]string{"ann/a.txt": "one", "ann/b.txt": "one", "bob/c.txt": "two"} {
+		f, err := store.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		f.Close()
+	}
+	n, err := moveToContents(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("%d files are moved, %v", n, err)
+	}
+	if _, err = os.Stat(string(store) + "/ann"); !os.IsNotExist(err) {
+		t.Errorf("the directory of a login is left: %v", err)
+	}
+	b, err := ioutil.ReadFile(string(store) + "/" + mustContentName(t, "bob/c.txt"))
+	if err != nil || string(b) != "two" {
+		t.Errorf("the moved file is %q, %v", b, err)
+	}
+	if n, err = moveToContents(ctx); err != nil || n != 0 {
+		t.Errorf("the migration run again moves %d, %v", n, err)
+	}
+	bad, err := verifyContents(ctx)
+	if err != nil || len(bad) != 0 {
+		t.Errorf("the verification finds %v, %v", bad, err)
+	}
+	if err = os.WriteFile(string(store)+"/"+mustContentName(t, "ann/a.txt"), []byte("corrupt"), storage.FilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if bad, err = verifyContents(ctx); err != nil || len(bad) != 2 {
+		t.Errorf("the verification of a corrupt content finds %v, %v", bad, err)
+	}
+}
+
+func mustContentName(t *testing.T, name string) string {
+	t.Helper()
+	stored, err := contentName(context.Background(), name)
+	if err != nil || stored == name {
+		t.Fatalf("%s is kept as %q, %v", name, stored, err)
+	}
+	return stored
+}
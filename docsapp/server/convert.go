@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	convertRoute = "convert"
+	toQuery      = "to"
+	// convertedFrom is the type of the link of a converted document to its source
+	convertedFrom = "converted-from"
+	// convertTimeoutDefault is the time of a conversion without convert.timeout
+	convertTimeoutDefault = 5 * time.Minute
+)
+
+// convertConfig is the "convert" of config.json. Commands are the external converters by "from>to" media types,
+// like "application/msword>application/pdf": ["soffice", "--headless", "--convert-to", "pdf", "--outdir", "{dir}", "{in}"].
+// {in} is the source file, {out} the file to write and {dir} the directory of both: the converter writes {out}
+// or, as soffice does, the source name with the extension of the target in {dir}
+type convertConfig struct {
+	Commands map[string][]string `json:"commands"`
+	Timeout  string              `json:"timeout"`
+}
+
+var (
+	convertTimeout = convertTimeoutDefault
+	// converters are the built-in conversions by "from>to" media types
+	converters = map[string]func(io.Reader, io.Writer) error{
+		"text/markdown>text/html":   markdownToHTML,
+		"text/x-markdown>text/html": markdownToHTML,
+	}
+	// convertExts are the extensions of the types the first one of mime is not the usual one of
+	convertExts   = map[string]string{"image/jpeg": ".jpg", "text/html": ".html"}
+	imageEncoders = map[string]func(io.Writer, image.Image) error{
+		"image/png":  png.Encode,
+		"image/jpeg": func(w io.Writer, m image.Image) error { return jpeg.Encode(w, m, nil) },
+		"image/gif":  func(w io.Writer, m image.Image) error { return gif.Encode(w, m, nil) },
+	}
+)
+
+func init() {
+	mime.AddExtensionType(".md", "text/markdown")
+	for from := range imageEncoders {
+		for to, encode := range imageEncoders {
+			if from == to {
+				continue
+			}
+			encode := encode
+			converters[from+">"+to] = func(in io.Reader, out io.Writer) error {
+				m, _, err := image.Decode(in)
+				if err != nil {
+					return err
+				}
+				return encode(out, m)
+			}
+		}
+	}
+}
+
+// initConvert reads the convert of config.json
+func initConvert(c convertConfig) (err error) {
+	for k, args := range c.Commands {
+		if !strings.Contains(k, ">") || len(args) == 0 {
+			return fmt.Errorf("convert.commands: %q is not \"from>to\": [\"command\", \"args\"...]", k)
+		}
+	}
+	if c.Timeout != "" {
+		convertTimeout, err = time.ParseDuration(c.Timeout)
+	}
+	return
+}
+
+// convertType reads the to parameter, a media type or an extension like pdf
+func convertType(to string) string {
+	if strings.Contains(to, "/") {
+		mediaType, _, _ := mime.ParseMediaType(to)
+		return mediaType
+	}
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension("." + strings.TrimPrefix(to, ".")))
+	return mediaType
+}
+
+// convertExt is the extension of the files of the media type
+func convertExt(mediaType string) string {
+	if ext, ok := convertExts[mediaType]; ok {
+		return ext
+	}
+	exts, _ := mime.ExtensionsByType(mediaType)
+	if len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// convertHandler starts the conversion of POST /docs/{id}/convert to=... into a new document of the login
+// of the token linked to its source, and answers the job to follow it at /jobs/{id}
+func convertHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	switch r.Method {
+	case "POST":
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	src, err := docAccess(r, id, false)
+	if err != nil {
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	if !src.File {
+		errorHandler(statusInvalidParameters, "only the documents with a file are converted", &err)
+		return
+	}
+	from, to := embedType(src), convertType(r.Form.Get(toQuery))
+	key := from + ">" + to
+	if converters[key] == nil && config.Convert.Commands[key] == nil {
+		errorHandler(statusInvalidParameters, "there is no conversion of "+from+" to "+r.Form.Get(toQuery), &err)
+		return
+	}
+	doc := &docsdb.Doc{Mime: to, File: true, Grant: []string{login}, Owner: login, Tenant: src.Tenant, Created: time.Now().Format(timeFormat)}
+	doc.ID, err = newID()
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	j, err := newJob(convertRoute, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	go func() {
+		err := convertDocument(j, src, doc, key, login)
+		if err != nil {
+			log.Printf("convert %s to %s: %v", src.ID, to, err)
+			j.finish("", err)
+			return
+		}
+		j.finish(doc.ID, nil)
+	}()
+	status := publicURL(r, routes["jobs"]+j.ID)
+	w.Header().Set("Location", status)
+	model := &outModel{}
+	model.Response = map[string]interface{}{"job": j.ID, "status": status}
+	return sendJSON(w, model)
+}
+
+// convertDocument converts the file of src by the converter of key into the file of doc,
+// then creates doc linked to src
+func convertDocument(j *job, src, doc *docsdb.Doc, key, login string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), convertTimeout)
+	defer cancel()
+	stored, err := contentName(ctx, src.Name)
+	if err != nil {
+		return
+	}
+	srcPath, err := store.Path(stored)
+	if err != nil {
+		return
+	}
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return
+	}
+	j.progress(0, fi.Size())
+	name := strings.TrimSuffix(filepath.Base(src.Name), filepath.Ext(src.Name)) + convertExt(doc.Mime)
+	var out io.Reader
+	if convert := converters[key]; convert != nil {
+		var f *os.File
+		f, err = os.Open(srcPath)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		pr, pw := io.Pipe()
+		go func() { pw.CloseWithError(convert(f, pw)) }()
+		defer pr.Close()
+		out = pr
+	} else {
+		var dir string
+		dir, err = ioutil.TempDir("", "convert")
+		if err != nil {
+			return
+		}
+		defer os.RemoveAll(dir)
+		var f *os.File
+		f, err = runConverter(ctx, config.Convert.Commands[key], srcPath, dir, convertExt(doc.Mime))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	doc.Name, _, err = saveFile(ctx, login, name, out)
+	if err != nil {
+		return
+	}
+	j.progress(fi.Size(), fi.Size())
+	err = myDB.CreateDocument(withOutbox(ctx, hookCreated, login), doc, nil)
+	if err != nil {
+		removeFile(ctx, doc.Name)
+		return
+	}
+	indexContent(ctx, login, doc)
+	startOutbox()
+	return myDB.AddLink(ctx, &docsdb.Link{From: doc.ID, To: src.ID, Type: convertedFrom})
+}
+
+// runConverter runs the external converter on a copy of the source in dir and opens what it has written
+func runConverter(ctx context.Context, command []string, srcPath, dir, ext string) (f *os.File, err error) {
+	in := filepath.Join(dir, "in"+filepath.Ext(srcPath))
+	out := filepath.Join(dir, "out"+ext)
+	err = copyFile(srcPath, in)
+	if err != nil {
+		return
+	}
+	args := make([]string, len(command))
+	for i, a := range command {
+		args[i] = strings.NewReplacer("{in}", in, "{out}", out, "{dir}", dir).Replace(a)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", args[0], err, output)
+	}
+	f, err = os.Open(out)
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(dir, "in"+ext))
+	}
+	return
+}
+
+func copyFile(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return
+	}
+	return dst.Close()
+}
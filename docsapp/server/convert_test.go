@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestConvertedDocumentIsToldToTheHooks(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	login := "convertlogin"
+	if err := myDB.AddUser(ctx, &docsdb.User{Login: login}); err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := saveFile(ctx, login, "notes.md", strings.NewReader("# Notes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &docsdb.Doc{ID: "cv1", Name: name, Mime: "text/markdown", File: true, Grant: []string{login}, Owner: login}
+	if err = myDB.CreateDocument(ctx, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chanHook, 1)
+	registerHook(events)
+	defer func() { hooks.registered = nil }()
+	j, err := newJob(convertRoute, login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &docsdb.Doc{ID: "cv2", Mime: "text/html", File: true, Grant: []string{login}, Owner: login}
+	err = convertDocument(j, src, doc, "text/markdown>text/html", login)
+	j.finish(doc.ID, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Action != hookCreated || e.Login != login || e.Doc.ID != "cv2" {
+			t.Errorf("the hook is told %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the hook is not told of the converted document")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+// dbConfig is the "db" of config.json, the durations are like "2s".
+// Timeout limits every query, RouteTimeouts the queries of the routes named as the spans, e.g. "/docs/{id}".
+// The breaker opens after BreakerFailures failures of the database in a row for BreakerCooldown.
+// JournalMode (WAL by default), BusyTimeout (5s by default) and ForeignKeys (on by default) are the pragmas
+// of the connections and MaxOpenConns limits them.
+// Path is the primary database, dbPath by default and -db or $DOCSAPP_DB over it, and Replicas are the read-only copies of it
+// the documents and the logins are read from in turn
+type dbConfig struct {
+	Path            string            `json:"path"`
+	Replicas        []string          `json:"replicas"`
+	Timeout         string            `json:"timeout"`
+	RouteTimeouts   map[string]string `json:"route_timeouts"`
+	BreakerFailures int               `json:"breaker_failures"`
+	BreakerCooldown string            `json:"breaker_cooldown"`
+	JournalMode     string            `json:"journal_mode"`
+	BusyTimeout     string            `json:"busy_timeout"`
+	ForeignKeys     bool              `json:"foreign_keys"`
+	MaxOpenConns    int               `json:"max_open_conns"`
+}
+
+var (
+	// demo keeps the database in memory, everything is lost on exit
+	demo          = flag.Bool("demo", false, "keep the database in memory, to try the server without sqlite")
+	dbBreaker     *docsdb.Breaker
+	routeTimeouts map[string]time.Duration
+)
+
+// parseDuration parses d, empty is 0
+func parseDuration(d string) (time.Duration, error) {
+	if d == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(d)
+}
+
+// openDB makes myDB: the database, or the in-memory one of the demos, behind the breaker, traced and timed
+func openDB(c dbConfig, demo bool) (err error) {
+	o := docsdb.BreakerOptions{Failures: c.BreakerFailures}
+	o.Timeout, err = parseDuration(c.Timeout)
+	if err != nil {
+		return
+	}
+	o.Cooldown, err = parseDuration(c.BreakerCooldown)
+	if err != nil {
+		return
+	}
+	routeTimeouts = make(map[string]time.Duration, len(c.RouteTimeouts))
+	for route, d := range c.RouteTimeouts {
+		routeTimeouts[route], err = parseDuration(d)
+		if err != nil {
+			return
+		}
+	}
+	h := &docsdb.Handler{MaxScanRows: config.MaxScanRows, JournalMode: c.JournalMode, ForeignKeys: c.ForeignKeys, MaxOpenConns: c.MaxOpenConns}
+	h.BusyTimeout, err = parseDuration(c.BusyTimeout)
+	if err != nil {
+		return
+	}
+	var store docsdb.ISQL = h
+	if demo {
+		log.Print("demo: the database is in memory, it is lost on exit")
+		store = inmem.New()
+	} else if len(c.Replicas) > 0 {
+		replicas := make([]docsdb.ISQL, len(c.Replicas))
+		for i, path := range c.Replicas {
+			replica := *h
+			replica.ReadOnly = true
+			err = replica.Init("sqlite3", path)
+			if err != nil {
+				return
+			}
+			replicas[i] = &replica
+		}
+		store = docsdb.Replicated(h, replicas...)
+	}
+	dbBreaker = docsdb.Guarded(store, o)
+	myDB = docsdb.Traced(dbBreaker, tracer, observeQuery)
+	path := filepath.FromSlash(c.Path)
+	if path == "" {
+		path = filepath.FromSlash(dbPath)
+	}
+	if !demo {
+		err = os.MkdirAll(filepath.Dir(path), storage.DirPerm)
+		if err != nil {
+			return
+		}
+	}
+	return myDB.Init("sqlite3", path)
+}
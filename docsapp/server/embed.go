@@ -0,0 +1,128 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// embedConfig is the "embed" of config.json, FrameOptions is the X-Frame-Options of the embedded documents
+// (none by default so they are embedded anywhere) and FrameAncestors, if any, the only pages they are embedded in
+type embedConfig struct {
+	FrameOptions   string   `json:"frame_options"`
+	FrameAncestors []string `json:"frame_ancestors"`
+}
+
+// embedType is the media type of the file of doc, its extension tells it if the uploader didn't
+func embedType(doc *docsdb.Doc) string {
+	mediaType, _, _ := mime.ParseMediaType(doc.Mime)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(doc.Name)))
+	}
+	return mediaType
+}
+
+// embeddableTypes are the media types shown inline: the ones that run no scripts whatever the uploader put in them.
+// The media type is the uploader's, the markup of any kind (text/xml, image/svg+xml...) may be HTML
+var embeddableTypes = map[string]bool{
+	"text/plain":      true,
+	"text/csv":        true,
+	"text/markdown":   true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+}
+
+// embedPolicy is the Content-Security-Policy of the embedded files, a file that still runs as a page runs sandboxed without anything
+const embedPolicy = "sandbox; default-src 'none'"
+
+// embeddable reports whether a file of the media type is shown inline
+func embeddable(mediaType string) bool {
+	return embeddableTypes[mediaType]
+}
+
+// embedHandler serves the files of the public and the unlisted documents inline to be embedded in other pages without a token,
+// with the ranges and the conditional requests of http.ServeContent or of the web server it is offloaded to
+func embedHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	id := path.Base(r.URL.Path)
+	if !validID(id) {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	doc, err := myDB.GetDocument(r.Context(), id)
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if doc == nil || doc.Visibility == docsdb.VisibilityPrivate || !doc.File {
+		errorHandler(statusInvalidParameters, "only the files of the public and the unlisted documents are embedded", &err)
+		return
+	}
+	if expired(doc) {
+		errorHandler(statusGone, "the document has expired", &err)
+		return
+	}
+	mediaType := embedType(doc)
+	if !embeddable(mediaType) {
+		errorHandler(statusInvalidParameters, "only plain text, raster images and PDF are embedded", &err)
+		return
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		mediaType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filepath.Base(doc.Name)}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	configLock.RLock()
+	embed := config.Embed
+	configLock.RUnlock()
+	if embed.FrameOptions != "" {
+		w.Header().Set("X-Frame-Options", embed.FrameOptions)
+	}
+	policy := embedPolicy
+	if len(embed.FrameAncestors) > 0 {
+		policy += "; frame-ancestors " + strings.Join(embed.FrameAncestors, " ")
+	}
+	w.Header().Set("Content-Security-Policy", policy)
+	offloaded, err := offload(r.Context(), w, doc, "")
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if offloaded {
+		return
+	}
+	_, span := startSpan(r.Context(), "storage.read", attribute.String("file.path", doc.Name))
+	defer func() { endSpan(span, err) }()
+	f, err := openFile(r.Context(), doc.Name)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	http.ServeContent(w, r, doc.Name, fi.ModTime(), f)
+	return
+}
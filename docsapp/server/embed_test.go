@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestOnlyTheTypesWithoutScriptsAreEmbeddable(t *testing.T) {
+	for mediaType, want := range map[string]bool{
+		"text/plain":      true,
+		"image/png":       true,
+		"application/pdf": true,
+		"text/html":       false,
+		"text/xml":        false,
+		"text/xsl":        false,
+		"image/svg+xml":   false,
+		"application/xml": false,
+	} {
+		if embeddable(mediaType) != want {
+			t.Errorf("%s is embeddable: %v, want %v", mediaType, !want, want)
+		}
+	}
+}
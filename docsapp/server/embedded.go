@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+// embeddedDB is the database of the embedded mode, in its directory
+const embeddedDB = "docs.db"
+
+var (
+	embedded    = flag.Bool("embedded", false, "serve a single user from -dir, config.json, the database and the files are made there")
+	embeddedDir = flag.String("dir", defaultEmbeddedDir(), "the directory of -embedded")
+)
+
+// defaultEmbeddedDir is docsapp in the configuration directory of the user: %AppData% on Windows,
+// ~/Library/Application Support on macOS and $XDG_CONFIG_HOME or ~/.config elsewhere
+func defaultEmbeddedDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "docsapp"
+	}
+	return filepath.Join(dir, "docsapp")
+}
+
+// RunEmbedded serves docsapp for desktop and single-user use from dir: it is made with config.json, the database
+// and the data directory the first time, the server answers the local addresses only then.
+// The admin token of the new config.json is logged once, config.json may be edited as the one of a server
+func RunEmbedded(dir string) (err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(dir, storage.DirPerm)
+	if err != nil {
+		return
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		return
+	}
+	_, err = os.Stat(configName)
+	if os.IsNotExist(err) {
+		err = writeEmbeddedConfig()
+	}
+	if err != nil {
+		return
+	}
+	err = setup()
+	if err != nil {
+		return
+	}
+	err = initLocations(config)
+	if err != nil {
+		return
+	}
+	log.Printf("embedded: serving %s on %s", dir, listenAddr)
+	return serve()
+}
+
+// writeEmbeddedConfig makes config.json of the embedded mode with a random admin token
+func writeEmbeddedConfig() (err error) {
+	token := make([]byte, 16)
+	_, err = rand.Read(token)
+	if err != nil {
+		return
+	}
+	c := &configuration{
+		AdminToken: hex.EncodeToString(token),
+		DB:         dbConfig{Path: embeddedDB, ForeignKeys: true},
+		Access:     accessConfig{Allow: []string{"127.0.0.1", "::1"}},
+	}
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(configName, b, 0600)
+	if err != nil {
+		return
+	}
+	log.Printf("embedded: %s is made, register the admin with the token %s", configName, c.AdminToken)
+	return
+}
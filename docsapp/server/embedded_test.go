@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEmbeddedConfigIsSetUp(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Chdir(wd)
+		if err := setup(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	err = writeEmbeddedConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setup()
+	if err != nil {
+		t.Fatalf("the config.json made is not set up: %v", err)
+	}
+	if config.AdminToken == "" || config.DB.Path != embeddedDB || !config.DB.ForeignKeys {
+		t.Errorf("the config is %+v", config)
+	}
+	if apiAccess.permits(nil) {
+		t.Error("the embedded server answers every address")
+	}
+}
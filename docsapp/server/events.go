@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	contentTypeEvents = "text/event-stream"
+	// eventsBuffer is the number of the events a feed keeps unread, a slower client misses the next ones
+	eventsBuffer = 64
+	// eventsKeepAlive is how often an idle feed sends a comment so the proxies don't close it
+	eventsKeepAlive = 15 * time.Second
+	// progressBytes is the step of the progress events of the bytes of an unknown total
+	progressBytes = 1 << 20
+)
+
+// event is a message of the feed of a login, Type is the event field of the stream and Data is sent as JSON
+type event struct {
+	Type string
+	Data interface{}
+}
+
+var feeds = struct {
+	sync.Mutex
+	m map[string]map[chan event]bool
+}{m: make(map[string]map[chan event]bool)}
+
+// subscribe opens a feed of the events of login
+func subscribe(login string) chan event {
+	c := make(chan event, eventsBuffer)
+	feeds.Lock()
+	defer feeds.Unlock()
+	if feeds.m[login] == nil {
+		feeds.m[login] = make(map[chan event]bool)
+	}
+	feeds.m[login][c] = true
+	return c
+}
+
+// unsubscribe closes the feed c of login
+func unsubscribe(login string, c chan event) {
+	feeds.Lock()
+	defer feeds.Unlock()
+	delete(feeds.m[login], c)
+	if len(feeds.m[login]) == 0 {
+		delete(feeds.m, login)
+	}
+}
+
+// publish sends e to the feeds of login, it never waits for a client
+func publish(login string, e event) {
+	if login == "" {
+		return
+	}
+	feeds.Lock()
+	defer feeds.Unlock()
+	for c := range feeds.m[login] {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+// progressStep reports whether done of total is worth an event after the one of last:
+// a whole percent more, progressBytes more of an unknown total or the end
+func progressStep(done, last, total int64) bool {
+	if total <= 0 {
+		return done-last >= progressBytes
+	}
+	return done >= total || done*100/total > last*100/total
+}
+
+// eventsHandler streams the events of the login of the token on GET /events as server-sent events:
+// the progress of its uploads and jobs and its documents created or updated, the entries of the outbox
+func eventsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err = errors.Errorf("%T is not a http.Flusher", w)
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	c := subscribe(login)
+	defer unsubscribe(login, c)
+	w.Header().Set("Content-Type", contentTypeEvents)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-stopping:
+			return nil
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-c:
+			var data []byte
+			data, err = json.Marshal(e.Data)
+			if err != nil {
+				errorHandler(statusNotExpected, "", &err)
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err != nil {
+			// the client is gone
+			return nil
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	expiryRoute    = "expiry"
+	expiresAtQuery = "expires_at"
+	// purgeGraceDefault is how long the expired documents are kept without expiry.grace
+	purgeGraceDefault = 7 * 24 * time.Hour
+	// purgeIntervalDefault is how often the expired documents are purged without expiry.interval
+	purgeIntervalDefault = time.Hour
+)
+
+// expiryConfig is the "expiry" of config.json: Grace is how long the expired documents and their files
+// are kept before the purge, like "72h", and Interval how often the purge runs
+type expiryConfig struct {
+	Grace    string `json:"grace"`
+	Interval string `json:"interval"`
+}
+
+var (
+	purgeGrace    = purgeGraceDefault
+	purgeInterval = purgeIntervalDefault
+)
+
+// initExpiry reads the expiry of config.json
+func initExpiry(c expiryConfig) (err error) {
+	if c.Grace != "" {
+		purgeGrace, err = time.ParseDuration(c.Grace)
+		if err != nil {
+			return
+		}
+	}
+	if c.Interval != "" {
+		purgeInterval, err = time.ParseDuration(c.Interval)
+	}
+	return
+}
+
+// expired reports whether the expiry of doc has hit
+func expired(doc *docsdb.Doc) bool {
+	return doc.ExpiresAt != "" && doc.ExpiresAt <= time.Now().Format(timeFormat)
+}
+
+// validExpiry checks that expiresAt is empty or a time to come in timeFormat
+func validExpiry(expiresAt string) (err error) {
+	if expiresAt == "" {
+		return
+	}
+	t, err := time.ParseInLocation(timeFormat, expiresAt, time.Local)
+	if err != nil || !t.After(time.Now()) {
+		errorHandler(statusInvalidParameters, expiresAtQuery+" is a time to come like "+timeFormat+" or empty for never", &err)
+	}
+	return
+}
+
+// expiryHandler shows the expiry of the document on GET /docs/{id}/expiry and sets it on PUT expires_at=...,
+// the granted users extend it or drop it with an empty one before it hits, afterwards the document is gone
+func expiryHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	switch r.Method {
+	case "GET", "PUT":
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	doc, err := docAccess(r, id, r.Method == "PUT")
+	if err != nil {
+		return
+	}
+	if r.Method == "PUT" {
+		doc.ExpiresAt = r.Form.Get(expiresAtQuery)
+		err = validExpiry(doc.ExpiresAt)
+		if err != nil {
+			return
+		}
+		err = myDB.SetExpiry(r.Context(), id, doc.ExpiresAt)
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "wrong id", &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		recordActivity(r, id, activityExpiry, doc.ExpiresAt)
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{expiresAtQuery: doc.ExpiresAt}
+	return sendJSON(w, model)
+}
+
+// purgeExpired deletes the documents expired more than purgeGrace ago with their files
+func purgeExpired(ctx context.Context) (n int, err error) {
+	docs, err := myDB.GetExpiredDocuments(ctx, time.Now().Add(-purgeGrace).Format(timeFormat))
+	if err != nil {
+		return
+	}
+	for _, doc := range docs {
+		err = myDB.DeleteDocument(ctx, doc.ID)
+		if err == errNoRows {
+			continue
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, "delete %s", doc.ID)
+		}
+		n++
+		err = store.Remove(previewName(doc.ID))
+		if err != nil {
+			return n, errors.WithStack(err)
+		}
+		if !doc.File {
+			continue
+		}
+		err = removeFile(ctx, doc.Name)
+		if err != nil {
+			return n, errors.WithStack(err)
+		}
+	}
+	return n, nil
+}
+
+// purgeLoop purges the expired documents, the accounts due to be deleted, the expired tokens and the delivered outbox every purgeInterval
+// until the shutdown, startLoop runs it
+func purgeLoop() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for nextTick(ticker) {
+		n, err := purgeExpired(context.Background())
+		if err != nil {
+			log.Printf("the purge of the expired documents: %+v", err)
+		}
+		if n > 0 {
+			log.Printf("%d expired documents are purged", n)
+		}
+		n, err = purgeDeletions(context.Background())
+		if err != nil {
+			log.Printf("the deletion of the accounts: %+v", err)
+		}
+		if n > 0 {
+			log.Printf("%d accounts are deleted", n)
+		}
+		cleared, err := purgeTokens(context.Background())
+		if err != nil {
+			log.Printf("the purge of the revoked tokens: %+v", err)
+		}
+		if cleared > 0 {
+			log.Printf("%d expired tokens are forgotten", cleared)
+		}
+		cleared, err = purgeOutbox(context.Background())
+		if err != nil {
+			log.Printf("the purge of the outbox: %+v", err)
+		}
+		if cleared > 0 {
+			log.Printf("%d delivered entries of the outbox are purged", cleared)
+		}
+	}
+}
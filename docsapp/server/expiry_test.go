@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestExpiredDocumentsAreGone(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "expirylogin")
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour).Format(timeFormat)
+	future := time.Now().Add(time.Hour).Format(timeFormat)
+	for id, expiresAt := range map[string]string{"1": past, "2": future} {
+		err := myDB.CreateDocument(ctx, &docsdb.Doc{ID: id, Name: "notes" + id, Grant: []string{"expirylogin"}, ExpiresAt: expiresAt}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?limit=-1&token="+token, nil))
+	if docs, _ := model.Data["docs"].([]interface{}); model.Error != nil || len(docs) != 1 {
+		t.Errorf("the listing is %v, %+v, want document 2 only", model.Data, model.Error)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/links?token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusGone {
+		t.Errorf("an expired document gets %+v, want %d", model.Error, statusGone)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, form("PUT", routes["docsID"]+"1/"+expiryRoute, url.Values{tokenQuery: {token}, expiresAtQuery: {future}}))
+	if model.Error == nil || model.Error.Code != statusGone {
+		t.Errorf("extending an expired document gets %+v, want %d", model.Error, statusGone)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, form("PUT", routes["docsID"]+"2/"+expiryRoute, url.Values{tokenQuery: {token}, expiresAtQuery: {past}}))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("an expiry in the past gets %+v, want %d", model.Error, statusInvalidParameters)
+	}
+	later := time.Now().Add(48 * time.Hour).Format(timeFormat)
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, form("PUT", routes["docsID"]+"2/"+expiryRoute, url.Values{tokenQuery: {token}, expiresAtQuery: {later}}))
+	if model.Error != nil || model.Response[expiresAtQuery] != later {
+		t.Errorf("extending gets %v, %+v, want %s", model.Response, model.Error, later)
+	}
+	purgeGrace = 2 * time.Hour
+	n, err := purgeExpired(ctx)
+	if err != nil || n != 0 {
+		t.Errorf("the purge within the grace deletes %d, %v", n, err)
+	}
+	purgeGrace = 0
+	n, err = purgeExpired(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("the purge deletes %d, %v, want 1", n, err)
+	}
+	purgeGrace = purgeGraceDefault
+	if _, err = myDB.GetDocument(ctx, "1"); err != errNoRows {
+		t.Errorf("the purged document is there: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	formatQuery  = "format"
+	columnsQuery = "columns"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+	// csvFlushRows is the number of rows the CSV export sends at once
+	csvFlushRows = 100
+)
+
+var (
+	exportColumns        = []string{"id", "name", "mime", "file", "public", "visibility", "created", "grant", "json", "owner", "size", "hash", "version"}
+	exportDefaultColumns = []string{"id", "name", "mime", "file", "public", "created", "grant"}
+	exportContentType    = map[string]string{formatCSV: "text/csv; charset=utf-8", formatNDJSON: "application/x-ndjson"}
+)
+
+// exportColumnsOf reads the comma separated columns parameter
+func exportColumnsOf(r *http.Request) (columns []string, err error) {
+	value := r.FormValue(columnsQuery)
+	if value == "" {
+		return exportDefaultColumns, nil
+	}
+	for _, c := range strings.Split(value, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		var ok bool
+		for _, v := range exportColumns {
+			if c == v {
+				ok = true
+			}
+		}
+		if !ok {
+			errorHandler(statusInvalidParameters, "possible columns of the export: "+strings.Join(exportColumns, ", "), &err)
+			return
+		}
+		columns = append(columns, c)
+	}
+	return
+}
+
+// exportValue is the value of the column of d, typed for NDJSON
+func exportValue(d *docsdb.Doc, column string) interface{} {
+	switch column {
+	case "id":
+		return d.ID
+	case "name":
+		return d.Name
+	case "mime":
+		return d.Mime
+	case "file":
+		return d.File
+	case "public":
+		return d.Public
+	case "visibility":
+		return d.Visibility
+	case "created":
+		return d.Created
+	case "grant":
+		if d.Grant == nil {
+			return []string{}
+		}
+		return d.Grant
+	case "json":
+		return string(d.JSON)
+	case "owner":
+		return d.Owner
+	case "size":
+		return d.Size
+	case "hash":
+		return d.Hash
+	case "version":
+		return d.Version
+	}
+	return nil
+}
+
+// csvValue is exportValue as a cell, the grants are separated by spaces
+func csvValue(d *docsdb.Doc, column string) string {
+	switch v := exportValue(d, column).(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		return strings.Join(v, " ")
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// exportDocuments streams the listing of filter as CSV with a header line or as a JSON object a line.
+// Without the limit parameter all the documents are exported.
+// The errors after the first document are only logged, the response has begun by then
+func exportDocuments(w http.ResponseWriter, r *http.Request, filter *docsdb.Filter, format string) (err error) {
+	contentType, ok := exportContentType[format]
+	if !ok {
+		errorHandler(statusInvalidParameters, "possible formats: "+formatCSV+", "+formatNDJSON, &err)
+		return
+	}
+	columns, err := exportColumnsOf(r)
+	if err != nil {
+		return
+	}
+	if r.FormValue(limitQuery) == "" {
+		filter.Limit = -1
+	}
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	enc := json.NewEncoder(w)
+	var n int
+	start := func() error {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=docs."+format)
+		if format == formatCSV {
+			return cw.Write(columns)
+		}
+		return nil
+	}
+	err = myDB.EachDocument(r.Context(), filter, func(d *docsdb.Doc) (err error) {
+		if n == 0 {
+			err = start()
+			if err != nil {
+				return
+			}
+		}
+		n++
+		if format == formatNDJSON {
+			row := make(map[string]interface{}, len(columns))
+			for _, c := range columns {
+				row[c] = exportValue(d, c)
+			}
+			return enc.Encode(row)
+		}
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = csvValue(d, c)
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return
+		}
+		if n%csvFlushRows == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return cw.Error()
+	})
+	if n > 0 {
+		if err == nil {
+			cw.Flush()
+			err = cw.Error()
+		}
+		return errors.WithStack(err)
+	}
+	if err == docsdb.ErrFilterTooExpensive {
+		errorHandler(statusInvalidParameters, "filters on mime, file, json, size and version are not served for so many documents, filter by id, name, public, visibility, created, owner or hash", &err)
+		return
+	}
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	err = start()
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	urlQuery        = "url"
+	visibilityQuery = "visibility"
+	// fetchTimeoutDefault is the time of a fetch without fetch.timeout
+	fetchTimeoutDefault = 5 * time.Minute
+	fetchRedirects      = 5
+)
+
+// fetchConfig is the "fetch" of config.json: MaxSize is the greatest size in bytes of the fetched documents,
+// maxMB by default, and Timeout the time a fetch may take, like "1m"
+type fetchConfig struct {
+	MaxSize int64  `json:"max_size"`
+	Timeout string `json:"timeout"`
+}
+
+var (
+	errFetchAddress = errors.New("the documents are not fetched from internal addresses")
+	errFetchScheme  = errors.New("the documents are fetched over http and https only")
+	fetchTimeout    = fetchTimeoutDefault
+	fetchMaxSize    = int64(maxMB)
+	// fetchClient checks the address of every connection it dials, so neither a redirect
+	// nor a name resolving to another address later reaches the internal network
+	fetchClient = &http.Client{
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 30 * time.Second, Control: fetchControl}).DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= fetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", fetchRedirects)
+			}
+			return fetchScheme(req.URL)
+		},
+	}
+)
+
+// initFetch reads the fetch of config.json
+func initFetch(c fetchConfig) (err error) {
+	if c.MaxSize != 0 {
+		fetchMaxSize = c.MaxSize
+	}
+	if c.Timeout != "" {
+		fetchTimeout, err = time.ParseDuration(c.Timeout)
+	}
+	return
+}
+
+// fetchScheme refuses the urls other than http and https
+func fetchScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errFetchScheme
+	}
+	return nil
+}
+
+// fetchControl refuses the connections to the loopback, private, link-local and unspecified addresses
+func fetchControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return errFetchAddress
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal as the private ones
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// progressReader tells the job how much of the total has been read and fails after fetchMaxSize bytes
+type progressReader struct {
+	io.Reader
+	job   *job
+	done  int64
+	total int64
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.Reader.Read(b)
+	p.done += int64(n)
+	if p.done > fetchMaxSize {
+		return n, fmt.Errorf("the document is larger than %d bytes", fetchMaxSize)
+	}
+	p.job.progress(p.done, p.total)
+	return
+}
+
+// fetchHandler starts the fetch of the url of POST /docs/fetch url=...&visibility=... into a document
+// of the login of the token and answers the job to follow it at /jobs/{id}
+func fetchHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "POST":
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	u, err := url.Parse(r.PostForm.Get(urlQuery))
+	if err != nil || u.Host == "" {
+		errorHandler(statusInvalidParameters, "url is the absolute url of the document", &err)
+		return
+	}
+	err = fetchScheme(u)
+	if err != nil {
+		errorHandler(statusInvalidParameters, err.Error(), &err)
+		return
+	}
+	doc := &docsdb.Doc{Grant: []string{login}, Owner: login, Visibility: r.PostForm.Get(visibilityQuery), Created: time.Now().Format(timeFormat)}
+	if !docsdb.ValidVisibility(doc.Visibility) {
+		errorHandler(statusInvalidParameters, "visibility is private, unlisted or public", &err)
+		return
+	}
+	doc.Tenant, err = userTenant(r, login)
+	if err != nil {
+		return
+	}
+	j, err := newJob("fetch", login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	go func() {
+		docID, err := fetchDocument(j, u, doc, login)
+		if err != nil {
+			log.Printf("fetch %s: %v", u, err)
+		}
+		j.finish(docID, err)
+	}()
+	status := publicURL(r, routes["jobs"]+j.ID)
+	w.Header().Set("Location", status)
+	model := &outModel{}
+	model.Response = map[string]interface{}{"job": j.ID, "status": status}
+	return sendJSON(w, model)
+}
+
+// fetchDocument downloads u into the file of doc and creates it, the name and the media type
+// are the ones the server tells or the url and the content do
+func fetchDocument(j *job, u *url.URL, doc *docsdb.Doc, login string) (docID string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return
+	}
+	resp, err := fetchClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the url answered %s", resp.Status)
+	}
+	if resp.ContentLength > fetchMaxSize {
+		return "", fmt.Errorf("the document is larger than %d bytes", fetchMaxSize)
+	}
+	doc.Name = path.Base(resp.Request.URL.Path)
+	if _, params, e := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); e == nil && params["filename"] != "" {
+		doc.Name = filepath.Base(params["filename"])
+	}
+	if doc.Name == "/" || doc.Name == "." {
+		doc.Name = resp.Request.URL.Hostname()
+	}
+	body := bufio.NewReader(&progressReader{Reader: resp.Body, job: j, total: resp.ContentLength})
+	doc.Mime = resp.Header.Get("Content-Type")
+	if doc.Mime == "" {
+		head, _ := body.Peek(512)
+		doc.Mime = http.DetectContentType(head)
+	}
+	doc.File = true
+	doc.Name, _, err = saveFile(ctx, login, doc.Name, body)
+	if err != nil {
+		return
+	}
+	doc.ID, err = newID()
+	if err != nil {
+		return
+	}
+	err = myDB.CreateDocument(withOutbox(ctx, hookCreated, login), doc, nil)
+	if err != nil {
+		removeFile(ctx, doc.Name)
+		return
+	}
+	indexContent(ctx, login, doc)
+	startOutbox()
+	return doc.ID, nil
+}
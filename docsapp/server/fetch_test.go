@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestFetchControlRefusesInternalAddresses(t *testing.T) {
+	for address, internal := range map[string]bool{
+		"127.0.0.1:80":       true,
+		"10.1.2.3:443":       true,
+		"192.168.0.1:80":     true,
+		"169.254.169.254:80": true,
+		"100.64.0.1:80":      true,
+		"0.0.0.0:80":         true,
+		"[::1]:80":           true,
+		"[fd00::1]:80":       true,
+		"93.184.216.34:80":   false,
+		"[2606:4700::1]:443": false,
+	} {
+		err := fetchControl("tcp", address, nil)
+		if internal && err != errFetchAddress {
+			t.Errorf("%s: %v, want errFetchAddress", address, err)
+		}
+		if !internal && err != nil {
+			t.Errorf("%s: %v, want it fetched", address, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	signedURLRoute = "signed-url"
+	ttlQuery       = "ttl"
+	expiresQuery   = "expires"
+	signatureQuery = "signature"
+	// signedURLTTL is the default and signedURLMaxTTL the greatest life of a signed url if config.json has none
+	signedURLTTL    = 10 * time.Minute
+	signedURLMaxTTL = 24 * time.Hour
+
+	offloadAccelRedirect = "x-accel-redirect"
+	offloadSendfile      = "x-sendfile"
+)
+
+// offloadConfig is the "offload" of config.json: the files are sent by the web server in front, the process
+// only checks the access. Mode x-accel-redirect has nginx send them from its internal Location
+// the data directory is served from, x-sendfile has Apache mod_xsendfile or lighttpd send them by their path
+type offloadConfig struct {
+	Mode     string `json:"mode"`
+	Location string `json:"location"`
+}
+
+// signedURLConfig is the "signed_urls" of config.json. Key signs the urls, a random one is made at start
+// if it is empty so the urls don't outlive the process. TTL and MaxTTL are durations like "10m".
+// AccelRedirect is the internal location of nginx the data directory is served from, the signed downloads
+// are answered with X-Accel-Redirect to it whatever the offload of config.json is
+type signedURLConfig struct {
+	Key           string `json:"key"`
+	TTL           string `json:"ttl"`
+	MaxTTL        string `json:"max_ttl"`
+	AccelRedirect string `json:"accel_redirect"`
+}
+
+var (
+	signingKey []byte
+	signedTTL  = signedURLTTL
+	signedMax  = signedURLMaxTTL
+)
+
+// initSignedURLs reads the signed_urls of config.json
+func initSignedURLs(c signedURLConfig) (err error) {
+	if c.Key != "" {
+		signingKey = []byte(c.Key)
+	} else {
+		signingKey = make([]byte, 32)
+		_, err = rand.Read(signingKey)
+		if err != nil {
+			return
+		}
+		log.Println("signed_urls.key is not set, the signed urls are valid until the server stops")
+	}
+	if c.TTL != "" {
+		signedTTL, err = time.ParseDuration(c.TTL)
+		if err != nil {
+			return
+		}
+	}
+	if c.MaxTTL != "" {
+		signedMax, err = time.ParseDuration(c.MaxTTL)
+	}
+	return
+}
+
+// initOffload checks the offload of config.json
+func initOffload(c offloadConfig) error {
+	switch c.Mode {
+	case "", offloadSendfile:
+	case offloadAccelRedirect:
+		if c.Location == "" {
+			return fmt.Errorf("offload.location is the internal location of nginx for %s", offloadAccelRedirect)
+		}
+	default:
+		return fmt.Errorf("offload.mode is %s or %s, got %q", offloadAccelRedirect, offloadSendfile, c.Mode)
+	}
+	return nil
+}
+
+// offload tells the web server to send the file of doc, from accelRedirect if it is set
+// or as config.json says. It reports false if the process is to send the file itself
+func offload(ctx context.Context, w http.ResponseWriter, doc *docsdb.Doc, accelRedirect string) (ok bool, err error) {
+	mode, location := config.Offload.Mode, config.Offload.Location
+	if accelRedirect != "" {
+		mode, location = offloadAccelRedirect, accelRedirect
+	}
+	if mode != offloadAccelRedirect && mode != offloadSendfile {
+		return false, nil
+	}
+	name, err := contentName(ctx, doc.Name)
+	if err != nil {
+		return
+	}
+	switch mode {
+	case offloadAccelRedirect:
+		w.Header().Set("X-Accel-Redirect", path.Join(location, name))
+	case offloadSendfile:
+		var p string
+		p, err = store.Path(name)
+		if err != nil {
+			return
+		}
+		p, err = filepath.Abs(p)
+		if err != nil {
+			return
+		}
+		w.Header().Set("X-Sendfile", p)
+	}
+	return true, nil
+}
+
+// signDownload is the signature of the download of the document with id until expires
+func signDownload(id string, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURLHandler serves GET /docs/{id}/signed-url?ttl=10m, the url the file of the document
+// is downloaded by without a token until it expires
+func signedURLHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	if r.Method != "GET" {
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	doc, err := docAccess(r, id, false)
+	if err != nil {
+		return
+	}
+	if !doc.File {
+		errorHandler(statusInvalidParameters, "the document has no file", &err)
+		return
+	}
+	ttl := signedTTL
+	if v := r.Form.Get(ttlQuery); v != "" {
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 || ttl > signedMax {
+			errorHandler(statusInvalidParameters, "ttl is a duration up to "+signedMax.String(), &err)
+			return
+		}
+	}
+	expires := time.Now().Add(ttl).Unix()
+	q := url.Values{expiresQuery: {strconv.FormatInt(expires, 10)}, signatureQuery: {signDownload(id, expires)}}
+	model := &outModel{}
+	model.Response = map[string]interface{}{
+		"url":     publicURL(r, routes["files"]+id+"?"+q.Encode()),
+		"expires": time.Unix(expires, 0).UTC().Format(time.RFC3339)}
+	return sendJSON(w, model)
+}
+
+// filesHandler serves the files of the signed urls to anyone, a CDN may cache them until they expire
+func filesHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	id := path.Base(r.URL.Path)
+	if !validID(id) {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get(expiresQuery), 10, 64)
+	if err != nil || !hmac.Equal([]byte(q.Get(signatureQuery)), []byte(signDownload(id, expires))) {
+		errorHandler(statusAccessDenied, "the signature is wrong", &err)
+		return
+	}
+	left := time.Until(time.Unix(expires, 0))
+	if left <= 0 {
+		errorHandler(statusAccessDenied, "the url has expired", &err)
+		return
+	}
+	doc, err := myDB.GetDocument(r.Context(), id)
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if doc == nil || !doc.File {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	if expired(doc) {
+		errorHandler(statusGone, "the document has expired", &err)
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(left.Seconds())))
+	return sendDocumentFile(w, r, doc, config.SignedURLs.AccelRedirect)
+}
+
+// sendDocumentFile sends the file of doc as an attachment or has the web server send it, see offload
+func sendDocumentFile(w http.ResponseWriter, r *http.Request, doc *docsdb.Doc, accelRedirect string) (err error) {
+	w.Header().Set("Content-Disposition", "attachment; filename="+doc.Name)
+	w.Header().Set("Content-Type", doc.Mime)
+	offloaded, err := offload(r.Context(), w, doc, accelRedirect)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if offloaded {
+		return
+	}
+	_, span := startSpan(r.Context(), "storage.read", attribute.String("file.path", doc.Name))
+	defer func() { endSpan(span, err) }()
+	f, err := openFile(r.Context(), doc.Name)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(fi.Size()))
+	if r.Method == "GET" {
+		_, err = io.Copy(w, f)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+	}
+	return
+}
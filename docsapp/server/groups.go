@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const membersRoute = "members"
+
+// groupsHandler lists the groups of the tenant on GET /groups for its users; for the admins of the tenant
+// it creates one on POST /groups name=..., deletes one on DELETE /groups/{name},
+// adds a member on POST /groups/{name}/members login=... and removes one on DELETE /groups/{name}/members/{login}
+func groupsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "POST", "DELETE":
+	case "HEAD", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	var parts []string
+	if p := strings.Trim(strings.TrimPrefix(r.URL.Path, routes["groups"]), "/"); p != "" {
+		parts = strings.Split(p, "/")
+	}
+	if len(parts) > 3 || len(parts) > 1 && parts[1] != membersRoute {
+		errorHandler(statusInvalidParameters, "only "+routes["groups"]+", "+routes["groupsName"]+"{name}, "+routes["groupsName"]+"{name}/"+membersRoute+" and "+routes["groupsName"]+"{name}/"+membersRoute+"/{login} are served", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	tenant, err := userTenant(r, login)
+	if err != nil {
+		return
+	}
+	model := &outModel{}
+	if r.Method == "GET" {
+		if len(parts) != 0 {
+			errorHandler(statusInvalidParameters, "the groups are listed on GET "+routes["groups"], &err)
+			return
+		}
+		var groups []*docsdb.Group
+		groups, err = myDB.GetGroups(r.Context(), tenant)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Data = map[string]interface{}{"groups": groups}
+		return sendJSON(w, model)
+	}
+	admin, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if !admin {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	switch {
+	case r.Method == "POST" && len(parts) == 0:
+		g := &docsdb.Group{Name: r.PostForm.Get(nameQuery), Tenant: tenant, Created: time.Now().Format(timeFormat)}
+		if !tenantName.MatchString(g.Name) {
+			errorHandler(statusInvalidParameters, "the name of a group is up to 64 letters, digits, _ and -", &err)
+			return
+		}
+		err = myDB.AddGroup(r.Context(), g)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				errorHandler(statusInvalidParameters, "group "+g.Name+" already exists", &err)
+				return
+			}
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{g.Name: true}
+	case r.Method == "DELETE" && len(parts) == 1:
+		err = myDB.DeleteGroup(r.Context(), tenant, parts[0])
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "there is no group "+parts[0], &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{parts[0]: true}
+	case r.Method == "POST" && len(parts) == 2:
+		member := r.PostForm.Get(loginQuery)
+		err = myDB.AddGroupMember(r.Context(), tenant, parts[0], member)
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "there is no group "+parts[0]+" or user "+member, &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{member: true}
+	case r.Method == "DELETE" && len(parts) == 3:
+		err = myDB.DeleteGroupMember(r.Context(), tenant, parts[0], parts[2])
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "user "+parts[2]+" is not a member of group "+parts[0], &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{parts[2]: true}
+	default:
+		errorHandler(statusInvalidParameters, "groups are made on POST "+routes["groups"]+" and members on POST "+routes["groupsName"]+"{name}/"+membersRoute, &err)
+		return
+	}
+	return sendJSON(w, model)
+}
+
+// inGroups reports whether login is a member of one of the groups
+func inGroups(r *http.Request, login string, groups []string) (in bool, err error) {
+	if len(groups) == 0 {
+		return
+	}
+	mine, err := myDB.GetUserGroups(r.Context(), login)
+	if err != nil {
+		return
+	}
+	for _, v := range mine {
+		for _, g := range groups {
+			if v == g {
+				return true, nil
+			}
+		}
+	}
+	return
+}
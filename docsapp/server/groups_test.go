@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestGroupMembersReadTheGrantedDocuments(t *testing.T) {
+	useDB(t, inmem.New())
+	values := url.Values{loginQuery: {"groupadmin"}, passwordQuery: {"password1"}, tokenQuery: {config.AdminToken}}
+	model := do(t, routes["register"], registerHandler, form("POST", routes["register"], values))
+	if model.Error != nil {
+		t.Fatalf("register the admin: %+v", model.Error)
+	}
+	model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], url.Values{loginQuery: {"groupadmin"}, passwordQuery: {"password1"}}))
+	if model.Error != nil {
+		t.Fatalf("auth the admin: %+v", model.Error)
+	}
+	admin := model.Response[tokenQuery].(string)
+	member := signIn(t, "memberlogin")
+	stranger := signIn(t, "strangerlogin")
+	groupsName := routes["groupsName"] + "{name}"
+	model = do(t, routes["groups"], groupsHandler, form("POST", routes["groups"], url.Values{tokenQuery: {member}, nameQuery: {"team"}}))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a user makes a group: %+v, want %d", model.Error, statusAccessDenied)
+	}
+	model = do(t, routes["groups"], groupsHandler, form("POST", routes["groups"], url.Values{tokenQuery: {admin}, nameQuery: {"team"}}))
+	if model.Error != nil {
+		t.Fatalf("the admin makes a group: %+v", model.Error)
+	}
+	model = do(t, groupsName, groupsHandler, form("POST", routes["groupsName"]+"team/"+membersRoute, url.Values{tokenQuery: {admin}, loginQuery: {"memberlogin"}}))
+	if model.Error != nil {
+		t.Fatalf("the admin adds a member: %+v", model.Error)
+	}
+	model = do(t, routes["groups"], groupsHandler, httptest.NewRequest("GET", routes["groups"]+"?token="+member, nil))
+	if model.Error != nil || len(model.Data["groups"].([]interface{})) != 1 {
+		t.Errorf("the member lists %v, %+v, want team", model.Data, model.Error)
+	}
+	err := myDB.CreateDocument(httptest.NewRequest("GET", "/", nil).Context(), &docsdb.Doc{ID: "1", Name: "notes", Tenant: docsdb.DefaultTenant, Grant: []string{"groupadmin"}, Groups: []string{"team"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/links?token="+member, nil))
+	if model.Error != nil {
+		t.Errorf("the member gets %+v", model.Error)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/links?token="+stranger, nil))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a stranger gets %+v, want %d", model.Error, statusAccessDenied)
+	}
+	model = do(t, groupsName, groupsHandler, httptest.NewRequest("DELETE", routes["groupsName"]+"team/"+membersRoute+"/memberlogin?token="+admin, nil))
+	if model.Error != nil {
+		t.Fatalf("the admin removes the member: %+v", model.Error)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"1/links?token="+member, nil))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a removed member gets %+v, want %d", model.Error, statusAccessDenied)
+	}
+}
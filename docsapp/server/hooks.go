@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	hookCreated = "created"
+	hookUpdated = "updated"
+	// hookTimeoutDefault is the time a hook has for an upload without hooks.timeout
+	hookTimeoutDefault = time.Minute
+)
+
+// hooksConfig is the "hooks" of config.json. Commands are run after every upload, like ["/usr/local/bin/index", "{path}"],
+// with the uploadEvent as JSON on their standard input. {id} is the id of the document and {path} the path of its file
+// in their arguments, "" without a file. Timeout is the time each of them has, like "1m"
+type hooksConfig struct {
+	Commands [][]string `json:"commands"`
+	Timeout  string     `json:"timeout"`
+}
+
+// uploadEvent is what the hooks get of a document created or updated: the action, the login uploading it,
+// its metadata and the path of its file in the data directory, "" if it has none
+type uploadEvent struct {
+	Action string      `json:"action"`
+	Login  string      `json:"login"`
+	Doc    *docsdb.Doc `json:"doc"`
+	Path   string      `json:"path,omitempty"`
+}
+
+// uploadHook is told of the uploads once they are stored, like a search indexer or a scanner outside,
+// through the outbox: an upload is told after a crash too and may be told again if the process ends while telling it.
+// The builds wire their own in with registerHook in the init of a file of theirs, the commands of config.json
+// are execHooks. Their errors are logged, the upload is done already
+type uploadHook interface {
+	Uploaded(ctx context.Context, e *uploadEvent) error
+}
+
+// execHook runs a command of hooks.commands
+type execHook []string
+
+var (
+	hookTimeout = hookTimeoutDefault
+	hooks       struct {
+		sync.RWMutex
+		registered []uploadHook
+		commands   []uploadHook
+	}
+)
+
+// registerHook adds h to the hooks told of the uploads
+func registerHook(h uploadHook) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.registered = append(hooks.registered, h)
+}
+
+// initHooks reads the hooks of config.json
+func initHooks(c hooksConfig) (err error) {
+	commands := make([]uploadHook, 0, len(c.Commands))
+	for _, args := range c.Commands {
+		if len(args) == 0 || args[0] == "" {
+			return fmt.Errorf("hooks.commands: %q is not [\"command\", \"args\"...]", args)
+		}
+		commands = append(commands, execHook(args))
+	}
+	hookTimeout = hookTimeoutDefault
+	if c.Timeout != "" {
+		hookTimeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return
+		}
+	}
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.commands = commands
+	return
+}
+
+// callHooks tells every hook of all of e one after another, each within hookTimeout
+func callHooks(ctx context.Context, all []uploadHook, e *uploadEvent) {
+	for _, h := range all {
+		hctx, cancel := context.WithTimeout(ctx, hookTimeout)
+		err := h.Uploaded(hctx, e)
+		cancel()
+		if err != nil {
+			log.Printf("hook of %s %s: %v", e.Doc.ID, e.Action, err)
+		}
+	}
+}
+
+// Uploaded runs the command with e on its standard input
+func (h execHook) Uploaded(ctx context.Context, e *uploadEvent) error {
+	in, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	args := make([]string, len(h))
+	for i, a := range h {
+		args[i] = strings.NewReplacer("{id}", e.Doc.ID, "{path}", e.Path).Replace(a)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(in)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", args[0], err, output)
+	}
+	return nil
+}
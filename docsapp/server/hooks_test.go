@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+type chanHook chan *uploadEvent
+
+func (h chanHook) Uploaded(ctx context.Context, e *uploadEvent) error {
+	h <- e
+	return nil
+}
+
+func TestHooksAreToldOfTheUploads(t *testing.T) {
+	useDB(t, inmem.New())
+	events := make(chanHook, 1)
+	registerHook(events)
+	defer func() { hooks.registered = nil }()
+	token := signIn(t, "hooklogin")
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField(tokenQuery, token)
+	mw.WriteField(metaQuery, `{"name":"notes","mime":"text/plain","created":"2019-01-01 00:00:00"}`)
+	mw.Close()
+	r := httptest.NewRequest("POST", routes["docs"], body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	makeHandler(routes["docs"], docsHandler)(httptest.NewRecorder(), r)
+	select {
+	case e := <-events:
+		if e.Action != hookCreated || e.Login != "hooklogin" || e.Doc.Name != "notes" || e.Path != "" {
+			t.Errorf("the event is %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hook is not told of the upload")
+	}
+}
+
+func TestExecHookGetsTheEvent(t *testing.T) {
+	dir := t.TempDir()
+	h := execHook{"sh", "-c", `cat > "$0"`, filepath.Join(dir, "{id}.json")}
+	e := &uploadEvent{Action: hookUpdated, Login: "hooklogin", Doc: &docsdb.Doc{ID: "1", Name: "hooklogin/a.txt", File: true}, Path: "data/a"}
+	if err := h.Uploaded(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &uploadEvent{}
+	if err = json.Unmarshal(b, got); err != nil || got.Action != hookUpdated || got.Doc.ID != "1" || got.Path != "data/a" {
+		t.Errorf("the command gets %s, %v", b, err)
+	}
+	if err = (execHook{"sh", "-c", "exit 3"}).Uploaded(context.Background(), e); err == nil {
+		t.Error("a failed command is no error")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	replayedHeader    = "Idempotent-Replayed"
+	// idempotencyTTLDefault is how long the answers are kept without idempotency_ttl
+	idempotencyTTLDefault = 24 * time.Hour
+	maxIdempotencyKey     = 255
+	// maxIdempotentAnswers is how many answers are kept at most, the keys past it are refused until some expire
+	maxIdempotentAnswers = 10000
+	// maxIdempotentBody is the size of the largest answer kept, the larger ones are not replayed
+	maxIdempotentBody = 64 << 10
+)
+
+// idempotentAnswer is the answer of the request with an Idempotency-Key, the retries with the key get it again.
+// sum is of the request, a retry is the same request
+type idempotentAnswer struct {
+	sum     [sha256.Size]byte
+	running bool
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+var (
+	idempotencyTTL = idempotencyTTLDefault
+	answers        = struct {
+		sync.Mutex
+		m map[string]*idempotentAnswer
+	}{m: make(map[string]*idempotentAnswer)}
+)
+
+// answerRecorder writes the answer through and keeps it up to maxIdempotentBody, tooLarge tells it is cut
+type answerRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (a *answerRecorder) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *answerRecorder) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	if a.body.Len()+len(b) > maxIdempotentBody {
+		a.tooLarge = true
+		a.body.Reset()
+	}
+	if !a.tooLarge {
+		a.body.Write(b)
+	}
+	return a.ResponseWriter.Write(b)
+}
+
+// writeIdempotencyError answers the requests the key can't be used for
+func writeIdempotencyError(w http.ResponseWriter, code int, text string) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&outModel{Error: &errorModel{Code: code, Text: statusText[code] + ": " + text}})
+}
+
+// idempotent serves the changes with an Idempotency-Key once: the answer is kept for idempotencyTTL
+// and the retries of the same request, token and body included, get it again with Idempotent-Replayed.
+// The keys are of the token they are sent with, the requests of another token never share them.
+// The key of another request is refused, and so is a retry while the first request runs.
+// The answers of the server errors and the ones over maxIdempotentBody are not kept so the retries after them run again
+func idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" || r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeIdempotencyError(w, statusInvalidParameters, "the idempotency key is too long")
+			return
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxMB+1))
+		if err != nil {
+			writeIdempotencyError(w, statusInvalidParameters, err.Error())
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		credential := sha256.Sum256([]byte(idempotencyToken(r, body)))
+		key = hex.EncodeToString(credential[:]) + " " + key
+		h := sha256.New()
+		h.Write(credential[:])
+		io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+		h.Write(body)
+		var sum [sha256.Size]byte
+		copy(sum[:], h.Sum(nil))
+		now := time.Now()
+		answers.Lock()
+		a := answers.m[key]
+		if a != nil && now.After(a.expires) {
+			a = nil
+		}
+		switch {
+		case a == nil:
+			for k, v := range answers.m {
+				if now.After(v.expires) && !v.running {
+					delete(answers.m, k)
+				}
+			}
+			if len(answers.m) >= maxIdempotentAnswers {
+				answers.Unlock()
+				writeIdempotencyError(w, statusTooManyRequests, "too many idempotency keys are kept, retry later")
+				return
+			}
+			a = &idempotentAnswer{sum: sum, running: true, expires: now.Add(idempotencyTTL)}
+			answers.m[key] = a
+			answers.Unlock()
+		case a.sum != sum:
+			answers.Unlock()
+			writeIdempotencyError(w, statusUnprocessable, "the idempotency key is of another request")
+			return
+		case a.running:
+			answers.Unlock()
+			writeIdempotencyError(w, statusConflict, "the request with the idempotency key is running")
+			return
+		default:
+			status, header, body := a.status, a.header, a.body
+			answers.Unlock()
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(replayedHeader, "true")
+			w.WriteHeader(status)
+			w.Write(body)
+			return
+		}
+		rec := &answerRecorder{ResponseWriter: w}
+		defer func() {
+			answers.Lock()
+			defer answers.Unlock()
+			if rec.status >= 500 || rec.tooLarge || serverError(rec.body.Bytes()) {
+				delete(answers.m, key)
+				return
+			}
+			a.running = false
+			a.status, a.header, a.body = rec.status, w.Header().Clone(), rec.body.Bytes()
+			if a.status == 0 {
+				a.status = http.StatusOK
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// idempotencyToken is the token of the request the key is of, read from a copy of the request
+// for the form not to be parsed before the handler reads the body
+func idempotencyToken(r *http.Request, body []byte) string {
+	c := r.Clone(r.Context())
+	c.Body = ioutil.NopCloser(bytes.NewReader(body))
+	token := requestToken(c)
+	if c.MultipartForm != nil {
+		c.MultipartForm.RemoveAll()
+	}
+	return token
+}
+
+// serverError reports whether the body is the json of an error of the server, they are answered with 200
+func serverError(body []byte) bool {
+	model := &outModel{}
+	if json.Unmarshal(body, model) != nil || model.Error == nil {
+		return false
+	}
+	return model.Error.Code >= 500
+}
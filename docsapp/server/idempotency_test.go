@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentReplaysTheAnswer(t *testing.T) {
+	answers.m = make(map[string]*idempotentAnswer)
+	var n int
+	h := idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		fmt.Fprintf(w, `{"response":{"n":%d}}`, n)
+	}))
+	post := func(token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/docs", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set(idempotencyHeader, "key-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	first := post("a", "name=notes")
+	retry := post("a", "name=notes")
+	if n != 1 || retry.Body.String() != first.Body.String() || retry.Header().Get(replayedHeader) != "true" {
+		t.Errorf("the retry ran %d times and got %q, want %q replayed", n, retry.Body, first.Body)
+	}
+	other := post("a", "name=list")
+	if n != 1 || other.Code != statusUnprocessable {
+		t.Errorf("another request with the key got %d, want %d", other.Code, statusUnprocessable)
+	}
+	// the same request of another token has a key of its own
+	another := post("b", "name=notes")
+	if n != 2 || another.Header().Get(replayedHeader) != "" {
+		t.Errorf("the request of another token ran %d times and got %q replayed", n, another.Body)
+	}
+}
+
+func TestIdempotentKeepsNoLargeAnswers(t *testing.T) {
+	answers.m = make(map[string]*idempotentAnswer)
+	var n int
+	h := idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Write(make([]byte, maxIdempotentBody+1))
+	}))
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("POST", "/docs", nil)
+		r.Header.Set(idempotencyHeader, "key-large")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if n != 2 {
+		t.Errorf("the request with a large answer ran %d times, want it run again", n)
+	}
+}
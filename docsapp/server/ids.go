@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// idLengthDefault and idAlphabetDefault make the ids without ids.length and ids.alphabet,
+	// 36^12 of them keep the collisions of a few millions of documents unlikely
+	idLengthDefault   = 12
+	idAlphabetDefault = "0123456789abcdefghijklmnopqrstuvwxyz"
+	// idMaxLength is the longest id, the ones of the clients too
+	idMaxLength = 64
+	// idSafe are the characters an alphabet may have, the ones needing no escaping in the urls
+	idSafe = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_"
+)
+
+// idConfig is the "ids" of config.json: the length and the alphabet of the ids the server makes.
+// The alphabet is to have the characters of the ids there are, the ids of the requests out of it are refused
+type idConfig struct {
+	Length   int    `json:"length"`
+	Alphabet string `json:"alphabet"`
+}
+
+var (
+	idLength   = idLengthDefault
+	idAlphabet = idAlphabetDefault
+)
+
+// initIDs reads the ids of config.json
+func initIDs(c idConfig) error {
+	if c.Length != 0 {
+		if c.Length < 1 || c.Length > idMaxLength {
+			return fmt.Errorf("ids.length is 1 to %d", idMaxLength)
+		}
+		idLength = c.Length
+	}
+	if c.Alphabet != "" {
+		for i := 0; i < len(c.Alphabet); i++ {
+			if !strings.ContainsRune(idSafe, rune(c.Alphabet[i])) || strings.IndexByte(c.Alphabet, c.Alphabet[i]) != i {
+				return fmt.Errorf("ids.alphabet is distinct latin letters, digits, - and _")
+			}
+		}
+		if len(c.Alphabet) < 2 {
+			return fmt.Errorf("ids.alphabet has two characters at least")
+		}
+		idAlphabet = c.Alphabet
+	}
+	return nil
+}
+
+// newID makes a random id of idLength digits of idAlphabet, the documents of the same names
+// have ids of their own
+func newID() (string, error) {
+	base := big.NewInt(int64(len(idAlphabet)))
+	id := make([]byte, idLength)
+	for i := range id {
+		digit, err := rand.Int(rand.Reader, base)
+		if err != nil {
+			return "", err
+		}
+		id[i] = idAlphabet[digit.Int64()]
+	}
+	return string(id), nil
+}
+
+// seededID makes the id of seed, the same seed makes the same id, for the seeded documents to be made once:
+// the digest of seed is written in idLength digits of idAlphabet, the digest of the digest goes on if it runs out
+func seededID(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(idAlphabet)))
+	digit := new(big.Int)
+	id := make([]byte, idLength)
+	for i := range id {
+		if n.Sign() == 0 {
+			sum = sha256.Sum256(sum[:])
+			n.SetBytes(sum[:])
+		}
+		n.DivMod(n, base, digit)
+		id[i] = idAlphabet[digit.Int64()]
+	}
+	return string(id)
+}
+
+// validID reports whether id may be an id: up to idMaxLength characters of idAlphabet
+func validID(id string) bool {
+	if id == "" || len(id) > idMaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if strings.IndexByte(idAlphabet, id[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestNewID(t *testing.T) {
+	defer initIDs(idConfig{Length: idLengthDefault, Alphabet: idAlphabetDefault})
+	for _, c := range []idConfig{{}, {Length: 6, Alphabet: "0123456789abcdef"}, {Length: idMaxLength, Alphabet: "ab"}} {
+		if err := initIDs(c); err != nil {
+			t.Fatal(err)
+		}
+		id, err := newID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != idLength || strings.Trim(id, idAlphabet) != "" || !validID(id) {
+			t.Errorf("%+v makes %q", c, id)
+		}
+		if other, _ := newID(); other == id && idLength > 6 {
+			t.Errorf("%+v makes %q twice", c, id)
+		}
+		seeded := seededID("notes.txt")
+		if len(seeded) != idLength || seededID("notes.txt") != seeded || seededID("notes.md") == seeded {
+			t.Errorf("%+v makes the same ids of different seeds or different ids of the same one", c)
+		}
+	}
+	for _, c := range []idConfig{{Length: idMaxLength + 1}, {Alphabet: "a"}, {Alphabet: "aba"}, {Alphabet: "ab/"}} {
+		if initIDs(c) == nil {
+			t.Errorf("%+v is accepted", c)
+		}
+	}
+}
+
+func TestWrongPathID(t *testing.T) {
+	for _, id := range []string{"a.b", "%2E%2E", strings.Repeat("a", idMaxLength+1)} {
+		model := do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+id, nil))
+		if model.Error == nil || model.Error.Code != statusInvalidParameters {
+			t.Errorf("%s gets %+v, want %d", id, model.Error, statusInvalidParameters)
+		}
+	}
+}
+
+func TestDocumentsOfTheSameNameHaveTheirOwnIDs(t *testing.T) {
+	useDB(t, inmem.New())
+	owner, other := signIn(t, "samenamelogin"), signIn(t, "othernamelogin")
+	for _, token := range []string{owner, owner, other} {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField(tokenQuery, token)
+		mw.WriteField(metaQuery, `{"name":"notes","mime":"text/plain","created":"2019-01-01 00:00:00"}`)
+		mw.Close()
+		r := httptest.NewRequest("POST", routes["docs"], body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		if model := do(t, routes["docs"], docsHandler, r); model.Error != nil {
+			t.Fatalf("the notes are refused: %+v", model.Error)
+		}
+	}
+	docs, err := myDB.GetDocumentsList(context.Background(), &docsdb.Filter{Login: "samenamelogin", Limit: -1})
+	if err != nil || len(docs) != 2 || docs[0].ID == docs[1].ID {
+		t.Errorf("the notes uploaded twice are %v, %v", docs, err)
+	}
+}
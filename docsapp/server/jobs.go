@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// the states of a job
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// jobTTL is how long a finished job is kept for its status to be read
+const jobTTL = time.Hour
+
+// job is the work of a request going on after the answer, its status is read at /jobs/{id} by its login
+// and pushed to its feed at /events.
+// Done and Total are the bytes done of the total, -1 if it is not known
+type job struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	State string `json:"state"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+	Error string `json:"error,omitempty"`
+	Doc   string `json:"doc,omitempty"`
+	// URL is the signed url the document of the job is downloaded by without a token, if it has one
+	URL       string `json:"url,omitempty"`
+	Created   string `json:"created"`
+	login     string
+	published int64
+	updated   time.Time
+}
+
+var jobs = struct {
+	sync.Mutex
+	m map[string]*job
+}{m: make(map[string]*job)}
+
+// newJob registers a running job of login, the jobs finished jobTTL ago are dropped
+func newJob(kind, login string) (j *job, err error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	j = &job{ID: id.String(), Kind: kind, State: jobRunning, Total: -1, Created: now.Format(timeFormat), login: login, updated: now}
+	jobs.Lock()
+	defer jobs.Unlock()
+	for k, v := range jobs.m {
+		if v.State != jobRunning && now.Sub(v.updated) > jobTTL {
+			delete(jobs.m, k)
+		}
+	}
+	jobs.m[j.ID] = j
+	running.Add(1)
+	return
+}
+
+// progress sets the bytes done of the total, the feeds of the login get it every percent
+func (j *job) progress(done, total int64) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	j.Done, j.Total, j.updated = done, total, time.Now()
+	if progressStep(done, j.published, total) {
+		j.publishLocked()
+	}
+}
+
+// publishLocked pushes the job to the feeds of its login, jobs is locked
+func (j *job) publishLocked() {
+	j.published = j.Done
+	publish(j.login, event{Type: "job", Data: *j})
+}
+
+// setURL sets the url of the result of the job before it finishes
+func (j *job) setURL(u string) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	j.URL = u
+}
+
+// finish ends the job with the document it has made or the error it has failed with
+func (j *job) finish(doc string, err error) {
+	jobs.Lock()
+	defer jobs.Unlock()
+	if j.State == jobRunning {
+		defer running.Done()
+	}
+	j.updated = time.Now()
+	if err != nil {
+		j.State, j.Error = jobFailed, err.Error()
+	} else {
+		j.State, j.Doc = jobDone, doc
+	}
+	j.publishLocked()
+}
+
+// jobsHandler shows the status of the job of the login of the token on GET /jobs/{id}
+func jobsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	jobs.Lock()
+	j, ok := jobs.m[path.Base(r.URL.Path)]
+	var status job
+	if ok {
+		status = *j
+	}
+	jobs.Unlock()
+	if !ok || status.login != login {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	model := &outModel{}
+	model.Data = map[string]interface{}{"job": status}
+	return sendJSON(w, model)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+// defaultTokenTTL is how long the tokens live without sessions.ttl
+const defaultTokenTTL = 24 * time.Hour
+
+// jwtConfig is the "jwt" of config.json: Key signs the tokens with HMAC-SHA256, a random one is made at start
+// if it is empty so the tokens don't outlive the process. The instances sharing a database share the key
+type jwtConfig struct {
+	Key string `json:"key"`
+}
+
+// tokenClaims are the claims of the tokens: the login signed in, whether it is an admin, the scopes
+// and the generation of the tokens of the login, RevokeLogin moves it ahead to revoke the ones made before
+type tokenClaims struct {
+	ID         string   `json:"jti"`
+	Login      string   `json:"sub"`
+	Admin      bool     `json:"adm,omitempty"`
+	Scopes     []string `json:"scp"`
+	Generation int64    `json:"gen,omitempty"`
+	IssuedAt   int64    `json:"iat"`
+	ExpiresAt  int64    `json:"exp"`
+}
+
+// jwtHeader is the header of the tokens, the ones with another are refused whatever algorithm they tell
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+var (
+	jwtKey          []byte
+	errTokenExpired = errors.New(tokenExpiredText)
+	errTokenInvalid = errors.New(tokenInvalidText)
+)
+
+// revocations are the ids of the revoked tokens and the generations of the tokens of the logins,
+// kept here for the tokens to be checked without the database. loadRevocations reads them
+// at start and on every purge, the revocations of the other instances sharing the database come with it
+var revocations struct {
+	sync.RWMutex
+	tokens      map[string]bool
+	generations map[string]int64
+}
+
+// initJWT reads the jwt of config.json
+func initJWT(c jwtConfig) (err error) {
+	if c.Key != "" {
+		jwtKey = []byte(c.Key)
+		return
+	}
+	jwtKey = make([]byte, 32)
+	_, err = rand.Read(jwtKey)
+	if err != nil {
+		return
+	}
+	log.Println("jwt.key is not set, the tokens are valid until the server stops")
+	return
+}
+
+// tokenTTL is how long the tokens made now live
+func tokenTTL() time.Duration {
+	if sessionTTL > 0 {
+		return sessionTTL
+	}
+	return defaultTokenTTL
+}
+
+// issueToken makes a token of login with scopes
+func issueToken(login string, admin bool, scopes []string) (token string, c *tokenClaims, err error) {
+	v4, err := uuid.NewV4()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	c = &tokenClaims{ID: v4.String(), Login: login, Admin: admin, Scopes: scopes, Generation: tokenGeneration(login),
+		IssuedAt: now.Unix(), ExpiresAt: now.Add(tokenTTL()).Unix()}
+	token, err = signToken(c)
+	return
+}
+
+// signToken encodes c as a token signed by jwtKey
+func signToken(c *tokenClaims) (token string, err error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	token = jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return token + "." + base64.RawURLEncoding.EncodeToString(tokenSignature(token)), nil
+}
+
+// tokenSignature is the signature of the header and the payload of a token
+func tokenSignature(signed string) []byte {
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+// parseToken checks the signature and the expiry of token and answers its claims,
+// errTokenExpired if it has expired and errTokenInvalid if it is not one of the tokens signed by jwtKey
+func parseToken(token string) (c *tokenClaims, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, errTokenInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, tokenSignature(parts[0]+"."+parts[1])) {
+		return nil, errTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	c = &tokenClaims{}
+	if json.Unmarshal(payload, c) != nil || c.Login == "" || c.ID == "" {
+		return nil, errTokenInvalid
+	}
+	if c.ExpiresAt <= time.Now().Unix() {
+		return c, errTokenExpired
+	}
+	return c, nil
+}
+
+// checkToken is parseToken refusing the revoked tokens with errTokenInvalid too
+func checkToken(token string) (c *tokenClaims, err error) {
+	c, err = parseToken(token)
+	if err != nil {
+		return
+	}
+	if isRevoked(c) {
+		return nil, errTokenInvalid
+	}
+	return
+}
+
+// tokenLogin is the login of token, "" if it is not a valid one
+func tokenLogin(token string) string {
+	c, err := checkToken(token)
+	if err != nil {
+		return ""
+	}
+	return c.Login
+}
+
+// expiresAtOf is the time c expires at in the format of the answers
+func expiresAtOf(c *tokenClaims) string {
+	return time.Unix(c.ExpiresAt, 0).Format(timeFormat)
+}
+
+// loadRevocations reads the revoked tokens not expired yet and the generations of the tokens of the logins
+func loadRevocations(ctx context.Context) (err error) {
+	ids, err := myDB.GetRevokedTokens(ctx, time.Now().Format(timeFormat))
+	if err != nil {
+		return
+	}
+	generations, err := myDB.GetTokenGenerations(ctx)
+	if err != nil {
+		return
+	}
+	tokens := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		tokens[id] = true
+	}
+	revocations.Lock()
+	defer revocations.Unlock()
+	revocations.tokens, revocations.generations = tokens, generations
+	return
+}
+
+// isRevoked reports whether the token of c is revoked by itself or along with the other tokens of its login
+func isRevoked(c *tokenClaims) bool {
+	revocations.RLock()
+	defer revocations.RUnlock()
+	return revocations.tokens[c.ID] || c.Generation < revocations.generations[c.Login]
+}
+
+// tokenGeneration is the generation of the tokens of login made now
+func tokenGeneration(login string) int64 {
+	revocations.RLock()
+	defer revocations.RUnlock()
+	return revocations.generations[login]
+}
+
+// revokeClaims revokes the token of c until it expires, it reports false if it is revoked already
+func revokeClaims(ctx context.Context, c *tokenClaims) (revoked bool, err error) {
+	revoked, err = myDB.RevokeToken(ctx, c.ID, expiresAtOf(c))
+	if err != nil {
+		return
+	}
+	revocations.Lock()
+	defer revocations.Unlock()
+	if revocations.tokens == nil {
+		revocations.tokens = make(map[string]bool)
+	}
+	revocations.tokens[c.ID] = true
+	return
+}
+
+// revokeLoginTokens revokes every token of login made so far, the refresh tokens too
+func revokeLoginTokens(ctx context.Context, login string) (err error) {
+	_, err = myDB.DeleteRefreshTokens(ctx, login, "")
+	if err != nil {
+		return
+	}
+	generation, err := myDB.RevokeLogin(ctx, login)
+	if err != nil {
+		return
+	}
+	revocations.Lock()
+	defer revocations.Unlock()
+	if revocations.generations == nil {
+		revocations.generations = make(map[string]int64)
+	}
+	if generation > revocations.generations[login] {
+		revocations.generations[login] = generation
+	}
+	return
+}
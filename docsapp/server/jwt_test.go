@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestTokensAreCheckedWithoutTheDatabase(t *testing.T) {
+	token, c, err := issueToken("jwtlogin", true, []string{scopeDocsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a token needs no database, the claims tell the login, the admin flag, the scopes and the expiry
+	useDB(t, nil)
+	got, err := checkToken(token)
+	if err != nil || got.Login != "jwtlogin" || !got.Admin || strings.Join(got.Scopes, " ") != scopeDocsRead || got.ExpiresAt != c.ExpiresAt {
+		t.Errorf("the claims are %+v, %v", got, err)
+	}
+	if d := time.Until(time.Unix(c.ExpiresAt, 0)); d <= defaultTokenTTL-time.Minute || d > defaultTokenTTL {
+		t.Errorf("a token lives %v, want %v", d, defaultTokenTTL)
+	}
+
+	parts := strings.Split(token, ".")
+	admin := base64.RawURLEncoding.EncodeToString([]byte(`{"jti":"1","sub":"jwtadmin","adm":true,"scp":["admin"],"exp":9999999999}`))
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	for name, forged := range map[string]string{
+		"the changed claims": parts[0] + "." + admin + "." + parts[2],
+		"no signature":       none + "." + admin + ".",
+		"another key":        parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 32)),
+		"a uuid":             "143136bc-4439-42f9-9e5b-21303849e14d",
+	} {
+		if _, err = checkToken(forged); err != errTokenInvalid {
+			t.Errorf("%s gets %v, want %v", name, err, errTokenInvalid)
+		}
+	}
+}
+
+func TestRevokedTokensAreRefused(t *testing.T) {
+	useDB(t, inmem.New())
+	ctx := context.Background()
+	first, c, err := issueToken("revokedlogin", false, userScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := issueToken("revokedlogin", false, userScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := revokeClaims(ctx, c); err != nil || !revoked {
+		t.Fatalf("the revocation is %v, %v", revoked, err)
+	}
+	if tokenLogin(first) != "" || tokenLogin(second) == "" {
+		t.Error("the revocation of a token is not of that token only")
+	}
+	if err = revokeLoginTokens(ctx, "revokedlogin"); err != nil {
+		t.Fatal(err)
+	}
+	if tokenLogin(second) != "" {
+		t.Error("a token of a revoked login is valid")
+	}
+	third, _, err := issueToken("revokedlogin", false, userScopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenLogin(third) == "" {
+		t.Error("a token made after the revocation of the login is refused")
+	}
+
+	// the other instances sharing the database read the revocations
+	revocations.tokens, revocations.generations = nil, nil
+	if tokenLogin(second) == "" {
+		t.Fatal("the revocations are not forgotten")
+	}
+	if err = loadRevocations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tokenLogin(first) != "" || tokenLogin(second) != "" || tokenLogin(third) == "" {
+		t.Error("the loaded revocations are not the ones made")
+	}
+}
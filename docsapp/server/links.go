@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	linksRoute    = "links"
+	linkToQuery   = "to"
+	linkTypeQuery = "type"
+)
+
+// linkTypeRe is of the types like supersedes or attachment-of
+var linkTypeRe = regexp.MustCompile(`^[a-z][a-z-]{0,31}$`)
+
+// linksHandler serves GET, POST and DELETE /docs/{id}/links.
+// The links of a document are read by the ones the document is read by, a link is made and removed
+// by the ones the document is changed by if they read the linked one too
+func linksHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	switch r.Method {
+	case "GET", "POST", "DELETE":
+	case "HEAD", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	_, err = docAccess(r, id, r.Method != "GET")
+	if err != nil {
+		return
+	}
+	model := &outModel{}
+	if r.Method == "GET" {
+		var links []*docsdb.Link
+		links, err = myDB.GetLinks(r.Context(), id)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		outgoing, incoming := make([]*docsdb.Link, 0), make([]*docsdb.Link, 0)
+		for _, l := range links {
+			if l.From == id {
+				outgoing = append(outgoing, l)
+			} else {
+				incoming = append(incoming, l)
+			}
+		}
+		model.Data = map[string]interface{}{linksRoute: map[string]interface{}{"outgoing": outgoing, "incoming": incoming}}
+		return sendJSON(w, model)
+	}
+	link := &docsdb.Link{From: id, To: r.Form.Get(linkToQuery), Type: r.Form.Get(linkTypeQuery)}
+	if !linkTypeRe.MatchString(link.Type) {
+		errorHandler(statusInvalidParameters, "the type of the link is up to 32 lowercase latin letters and -, e.g. supersedes", &err)
+		return
+	}
+	if link.To == "" || link.To == id {
+		errorHandler(statusInvalidParameters, "the linked document is to be another one", &err)
+		return
+	}
+	if r.Method == "POST" {
+		_, err = docAccess(r, link.To, false)
+		if err != nil {
+			return
+		}
+		err = myDB.AddLink(r.Context(), link)
+	} else {
+		err = myDB.DeleteLink(r.Context(), link)
+	}
+	if err == errNoRows {
+		errorHandler(statusInvalidParameters, "there is no such link", &err)
+		return
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	change := "+"
+	if r.Method == "DELETE" {
+		change = "-"
+	}
+	recordActivity(r, id, activityLink, change+link.Type+" "+link.To)
+	model.Response = map[string]interface{}{"link": link}
+	return sendJSON(w, model)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+// the environment variables of the locations, they are over config.json and under the flags
+const (
+	envAddr = "DOCSAPP_ADDR"
+	envDB   = "DOCSAPP_DB"
+	envData = "DOCSAPP_DATA"
+)
+
+var (
+	addrFlag = flag.String("addr", "", "host:port to listen on, over $"+envAddr+" and addr of config.json, "+defaultHost+" by default")
+	dbFlag   = flag.String("db", "", "the database, over $"+envDB+" and db.path of config.json, "+dbPath+" by default")
+	dataFlag = flag.String("data", "", "the directory of the files, over $"+envData+" and data_dir of config.json, "+dataPath+" by default")
+	// listenAddr is the host:port the server listens on
+	listenAddr = defaultHost
+)
+
+// initLocations settles where the server listens, its database and its files from the flags, the environment,
+// config.json and the defaults in this order into c, the data directory is made if it is missing.
+// It runs after flag.Parse, so it is not a part of setup
+func initLocations(c *configuration) (err error) {
+	c.Addr = firstSet(*addrFlag, os.Getenv(envAddr), c.Addr, defaultHost)
+	c.DB.Path = firstSet(*dbFlag, os.Getenv(envDB), c.DB.Path, dbPath)
+	c.DataDir = firstSet(*dataFlag, os.Getenv(envData), c.DataDir, dataPath)
+	_, port, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return errors.Wrap(err, "addr")
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return errors.Errorf("addr %s has no port number", c.Addr)
+	}
+	if fi, err := os.Stat(filepath.FromSlash(c.DB.Path)); err == nil && fi.IsDir() {
+		return errors.Errorf("db.path %s is a directory", c.DB.Path)
+	}
+	dir := filepath.FromSlash(c.DataDir)
+	err = os.MkdirAll(dir, storage.DirPerm)
+	if err != nil {
+		return errors.Wrap(err, "data_dir")
+	}
+	listenAddr, store = c.Addr, storage.Dir(dir)
+	return
+}
+
+// firstSet is the first of values that is not empty
+func firstSet(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestLocationsFollowFlagsEnvAndConfig(t *testing.T) {
+	defer func(a string, s storage.Dir) { listenAddr, store = a, s }(listenAddr, store)
+	dir := t.TempDir()
+	c := &configuration{Addr: "0.0.0.0:9000", DataDir: filepath.Join(dir, "files")}
+	err := initLocations(c)
+	if err != nil || listenAddr != "0.0.0.0:9000" || string(store) != filepath.Join(dir, "files") || c.DB.Path != dbPath {
+		t.Fatalf("config.json makes %s, %s, %s, %v", listenAddr, store, c.DB.Path, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "files")); err != nil || !fi.IsDir() {
+		t.Errorf("the data directory is not made: %v", err)
+	}
+	t.Setenv(envAddr, ":9001")
+	t.Setenv(envDB, filepath.Join(dir, "env.db"))
+	defer func() { *addrFlag = "" }()
+	*addrFlag = "127.0.0.1:9002"
+	err = initLocations(c)
+	if err != nil || listenAddr != "127.0.0.1:9002" || c.DB.Path != filepath.Join(dir, "env.db") {
+		t.Errorf("the flag and the environment make %s, %s, %v", listenAddr, c.DB.Path, err)
+	}
+	*addrFlag = ""
+	t.Setenv(envAddr, "")
+	t.Setenv(envDB, "")
+	for _, bad := range []*configuration{
+		{Addr: "localhost"},
+		{Addr: "localhost:http"},
+		{Addr: "localhost:70000"},
+		{DB: dbConfig{Path: dir}},
+	} {
+		if err = initLocations(bad); err == nil {
+			t.Errorf("%+v is taken", bad)
+		}
+	}
+}
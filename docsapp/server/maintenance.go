@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	enabledQuery = "enabled"
+	messageQuery = "message"
+	// maintenanceMessage is the banner of the maintenance without a message
+	maintenanceMessage = "the server is under maintenance, changes are not accepted for a while"
+)
+
+// maintenanceConfig is the "maintenance" of config.json, the state the server starts in
+type maintenanceConfig struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// maintenance is switched by the admins at /maintenance: the reads go on, the writes are answered with 503
+// and every answer has the banner
+var maintenance struct {
+	sync.RWMutex
+	maintenanceConfig
+}
+
+func setMaintenance(c maintenanceConfig) {
+	if c.Message == "" {
+		c.Message = maintenanceMessage
+	}
+	maintenance.Lock()
+	maintenance.maintenanceConfig = c
+	maintenance.Unlock()
+}
+
+// maintenanceBanner is the message of the maintenance, "" if there is none
+func maintenanceBanner() string {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+	if !maintenance.Enabled {
+		return ""
+	}
+	return maintenance.Message
+}
+
+// blockedByMaintenance reports whether the request of the route is a write to be refused
+func blockedByMaintenance(r *http.Request, route string) bool {
+	if route == routes["maintenance"] {
+		return false
+	}
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	}
+	return maintenanceBanner() != ""
+}
+
+// maintenanceHandler shows the maintenance state on GET and switches it on PUT enabled=true&message=...
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "PUT":
+	case "HEAD", "POST", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	admin, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if !admin {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	if r.Method == "PUT" {
+		c := maintenanceConfig{Message: r.Form.Get(messageQuery)}
+		c.Enabled, err = strconv.ParseBool(r.Form.Get(enabledQuery))
+		if err != nil {
+			errorHandler(statusInvalidParameters, "enabled is true or false", &err)
+			return
+		}
+		setMaintenance(c)
+	}
+	maintenance.RLock()
+	model := &outModel{}
+	model.Response = map[string]interface{}{enabledQuery: maintenance.Enabled, messageQuery: maintenance.Message}
+	maintenance.RUnlock()
+	return sendJSON(w, model)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// the inline markup of markdown, on the escaped text
+var (
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	mdStrong = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdEm     = regexp.MustCompile(`\*([^*]+)\*`)
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdHeader = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdItem   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdNumber = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+)
+
+// markdownToHTML converts the common markdown: headers, paragraphs, lists, fenced code,
+// code spans, emphasis and links, the rest is kept as text. Everything is escaped, raw html is not passed,
+// and the links other than http, https, mailto and the relative ones are dropped
+func markdownToHTML(in io.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	w.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\" /></head>\n<body>\n")
+	var paragraph []string
+	var list string
+	var code bool
+	flush := func() {
+		if len(paragraph) > 0 {
+			w.WriteString("<p>" + mdInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+		if list != "" {
+			w.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	item := func(tag, text string) {
+		if len(paragraph) > 0 || list != tag {
+			flush()
+			list = tag
+			w.WriteString("<" + tag + ">\n")
+		}
+		w.WriteString("<li>" + mdInline(text) + "</li>\n")
+	}
+	s := bufio.NewScanner(in)
+	s.Buffer(make([]byte, 64*1024), maxMB)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		if strings.HasPrefix(line, "```") {
+			if code {
+				w.WriteString("</code></pre>\n")
+			} else {
+				flush()
+				w.WriteString("<pre><code>")
+			}
+			code = !code
+			continue
+		}
+		if code {
+			w.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+		if m := mdHeader.FindStringSubmatch(line); m != nil {
+			flush()
+			n := string(rune('0' + len(m[1])))
+			w.WriteString("<h" + n + ">" + mdInline(m[2]) + "</h" + n + ">\n")
+		} else if m := mdItem.FindStringSubmatch(line); m != nil {
+			item("ul", m[1])
+		} else if m := mdNumber.FindStringSubmatch(line); m != nil {
+			item("ol", m[1])
+		} else if strings.TrimSpace(line) == "" {
+			flush()
+		} else {
+			if list != "" {
+				flush()
+			}
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	if code {
+		w.WriteString("</code></pre>\n")
+	}
+	flush()
+	w.WriteString("</body>\n</html>\n")
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// mdInline converts the inline markup of text
+func mdInline(text string) string {
+	text = html.EscapeString(text)
+	var spans []string
+	// the code spans are put aside so their content is not converted
+	text = mdCode.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+mdCode.FindStringSubmatch(m)[1]+"</code>")
+		return "\x00"
+	})
+	text = mdLink.ReplaceAllStringFunc(text, func(m string) string {
+		sub := mdLink.FindStringSubmatch(m)
+		href := html.UnescapeString(sub[2])
+		if i := strings.IndexAny(href, ":/?#"); i >= 0 && href[i] == ':' {
+			scheme := strings.ToLower(href[:i])
+			if scheme != "http" && scheme != "https" && scheme != "mailto" {
+				return sub[1]
+			}
+		}
+		return `<a href="` + html.EscapeString(href) + `">` + sub[1] + "</a>"
+	})
+	text = mdStrong.ReplaceAllString(text, "<strong>$1</strong>")
+	text = mdEm.ReplaceAllString(text, "<em>$1</em>")
+	for _, span := range spans {
+		text = strings.Replace(text, "\x00", span, 1)
+	}
+	return text
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	in := "# Title\n\nsome *text* with `a<b` and [a link](https://example.com)\n\n- one\n- two\n\n[bad](javascript:alert(1)) <script>\n"
+	out := &bytes.Buffer{}
+	err := markdownToHTML(strings.NewReader(in), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<h1>Title</h1>",
+		"<em>text</em>",
+		"<code>a&lt;b</code>",
+		`<a href="https://example.com">a link</a>`,
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>",
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%q is not in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out.String(), `href="javascript`) {
+		t.Errorf("the javascript link is kept in\n%s", out)
+	}
+}
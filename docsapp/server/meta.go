@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	metaRoute = "meta"
+	// metaFilterPrefix starts the parameters of GET /docs filtering by the custom keys, meta.project=alpha
+	metaFilterPrefix = "meta."
+	// metaValueMax is the greatest size of a value in bytes for the keys meta_limits doesn't have
+	metaValueMax = 1024
+)
+
+var metaKeyRe = regexp.MustCompile(`^[\w-]{1,64}$`)
+
+// metaLimit is the greatest size of the value of key, "*" of meta_limits is of the keys it doesn't list
+func metaLimit(key string) int {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if n, ok := config.MetaLimits[key]; ok {
+		return n
+	}
+	if n, ok := config.MetaLimits["*"]; ok {
+		return n
+	}
+	return metaValueMax
+}
+
+// parseMeta reads the value of key from body, a JSON string, number or boolean
+func parseMeta(key string, body []byte) (m *docsdb.Meta, ok bool) {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return
+	}
+	m = &docsdb.Meta{Key: key}
+	switch v := v.(type) {
+	case string:
+		m.Type, m.Value = docsdb.MetaString, v
+	case float64:
+		m.Type, m.Value = docsdb.MetaNumber, strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		m.Type, m.Value = docsdb.MetaBool, strconv.FormatBool(v)
+	default:
+		return nil, false
+	}
+	return m, true
+}
+
+// metaValue is the value of m of its type
+func metaValue(m *docsdb.Meta) interface{} {
+	switch m.Type {
+	case docsdb.MetaNumber:
+		if v, err := strconv.ParseFloat(m.Value, 64); err == nil {
+			return v
+		}
+	case docsdb.MetaBool:
+		if v, err := strconv.ParseBool(m.Value); err == nil {
+			return v
+		}
+	}
+	return m.Value
+}
+
+// metaFilter reads the meta.{key} parameters of r
+func metaFilter(r *http.Request) (meta map[string]string, err error) {
+	for k, v := range r.Form {
+		if !strings.HasPrefix(k, metaFilterPrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(k, metaFilterPrefix)
+		if !metaKeyRe.MatchString(key) {
+			errorHandler(statusInvalidParameters, "invalid key "+key+": up to 64 latin letters, digits, _ and -", &err)
+			return
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[key] = v[0]
+	}
+	return
+}
+
+// metaHandler serves GET /docs/{id}/meta, GET, PUT and DELETE /docs/{id}/meta/{key}.
+// The keys are read by the ones the document is read by and changed by the granted users and admins
+func metaHandler(w http.ResponseWriter, r *http.Request, id string, key string) (err error) {
+	if key != "" && !metaKeyRe.MatchString(key) {
+		errorHandler(statusInvalidParameters, "invalid key: up to 64 latin letters, digits, _ and -", &err)
+		return
+	}
+	switch r.Method {
+	case "GET", "PUT", "DELETE":
+	case "HEAD", "POST", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	if r.Method != "GET" && key == "" {
+		errorHandler(statusInvalidParameters, "the key is missing: "+routes["docsID"]+"{id}/"+metaRoute+"/{key}", &err)
+		return
+	}
+	_, err = docAccess(r, id, r.Method != "GET")
+	if err != nil {
+		return
+	}
+	model := &outModel{}
+	switch r.Method {
+	case "GET":
+		var meta []*docsdb.Meta
+		meta, err = myDB.GetMeta(r.Context(), id)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		values := make(map[string]interface{}, len(meta))
+		for _, m := range meta {
+			if key == "" || m.Key == key {
+				values[m.Key] = metaValue(m)
+			}
+		}
+		if key != "" && len(values) == 0 {
+			errorHandler(statusInvalidParameters, "the document has no key "+key, &err)
+			return
+		}
+		model.Data = map[string]interface{}{metaRoute: values}
+	case "PUT":
+		limit := metaLimit(key)
+		var body []byte
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+		if err != nil {
+			errorHandler(statusInvalidParameters, "", &err)
+			return
+		}
+		if len(body) > limit {
+			errorHandler(statusInvalidParameters, fmt.Sprintf("the value of %s is limited by %d bytes", key, limit), &err)
+			return
+		}
+		m, ok := parseMeta(key, body)
+		if !ok {
+			errorHandler(statusInvalidParameters, "the value is a JSON string, number or boolean", &err)
+			return
+		}
+		err = myDB.SetMeta(r.Context(), id, m)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		recordActivity(r, id, activityMeta, "+"+key)
+		model.Response = map[string]interface{}{key: metaValue(m)}
+	case "DELETE":
+		err = myDB.DeleteMeta(r.Context(), id, key)
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "the document has no key "+key, &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		recordActivity(r, id, activityMeta, "-"+key)
+		model.Response = map[string]interface{}{key: true}
+	}
+	return sendJSON(w, model)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	contentTypeMetrics = "text/plain; version=0.0.4; charset=utf-8"
+	// storageUsageTTL is how long the usage of the data directory is kept, a scrape doesn't walk it every time
+	storageUsageTTL = time.Minute
+)
+
+// breakerStates are the values of the docsdb_breaker_state gauge
+var breakerStates = map[string]int{docsdb.BreakerClosed: 0, docsdb.BreakerOpen: 1, docsdb.BreakerHalfOpen: 2}
+
+// the metrics the handlers, the uploads and the queries are counted in
+var (
+	requestsTotal   = &counterVec{}
+	requestDuration = newHistogram(.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10)
+	uploadBytes     = newHistogram(1<<10, 16<<10, 128<<10, 1<<20, 4<<20, 16<<20, maxMB)
+	queryDuration   = newHistogram(.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1)
+	storageUsage    struct {
+		sync.Mutex
+		files, bytes int64
+		read         time.Time
+	}
+)
+
+// metricMethods are the methods the requests are counted by, the others are OTHER
+var metricMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true}
+
+// counterVec is a counter by its label values
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+// add adds n to the counter of labels
+func (c *counterVec) add(labels string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]int64)
+	}
+	c.values[labels] += n
+}
+
+// write writes the counter in the Prometheus text format
+func (c *counterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(c.values))
+	for labels := range c.values {
+		keys = append(keys, labels)
+	}
+	// sorted for the scrapes to list the series alike
+	sort.Strings(keys)
+	for _, labels := range keys {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels, c.values[labels])
+	}
+}
+
+// histogram is a histogram by its label values, buckets are the upper bounds of the buckets, +Inf aside
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries are the observations of a histogram with some label values, counts by the buckets
+type histogramSeries struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func newHistogram(buckets ...float64) *histogram {
+	return &histogram{buckets: buckets, series: make(map[string]*histogramSeries)}
+}
+
+// observe adds v to the histogram of labels
+func (h *histogram) observe(labels string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[labels]
+	if s == nil {
+		s = &histogramSeries{counts: make([]int64, len(h.buckets))}
+		h.series[labels] = s
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// write writes the histogram in the Prometheus text format
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(h.series))
+	for labels := range h.series {
+		keys = append(keys, labels)
+	}
+	sort.Strings(keys)
+	for _, labels := range keys {
+		s := h.series[labels]
+		sep := labels
+		if sep != "" {
+			sep += ","
+		}
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, sep, strconv.FormatFloat(le, 'g', -1, 64), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, sep, s.count)
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %v\n%s_count%s %d\n", name, labels, s.sum, name, labels, s.count)
+	}
+}
+
+// labelEscaper escapes the values of the labels
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels makes the labels of the pairs of names and values, like route="/docs",method="GET"
+func metricLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i] + `="` + labelEscaper.Replace(pairs[i+1]) + `"`)
+	}
+	return b.String()
+}
+
+// observeRequest counts the request of the route answered with code in d
+func observeRequest(route, method string, code int, d time.Duration) {
+	if !metricMethods[method] {
+		method = "OTHER"
+	}
+	requestsTotal.add(metricLabels("route", route, "method", method, "code", strconv.Itoa(code)), 1)
+	requestDuration.observe(metricLabels("route", route, "method", method), d.Seconds())
+}
+
+// observeQuery is the docsdb.QueryObserver of myDB
+func observeQuery(query string, d time.Duration) {
+	queryDuration.observe(metricLabels("query", query), d.Seconds())
+}
+
+// readStorageUsage is the usage of the data directory, read again once storageUsageTTL has passed
+func readStorageUsage() (files, bytes int64) {
+	storageUsage.Lock()
+	defer storageUsage.Unlock()
+	if time.Since(storageUsage.read) > storageUsageTTL {
+		f, b, err := store.Usage()
+		if err != nil {
+			log.Printf("the usage of the data directory: %v", err)
+		} else {
+			storageUsage.files, storageUsage.bytes, storageUsage.read = f, b, time.Now()
+		}
+	}
+	return storageUsage.files, storageUsage.bytes
+}
+
+// isAdminToken reports whether token is the admin token, compared in constant time.
+// No token is the admin one while config.json has none
+func isAdminToken(token string) bool {
+	return config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) == 1
+}
+
+// writeMetric writes a metric without labels in the Prometheus text format
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// metricsHandler serves the metrics to the holders of the admin token from the admin addresses
+func metricsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	if !isAdminToken(requestToken(r)) || !adminAccess.permits(clientIP(r)) {
+		errorHandler(statusAccessDenied, "", &err)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeMetrics)
+	s := dbBreaker.Stats()
+	writeMetric(w, "docsdb_breaker_state", "gauge", "The state of the database breaker: 0 closed, 1 open, 2 half-open.", breakerStates[s.State])
+	writeMetric(w, "docsdb_breaker_failures", "gauge", "The failures of the database in a row.", s.Failures)
+	writeMetric(w, "docsdb_breaker_trips_total", "counter", "The times the database breaker has opened.", s.Trips)
+	writeMetric(w, "docsdb_query_timeouts_total", "counter", "The queries timed out.", s.Timeouts)
+	queryDuration.write(w, "docsdb_query_duration_seconds", "The time the queries take by their methods.")
+	writeMetric(w, "docsapp_panics_total", "counter", "The panics of the handlers recovered.", atomic.LoadInt64(&panics))
+	requestsTotal.write(w, "docsapp_requests_total", "The requests answered by the route, the method and the status.")
+	requestDuration.write(w, "docsapp_request_duration_seconds", "The time the requests take by the route and the method.")
+	uploadBytes.write(w, "docsapp_upload_bytes", "The sizes of the files uploaded.")
+	files, bytes := readStorageUsage()
+	writeMetric(w, "docsapp_storage_files", "gauge", "The files in the data directory.", files)
+	writeMetric(w, "docsapp_storage_bytes", "gauge", "The bytes of the files in the data directory.", bytes)
+	return
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestHistogramIsWrittenCumulative(t *testing.T) {
+	h := newHistogram(1, 10)
+	for _, v := range []float64{0.5, 5, 50} {
+		h.observe(metricLabels("query", `Get"Doc`), v)
+	}
+	b := &bytes.Buffer{}
+	h.write(b, "h", "A histogram.")
+	want := `# HELP h A histogram.
+# TYPE h histogram
+h_bucket{query="Get\"Doc",le="1"} 1
+h_bucket{query="Get\"Doc",le="10"} 2
+h_bucket{query="Get\"Doc",le="+Inf"} 3
+h_sum{query="Get\"Doc"} 55.5
+h_count{query="Get\"Doc"} 3
+`
+	if b.String() != want {
+		t.Errorf("the histogram is written as\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestMetricsCountTheRequests(t *testing.T) {
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	storageUsage.read = time.Time{}
+	dbBreaker = docsdb.Guarded(inmem.New(), docsdb.BreakerOptions{})
+	useDB(t, docsdb.Traced(dbBreaker, tracer, observeQuery))
+	signIn(t, "metricslogin")
+	makeHandler("/teapot", func(w http.ResponseWriter, r *http.Request) (err error) {
+		errorHandler(statusConflict, "", &err)
+		return
+	})(httptest.NewRecorder(), httptest.NewRequest("BREW", "/teapot", nil))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", routes["metrics"], nil)
+	r.Header.Set("Authorization", "Bearer "+config.AdminToken)
+	makeHandler(routes["metrics"], metricsHandler)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("the metrics are answered with %d: %s", w.Code, w.Body)
+	}
+	// the other tests are counted too, the series of the route of this one only has a known value
+	for _, series := range []string{
+		`docsapp_requests_total{route="/teapot",method="OTHER",code="409"} 1`,
+		`docsapp_requests_total{route="/register",method="POST",code="200"} `,
+		`docsapp_request_duration_seconds_count{route="/auth",method="POST"} `,
+		`docsdb_query_duration_seconds_count{query="AddUser"} `,
+		"docsapp_storage_files 0",
+	} {
+		if !strings.Contains(w.Body.String(), "\n"+series) {
+			t.Errorf("the metrics have no %s:\n%s", series, w.Body)
+		}
+	}
+	r = httptest.NewRequest("GET", routes["metrics"], nil)
+	if model := do(t, routes["metrics"], metricsHandler, r); model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("the metrics are answered without the admin token: %+v", model)
+	}
+	defer func(token string) { config.AdminToken = token }(config.AdminToken)
+	config.AdminToken = ""
+	r = httptest.NewRequest("GET", routes["metrics"], nil)
+	if model := do(t, routes["metrics"], metricsHandler, r); model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("the metrics are answered while config.json has no admin token: %+v", model)
+	}
+}
@@ -0,0 +1,71 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Activity is the model of the database table DocActivity: what Login has done to the document Doc
+// at Created, ID orders the entries of a document as they were added
+type Activity struct {
+	ID      int64  `json:"id" xml:"id"`
+	Doc     string `json:"doc" xml:"doc"`
+	Login   string `json:"login" xml:"login"`
+	Type    string `json:"type" xml:"type"`
+	Detail  string `json:"detail,omitempty" xml:"detail,omitempty"`
+	Created string `json:"created" xml:"created"`
+}
+
+// AddActivity adds the entry to the activity of its document and sets its ID, sql.ErrNoRows if there is no document
+func (h *Handler) AddActivity(ctx context.Context, a *Activity) (err error) {
+	res, err := h.stmtInsActivity.ExecContext(ctx, a.Login, a.Type, a.Detail, a.Created, a.Doc)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	a.ID, err = res.LastInsertId()
+	return
+}
+
+// GetActivity finds up to limit entries of the activity of the document with id added after the one with after,
+// the earliest first. A negative limit is no limit
+func (h *Handler) GetActivity(ctx context.Context, id string, after int64, limit int) (activity []*Activity, err error) {
+	rows, err := h.stmtGetActivity.QueryContext(ctx, id, after, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := &Activity{Doc: id}
+		err = rows.Scan(&a.ID, &a.Login, &a.Type, &a.Detail, &a.Created)
+		if err != nil {
+			return
+		}
+		activity = append(activity, a)
+	}
+	return activity, rows.Err()
+}
+
+// prepareActivity prepares the statements of the activity
+func (h *Handler) prepareActivity() (err error) {
+	h.stmtInsActivity, err = h.db.Prepare(`INSERT INTO DocActivity(docid, login, type, detail, created) SELECT docid, ?, ?, ?, ? FROM Document WHERE id=?`)
+	if err != nil {
+		return
+	}
+	h.stmtGetActivity, err = h.db.Prepare(`
+	SELECT a.aid, a.login, a.type, a.detail, a.created FROM DocActivity as a INNER JOIN Document as d USING(docid)
+	WHERE d.id=? AND a.aid>?
+	ORDER BY a.aid
+	LIMIT ?`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteActivityDocID, err = h.db.Prepare(`DELETE FROM DocActivity WHERE docid=?`)
+	return
+}
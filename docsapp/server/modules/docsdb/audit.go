@@ -0,0 +1,55 @@
+package docsdb
+
+import (
+	"context"
+)
+
+// Audit is the model of the database table Audit: what Actor has done to the account of Login at Created,
+// ID orders the entries as they were added. The logins are kept as they were for the users who are gone
+type Audit struct {
+	ID      int64  `json:"id" xml:"id"`
+	Actor   string `json:"actor" xml:"actor"`
+	Login   string `json:"login" xml:"login"`
+	Action  string `json:"action" xml:"action"`
+	Detail  string `json:"detail,omitempty" xml:"detail,omitempty"`
+	Created string `json:"created" xml:"created"`
+}
+
+// AddAudit adds the entry to the audit log and sets its ID
+func (h *Handler) AddAudit(ctx context.Context, a *Audit) (err error) {
+	res, err := h.stmtInsAudit.ExecContext(ctx, a.Actor, a.Login, a.Action, a.Detail, a.Created)
+	if err != nil {
+		return
+	}
+	a.ID, err = res.LastInsertId()
+	return
+}
+
+// GetAudit finds up to limit entries of the audit log added after the one with after, the earliest first.
+// A negative limit is no limit
+func (h *Handler) GetAudit(ctx context.Context, after int64, limit int) (audit []*Audit, err error) {
+	rows, err := h.stmtGetAudit.QueryContext(ctx, after, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := &Audit{}
+		err = rows.Scan(&a.ID, &a.Actor, &a.Login, &a.Action, &a.Detail, &a.Created)
+		if err != nil {
+			return
+		}
+		audit = append(audit, a)
+	}
+	return audit, rows.Err()
+}
+
+// prepareAudit prepares the statements of the audit log
+func (h *Handler) prepareAudit() (err error) {
+	h.stmtInsAudit, err = h.db.Prepare(`INSERT INTO Audit(actor, login, action, detail, created) VALUES (?,?,?,?,?)`)
+	if err != nil {
+		return
+	}
+	h.stmtGetAudit, err = h.db.Prepare(`SELECT aid, actor, login, action, detail, created FROM Audit WHERE aid>? ORDER BY aid LIMIT ?`)
+	return
+}
@@ -0,0 +1,120 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Blob is the model of the database table Blob: the file of Name, the name of a document, is the content
+// of Hash, the hex sha256, in the storage. The documents with the same content share it
+type Blob struct {
+	Name string `json:"name" xml:"name"`
+	Hash string `json:"hash" xml:"hash"`
+	Size int64  `json:"size" xml:"size"`
+}
+
+// SetBlob maps the name of blob to its content, the content it had before is replaced.
+// The documents of the file get the size and the hash of the content
+func (h *Handler) SetBlob(ctx context.Context, blob *Blob) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.StmtContext(ctx, h.stmtSetBlob).ExecContext(ctx, blob.Name, blob.Hash, blob.Size)
+	if err != nil {
+		return
+	}
+	_, err = tx.StmtContext(ctx, h.stmtSetDocFile).ExecContext(ctx, blob.Size, blob.Hash, blob.Name)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// fileOf is the size and the hash of the content of the file of d, 0 and "" if it is not a file or is not mapped
+func (h *Handler) fileOf(ctx context.Context, tx *sql.Tx, d *Doc) (size int64, hash string, err error) {
+	if !d.File {
+		return
+	}
+	var name string
+	err = tx.StmtContext(ctx, h.stmtGetBlob).QueryRowContext(ctx, d.Name).Scan(&name, &hash, &size)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// GetBlob finds the content of the file of name, sql.ErrNoRows if it is not mapped
+func (h *Handler) GetBlob(ctx context.Context, name string) (b *Blob, err error) {
+	b = &Blob{}
+	err = h.stmtGetBlob.QueryRowContext(ctx, name).Scan(&b.Name, &b.Hash, &b.Size)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GetBlobs finds up to limit mappings ordered by the names after the one of after, a negative limit is no limit
+func (h *Handler) GetBlobs(ctx context.Context, after string, limit int) (blobs []*Blob, err error) {
+	rows, err := h.stmtGetBlobs.QueryContext(ctx, after, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &Blob{}
+		err = rows.Scan(&b.Name, &b.Hash, &b.Size)
+		if err != nil {
+			return
+		}
+		blobs = append(blobs, b)
+	}
+	return blobs, rows.Err()
+}
+
+// CountBlobs counts the names mapped to the content of hash, the content of none is not needed
+func (h *Handler) CountBlobs(ctx context.Context, hash string) (n int64, err error) {
+	err = h.stmtCountBlobs.QueryRowContext(ctx, hash).Scan(&n)
+	return
+}
+
+// DeleteBlob drops the mapping of name and answers what it was, sql.ErrNoRows if it is not mapped
+func (h *Handler) DeleteBlob(ctx context.Context, name string) (b *Blob, err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	b = &Blob{}
+	err = tx.StmtContext(ctx, h.stmtGetBlob).QueryRowContext(ctx, name).Scan(&b.Name, &b.Hash, &b.Size)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.StmtContext(ctx, h.stmtDeleteBlob).ExecContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b, tx.Commit()
+}
+
+// prepareBlobs prepares the statements of the mapping of the files to their contents
+func (h *Handler) prepareBlobs() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtSetBlob, `INSERT OR REPLACE INTO Blob (name, hash, size) VALUES (?,?,?)`},
+		{&h.stmtGetBlob, `SELECT name, hash, size FROM Blob WHERE name=?`},
+		{&h.stmtGetBlobs, `SELECT name, hash, size FROM Blob WHERE name>? ORDER BY name LIMIT ?`},
+		{&h.stmtCountBlobs, `SELECT COUNT(*) FROM Blob WHERE hash=?`},
+		{&h.stmtDeleteBlob, `DELETE FROM Blob WHERE name=?`},
+		{&h.stmtSetDocFile, `UPDATE Document SET size=?, hash=? WHERE name=? AND file=true`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
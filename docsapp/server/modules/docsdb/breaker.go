@@ -0,0 +1,525 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the defaults of BreakerOptions
+const (
+	DefaultBreakerFailures = 5
+	DefaultBreakerCooldown = 10 * time.Second
+)
+
+// the states of a Breaker
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+var (
+	// ErrUnavailable is returned by a Breaker without querying while it is open
+	ErrUnavailable = errors.New("the database is unavailable")
+	// ErrTimeout is returned by a Breaker for the queries that have not finished in time
+	ErrTimeout = errors.New("the query has timed out")
+)
+
+// BreakerOptions are the limits of a Breaker
+type BreakerOptions struct {
+	// Timeout is the time of a query unless its context has WithQueryTimeout, no limit if it is 0
+	Timeout time.Duration
+	// Failures is the number of the failures in a row opening the breaker, DefaultBreakerFailures if it is 0
+	Failures int
+	// Cooldown is the time the breaker stays open before it lets a query try the database,
+	// DefaultBreakerCooldown if it is 0
+	Cooldown time.Duration
+}
+
+// BreakerStats is the state of a Breaker for monitoring
+type BreakerStats struct {
+	State    string
+	Failures int
+	Trips    int64
+	Timeouts int64
+}
+
+// Breaker times the queries of next out and fails fast with ErrUnavailable once the database
+// has failed Failures times in a row: locked, timed out or gone. After Cooldown one query is let through,
+// the breaker closes if it succeeds and opens again if it fails.
+// EachDocument is not timed out as it runs as long as its reader
+type Breaker struct {
+	ISQL
+	o        BreakerOptions
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+	trips    int64
+	timeouts int64
+}
+
+// Guarded wraps next in a Breaker
+func Guarded(next ISQL, o BreakerOptions) *Breaker {
+	if o.Failures == 0 {
+		o.Failures = DefaultBreakerFailures
+	}
+	if o.Cooldown == 0 {
+		o.Cooldown = DefaultBreakerCooldown
+	}
+	return &Breaker{ISQL: next, o: o, state: BreakerClosed}
+}
+
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout makes the queries of a Breaker with ctx time out after d instead of its Timeout
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+// Stats returns the state of b
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStats{State: b.state, Failures: b.failures, Trips: b.trips, Timeouts: b.timeouts}
+}
+
+// isFailure tells the failures of the database from the answers and the errors of the queries themselves
+func isFailure(err error) bool {
+	if err == nil || err == sql.ErrNoRows || err == ErrFilterTooExpensive || err == ErrTenantNotEmpty {
+		return false
+	}
+	if err == ErrTimeout || err == sql.ErrConnDone || err == driver.ErrBadConn {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "unable to open database") || strings.Contains(msg, "disk I/O error")
+}
+
+// allow lets the query through unless the breaker is open, trial is the query trying the database after Cooldown
+func (b *Breaker) allow() (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.o.Cooldown {
+			return false, ErrUnavailable
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true, nil
+	case BreakerHalfOpen:
+		return false, ErrUnavailable
+	}
+	return false, nil
+}
+
+func (b *Breaker) done(trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+	if err == ErrTimeout {
+		b.timeouts++
+	}
+	if !isFailure(err) {
+		b.failures = 0
+		if trial {
+			b.state = BreakerClosed
+		}
+		return
+	}
+	b.failures++
+	if trial || b.state == BreakerClosed && b.failures >= b.o.Failures {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.trips++
+	}
+}
+
+// run runs the query fn through the breaker, timed out if timeout is set
+func (b *Breaker) run(ctx context.Context, timeout bool, fn func(context.Context) error) (err error) {
+	trial, err := b.allow()
+	if err != nil {
+		return
+	}
+	qctx := ctx
+	d, ok := ctx.Value(queryTimeoutKey{}).(time.Duration)
+	if !ok {
+		d = b.o.Timeout
+	}
+	if timeout && d > 0 {
+		var cancel context.CancelFunc
+		qctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	err = fn(qctx)
+	if err != nil && qctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = ErrTimeout
+	}
+	b.done(trial, err)
+	return
+}
+
+func (b *Breaker) AddActivity(ctx context.Context, a *Activity) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddActivity(ctx, a) })
+}
+
+func (b *Breaker) AddAudit(ctx context.Context, a *Audit) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddAudit(ctx, a) })
+}
+
+func (b *Breaker) AddGroup(ctx context.Context, g *Group) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddGroup(ctx, g) })
+}
+
+func (b *Breaker) AddGroupMember(ctx context.Context, tenant string, group string, login string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddGroupMember(ctx, tenant, group, login) })
+}
+
+func (b *Breaker) AddLink(ctx context.Context, l *Link) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddLink(ctx, l) })
+}
+
+func (b *Breaker) AddRefreshToken(ctx context.Context, token *RefreshToken) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddRefreshToken(ctx, token) })
+}
+
+func (b *Breaker) AddTenant(ctx context.Context, t *Tenant) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddTenant(ctx, t) })
+}
+
+func (b *Breaker) AddUsage(ctx context.Context, login string, u *Usage) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddUsage(ctx, login, u) })
+}
+
+func (b *Breaker) AddUser(ctx context.Context, user *User) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.AddUser(ctx, user) })
+}
+
+func (b *Breaker) ClearRevokedTokens(ctx context.Context, before string) (n int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		n, err = b.ISQL.ClearRevokedTokens(ctx, before)
+		return
+	})
+	return
+}
+
+func (b *Breaker) ClearOutbox(ctx context.Context, before string) (n int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		n, err = b.ISQL.ClearOutbox(ctx, before)
+		return
+	})
+	return
+}
+
+func (b *Breaker) ClearRefreshTokens(ctx context.Context, before string) (n int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		n, err = b.ISQL.ClearRefreshTokens(ctx, before)
+		return
+	})
+	return
+}
+
+func (b *Breaker) CountBlobs(ctx context.Context, hash string) (n int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		n, err = b.ISQL.CountBlobs(ctx, hash)
+		return
+	})
+	return
+}
+
+func (b *Breaker) CreateDocument(ctx context.Context, d *Doc, JSON []byte) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.CreateDocument(ctx, d, JSON) })
+}
+
+func (b *Breaker) DeleteBlob(ctx context.Context, name string) (blob *Blob, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		blob, err = b.ISQL.DeleteBlob(ctx, name)
+		return
+	})
+	return
+}
+
+func (b *Breaker) DeleteDocument(ctx context.Context, id string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteDocument(ctx, id) })
+}
+
+func (b *Breaker) DeleteGroup(ctx context.Context, tenant string, name string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteGroup(ctx, tenant, name) })
+}
+
+func (b *Breaker) DeleteGroupMember(ctx context.Context, tenant string, group string, login string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteGroupMember(ctx, tenant, group, login) })
+}
+
+func (b *Breaker) DeleteLink(ctx context.Context, l *Link) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteLink(ctx, l) })
+}
+
+func (b *Breaker) DeleteMeta(ctx context.Context, id string, key string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteMeta(ctx, id, key) })
+}
+
+func (b *Breaker) DeleteRefreshTokens(ctx context.Context, login string, family string) (n int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		n, err = b.ISQL.DeleteRefreshTokens(ctx, login, family)
+		return
+	})
+	return
+}
+
+func (b *Breaker) DeleteTenant(ctx context.Context, name string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.DeleteTenant(ctx, name) })
+}
+
+func (b *Breaker) DeleteUser(ctx context.Context, login string) (docs []*Doc, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		docs, err = b.ISQL.DeleteUser(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) EachDocument(ctx context.Context, filter *Filter, fn func(*Doc) error) error {
+	return b.run(ctx, false, func(ctx context.Context) error { return b.ISQL.EachDocument(ctx, filter, fn) })
+}
+
+func (b *Breaker) GetActivity(ctx context.Context, id string, after int64, limit int) (activity []*Activity, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		activity, err = b.ISQL.GetActivity(ctx, id, after, limit)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetAudit(ctx context.Context, after int64, limit int) (audit []*Audit, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		audit, err = b.ISQL.GetAudit(ctx, after, limit)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetBlob(ctx context.Context, name string) (blob *Blob, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		blob, err = b.ISQL.GetBlob(ctx, name)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetBlobs(ctx context.Context, after string, limit int) (blobs []*Blob, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		blobs, err = b.ISQL.GetBlobs(ctx, after, limit)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetDeletion(ctx context.Context, login string) (d *Deletion, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		d, err = b.ISQL.GetDeletion(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetDocument(ctx context.Context, id string) (doc *Doc, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		doc, err = b.ISQL.GetDocument(ctx, id)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetDocumentsList(ctx context.Context, filter *Filter) (docs []*Doc, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		docs, err = b.ISQL.GetDocumentsList(ctx, filter)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetDueDeletions(ctx context.Context, before string) (deletions []*Deletion, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		deletions, err = b.ISQL.GetDueDeletions(ctx, before)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetExpiredDocuments(ctx context.Context, before string) (docs []*Doc, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		docs, err = b.ISQL.GetExpiredDocuments(ctx, before)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetGroups(ctx context.Context, tenant string) (groups []*Group, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		groups, err = b.ISQL.GetGroups(ctx, tenant)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetLinks(ctx context.Context, id string) (links []*Link, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		links, err = b.ISQL.GetLinks(ctx, id)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetMeta(ctx context.Context, id string) (meta []*Meta, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		meta, err = b.ISQL.GetMeta(ctx, id)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetOutbox(ctx context.Context, limit int) (entries []*Outbox, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		entries, err = b.ISQL.GetOutbox(ctx, limit)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetPassword(ctx context.Context, login string) (password string, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		password, err = b.ISQL.GetPassword(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetRevokedTokens(ctx context.Context, after string) (ids []string, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		ids, err = b.ISQL.GetRevokedTokens(ctx, after)
+		return
+	})
+	return
+}
+
+func (b *Breaker) SetPassword(ctx context.Context, login string, password string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetPassword(ctx, login, password) })
+}
+
+func (b *Breaker) GetTenants(ctx context.Context) (tenants []*Tenant, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		tenants, err = b.ISQL.GetTenants(ctx)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetTokenGenerations(ctx context.Context) (generations map[string]int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		generations, err = b.ISQL.GetTokenGenerations(ctx)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetUsage(ctx context.Context, login string, period string) (u *Usage, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		u, err = b.ISQL.GetUsage(ctx, login, period)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetUserGroups(ctx context.Context, login string) (groups []string, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		groups, err = b.ISQL.GetUserGroups(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) GetUserTenant(ctx context.Context, login string) (tenant string, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		tenant, err = b.ISQL.GetUserTenant(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) IndexContent(ctx context.Context, id string, content string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.IndexContent(ctx, id, content) })
+}
+
+func (b *Breaker) IsAdmin(ctx context.Context, login string) (admin bool, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		admin, err = b.ISQL.IsAdmin(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) RevokeLogin(ctx context.Context, login string) (generation int64, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		generation, err = b.ISQL.RevokeLogin(ctx, login)
+		return
+	})
+	return
+}
+
+func (b *Breaker) RevokeToken(ctx context.Context, id string, expiresAt string) (revoked bool, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		revoked, err = b.ISQL.RevokeToken(ctx, id, expiresAt)
+		return
+	})
+	return
+}
+
+func (b *Breaker) SearchDocuments(ctx context.Context, filter *Filter, query string, content bool) (hits []*Hit, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		hits, err = b.ISQL.SearchDocuments(ctx, filter, query, content)
+		return
+	})
+	return
+}
+
+func (b *Breaker) SetBlob(ctx context.Context, blob *Blob) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetBlob(ctx, blob) })
+}
+
+func (b *Breaker) SetDeletion(ctx context.Context, d *Deletion) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetDeletion(ctx, d) })
+}
+
+func (b *Breaker) SetExpiry(ctx context.Context, id string, expiresAt string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetExpiry(ctx, id, expiresAt) })
+}
+
+func (b *Breaker) SetMeta(ctx context.Context, id string, m *Meta) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetMeta(ctx, id, m) })
+}
+
+func (b *Breaker) SetOutboxDelivered(ctx context.Context, id int64, at string) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.SetOutboxDelivered(ctx, id, at) })
+}
+
+func (b *Breaker) UpdateDocument(ctx context.Context, d *Doc, JSON []byte) error {
+	return b.run(ctx, true, func(ctx context.Context) error { return b.ISQL.UpdateDocument(ctx, d, JSON) })
+}
+
+func (b *Breaker) UseRefreshToken(ctx context.Context, hash string) (token *RefreshToken, err error) {
+	err = b.run(ctx, true, func(ctx context.Context) (err error) {
+		token, err = b.ISQL.UseRefreshToken(ctx, hash)
+		return
+	})
+	return
+}
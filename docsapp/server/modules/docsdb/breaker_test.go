@@ -0,0 +1,40 @@
+package docsdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingSQL answers GetPassword with err
+type failingSQL struct {
+	ISQL
+	err error
+}
+
+func (f *failingSQL) GetPassword(ctx context.Context, login string) (string, error) {
+	return "", f.err
+}
+
+func TestBreaker(t *testing.T) {
+	db := &failingSQL{err: errors.New("database is locked")}
+	b := Guarded(db, BreakerOptions{Failures: 2, Cooldown: time.Millisecond})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := b.GetPassword(ctx, ""); err != db.err {
+			t.Fatalf("query %d: got %v, want %v", i, err, db.err)
+		}
+	}
+	if _, err := b.GetPassword(ctx, ""); err != ErrUnavailable {
+		t.Fatalf("open breaker: got %v, want %v", err, ErrUnavailable)
+	}
+	time.Sleep(2 * time.Millisecond)
+	db.err = nil
+	if _, err := b.GetPassword(ctx, ""); err != nil {
+		t.Fatalf("trial: %v", err)
+	}
+	if s := b.Stats(); s.State != BreakerClosed || s.Trips != 1 {
+		t.Fatalf("got %+v, want closed after 1 trip", s)
+	}
+}
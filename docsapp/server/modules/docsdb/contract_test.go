@@ -0,0 +1,46 @@
+package docsdb_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/docsdbtest"
+)
+
+// hasDriver tells whether the driver is registered, it is not when sqlite3 is built without cgo
+func hasDriver(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandlerKeepsTheContract(t *testing.T) {
+	if !hasDriver("sqlite3") {
+		t.Skip("the sqlite3 driver is not registered")
+	}
+	docsdbtest.Run(t, func(t *testing.T) docsdb.ISQL {
+		dir, err := ioutil.TempDir("", "docsdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &docsdb.Handler{}
+		err = h.Init("sqlite3", filepath.Join(dir, "contract.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			h.Disconnect()
+			os.RemoveAll(dir)
+		})
+		return h
+	})
+}
@@ -0,0 +1,37 @@
+package docsdb
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by GetDocumentsList for a Filter.After no listing has made
+var ErrInvalidCursor = errors.New("the cursor is not one of a listing")
+
+// cursorWhere narrows a listing to the documents after the cursor of filter.After,
+// the documents created since or deleted do not move the ones of the next pages
+const cursorWhere = ` AND (d.created>? OR (d.created=? AND d.docid>?))`
+
+// MakeCursor is the cursor of the document with docid created at created, the listings are ordered by both
+func MakeCursor(created string, docid int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(created + "/" + strconv.Itoa(docid)))
+}
+
+// ParseCursor is the creation time and the docid of the document a cursor of MakeCursor is of
+func ParseCursor(cursor string) (created string, docid int, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	i := strings.LastIndexByte(string(b), '/')
+	if i < 0 {
+		return "", 0, ErrInvalidCursor
+	}
+	docid, err = strconv.Atoi(string(b[i+1:]))
+	if err != nil || docid <= 0 {
+		return "", 0, ErrInvalidCursor
+	}
+	return string(b[:i]), docid, nil
+}
@@ -0,0 +1,145 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Deletion is the deletion of the account of Login: it waits for Code to be confirmed while Code is set,
+// then the account is deleted at At, a time in the format of Doc.Created. There is none if both are empty
+type Deletion struct {
+	Login string `json:"login" xml:"login"`
+	Code  string `json:"-" xml:"-"`
+	At    string `json:"at,omitempty" xml:"at,omitempty"`
+}
+
+// SetDeletion sets the deletion of the account of d.Login, sql.ErrNoRows if there is no such user
+func (h *Handler) SetDeletion(ctx context.Context, d *Deletion) (err error) {
+	res, err := h.stmtSetDeletion.ExecContext(ctx, d.Code, d.At, d.Login)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// GetDeletion finds the deletion of the account of login, sql.ErrNoRows if there is no such user
+func (h *Handler) GetDeletion(ctx context.Context, login string) (d *Deletion, err error) {
+	var code, at sql.NullString
+	err = h.stmtGetDeletion.QueryRowContext(ctx, login).Scan(&code, &at)
+	if err != nil {
+		return nil, err
+	}
+	return &Deletion{Login: login, Code: code.String, At: at.String}, nil
+}
+
+// GetDueDeletions finds the confirmed deletions due by before, the earliest first.
+// The UserDeleteAt index keeps it from reading the users who are staying
+func (h *Handler) GetDueDeletions(ctx context.Context, before string) (deletions []*Deletion, err error) {
+	rows, err := h.stmtGetDueDeletions.QueryContext(ctx, before)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code sql.NullString
+		d := &Deletion{}
+		err = rows.Scan(&d.Login, &code, &d.At)
+		if err != nil {
+			return
+		}
+		d.Code = code.String
+		deletions = append(deletions, d)
+	}
+	return deletions, rows.Err()
+}
+
+// DeleteUser deletes the user with its grants, its group memberships and its usage,
+// and the documents granted to nobody else, which it answers without their grants for their files to be removed.
+// sql.ErrNoRows if there is no such user
+func (h *Handler) DeleteUser(ctx context.Context, login string) (docs []*Doc, err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var uid int64
+	err = tx.Stmt(h.stmtGetUID).QueryRowContext(ctx, login).Scan(&uid)
+	if err != nil {
+		return
+	}
+	rows, err := tx.Stmt(h.stmtGetSoleDocs).QueryContext(ctx, uid, uid)
+	if err != nil {
+		return
+	}
+	var docIDs []int
+	for rows.Next() {
+		var docID int
+		d := &Doc{}
+		err = rows.Scan(&docID, &d.ID, &d.Name, &d.Mime, &d.File, &d.Visibility, &d.Created, &d.ExpiresAt, &d.Tenant)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.ResolveVisibility()
+		docIDs = append(docIDs, docID)
+		docs = append(docs, d)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	for _, docID := range docIDs {
+		err = h.deleteDocID(ctx, tx, docID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, stmt := range []*sql.Stmt{h.stmtDeleteGrantUID, h.stmtDeleteGroupMemberUID, h.stmtDeleteUsageUID, h.stmtDeleteUser} {
+		_, err = tx.Stmt(stmt).ExecContext(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// prepareDeletion prepares the statements of the deletion of the accounts
+func (h *Handler) prepareDeletion() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtSetDeletion, `UPDATE User SET delete_code=?, delete_at=? WHERE login=?`},
+		{&h.stmtGetDeletion, `SELECT delete_code, delete_at FROM User WHERE login=?`},
+		{&h.stmtGetDueDeletions, `SELECT login, delete_code, delete_at FROM User WHERE delete_at<>'' AND delete_at<=? ORDER BY delete_at`},
+		{&h.stmtGetUID, `SELECT uid FROM User WHERE login=?`},
+		{&h.stmtGetSoleDocs, `
+		SELECT d.docid, d.id, d.name, d.mime, d.file, d.visibility, d.created, d.expires_at, t.name
+		FROM Grant as g INNER JOIN Document as d USING(docid) INNER JOIN Tenant as t ON(d.tid=t.tid)
+		WHERE g.uid=? AND NOT EXISTS (SELECT 1 FROM Grant WHERE docid=g.docid AND uid<>?)
+		AND NOT EXISTS (SELECT 1 FROM GroupGrant WHERE docid=g.docid)
+		ORDER BY d.id`},
+		{&h.stmtDeleteGrantUID, `DELETE FROM Grant WHERE uid=?`},
+		{&h.stmtDeleteGroupMemberUID, `DELETE FROM GroupMember WHERE uid=?`},
+		{&h.stmtDeleteUsageUID, `DELETE FROM Usage WHERE uid=?`},
+		{&h.stmtDeleteUser, `DELETE FROM User WHERE uid=?`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -1,106 +1,355 @@
 package docsdb
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// the defaults of a Handler
+const (
+	// DefaultMaxScanRows is the MaxScanRows of a Handler without one
+	DefaultMaxScanRows = 10000
+	// DefaultJournalMode lets the readers go on while a writer writes
+	DefaultJournalMode = "WAL"
+	// DefaultBusyTimeout is the time a connection waits for the lock of another one before SQLITE_BUSY
+	DefaultBusyTimeout = 5 * time.Second
+)
+
+// ErrFilterTooExpensive is returned by GetDocumentsList for the filters on unindexed columns
+// when Document has more than MaxScanRows rows
+var ErrFilterTooExpensive = errors.New("the filter needs a scan of too many documents")
+
+// the visibilities of the documents: the private ones are of the granted users only,
+// the unlisted ones are read by the tenant knowing their id and the public ones are listed too
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+// the values of Filter.Shared: the documents of the login granted to others, to groups or seen by the tenant,
+// and the documents of the others granted to the login or to its groups
+const (
+	SharedByMe   = "by-me"
+	SharedWithMe = "with-me"
+)
+
+// expiryWhere leaves out the documents expired by Filter.Now, "" is before every time
+const expiryWhere = ` AND (d.expires_at='' OR d.expires_at>?)`
+
+// unindexedColumns are the filter columns GetDocumentsList has to scan Document for
+var unindexedColumns = map[string]bool{"mime": true, "file": true, "json": true, "size": true, "version": true}
+
 // Doc is the model of the database table Document
-// (exception Grant which the database table Grant is responsible for)
+// (exception Grant and Groups which the database tables Grant and GroupGrant are responsible for).
+// The grants are of the users and the groups of the tenant of the document only
 type Doc struct {
-	ID      string   `json:"id"`
-	Name    string   `json:"name"`
-	Mime    string   `json:"mime"`
-	File    bool     `json:"file,boolean"`
-	Public  bool     `json:"public,boolean"`
-	Created string   `json:"created"`
-	Grant   []string `json:"grant"`
-	JSON    []byte   `json:"json,omitempty"`
+	ID      string   `json:"id" xml:"id"`
+	Name    string   `json:"name" xml:"name"`
+	Mime    string   `json:"mime" xml:"mime"`
+	File    bool     `json:"file,boolean" xml:"file"`
+	Public  bool     `json:"public,boolean" xml:"public"`
+	Created string   `json:"created" xml:"created"`
+	Grant   []string `json:"grant" xml:"grant"`
+	JSON    []byte   `json:"json,omitempty" xml:"json,omitempty"`
+	Tenant  string   `json:"tenant,omitempty" xml:"tenant,omitempty"`
+	// Visibility is one of the Visibility constants, Public is whether it is VisibilityPublic
+	Visibility string `json:"visibility,omitempty" xml:"visibility,omitempty"`
+	// Groups are the groups the document is granted to, their members have it as the users of Grant do
+	Groups []string `json:"groups,omitempty" xml:"group,omitempty"`
+	// ExpiresAt is the time in the format of Created the document is gone at, it never is if ExpiresAt is empty
+	ExpiresAt string `json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+	// Owner is the login which has made the document, it is set at the creation only
+	Owner string `json:"owner,omitempty" xml:"owner,omitempty"`
+	// Size and Hash are the bytes and the hex sha256 of the file the store has in Blob, 0 and "" without one
+	Size int64  `json:"size" xml:"size"`
+	Hash string `json:"hash,omitempty" xml:"hash,omitempty"`
+	// Version is 1 at the creation and one more at every update, the store counts it
+	Version int `json:"version" xml:"version"`
+	// PreviewURL is not stored, the server sets it in the listings
+	PreviewURL string `json:"preview_url,omitempty" xml:"preview_url,omitempty"`
+	// Cursor is not stored, the listings set it for Filter.After to go on after the document
+	Cursor string `json:"-" xml:"-"`
+}
+
+// ValidVisibility reports whether v is a visibility, "" is taken from Public
+func ValidVisibility(v string) bool {
+	switch v {
+	case "", VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// ResolveVisibility sets Visibility from Public if it is not set, then Public from Visibility
+func (d *Doc) ResolveVisibility() {
+	if d.Visibility == "" {
+		d.Visibility = VisibilityPrivate
+		if d.Public {
+			d.Visibility = VisibilityPublic
+		}
+	}
+	d.Public = d.Visibility == VisibilityPublic
 }
 
 // User is the model of the databse table User
 type User struct {
-	Login       string `json:"login"`
+	Login string `json:"login"`
+	// Password is the bcrypt hash of the password, the users added before the hashing have the password itself
+	// until they sign in
 	Password    string `json:"password"`
 	Token       string `json:"token"`
 	AdminRights bool   `json:"admin,boolean"`
+	Tenant      string `json:"tenant"`
 }
 
-// Filter is the parameters for building queries
+// Filter is the parameters for building queries,
+// the public documents are the ones of the tenant of Login.
+// With Tenant the public documents of the tenant are found only, Login is not used
 type Filter struct {
+	Tenant string `json:"tenant"`
 	Login  string `json:"login"`
 	Column string `json:"column"`
 	Value  string `json:"value"`
 	Limit  int    `json:"limit"`
+	// Meta are the values the custom keys of the documents must have
+	Meta map[string]string `json:"meta"`
+	// Now is the time in the format of Doc.Created the documents expired by are left out at, none are if it is empty
+	Now string `json:"now"`
+	// Shared narrows the documents of Login to the ones it has shared, SharedByMe, or the ones shared with it, SharedWithMe
+	Shared string `json:"shared"`
+	// After is the Cursor of the last document of the previous page, the listing goes on after it
+	After string `json:"after"`
 }
 
 // ISQL is the interface of sql database primarily for flexibility and mocking
 type ISQL interface {
-	AddUser(*User) error
-	ClearToken(string) error
+	AddActivity(context.Context, *Activity) error
+	AddAudit(context.Context, *Audit) error
+	AddGroup(context.Context, *Group) error
+	AddGroupMember(context.Context, string, string, string) error
+	AddLink(context.Context, *Link) error
+	AddRefreshToken(context.Context, *RefreshToken) error
+	AddTenant(context.Context, *Tenant) error
+	AddUsage(context.Context, string, *Usage) error
+	AddUser(context.Context, *User) error
+	ClearOutbox(context.Context, string) (int64, error)
+	ClearRefreshTokens(context.Context, string) (int64, error)
+	ClearRevokedTokens(context.Context, string) (int64, error)
 	Connect() error
-	CreateDocument(*Doc, []byte) error
-	DeleteDocument(string) error
+	CountBlobs(context.Context, string) (int64, error)
+	CreateDocument(context.Context, *Doc, []byte) error
+	DeleteBlob(context.Context, string) (*Blob, error)
+	DeleteDocument(context.Context, string) error
+	DeleteGroup(context.Context, string, string) error
+	DeleteGroupMember(context.Context, string, string, string) error
+	DeleteLink(context.Context, *Link) error
+	DeleteMeta(context.Context, string, string) error
+	DeleteRefreshTokens(context.Context, string, string) (int64, error)
+	DeleteTenant(context.Context, string) error
+	DeleteUser(context.Context, string) ([]*Doc, error)
+	EachDocument(context.Context, *Filter, func(*Doc) error) error
 	Disconnect()
-	GetDocument(string) (*Doc, error)
-	GetDocumentsList(*Filter) ([]*Doc, error)
-	GetLogin(string) (string, error)
-	GetPassword(string) (string, error)
+	GetActivity(context.Context, string, int64, int) ([]*Activity, error)
+	GetAudit(context.Context, int64, int) ([]*Audit, error)
+	GetBlob(context.Context, string) (*Blob, error)
+	GetBlobs(context.Context, string, int) ([]*Blob, error)
+	GetDeletion(context.Context, string) (*Deletion, error)
+	GetDocument(context.Context, string) (*Doc, error)
+	GetDocumentsList(context.Context, *Filter) ([]*Doc, error)
+	GetDueDeletions(context.Context, string) ([]*Deletion, error)
+	GetExpiredDocuments(context.Context, string) ([]*Doc, error)
+	GetGroups(context.Context, string) ([]*Group, error)
+	GetLinks(context.Context, string) ([]*Link, error)
+	GetMeta(context.Context, string) ([]*Meta, error)
+	GetOutbox(context.Context, int) ([]*Outbox, error)
+	GetPassword(context.Context, string) (string, error)
+	GetRevokedTokens(context.Context, string) ([]string, error)
+	GetTenants(context.Context) ([]*Tenant, error)
+	GetTokenGenerations(context.Context) (map[string]int64, error)
+	GetUsage(context.Context, string, string) (*Usage, error)
+	GetUserGroups(context.Context, string) ([]string, error)
+	GetUserTenant(context.Context, string) (string, error)
+	IndexContent(context.Context, string, string) error
 	Init(string, string) error
-	IsAdmin(string) (bool, error)
-	UpdateDocument(*Doc, []byte) error
-	UpdateToken(string, string) error
+	IsAdmin(context.Context, string) (bool, error)
+	RevokeLogin(context.Context, string) (int64, error)
+	RevokeToken(context.Context, string, string) (bool, error)
+	SearchDocuments(context.Context, *Filter, string, bool) ([]*Hit, error)
+	SetBlob(context.Context, *Blob) error
+	SetDeletion(context.Context, *Deletion) error
+	SetExpiry(context.Context, string, string) error
+	SetMeta(context.Context, string, *Meta) error
+	SetOutboxDelivered(context.Context, int64, string) error
+	SetPassword(context.Context, string, string) error
+	UpdateDocument(context.Context, *Doc, []byte) error
+	UseRefreshToken(context.Context, string) (*RefreshToken, error)
 }
 
 // Handler is sql database tool to work with sqlDriver
 type Handler struct {
-	db                       *sql.DB
-	path                     string
-	driver                   string
-	stmtClearToken           *sql.Stmt
-	stmtDeleteDoc            *sql.Stmt
-	stmtDeleteGrantDocID     *sql.Stmt
-	stmtGetAdmin             *sql.Stmt
-	stmtGetDoc               *sql.Stmt
-	stmtGetDocsDefaultFilter *sql.Stmt
-	stmtGetDocID             *sql.Stmt
-	stmtGetLogin             *sql.Stmt
-	stmtGetPassword          *sql.Stmt
-	stmtGetUserLogin         *sql.Stmt
-	stmtGetUserUID           *sql.Stmt
-	stmtInsDoc               *sql.Stmt
-	stmtInsGrant             *sql.Stmt
-	stmtInsUser              *sql.Stmt
-	stmtUpdateDoc            *sql.Stmt
-	stmtUpdateToken          *sql.Stmt
+	// MaxScanRows is the number of documents over which the filters on unindexed columns are rejected,
+	// DefaultMaxScanRows if it is 0
+	MaxScanRows int
+	// JournalMode, BusyTimeout and ForeignKeys are the pragmas of every connection,
+	// DefaultJournalMode and DefaultBusyTimeout if they are not set
+	JournalMode string
+	BusyTimeout time.Duration
+	ForeignKeys bool
+	// MaxOpenConns limits the connections of the pool, no limit if it is 0
+	MaxOpenConns int
+	// ReadOnly is of the read replicas: Init doesn't migrate them and their connections refuse to write
+	ReadOnly                  bool
+	db                        *sql.DB
+	path                      string
+	driver                    string
+	stmtAddUsage              *sql.Stmt
+	stmtCountDocs             *sql.Stmt
+	stmtCountTenant           *sql.Stmt
+	stmtDeleteDoc             *sql.Stmt
+	stmtDeleteGrantDocID      *sql.Stmt
+	stmtDeleteGroup           *sql.Stmt
+	stmtDeleteGroupGrantDocID *sql.Stmt
+	stmtDeleteGroupGrantsGID  *sql.Stmt
+	stmtDeleteGroupMember     *sql.Stmt
+	stmtDeleteGroupMembersGID *sql.Stmt
+	stmtDeleteLink            *sql.Stmt
+	stmtDeleteLinksDocID      *sql.Stmt
+	stmtDeleteMeta            *sql.Stmt
+	stmtDeleteMetaDocID       *sql.Stmt
+	stmtDeleteTenant          *sql.Stmt
+	stmtDeleteTenantGroups    *sql.Stmt
+	stmtGetAdmin              *sql.Stmt
+	stmtGetDoc                *sql.Stmt
+	stmtGetDocsDefaultFilter  *sql.Stmt
+	stmtGetDocID              *sql.Stmt
+	stmtGetGroupGrant         *sql.Stmt
+	stmtGetGroupID            *sql.Stmt
+	stmtGetGroupMembers       *sql.Stmt
+	stmtGetGroups             *sql.Stmt
+	stmtGetLinks              *sql.Stmt
+	stmtGetLogin              *sql.Stmt
+	stmtGetMeta               *sql.Stmt
+	stmtGetPassword           *sql.Stmt
+	stmtSetPassword           *sql.Stmt
+	stmtGetTenants            *sql.Stmt
+	stmtGetUsage              *sql.Stmt
+	stmtSetExpiry             *sql.Stmt
+	stmtDeleteContentDocID    *sql.Stmt
+	stmtInsContent            *sql.Stmt
+	stmtInsActivity           *sql.Stmt
+	stmtGetActivity           *sql.Stmt
+	stmtDeleteActivityDocID   *sql.Stmt
+	stmtGetExpired            *sql.Stmt
+	stmtInsAudit              *sql.Stmt
+	stmtGetAudit              *sql.Stmt
+	stmtSetDeletion           *sql.Stmt
+	stmtGetDeletion           *sql.Stmt
+	stmtGetDueDeletions       *sql.Stmt
+	stmtGetUID                *sql.Stmt
+	stmtGetSoleDocs           *sql.Stmt
+	stmtDeleteGrantUID        *sql.Stmt
+	stmtDeleteGroupMemberUID  *sql.Stmt
+	stmtDeleteUsageUID        *sql.Stmt
+	stmtDeleteUser            *sql.Stmt
+	stmtSetBlob               *sql.Stmt
+	stmtSetDocFile            *sql.Stmt
+	stmtGetBlob               *sql.Stmt
+	stmtGetBlobs              *sql.Stmt
+	stmtCountBlobs            *sql.Stmt
+	stmtDeleteBlob            *sql.Stmt
+	stmtRevokeToken           *sql.Stmt
+	stmtGetRevokedTokens      *sql.Stmt
+	stmtClearRevokedTokens    *sql.Stmt
+	stmtInsTokenGeneration    *sql.Stmt
+	stmtIncTokenGeneration    *sql.Stmt
+	stmtGetTokenGeneration    *sql.Stmt
+	stmtGetTokenGenerations   *sql.Stmt
+	stmtAddRefreshToken       *sql.Stmt
+	stmtGetRefreshToken       *sql.Stmt
+	stmtUseRefreshToken       *sql.Stmt
+	stmtDeleteRefreshTokens   *sql.Stmt
+	stmtClearRefreshTokens    *sql.Stmt
+	stmtInsOutbox             *sql.Stmt
+	stmtGetOutbox             *sql.Stmt
+	stmtSetOutboxDelivered    *sql.Stmt
+	stmtClearOutbox           *sql.Stmt
+	stmtGetUserGroups         *sql.Stmt
+	stmtGetUserTenant         *sql.Stmt
+	stmtGetUserUID            *sql.Stmt
+	stmtInsDoc                *sql.Stmt
+	stmtInsGrant              *sql.Stmt
+	stmtInsGroup              *sql.Stmt
+	stmtInsGroupGrant         *sql.Stmt
+	stmtInsGroupMember        *sql.Stmt
+	stmtInsLink               *sql.Stmt
+	stmtInsTenant             *sql.Stmt
+	stmtInsUser               *sql.Stmt
+	stmtSetMeta               *sql.Stmt
+	stmtUpdateDoc             *sql.Stmt
 }
 
-// AddUser inserts into User login, password and admin
-func (h *Handler) AddUser(user *User) (err error) {
-	_, err = h.stmtInsUser.Exec(user.Login, user.Password, user.AdminRights)
-	return
-}
-
-// ClearToken updates user to set token as "" (empty string)
-func (h *Handler) ClearToken(token string) (err error) {
-	_, err = h.stmtClearToken.Exec(token)
+// AddUser inserts into User login, password, admin and the tenant, which is to exist
+func (h *Handler) AddUser(ctx context.Context, user *User) (err error) {
+	_, err = h.stmtInsUser.ExecContext(ctx, user.Login, user.Password, user.AdminRights, tenantOf(user.Tenant))
 	return
 }
 
 // Connect creates connection to the database
 func (h *Handler) Connect() (err error) {
-	h.db, err = sql.Open(h.driver, h.path)
+	h.db, err = sql.Open(h.driver, h.dsn())
+	if err != nil {
+		return
+	}
+	h.db.SetMaxOpenConns(h.MaxOpenConns)
 	return
 }
 
+// dsn is the path with the pragmas of the connections in the parameters of go-sqlite3
+func (h *Handler) dsn() string {
+	journalMode := h.JournalMode
+	if journalMode == "" {
+		journalMode = DefaultJournalMode
+	}
+	busyTimeout := h.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+	q := url.Values{}
+	q.Set("_journal_mode", journalMode)
+	q.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	if h.ForeignKeys {
+		q.Set("_foreign_keys", "1")
+	}
+	if h.ReadOnly {
+		q.Set("_query_only", "1")
+	}
+	sep := "?"
+	if strings.Contains(h.path, "?") {
+		sep = "&"
+	}
+	return h.path + sep + q.Encode()
+}
+
 // CreateDocument inserts into Document and Grant values,
-// then finds user uid by login and fill the Grant table
-func (h *Handler) CreateDocument(d *Doc, JSON []byte) (err error) {
-	tx, err := h.db.Begin()
+// then finds user uid by login among the users of the tenant of the document and fill the Grant table
+func (h *Handler) CreateDocument(ctx context.Context, d *Doc, JSON []byte) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
 	defer tx.Rollback()
-	res, err := tx.Stmt(h.stmtInsDoc).Exec(d.ID, d.Name, d.Mime, d.File, d.Public, d.Created, d.JSON)
+	d.ResolveVisibility()
+	size, hash, err := h.fileOf(ctx, tx, d)
+	if err != nil {
+		return
+	}
+	res, err := tx.Stmt(h.stmtInsDoc).ExecContext(ctx, d.ID, d.Name, d.Mime, d.File, d.Public, d.Visibility, d.Created, d.JSON, d.ExpiresAt, d.Owner, size, hash, tenantOf(d.Tenant))
 	if err != nil {
 		return
 	}
@@ -109,7 +358,7 @@ func (h *Handler) CreateDocument(d *Doc, JSON []byte) (err error) {
 		return
 	}
 	for _, v := range d.Grant {
-		uidRow := tx.Stmt(h.stmtGetUserUID).QueryRow(v)
+		uidRow := tx.Stmt(h.stmtGetUserUID).QueryRowContext(ctx, v, tenantOf(d.Tenant))
 		var uid int
 		for i := 0; i < 5; i++ {
 			err = uidRow.Scan(&uid)
@@ -124,23 +373,33 @@ func (h *Handler) CreateDocument(d *Doc, JSON []byte) (err error) {
 			}
 			break
 		}
-		_, err = tx.Stmt(h.stmtInsGrant).Exec(docID, uid)
+		_, err = tx.Stmt(h.stmtInsGrant).ExecContext(ctx, docID, uid)
 		if err != nil {
 			return
 		}
 	}
-	tx.Commit()
-	return
+	err = h.grantGroups(ctx, tx, docID, d.Tenant, d.Groups)
+	if err != nil {
+		return
+	}
+	stored := *d
+	stored.Tenant, stored.Size, stored.Hash, stored.Version = tenantOf(d.Tenant), size, hash, 1
+	err = h.addOutbox(ctx, tx, &stored)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
 }
 
-// DeleteDocument finds docid by id, deletes documents from Grant and then from Document
-func (h *Handler) DeleteDocument(id string) (err error) {
-	tx, err := h.db.Begin()
+// DeleteDocument finds docid by id, deletes documents from Grant, GroupGrant, DocMeta, DocLink, DocContent
+// and DocActivity and then from Document
+func (h *Handler) DeleteDocument(ctx context.Context, id string) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
 	defer tx.Rollback()
-	row := tx.Stmt(h.stmtGetDocID).QueryRow(id)
+	row := tx.Stmt(h.stmtGetDocID).QueryRowContext(ctx, id)
 	var docID int
 	for i := 0; i < 5; i++ {
 		err = row.Scan(&docID)
@@ -155,15 +414,41 @@ func (h *Handler) DeleteDocument(id string) (err error) {
 		}
 		break
 	}
-	_, err = tx.Stmt(h.stmtDeleteGrantDocID).Exec(docID)
+	err = h.deleteDocID(ctx, tx, docID)
 	if err != nil {
 		return
 	}
-	_, err = tx.Stmt(h.stmtDeleteDoc).Exec(docID)
+	tx.Commit()
+	return
+}
+
+// deleteDocID deletes the document with docID in tx with its grants, keys, links, content and activity
+func (h *Handler) deleteDocID(ctx context.Context, tx *sql.Tx, docID int) (err error) {
+	_, err = tx.Stmt(h.stmtDeleteGrantDocID).ExecContext(ctx, docID)
 	if err != nil {
 		return
 	}
-	tx.Commit()
+	_, err = tx.Stmt(h.stmtDeleteGroupGrantDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteMetaDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteLinksDocID).ExecContext(ctx, docID, docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteContentDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteActivityDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteDoc).ExecContext(ctx, docID)
 	return
 }
 
@@ -172,13 +457,14 @@ func (h *Handler) Disconnect() {
 	h.db.Close()
 }
 
-//GetDocument finds document by id and then finds all the granted logins by joining Document, Grant, User
-func (h *Handler) GetDocument(id string) (doc *Doc, err error) {
+// GetDocument finds document by id and then finds all the granted logins by joining Document, Grant, User
+// and the granted groups
+func (h *Handler) GetDocument(ctx context.Context, id string) (doc *Doc, err error) {
 	var docID int
 	d := &Doc{}
-	row := h.stmtGetDoc.QueryRow(id)
+	row := h.stmtGetDoc.QueryRowContext(ctx, id)
 	for i := 0; i < 5; i++ {
-		err = row.Scan(&docID, &d.Name, &d.Mime, &d.File, &d.Public, &d.Created, &d.JSON)
+		err = row.Scan(&docID, &d.Name, &d.Mime, &d.File, &d.Public, &d.Visibility, &d.Created, &d.JSON, &d.Tenant, &d.ExpiresAt, &d.Owner, &d.Size, &d.Hash, &d.Version)
 		if err != nil {
 			if err == sql.ErrConnDone {
 				err = h.Connect()
@@ -190,7 +476,7 @@ func (h *Handler) GetDocument(id string) (doc *Doc, err error) {
 		}
 		break
 	}
-	rows, err := h.stmtGetLogin.Query(docID)
+	rows, err := h.stmtGetLogin.QueryContext(ctx, docID)
 	if err != nil {
 		return
 	}
@@ -213,104 +499,187 @@ func (h *Handler) GetDocument(id string) (doc *Doc, err error) {
 		grant = append(grant, s)
 	}
 	d.Grant = grant
+	d.Groups, err = h.column(ctx, h.stmtGetGroupGrant, docID)
+	if err != nil {
+		return
+	}
 	doc = d
 	return
 }
 
-// GetDocumentsList finds all documents that filter.Login has access to depending on filter parameters
-func (h *Handler) GetDocumentsList(filter *Filter) (doc []*Doc, err error) {
+// GetDocumentsList finds all documents that filter.Login has access to depending on filter parameters.
+//
+// The grants of the user are found by the GrantUID index and the public documents by DocumentPublic,
+// so without a filter or with a filter on id, name, public, created, owner or hash a listing costs
+// O((g + p) log n) for g granted and p public documents of n, plus the sort of their union.
+// The filters on mime, file, json, size and version compare every candidate row, they are rejected
+// with ErrFilterTooExpensive once Document has more than MaxScanRows rows.
+// Every key of filter.Meta adds a lookup of the DocMetaKey index.
+// The documents are ordered by created then docid, a page goes on after the Cursor of filter.After
+// and so skips or repeats none of them while documents are created or deleted between the pages
+func (h *Handler) GetDocumentsList(ctx context.Context, filter *Filter) (doc []*Doc, err error) {
+	err = h.EachDocument(ctx, filter, func(d *Doc) error {
+		doc = append(doc, d)
+		return nil
+	})
+	return
+}
+
+// EachDocument passes the documents GetDocumentsList finds to fn one by one as they are read,
+// it stops at the first error of fn and returns it. A negative filter.Limit is no limit.
+// The public documents of filter.Tenant are passed without their grants, they are nobody's business
+func (h *Handler) EachDocument(ctx context.Context, filter *Filter, fn func(*Doc) error) (err error) {
 	var rows *sql.Rows
-	if filter.Column == "" || filter.Value == "" {
-		rows, err = h.stmtGetDocsDefaultFilter.Query(filter.Login, filter.Limit)
+	if filter.Column != "" && filter.Value != "" && unindexedColumns[strings.ToLower(filter.Column)] {
+		err = h.checkScan(ctx)
 		if err != nil {
 			return
 		}
-	} else {
-		rows, err = h.db.Query(`SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.created, d.json 
-		FROM Document as d INNER JOIN Grant as g ON(d.docID=g.docID) INNER JOIN User as u ON(g.uid=u.uid)
-		WHERE u.login=? AND `+filter.Column+`=?
-		UNION
-		SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.created, d.json
-		FROM Document as d
-		WHERE d.public=true AND `+filter.Column+`=?
-		ORDER BY d.name, d.created
-		LIMIT ?`, filter.Login, filter.Value, filter.Value, filter.Limit)
+	}
+	where, args := filterWhere(filter)
+	if filter.After != "" {
+		var created string
+		var docid int
+		created, docid, err = ParseCursor(filter.After)
 		if err != nil {
 			return
 		}
+		where += cursorWhere
+		args = append(args, created, created, docid)
+	}
+	filtered := where != ""
+	where = expiryWhere + where
+	args = append([]interface{}{filter.Now}, args...)
+	switch {
+	case filter.Tenant != "":
+		params := append(append([]interface{}{filter.Tenant}, args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d
+		WHERE d.public=true AND d.tid=(SELECT tid FROM Tenant WHERE name=?)`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, params...)
+	case filter.Shared == SharedWithMe:
+		params := append([]interface{}{filter.Login, filter.Login}, args...)
+		params = append(append(append(params, filter.Login, filter.Login), args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d INNER JOIN Grant as g ON(d.docid=g.docid) INNER JOIN User as u ON(g.uid=u.uid)
+		WHERE u.login=? AND d.owner<>?`+where+`
+		UNION
+		SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d INNER JOIN GroupGrant as gg ON(d.docid=gg.docid) INNER JOIN GroupMember as m ON(gg.gid=m.gid) INNER JOIN User as u ON(m.uid=u.uid)
+		WHERE u.login=? AND d.owner<>?`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, params...)
+	case filter.Shared == SharedByMe:
+		params := append(append([]interface{}{filter.Login, filter.Login, filter.Login}, args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d INNER JOIN Grant as g ON(d.docid=g.docid) INNER JOIN User as u ON(g.uid=u.uid)
+		WHERE u.login=? AND d.owner=? AND (d.visibility<>'`+VisibilityPrivate+`'
+			OR EXISTS (SELECT 1 FROM GroupGrant as gg WHERE gg.docid=d.docid)
+			OR EXISTS (SELECT 1 FROM Grant as o INNER JOIN User as ou ON(o.uid=ou.uid) WHERE o.docid=d.docid AND ou.login<>?))`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, params...)
+	case !filtered:
+		rows, err = h.stmtGetDocsDefaultFilter.QueryContext(ctx, filter.Login, filter.Now, filter.Login, filter.Now, filter.Login, filter.Now, filter.Limit)
+	default:
+		params := append([]interface{}{filter.Login}, args...)
+		params = append(append(params, filter.Login), args...)
+		params = append(append(append(params, filter.Login), args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d INNER JOIN Grant as g ON(d.docID=g.docID) INNER JOIN User as u ON(g.uid=u.uid)
+		WHERE u.login=?`+where+`
+		UNION
+		SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d INNER JOIN GroupGrant as gg ON(d.docid=gg.docid) INNER JOIN GroupMember as m ON(gg.gid=m.gid) INNER JOIN User as u ON(m.uid=u.uid)
+		WHERE u.login=?`+where+`
+		UNION
+		SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+		FROM Document as d
+		WHERE d.public=true AND d.tid=(SELECT tid FROM User WHERE login=?)`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, params...)
+	}
+	if err != nil {
+		return
 	}
-	var gRows *sql.Rows
-	var docid int
-	i := 0
-	var d []*Doc
 	defer rows.Close()
+	var docid int
 	for rows.Next() {
-		d = append(d, &Doc{})
-		for i := 0; i < 5; i++ {
-			err = rows.Scan(&docid, &d[i].ID, &d[i].Name, &d[i].Mime, &d[i].File, &d[i].Public, &d[i].Created, &d[i].JSON)
+		d := &Doc{}
+		err = rows.Scan(&docid, &d.ID, &d.Name, &d.Mime, &d.File, &d.Public, &d.Visibility, &d.Created, &d.JSON, &d.ExpiresAt, &d.Owner, &d.Size, &d.Hash, &d.Version)
+		if err != nil {
+			return
+		}
+		d.Cursor = MakeCursor(d.Created, docid)
+		if filter.Tenant == "" {
+			d.Grant, err = h.getGrant(ctx, docid)
+			if err != nil {
+				return
+			}
+			d.Groups, err = h.column(ctx, h.stmtGetGroupGrant, docid)
 			if err != nil {
-				if err == sql.ErrConnDone {
-					err = h.Connect()
-					if err != nil {
-						return
-					}
-				}
 				return
 			}
-			break
 		}
-		gRows, err = h.stmtGetLogin.Query(docid)
+		err = fn(d)
 		if err != nil {
 			return
 		}
-		for gRows.Next() {
-			var login string
-			for i := 0; i < 5; i++ {
-				err = gRows.Scan(&login)
-				if err != nil {
-					if err == sql.ErrConnDone {
-						err = h.Connect()
-						if err != nil {
-							return
-						}
-					}
-					return
-				}
-				break
-			}
-			d[i].Grant = append(d[i].Grant, login)
-		}
-		i++
-		gRows.Close()
 	}
-	doc = d
+	return rows.Err()
+}
+
+// filterWhere is the condition of the column and the custom keys of filter on Document as d with its arguments
+func filterWhere(filter *Filter) (where string, args []interface{}) {
+	where, args = metaWhere(filter)
+	if filter.Column != "" && filter.Value != "" {
+		where = ` AND ` + filter.Column + `=?` + where
+		args = append([]interface{}{filter.Value}, args...)
+	}
 	return
 }
 
-// GetLogin finds login by token
-func (h *Handler) GetLogin(token string) (login string, err error) {
-	row := h.stmtGetUserLogin.QueryRow(token)
-	for i := 0; i < 5; i++ {
-		err = row.Scan(&login)
+// getGrant finds the logins granted the document with docid
+func (h *Handler) getGrant(ctx context.Context, docid int) (grant []string, err error) {
+	rows, err := h.stmtGetLogin.QueryContext(ctx, docid)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var login string
+		err = rows.Scan(&login)
 		if err != nil {
-			if err == sql.ErrConnDone {
-				err = h.Connect()
-				if err != nil {
-					return
-				}
-			}
 			return
 		}
-		break
+		grant = append(grant, login)
+	}
+	return grant, rows.Err()
+}
+
+// checkScan fails with ErrFilterTooExpensive if Document has more than MaxScanRows rows
+func (h *Handler) checkScan(ctx context.Context) (err error) {
+	limit := h.MaxScanRows
+	if limit == 0 {
+		limit = DefaultMaxScanRows
+	}
+	var n int
+	err = h.stmtCountDocs.QueryRowContext(ctx).Scan(&n)
+	if err != nil {
+		return
+	}
+	if n > limit {
+		return ErrFilterTooExpensive
 	}
 	return
 }
 
-// GetPassword finds password by login
-func (h *Handler) GetPassword(login string) (password string, err error) {
-	row := h.stmtGetPassword.QueryRow(login)
+// GetPassword finds password by login, "" if the user has none
+func (h *Handler) GetPassword(ctx context.Context, login string) (password string, err error) {
+	row := h.stmtGetPassword.QueryRowContext(ctx, login)
+	var p sql.NullString
 	for i := 0; i < 5; i++ {
-		err = row.Scan(&password)
+		err = row.Scan(&p)
 		if err != nil {
 			if err == sql.ErrConnDone {
 				err = h.Connect()
@@ -322,30 +691,44 @@ func (h *Handler) GetPassword(login string) (password string, err error) {
 		}
 		break
 	}
-	return
+	return p.String, nil
 }
 
-// Init creates connection to the database and prepares the statements
-func (h *Handler) Init(driver string, path string) (err error) {
-	h.driver = driver
-	h.path = path
-	err = h.Connect()
+// SetPassword sets the password of login, the hash of it. sql.ErrNoRows if there is no such user
+func (h *Handler) SetPassword(ctx context.Context, login string, password string) (err error) {
+	res, err := h.stmtSetPassword.ExecContext(ctx, password, login)
 	if err != nil {
 		return
 	}
-	h.stmtInsUser, err = h.db.Prepare(`INSERT INTO User (login, password, admin) VALUES (?, ?, ?)`)
+	n, err := res.RowsAffected()
 	if err != nil {
 		return
 	}
-	h.stmtUpdateToken, err = h.db.Prepare(`UPDATE User SET token=? WHERE login=?`)
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// Init creates connection to the database, migrates it unless it is ReadOnly and prepares the statements
+func (h *Handler) Init(driver string, path string) (err error) {
+	h.driver = driver
+	h.path = path
+	err = h.Connect()
 	if err != nil {
 		return
 	}
-	h.stmtClearToken, err = h.db.Prepare(`UPDATE User SET token="" WHERE token=?`)
+	if !h.ReadOnly {
+		err = h.migrate()
+		if err != nil {
+			return
+		}
+	}
+	h.stmtInsUser, err = h.db.Prepare(`INSERT INTO User (login, password, admin, tid) VALUES (?, ?, ?, (SELECT tid FROM Tenant WHERE name=?))`)
 	if err != nil {
 		return
 	}
-	h.stmtInsDoc, err = h.db.Prepare(`INSERT INTO Document(id, name, mime, file, public, created, json) values (?,?,?,?,?,?,?)`)
+	h.stmtInsDoc, err = h.db.Prepare(`INSERT INTO Document(id, name, mime, file, public, visibility, created, json, expires_at, owner, size, hash, tid) values (?,?,?,?,?,?,?,?,?,?,?,?,(SELECT tid FROM Tenant WHERE name=?))`)
 	if err != nil {
 		return
 	}
@@ -353,11 +736,11 @@ func (h *Handler) Init(driver string, path string) (err error) {
 	if err != nil {
 		return
 	}
-	h.stmtGetUserUID, err = h.db.Prepare("SELECT uid FROM User WHERE login=?")
+	h.stmtGetUserUID, err = h.db.Prepare("SELECT uid FROM User WHERE login=? AND tid=(SELECT tid FROM Tenant WHERE name=?)")
 	if err != nil {
 		return
 	}
-	h.stmtGetDoc, err = h.db.Prepare(`SELECT d.docid, d.name, d.mime, d.file, d.public, d.created, d.json FROM Document as d WHERE d.id=?`)
+	h.stmtGetDoc, err = h.db.Prepare(`SELECT d.docid, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, t.name, d.expires_at, d.owner, d.size, d.hash, d.version FROM Document as d INNER JOIN Tenant as t USING(tid) WHERE d.id=?`)
 	if err != nil {
 		return
 	}
@@ -366,27 +749,31 @@ func (h *Handler) Init(driver string, path string) (err error) {
 		return
 	}
 	h.stmtGetDocsDefaultFilter, err = h.db.Prepare(`
-	SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.created, d.json 
+	SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
 	FROM Document as d INNER JOIN Grant as g ON(d.docid=g.docid) INNER JOIN User as u ON(g.uid=u.uid)
-	WHERE u.login=?
+	WHERE u.login=?` + expiryWhere + `
 	UNION
-	SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.created, d.json
+	SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
+	FROM Document as d INNER JOIN GroupGrant as gg ON(d.docid=gg.docid) INNER JOIN GroupMember as m ON(gg.gid=m.gid) INNER JOIN User as u ON(m.uid=u.uid)
+	WHERE u.login=?` + expiryWhere + `
+	UNION
+	SELECT d.docid, d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version
 	FROM Document as d
-	WHERE d.public=true
-	ORDER BY d.name, d.created
+	WHERE d.public=true AND d.tid=(SELECT tid FROM User WHERE login=?)` + expiryWhere + `
+	ORDER BY d.created, d.docid
 	LIMIT ?`)
 	if err != nil {
 		return
 	}
-	h.stmtGetUserLogin, err = h.db.Prepare(`SELECT login FROM User WHERE token=?`)
+	h.stmtUpdateDoc, err = h.db.Prepare(`UPDATE Document SET name=?, mime=?, file=?, public=?, visibility=?, created=?, json=?, expires_at=?, size=?, hash=?, version=version+1 WHERE id=?`)
 	if err != nil {
 		return
 	}
-	h.stmtUpdateDoc, err = h.db.Prepare(`UPDATE Document SET name=?, mime=?, file=?, public=?, created=?, json=? WHERE id=?`)
+	h.stmtGetPassword, err = h.db.Prepare(`SELECT password FROM User WHERE login=?`)
 	if err != nil {
 		return
 	}
-	h.stmtGetPassword, err = h.db.Prepare(`SELECT password FROM User WHERE login=?`)
+	h.stmtSetPassword, err = h.db.Prepare(`UPDATE User SET password=? WHERE login=?`)
 	if err != nil {
 		return
 	}
@@ -406,14 +793,155 @@ func (h *Handler) Init(driver string, path string) (err error) {
 	if err != nil {
 		return
 	}
+	h.stmtCountDocs, err = h.db.Prepare(`SELECT COUNT(*) FROM Document`)
+	if err != nil {
+		return
+	}
+	h.stmtSetMeta, err = h.db.Prepare(`INSERT OR REPLACE INTO DocMeta(docid, key, type, value) VALUES (?,?,?,?)`)
+	if err != nil {
+		return
+	}
+	h.stmtGetMeta, err = h.db.Prepare(`SELECT m.key, m.type, m.value FROM DocMeta as m INNER JOIN Document as d USING(docid) WHERE d.id=? ORDER BY m.key`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteMeta, err = h.db.Prepare(`DELETE FROM DocMeta WHERE docid=(SELECT docid FROM Document WHERE id=?) AND key=?`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteMetaDocID, err = h.db.Prepare(`DELETE FROM DocMeta WHERE docid=?`)
+	if err != nil {
+		return
+	}
+	h.stmtInsTenant, err = h.db.Prepare(`INSERT INTO Tenant(name, created) VALUES (?,?)`)
+	if err != nil {
+		return
+	}
+	h.stmtGetTenants, err = h.db.Prepare(`
+	SELECT t.name, t.created,
+	(SELECT COUNT(*) FROM User as u WHERE u.tid=t.tid), (SELECT COUNT(*) FROM Document as d WHERE d.tid=t.tid)
+	FROM Tenant as t ORDER BY t.name`)
+	if err != nil {
+		return
+	}
+	h.stmtCountTenant, err = h.db.Prepare(`
+	SELECT (SELECT COUNT(*) FROM User as u WHERE u.tid=t.tid), (SELECT COUNT(*) FROM Document as d WHERE d.tid=t.tid)
+	FROM Tenant as t WHERE t.name=?`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteTenant, err = h.db.Prepare(`DELETE FROM Tenant WHERE name=?`)
+	if err != nil {
+		return
+	}
+	h.stmtGetUserTenant, err = h.db.Prepare(`SELECT t.name FROM User as u INNER JOIN Tenant as t USING(tid) WHERE u.login=?`)
+	if err != nil {
+		return
+	}
+	h.stmtInsLink, err = h.db.Prepare(`INSERT OR IGNORE INTO DocLink(fromid, toid, type) VALUES (?,?,?)`)
+	if err != nil {
+		return
+	}
+	h.stmtGetLinks, err = h.db.Prepare(`
+	SELECT f.id, t.id, l.type FROM DocLink as l
+	INNER JOIN Document as f ON(l.fromid=f.docid) INNER JOIN Document as t ON(l.toid=t.docid)
+	WHERE f.id=? OR t.id=?
+	ORDER BY l.type, f.id, t.id`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteLink, err = h.db.Prepare(`DELETE FROM DocLink WHERE fromid=(SELECT docid FROM Document WHERE id=?) AND toid=(SELECT docid FROM Document WHERE id=?) AND type=?`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteLinksDocID, err = h.db.Prepare(`DELETE FROM DocLink WHERE fromid=? OR toid=?`)
+	if err != nil {
+		return
+	}
+	h.stmtAddUsage, err = h.db.Prepare(`
+	INSERT INTO Usage(uid, period, requests, bytes) SELECT uid, ?, ?, ? FROM User WHERE login=?
+	ON CONFLICT(uid, period) DO UPDATE SET requests=requests+excluded.requests, bytes=bytes+excluded.bytes`)
+	if err != nil {
+		return
+	}
+	h.stmtGetUsage, err = h.db.Prepare(`SELECT s.requests, s.bytes FROM Usage as s INNER JOIN User as u USING(uid) WHERE u.login=? AND s.period=?`)
+	if err != nil {
+		return
+	}
+	err = h.prepareGroups()
+	if err != nil {
+		return
+	}
+	err = h.prepareExpiry()
+	if err != nil {
+		return
+	}
+	err = h.prepareSearch()
+	if err != nil {
+		return
+	}
+	err = h.prepareActivity()
+	if err != nil {
+		return
+	}
+	err = h.prepareAudit()
+	if err != nil {
+		return
+	}
+	err = h.prepareDeletion()
+	if err != nil {
+		return
+	}
+	err = h.prepareBlobs()
+	if err != nil {
+		return
+	}
+	err = h.prepareRevocations()
+	if err != nil {
+		return
+	}
+	err = h.prepareRefresh()
+	if err != nil {
+		return
+	}
+	return h.prepareOutbox()
+}
+
+// prepareGroups prepares the statements of the groups
+func (h *Handler) prepareGroups() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtInsGroup, `INSERT INTO UserGroup(name, created, tid) VALUES (?,?,(SELECT tid FROM Tenant WHERE name=?))`},
+		{&h.stmtGetGroupID, `SELECT gid FROM UserGroup WHERE name=? AND tid=(SELECT tid FROM Tenant WHERE name=?)`},
+		{&h.stmtGetGroups, `SELECT gid, name, created FROM UserGroup WHERE tid=(SELECT tid FROM Tenant WHERE name=?) ORDER BY name`},
+		{&h.stmtGetGroupMembers, `SELECT u.login FROM GroupMember INNER JOIN User as u USING(uid) WHERE GroupMember.gid=? ORDER BY u.login`},
+		{&h.stmtInsGroupMember, `INSERT OR IGNORE INTO GroupMember(gid, uid) VALUES (?,?)`},
+		{&h.stmtDeleteGroupMember, `DELETE FROM GroupMember WHERE gid=? AND uid=(SELECT uid FROM User WHERE login=?)`},
+		{&h.stmtDeleteGroupMembersGID, `DELETE FROM GroupMember WHERE gid=?`},
+		{&h.stmtDeleteGroupGrantsGID, `DELETE FROM GroupGrant WHERE gid=?`},
+		{&h.stmtDeleteGroup, `DELETE FROM UserGroup WHERE gid=?`},
+		{&h.stmtDeleteTenantGroups, `DELETE FROM UserGroup WHERE tid=(SELECT tid FROM Tenant WHERE name=?)`},
+		{&h.stmtGetUserGroups, `SELECT g.name FROM GroupMember as m INNER JOIN UserGroup as g USING(gid) INNER JOIN User as u ON(m.uid=u.uid) WHERE u.login=? ORDER BY g.name`},
+		{&h.stmtInsGroupGrant, `INSERT OR IGNORE INTO GroupGrant(docid, gid) VALUES (?,?)`},
+		{&h.stmtGetGroupGrant, `SELECT g.name FROM GroupGrant INNER JOIN UserGroup as g USING(gid) WHERE GroupGrant.docid=? ORDER BY g.name`},
+		{&h.stmtDeleteGroupGrantDocID, `DELETE FROM GroupGrant WHERE docid=?`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
-// IsAdmin checks if User.login has admin rights
-func (h *Handler) IsAdmin(login string) (admin bool, err error) {
-	row := h.stmtGetAdmin.QueryRow(login)
+// IsAdmin checks if User.login has admin rights, a NULL admin has none
+func (h *Handler) IsAdmin(ctx context.Context, login string) (admin bool, err error) {
+	row := h.stmtGetAdmin.QueryRowContext(ctx, login)
+	var a sql.NullBool
 	for i := 0; i < 5; i++ {
-		err = row.Scan(&admin)
+		err = row.Scan(&a)
 		if err != nil {
 			if err == sql.ErrConnDone {
 				err = h.Connect()
@@ -425,29 +953,35 @@ func (h *Handler) IsAdmin(login string) (admin bool, err error) {
 		}
 		break
 	}
-	return
+	return a.Bool, nil
 }
 
-// UpdateDocument updates Document, finds docid and uids and deletes from Grant then updates Grant wtih new ones
-func (h *Handler) UpdateDocument(d *Doc, JSON []byte) (err error) {
-	dCurrent, err := h.GetDocument(d.ID)
+// UpdateDocument updates Document, finds docid and uids and deletes from Grant then updates Grant wtih new ones,
+// the groups of GroupGrant are replaced by d.Groups
+func (h *Handler) UpdateDocument(ctx context.Context, d *Doc, JSON []byte) (err error) {
+	dCurrent, err := h.GetDocument(ctx, d.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			err = h.CreateDocument(d, JSON)
+			err = h.CreateDocument(ctx, d, JSON)
 		}
 		return
 	}
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
 	defer tx.Rollback()
-	_, err = tx.Stmt(h.stmtUpdateDoc).Exec(d.Name, d.Mime, d.File, d.Public, d.Created, d.JSON, d.ID)
+	d.ResolveVisibility()
+	size, hash, err := h.fileOf(ctx, tx, d)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtUpdateDoc).ExecContext(ctx, d.Name, d.Mime, d.File, d.Public, d.Visibility, d.Created, d.JSON, d.ExpiresAt, size, hash, d.ID)
 	if err != nil {
 		return
 	}
 	var docID int
-	row := tx.Stmt(h.stmtGetDocID).QueryRow(d.ID)
+	row := tx.Stmt(h.stmtGetDocID).QueryRowContext(ctx, d.ID)
 	for i := 0; i < 5; i++ {
 		err = row.Scan(&docID)
 		if err != nil {
@@ -472,7 +1006,7 @@ func (h *Handler) UpdateDocument(d *Doc, JSON []byte) (err error) {
 		if !needDelete {
 			continue
 		}
-		row := tx.Stmt(h.stmtGetUserUID).QueryRow(v)
+		row := tx.Stmt(h.stmtGetUserUID).QueryRowContext(ctx, v, tenantOf(dCurrent.Tenant))
 		for i := 0; i < 5; i++ {
 			err = row.Scan(&uid)
 			if err != nil {
@@ -486,21 +1020,28 @@ func (h *Handler) UpdateDocument(d *Doc, JSON []byte) (err error) {
 			}
 			break
 		}
-		_, err = tx.Stmt(h.stmtDeleteGrantDocID).Exec(d.ID)
+		_, err = tx.Stmt(h.stmtDeleteGrantDocID).ExecContext(ctx, d.ID)
 		if err != nil {
 			return
 		}
-		_, err = tx.Stmt(h.stmtInsGrant).Exec(docID, uid)
+		_, err = tx.Stmt(h.stmtInsGrant).ExecContext(ctx, docID, uid)
 		if err != nil {
 			return
 		}
 	}
-	tx.Commit()
-	return
-}
-
-// UpdateToken updates User with provided login to set new token
-func (h *Handler) UpdateToken(login string, token string) (err error) {
-	_, err = h.stmtUpdateToken.Exec(token, login)
-	return
+	_, err = tx.Stmt(h.stmtDeleteGroupGrantDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	err = h.grantGroups(ctx, tx, int64(docID), dCurrent.Tenant, d.Groups)
+	if err != nil {
+		return
+	}
+	stored := *d
+	stored.Tenant, stored.Owner, stored.Size, stored.Hash, stored.Version = dCurrent.Tenant, dCurrent.Owner, size, hash, dCurrent.Version+1
+	err = h.addOutbox(ctx, tx, &stored)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,82 @@
+package docsdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	benchUsers = 100
+	benchDocs  = 10000
+)
+
+// newBenchHandler creates a database of benchDocs documents, every one granted to its owner
+// and every tenth one public
+func newBenchHandler(b *testing.B) (h *Handler, cleanup func()) {
+	dir, err := ioutil.TempDir("", "docsdb")
+	if err != nil {
+		b.Fatal(err)
+	}
+	h = &Handler{MaxScanRows: 2 * benchDocs}
+	err = h.Init("sqlite3", filepath.Join(dir, "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchUsers; i++ {
+		err = h.AddUser(context.Background(), &User{Login: fmt.Sprintf("benchuser%d", i), Password: "password1"})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < benchDocs; i++ {
+		d := &Doc{
+			ID:      fmt.Sprintf("%06d", i),
+			Name:    fmt.Sprintf("doc%d", i),
+			Mime:    "text/plain",
+			File:    true,
+			Public:  i%10 == 0,
+			Created: "2019-01-01 00:00:00",
+			Grant:   []string{fmt.Sprintf("benchuser%d", i%benchUsers)},
+			JSON:    []byte(fmt.Sprintf(`{"n":%d}`, i)),
+		}
+		err = h.CreateDocument(context.Background(), d, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	return h, func() {
+		h.Disconnect()
+		os.RemoveAll(dir)
+	}
+}
+
+func benchmarkList(b *testing.B, filter *Filter) {
+	h, cleanup := newBenchHandler(b)
+	defer cleanup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := h.GetDocumentsList(context.Background(), filter)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDocumentsListDefault(b *testing.B) {
+	benchmarkList(b, &Filter{Login: "benchuser1", Limit: 10})
+}
+
+func BenchmarkGetDocumentsListByName(b *testing.B) {
+	benchmarkList(b, &Filter{Login: "benchuser1", Column: "name", Value: "doc501", Limit: 10})
+}
+
+func BenchmarkGetDocumentsListByJSON(b *testing.B) {
+	benchmarkList(b, &Filter{Login: "benchuser1", Column: "json", Value: `{"n":501}`, Limit: 10})
+}
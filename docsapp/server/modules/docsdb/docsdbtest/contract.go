@@ -0,0 +1,864 @@
+// Package docsdbtest is the contract every docsdb.ISQL is to keep, whatever database it is of,
+// and a Mock of docsdb.ISQL for the tests of its callers
+package docsdbtest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// Run runs the contract on the stores newStore makes, an empty one for every subtest
+// with the default tenant only
+func Run(t *testing.T, newStore func(t *testing.T) docsdb.ISQL) {
+	for _, c := range []struct {
+		name string
+		test func(t *testing.T, s docsdb.ISQL)
+	}{
+		{"Users", testUsers},
+		{"Documents", testDocuments},
+		{"Listing", testListing},
+		{"Shared", testShared},
+		{"Cursor", testCursor},
+		{"Meta", testMeta},
+		{"Links", testLinks},
+		{"Tenants", testTenants},
+		{"Usage", testUsage},
+		{"Groups", testGroups},
+		{"Expiry", testExpiry},
+		{"Search", testSearch},
+		{"Activity", testActivity},
+		{"Deletion", testDeletion},
+		{"Audit", testAudit},
+		{"Blobs", testBlobs},
+		{"FileFields", testFileFields},
+		{"Revocations", testRevocations},
+		{"RefreshTokens", testRefreshTokens},
+		{"Outbox", testOutbox},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			c.test(t, newStore(t))
+		})
+	}
+}
+
+// must fails the test at once with err
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantNoRows checks err is sql.ErrNoRows
+func wantNoRows(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != sql.ErrNoRows {
+		t.Errorf("%s: %v, want sql.ErrNoRows", what, err)
+	}
+}
+
+// wantError checks err tells text
+func wantError(t *testing.T, what string, err error, text string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), text) {
+		t.Errorf("%s: %v, want %s", what, err, text)
+	}
+}
+
+func testUsers(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann", Password: "secret", AdminRights: true}))
+	wantError(t, "a second ann", s.AddUser(ctx, &docsdb.User{Login: "ann"}), "UNIQUE")
+	wantError(t, "a user of an unknown tenant", s.AddUser(ctx, &docsdb.User{Login: "bob", Tenant: "nowhere"}), "NOT NULL")
+	password, err := s.GetPassword(ctx, "ann")
+	must(t, err)
+	if password != "secret" {
+		t.Errorf("the password of ann is %q, want secret", password)
+	}
+	admin, err := s.IsAdmin(ctx, "ann")
+	must(t, err)
+	if !admin {
+		t.Error("ann is not an admin")
+	}
+	tenant, err := s.GetUserTenant(ctx, "ann")
+	must(t, err)
+	if tenant != docsdb.DefaultTenant {
+		t.Errorf("the tenant of ann is %q, want %s", tenant, docsdb.DefaultTenant)
+	}
+	_, err = s.GetPassword(ctx, "nobody")
+	wantNoRows(t, "the password of an unknown user", err)
+	must(t, s.SetPassword(ctx, "ann", "$2a$10$hash"))
+	password, err = s.GetPassword(ctx, "ann")
+	must(t, err)
+	if password != "$2a$10$hash" {
+		t.Errorf("the password of ann is %q after it is set", password)
+	}
+	wantNoRows(t, "the password of an unknown user set", s.SetPassword(ctx, "nobody", "$2a$10$hash"))
+	_, err = s.IsAdmin(ctx, "nobody")
+	wantNoRows(t, "the rights of an unknown user", err)
+	_, err = s.GetUserTenant(ctx, "nobody")
+	wantNoRows(t, "the tenant of an unknown user", err)
+}
+
+func testDocuments(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	d := &docsdb.Doc{ID: "1", Name: "a", Mime: "text/plain", File: true, Created: "2019-01-01 00:00:00", Grant: []string{"ann"}, JSON: []byte(`{"n":1}`)}
+	must(t, s.CreateDocument(ctx, d, nil))
+	wantError(t, "a second document 1", s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "b"}, nil), "UNIQUE")
+	got, err := s.GetDocument(ctx, "1")
+	must(t, err)
+	if got.Name != "a" || got.Mime != "text/plain" || !got.File || got.Public || string(got.JSON) != `{"n":1}` {
+		t.Errorf("document 1 is %+v, want %+v", got, d)
+	}
+	if got.Visibility != docsdb.VisibilityPrivate {
+		t.Errorf("the visibility of document 1 is %q, want %s", got.Visibility, docsdb.VisibilityPrivate)
+	}
+	if len(got.Grant) != 1 || got.Grant[0] != "ann" {
+		t.Errorf("document 1 is granted to %v, want ann", got.Grant)
+	}
+	if got.Tenant != docsdb.DefaultTenant {
+		t.Errorf("the tenant of document 1 is %q, want %s", got.Tenant, docsdb.DefaultTenant)
+	}
+	must(t, s.UpdateDocument(ctx, &docsdb.Doc{ID: "1", Name: "renamed", Public: true, Grant: []string{"ann"}}, nil))
+	got, err = s.GetDocument(ctx, "1")
+	must(t, err)
+	if got.Name != "renamed" || got.Visibility != docsdb.VisibilityPublic {
+		t.Errorf("the updated document 1 is %+v, want renamed and public", got)
+	}
+	// the update without a json leaves it NULL, it reads back as none in the document and in the listings
+	if got.JSON != nil {
+		t.Errorf("the json of the updated document 1 is %q, want none", got.JSON)
+	}
+	list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1})
+	must(t, err)
+	if len(list) != 1 || list[0].JSON != nil {
+		t.Errorf("ann lists %+v, want document 1 without json", list)
+	}
+	must(t, s.UpdateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}}, nil))
+	_, err = s.GetDocument(ctx, "2")
+	if err != nil {
+		t.Errorf("updating an unknown document doesn't create it: %v", err)
+	}
+	wantNoRows(t, "granting an unknown user", s.CreateDocument(ctx, &docsdb.Doc{ID: "3", Grant: []string{"nobody"}}, nil))
+	must(t, s.DeleteDocument(ctx, "1"))
+	_, err = s.GetDocument(ctx, "1")
+	wantNoRows(t, "a deleted document", err)
+	wantNoRows(t, "deleting an unknown document", s.DeleteDocument(ctx, "1"))
+}
+
+func testListing(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddTenant(ctx, &docsdb.Tenant{Name: "acme", Created: "2019-01-01 00:00:00"}))
+	for _, u := range []*docsdb.User{{Login: "ann"}, {Login: "bob"}, {Login: "eve", Tenant: "acme"}} {
+		must(t, s.AddUser(ctx, u))
+	}
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "b", Grant: []string{"ann"}},
+		{ID: "2", Name: "a", Public: true, Grant: []string{"bob"}},
+		{ID: "3", Name: "c", Public: true, Grant: []string{"eve"}, Tenant: "acme"},
+		{ID: "4", Name: "d", Grant: []string{"bob"}},
+	} {
+		must(t, s.CreateDocument(ctx, d, nil))
+	}
+	for _, c := range []struct {
+		filter docsdb.Filter
+		want   string
+	}{
+		{docsdb.Filter{Login: "ann", Limit: -1}, "1,2"},
+		{docsdb.Filter{Login: "ann", Limit: 1}, "1"},
+		{docsdb.Filter{Login: "bob", Limit: -1}, "2,4"},
+		{docsdb.Filter{Login: "eve", Limit: -1}, "3"},
+		{docsdb.Filter{Login: "ann", Column: "name", Value: "b", Limit: -1}, "1"},
+		{docsdb.Filter{Tenant: "acme", Limit: -1}, "3"},
+	} {
+		list, err := s.GetDocumentsList(ctx, &c.filter)
+		must(t, err)
+		var ids []string
+		for _, d := range list {
+			ids = append(ids, d.ID)
+		}
+		if got := strings.Join(ids, ","); got != c.want {
+			t.Errorf("%+v lists %s, want %s", c.filter, got, c.want)
+		}
+	}
+	wantNoRows(t, "granting a user of another tenant", s.CreateDocument(ctx, &docsdb.Doc{ID: "5", Grant: []string{"eve"}}, nil))
+}
+
+func testShared(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	for _, u := range []*docsdb.User{{Login: "ann"}, {Login: "bob"}} {
+		must(t, s.AddUser(ctx, u))
+	}
+	must(t, s.AddGroup(ctx, &docsdb.Group{Name: "team", Created: "2019-01-01 00:00:00"}))
+	must(t, s.AddGroupMember(ctx, docsdb.DefaultTenant, "team", "bob"))
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "a", Owner: "ann", Grant: []string{"ann"}},
+		{ID: "2", Name: "b", Owner: "ann", Grant: []string{"ann", "bob"}},
+		{ID: "3", Name: "c", Owner: "ann", Grant: []string{"ann"}, Groups: []string{"team"}},
+		{ID: "4", Name: "d", Owner: "ann", Grant: []string{"ann"}, Visibility: docsdb.VisibilityUnlisted},
+		{ID: "5", Name: "e", Owner: "bob", Grant: []string{"bob", "ann"}},
+		{ID: "6", Name: "f", Owner: "bob", Grant: []string{"bob"}, Public: true},
+	} {
+		must(t, s.CreateDocument(ctx, d, nil))
+	}
+	for _, c := range []struct {
+		filter docsdb.Filter
+		want   string
+	}{
+		{docsdb.Filter{Login: "ann", Shared: docsdb.SharedByMe, Limit: -1}, "2,3,4"},
+		{docsdb.Filter{Login: "ann", Shared: docsdb.SharedWithMe, Limit: -1}, "5"},
+		{docsdb.Filter{Login: "bob", Shared: docsdb.SharedByMe, Limit: -1}, "5,6"},
+		{docsdb.Filter{Login: "bob", Shared: docsdb.SharedWithMe, Limit: -1}, "2,3"},
+		{docsdb.Filter{Login: "bob", Shared: docsdb.SharedWithMe, Column: "name", Value: "c", Limit: -1}, "3"},
+	} {
+		list, err := s.GetDocumentsList(ctx, &c.filter)
+		must(t, err)
+		var ids []string
+		for _, d := range list {
+			ids = append(ids, d.ID)
+		}
+		if got := strings.Join(ids, ","); got != c.want {
+			t.Errorf("%+v lists %s, want %s", c.filter, got, c.want)
+		}
+	}
+	d, err := s.GetDocument(ctx, "5")
+	must(t, err)
+	must(t, s.UpdateDocument(ctx, &docsdb.Doc{ID: "5", Name: "e", Owner: "ann", Grant: d.Grant}, nil))
+	if d, _ = s.GetDocument(ctx, "5"); d == nil || d.Owner != "bob" {
+		t.Errorf("the owner after an update is %+v", d)
+	}
+}
+
+func testCursor(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	create := func(id, created string) {
+		must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: id, Name: id, Created: created, Grant: []string{"ann"}}, nil))
+	}
+	create("1", "2019-01-02 00:00:00")
+	create("2", "2019-01-02 00:00:00")
+	create("3", "2019-01-02 00:00:00")
+	create("4", "2019-01-01 00:00:00")
+	page := func(after string, limit int, want string) string {
+		list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: limit, After: after})
+		must(t, err)
+		var ids []string
+		for _, d := range list {
+			ids = append(ids, d.ID)
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Fatalf("the page after %q lists %s, want %s", after, got, want)
+		}
+		return list[len(list)-1].Cursor
+	}
+	next := page("", 2, "4,1")
+	// the changes between the pages move none of the documents left
+	must(t, s.DeleteDocument(ctx, "4"))
+	create("5", "2019-01-01 12:00:00")
+	create("6", "2019-01-03 00:00:00")
+	next = page(next, 2, "2,3")
+	page(next, -1, "6")
+	_, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1, After: "not a cursor"})
+	if err != docsdb.ErrInvalidCursor {
+		t.Errorf("listing after an invalid cursor fails with %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testMeta(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "a", Grant: []string{"ann"}}, nil))
+	must(t, s.SetMeta(ctx, "1", &docsdb.Meta{Key: "pages", Type: docsdb.MetaNumber, Value: "3"}))
+	must(t, s.SetMeta(ctx, "1", &docsdb.Meta{Key: "author", Type: docsdb.MetaString, Value: "ann"}))
+	must(t, s.SetMeta(ctx, "1", &docsdb.Meta{Key: "pages", Type: docsdb.MetaNumber, Value: "4"}))
+	wantNoRows(t, "a key of an unknown document", s.SetMeta(ctx, "2", &docsdb.Meta{Key: "pages", Value: "1"}))
+	meta, err := s.GetMeta(ctx, "1")
+	must(t, err)
+	if len(meta) != 2 || *meta[0] != (docsdb.Meta{Key: "author", Type: docsdb.MetaString, Value: "ann"}) ||
+		*meta[1] != (docsdb.Meta{Key: "pages", Type: docsdb.MetaNumber, Value: "4"}) {
+		t.Errorf("the keys of document 1 are %v, want author and pages 4", meta)
+	}
+	list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1, Meta: map[string]string{"pages": "4"}})
+	must(t, err)
+	if len(list) != 1 {
+		t.Errorf("the documents of 4 pages are %v, want 1", list)
+	}
+	must(t, s.DeleteMeta(ctx, "1", "pages"))
+	wantNoRows(t, "deleting a deleted key", s.DeleteMeta(ctx, "1", "pages"))
+}
+
+func testLinks(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	for _, id := range []string{"1", "2", "3"} {
+		must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: id, Name: id, Grant: []string{"ann"}}, nil))
+	}
+	must(t, s.AddLink(ctx, &docsdb.Link{From: "2", To: "1", Type: "supersedes"}))
+	must(t, s.AddLink(ctx, &docsdb.Link{From: "3", To: "2", Type: "attachment-of"}))
+	wantNoRows(t, "a link to an unknown document", s.AddLink(ctx, &docsdb.Link{From: "1", To: "4", Type: "supersedes"}))
+	links, err := s.GetLinks(ctx, "2")
+	must(t, err)
+	if len(links) != 2 || *links[0] != (docsdb.Link{From: "3", To: "2", Type: "attachment-of"}) ||
+		*links[1] != (docsdb.Link{From: "2", To: "1", Type: "supersedes"}) {
+		t.Errorf("the links of document 2 are %v, want both ways ordered by type", links)
+	}
+	must(t, s.DeleteLink(ctx, &docsdb.Link{From: "2", To: "1", Type: "supersedes"}))
+	wantNoRows(t, "deleting a deleted link", s.DeleteLink(ctx, &docsdb.Link{From: "2", To: "1", Type: "supersedes"}))
+	must(t, s.DeleteDocument(ctx, "3"))
+	links, err = s.GetLinks(ctx, "2")
+	must(t, err)
+	if len(links) != 0 {
+		t.Errorf("the links of document 2 are %v after the deletion of 3, want none", links)
+	}
+}
+
+func testTenants(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddTenant(ctx, &docsdb.Tenant{Name: "acme", Created: "2019-01-01 00:00:00"}))
+	must(t, s.AddTenant(ctx, &docsdb.Tenant{Name: "empty", Created: "2019-01-02 00:00:00"}))
+	wantError(t, "a second acme", s.AddTenant(ctx, &docsdb.Tenant{Name: "acme"}), "UNIQUE")
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "eve", Tenant: "acme"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "a", Tenant: "acme", Grant: []string{"eve"}}, nil))
+	tenants, err := s.GetTenants(ctx)
+	must(t, err)
+	var names []string
+	for _, tn := range tenants {
+		names = append(names, tn.Name)
+		if tn.Name == "acme" && (tn.Created != "2019-01-01 00:00:00" || tn.Users != 1 || tn.Docs != 1) {
+			t.Errorf("acme is %+v, want 1 user and 1 document", tn)
+		}
+	}
+	if got := strings.Join(names, ","); got != "acme,default,empty" {
+		t.Errorf("the tenants are %s, want acme,default,empty", got)
+	}
+	if err := s.DeleteTenant(ctx, "acme"); err != docsdb.ErrTenantNotEmpty {
+		t.Errorf("deleting acme: %v, want ErrTenantNotEmpty", err)
+	}
+	if err := s.DeleteTenant(ctx, docsdb.DefaultTenant); err != docsdb.ErrTenantNotEmpty {
+		t.Errorf("deleting the default tenant: %v, want ErrTenantNotEmpty", err)
+	}
+	must(t, s.DeleteTenant(ctx, "empty"))
+	wantNoRows(t, "deleting a deleted tenant", s.DeleteTenant(ctx, "empty"))
+}
+
+func testUsage(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.AddUsage(ctx, "ann", &docsdb.Usage{Period: "2019-01", Requests: 1, Bytes: 10}))
+	u := &docsdb.Usage{Period: "2019-01", Requests: 2, Bytes: 5}
+	must(t, s.AddUsage(ctx, "ann", u))
+	if u.Requests != 3 || u.Bytes != 15 {
+		t.Errorf("the sums are %+v, want 3 requests and 15 bytes", u)
+	}
+	u, err := s.GetUsage(ctx, "ann", "2019-01")
+	must(t, err)
+	if u.Requests != 3 || u.Bytes != 15 {
+		t.Errorf("the usage of 2019-01 is %+v, want 3 requests and 15 bytes", u)
+	}
+	u, err = s.GetUsage(ctx, "ann", "2019-02")
+	must(t, err)
+	if u.Period != "2019-02" || u.Requests != 0 || u.Bytes != 0 {
+		t.Errorf("the usage of 2019-02 is %+v, want zero", u)
+	}
+	wantNoRows(t, "the usage of an unknown user", s.AddUsage(ctx, "nobody", &docsdb.Usage{Period: "2019-01", Requests: 1}))
+}
+
+func testGroups(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddTenant(ctx, &docsdb.Tenant{Name: "acme", Created: "2019-01-01 00:00:00"}))
+	for _, u := range []*docsdb.User{{Login: "ann"}, {Login: "bob"}, {Login: "eve", Tenant: "acme"}} {
+		must(t, s.AddUser(ctx, u))
+	}
+	must(t, s.AddGroup(ctx, &docsdb.Group{Name: "team", Created: "2019-01-01 00:00:00"}))
+	must(t, s.AddGroup(ctx, &docsdb.Group{Name: "team", Tenant: "acme", Created: "2019-01-01 00:00:00"}))
+	wantError(t, "a second team", s.AddGroup(ctx, &docsdb.Group{Name: "team"}), "UNIQUE")
+	wantError(t, "a group of an unknown tenant", s.AddGroup(ctx, &docsdb.Group{Name: "team", Tenant: "nowhere"}), "NOT NULL")
+	must(t, s.AddGroupMember(ctx, docsdb.DefaultTenant, "team", "bob"))
+	must(t, s.AddGroupMember(ctx, docsdb.DefaultTenant, "team", "bob"))
+	wantNoRows(t, "a member of another tenant", s.AddGroupMember(ctx, docsdb.DefaultTenant, "team", "eve"))
+	wantNoRows(t, "a member of an unknown group", s.AddGroupMember(ctx, docsdb.DefaultTenant, "nobody", "bob"))
+	groups, err := s.GetGroups(ctx, docsdb.DefaultTenant)
+	must(t, err)
+	if len(groups) != 1 || groups[0].Name != "team" || strings.Join(groups[0].Members, ",") != "bob" {
+		t.Errorf("the groups are %v, want team of bob", groups)
+	}
+	names, err := s.GetUserGroups(ctx, "bob")
+	must(t, err)
+	if strings.Join(names, ",") != "team" {
+		t.Errorf("the groups of bob are %v, want team", names)
+	}
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "a", Grant: []string{"ann"}, Groups: []string{"team"}}, nil))
+	wantNoRows(t, "granting an unknown group", s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Grant: []string{"ann"}, Groups: []string{"nobody"}}, nil))
+	d, err := s.GetDocument(ctx, "1")
+	must(t, err)
+	if strings.Join(d.Groups, ",") != "team" {
+		t.Errorf("document 1 is granted to the groups %v, want team", d.Groups)
+	}
+	list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "bob", Limit: -1})
+	must(t, err)
+	if len(list) != 1 || list[0].ID != "1" || strings.Join(list[0].Groups, ",") != "team" {
+		t.Errorf("bob lists %v, want 1 of team", list)
+	}
+	list, err = s.GetDocumentsList(ctx, &docsdb.Filter{Login: "eve", Limit: -1})
+	must(t, err)
+	if len(list) != 0 {
+		t.Errorf("eve of the team of acme lists %v, want none", list)
+	}
+	must(t, s.DeleteGroupMember(ctx, docsdb.DefaultTenant, "team", "bob"))
+	wantNoRows(t, "removing a removed member", s.DeleteGroupMember(ctx, docsdb.DefaultTenant, "team", "bob"))
+	list, err = s.GetDocumentsList(ctx, &docsdb.Filter{Login: "bob", Limit: -1})
+	must(t, err)
+	if len(list) != 0 {
+		t.Errorf("bob out of the team lists %v, want none", list)
+	}
+	must(t, s.DeleteGroup(ctx, docsdb.DefaultTenant, "team"))
+	wantNoRows(t, "deleting a deleted group", s.DeleteGroup(ctx, docsdb.DefaultTenant, "team"))
+	d, err = s.GetDocument(ctx, "1")
+	must(t, err)
+	if len(d.Groups) != 0 {
+		t.Errorf("document 1 is granted to the deleted groups %v", d.Groups)
+	}
+}
+
+func testExpiry(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "a", Grant: []string{"ann"}, ExpiresAt: "2019-01-02 00:00:00"}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}, ExpiresAt: "2019-01-03 00:00:00"}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "3", Name: "c", Grant: []string{"ann"}}, nil))
+	d, err := s.GetDocument(ctx, "1")
+	must(t, err)
+	if d.ExpiresAt != "2019-01-02 00:00:00" {
+		t.Errorf("document 1 expires at %q", d.ExpiresAt)
+	}
+	for now, want := range map[string]string{"": "a b c", "2019-01-02 00:00:00": "b c", "2019-01-03 12:00:00": "c"} {
+		list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1, Now: now})
+		must(t, err)
+		var names []string
+		for _, d := range list {
+			names = append(names, d.Name)
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("ann lists %q at %q, want %q", got, now, want)
+		}
+		list, err = s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Column: "name", Value: "b", Limit: -1, Now: now})
+		must(t, err)
+		if b := strings.Contains(want, "b"); b != (len(list) == 1) {
+			t.Errorf("ann finds %d documents named b at %q", len(list), now)
+		}
+	}
+	must(t, s.SetExpiry(ctx, "2", "2019-01-05 00:00:00"))
+	wantNoRows(t, "the expiry of an unknown document", s.SetExpiry(ctx, "4", "2019-01-05 00:00:00"))
+	expired, err := s.GetExpiredDocuments(ctx, "2019-01-04 00:00:00")
+	must(t, err)
+	if len(expired) != 1 || expired[0].ID != "1" || expired[0].Tenant != docsdb.DefaultTenant {
+		t.Errorf("the documents expired by 2019-01-04 are %v, want 1", expired)
+	}
+	expired, err = s.GetExpiredDocuments(ctx, "2019-01-05 00:00:00")
+	must(t, err)
+	if len(expired) != 2 || expired[0].ID != "1" || expired[1].ID != "2" {
+		t.Errorf("the documents expired by 2019-01-05 are %v, want 1 and 2", expired)
+	}
+	must(t, s.SetExpiry(ctx, "2", ""))
+	expired, err = s.GetExpiredDocuments(ctx, "2019-01-05 00:00:00")
+	must(t, err)
+	if len(expired) != 1 {
+		t.Errorf("document 2 never expiring is expired: %v", expired)
+	}
+}
+
+func testSearch(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "bob"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "Report.txt", Grant: []string{"ann"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Name: "notes.md", Grant: []string{"ann"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "3", Name: "report of bob", Grant: []string{"bob"}}, nil))
+	must(t, s.IndexContent(ctx, "1", "the yearly report of the sales in 2019"))
+	must(t, s.IndexContent(ctx, "2", "the sales went up"))
+	must(t, s.IndexContent(ctx, "3", "the sales of bob"))
+	wantNoRows(t, "indexing an unknown document", s.IndexContent(ctx, "4", "text"))
+	search := func(query string, content bool) (ids []string, snippets []string) {
+		hits, err := s.SearchDocuments(ctx, &docsdb.Filter{Login: "ann", Limit: -1}, query, content)
+		must(t, err)
+		for _, h := range hits {
+			ids = append(ids, h.ID)
+			snippets = append(snippets, h.Snippet)
+		}
+		return
+	}
+	if ids, _ := search("report", false); strings.Join(ids, " ") != "1" {
+		t.Errorf("ann finds %v by the name report, want 1", ids)
+	}
+	ids, snippets := search("sales", true)
+	if strings.Join(ids, " ") != "1 2" {
+		t.Errorf("ann finds %v by the content sales, want 1 2", ids)
+	}
+	for _, v := range snippets {
+		if !strings.Contains(v, docsdb.SnippetStart+"sales"+docsdb.SnippetEnd) {
+			t.Errorf("the snippet %q has no marked sales", v)
+		}
+	}
+	must(t, s.IndexContent(ctx, "2", "<script>sales</script>"))
+	_, snippets = search("sales", true)
+	for _, v := range snippets {
+		if strings.Contains(v, "<script>") {
+			t.Errorf("the snippet %q has the markup of the content", v)
+		}
+	}
+	if ids, _ := search("sales 2019", true); strings.Join(ids, " ") != "1" {
+		t.Errorf("ann finds %v by the content sales 2019, want 1", ids)
+	}
+	must(t, s.IndexContent(ctx, "1", ""))
+	if ids, _ := search("2019", true); len(ids) != 0 {
+		t.Errorf("ann finds %v in a dropped content", ids)
+	}
+	must(t, s.DeleteDocument(ctx, "2"))
+	if ids, _ := search("sales", true); len(ids) != 0 {
+		t.Errorf("ann finds %v in a deleted document", ids)
+	}
+}
+
+func testActivity(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "a", Grant: []string{"ann"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}}, nil))
+	var ids []int64
+	for _, v := range []struct{ doc, typ string }{{"1", "created"}, {"2", "created"}, {"1", "grant"}, {"1", "updated"}} {
+		a := &docsdb.Activity{Doc: v.doc, Login: "ann", Type: v.typ, Detail: "+bob", Created: "2019-01-01 00:00:00"}
+		must(t, s.AddActivity(ctx, a))
+		ids = append(ids, a.ID)
+	}
+	if !(ids[0] < ids[1] && ids[1] < ids[2] && ids[2] < ids[3]) {
+		t.Errorf("the ids of the entries %v are not growing", ids)
+	}
+	wantNoRows(t, "the activity of an unknown document", s.AddActivity(ctx, &docsdb.Activity{Doc: "3", Login: "ann", Type: "created"}))
+	activity, err := s.GetActivity(ctx, "1", 0, -1)
+	must(t, err)
+	var types []string
+	for _, a := range activity {
+		types = append(types, a.Type)
+	}
+	if strings.Join(types, " ") != "created grant updated" || activity[1].Detail != "+bob" || activity[0].Doc != "1" {
+		t.Errorf("the activity of 1 is %v, want created grant updated", types)
+	}
+	activity, err = s.GetActivity(ctx, "1", ids[0], 1)
+	must(t, err)
+	if len(activity) != 1 || activity[0].ID != ids[2] {
+		t.Errorf("the page after %d is %v, want %d", ids[0], activity, ids[2])
+	}
+	must(t, s.DeleteDocument(ctx, "1"))
+	activity, err = s.GetActivity(ctx, "1", 0, -1)
+	must(t, err)
+	if len(activity) != 0 {
+		t.Errorf("a deleted document has the activity %v", activity)
+	}
+}
+
+func testDeletion(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "bob"}))
+	must(t, s.AddGroup(ctx, &docsdb.Group{Name: "team"}))
+	must(t, s.AddGroupMember(ctx, docsdb.DefaultTenant, "team", "ann"))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "ann/a.txt", File: true, Grant: []string{"ann"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann", "bob"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "3", Name: "c", Grant: []string{"ann"}, Groups: []string{"team"}}, nil))
+	u := &docsdb.Usage{Period: "2019-01", Requests: 1}
+	must(t, s.AddUsage(ctx, "ann", u))
+
+	d, err := s.GetDeletion(ctx, "ann")
+	must(t, err)
+	if d.Login != "ann" || d.Code != "" || d.At != "" {
+		t.Errorf("ann has the deletion %+v before any", d)
+	}
+	_, err = s.GetDeletion(ctx, "carl")
+	wantNoRows(t, "the deletion of an unknown user", err)
+	wantNoRows(t, "a deletion of an unknown user", s.SetDeletion(ctx, &docsdb.Deletion{Login: "carl", Code: "x"}))
+	must(t, s.SetDeletion(ctx, &docsdb.Deletion{Login: "ann", Code: "x"}))
+	must(t, s.SetDeletion(ctx, &docsdb.Deletion{Login: "bob", At: "2019-02-01 00:00:00"}))
+	d, err = s.GetDeletion(ctx, "ann")
+	must(t, err)
+	if d.Code != "x" || d.At != "" {
+		t.Errorf("the deletion of ann is %+v, want the code x", d)
+	}
+	must(t, s.SetDeletion(ctx, &docsdb.Deletion{Login: "ann", At: "2019-01-15 00:00:00"}))
+	due, err := s.GetDueDeletions(ctx, "2019-01-20 00:00:00")
+	must(t, err)
+	if len(due) != 1 || due[0].Login != "ann" {
+		t.Errorf("the deletions due by 2019-01-20 are %v, want ann", due)
+	}
+	due, err = s.GetDueDeletions(ctx, "2019-03-01 00:00:00")
+	must(t, err)
+	if len(due) != 2 || due[0].Login != "ann" || due[1].Login != "bob" {
+		t.Errorf("the deletions due by 2019-03-01 are %v, want ann bob", due)
+	}
+
+	docs, err := s.DeleteUser(ctx, "ann")
+	must(t, err)
+	if len(docs) != 1 || docs[0].ID != "1" || docs[0].Name != "ann/a.txt" || !docs[0].File {
+		t.Errorf("the deleted documents of ann are %v, want 1", docs)
+	}
+	_, err = s.GetDocument(ctx, "1")
+	wantNoRows(t, "a document of a deleted user", err)
+	doc, err := s.GetDocument(ctx, "2")
+	must(t, err)
+	if strings.Join(doc.Grant, " ") != "bob" {
+		t.Errorf("a shared document is granted to %v after the deletion of ann, want bob", doc.Grant)
+	}
+	doc, err = s.GetDocument(ctx, "3")
+	must(t, err)
+	if len(doc.Grant) != 0 || strings.Join(doc.Groups, " ") != "team" {
+		t.Errorf("a document of a group is granted to %v and %v after the deletion of ann, want the group only", doc.Grant, doc.Groups)
+	}
+	groups, err := s.GetUserGroups(ctx, "ann")
+	must(t, err)
+	if len(groups) != 0 {
+		t.Errorf("a deleted user is in %v", groups)
+	}
+	_, err = s.GetPassword(ctx, "ann")
+	wantNoRows(t, "the password of a deleted user", err)
+	_, err = s.DeleteUser(ctx, "ann")
+	wantNoRows(t, "a second deletion", err)
+	due, err = s.GetDueDeletions(ctx, "2019-03-01 00:00:00")
+	must(t, err)
+	if len(due) != 1 || due[0].Login != "bob" {
+		t.Errorf("the deletions due after ann is gone are %v, want bob", due)
+	}
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	d, err = s.GetDeletion(ctx, "ann")
+	must(t, err)
+	if d.At != "" {
+		t.Errorf("a new ann has the deletion %+v of the old one", d)
+	}
+	u = &docsdb.Usage{Period: "2019-01", Requests: 1}
+	must(t, s.AddUsage(ctx, "ann", u))
+	if u.Requests != 1 {
+		t.Errorf("a new ann has %d requests, the usage of the old one is kept", u.Requests)
+	}
+}
+
+func testAudit(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	var ids []int64
+	for _, action := range []string{"deletion requested", "deletion confirmed", "deleted"} {
+		a := &docsdb.Audit{Actor: "ann", Login: "ann", Action: action, Created: "2019-01-01 00:00:00"}
+		must(t, s.AddAudit(ctx, a))
+		ids = append(ids, a.ID)
+	}
+	if !(ids[0] < ids[1] && ids[1] < ids[2]) {
+		t.Errorf("the ids of the entries %v are not growing", ids)
+	}
+	audit, err := s.GetAudit(ctx, 0, -1)
+	must(t, err)
+	if len(audit) != 3 || audit[0].Action != "deletion requested" || audit[2].Actor != "ann" {
+		t.Errorf("the audit log is %v, want 3 entries", audit)
+	}
+	audit, err = s.GetAudit(ctx, ids[0], 1)
+	must(t, err)
+	if len(audit) != 1 || audit[0].ID != ids[1] {
+		t.Errorf("the page after %d is %v, want %d", ids[0], audit, ids[1])
+	}
+}
+
+func testBlobs(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "ann/a.txt", Hash: "aa", Size: 1}))
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "ann/b.txt", Hash: "bb", Size: 2}))
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "ann/b.txt", Hash: "aa", Size: 1}))
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "bob/c.txt", Hash: "cc", Size: 3}))
+	b, err := s.GetBlob(ctx, "ann/b.txt")
+	must(t, err)
+	if b.Hash != "aa" || b.Size != 1 {
+		t.Errorf("the replaced blob is %+v", b)
+	}
+	_, err = s.GetBlob(ctx, "nobody/a.txt")
+	wantNoRows(t, "the blob of an unknown name", err)
+	n, err := s.CountBlobs(ctx, "aa")
+	must(t, err)
+	if n != 2 {
+		t.Errorf("aa is the content of %d names, want 2", n)
+	}
+	blobs, err := s.GetBlobs(ctx, "ann/a.txt", 1)
+	must(t, err)
+	if len(blobs) != 1 || blobs[0].Name != "ann/b.txt" {
+		t.Errorf("the page after ann/a.txt is %+v", blobs)
+	}
+	blobs, err = s.GetBlobs(ctx, "", -1)
+	must(t, err)
+	if len(blobs) != 3 {
+		t.Errorf("all the blobs are %+v", blobs)
+	}
+	b, err = s.DeleteBlob(ctx, "ann/a.txt")
+	must(t, err)
+	if b.Hash != "aa" {
+		t.Errorf("the deleted blob is %+v", b)
+	}
+	_, err = s.DeleteBlob(ctx, "ann/a.txt")
+	wantNoRows(t, "the blob deleted twice", err)
+	if n, err = s.CountBlobs(ctx, "aa"); err != nil || n != 1 {
+		t.Errorf("aa is the content of %d names, %v after a deletion, want 1", n, err)
+	}
+}
+
+func testFileFields(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "ann/a.txt", Hash: "aa", Size: 1}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "ann/a.txt", File: true, Grant: []string{"ann"}}, nil))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Size: 5, Hash: "bb", Version: 7, Grant: []string{"ann"}}, nil))
+	check := func(id string, size int64, hash string, version int) {
+		t.Helper()
+		d, err := s.GetDocument(ctx, id)
+		must(t, err)
+		if d.Size != size || d.Hash != hash || d.Version != version {
+			t.Errorf("%s has size %d, hash %q and version %d, want %d, %q and %d", id, d.Size, d.Hash, d.Version, size, hash, version)
+		}
+	}
+	check("1", 1, "aa", 1)
+	check("2", 0, "", 1)
+	must(t, s.SetBlob(ctx, &docsdb.Blob{Name: "ann/a.txt", Hash: "cc", Size: 3}))
+	check("1", 3, "cc", 1)
+	must(t, s.UpdateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}}, nil))
+	must(t, s.UpdateDocument(ctx, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}}, nil))
+	check("2", 0, "", 3)
+	list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Column: "hash", Value: "cc", Limit: -1})
+	must(t, err)
+	if len(list) != 1 || list[0].ID != "1" || list[0].Size != 3 {
+		t.Errorf("the documents of hash cc are %+v, want 1 of size 3", list)
+	}
+}
+
+func testRevocations(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	revoked, err := s.RevokeToken(ctx, "a", "2020-01-01 00:00:00")
+	must(t, err)
+	if !revoked {
+		t.Error("a new token is not revoked")
+	}
+	revoked, err = s.RevokeToken(ctx, "a", "2020-01-01 00:00:00")
+	must(t, err)
+	if revoked {
+		t.Error("a token is revoked twice")
+	}
+	_, err = s.RevokeToken(ctx, "b", "2030-01-01 00:00:00")
+	must(t, err)
+	ids, err := s.GetRevokedTokens(ctx, "2025-01-01 00:00:00")
+	must(t, err)
+	if len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("the tokens revoked until after 2025 are %v, want [b]", ids)
+	}
+	n, err := s.ClearRevokedTokens(ctx, "2025-01-01 00:00:00")
+	must(t, err)
+	if n != 1 {
+		t.Errorf("%d expired revoked tokens are cleared, want 1", n)
+	}
+	if ids, _ = s.GetRevokedTokens(ctx, ""); len(ids) != 1 {
+		t.Errorf("the tokens left revoked are %v, want [b]", ids)
+	}
+	generation, err := s.RevokeLogin(ctx, "ann")
+	must(t, err)
+	if generation != 1 {
+		t.Errorf("the first revocation of ann is the generation %d, want 1", generation)
+	}
+	if generation, _ = s.RevokeLogin(ctx, "ann"); generation != 2 {
+		t.Errorf("the second revocation of ann is the generation %d, want 2", generation)
+	}
+	generations, err := s.GetTokenGenerations(ctx)
+	must(t, err)
+	if len(generations) != 1 || generations["ann"] != 2 {
+		t.Errorf("the generations are %v, want ann 2", generations)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	for _, token := range []*docsdb.RefreshToken{
+		{Hash: "a", Login: "ann", Family: "1", Scopes: "docs:read", ExpiresAt: "2030-01-01 00:00:00"},
+		{Hash: "b", Login: "ann", Family: "2", ExpiresAt: "2030-01-01 00:00:00"},
+		{Hash: "c", Login: "ann", Family: "2", ExpiresAt: "2020-01-01 00:00:00"},
+		{Hash: "d", Login: "bob", Family: "3", ExpiresAt: "2030-01-01 00:00:00"},
+	} {
+		must(t, s.AddRefreshToken(ctx, token))
+	}
+	if err := s.AddRefreshToken(ctx, &docsdb.RefreshToken{Hash: "a", Login: "bob", Family: "4"}); err == nil {
+		t.Error("a refresh token is added twice")
+	}
+	token, err := s.UseRefreshToken(ctx, "a")
+	must(t, err)
+	if token.Login != "ann" || token.Family != "1" || token.Scopes != "docs:read" || token.Used {
+		t.Errorf("the first use of a is %+v", token)
+	}
+	if token, _ = s.UseRefreshToken(ctx, "a"); token == nil || !token.Used {
+		t.Errorf("the second use of a is %+v", token)
+	}
+	_, err = s.UseRefreshToken(ctx, "z")
+	wantNoRows(t, "an unknown refresh token", err)
+	n, err := s.ClearRefreshTokens(ctx, "2025-01-01 00:00:00")
+	must(t, err)
+	if n != 1 {
+		t.Errorf("%d expired refresh tokens are cleared, want 1", n)
+	}
+	if n, err = s.DeleteRefreshTokens(ctx, "ann", "2"); err != nil || n != 1 {
+		t.Errorf("the family 2 of ann has %d, %v, want 1", n, err)
+	}
+	if n, err = s.DeleteRefreshTokens(ctx, "ann", ""); err != nil || n != 1 {
+		t.Errorf("ann has %d left, %v, want 1", n, err)
+	}
+	if _, err = s.UseRefreshToken(ctx, "d"); err != nil {
+		t.Errorf("the token of bob is deleted along with the ones of ann: %v", err)
+	}
+}
+
+func testOutbox(t *testing.T, s docsdb.ISQL) {
+	ctx := context.Background()
+	must(t, s.AddUser(ctx, &docsdb.User{Login: "ann"}))
+	must(t, s.CreateDocument(ctx, &docsdb.Doc{ID: "1", Name: "quiet", Grant: []string{"ann"}}, nil))
+	created := docsdb.WithOutbox(ctx, &docsdb.Outbox{Action: "created", Login: "ann", Created: "2019-01-01 00:00:00"})
+	must(t, s.CreateDocument(created, &docsdb.Doc{ID: "2", Name: "a", Grant: []string{"ann"}, JSON: []byte(`{"n":1}`)}, nil))
+	updated := docsdb.WithOutbox(ctx, &docsdb.Outbox{Action: "updated", Login: "ann", Created: "2019-01-02 00:00:00"})
+	must(t, s.UpdateDocument(updated, &docsdb.Doc{ID: "2", Name: "b", Grant: []string{"ann"}}, nil))
+	wantNoRows(t, "granting an unknown user", s.CreateDocument(created, &docsdb.Doc{ID: "3", Grant: []string{"nobody"}}, nil))
+	entries, err := s.GetOutbox(ctx, -1)
+	must(t, err)
+	if len(entries) != 2 || entries[0].ID >= entries[1].ID {
+		t.Fatalf("the outbox is %v, want the creation and the update of 2", entries)
+	}
+	c, u := entries[0], entries[1]
+	if c.Action != "created" || c.Login != "ann" || c.Created != "2019-01-01 00:00:00" || c.Doc.ID != "2" || c.Doc.Name != "a" ||
+		string(c.Doc.JSON) != `{"n":1}` || c.Doc.Version != 1 || c.Doc.Tenant != docsdb.DefaultTenant {
+		t.Errorf("the creation is %+v with %+v", c, c.Doc)
+	}
+	if u.Action != "updated" || u.Doc.Name != "b" || u.Doc.Version != 2 {
+		t.Errorf("the update is %+v with %+v", u, u.Doc)
+	}
+	must(t, s.SetOutboxDelivered(ctx, c.ID, "2019-01-03 00:00:00"))
+	wantNoRows(t, "delivering an unknown entry", s.SetOutboxDelivered(ctx, u.ID+1, "2019-01-03 00:00:00"))
+	entries, err = s.GetOutbox(ctx, 1)
+	must(t, err)
+	if len(entries) != 1 || entries[0].ID != u.ID {
+		t.Errorf("the outbox is %v after the delivery of the creation, want the update", entries)
+	}
+	n, err := s.ClearOutbox(ctx, "2019-01-03 00:00:00")
+	must(t, err)
+	if n != 0 {
+		t.Errorf("%d entries delivered at the time are cleared, want 0", n)
+	}
+	n, err = s.ClearOutbox(ctx, "2019-02-01 00:00:00")
+	must(t, err)
+	if n != 1 {
+		t.Errorf("%d delivered entries are cleared, want 1", n)
+	}
+	entries, err = s.GetOutbox(ctx, -1)
+	must(t, err)
+	if len(entries) != 1 || entries[0].ID != u.ID {
+		t.Errorf("the clearing has left %v, want the update", entries)
+	}
+}
@@ -0,0 +1,830 @@
+package docsdbtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// ErrNotMocked is returned by the methods of a Mock having neither a function nor a Store
+var ErrNotMocked = errors.New("docsdbtest: the method is not mocked")
+
+// Mock is a docsdb.ISQL calling the function of every method if it is set and Store otherwise,
+// the methods with neither fail with ErrNotMocked. It records the names of the methods called,
+// the functions may be set before the Mock is used only
+type Mock struct {
+	Store docsdb.ISQL
+
+	AddActivityFunc         func(context.Context, *docsdb.Activity) error
+	AddAuditFunc            func(context.Context, *docsdb.Audit) error
+	AddGroupFunc            func(context.Context, *docsdb.Group) error
+	AddGroupMemberFunc      func(context.Context, string, string, string) error
+	AddLinkFunc             func(context.Context, *docsdb.Link) error
+	AddRefreshTokenFunc     func(context.Context, *docsdb.RefreshToken) error
+	AddTenantFunc           func(context.Context, *docsdb.Tenant) error
+	AddUsageFunc            func(context.Context, string, *docsdb.Usage) error
+	AddUserFunc             func(context.Context, *docsdb.User) error
+	ClearRevokedTokensFunc  func(context.Context, string) (int64, error)
+	ClearOutboxFunc         func(context.Context, string) (int64, error)
+	ClearRefreshTokensFunc  func(context.Context, string) (int64, error)
+	CountBlobsFunc          func(context.Context, string) (int64, error)
+	ConnectFunc             func() error
+	CreateDocumentFunc      func(context.Context, *docsdb.Doc, []byte) error
+	DeleteBlobFunc          func(context.Context, string) (*docsdb.Blob, error)
+	DeleteDocumentFunc      func(context.Context, string) error
+	DeleteGroupFunc         func(context.Context, string, string) error
+	DeleteGroupMemberFunc   func(context.Context, string, string, string) error
+	DeleteLinkFunc          func(context.Context, *docsdb.Link) error
+	DeleteMetaFunc          func(context.Context, string, string) error
+	DeleteRefreshTokensFunc func(context.Context, string, string) (int64, error)
+	DeleteTenantFunc        func(context.Context, string) error
+	DeleteUserFunc          func(context.Context, string) ([]*docsdb.Doc, error)
+	DisconnectFunc          func()
+	EachDocumentFunc        func(context.Context, *docsdb.Filter, func(*docsdb.Doc) error) error
+	GetActivityFunc         func(context.Context, string, int64, int) ([]*docsdb.Activity, error)
+	GetAuditFunc            func(context.Context, int64, int) ([]*docsdb.Audit, error)
+	GetBlobFunc             func(context.Context, string) (*docsdb.Blob, error)
+	GetBlobsFunc            func(context.Context, string, int) ([]*docsdb.Blob, error)
+	GetDeletionFunc         func(context.Context, string) (*docsdb.Deletion, error)
+	GetDocumentFunc         func(context.Context, string) (*docsdb.Doc, error)
+	GetDocumentsListFunc    func(context.Context, *docsdb.Filter) ([]*docsdb.Doc, error)
+	GetDueDeletionsFunc     func(context.Context, string) ([]*docsdb.Deletion, error)
+	GetExpiredDocumentsFunc func(context.Context, string) ([]*docsdb.Doc, error)
+	GetGroupsFunc           func(context.Context, string) ([]*docsdb.Group, error)
+	GetLinksFunc            func(context.Context, string) ([]*docsdb.Link, error)
+	GetMetaFunc             func(context.Context, string) ([]*docsdb.Meta, error)
+	GetOutboxFunc           func(context.Context, int) ([]*docsdb.Outbox, error)
+	GetPasswordFunc         func(context.Context, string) (string, error)
+	GetRevokedTokensFunc    func(context.Context, string) ([]string, error)
+	SetPasswordFunc         func(context.Context, string, string) error
+	GetTenantsFunc          func(context.Context) ([]*docsdb.Tenant, error)
+	GetTokenGenerationsFunc func(context.Context) (map[string]int64, error)
+	GetUsageFunc            func(context.Context, string, string) (*docsdb.Usage, error)
+	GetUserGroupsFunc       func(context.Context, string) ([]string, error)
+	GetUserTenantFunc       func(context.Context, string) (string, error)
+	IndexContentFunc        func(context.Context, string, string) error
+	InitFunc                func(string, string) error
+	IsAdminFunc             func(context.Context, string) (bool, error)
+	RevokeLoginFunc         func(context.Context, string) (int64, error)
+	RevokeTokenFunc         func(context.Context, string, string) (bool, error)
+	SearchDocumentsFunc     func(context.Context, *docsdb.Filter, string, bool) ([]*docsdb.Hit, error)
+	SetBlobFunc             func(context.Context, *docsdb.Blob) error
+	SetDeletionFunc         func(context.Context, *docsdb.Deletion) error
+	SetExpiryFunc           func(context.Context, string, string) error
+	SetMetaFunc             func(context.Context, string, *docsdb.Meta) error
+	SetOutboxDeliveredFunc  func(context.Context, int64, string) error
+	UpdateDocumentFunc      func(context.Context, *docsdb.Doc, []byte) error
+	UseRefreshTokenFunc     func(context.Context, string) (*docsdb.RefreshToken, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// Calls are the names of the methods called so far in the order they were called
+func (m *Mock) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// Called counts the calls of the method
+func (m *Mock) Called(method string) (n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.calls {
+		if c == method {
+			n++
+		}
+	}
+	return
+}
+
+func (m *Mock) record(method string) {
+	m.mu.Lock()
+	m.calls = append(m.calls, method)
+	m.mu.Unlock()
+}
+
+// AddActivity calls AddActivityFunc or Store
+func (m *Mock) AddActivity(ctx context.Context, a *docsdb.Activity) error {
+	m.record("AddActivity")
+	if m.AddActivityFunc != nil {
+		return m.AddActivityFunc(ctx, a)
+	}
+	if m.Store != nil {
+		return m.Store.AddActivity(ctx, a)
+	}
+	return ErrNotMocked
+}
+
+// AddAudit calls AddAuditFunc or Store
+func (m *Mock) AddAudit(ctx context.Context, a *docsdb.Audit) error {
+	m.record("AddAudit")
+	if m.AddAuditFunc != nil {
+		return m.AddAuditFunc(ctx, a)
+	}
+	if m.Store != nil {
+		return m.Store.AddAudit(ctx, a)
+	}
+	return ErrNotMocked
+}
+
+// AddGroup calls AddGroupFunc or Store
+func (m *Mock) AddGroup(ctx context.Context, g *docsdb.Group) error {
+	m.record("AddGroup")
+	if m.AddGroupFunc != nil {
+		return m.AddGroupFunc(ctx, g)
+	}
+	if m.Store != nil {
+		return m.Store.AddGroup(ctx, g)
+	}
+	return ErrNotMocked
+}
+
+// AddGroupMember calls AddGroupMemberFunc or Store
+func (m *Mock) AddGroupMember(ctx context.Context, tenant string, group string, login string) error {
+	m.record("AddGroupMember")
+	if m.AddGroupMemberFunc != nil {
+		return m.AddGroupMemberFunc(ctx, tenant, group, login)
+	}
+	if m.Store != nil {
+		return m.Store.AddGroupMember(ctx, tenant, group, login)
+	}
+	return ErrNotMocked
+}
+
+// AddLink calls AddLinkFunc or Store
+func (m *Mock) AddLink(ctx context.Context, l *docsdb.Link) error {
+	m.record("AddLink")
+	if m.AddLinkFunc != nil {
+		return m.AddLinkFunc(ctx, l)
+	}
+	if m.Store != nil {
+		return m.Store.AddLink(ctx, l)
+	}
+	return ErrNotMocked
+}
+
+// AddRefreshToken calls AddRefreshTokenFunc or Store
+func (m *Mock) AddRefreshToken(ctx context.Context, token *docsdb.RefreshToken) error {
+	m.record("AddRefreshToken")
+	if m.AddRefreshTokenFunc != nil {
+		return m.AddRefreshTokenFunc(ctx, token)
+	}
+	if m.Store != nil {
+		return m.Store.AddRefreshToken(ctx, token)
+	}
+	return ErrNotMocked
+}
+
+// AddTenant calls AddTenantFunc or Store
+func (m *Mock) AddTenant(ctx context.Context, t *docsdb.Tenant) error {
+	m.record("AddTenant")
+	if m.AddTenantFunc != nil {
+		return m.AddTenantFunc(ctx, t)
+	}
+	if m.Store != nil {
+		return m.Store.AddTenant(ctx, t)
+	}
+	return ErrNotMocked
+}
+
+// AddUsage calls AddUsageFunc or Store
+func (m *Mock) AddUsage(ctx context.Context, login string, u *docsdb.Usage) error {
+	m.record("AddUsage")
+	if m.AddUsageFunc != nil {
+		return m.AddUsageFunc(ctx, login, u)
+	}
+	if m.Store != nil {
+		return m.Store.AddUsage(ctx, login, u)
+	}
+	return ErrNotMocked
+}
+
+// AddUser calls AddUserFunc or Store
+func (m *Mock) AddUser(ctx context.Context, user *docsdb.User) error {
+	m.record("AddUser")
+	if m.AddUserFunc != nil {
+		return m.AddUserFunc(ctx, user)
+	}
+	if m.Store != nil {
+		return m.Store.AddUser(ctx, user)
+	}
+	return ErrNotMocked
+}
+
+// ClearRevokedTokens calls ClearRevokedTokensFunc or Store
+func (m *Mock) ClearRevokedTokens(ctx context.Context, before string) (int64, error) {
+	m.record("ClearRevokedTokens")
+	if m.ClearRevokedTokensFunc != nil {
+		return m.ClearRevokedTokensFunc(ctx, before)
+	}
+	if m.Store != nil {
+		return m.Store.ClearRevokedTokens(ctx, before)
+	}
+	return 0, ErrNotMocked
+}
+
+// ClearOutbox calls ClearOutboxFunc or Store
+func (m *Mock) ClearOutbox(ctx context.Context, before string) (int64, error) {
+	m.record("ClearOutbox")
+	if m.ClearOutboxFunc != nil {
+		return m.ClearOutboxFunc(ctx, before)
+	}
+	if m.Store != nil {
+		return m.Store.ClearOutbox(ctx, before)
+	}
+	return 0, ErrNotMocked
+}
+
+// ClearRefreshTokens calls ClearRefreshTokensFunc or Store
+func (m *Mock) ClearRefreshTokens(ctx context.Context, before string) (int64, error) {
+	m.record("ClearRefreshTokens")
+	if m.ClearRefreshTokensFunc != nil {
+		return m.ClearRefreshTokensFunc(ctx, before)
+	}
+	if m.Store != nil {
+		return m.Store.ClearRefreshTokens(ctx, before)
+	}
+	return 0, ErrNotMocked
+}
+
+// CountBlobs calls CountBlobsFunc or Store
+func (m *Mock) CountBlobs(ctx context.Context, hash string) (int64, error) {
+	m.record("CountBlobs")
+	if m.CountBlobsFunc != nil {
+		return m.CountBlobsFunc(ctx, hash)
+	}
+	if m.Store != nil {
+		return m.Store.CountBlobs(ctx, hash)
+	}
+	return 0, ErrNotMocked
+}
+
+// Connect calls ConnectFunc or Store
+func (m *Mock) Connect() error {
+	m.record("Connect")
+	if m.ConnectFunc != nil {
+		return m.ConnectFunc()
+	}
+	if m.Store != nil {
+		return m.Store.Connect()
+	}
+	return ErrNotMocked
+}
+
+// CreateDocument calls CreateDocumentFunc or Store
+func (m *Mock) CreateDocument(ctx context.Context, d *docsdb.Doc, JSON []byte) error {
+	m.record("CreateDocument")
+	if m.CreateDocumentFunc != nil {
+		return m.CreateDocumentFunc(ctx, d, JSON)
+	}
+	if m.Store != nil {
+		return m.Store.CreateDocument(ctx, d, JSON)
+	}
+	return ErrNotMocked
+}
+
+// DeleteBlob calls DeleteBlobFunc or Store
+func (m *Mock) DeleteBlob(ctx context.Context, name string) (*docsdb.Blob, error) {
+	m.record("DeleteBlob")
+	if m.DeleteBlobFunc != nil {
+		return m.DeleteBlobFunc(ctx, name)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteBlob(ctx, name)
+	}
+	return nil, ErrNotMocked
+}
+
+// DeleteDocument calls DeleteDocumentFunc or Store
+func (m *Mock) DeleteDocument(ctx context.Context, id string) error {
+	m.record("DeleteDocument")
+	if m.DeleteDocumentFunc != nil {
+		return m.DeleteDocumentFunc(ctx, id)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteDocument(ctx, id)
+	}
+	return ErrNotMocked
+}
+
+// DeleteGroup calls DeleteGroupFunc or Store
+func (m *Mock) DeleteGroup(ctx context.Context, tenant string, name string) error {
+	m.record("DeleteGroup")
+	if m.DeleteGroupFunc != nil {
+		return m.DeleteGroupFunc(ctx, tenant, name)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteGroup(ctx, tenant, name)
+	}
+	return ErrNotMocked
+}
+
+// DeleteGroupMember calls DeleteGroupMemberFunc or Store
+func (m *Mock) DeleteGroupMember(ctx context.Context, tenant string, group string, login string) error {
+	m.record("DeleteGroupMember")
+	if m.DeleteGroupMemberFunc != nil {
+		return m.DeleteGroupMemberFunc(ctx, tenant, group, login)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteGroupMember(ctx, tenant, group, login)
+	}
+	return ErrNotMocked
+}
+
+// DeleteLink calls DeleteLinkFunc or Store
+func (m *Mock) DeleteLink(ctx context.Context, l *docsdb.Link) error {
+	m.record("DeleteLink")
+	if m.DeleteLinkFunc != nil {
+		return m.DeleteLinkFunc(ctx, l)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteLink(ctx, l)
+	}
+	return ErrNotMocked
+}
+
+// DeleteMeta calls DeleteMetaFunc or Store
+func (m *Mock) DeleteMeta(ctx context.Context, id string, key string) error {
+	m.record("DeleteMeta")
+	if m.DeleteMetaFunc != nil {
+		return m.DeleteMetaFunc(ctx, id, key)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteMeta(ctx, id, key)
+	}
+	return ErrNotMocked
+}
+
+// DeleteRefreshTokens calls DeleteRefreshTokensFunc or Store
+func (m *Mock) DeleteRefreshTokens(ctx context.Context, login string, family string) (int64, error) {
+	m.record("DeleteRefreshTokens")
+	if m.DeleteRefreshTokensFunc != nil {
+		return m.DeleteRefreshTokensFunc(ctx, login, family)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteRefreshTokens(ctx, login, family)
+	}
+	return 0, ErrNotMocked
+}
+
+// DeleteTenant calls DeleteTenantFunc or Store
+func (m *Mock) DeleteTenant(ctx context.Context, name string) error {
+	m.record("DeleteTenant")
+	if m.DeleteTenantFunc != nil {
+		return m.DeleteTenantFunc(ctx, name)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteTenant(ctx, name)
+	}
+	return ErrNotMocked
+}
+
+// DeleteUser calls DeleteUserFunc or Store
+func (m *Mock) DeleteUser(ctx context.Context, login string) ([]*docsdb.Doc, error) {
+	m.record("DeleteUser")
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.DeleteUser(ctx, login)
+	}
+	return nil, ErrNotMocked
+}
+
+// Disconnect calls DisconnectFunc or Store
+func (m *Mock) Disconnect() {
+	m.record("Disconnect")
+	if m.DisconnectFunc != nil {
+		m.DisconnectFunc()
+		return
+	}
+	if m.Store != nil {
+		m.Store.Disconnect()
+	}
+}
+
+// EachDocument calls EachDocumentFunc or Store
+func (m *Mock) EachDocument(ctx context.Context, filter *docsdb.Filter, fn func(*docsdb.Doc) error) error {
+	m.record("EachDocument")
+	if m.EachDocumentFunc != nil {
+		return m.EachDocumentFunc(ctx, filter, fn)
+	}
+	if m.Store != nil {
+		return m.Store.EachDocument(ctx, filter, fn)
+	}
+	return ErrNotMocked
+}
+
+// GetActivity calls GetActivityFunc or Store
+func (m *Mock) GetActivity(ctx context.Context, id string, after int64, limit int) ([]*docsdb.Activity, error) {
+	m.record("GetActivity")
+	if m.GetActivityFunc != nil {
+		return m.GetActivityFunc(ctx, id, after, limit)
+	}
+	if m.Store != nil {
+		return m.Store.GetActivity(ctx, id, after, limit)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetAudit calls GetAuditFunc or Store
+func (m *Mock) GetAudit(ctx context.Context, after int64, limit int) ([]*docsdb.Audit, error) {
+	m.record("GetAudit")
+	if m.GetAuditFunc != nil {
+		return m.GetAuditFunc(ctx, after, limit)
+	}
+	if m.Store != nil {
+		return m.Store.GetAudit(ctx, after, limit)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetBlob calls GetBlobFunc or Store
+func (m *Mock) GetBlob(ctx context.Context, name string) (*docsdb.Blob, error) {
+	m.record("GetBlob")
+	if m.GetBlobFunc != nil {
+		return m.GetBlobFunc(ctx, name)
+	}
+	if m.Store != nil {
+		return m.Store.GetBlob(ctx, name)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetBlobs calls GetBlobsFunc or Store
+func (m *Mock) GetBlobs(ctx context.Context, after string, limit int) ([]*docsdb.Blob, error) {
+	m.record("GetBlobs")
+	if m.GetBlobsFunc != nil {
+		return m.GetBlobsFunc(ctx, after, limit)
+	}
+	if m.Store != nil {
+		return m.Store.GetBlobs(ctx, after, limit)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetDeletion calls GetDeletionFunc or Store
+func (m *Mock) GetDeletion(ctx context.Context, login string) (*docsdb.Deletion, error) {
+	m.record("GetDeletion")
+	if m.GetDeletionFunc != nil {
+		return m.GetDeletionFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.GetDeletion(ctx, login)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetDocument calls GetDocumentFunc or Store
+func (m *Mock) GetDocument(ctx context.Context, id string) (*docsdb.Doc, error) {
+	m.record("GetDocument")
+	if m.GetDocumentFunc != nil {
+		return m.GetDocumentFunc(ctx, id)
+	}
+	if m.Store != nil {
+		return m.Store.GetDocument(ctx, id)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetDocumentsList calls GetDocumentsListFunc or Store
+func (m *Mock) GetDocumentsList(ctx context.Context, filter *docsdb.Filter) ([]*docsdb.Doc, error) {
+	m.record("GetDocumentsList")
+	if m.GetDocumentsListFunc != nil {
+		return m.GetDocumentsListFunc(ctx, filter)
+	}
+	if m.Store != nil {
+		return m.Store.GetDocumentsList(ctx, filter)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetDueDeletions calls GetDueDeletionsFunc or Store
+func (m *Mock) GetDueDeletions(ctx context.Context, before string) ([]*docsdb.Deletion, error) {
+	m.record("GetDueDeletions")
+	if m.GetDueDeletionsFunc != nil {
+		return m.GetDueDeletionsFunc(ctx, before)
+	}
+	if m.Store != nil {
+		return m.Store.GetDueDeletions(ctx, before)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetExpiredDocuments calls GetExpiredDocumentsFunc or Store
+func (m *Mock) GetExpiredDocuments(ctx context.Context, before string) ([]*docsdb.Doc, error) {
+	m.record("GetExpiredDocuments")
+	if m.GetExpiredDocumentsFunc != nil {
+		return m.GetExpiredDocumentsFunc(ctx, before)
+	}
+	if m.Store != nil {
+		return m.Store.GetExpiredDocuments(ctx, before)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetGroups calls GetGroupsFunc or Store
+func (m *Mock) GetGroups(ctx context.Context, tenant string) ([]*docsdb.Group, error) {
+	m.record("GetGroups")
+	if m.GetGroupsFunc != nil {
+		return m.GetGroupsFunc(ctx, tenant)
+	}
+	if m.Store != nil {
+		return m.Store.GetGroups(ctx, tenant)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetLinks calls GetLinksFunc or Store
+func (m *Mock) GetLinks(ctx context.Context, id string) ([]*docsdb.Link, error) {
+	m.record("GetLinks")
+	if m.GetLinksFunc != nil {
+		return m.GetLinksFunc(ctx, id)
+	}
+	if m.Store != nil {
+		return m.Store.GetLinks(ctx, id)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetMeta calls GetMetaFunc or Store
+func (m *Mock) GetMeta(ctx context.Context, id string) ([]*docsdb.Meta, error) {
+	m.record("GetMeta")
+	if m.GetMetaFunc != nil {
+		return m.GetMetaFunc(ctx, id)
+	}
+	if m.Store != nil {
+		return m.Store.GetMeta(ctx, id)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetOutbox calls GetOutboxFunc or Store
+func (m *Mock) GetOutbox(ctx context.Context, limit int) ([]*docsdb.Outbox, error) {
+	m.record("GetOutbox")
+	if m.GetOutboxFunc != nil {
+		return m.GetOutboxFunc(ctx, limit)
+	}
+	if m.Store != nil {
+		return m.Store.GetOutbox(ctx, limit)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetPassword calls GetPasswordFunc or Store
+func (m *Mock) GetPassword(ctx context.Context, login string) (string, error) {
+	m.record("GetPassword")
+	if m.GetPasswordFunc != nil {
+		return m.GetPasswordFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.GetPassword(ctx, login)
+	}
+	return "", ErrNotMocked
+}
+
+// GetRevokedTokens calls GetRevokedTokensFunc or Store
+func (m *Mock) GetRevokedTokens(ctx context.Context, after string) ([]string, error) {
+	m.record("GetRevokedTokens")
+	if m.GetRevokedTokensFunc != nil {
+		return m.GetRevokedTokensFunc(ctx, after)
+	}
+	if m.Store != nil {
+		return m.Store.GetRevokedTokens(ctx, after)
+	}
+	return nil, ErrNotMocked
+}
+
+// SetPassword calls SetPasswordFunc or Store
+func (m *Mock) SetPassword(ctx context.Context, login string, password string) error {
+	m.record("SetPassword")
+	if m.SetPasswordFunc != nil {
+		return m.SetPasswordFunc(ctx, login, password)
+	}
+	if m.Store != nil {
+		return m.Store.SetPassword(ctx, login, password)
+	}
+	return ErrNotMocked
+}
+
+// GetTenants calls GetTenantsFunc or Store
+func (m *Mock) GetTenants(ctx context.Context) ([]*docsdb.Tenant, error) {
+	m.record("GetTenants")
+	if m.GetTenantsFunc != nil {
+		return m.GetTenantsFunc(ctx)
+	}
+	if m.Store != nil {
+		return m.Store.GetTenants(ctx)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetTokenGenerations calls GetTokenGenerationsFunc or Store
+func (m *Mock) GetTokenGenerations(ctx context.Context) (map[string]int64, error) {
+	m.record("GetTokenGenerations")
+	if m.GetTokenGenerationsFunc != nil {
+		return m.GetTokenGenerationsFunc(ctx)
+	}
+	if m.Store != nil {
+		return m.Store.GetTokenGenerations(ctx)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetUsage calls GetUsageFunc or Store
+func (m *Mock) GetUsage(ctx context.Context, login string, period string) (*docsdb.Usage, error) {
+	m.record("GetUsage")
+	if m.GetUsageFunc != nil {
+		return m.GetUsageFunc(ctx, login, period)
+	}
+	if m.Store != nil {
+		return m.Store.GetUsage(ctx, login, period)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetUserGroups calls GetUserGroupsFunc or Store
+func (m *Mock) GetUserGroups(ctx context.Context, login string) ([]string, error) {
+	m.record("GetUserGroups")
+	if m.GetUserGroupsFunc != nil {
+		return m.GetUserGroupsFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.GetUserGroups(ctx, login)
+	}
+	return nil, ErrNotMocked
+}
+
+// GetUserTenant calls GetUserTenantFunc or Store
+func (m *Mock) GetUserTenant(ctx context.Context, login string) (string, error) {
+	m.record("GetUserTenant")
+	if m.GetUserTenantFunc != nil {
+		return m.GetUserTenantFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.GetUserTenant(ctx, login)
+	}
+	return "", ErrNotMocked
+}
+
+// IndexContent calls IndexContentFunc or Store
+func (m *Mock) IndexContent(ctx context.Context, id string, content string) error {
+	m.record("IndexContent")
+	if m.IndexContentFunc != nil {
+		return m.IndexContentFunc(ctx, id, content)
+	}
+	if m.Store != nil {
+		return m.Store.IndexContent(ctx, id, content)
+	}
+	return ErrNotMocked
+}
+
+// Init calls InitFunc or Store
+func (m *Mock) Init(driver string, path string) error {
+	m.record("Init")
+	if m.InitFunc != nil {
+		return m.InitFunc(driver, path)
+	}
+	if m.Store != nil {
+		return m.Store.Init(driver, path)
+	}
+	return ErrNotMocked
+}
+
+// IsAdmin calls IsAdminFunc or Store
+func (m *Mock) IsAdmin(ctx context.Context, login string) (bool, error) {
+	m.record("IsAdmin")
+	if m.IsAdminFunc != nil {
+		return m.IsAdminFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.IsAdmin(ctx, login)
+	}
+	return false, ErrNotMocked
+}
+
+// RevokeLogin calls RevokeLoginFunc or Store
+func (m *Mock) RevokeLogin(ctx context.Context, login string) (int64, error) {
+	m.record("RevokeLogin")
+	if m.RevokeLoginFunc != nil {
+		return m.RevokeLoginFunc(ctx, login)
+	}
+	if m.Store != nil {
+		return m.Store.RevokeLogin(ctx, login)
+	}
+	return 0, ErrNotMocked
+}
+
+// RevokeToken calls RevokeTokenFunc or Store
+func (m *Mock) RevokeToken(ctx context.Context, id string, expiresAt string) (bool, error) {
+	m.record("RevokeToken")
+	if m.RevokeTokenFunc != nil {
+		return m.RevokeTokenFunc(ctx, id, expiresAt)
+	}
+	if m.Store != nil {
+		return m.Store.RevokeToken(ctx, id, expiresAt)
+	}
+	return false, ErrNotMocked
+}
+
+// SearchDocuments calls SearchDocumentsFunc or Store
+func (m *Mock) SearchDocuments(ctx context.Context, filter *docsdb.Filter, query string, content bool) ([]*docsdb.Hit, error) {
+	m.record("SearchDocuments")
+	if m.SearchDocumentsFunc != nil {
+		return m.SearchDocumentsFunc(ctx, filter, query, content)
+	}
+	if m.Store != nil {
+		return m.Store.SearchDocuments(ctx, filter, query, content)
+	}
+	return nil, ErrNotMocked
+}
+
+// SetBlob calls SetBlobFunc or Store
+func (m *Mock) SetBlob(ctx context.Context, blob *docsdb.Blob) error {
+	m.record("SetBlob")
+	if m.SetBlobFunc != nil {
+		return m.SetBlobFunc(ctx, blob)
+	}
+	if m.Store != nil {
+		return m.Store.SetBlob(ctx, blob)
+	}
+	return ErrNotMocked
+}
+
+// SetDeletion calls SetDeletionFunc or Store
+func (m *Mock) SetDeletion(ctx context.Context, d *docsdb.Deletion) error {
+	m.record("SetDeletion")
+	if m.SetDeletionFunc != nil {
+		return m.SetDeletionFunc(ctx, d)
+	}
+	if m.Store != nil {
+		return m.Store.SetDeletion(ctx, d)
+	}
+	return ErrNotMocked
+}
+
+// SetExpiry calls SetExpiryFunc or Store
+func (m *Mock) SetExpiry(ctx context.Context, id string, expiresAt string) error {
+	m.record("SetExpiry")
+	if m.SetExpiryFunc != nil {
+		return m.SetExpiryFunc(ctx, id, expiresAt)
+	}
+	if m.Store != nil {
+		return m.Store.SetExpiry(ctx, id, expiresAt)
+	}
+	return ErrNotMocked
+}
+
+// SetMeta calls SetMetaFunc or Store
+func (m *Mock) SetMeta(ctx context.Context, id string, meta *docsdb.Meta) error {
+	m.record("SetMeta")
+	if m.SetMetaFunc != nil {
+		return m.SetMetaFunc(ctx, id, meta)
+	}
+	if m.Store != nil {
+		return m.Store.SetMeta(ctx, id, meta)
+	}
+	return ErrNotMocked
+}
+
+// SetOutboxDelivered calls SetOutboxDeliveredFunc or Store
+func (m *Mock) SetOutboxDelivered(ctx context.Context, id int64, at string) error {
+	m.record("SetOutboxDelivered")
+	if m.SetOutboxDeliveredFunc != nil {
+		return m.SetOutboxDeliveredFunc(ctx, id, at)
+	}
+	if m.Store != nil {
+		return m.Store.SetOutboxDelivered(ctx, id, at)
+	}
+	return ErrNotMocked
+}
+
+// UpdateDocument calls UpdateDocumentFunc or Store
+func (m *Mock) UpdateDocument(ctx context.Context, d *docsdb.Doc, JSON []byte) error {
+	m.record("UpdateDocument")
+	if m.UpdateDocumentFunc != nil {
+		return m.UpdateDocumentFunc(ctx, d, JSON)
+	}
+	if m.Store != nil {
+		return m.Store.UpdateDocument(ctx, d, JSON)
+	}
+	return ErrNotMocked
+}
+
+// UseRefreshToken calls UseRefreshTokenFunc or Store
+func (m *Mock) UseRefreshToken(ctx context.Context, hash string) (*docsdb.RefreshToken, error) {
+	m.record("UseRefreshToken")
+	if m.UseRefreshTokenFunc != nil {
+		return m.UseRefreshTokenFunc(ctx, hash)
+	}
+	if m.Store != nil {
+		return m.Store.UseRefreshToken(ctx, hash)
+	}
+	return nil, ErrNotMocked
+}
+
+var _ docsdb.ISQL = (*Mock)(nil)
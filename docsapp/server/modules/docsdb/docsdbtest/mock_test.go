@@ -0,0 +1,40 @@
+package docsdbtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/docsdbtest"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestMockOfAStoreKeepsTheContract(t *testing.T) {
+	docsdbtest.Run(t, func(t *testing.T) docsdb.ISQL {
+		return &docsdbtest.Mock{Store: inmem.New()}
+	})
+}
+
+func TestMockCallsTheFunctions(t *testing.T) {
+	ctx := context.Background()
+	m := &docsdbtest.Mock{
+		GetPasswordFunc: func(ctx context.Context, login string) (string, error) {
+			return "secret", nil
+		},
+	}
+	password, err := m.GetPassword(ctx, "ann")
+	if err != nil || password != "secret" {
+		t.Errorf("GetPassword: %q, %v, want secret", password, err)
+	}
+	_, err = m.IsAdmin(ctx, "ann")
+	if err != docsdbtest.ErrNotMocked {
+		t.Errorf("IsAdmin: %v, want ErrNotMocked", err)
+	}
+	m.GetPassword(ctx, "bob")
+	if n := m.Called("GetPassword"); n != 2 {
+		t.Errorf("GetPassword is called %d times, want 2", n)
+	}
+	if calls := m.Calls(); len(calls) != 3 || calls[1] != "IsAdmin" {
+		t.Errorf("the calls are %v, want GetPassword, IsAdmin, GetPassword", calls)
+	}
+}
@@ -0,0 +1,56 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SetExpiry sets the time the document with id is gone at, "" is never. sql.ErrNoRows if there is no document
+func (h *Handler) SetExpiry(ctx context.Context, id string, expiresAt string) (err error) {
+	res, err := h.stmtSetExpiry.ExecContext(ctx, expiresAt, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// GetExpiredDocuments finds the documents expired by before, the earliest first, without their grants.
+// The DocumentExpires index keeps it from reading the documents which never expire
+func (h *Handler) GetExpiredDocuments(ctx context.Context, before string) (docs []*Doc, err error) {
+	rows, err := h.stmtGetExpired.QueryContext(ctx, before)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &Doc{}
+		err = rows.Scan(&d.ID, &d.Name, &d.Mime, &d.File, &d.Visibility, &d.Created, &d.ExpiresAt, &d.Tenant)
+		if err != nil {
+			return
+		}
+		d.ResolveVisibility()
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// prepareExpiry prepares the statements of the expiry
+func (h *Handler) prepareExpiry() (err error) {
+	h.stmtSetExpiry, err = h.db.Prepare(`UPDATE Document SET expires_at=? WHERE id=?`)
+	if err != nil {
+		return
+	}
+	h.stmtGetExpired, err = h.db.Prepare(`
+	SELECT d.id, d.name, d.mime, d.file, d.visibility, d.created, d.expires_at, t.name
+	FROM Document as d INNER JOIN Tenant as t USING(tid)
+	WHERE d.expires_at<>'' AND d.expires_at<=?
+	ORDER BY d.expires_at`)
+	return
+}
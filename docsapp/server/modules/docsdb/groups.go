@@ -0,0 +1,150 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Group is the model of the database table UserGroup: users of a tenant the documents of the tenant
+// are granted to at once. Members are the logins of the group, GetGroups finds them
+type Group struct {
+	Name    string   `json:"name" xml:"name"`
+	Tenant  string   `json:"tenant" xml:"tenant"`
+	Created string   `json:"created" xml:"created"`
+	Members []string `json:"members" xml:"member"`
+}
+
+// AddGroup inserts into UserGroup name and created of the tenant, which is to exist
+func (h *Handler) AddGroup(ctx context.Context, g *Group) (err error) {
+	_, err = h.stmtInsGroup.ExecContext(ctx, g.Name, g.Created, tenantOf(g.Tenant))
+	return
+}
+
+// DeleteGroup deletes the group of the tenant with its members and its grants, sql.ErrNoRows if there is none
+func (h *Handler) DeleteGroup(ctx context.Context, tenant string, name string) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var gid int
+	err = tx.Stmt(h.stmtGetGroupID).QueryRowContext(ctx, name, tenantOf(tenant)).Scan(&gid)
+	if err != nil {
+		return
+	}
+	for _, stmt := range []*sql.Stmt{h.stmtDeleteGroupMembersGID, h.stmtDeleteGroupGrantsGID, h.stmtDeleteGroup} {
+		_, err = tx.Stmt(stmt).ExecContext(ctx, gid)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// GetGroups finds the groups of the tenant ordered by name with their members
+func (h *Handler) GetGroups(ctx context.Context, tenant string) (groups []*Group, err error) {
+	rows, err := h.stmtGetGroups.QueryContext(ctx, tenantOf(tenant))
+	if err != nil {
+		return
+	}
+	var gids []int
+	for rows.Next() {
+		var gid int
+		g := &Group{Tenant: tenantOf(tenant)}
+		err = rows.Scan(&gid, &g.Name, &g.Created)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		gids = append(gids, gid)
+		groups = append(groups, g)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+	for i, g := range groups {
+		g.Members, err = h.column(ctx, h.stmtGetGroupMembers, gids[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// AddGroupMember adds login to the group of the tenant, sql.ErrNoRows if there is no such group
+// or no such user in the tenant
+func (h *Handler) AddGroupMember(ctx context.Context, tenant string, group string, login string) (err error) {
+	var gid, uid int
+	err = h.stmtGetGroupID.QueryRowContext(ctx, group, tenantOf(tenant)).Scan(&gid)
+	if err != nil {
+		return
+	}
+	err = h.stmtGetUserUID.QueryRowContext(ctx, login, tenantOf(tenant)).Scan(&uid)
+	if err != nil {
+		return
+	}
+	_, err = h.stmtInsGroupMember.ExecContext(ctx, gid, uid)
+	return
+}
+
+// DeleteGroupMember removes login from the group of the tenant, sql.ErrNoRows if it is not a member
+func (h *Handler) DeleteGroupMember(ctx context.Context, tenant string, group string, login string) (err error) {
+	var gid int
+	err = h.stmtGetGroupID.QueryRowContext(ctx, group, tenantOf(tenant)).Scan(&gid)
+	if err != nil {
+		return
+	}
+	res, err := h.stmtDeleteGroupMember.ExecContext(ctx, gid, login)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// GetUserGroups finds the names of the groups of login ordered by name
+func (h *Handler) GetUserGroups(ctx context.Context, login string) (groups []string, err error) {
+	return h.column(ctx, h.stmtGetUserGroups, login)
+}
+
+// grantGroups grants the document with docID to the groups of the tenant, sql.ErrNoRows if one is not there
+func (h *Handler) grantGroups(ctx context.Context, tx *sql.Tx, docID int64, tenant string, groups []string) (err error) {
+	for _, name := range groups {
+		var gid int
+		err = tx.Stmt(h.stmtGetGroupID).QueryRowContext(ctx, name, tenantOf(tenant)).Scan(&gid)
+		if err != nil {
+			return
+		}
+		_, err = tx.Stmt(h.stmtInsGroupGrant).ExecContext(ctx, docID, gid)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// column finds the strings stmt selects with args
+func (h *Handler) column(ctx context.Context, stmt *sql.Stmt, args ...interface{}) (values []string, err error) {
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		err = rows.Scan(&v)
+		if err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
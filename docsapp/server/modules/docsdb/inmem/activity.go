@@ -0,0 +1,38 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// AddActivity adds the entry to the activity of its document and sets its ID, sql.ErrNoRows if there is no document
+func (s *Store) AddActivity(ctx context.Context, a *docsdb.Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[a.Doc] == nil {
+		return sql.ErrNoRows
+	}
+	s.lastActivity++
+	a.ID = s.lastActivity
+	s.activity[a.Doc] = append(s.activity[a.Doc], *a)
+	return nil
+}
+
+// GetActivity finds up to limit entries of the activity of the document with id added after the one with after,
+// the earliest first. A negative limit is no limit
+func (s *Store) GetActivity(ctx context.Context, id string, after int64, limit int) (activity []*docsdb.Activity, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.activity[id] {
+		if limit >= 0 && len(activity) == limit {
+			break
+		}
+		if a.ID > after {
+			c := a
+			activity = append(activity, &c)
+		}
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// AddAudit adds the entry to the audit log and sets its ID
+func (s *Store) AddAudit(ctx context.Context, a *docsdb.Audit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.ID = int64(len(s.audit)) + 1
+	s.audit = append(s.audit, *a)
+	return nil
+}
+
+// GetAudit finds up to limit entries of the audit log added after the one with after, the earliest first.
+// A negative limit is no limit
+func (s *Store) GetAudit(ctx context.Context, after int64, limit int) (audit []*docsdb.Audit, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.audit {
+		if limit >= 0 && len(audit) == limit {
+			break
+		}
+		if a.ID > after {
+			c := a
+			audit = append(audit, &c)
+		}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// SetBlob maps the name of blob to its content, the content it had before is replaced
+func (s *Store) SetBlob(ctx context.Context, blob *docsdb.Blob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[blob.Name] = *blob
+	for _, d := range s.docs {
+		if d.File && d.Name == blob.Name {
+			d.Size, d.Hash = blob.Size, blob.Hash
+		}
+	}
+	return nil
+}
+
+// fileOf is the size and the hash of the content of the file of d, 0 and "" if it is not a file or is not mapped, s is locked
+func (s *Store) fileOf(d *docsdb.Doc) (int64, string) {
+	b, ok := s.blobs[d.Name]
+	if !d.File || !ok {
+		return 0, ""
+	}
+	return b.Size, b.Hash
+}
+
+// GetBlob finds the content of the file of name, sql.ErrNoRows if it is not mapped
+func (s *Store) GetBlob(ctx context.Context, name string) (*docsdb.Blob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &b, nil
+}
+
+// GetBlobs finds up to limit mappings ordered by the names after the one of after, a negative limit is no limit
+func (s *Store) GetBlobs(ctx context.Context, after string, limit int) ([]*docsdb.Blob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var blobs []*docsdb.Blob
+	for name, b := range s.blobs {
+		if name > after {
+			b := b
+			blobs = append(blobs, &b)
+		}
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Name < blobs[j].Name })
+	if limit >= 0 && len(blobs) > limit {
+		blobs = blobs[:limit]
+	}
+	return blobs, nil
+}
+
+// CountBlobs counts the names mapped to the content of hash
+func (s *Store) CountBlobs(ctx context.Context, hash string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int64
+	for _, b := range s.blobs {
+		if b.Hash == hash {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DeleteBlob drops the mapping of name and answers what it was, sql.ErrNoRows if it is not mapped
+func (s *Store) DeleteBlob(ctx context.Context, name string) (*docsdb.Blob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blobs[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(s.blobs, name)
+	return &b, nil
+}
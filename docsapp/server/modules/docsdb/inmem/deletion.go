@@ -0,0 +1,81 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// SetDeletion sets the deletion of the account of d.Login, sql.ErrNoRows if there is no such user
+func (s *Store) SetDeletion(ctx context.Context, d *docsdb.Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users[d.Login] == nil {
+		return sql.ErrNoRows
+	}
+	s.deletions[d.Login] = docsdb.Deletion{Code: d.Code, At: d.At}
+	return nil
+}
+
+// GetDeletion finds the deletion of the account of login, sql.ErrNoRows if there is no such user
+func (s *Store) GetDeletion(ctx context.Context, login string) (*docsdb.Deletion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.users[login] == nil {
+		return nil, sql.ErrNoRows
+	}
+	d := s.deletions[login]
+	d.Login = login
+	return &d, nil
+}
+
+// GetDueDeletions finds the confirmed deletions due by before, the earliest first
+func (s *Store) GetDueDeletions(ctx context.Context, before string) (deletions []*docsdb.Deletion, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for login, d := range s.deletions {
+		if d.At != "" && d.At <= before {
+			d.Login = login
+			c := d
+			deletions = append(deletions, &c)
+		}
+	}
+	sort.Slice(deletions, func(i, j int) bool { return deletions[i].At < deletions[j].At })
+	return
+}
+
+// DeleteUser deletes the user with its grants, its group memberships and its usage,
+// and the documents granted to nobody else, which it answers without their grants for their files to be removed.
+// sql.ErrNoRows if there is no such user
+func (s *Store) DeleteUser(ctx context.Context, login string) (docs []*docsdb.Doc, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users[login] == nil {
+		return nil, sql.ErrNoRows
+	}
+	for id, d := range s.docs {
+		if len(d.Grant) == 1 && d.Grant[0] == login && len(d.Groups) == 0 {
+			c := copyDoc(d)
+			c.Grant, c.Groups = nil, nil
+			docs = append(docs, c)
+			s.deleteDoc(id)
+			continue
+		}
+		for i, v := range d.Grant {
+			if v == login {
+				d.Grant = append(d.Grant[:i:i], d.Grant[i+1:]...)
+				break
+			}
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	for _, g := range s.groups {
+		delete(g.members, login)
+	}
+	delete(s.usage, login)
+	delete(s.deletions, login)
+	delete(s.users, login)
+	return docs, nil
+}
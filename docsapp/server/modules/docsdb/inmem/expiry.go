@@ -0,0 +1,36 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// SetExpiry sets the time the document with id is gone at, sql.ErrNoRows if there is no such document
+func (s *Store) SetExpiry(ctx context.Context, id string, expiresAt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.docs[id]
+	if d == nil {
+		return sql.ErrNoRows
+	}
+	d.ExpiresAt = expiresAt
+	return nil
+}
+
+// GetExpiredDocuments finds the documents expired by before, the earliest first, without their grants
+func (s *Store) GetExpiredDocuments(ctx context.Context, before string) (docs []*docsdb.Doc, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, d := range s.docs {
+		if d.ExpiresAt != "" && d.ExpiresAt <= before {
+			c := copyDoc(d)
+			c.Grant, c.Groups, c.JSON = nil, nil, nil
+			docs = append(docs, c)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ExpiresAt < docs[j].ExpiresAt })
+	return
+}
@@ -0,0 +1,149 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+var (
+	errUniqueGroup   = errors.New("UNIQUE constraint failed: UserGroup.tid, UserGroup.name")
+	errNoTenantGroup = errors.New("NOT NULL constraint failed: UserGroup.tid")
+)
+
+// groupKey is a group of a tenant
+type groupKey struct {
+	tenant string
+	name   string
+}
+
+type group struct {
+	created string
+	members map[string]bool
+}
+
+// AddGroup adds the group to its tenant, which is to exist
+func (s *Store) AddGroup(ctx context.Context, g *docsdb.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := groupKey{tenantOf(g.Tenant), g.Name}
+	if _, ok := s.tenants[k.tenant]; !ok {
+		return errNoTenantGroup
+	}
+	if s.groups[k] != nil {
+		return errUniqueGroup
+	}
+	s.groups[k] = &group{created: g.Created, members: make(map[string]bool)}
+	return nil
+}
+
+// AddGroupMember adds login to the group of the tenant, sql.ErrNoRows if there is no such group
+// or no such user in the tenant
+func (s *Store) AddGroupMember(ctx context.Context, tenant string, name string, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[groupKey{tenantOf(tenant), name}]
+	u := s.users[login]
+	if g == nil || u == nil || u.Tenant != tenantOf(tenant) {
+		return sql.ErrNoRows
+	}
+	g.members[login] = true
+	return nil
+}
+
+// DeleteGroup deletes the group of the tenant with its members and its grants, sql.ErrNoRows if there is none
+func (s *Store) DeleteGroup(ctx context.Context, tenant string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := groupKey{tenantOf(tenant), name}
+	if s.groups[k] == nil {
+		return sql.ErrNoRows
+	}
+	delete(s.groups, k)
+	for _, d := range s.docs {
+		if d.Tenant != k.tenant {
+			continue
+		}
+		groups := d.Groups[:0]
+		for _, v := range d.Groups {
+			if v != name {
+				groups = append(groups, v)
+			}
+		}
+		d.Groups = groups
+	}
+	return nil
+}
+
+// DeleteGroupMember removes login from the group of the tenant, sql.ErrNoRows if it is not a member
+func (s *Store) DeleteGroupMember(ctx context.Context, tenant string, name string, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[groupKey{tenantOf(tenant), name}]
+	if g == nil || !g.members[login] {
+		return sql.ErrNoRows
+	}
+	delete(g.members, login)
+	return nil
+}
+
+// GetGroups finds the groups of the tenant ordered by name with their members
+func (s *Store) GetGroups(ctx context.Context, tenant string) (groups []*docsdb.Group, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, g := range s.groups {
+		if k.tenant != tenantOf(tenant) {
+			continue
+		}
+		members := make([]string, 0, len(g.members))
+		for login := range g.members {
+			members = append(members, login)
+		}
+		sort.Strings(members)
+		groups = append(groups, &docsdb.Group{Name: k.name, Tenant: k.tenant, Created: g.created, Members: members})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return
+}
+
+// GetUserGroups finds the names of the groups of login ordered by name
+func (s *Store) GetUserGroups(ctx context.Context, login string) (groups []string, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k, g := range s.groups {
+		if g.members[login] {
+			groups = append(groups, k.name)
+		}
+	}
+	sort.Strings(groups)
+	return
+}
+
+// inGroup reports whether login is a member of one of the groups of the tenant
+func (s *Store) inGroup(login, tenant string, groups []string) bool {
+	for _, name := range groups {
+		if g := s.groups[groupKey{tenant, name}]; g != nil && g.members[login] {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedGroups are the groups ordered by name without the repeated ones
+func sortedGroups(groups []string) []string {
+	if groups == nil {
+		return nil
+	}
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	unique := sorted[:0]
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
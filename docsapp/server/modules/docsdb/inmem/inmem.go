@@ -0,0 +1,608 @@
+// Package inmem is a docsdb.ISQL keeping everything in maps, for the tests of the handlers and the demos.
+// It answers as the sqlite Handler does: sql.ErrNoRows for what is not found and errors telling
+// "UNIQUE" and "NOT NULL" for the duplicates and the unknown tenants
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+var (
+	errUniqueUser    = errors.New("UNIQUE constraint failed: User.login")
+	errUniqueDoc     = errors.New("UNIQUE constraint failed: Document.id")
+	errUniqueTenant  = errors.New("UNIQUE constraint failed: Tenant.name")
+	errUniqueRefresh = errors.New("UNIQUE constraint failed: RefreshToken.hash")
+	errNoTenantUser  = errors.New("NOT NULL constraint failed: User.tid")
+	errNoTenantDoc   = errors.New("NOT NULL constraint failed: Document.tid")
+	errUnknownColumn = errors.New("no such column")
+)
+
+// defaultTenantCreated is the created of the default tenant, it is there from the start
+const defaultTenantCreated = "1970-01-01 00:00:00"
+
+// Store is the in-memory database, the zero value is not usable, New makes one
+type Store struct {
+	mu      sync.RWMutex
+	tenants map[string]string
+	users   map[string]*docsdb.User
+	docs    map[string]*docsdb.Doc
+	// docids are the docids of the documents by their ids, lastDocID the last of them as AUTOINCREMENT has it
+	docids    map[string]int
+	lastDocID int
+	meta      map[string]map[string]docsdb.Meta
+	links     map[docsdb.Link]bool
+	usage     map[string]map[string]docsdb.Usage
+	groups    map[groupKey]*group
+	content   map[string]string
+	activity  map[string][]docsdb.Activity
+	// lastActivity is the ID of the last entry of any activity, as AUTOINCREMENT has it
+	lastActivity int64
+	audit        []docsdb.Audit
+	// deletions are the deletions of the accounts by the logins, without Login
+	deletions map[string]docsdb.Deletion
+	// blobs are the mappings of the files to their contents by the names
+	blobs map[string]docsdb.Blob
+	// revokedTokens are the times the revoked tokens expire at by their ids
+	revokedTokens map[string]string
+	// tokenGenerations are the generations of the tokens by the logins, they outlive the users
+	tokenGenerations map[string]int64
+	// refreshTokens are the refresh tokens by their hashes
+	refreshTokens map[string]docsdb.RefreshToken
+	// outbox are the entries of the changes to be told, lastOutbox the ID of the last of them as AUTOINCREMENT has it
+	outbox     []docsdb.Outbox
+	lastOutbox int64
+}
+
+// New makes an empty Store with the default tenant
+func New() *Store {
+	return &Store{
+		tenants:          map[string]string{docsdb.DefaultTenant: defaultTenantCreated},
+		users:            make(map[string]*docsdb.User),
+		docs:             make(map[string]*docsdb.Doc),
+		docids:           make(map[string]int),
+		meta:             make(map[string]map[string]docsdb.Meta),
+		links:            make(map[docsdb.Link]bool),
+		usage:            make(map[string]map[string]docsdb.Usage),
+		groups:           make(map[groupKey]*group),
+		content:          make(map[string]string),
+		activity:         make(map[string][]docsdb.Activity),
+		deletions:        make(map[string]docsdb.Deletion),
+		blobs:            make(map[string]docsdb.Blob),
+		revokedTokens:    make(map[string]string),
+		tokenGenerations: make(map[string]int64),
+		refreshTokens:    make(map[string]docsdb.RefreshToken),
+	}
+}
+
+// tenantOf is the tenant name, docsdb.DefaultTenant if it is empty
+func tenantOf(name string) string {
+	if name == "" {
+		return docsdb.DefaultTenant
+	}
+	return name
+}
+
+// copyDoc copies d so the callers don't share it with the store
+func copyDoc(d *docsdb.Doc) *docsdb.Doc {
+	c := *d
+	c.Grant = append([]string(nil), d.Grant...)
+	c.Groups = sortedGroups(d.Groups)
+	if d.JSON != nil {
+		c.JSON = append([]byte(nil), d.JSON...)
+	}
+	return &c
+}
+
+// AddLink adds the link, sql.ErrNoRows if either of the documents doesn't exist
+func (s *Store) AddLink(ctx context.Context, l *docsdb.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[l.From] == nil || s.docs[l.To] == nil {
+		return sql.ErrNoRows
+	}
+	s.links[*l] = true
+	return nil
+}
+
+// AddTenant adds the tenant
+func (s *Store) AddTenant(ctx context.Context, t *docsdb.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[t.Name]; ok {
+		return errUniqueTenant
+	}
+	s.tenants[t.Name] = t.Created
+	return nil
+}
+
+// AddUsage adds the requests and the bytes of u to the usage of login in u.Period, u gets the sums
+func (s *Store) AddUsage(ctx context.Context, login string, u *docsdb.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users[login] == nil {
+		return sql.ErrNoRows
+	}
+	if s.usage[login] == nil {
+		s.usage[login] = make(map[string]docsdb.Usage)
+	}
+	sum := s.usage[login][u.Period]
+	sum.Period = u.Period
+	sum.Requests += u.Requests
+	sum.Bytes += u.Bytes
+	s.usage[login][u.Period] = sum
+	*u = sum
+	return nil
+}
+
+// AddUser adds the user to its tenant, which is to exist
+func (s *Store) AddUser(ctx context.Context, user *docsdb.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users[user.Login] != nil {
+		return errUniqueUser
+	}
+	tenant := tenantOf(user.Tenant)
+	if _, ok := s.tenants[tenant]; !ok {
+		return errNoTenantUser
+	}
+	s.users[user.Login] = &docsdb.User{Login: user.Login, Password: user.Password, AdminRights: user.AdminRights, Tenant: tenant}
+	return nil
+}
+
+// Connect does nothing, the store is always there
+func (s *Store) Connect() error {
+	return nil
+}
+
+// CreateDocument adds the document granted to the users of its tenant in d.Grant, sql.ErrNoRows if one is not there
+func (s *Store) CreateDocument(ctx context.Context, d *docsdb.Doc, JSON []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[d.ID] != nil {
+		return errUniqueDoc
+	}
+	c := copyDoc(d)
+	c.ResolveVisibility()
+	c.Tenant = tenantOf(d.Tenant)
+	if _, ok := s.tenants[c.Tenant]; !ok {
+		return errNoTenantDoc
+	}
+	err := s.checkGrant(c)
+	if err != nil {
+		return err
+	}
+	c.Size, c.Hash = s.fileOf(c)
+	c.Version = 1
+	s.docs[c.ID] = c
+	s.lastDocID++
+	s.docids[c.ID] = s.lastDocID
+	s.addOutbox(ctx, c)
+	return nil
+}
+
+// checkGrant fails with sql.ErrNoRows if a login of d.Grant is not a user of the tenant of d
+// or a group of d.Groups is not a group of it
+func (s *Store) checkGrant(d *docsdb.Doc) error {
+	for _, login := range d.Grant {
+		u := s.users[login]
+		if u == nil || u.Tenant != d.Tenant {
+			return sql.ErrNoRows
+		}
+	}
+	for _, name := range d.Groups {
+		if s.groups[groupKey{d.Tenant, name}] == nil {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// DeleteDocument deletes the document with its keys and links, sql.ErrNoRows if there is none
+func (s *Store) DeleteDocument(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[id] == nil {
+		return sql.ErrNoRows
+	}
+	s.deleteDoc(id)
+	return nil
+}
+
+// deleteDoc deletes the document with id with its keys, links, content and activity, s is locked
+func (s *Store) deleteDoc(id string) {
+	delete(s.docs, id)
+	delete(s.docids, id)
+	delete(s.meta, id)
+	delete(s.content, id)
+	delete(s.activity, id)
+	for l := range s.links {
+		if l.From == id || l.To == id {
+			delete(s.links, l)
+		}
+	}
+}
+
+// DeleteLink deletes the link, sql.ErrNoRows if there is no such link
+func (s *Store) DeleteLink(ctx context.Context, l *docsdb.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.links[*l] {
+		return sql.ErrNoRows
+	}
+	delete(s.links, *l)
+	return nil
+}
+
+// DeleteMeta deletes the key of the document with id, sql.ErrNoRows if it has no such key
+func (s *Store) DeleteMeta(ctx context.Context, id string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.meta[id][key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.meta[id], key)
+	return nil
+}
+
+// DeleteTenant deletes the tenant with its groups, sql.ErrNoRows if there is none and docsdb.ErrTenantNotEmpty if it is in use
+func (s *Store) DeleteTenant(ctx context.Context, name string) error {
+	if name == docsdb.DefaultTenant {
+		return docsdb.ErrTenantNotEmpty
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tenants[name]; !ok {
+		return sql.ErrNoRows
+	}
+	users, docs := s.countTenant(name)
+	if users+docs > 0 {
+		return docsdb.ErrTenantNotEmpty
+	}
+	for k := range s.groups {
+		if k.tenant == name {
+			delete(s.groups, k)
+		}
+	}
+	delete(s.tenants, name)
+	return nil
+}
+
+// countTenant counts the users and the documents of the tenant
+func (s *Store) countTenant(name string) (users, docs int) {
+	for _, u := range s.users {
+		if u.Tenant == name {
+			users++
+		}
+	}
+	for _, d := range s.docs {
+		if d.Tenant == name {
+			docs++
+		}
+	}
+	return
+}
+
+// Disconnect does nothing, the data is kept until the store is dropped
+func (s *Store) Disconnect() {}
+
+// EachDocument passes the documents GetDocumentsList finds to fn one by one,
+// it stops at the first error of fn and returns it. A negative filter.Limit is no limit
+func (s *Store) EachDocument(ctx context.Context, filter *docsdb.Filter, fn func(*docsdb.Doc) error) error {
+	docs, err := s.list(filter)
+	if err != nil {
+		return err
+	}
+	for _, d := range docs {
+		err = fn(d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list finds the copies of the documents of filter ordered by created and docid after filter.After,
+// they are copied so the lock is not held while fn of EachDocument runs as it may query the store
+func (s *Store) list(filter *docsdb.Filter) (docs []*docsdb.Doc, err error) {
+	var afterCreated string
+	var afterID int
+	if filter.After != "" {
+		afterCreated, afterID, err = docsdb.ParseCursor(filter.After)
+		if err != nil {
+			return
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenant := filter.Tenant
+	if u := s.users[filter.Login]; u != nil && tenant == "" {
+		tenant = u.Tenant
+	}
+	for _, d := range s.docs {
+		var granted, direct bool
+		for _, login := range d.Grant {
+			if login == filter.Login && filter.Tenant == "" {
+				granted, direct = true, true
+			}
+		}
+		if filter.Tenant == "" && s.inGroup(filter.Login, d.Tenant, d.Groups) {
+			granted = true
+		}
+		if !granted && !(d.Public && d.Tenant == tenant) {
+			continue
+		}
+		switch filter.Shared {
+		case docsdb.SharedWithMe:
+			if !granted || d.Owner == filter.Login {
+				continue
+			}
+		case docsdb.SharedByMe:
+			if !direct || d.Owner != filter.Login || !sharedOut(d) {
+				continue
+			}
+		}
+		if d.ExpiresAt != "" && d.ExpiresAt <= filter.Now {
+			continue
+		}
+		if filter.After != "" && (d.Created < afterCreated || d.Created == afterCreated && s.docids[d.ID] <= afterID) {
+			continue
+		}
+		if filter.Column != "" && filter.Value != "" {
+			var ok bool
+			ok, err = matches(d, filter.Column, filter.Value)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		ok := true
+		for k, v := range filter.Meta {
+			if m, found := s.meta[d.ID][k]; !found || m.Value != v {
+				ok = false
+			}
+		}
+		if ok {
+			c := copyDoc(d)
+			if filter.Tenant != "" {
+				c.Grant, c.Groups = nil, nil
+			}
+			c.Cursor = docsdb.MakeCursor(c.Created, s.docids[c.ID])
+			docs = append(docs, c)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Created != docs[j].Created {
+			return docs[i].Created < docs[j].Created
+		}
+		return s.docids[docs[i].ID] < s.docids[docs[j].ID]
+	})
+	if filter.Limit >= 0 && len(docs) > filter.Limit {
+		docs = docs[:filter.Limit]
+	}
+	return
+}
+
+// sharedOut reports whether d is granted to others than its owner, to groups or seen by the tenant
+func sharedOut(d *docsdb.Doc) bool {
+	if d.Visibility != docsdb.VisibilityPrivate || len(d.Groups) > 0 {
+		return true
+	}
+	for _, login := range d.Grant {
+		if login != d.Owner {
+			return true
+		}
+	}
+	return false
+}
+
+// matches compares the column of d with value as sqlite does, the booleans are 1 and 0 there
+func matches(d *docsdb.Doc, column, value string) (bool, error) {
+	switch strings.ToLower(column) {
+	case "id":
+		return d.ID == value, nil
+	case "name":
+		return d.Name == value, nil
+	case "mime":
+		return d.Mime == value, nil
+	case "created":
+		return d.Created == value, nil
+	case "json":
+		return string(d.JSON) == value, nil
+	case "file":
+		return value == boolText(d.File), nil
+	case "public":
+		return value == boolText(d.Public), nil
+	case "visibility":
+		return d.Visibility == value, nil
+	case "owner":
+		return d.Owner == value, nil
+	case "size":
+		return strconv.FormatInt(d.Size, 10) == value, nil
+	case "hash":
+		return d.Hash == value, nil
+	case "version":
+		return strconv.Itoa(d.Version) == value, nil
+	}
+	return false, errUnknownColumn
+}
+
+func boolText(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// GetDocument finds the document by id
+func (s *Store) GetDocument(ctx context.Context, id string) (*docsdb.Doc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d := s.docs[id]
+	if d == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyDoc(d), nil
+}
+
+// GetDocumentsList finds all the documents filter.Login has access to depending on filter parameters
+func (s *Store) GetDocumentsList(ctx context.Context, filter *docsdb.Filter) (docs []*docsdb.Doc, err error) {
+	return s.list(filter)
+}
+
+// GetLinks finds the links of the document with id in both directions ordered by type, from and to
+func (s *Store) GetLinks(ctx context.Context, id string) (links []*docsdb.Link, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for l := range s.links {
+		if l.From == id || l.To == id {
+			c := l
+			links = append(links, &c)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return
+}
+
+// GetMeta finds the keys of the document with id ordered by key
+func (s *Store) GetMeta(ctx context.Context, id string) (meta []*docsdb.Meta, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.meta[id] {
+		c := m
+		meta = append(meta, &c)
+	}
+	sort.Slice(meta, func(i, j int) bool { return meta[i].Key < meta[j].Key })
+	return
+}
+
+// GetPassword finds password by login
+func (s *Store) GetPassword(ctx context.Context, login string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[login]
+	if u == nil {
+		return "", sql.ErrNoRows
+	}
+	return u.Password, nil
+}
+
+// SetPassword sets the password of login, the hash of it. sql.ErrNoRows if there is no such user
+func (s *Store) SetPassword(ctx context.Context, login string, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[login]
+	if u == nil {
+		return sql.ErrNoRows
+	}
+	u.Password = password
+	return nil
+}
+
+// GetTenants finds all the tenants with the numbers of their users and documents ordered by name
+func (s *Store) GetTenants(ctx context.Context) (tenants []*docsdb.Tenant, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name, created := range s.tenants {
+		t := &docsdb.Tenant{Name: name, Created: created}
+		t.Users, t.Docs = s.countTenant(name)
+		tenants = append(tenants, t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return
+}
+
+// GetUsage finds the usage of login in period, it is zero if login made no requests then
+func (s *Store) GetUsage(ctx context.Context, login string, period string) (*docsdb.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.usage[login][period]
+	if !ok {
+		u.Period = period
+	}
+	return &u, nil
+}
+
+// GetUserTenant finds the tenant of login
+func (s *Store) GetUserTenant(ctx context.Context, login string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[login]
+	if u == nil {
+		return "", sql.ErrNoRows
+	}
+	return u.Tenant, nil
+}
+
+// Init does nothing, there is nothing at driver and path to connect to
+func (s *Store) Init(driver string, path string) error {
+	return nil
+}
+
+// IsAdmin checks if login has admin rights
+func (s *Store) IsAdmin(ctx context.Context, login string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[login]
+	if u == nil {
+		return false, sql.ErrNoRows
+	}
+	return u.AdminRights, nil
+}
+
+// SetMeta sets the key of the document with id, sql.ErrNoRows if there is no such document
+func (s *Store) SetMeta(ctx context.Context, id string, m *docsdb.Meta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[id] == nil {
+		return sql.ErrNoRows
+	}
+	if s.meta[id] == nil {
+		s.meta[id] = make(map[string]docsdb.Meta)
+	}
+	s.meta[id][m.Key] = *m
+	return nil
+}
+
+// UpdateDocument replaces the document and its grants, it creates the document if there is none
+func (s *Store) UpdateDocument(ctx context.Context, d *docsdb.Doc, JSON []byte) error {
+	s.mu.Lock()
+	current := s.docs[d.ID]
+	if current == nil {
+		s.mu.Unlock()
+		return s.CreateDocument(ctx, d, JSON)
+	}
+	defer s.mu.Unlock()
+	c := copyDoc(d)
+	c.ResolveVisibility()
+	c.Tenant, c.Owner = current.Tenant, current.Owner
+	err := s.checkGrant(c)
+	if err != nil {
+		return err
+	}
+	c.Size, c.Hash = s.fileOf(c)
+	c.Version = current.Version + 1
+	s.docs[c.ID] = c
+	s.addOutbox(ctx, c)
+	return nil
+}
+
+var _ docsdb.ISQL = (*Store)(nil)
@@ -0,0 +1,91 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/docsdbtest"
+)
+
+func TestContract(t *testing.T) {
+	docsdbtest.Run(t, func(t *testing.T) docsdb.ISQL {
+		return New()
+	})
+}
+
+func TestListingIsScopedToTheTenant(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	err := s.AddTenant(ctx, &docsdb.Tenant{Name: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*docsdb.User{{Login: "ann"}, {Login: "bob"}, {Login: "eve", Tenant: "acme"}} {
+		err = s.AddUser(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	docs := []*docsdb.Doc{
+		{ID: "1", Name: "b", Grant: []string{"ann"}},
+		{ID: "2", Name: "a", Public: true, Grant: []string{"bob"}},
+		{ID: "3", Name: "c", Public: true, Grant: []string{"eve"}, Tenant: "acme"},
+		{ID: "4", Name: "d", Grant: []string{"bob"}},
+	}
+	for _, d := range docs {
+		err = s.CreateDocument(ctx, d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, d := range list {
+		ids = append(ids, d.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2" {
+		t.Errorf("ann sees %s, want 1,2", got)
+	}
+	list, err = s.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Column: "public", Value: "1", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != "2" {
+		t.Errorf("the public documents of ann are %v, want 2", list)
+	}
+	err = s.CreateDocument(ctx, &docsdb.Doc{ID: "5", Grant: []string{"eve"}}, nil)
+	if err != sql.ErrNoRows {
+		t.Errorf("granting a user of another tenant: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestErrorsAreTheOnesOfSqlite(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	err := s.AddUser(ctx, &docsdb.User{Login: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddUser(ctx, &docsdb.User{Login: "ann"})
+	if err == nil || !strings.Contains(err.Error(), "UNIQUE") {
+		t.Errorf("a second ann: %v, want UNIQUE", err)
+	}
+	err = s.AddUser(ctx, &docsdb.User{Login: "bob", Tenant: "nowhere"})
+	if err == nil || !strings.Contains(err.Error(), "NOT NULL") {
+		t.Errorf("a user of an unknown tenant: %v, want NOT NULL", err)
+	}
+	_, err = s.GetDocument(ctx, "1")
+	if err != sql.ErrNoRows {
+		t.Errorf("an unknown document: %v, want sql.ErrNoRows", err)
+	}
+	err = s.DeleteTenant(ctx, docsdb.DefaultTenant)
+	if err != docsdb.ErrTenantNotEmpty {
+		t.Errorf("deleting the default tenant: %v, want ErrTenantNotEmpty", err)
+	}
+}
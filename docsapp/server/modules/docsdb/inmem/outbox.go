@@ -0,0 +1,64 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// addOutbox adds the entry of ctx for d to the outbox, if ctx has one. The caller holds the lock
+func (s *Store) addOutbox(ctx context.Context, d *docsdb.Doc) {
+	e := docsdb.OutboxOf(ctx)
+	if e == nil {
+		return
+	}
+	s.lastOutbox++
+	s.outbox = append(s.outbox, docsdb.Outbox{ID: s.lastOutbox, Action: e.Action, Login: e.Login, Doc: copyDoc(d), Created: e.Created})
+}
+
+// GetOutbox finds up to limit entries of the outbox not delivered yet, the earliest first
+func (s *Store) GetOutbox(ctx context.Context, limit int) (entries []*docsdb.Outbox, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.outbox {
+		if len(entries) == limit {
+			break
+		}
+		if e.Delivered == "" {
+			c := e
+			c.Doc = copyDoc(e.Doc)
+			entries = append(entries, &c)
+		}
+	}
+	return
+}
+
+// SetOutboxDelivered marks the entry with id delivered at, sql.ErrNoRows if there is none
+func (s *Store) SetOutboxDelivered(ctx context.Context, id int64, at string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.outbox {
+		if s.outbox[i].ID == id {
+			s.outbox[i].Delivered = at
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// ClearOutbox deletes the entries of the outbox delivered before before and answers how many they were
+func (s *Store) ClearOutbox(ctx context.Context, before string) (n int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.outbox[:0]
+	for _, e := range s.outbox {
+		if e.Delivered != "" && e.Delivered < before {
+			n++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	s.outbox = kept
+	return
+}
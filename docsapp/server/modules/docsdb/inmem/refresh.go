@@ -0,0 +1,63 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// AddRefreshToken adds the refresh token
+func (s *Store) AddRefreshToken(ctx context.Context, token *docsdb.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.refreshTokens[token.Hash]; ok {
+		return errUniqueRefresh
+	}
+	t := *token
+	t.Used = false
+	s.refreshTokens[t.Hash] = t
+	return nil
+}
+
+// UseRefreshToken marks the refresh token of hash used and answers it as it was, sql.ErrNoRows if there is none
+func (s *Store) UseRefreshToken(ctx context.Context, hash string) (*docsdb.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refreshTokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	used := t
+	used.Used = true
+	s.refreshTokens[hash] = used
+	return &t, nil
+}
+
+// DeleteRefreshTokens deletes the refresh tokens of family of login, all the ones of login if family is empty
+func (s *Store) DeleteRefreshTokens(ctx context.Context, login, family string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for hash, t := range s.refreshTokens {
+		if t.Login == login && (family == "" || t.Family == family) {
+			delete(s.refreshTokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ClearRefreshTokens deletes the refresh tokens expired by before
+func (s *Store) ClearRefreshTokens(ctx context.Context, before string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for hash, t := range s.refreshTokens {
+		if t.ExpiresAt <= before {
+			delete(s.refreshTokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+package inmem
+
+import "context"
+
+// RevokeToken revokes the token of id until it expires at expiresAt, false if it is revoked already
+func (s *Store) RevokeToken(ctx context.Context, id string, expiresAt string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.revokedTokens[id]; ok {
+		return false, nil
+	}
+	s.revokedTokens[id] = expiresAt
+	return true, nil
+}
+
+// GetRevokedTokens finds the ids of the revoked tokens expiring after after
+func (s *Store) GetRevokedTokens(ctx context.Context, after string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for id, expiresAt := range s.revokedTokens {
+		if expiresAt > after {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// ClearRevokedTokens forgets the revoked tokens expired by before and answers how many there were
+func (s *Store) ClearRevokedTokens(ctx context.Context, before string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, expiresAt := range s.revokedTokens {
+		if expiresAt <= before {
+			delete(s.revokedTokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RevokeLogin revokes every token of login made so far and answers the generation the tokens made next have
+func (s *Store) RevokeLogin(ctx context.Context, login string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenGenerations[login]++
+	return s.tokenGenerations[login], nil
+}
+
+// GetTokenGenerations finds the generations of the tokens of the logins RevokeLogin has revoked
+func (s *Store) GetTokenGenerations(ctx context.Context) (map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	generations := make(map[string]int64, len(s.tokenGenerations))
+	for login, generation := range s.tokenGenerations {
+		generations[login] = generation
+	}
+	return generations, nil
+}
@@ -0,0 +1,123 @@
+package inmem
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// snippetTokens is the number of the words of a snippet, as the sqlite Handler has
+const snippetTokens = 12
+
+// IndexContent sets the text of the document with id the content searches look in, an empty one drops it
+func (s *Store) IndexContent(ctx context.Context, id string, content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[id] == nil {
+		return sql.ErrNoRows
+	}
+	if content == "" {
+		delete(s.content, id)
+	} else {
+		s.content[id] = content
+	}
+	return nil
+}
+
+// SearchDocuments finds the documents of filter whose name has query in any case or, with content,
+// whose text has every word of query, the words ending with * being prefixes as the full-text search of sqlite has them.
+// The operators of sqlite other than AND are not known here
+func (s *Store) SearchDocuments(ctx context.Context, filter *docsdb.Filter, query string, content bool) (hits []*docsdb.Hit, err error) {
+	all := *filter
+	all.Limit, all.After = -1, ""
+	docs, err := s.list(&all)
+	if err != nil {
+		return
+	}
+	var terms []string
+	for _, t := range strings.Fields(strings.ToLower(query)) {
+		if t != "and" {
+			terms = append(terms, t)
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, d := range docs {
+		if filter.Limit >= 0 && len(hits) == filter.Limit {
+			break
+		}
+		hit := &docsdb.Hit{Doc: *d}
+		hit.Grant, hit.Groups = nil, nil
+		if !content {
+			if strings.Contains(strings.ToLower(d.Name), strings.ToLower(query)) {
+				hits = append(hits, hit)
+			}
+			continue
+		}
+		var ok bool
+		hit.Snippet, ok = snippet(s.content[d.ID], terms)
+		if ok {
+			hits = append(hits, hit)
+		}
+	}
+	return
+}
+
+// snippet marks the terms in the words of text around the first matched one, ok is whether text has every term
+func snippet(text string, terms []string) (snip string, ok bool) {
+	if len(terms) == 0 {
+		return
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	found := make(map[string]bool, len(terms))
+	first := -1
+	matched := make([]bool, len(words))
+	for i, w := range words {
+		for _, t := range terms {
+			if matchTerm(strings.ToLower(w), t) {
+				found[t], matched[i] = true, true
+				if first < 0 {
+					first = i
+				}
+			}
+		}
+	}
+	if len(found) != len(terms) {
+		return
+	}
+	start := first - snippetTokens/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetTokens
+	if end > len(words) {
+		end = len(words)
+	}
+	parts := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		if matched[i] {
+			parts = append(parts, docsdb.SnippetStart+words[i]+docsdb.SnippetEnd)
+		} else {
+			parts = append(parts, words[i])
+		}
+	}
+	snip = strings.Join(parts, " ")
+	if start > 0 {
+		snip = docsdb.SnippetEllipsis + snip
+	}
+	if end < len(words) {
+		snip += docsdb.SnippetEllipsis
+	}
+	return snip, true
+}
+
+// matchTerm compares the lower case word with the term, a prefix if it ends with *
+func matchTerm(word, term string) bool {
+	if strings.HasSuffix(term, "*") {
+		return strings.HasPrefix(word, strings.TrimSuffix(term, "*"))
+	}
+	return word == term
+}
@@ -0,0 +1,64 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Link is the model of the database table DocLink, a relationship of the document From to the document To
+// such as "supersedes" or "attachment-of"
+type Link struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// AddLink inserts the link, sql.ErrNoRows if either of the documents doesn't exist
+func (h *Handler) AddLink(ctx context.Context, l *Link) (err error) {
+	var from, to int
+	err = h.stmtGetDocID.QueryRowContext(ctx, l.From).Scan(&from)
+	if err != nil {
+		return
+	}
+	err = h.stmtGetDocID.QueryRowContext(ctx, l.To).Scan(&to)
+	if err != nil {
+		return
+	}
+	_, err = h.stmtInsLink.ExecContext(ctx, from, to, l.Type)
+	return
+}
+
+// DeleteLink deletes the link, sql.ErrNoRows if there is no such link
+func (h *Handler) DeleteLink(ctx context.Context, l *Link) (err error) {
+	res, err := h.stmtDeleteLink.ExecContext(ctx, l.From, l.To, l.Type)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// GetLinks finds the links of the document with id in both directions
+func (h *Handler) GetLinks(ctx context.Context, id string) (links []*Link, err error) {
+	rows, err := h.stmtGetLinks.QueryContext(ctx, id, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l := &Link{}
+		err = rows.Scan(&l.From, &l.To, &l.Type)
+		if err != nil {
+			return
+		}
+		links = append(links, l)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,82 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+)
+
+// the types of Meta.Value
+const (
+	MetaString = "string"
+	MetaNumber = "number"
+	MetaBool   = "bool"
+)
+
+// Meta is the model of the database table DocMeta, a custom key of a document.
+// Value is the text of the value of the type, the filters of GetDocumentsList compare it
+type Meta struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// DeleteMeta deletes the key of the document with id, sql.ErrNoRows if it has no such key
+func (h *Handler) DeleteMeta(ctx context.Context, id string, key string) (err error) {
+	res, err := h.stmtDeleteMeta.ExecContext(ctx, id, key)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// GetMeta finds the keys of the document with id ordered by key
+func (h *Handler) GetMeta(ctx context.Context, id string) (meta []*Meta, err error) {
+	rows, err := h.stmtGetMeta.QueryContext(ctx, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := &Meta{}
+		err = rows.Scan(&m.Key, &m.Type, &m.Value)
+		if err != nil {
+			return
+		}
+		meta = append(meta, m)
+	}
+	err = rows.Err()
+	return
+}
+
+// SetMeta inserts or replaces the key of the document with id, sql.ErrNoRows if there is no such document
+func (h *Handler) SetMeta(ctx context.Context, id string, m *Meta) (err error) {
+	var docID int
+	err = h.stmtGetDocID.QueryRowContext(ctx, id).Scan(&docID)
+	if err != nil {
+		return
+	}
+	_, err = h.stmtSetMeta.ExecContext(ctx, docID, m.Key, m.Type, m.Value)
+	return
+}
+
+// metaWhere makes the conditions of the keys of filter.Meta on the document d, one lookup of the DocMetaKey index each
+func metaWhere(filter *Filter) (where string, args []interface{}) {
+	keys := make([]string, 0, len(filter.Meta))
+	for k := range filter.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		where += ` AND d.docid IN (SELECT docid FROM DocMeta WHERE key=? AND value=?)`
+		args = append(args, k, filter.Meta[k])
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package docsdb
+
+import (
+	"fmt"
+)
+
+// migrations are applied in order at Init, every one only once:
+// PRAGMA user_version keeps the number of the applied ones
+var migrations = [][]string{
+	// 1: the schema sqliteDocs.db was created with
+	{
+		`CREATE TABLE IF NOT EXISTS User (uid INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT NOT NULL UNIQUE DEFAULT "", password TEXT NOT NULL DEFAULT "", token TEXT NOT NULL DEFAULT "", admin BOOLEAN NOT NULL DEFAULT (false))`,
+		`CREATE TABLE IF NOT EXISTS Document (docid INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL UNIQUE, name TEXT NOT NULL, mime TEXT NOT NULL DEFAULT "application/octet-stream", file BOOLEAN DEFAULT (true) NOT NULL, public BOOLEAN DEFAULT (false) NOT NULL, created TEXT NOT NULL DEFAULT "1970-01-01 00:00:01", json BLOB)`,
+		`CREATE TABLE IF NOT EXISTS Grant (docid INTEGER REFERENCES Document (docid) NOT NULL, uid INTEGER REFERENCES User NOT NULL, PRIMARY KEY (docid, uid))`,
+	},
+	// 2: indexes of the lookups, User.login, Document.id and Grant.docid are covered
+	// by the indexes of their UNIQUE and PRIMARY KEY constraints
+	{
+		`CREATE INDEX IF NOT EXISTS UserToken ON User (token)`,
+		`CREATE INDEX IF NOT EXISTS GrantUID ON Grant (uid)`,
+		`CREATE INDEX IF NOT EXISTS DocumentPublic ON Document (public, name, created)`,
+		`CREATE INDEX IF NOT EXISTS DocumentName ON Document (name, created)`,
+	},
+	// 3: the custom keys of the documents
+	{
+		`CREATE TABLE IF NOT EXISTS DocMeta (docid INTEGER REFERENCES Document (docid) NOT NULL, key TEXT NOT NULL, type TEXT NOT NULL DEFAULT "string", value TEXT NOT NULL, PRIMARY KEY (docid, key))`,
+		`CREATE INDEX IF NOT EXISTS DocMetaKey ON DocMeta (key, value)`,
+	},
+	// 4: the links of the documents, DocLinkTo finds the incoming ones
+	{
+		`CREATE TABLE IF NOT EXISTS DocLink (fromid INTEGER REFERENCES Document (docid) NOT NULL, toid INTEGER REFERENCES Document (docid) NOT NULL, type TEXT NOT NULL, PRIMARY KEY (fromid, toid, type))`,
+		`CREATE INDEX IF NOT EXISTS DocLinkTo ON DocLink (toid)`,
+	},
+	// 5: the tenants, the users and the documents there were go to the default one.
+	// tid is not a REFERENCES column as sqlite can't add one with a default while foreign_keys is on
+	{
+		`CREATE TABLE IF NOT EXISTS Tenant (tid INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, created TEXT NOT NULL DEFAULT "1970-01-01 00:00:01")`,
+		`INSERT OR IGNORE INTO Tenant (tid, name) VALUES (1, '` + DefaultTenant + `')`,
+		`ALTER TABLE User ADD COLUMN tid INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE Document ADD COLUMN tid INTEGER NOT NULL DEFAULT 1`,
+		`CREATE INDEX IF NOT EXISTS UserTenant ON User (tid)`,
+		`CREATE INDEX IF NOT EXISTS DocumentTenantPublic ON Document (tid, public, name, created)`,
+	},
+	// 6: the visibility of the documents, public stays as the listed ones of DocumentTenantPublic
+	{
+		`ALTER TABLE Document ADD COLUMN visibility TEXT NOT NULL DEFAULT '` + VisibilityPrivate + `'`,
+		`UPDATE Document SET visibility='` + VisibilityPublic + `' WHERE public`,
+	},
+	// 7: the requests and the bytes of the answers of the users by the periods of their quotas
+	{
+		`CREATE TABLE IF NOT EXISTS Usage (uid INTEGER REFERENCES User NOT NULL, period TEXT NOT NULL, requests INTEGER NOT NULL DEFAULT 0, bytes INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (uid, period))`,
+	},
+	// 8: the groups of the users of a tenant and the documents granted to them,
+	// GroupMemberUID finds the groups of a user and GroupGrantGID the documents of a group
+	{
+		`CREATE TABLE IF NOT EXISTS UserGroup (gid INTEGER PRIMARY KEY AUTOINCREMENT, tid INTEGER NOT NULL, name TEXT NOT NULL, created TEXT NOT NULL DEFAULT "1970-01-01 00:00:01", UNIQUE (tid, name))`,
+		`CREATE TABLE IF NOT EXISTS GroupMember (gid INTEGER REFERENCES UserGroup (gid) NOT NULL, uid INTEGER REFERENCES User NOT NULL, PRIMARY KEY (gid, uid))`,
+		`CREATE INDEX IF NOT EXISTS GroupMemberUID ON GroupMember (uid)`,
+		`CREATE TABLE IF NOT EXISTS GroupGrant (docid INTEGER REFERENCES Document (docid) NOT NULL, gid INTEGER REFERENCES UserGroup (gid) NOT NULL, PRIMARY KEY (docid, gid))`,
+		`CREATE INDEX IF NOT EXISTS GroupGrantGID ON GroupGrant (gid)`,
+	},
+	// 9: the expiry of the documents, "" is never, DocumentExpires finds the ones to purge
+	{
+		`ALTER TABLE Document ADD COLUMN expires_at TEXT NOT NULL DEFAULT ""`,
+		`CREATE INDEX IF NOT EXISTS DocumentExpires ON Document (expires_at)`,
+	},
+	// 10: the text of the files of the documents for the full-text search, the docid of a row is the one of its document
+	{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS DocContent USING fts4(content)`,
+	},
+	// 11: the activity of the documents, the login is kept as it was for the users who are gone
+	{
+		`CREATE TABLE IF NOT EXISTS DocActivity (aid INTEGER PRIMARY KEY AUTOINCREMENT, docid INTEGER REFERENCES Document (docid) NOT NULL, login TEXT NOT NULL, type TEXT NOT NULL, detail TEXT NOT NULL DEFAULT "", created TEXT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS DocActivityDocID ON DocActivity (docid, aid)`,
+	},
+	// 12: the deletion of the accounts, UserDeleteAt finds the due ones, and the audit log of the accounts,
+	// the logins are kept as they were for the users who are gone
+	{
+		`ALTER TABLE User ADD COLUMN delete_code TEXT NOT NULL DEFAULT ""`,
+		`ALTER TABLE User ADD COLUMN delete_at TEXT NOT NULL DEFAULT ""`,
+		`CREATE INDEX IF NOT EXISTS UserDeleteAt ON User (delete_at)`,
+		`CREATE TABLE IF NOT EXISTS Audit (aid INTEGER PRIMARY KEY AUTOINCREMENT, actor TEXT NOT NULL, login TEXT NOT NULL, action TEXT NOT NULL, detail TEXT NOT NULL DEFAULT "", created TEXT NOT NULL)`,
+	},
+	// 13: the expiry of the tokens, "" is never, UserTokenExpires finds the expired ones
+	{
+		`ALTER TABLE User ADD COLUMN token_expires TEXT NOT NULL DEFAULT ""`,
+		`CREATE INDEX IF NOT EXISTS UserTokenExpires ON User (token_expires)`,
+	},
+	{
+		`CREATE TABLE IF NOT EXISTS Blob (name TEXT PRIMARY KEY, hash TEXT NOT NULL, size INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE INDEX IF NOT EXISTS BlobHash ON Blob (hash)`,
+	},
+	{
+		`CREATE TABLE IF NOT EXISTS RevokedToken (id TEXT PRIMARY KEY, expires_at TEXT NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS RevokedTokenExpires ON RevokedToken (expires_at)`,
+		`CREATE TABLE IF NOT EXISTS TokenGeneration (login TEXT PRIMARY KEY, generation INTEGER NOT NULL DEFAULT 0)`,
+	},
+	{
+		`CREATE TABLE IF NOT EXISTS RefreshToken (hash TEXT PRIMARY KEY, login TEXT NOT NULL, family TEXT NOT NULL, scopes TEXT NOT NULL DEFAULT '', expires_at TEXT NOT NULL, used BOOLEAN NOT NULL DEFAULT (false))`,
+		`CREATE INDEX IF NOT EXISTS RefreshTokenLogin ON RefreshToken (login, family)`,
+		`CREATE INDEX IF NOT EXISTS RefreshTokenExpires ON RefreshToken (expires_at)`,
+	},
+	{
+		`ALTER TABLE Document ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+		// the owners of the documents made before are the logins of their creation or of the directories of their files
+		`UPDATE Document SET owner=COALESCE((SELECT a.login FROM DocActivity as a WHERE a.docid=Document.docid AND a.type='created' ORDER BY a.aid LIMIT 1), '')`,
+		`UPDATE Document SET owner=substr(name, 1, instr(name, '/')-1) WHERE owner='' AND file=true AND instr(name, '/')>1`,
+		`CREATE INDEX IF NOT EXISTS DocumentOwner ON Document (owner)`,
+	},
+	// the listings are ordered by created and docid for their cursors, the index has docid as the rowid
+	{
+		`CREATE INDEX IF NOT EXISTS DocumentCreated ON Document (created)`,
+	},
+	// the files of the documents made before have the size and the hash of their contents if they are mapped
+	{
+		`ALTER TABLE Document ADD COLUMN size INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE Document ADD COLUMN hash TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE Document ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`UPDATE Document SET size=(SELECT b.size FROM Blob as b WHERE b.name=Document.name), hash=(SELECT b.hash FROM Blob as b WHERE b.name=Document.name)
+		WHERE file=true AND name IN (SELECT name FROM Blob)`,
+		`CREATE INDEX IF NOT EXISTS DocumentHash ON Document (hash)`,
+	},
+	{
+		`CREATE TABLE IF NOT EXISTS Outbox (oid INTEGER PRIMARY KEY AUTOINCREMENT, action TEXT NOT NULL, login TEXT NOT NULL, doc TEXT NOT NULL, created TEXT NOT NULL, delivered TEXT NOT NULL DEFAULT "")`,
+		`CREATE INDEX IF NOT EXISTS OutboxDelivered ON Outbox (delivered, oid)`,
+	},
+	// the signed tokens have replaced the ones kept in User, the columns stay as sqlite can't drop them
+	// before 3.35 but the tokens there are cleared and not looked up any more
+	{
+		`DROP INDEX IF EXISTS UserToken`,
+		`DROP INDEX IF EXISTS UserTokenExpires`,
+		`UPDATE User SET token='', token_expires='' WHERE token<>'' OR token_expires<>''`,
+	},
+}
+
+// migrate applies the migrations the database doesn't have yet
+func (h *Handler) migrate() (err error) {
+	var version int
+	err = h.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return
+	}
+	for ; version < len(migrations); version++ {
+		err = h.applyMigration(version)
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+	}
+	return
+}
+
+func (h *Handler) applyMigration(i int) (err error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for _, q := range migrations[i] {
+		_, err = tx.Exec(q)
+		if err != nil {
+			return
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version=%d`, i+1))
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,50 @@
+package docsdb_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// TestNullColumnsReadAsTheirDefaults opens a database whose User was made by hand without the NOT NULL
+// of the migrations, its NULL password and admin read as none
+func TestNullColumnsReadAsTheirDefaults(t *testing.T) {
+	if !hasDriver("sqlite3") {
+		t.Skip("the sqlite3 driver is not registered")
+	}
+	path := filepath.Join(t.TempDir(), "handmade.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE User (uid INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT UNIQUE, password TEXT, token TEXT, admin BOOLEAN)`,
+		`INSERT INTO User (login) VALUES ('ann')`,
+	} {
+		if _, err = db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	h := &docsdb.Handler{}
+	err = h.Init("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Disconnect()
+	ctx := context.Background()
+	password, err := h.GetPassword(ctx, "ann")
+	if err != nil || password != "" {
+		t.Errorf("the NULL password reads %q, %v, want none", password, err)
+	}
+	admin, err := h.IsAdmin(ctx, "ann")
+	if err != nil || admin {
+		t.Errorf("the NULL admin reads %v, %v, want false", admin, err)
+	}
+	if _, err = h.GetPassword(ctx, "bob"); err != sql.ErrNoRows {
+		t.Errorf("the password of an unknown login fails with %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,115 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// Outbox is an entry of the database table Outbox: Action of Login on Doc, written in the transaction
+// of the change for it to be told after the commit even if the process ends first.
+// Doc is the document as it was stored, Created and Delivered are times in the format of Doc.Created,
+// Delivered is empty until the entry is told
+type Outbox struct {
+	ID        int64  `json:"id" xml:"id"`
+	Action    string `json:"action" xml:"action"`
+	Login     string `json:"login" xml:"login"`
+	Doc       *Doc   `json:"doc" xml:"doc"`
+	Created   string `json:"created" xml:"created"`
+	Delivered string `json:"delivered,omitempty" xml:"delivered,omitempty"`
+}
+
+type outboxKey struct{}
+
+// WithOutbox makes CreateDocument and UpdateDocument with ctx add an entry like e to Outbox
+// in their transaction, with the document they store
+func WithOutbox(ctx context.Context, e *Outbox) context.Context {
+	return context.WithValue(ctx, outboxKey{}, e)
+}
+
+// OutboxOf is the entry of WithOutbox the changes with ctx add, nil if there is none
+func OutboxOf(ctx context.Context) *Outbox {
+	e, _ := ctx.Value(outboxKey{}).(*Outbox)
+	return e
+}
+
+// addOutbox adds the entry of ctx for d to Outbox within tx, if ctx has one
+func (h *Handler) addOutbox(ctx context.Context, tx *sql.Tx, d *Doc) (err error) {
+	e := OutboxOf(ctx)
+	if e == nil {
+		return
+	}
+	doc, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtInsOutbox).ExecContext(ctx, e.Action, e.Login, doc, e.Created)
+	return
+}
+
+// GetOutbox finds up to limit entries of Outbox not delivered yet, the earliest first
+func (h *Handler) GetOutbox(ctx context.Context, limit int) (entries []*Outbox, err error) {
+	rows, err := h.stmtGetOutbox.QueryContext(ctx, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc []byte
+		e := &Outbox{Doc: &Doc{}}
+		err = rows.Scan(&e.ID, &e.Action, &e.Login, &doc, &e.Created)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal(doc, e.Doc)
+		if err != nil {
+			return
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetOutboxDelivered marks the entry with id delivered at, sql.ErrNoRows if there is none
+func (h *Handler) SetOutboxDelivered(ctx context.Context, id int64, at string) (err error) {
+	res, err := h.stmtSetOutboxDelivered.ExecContext(ctx, at, id)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+// ClearOutbox deletes the entries of Outbox delivered before before and answers how many they were
+func (h *Handler) ClearOutbox(ctx context.Context, before string) (n int64, err error) {
+	res, err := h.stmtClearOutbox.ExecContext(ctx, before)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+// prepareOutbox prepares the statements of the outbox
+func (h *Handler) prepareOutbox() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtInsOutbox, `INSERT INTO Outbox(action, login, doc, created) VALUES (?,?,?,?)`},
+		{&h.stmtGetOutbox, `SELECT oid, action, login, doc, created FROM Outbox WHERE delivered='' ORDER BY oid LIMIT ?`},
+		{&h.stmtSetOutboxDelivered, `UPDATE Outbox SET delivered=? WHERE oid=?`},
+		{&h.stmtClearOutbox, `DELETE FROM Outbox WHERE delivered<>'' AND delivered<?`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
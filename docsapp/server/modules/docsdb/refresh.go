@@ -0,0 +1,84 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RefreshToken is the model of the database table RefreshToken: Hash is the hex sha256 of the token,
+// the tokens rotated from the same sign-in share Family. Scopes are the scopes of the access tokens
+// it is exchanged for, separated by spaces. A used token is kept until it expires to tell its reuse
+type RefreshToken struct {
+	Hash      string
+	Login     string
+	Family    string
+	Scopes    string
+	ExpiresAt string
+	Used      bool
+}
+
+// AddRefreshToken adds the refresh token
+func (h *Handler) AddRefreshToken(ctx context.Context, token *RefreshToken) (err error) {
+	_, err = h.stmtAddRefreshToken.ExecContext(ctx, token.Hash, token.Login, token.Family, token.Scopes, token.ExpiresAt)
+	return
+}
+
+// UseRefreshToken marks the refresh token of hash used and answers it as it was, Used tells it was used before.
+// sql.ErrNoRows if there is no such token
+func (h *Handler) UseRefreshToken(ctx context.Context, hash string) (token *RefreshToken, err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	token = &RefreshToken{}
+	err = tx.StmtContext(ctx, h.stmtGetRefreshToken).QueryRowContext(ctx, hash).
+		Scan(&token.Hash, &token.Login, &token.Family, &token.Scopes, &token.ExpiresAt, &token.Used)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.StmtContext(ctx, h.stmtUseRefreshToken).ExecContext(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// DeleteRefreshTokens deletes the refresh tokens of family of login, all the ones of login if family is empty,
+// and answers how many there were
+func (h *Handler) DeleteRefreshTokens(ctx context.Context, login, family string) (n int64, err error) {
+	res, err := h.stmtDeleteRefreshTokens.ExecContext(ctx, login, family, family)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+// ClearRefreshTokens deletes the refresh tokens expired by before and answers how many there were
+func (h *Handler) ClearRefreshTokens(ctx context.Context, before string) (n int64, err error) {
+	res, err := h.stmtClearRefreshTokens.ExecContext(ctx, before)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+// prepareRefresh prepares the statements of the refresh tokens
+func (h *Handler) prepareRefresh() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtAddRefreshToken, `INSERT INTO RefreshToken (hash, login, family, scopes, expires_at) VALUES (?,?,?,?,?)`},
+		{&h.stmtGetRefreshToken, `SELECT hash, login, family, scopes, expires_at, used FROM RefreshToken WHERE hash=?`},
+		{&h.stmtUseRefreshToken, `UPDATE RefreshToken SET used=1 WHERE hash=?`},
+		{&h.stmtDeleteRefreshTokens, `DELETE FROM RefreshToken WHERE login=? AND (?='' OR family=?)`},
+		{&h.stmtClearRefreshTokens, `DELETE FROM RefreshToken WHERE expires_at<=?`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
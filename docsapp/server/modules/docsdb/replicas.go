@@ -0,0 +1,97 @@
+package docsdb
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Replicas sends GetDocument, GetDocumentsList and EachDocument to the replicas in turn
+// and everything else to the primary. A read failing on a replica is read again from the primary,
+// sql.ErrNoRows too as the replica may not have caught up with a write yet.
+// EachDocument is read again only if the replica failed before passing a document to fn
+type Replicas struct {
+	ISQL
+	replicas []ISQL
+	next     uint32
+}
+
+// Replicated wraps primary so the reads go to the replicas, they are initialized by the caller
+// as Init initializes the primary only
+func Replicated(primary ISQL, replicas ...ISQL) *Replicas {
+	return &Replicas{ISQL: primary, replicas: replicas}
+}
+
+// failover reports whether the read failing on a replica with err is read again from the primary,
+// the filters too expensive and the reads given up by the caller would fail there as well
+func failover(ctx context.Context, err error) bool {
+	return err != nil && err != ErrFilterTooExpensive && ctx.Err() == nil
+}
+
+// replica is the next replica in turn, nil if there are none
+func (r *Replicas) replica() ISQL {
+	if len(r.replicas) == 0 {
+		return nil
+	}
+	return r.replicas[int(atomic.AddUint32(&r.next, 1)-1)%len(r.replicas)]
+}
+
+// Connect connects the primary and the replicas
+func (r *Replicas) Connect() (err error) {
+	err = r.ISQL.Connect()
+	if err != nil {
+		return
+	}
+	for _, replica := range r.replicas {
+		err = replica.Connect()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Disconnect disconnects the primary and the replicas
+func (r *Replicas) Disconnect() {
+	r.ISQL.Disconnect()
+	for _, replica := range r.replicas {
+		replica.Disconnect()
+	}
+}
+
+func (r *Replicas) EachDocument(ctx context.Context, filter *Filter, fn func(*Doc) error) (err error) {
+	replica := r.replica()
+	if replica == nil {
+		return r.ISQL.EachDocument(ctx, filter, fn)
+	}
+	var passed, fnFailed bool
+	err = replica.EachDocument(ctx, filter, func(d *Doc) error {
+		passed = true
+		fnErr := fn(d)
+		fnFailed = fnErr != nil
+		return fnErr
+	})
+	if !failover(ctx, err) || passed || fnFailed {
+		return
+	}
+	return r.ISQL.EachDocument(ctx, filter, fn)
+}
+
+func (r *Replicas) GetDocument(ctx context.Context, id string) (doc *Doc, err error) {
+	if replica := r.replica(); replica != nil {
+		doc, err = replica.GetDocument(ctx, id)
+		if !failover(ctx, err) {
+			return
+		}
+	}
+	return r.ISQL.GetDocument(ctx, id)
+}
+
+func (r *Replicas) GetDocumentsList(ctx context.Context, filter *Filter) (docs []*Doc, err error) {
+	if replica := r.replica(); replica != nil {
+		docs, err = replica.GetDocumentsList(ctx, filter)
+		if !failover(ctx, err) {
+			return
+		}
+	}
+	return r.ISQL.GetDocumentsList(ctx, filter)
+}
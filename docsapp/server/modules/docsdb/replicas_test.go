@@ -0,0 +1,37 @@
+package docsdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestReplicasFailOverToThePrimary(t *testing.T) {
+	ctx := context.Background()
+	primary, replica := inmem.New(), inmem.New()
+	r := docsdb.Replicated(primary, replica)
+	err := r.AddUser(ctx, &docsdb.User{Login: "ann"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.CreateDocument(ctx, &docsdb.Doc{ID: "1", Grant: []string{"ann"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = replica.GetDocument(ctx, "1"); err == nil {
+		t.Fatal("the write went to the replica")
+	}
+	doc, err := r.GetDocument(ctx, "1")
+	if err != nil || doc.ID != "1" {
+		t.Errorf("the document not replicated yet is %v, %v, want it from the primary", doc, err)
+	}
+	docs, err := r.GetDocumentsList(ctx, &docsdb.Filter{Login: "ann", Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("the listing is %d documents, want the 0 of the replica", len(docs))
+	}
+}
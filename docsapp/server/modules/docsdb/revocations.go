@@ -0,0 +1,109 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RevokeToken revokes the token of id until it expires at expiresAt, in the format of Doc.Created.
+// It reports false if the token is revoked already
+func (h *Handler) RevokeToken(ctx context.Context, id string, expiresAt string) (revoked bool, err error) {
+	res, err := h.stmtRevokeToken.ExecContext(ctx, id, expiresAt)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetRevokedTokens finds the ids of the revoked tokens expiring after after
+func (h *Handler) GetRevokedTokens(ctx context.Context, after string) (ids []string, err error) {
+	rows, err := h.stmtGetRevokedTokens.QueryContext(ctx, after)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ClearRevokedTokens forgets the revoked tokens expired by before and answers how many there were
+func (h *Handler) ClearRevokedTokens(ctx context.Context, before string) (n int64, err error) {
+	res, err := h.stmtClearRevokedTokens.ExecContext(ctx, before)
+	if err != nil {
+		return
+	}
+	return res.RowsAffected()
+}
+
+// RevokeLogin revokes every token of login made so far and answers the generation the tokens made next have.
+// The generations outlive the users, a login registered again doesn't get the tokens of the one deleted back
+func (h *Handler) RevokeLogin(ctx context.Context, login string) (generation int64, err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.StmtContext(ctx, h.stmtInsTokenGeneration).ExecContext(ctx, login)
+	if err != nil {
+		return
+	}
+	_, err = tx.StmtContext(ctx, h.stmtIncTokenGeneration).ExecContext(ctx, login)
+	if err != nil {
+		return
+	}
+	err = tx.StmtContext(ctx, h.stmtGetTokenGeneration).QueryRowContext(ctx, login).Scan(&generation)
+	if err != nil {
+		return
+	}
+	return generation, tx.Commit()
+}
+
+// GetTokenGenerations finds the generations of the tokens of the logins RevokeLogin has revoked
+func (h *Handler) GetTokenGenerations(ctx context.Context) (generations map[string]int64, err error) {
+	rows, err := h.stmtGetTokenGenerations.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	generations = make(map[string]int64)
+	for rows.Next() {
+		var login string
+		var generation int64
+		err = rows.Scan(&login, &generation)
+		if err != nil {
+			return
+		}
+		generations[login] = generation
+	}
+	return generations, rows.Err()
+}
+
+// prepareRevocations prepares the statements of the revoked tokens
+func (h *Handler) prepareRevocations() (err error) {
+	for _, s := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.stmtRevokeToken, `INSERT OR IGNORE INTO RevokedToken (id, expires_at) VALUES (?,?)`},
+		{&h.stmtGetRevokedTokens, `SELECT id FROM RevokedToken WHERE expires_at>?`},
+		{&h.stmtClearRevokedTokens, `DELETE FROM RevokedToken WHERE expires_at<=?`},
+		{&h.stmtInsTokenGeneration, `INSERT OR IGNORE INTO TokenGeneration (login, generation) VALUES (?,0)`},
+		{&h.stmtIncTokenGeneration, `UPDATE TokenGeneration SET generation=generation+1 WHERE login=?`},
+		{&h.stmtGetTokenGeneration, `SELECT generation FROM TokenGeneration WHERE login=?`},
+		{&h.stmtGetTokenGenerations, `SELECT login, generation FROM TokenGeneration`},
+	} {
+		*s.stmt, err = h.db.Prepare(s.query)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
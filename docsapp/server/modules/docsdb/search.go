@@ -0,0 +1,126 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+)
+
+// the marks of the matched terms in the snippets of the hits
+const (
+	SnippetStart    = "<b>"
+	SnippetEnd      = "</b>"
+	SnippetEllipsis = "…"
+	// snippetTokens is the number of the words of a snippet
+	snippetTokens = 12
+	// snippetOpen and snippetClose are the marks sqlite puts in the snippets, they are replaced
+	// by SnippetStart and SnippetEnd once the content is escaped. They are dropped from the indexed contents
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// snippetMarks are dropped from the contents indexed, a content never marks itself
+var snippetMarks = strings.NewReplacer(snippetOpen, "", snippetClose, "")
+
+// Hit is a document SearchDocuments finds, Snippet is the piece of its content around the matched terms
+// marked with SnippetStart and SnippetEnd, it is empty for the searches by name. The content is HTML escaped,
+// the marks are the only markup of a snippet
+type Hit struct {
+	Doc
+	Snippet string `json:"snippet,omitempty" xml:"snippet,omitempty"`
+}
+
+// visibleWhere is the condition of the documents filter.Login has: granted to it or its groups
+// or public in its tenant, with the login three times as its arguments
+const visibleWhere = ` AND d.docid IN (
+	SELECT g.docid FROM Grant as g INNER JOIN User as u ON(g.uid=u.uid) WHERE u.login=?
+	UNION
+	SELECT gg.docid FROM GroupGrant as gg INNER JOIN GroupMember as m ON(gg.gid=m.gid) INNER JOIN User as u ON(m.uid=u.uid) WHERE u.login=?
+	UNION
+	SELECT docid FROM Document WHERE public=true AND tid=(SELECT tid FROM User WHERE login=?))`
+
+// IndexContent sets the text of the document with id the content searches look in, an empty one drops it.
+// sql.ErrNoRows if there is no document
+func (h *Handler) IndexContent(ctx context.Context, id string, content string) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var docID int
+	err = tx.Stmt(h.stmtGetDocID).QueryRowContext(ctx, id).Scan(&docID)
+	if err != nil {
+		return
+	}
+	_, err = tx.Stmt(h.stmtDeleteContentDocID).ExecContext(ctx, docID)
+	if err != nil {
+		return
+	}
+	if content != "" {
+		_, err = tx.Stmt(h.stmtInsContent).ExecContext(ctx, docID, snippetMarks.Replace(content))
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchDocuments finds the documents filter.Login has whose name has query in any case or,
+// with content, whose indexed text matches query, a full-text query of sqlite like `report AND 2019`.
+// The column, the custom keys, Now and Limit of filter narrow it as they do GetDocumentsList,
+// the hits are ordered as the listings are and come without their grants
+func (h *Handler) SearchDocuments(ctx context.Context, filter *Filter, query string, content bool) (hits []*Hit, err error) {
+	where, args := filterWhere(filter)
+	where = expiryWhere + visibleWhere + where
+	args = append([]interface{}{filter.Now, filter.Login, filter.Login, filter.Login}, args...)
+	var rows *sql.Rows
+	if content {
+		args = append(append([]interface{}{snippetOpen, snippetClose, SnippetEllipsis, snippetTokens, query}, args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version,
+		snippet(DocContent, ?, ?, ?, -1, ?)
+		FROM DocContent INNER JOIN Document as d ON(d.docid=DocContent.docid)
+		WHERE DocContent MATCH ?`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, args...)
+	} else {
+		args = append(append([]interface{}{query}, args...), filter.Limit)
+		rows, err = h.db.QueryContext(ctx, `SELECT d.id, d.name, d.mime, d.file, d.public, d.visibility, d.created, d.json, d.expires_at, d.owner, d.size, d.hash, d.version, ''
+		FROM Document as d
+		WHERE instr(lower(d.name), lower(?))>0`+where+`
+		ORDER BY d.created, d.docid
+		LIMIT ?`, args...)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		hit := &Hit{}
+		d := &hit.Doc
+		// snippet is NULL for a row of DocContent without a content
+		var snippet sql.NullString
+		err = rows.Scan(&d.ID, &d.Name, &d.Mime, &d.File, &d.Public, &d.Visibility, &d.Created, &d.JSON, &d.ExpiresAt, &d.Owner, &d.Size, &d.Hash, &d.Version, &snippet)
+		if err != nil {
+			return
+		}
+		hit.Snippet = markSnippet(snippet.String)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// markSnippet escapes the snippet sqlite has made of a content and marks its matched terms with SnippetStart and SnippetEnd
+func markSnippet(s string) string {
+	return strings.NewReplacer(snippetOpen, SnippetStart, snippetClose, SnippetEnd).Replace(html.EscapeString(s))
+}
+
+// prepareSearch prepares the statements of the content index
+func (h *Handler) prepareSearch() (err error) {
+	h.stmtInsContent, err = h.db.Prepare(`INSERT INTO DocContent(docid, content) VALUES (?,?)`)
+	if err != nil {
+		return
+	}
+	h.stmtDeleteContentDocID, err = h.db.Prepare(`DELETE FROM DocContent WHERE docid=?`)
+	return
+}
@@ -0,0 +1,10 @@
+package docsdb
+
+import "testing"
+
+func TestSnippetIsEscapedBeforeItIsMarked(t *testing.T) {
+	got := markSnippet("<script>" + snippetOpen + "sales" + snippetClose + "</script>")
+	if want := "&lt;script&gt;<b>sales</b>&lt;/script&gt;"; got != want {
+		t.Errorf("the snippet is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// DefaultTenant is the tenant of the users and the documents made before the tenants
+// and of the ones without a tenant
+const DefaultTenant = "default"
+
+// ErrTenantNotEmpty is returned by DeleteTenant for the tenants with users or documents and the default one
+var ErrTenantNotEmpty = errors.New("the tenant has users or documents")
+
+// Tenant is the model of the database table Tenant: an organization whose users see only its documents
+type Tenant struct {
+	Name    string `json:"name"`
+	Created string `json:"created"`
+	Users   int    `json:"users"`
+	Docs    int    `json:"docs"`
+}
+
+// tenantOf is the tenant name, DefaultTenant if it is empty
+func tenantOf(name string) string {
+	if name == "" {
+		return DefaultTenant
+	}
+	return name
+}
+
+// AddTenant inserts into Tenant name and created
+func (h *Handler) AddTenant(ctx context.Context, t *Tenant) (err error) {
+	_, err = h.stmtInsTenant.ExecContext(ctx, t.Name, t.Created)
+	return
+}
+
+// DeleteTenant deletes the tenant with its groups, sql.ErrNoRows if there is none and ErrTenantNotEmpty if it is in use
+func (h *Handler) DeleteTenant(ctx context.Context, name string) (err error) {
+	if name == DefaultTenant {
+		return ErrTenantNotEmpty
+	}
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	var users, docs int
+	err = tx.Stmt(h.stmtCountTenant).QueryRowContext(ctx, name).Scan(&users, &docs)
+	if err != nil {
+		return
+	}
+	if users+docs > 0 {
+		return ErrTenantNotEmpty
+	}
+	// the groups of a tenant without users and documents have neither members nor grants
+	_, err = tx.Stmt(h.stmtDeleteTenantGroups).ExecContext(ctx, name)
+	if err != nil {
+		return
+	}
+	res, err := tx.Stmt(h.stmtDeleteTenant).ExecContext(ctx, name)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// GetTenants finds all the tenants with the numbers of their users and documents
+func (h *Handler) GetTenants(ctx context.Context) (tenants []*Tenant, err error) {
+	rows, err := h.stmtGetTenants.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := &Tenant{}
+		err = rows.Scan(&t.Name, &t.Created, &t.Users, &t.Docs)
+		if err != nil {
+			return
+		}
+		tenants = append(tenants, t)
+	}
+	err = rows.Err()
+	return
+}
+
+// GetUserTenant finds the tenant of login
+func (h *Handler) GetUserTenant(ctx context.Context, login string) (tenant string, err error) {
+	err = h.stmtGetUserTenant.QueryRowContext(ctx, login).Scan(&tenant)
+	return
+}
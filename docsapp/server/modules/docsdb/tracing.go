@@ -0,0 +1,442 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryObserver is told how long every query has taken, by the name of its method
+type QueryObserver func(query string, d time.Duration)
+
+// tracedSQL makes a span of every call of the queries of next
+type tracedSQL struct {
+	ISQL
+	tracer  trace.Tracer
+	observe QueryObserver
+}
+
+// Traced wraps next so its queries are traced by tracer and timed by observe, if it is not nil.
+// Init, Connect and Disconnect are not
+func Traced(next ISQL, tracer trace.Tracer, observe QueryObserver) ISQL {
+	return &tracedSQL{ISQL: next, tracer: tracer, observe: observe}
+}
+
+// timedSpan tells its observer the time from its start when it ends
+type timedSpan struct {
+	trace.Span
+	query   string
+	start   time.Time
+	observe QueryObserver
+}
+
+func (s *timedSpan) End(options ...trace.SpanEndOption) {
+	s.observe(s.query, time.Since(s.start))
+	s.Span.End(options...)
+}
+
+func (t *tracedSQL) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, "docsdb."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("db.system", "sqlite")))
+	if t.observe == nil {
+		return ctx, span
+	}
+	return ctx, &timedSpan{Span: span, query: name, start: time.Now(), observe: t.observe}
+}
+
+// end ends span, sql.ErrNoRows is an answer rather than a failure
+func end(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedSQL) AddActivity(ctx context.Context, a *Activity) (err error) {
+	ctx, span := t.start(ctx, "AddActivity")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddActivity(ctx, a)
+}
+
+func (t *tracedSQL) AddAudit(ctx context.Context, a *Audit) (err error) {
+	ctx, span := t.start(ctx, "AddAudit")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddAudit(ctx, a)
+}
+
+func (t *tracedSQL) AddGroup(ctx context.Context, g *Group) (err error) {
+	ctx, span := t.start(ctx, "AddGroup")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddGroup(ctx, g)
+}
+
+func (t *tracedSQL) AddGroupMember(ctx context.Context, tenant string, group string, login string) (err error) {
+	ctx, span := t.start(ctx, "AddGroupMember")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddGroupMember(ctx, tenant, group, login)
+}
+
+func (t *tracedSQL) AddLink(ctx context.Context, l *Link) (err error) {
+	ctx, span := t.start(ctx, "AddLink")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddLink(ctx, l)
+}
+
+func (t *tracedSQL) AddRefreshToken(ctx context.Context, token *RefreshToken) (err error) {
+	ctx, span := t.start(ctx, "AddRefreshToken")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddRefreshToken(ctx, token)
+}
+
+func (t *tracedSQL) AddTenant(ctx context.Context, tenant *Tenant) (err error) {
+	ctx, span := t.start(ctx, "AddTenant")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddTenant(ctx, tenant)
+}
+
+func (t *tracedSQL) AddUsage(ctx context.Context, login string, u *Usage) (err error) {
+	ctx, span := t.start(ctx, "AddUsage")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddUsage(ctx, login, u)
+}
+
+func (t *tracedSQL) AddUser(ctx context.Context, user *User) (err error) {
+	ctx, span := t.start(ctx, "AddUser")
+	defer func() { end(span, err) }()
+	return t.ISQL.AddUser(ctx, user)
+}
+
+func (t *tracedSQL) ClearRevokedTokens(ctx context.Context, before string) (n int64, err error) {
+	ctx, span := t.start(ctx, "ClearRevokedTokens")
+	defer func() { end(span, err) }()
+	return t.ISQL.ClearRevokedTokens(ctx, before)
+}
+
+func (t *tracedSQL) ClearOutbox(ctx context.Context, before string) (n int64, err error) {
+	ctx, span := t.start(ctx, "ClearOutbox")
+	defer func() { end(span, err) }()
+	return t.ISQL.ClearOutbox(ctx, before)
+}
+
+func (t *tracedSQL) ClearRefreshTokens(ctx context.Context, before string) (n int64, err error) {
+	ctx, span := t.start(ctx, "ClearRefreshTokens")
+	defer func() { end(span, err) }()
+	return t.ISQL.ClearRefreshTokens(ctx, before)
+}
+
+func (t *tracedSQL) CountBlobs(ctx context.Context, hash string) (n int64, err error) {
+	ctx, span := t.start(ctx, "CountBlobs")
+	defer func() { end(span, err) }()
+	return t.ISQL.CountBlobs(ctx, hash)
+}
+
+func (t *tracedSQL) CreateDocument(ctx context.Context, d *Doc, JSON []byte) (err error) {
+	ctx, span := t.start(ctx, "CreateDocument")
+	defer func() { end(span, err) }()
+	return t.ISQL.CreateDocument(ctx, d, JSON)
+}
+
+func (t *tracedSQL) DeleteBlob(ctx context.Context, name string) (blob *Blob, err error) {
+	ctx, span := t.start(ctx, "DeleteBlob")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteBlob(ctx, name)
+}
+
+func (t *tracedSQL) DeleteDocument(ctx context.Context, id string) (err error) {
+	ctx, span := t.start(ctx, "DeleteDocument")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteDocument(ctx, id)
+}
+
+func (t *tracedSQL) DeleteGroup(ctx context.Context, tenant string, name string) (err error) {
+	ctx, span := t.start(ctx, "DeleteGroup")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteGroup(ctx, tenant, name)
+}
+
+func (t *tracedSQL) DeleteGroupMember(ctx context.Context, tenant string, group string, login string) (err error) {
+	ctx, span := t.start(ctx, "DeleteGroupMember")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteGroupMember(ctx, tenant, group, login)
+}
+
+func (t *tracedSQL) DeleteLink(ctx context.Context, l *Link) (err error) {
+	ctx, span := t.start(ctx, "DeleteLink")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteLink(ctx, l)
+}
+
+func (t *tracedSQL) DeleteMeta(ctx context.Context, id string, key string) (err error) {
+	ctx, span := t.start(ctx, "DeleteMeta")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteMeta(ctx, id, key)
+}
+
+func (t *tracedSQL) DeleteRefreshTokens(ctx context.Context, login string, family string) (n int64, err error) {
+	ctx, span := t.start(ctx, "DeleteRefreshTokens")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteRefreshTokens(ctx, login, family)
+}
+
+func (t *tracedSQL) DeleteTenant(ctx context.Context, name string) (err error) {
+	ctx, span := t.start(ctx, "DeleteTenant")
+	defer func() { end(span, err) }()
+	return t.ISQL.DeleteTenant(ctx, name)
+}
+
+func (t *tracedSQL) DeleteUser(ctx context.Context, login string) (docs []*Doc, err error) {
+	ctx, span := t.start(ctx, "DeleteUser")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(docs)))
+		end(span, err)
+	}()
+	return t.ISQL.DeleteUser(ctx, login)
+}
+
+func (t *tracedSQL) EachDocument(ctx context.Context, filter *Filter, fn func(*Doc) error) (err error) {
+	ctx, span := t.start(ctx, "EachDocument")
+	span.SetAttributes(attribute.String("docsdb.filter.column", filter.Column), attribute.Int("docsdb.filter.limit", filter.Limit),
+		attribute.Int("docsdb.filter.meta", len(filter.Meta)))
+	var n int
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", n))
+		end(span, err)
+	}()
+	return t.ISQL.EachDocument(ctx, filter, func(d *Doc) error {
+		n++
+		return fn(d)
+	})
+}
+
+func (t *tracedSQL) GetActivity(ctx context.Context, id string, after int64, limit int) (activity []*Activity, err error) {
+	ctx, span := t.start(ctx, "GetActivity")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(activity)))
+		end(span, err)
+	}()
+	return t.ISQL.GetActivity(ctx, id, after, limit)
+}
+
+func (t *tracedSQL) GetAudit(ctx context.Context, after int64, limit int) (audit []*Audit, err error) {
+	ctx, span := t.start(ctx, "GetAudit")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(audit)))
+		end(span, err)
+	}()
+	return t.ISQL.GetAudit(ctx, after, limit)
+}
+
+func (t *tracedSQL) GetBlob(ctx context.Context, name string) (blob *Blob, err error) {
+	ctx, span := t.start(ctx, "GetBlob")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetBlob(ctx, name)
+}
+
+func (t *tracedSQL) GetBlobs(ctx context.Context, after string, limit int) (blobs []*Blob, err error) {
+	ctx, span := t.start(ctx, "GetBlobs")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(blobs)))
+		end(span, err)
+	}()
+	return t.ISQL.GetBlobs(ctx, after, limit)
+}
+
+func (t *tracedSQL) GetDeletion(ctx context.Context, login string) (d *Deletion, err error) {
+	ctx, span := t.start(ctx, "GetDeletion")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetDeletion(ctx, login)
+}
+
+func (t *tracedSQL) GetDocument(ctx context.Context, id string) (doc *Doc, err error) {
+	ctx, span := t.start(ctx, "GetDocument")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetDocument(ctx, id)
+}
+
+func (t *tracedSQL) GetDocumentsList(ctx context.Context, filter *Filter) (docs []*Doc, err error) {
+	ctx, span := t.start(ctx, "GetDocumentsList")
+	span.SetAttributes(attribute.String("docsdb.filter.column", filter.Column), attribute.Int("docsdb.filter.limit", filter.Limit),
+		attribute.Int("docsdb.filter.meta", len(filter.Meta)))
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(docs)))
+		end(span, err)
+	}()
+	return t.ISQL.GetDocumentsList(ctx, filter)
+}
+
+func (t *tracedSQL) GetDueDeletions(ctx context.Context, before string) (deletions []*Deletion, err error) {
+	ctx, span := t.start(ctx, "GetDueDeletions")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(deletions)))
+		end(span, err)
+	}()
+	return t.ISQL.GetDueDeletions(ctx, before)
+}
+
+func (t *tracedSQL) GetExpiredDocuments(ctx context.Context, before string) (docs []*Doc, err error) {
+	ctx, span := t.start(ctx, "GetExpiredDocuments")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(docs)))
+		end(span, err)
+	}()
+	return t.ISQL.GetExpiredDocuments(ctx, before)
+}
+
+func (t *tracedSQL) GetGroups(ctx context.Context, tenant string) (groups []*Group, err error) {
+	ctx, span := t.start(ctx, "GetGroups")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetGroups(ctx, tenant)
+}
+
+func (t *tracedSQL) GetLinks(ctx context.Context, id string) (links []*Link, err error) {
+	ctx, span := t.start(ctx, "GetLinks")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetLinks(ctx, id)
+}
+
+func (t *tracedSQL) GetMeta(ctx context.Context, id string) (meta []*Meta, err error) {
+	ctx, span := t.start(ctx, "GetMeta")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetMeta(ctx, id)
+}
+
+func (t *tracedSQL) GetOutbox(ctx context.Context, limit int) (entries []*Outbox, err error) {
+	ctx, span := t.start(ctx, "GetOutbox")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(entries)))
+		end(span, err)
+	}()
+	return t.ISQL.GetOutbox(ctx, limit)
+}
+
+func (t *tracedSQL) GetPassword(ctx context.Context, login string) (password string, err error) {
+	ctx, span := t.start(ctx, "GetPassword")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetPassword(ctx, login)
+}
+
+func (t *tracedSQL) GetRevokedTokens(ctx context.Context, after string) (ids []string, err error) {
+	ctx, span := t.start(ctx, "GetRevokedTokens")
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(ids)))
+		end(span, err)
+	}()
+	return t.ISQL.GetRevokedTokens(ctx, after)
+}
+
+func (t *tracedSQL) SetPassword(ctx context.Context, login string, password string) (err error) {
+	ctx, span := t.start(ctx, "SetPassword")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetPassword(ctx, login, password)
+}
+
+func (t *tracedSQL) GetTenants(ctx context.Context) (tenants []*Tenant, err error) {
+	ctx, span := t.start(ctx, "GetTenants")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetTenants(ctx)
+}
+
+func (t *tracedSQL) GetTokenGenerations(ctx context.Context) (generations map[string]int64, err error) {
+	ctx, span := t.start(ctx, "GetTokenGenerations")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetTokenGenerations(ctx)
+}
+
+func (t *tracedSQL) GetUsage(ctx context.Context, login string, period string) (u *Usage, err error) {
+	ctx, span := t.start(ctx, "GetUsage")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetUsage(ctx, login, period)
+}
+
+func (t *tracedSQL) GetUserGroups(ctx context.Context, login string) (groups []string, err error) {
+	ctx, span := t.start(ctx, "GetUserGroups")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetUserGroups(ctx, login)
+}
+
+func (t *tracedSQL) GetUserTenant(ctx context.Context, login string) (tenant string, err error) {
+	ctx, span := t.start(ctx, "GetUserTenant")
+	defer func() { end(span, err) }()
+	return t.ISQL.GetUserTenant(ctx, login)
+}
+
+func (t *tracedSQL) IndexContent(ctx context.Context, id string, content string) (err error) {
+	ctx, span := t.start(ctx, "IndexContent")
+	span.SetAttributes(attribute.Int("docsdb.content.length", len(content)))
+	defer func() { end(span, err) }()
+	return t.ISQL.IndexContent(ctx, id, content)
+}
+
+func (t *tracedSQL) IsAdmin(ctx context.Context, login string) (admin bool, err error) {
+	ctx, span := t.start(ctx, "IsAdmin")
+	defer func() { end(span, err) }()
+	return t.ISQL.IsAdmin(ctx, login)
+}
+
+func (t *tracedSQL) RevokeLogin(ctx context.Context, login string) (generation int64, err error) {
+	ctx, span := t.start(ctx, "RevokeLogin")
+	defer func() { end(span, err) }()
+	return t.ISQL.RevokeLogin(ctx, login)
+}
+
+func (t *tracedSQL) RevokeToken(ctx context.Context, id string, expiresAt string) (revoked bool, err error) {
+	ctx, span := t.start(ctx, "RevokeToken")
+	defer func() { end(span, err) }()
+	return t.ISQL.RevokeToken(ctx, id, expiresAt)
+}
+
+func (t *tracedSQL) SearchDocuments(ctx context.Context, filter *Filter, query string, content bool) (hits []*Hit, err error) {
+	ctx, span := t.start(ctx, "SearchDocuments")
+	span.SetAttributes(attribute.Bool("docsdb.search.content", content), attribute.Int("docsdb.filter.limit", filter.Limit))
+	defer func() {
+		span.SetAttributes(attribute.Int("docsdb.rows", len(hits)))
+		end(span, err)
+	}()
+	return t.ISQL.SearchDocuments(ctx, filter, query, content)
+}
+
+func (t *tracedSQL) SetBlob(ctx context.Context, blob *Blob) (err error) {
+	ctx, span := t.start(ctx, "SetBlob")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetBlob(ctx, blob)
+}
+
+func (t *tracedSQL) SetDeletion(ctx context.Context, d *Deletion) (err error) {
+	ctx, span := t.start(ctx, "SetDeletion")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetDeletion(ctx, d)
+}
+
+func (t *tracedSQL) SetExpiry(ctx context.Context, id string, expiresAt string) (err error) {
+	ctx, span := t.start(ctx, "SetExpiry")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetExpiry(ctx, id, expiresAt)
+}
+
+func (t *tracedSQL) SetMeta(ctx context.Context, id string, m *Meta) (err error) {
+	ctx, span := t.start(ctx, "SetMeta")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetMeta(ctx, id, m)
+}
+
+func (t *tracedSQL) SetOutboxDelivered(ctx context.Context, id int64, at string) (err error) {
+	ctx, span := t.start(ctx, "SetOutboxDelivered")
+	defer func() { end(span, err) }()
+	return t.ISQL.SetOutboxDelivered(ctx, id, at)
+}
+
+func (t *tracedSQL) UpdateDocument(ctx context.Context, d *Doc, JSON []byte) (err error) {
+	ctx, span := t.start(ctx, "UpdateDocument")
+	defer func() { end(span, err) }()
+	return t.ISQL.UpdateDocument(ctx, d, JSON)
+}
+
+func (t *tracedSQL) UseRefreshToken(ctx context.Context, hash string) (token *RefreshToken, err error) {
+	ctx, span := t.start(ctx, "UseRefreshToken")
+	defer func() { end(span, err) }()
+	return t.ISQL.UseRefreshToken(ctx, hash)
+}
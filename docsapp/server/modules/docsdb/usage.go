@@ -0,0 +1,43 @@
+package docsdb
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Usage is the model of the database table Usage: the requests of a user in a period
+// and the bytes of the answers to them. The periods are named by the caller, e.g. "2006-01-02" or "2006-01"
+type Usage struct {
+	Period   string `json:"period"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// AddUsage adds the requests and the bytes of u to the usage of login in u.Period,
+// u gets the sums. sql.ErrNoRows if there is no such user
+func (h *Handler) AddUsage(ctx context.Context, login string, u *Usage) (err error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Stmt(h.stmtAddUsage).ExecContext(ctx, u.Period, u.Requests, u.Bytes, login)
+	if err != nil {
+		return
+	}
+	err = tx.Stmt(h.stmtGetUsage).QueryRowContext(ctx, login, u.Period).Scan(&u.Requests, &u.Bytes)
+	if err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// GetUsage finds the usage of login in period, it is zero if login made no requests then
+func (h *Handler) GetUsage(ctx context.Context, login string, period string) (u *Usage, err error) {
+	u = &Usage{Period: period}
+	err = h.stmtGetUsage.QueryRowContext(ctx, login, period).Scan(&u.Requests, &u.Bytes)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
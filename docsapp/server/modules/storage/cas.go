@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// HashDir is the directory of the contents kept by their hashes, see HashName
+const HashDir = "sha256"
+
+var (
+	// ErrHash is the error of a hash which is not the hex sha256 of a content
+	ErrHash = errors.New("storage: the hash is not a hex sha256")
+	// ErrCorrupt is the error of a content which is not of its hash
+	ErrCorrupt = errors.New("storage: the content is not of its hash")
+)
+
+// ValidHash reports whether hash is a hex sha256, as the ones of Put are
+func ValidHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// HashName is the name of the content of hash, sha256/ab/cd/abcd... by the first bytes of it,
+// so no directory has too many files
+func HashName(hash string) string {
+	return Join(HashDir, hash[0:2], hash[2:4], hash)
+}
+
+// Put keeps the content of src by its hash and answers it with the size, the content kept already
+// is not written again. Nothing is left of src if it fails
+func (d Dir) Put(src io.Reader) (hash string, n int64, err error) {
+	dir := filepath.Join(string(d), HashDir)
+	err = os.MkdirAll(dir, DirPerm)
+	if err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(dir, ".put")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	n, err = io.Copy(io.MultiWriter(f, h), src)
+	if err == nil {
+		// the content is on the disk before it is renamed to its hash, a crash leaves no partial one there
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	err = f.Close()
+	if err != nil {
+		return "", 0, err
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	p, err := d.Path(HashName(hash))
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err = os.Stat(p); err == nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(p), DirPerm)
+	if err != nil {
+		return "", 0, err
+	}
+	err = os.Chmod(f.Name(), FilePerm)
+	if err != nil {
+		return "", 0, err
+	}
+	err = os.Rename(f.Name(), p)
+	if err != nil {
+		return "", 0, err
+	}
+	return
+}
+
+// Verify reads the content of hash and checks it is of it, ErrCorrupt if it is not
+func (d Dir) Verify(hash string) error {
+	if !ValidHash(hash) {
+		return ErrHash
+	}
+	f, err := d.Open(HashName(hash))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return ErrCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPut(t *testing.T) {
+	d := Dir(t.TempDir())
+	hash, n, err := d.Put(strings.NewReader("content"))
+	if err != nil || n != 7 || !ValidHash(hash) {
+		t.Fatalf("the content is put as %q, %d, %v", hash, n, err)
+	}
+	if name := HashName(hash); name != "sha256/"+hash[:2]+"/"+hash[2:4]+"/"+hash {
+		t.Errorf("the content is named %q", name)
+	}
+	again, _, err := d.Put(strings.NewReader("content"))
+	if err != nil || again != hash {
+		t.Errorf("the same content is put again as %q, %v", again, err)
+	}
+	entries, err := os.ReadDir(mustPath(t, d, HashDir))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("the temporary files are left: %v, %v", entries, err)
+	}
+	if b, err := d.ReadFile(HashName(hash)); err != nil || string(b) != "content" {
+		t.Errorf("the content kept is %q, %v", b, err)
+	}
+	if err = d.Verify(hash); err != nil {
+		t.Errorf("the content is %v", err)
+	}
+	if err = os.WriteFile(mustPath(t, d, HashName(hash)), []byte("changed"), FilePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Verify(hash); err != ErrCorrupt {
+		t.Errorf("the changed content is %v, want %v", err, ErrCorrupt)
+	}
+	if err = d.Verify("../a"); err != ErrHash {
+		t.Errorf("a wrong hash is %v, want %v", err, ErrHash)
+	}
+}
+
+func mustPath(t *testing.T, d Dir, name string) string {
+	t.Helper()
+	p, err := d.Path(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,124 @@
+// Package storage keeps the files of the documents in a directory. A file is known by its name,
+// the slash separated path of it under the directory, e.g. login/file.ext, the same on every platform.
+// The names of the files stored before, with a leading separator or with backslashes, are read as well.
+// Put keeps a content by its hash under HashDir instead, the same content once whatever its names are
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// the permissions of what is made in a Dir
+const (
+	DirPerm  os.FileMode = 0o755
+	FilePerm os.FileMode = 0o644
+)
+
+// ErrOutside is the error of a name or a path out of the directory
+var ErrOutside = errors.New("storage: the file is out of the directory")
+
+// Dir is the directory the files are kept in
+type Dir string
+
+// Path is the path of the file of name in d
+func (d Dir) Path(name string) (string, error) {
+	name = strings.Replace(name, `\`, "/", -1)
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", ErrOutside
+	}
+	return filepath.Join(string(d), filepath.FromSlash(name)), nil
+}
+
+// Name is the name of the file at p in d
+func (d Dir) Name(p string) (string, error) {
+	rel, err := filepath.Rel(string(d), p)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutside
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Join makes a name of its elements, the ones of the users are to have no separators
+func Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Create makes the file of name with the directories of it, an existing one is truncated
+func (d Dir) Create(name string) (*os.File, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(p), DirPerm)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePerm)
+}
+
+// Open opens the file of name for reading
+func (d Dir) Open(name string) (*os.File, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// ReadFile reads the whole file of name
+func (d Dir) ReadFile(name string) ([]byte, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// Stat describes the file of name
+func (d Dir) Stat(name string) (os.FileInfo, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+// Remove removes the file of name, a missing one is no error
+func (d Dir) Remove(name string) error {
+	p, err := d.Path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Usage is the number and the bytes of the files in d, a missing d has none
+func (d Dir) Usage() (files, bytes int64, err error) {
+	err = filepath.Walk(string(d), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files++
+			bytes += fi.Size()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	return
+}
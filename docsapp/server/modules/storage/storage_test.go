@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	d := Dir("data")
+	for _, c := range []struct {
+		name string
+		want string
+	}{
+		{"login/a.txt", filepath.Join("data", "login", "a.txt")},
+		{"/login/a.txt", filepath.Join("data", "login", "a.txt")},
+		{`\login\a.txt`, filepath.Join("data", "login", "a.txt")},
+		{"login/../other/a.txt", filepath.Join("data", "other", "a.txt")},
+	} {
+		got, err := d.Path(c.name)
+		if err != nil || got != c.want {
+			t.Errorf("the path of %q is %q, %v, want %q", c.name, got, err, c.want)
+		}
+	}
+	for _, name := range []string{"", "/", "..", "../a.txt", `..\a.txt`, "login/../../a.txt"} {
+		if got, err := d.Path(name); err != ErrOutside {
+			t.Errorf("the path of %q is %q, %v, want %v", name, got, err, ErrOutside)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	d := Dir("data")
+	got, err := d.Name(filepath.Join("data", "login", "a.txt"))
+	if err != nil || got != "login/a.txt" {
+		t.Errorf("the name is %q, %v, want login/a.txt", got, err)
+	}
+	if got, err = d.Name(filepath.Join("other", "a.txt")); err != ErrOutside {
+		t.Errorf("the name of a file out of the directory is %q, %v", got, err)
+	}
+	if got := Join("login", "a.txt"); got != "login/a.txt" {
+		t.Errorf("Join makes %q", got)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := Dir(dir)
+	f, err := d.Create("login/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("content")
+	f.Close()
+	b, err := d.ReadFile("/login/a.txt")
+	if err != nil || string(b) != "content" {
+		t.Errorf("the file is %q, %v", b, err)
+	}
+	fi, err := d.Stat("login/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	di, err := os.Stat(filepath.Join(dir, "login"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Windows has no permission bits but the read-only one, elsewhere the umask may take some away
+	if runtime.GOOS != "windows" && (fi.Mode().Perm()&^FilePerm != 0 || fi.Mode().Perm()&0o600 != 0o600 ||
+		di.Mode().Perm()&^DirPerm != 0 || di.Mode().Perm()&0o700 != 0o700) {
+		t.Errorf("the permissions are %v and %v of the directory", fi.Mode().Perm(), di.Mode().Perm())
+	}
+	if err = d.Remove("login/a.txt"); err != nil {
+		t.Error(err)
+	}
+	if err = d.Remove("login/a.txt"); err != nil {
+		t.Errorf("removing a missing file: %v", err)
+	}
+	if _, err = d.Create("../a.txt"); err != ErrOutside {
+		t.Errorf("a file out of the directory is made: %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	d := Dir(t.TempDir())
+	for name, content := range map[string]string{"ann/a.txt": "abc", "bob/b.txt": "de"} {
+		f, err := d.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		f.Close()
+	}
+	files, bytes, err := d.Usage()
+	if err != nil || files != 2 || bytes != 5 {
+		t.Errorf("the usage is %d files of %d bytes, %v, want 2 of 5", files, bytes, err)
+	}
+	files, bytes, err = Dir(filepath.Join(string(d), "none")).Usage()
+	if err != nil || files != 0 || bytes != 0 {
+		t.Errorf("a missing directory has %d files of %d bytes, %v", files, bytes, err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const contentTypeXML = "application/xml; charset=utf-8"
+
+// fields are the Response and the Data of outModel, in XML every one is an entry named by its key
+type fields map[string]interface{}
+
+// xmlWriter answers the requests preferring XML, sendJSON encodes the models as XML for it
+type xmlWriter struct {
+	http.ResponseWriter
+}
+
+func (x *xmlWriter) Flush() {
+	if f, ok := x.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// prefersXML reports whether the Accept of r ranks application/xml or text/xml over application/json,
+// the wildcards are taken for JSON
+func prefersXML(r *http.Request) bool {
+	var xmlQ, jsonQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/xml", "text/xml":
+			if q > xmlQ {
+				xmlQ = q
+			}
+		case "application/json", "application/*", "*/*":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		}
+	}
+	return xmlQ > jsonQ
+}
+
+// contentTypeOf is the content type of the models answered with w
+func contentTypeOf(w http.ResponseWriter) string {
+	if _, ok := w.(*xmlWriter); ok {
+		return contentTypeXML
+	}
+	return contentTypeJSON
+}
+
+// marshalModel encodes model in the format of w
+func marshalModel(w http.ResponseWriter, model *outModel) ([]byte, error) {
+	if _, ok := w.(*xmlWriter); !ok {
+		return json.Marshal(model)
+	}
+	body, err := xml.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// remarshalModel encodes modelJSON, an outModel encoded as JSON, in the format of w
+func remarshalModel(w http.ResponseWriter, modelJSON []byte) ([]byte, error) {
+	if _, ok := w.(*xmlWriter); !ok {
+		return modelJSON, nil
+	}
+	model := &outModel{}
+	err := json.Unmarshal(modelJSON, model)
+	if err != nil {
+		return nil, err
+	}
+	return marshalModel(w, model)
+}
+
+// MarshalXML encodes the fields ordered by key as <entry key="...">, the slices as their <item> elements
+func (f fields) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	err = e.EncodeToken(start)
+	if err != nil {
+		return
+	}
+	for _, k := range keys {
+		entry := xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}}}
+		err = encodeValue(e, entry, f[k])
+		if err != nil {
+			return
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeValue encodes v as the element start, the maps as fields
+func encodeValue(e *xml.Encoder, start xml.StartElement, v interface{}) (err error) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return fields(m).MarshalXML(e, start)
+	case fields:
+		return m.MarshalXML(e, start)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return e.EncodeElement(v, start)
+	}
+	err = e.EncodeToken(start)
+	if err != nil {
+		return
+	}
+	item := xml.StartElement{Name: xml.Name{Local: "item"}}
+	for i := 0; i < rv.Len(); i++ {
+		err = encodeValue(e, item, rv.Index(i).Interface())
+		if err != nil {
+			return
+		}
+	}
+	return e.EncodeToken(start.End())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestPrefersXML(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/json":                  false,
+		"application/xml":                   true,
+		"text/xml, application/json;q=0.5":  true,
+		"application/xml;q=0.5, */*":        false,
+		"application/json, application/xml": false,
+		"text/html,application/xml;q=0.9,*/*;q=0.8": true,
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		if got := prefersXML(r); got != want {
+			t.Errorf("Accept %q: %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestModelsAreAnsweredAsXML(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "xmllogin")
+	err := myDB.CreateDocument(httptest.NewRequest("GET", "/", nil).Context(), &docsdb.Doc{ID: "1", Name: "notes", Grant: []string{"xmllogin"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", routes["docs"]+"?"+url.Values{tokenQuery: {token}}.Encode(), nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != contentTypeXML {
+		t.Fatalf("the content type is %q, want %q", ct, contentTypeXML)
+	}
+	var envelope struct {
+		Entries []struct {
+			Key  string `xml:"key,attr"`
+			Docs []struct {
+				ID    string   `xml:"id"`
+				Name  string   `xml:"name"`
+				Grant []string `xml:"grant"`
+			} `xml:"item"`
+		} `xml:"data>entry"`
+	}
+	err = xml.Unmarshal(w.Body.Bytes(), &envelope)
+	if err != nil {
+		t.Fatalf("%v in %q", err, w.Body.String())
+	}
+	if len(envelope.Entries) != 1 || envelope.Entries[0].Key != "docs" || len(envelope.Entries[0].Docs) != 1 ||
+		envelope.Entries[0].Docs[0].Name != "notes" || strings.Join(envelope.Entries[0].Docs[0].Grant, ",") != "xmllogin" {
+		t.Errorf("the answer is %s", w.Body.String())
+	}
+	r = httptest.NewRequest("GET", routes["docs"], nil)
+	r.Header.Set("Accept", "text/xml")
+	w = httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, r)
+	var failure struct {
+		Code int `xml:"error>code"`
+	}
+	err = xml.Unmarshal(w.Body.Bytes(), &failure)
+	if err != nil || failure.Code != statusNotAuthorized {
+		t.Errorf("the error is %+v, %v in %q, want %d", failure, err, w.Body.String(), statusNotAuthorized)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	// outboxInterval is how often the outbox is read besides after the uploads, for the entries a crash has left
+	outboxInterval = 30 * time.Second
+	// outboxBatch is the number of the entries read at a time
+	outboxBatch = 100
+	// outboxKeep is how long the delivered entries are kept
+	outboxKeep = 24 * time.Hour
+)
+
+// outboxLock keeps one delivery of the outbox at a time, so an entry is told once by the process
+var outboxLock sync.Mutex
+
+// withOutbox is the context the uploads, the fetches and the conversions of login write the action to the outbox with
+func withOutbox(ctx context.Context, action, login string) context.Context {
+	return docsdb.WithOutbox(ctx, &docsdb.Outbox{Action: action, Login: login, Created: time.Now().Format(timeFormat)})
+}
+
+// startOutbox delivers the outbox after an upload has written to it, it doesn't wait for the hooks
+func startOutbox() {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		err := deliverOutbox(context.Background())
+		if err != nil {
+			log.Printf("the outbox: %+v", err)
+		}
+	}()
+}
+
+// outboxLoop delivers the outbox at the start and every outboxInterval until the shutdown, startLoop runs it.
+// The entries of a process which has ended before telling them are told then
+func outboxLoop() {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for run := !stopped(); run; run = nextTick(ticker) {
+		err := deliverOutbox(context.Background())
+		if err != nil {
+			log.Printf("the outbox: %+v", err)
+		}
+	}
+}
+
+// deliverOutbox tells the hooks and the feed of the login of every entry of the outbox not delivered yet,
+// the earliest first, and marks it delivered. It stops at the first entry failing, it is told the next time
+func deliverOutbox(ctx context.Context) error {
+	outboxLock.Lock()
+	defer outboxLock.Unlock()
+	for {
+		entries, err := myDB.GetOutbox(ctx, outboxBatch)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, e := range entries {
+			err = deliverEntry(ctx, e)
+			if err == nil {
+				err = myDB.SetOutboxDelivered(ctx, e.ID, time.Now().Format(timeFormat))
+			}
+			if err != nil {
+				return errors.Wrapf(err, "entry %d", e.ID)
+			}
+		}
+		if len(entries) < outboxBatch {
+			return nil
+		}
+	}
+}
+
+// deliverEntry publishes e to the feed of its login and calls the hooks with it, their errors are logged only.
+// The hooks are left out of a file outside the data directory
+func deliverEntry(ctx context.Context, e *docsdb.Outbox) error {
+	publish(e.Login, event{Type: "document", Data: e})
+	hooks.RLock()
+	all := append(append([]uploadHook(nil), hooks.registered...), hooks.commands...)
+	hooks.RUnlock()
+	if len(all) == 0 {
+		return nil
+	}
+	u := &uploadEvent{Action: e.Action, Login: e.Login, Doc: e.Doc}
+	if e.Doc.File {
+		stored, err := contentName(ctx, e.Doc.Name)
+		if err != nil {
+			return err
+		}
+		u.Path, err = store.Path(stored)
+		if err != nil {
+			log.Printf("hooks %s: %v", e.Doc.ID, err)
+			return nil
+		}
+	}
+	callHooks(ctx, all, u)
+	return nil
+}
+
+// purgeOutbox deletes the entries of the outbox delivered outboxKeep ago
+func purgeOutbox(ctx context.Context) (int64, error) {
+	return myDB.ClearOutbox(ctx, time.Now().Add(-outboxKeep).Format(timeFormat))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestOutboxLeftByACrashIsDeliveredOnce(t *testing.T) {
+	useDB(t, inmem.New())
+	ctx := context.Background()
+	if err := myDB.AddUser(ctx, &docsdb.User{Login: "outboxlogin"}); err != nil {
+		t.Fatal(err)
+	}
+	// the upload has committed but the process has ended before telling it
+	octx := docsdb.WithOutbox(ctx, &docsdb.Outbox{Action: hookCreated, Login: "outboxlogin", Created: "2019-01-01 00:00:00"})
+	if err := myDB.CreateDocument(octx, &docsdb.Doc{ID: "o1", Name: "notes", Grant: []string{"outboxlogin"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chanHook, 2)
+	registerHook(events)
+	defer func() { hooks.registered = nil }()
+	feed := subscribe("outboxlogin")
+	defer unsubscribe("outboxlogin", feed)
+	for i := 0; i < 2; i++ {
+		if err := deliverOutbox(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("the hook is told %d times, want once", len(events))
+	}
+	if e := <-events; e.Action != hookCreated || e.Login != "outboxlogin" || e.Doc.ID != "o1" || e.Doc.Version != 1 {
+		t.Errorf("the hook is told %+v", e)
+	}
+	select {
+	case e := <-feed:
+		if o, ok := e.Data.(*docsdb.Outbox); e.Type != "document" || !ok || o.Doc.Name != "notes" {
+			t.Errorf("the feed gets %+v", e)
+		}
+	default:
+		t.Error("the feed is not told")
+	}
+	if left, err := myDB.GetOutbox(ctx, -1); err != nil || len(left) != 0 {
+		t.Errorf("the outbox has %v left, %v", left, err)
+	}
+}
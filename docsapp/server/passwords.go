@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt cost of the passwords, the hashes of another one are made again at the sign-in
+const passwordCost = bcrypt.DefaultCost
+
+// unknownLoginHash is compared with the password of a sign-in of an unknown login
+var unknownLoginHash string
+
+func init() {
+	hash, err := hashPassword(unknownLoginPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
+	unknownLoginHash = hash
+}
+
+// hashPassword is the bcrypt hash of password kept in place of it, bcrypt.ErrPasswordTooLong
+// if it is longer than 72 bytes
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
+// isPasswordHash reports whether the password of a user is a bcrypt hash, the ones kept before the hashing are not
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// checkPassword compares password with the stored one of a user, a hash or a password kept before the hashing,
+// rehash is whether the stored one is to be hashed again: it is not a hash or it is of another cost
+func checkPassword(stored, password string) (match, rehash bool) {
+	if !isPasswordHash(stored) {
+		match = doesPasswordMatch(password, stored)
+		return match, match
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost != passwordCost
+}
+
+// rehashPassword keeps the hash of the password login has signed in with in place of what it had,
+// the sign-in goes on if it fails, it is done at the next one
+func rehashPassword(ctx context.Context, login, password string) {
+	hash, err := hashPassword(password)
+	if err == nil {
+		err = myDB.SetPassword(ctx, login, hash)
+	}
+	if err != nil {
+		log.Printf("the password of %s is not hashed: %v", login, err)
+	}
+}
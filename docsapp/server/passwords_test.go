@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestPasswordsAreHashed(t *testing.T) {
+	useDB(t, inmem.New())
+	ctx := context.Background()
+	signIn(t, "hashedlogin")
+	stored, err := myDB.GetPassword(ctx, "hashedlogin")
+	if err != nil || !isPasswordHash(stored) {
+		t.Errorf("the password kept is %q, %v", stored, err)
+	}
+
+	// a user added before the hashing has the password itself until it signs in
+	err = myDB.AddUser(ctx, &docsdb.User{Login: "plainlogin", Password: "password1", Tenant: docsdb.DefaultTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{loginQuery: {"plainlogin"}, passwordQuery: {"password2"}}
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	if model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("a wrong password gets %+v", model.Error)
+	}
+	if stored, _ = myDB.GetPassword(ctx, "plainlogin"); stored != "password1" {
+		t.Errorf("a failed sign-in keeps %q", stored)
+	}
+	values[passwordQuery] = []string{"password1"}
+	for i := 0; i < 2; i++ {
+		model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+		if model.Error != nil {
+			t.Fatalf("sign-in %d: %+v", i, model.Error)
+		}
+		stored, _ = myDB.GetPassword(ctx, "plainlogin")
+		if match, rehash := checkPassword(stored, "password1"); !isPasswordHash(stored) || !match || rehash {
+			t.Errorf("sign-in %d keeps %q", i, stored)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+const (
+	previewRoute = "preview"
+	// previewDir is the directory of store the previews are kept in by the ids of their documents,
+	// the logins have no dots so it is nobody's
+	previewDir = ".previews"
+	// previewSide is the greatest width and height of a preview
+	previewSide = 256
+	// previewTextMax is how much of a text its preview shows
+	previewTextMax = 1024
+	previewMargin  = 8
+	previewFont    = 10
+)
+
+// previewName is the name of the preview of the document with id in store
+func previewName(id string) string {
+	return storage.Join(previewDir, id+".png")
+}
+
+// previewKind is how the preview of doc is made: "image" resizes the picture, "convert" resizes the first page
+// the converter of convert.commands to image/png draws, "text" draws the beginning of the text or of the JSON
+// of a document without a file. It is "" if doc has no preview
+func previewKind(doc *docsdb.Doc) string {
+	if !doc.File {
+		if len(doc.JSON) > 0 {
+			return "text"
+		}
+		return ""
+	}
+	mediaType := embedType(doc)
+	switch {
+	case imageEncoders[mediaType] != nil:
+		return "image"
+	case config.Convert.Commands[mediaType+">image/png"] != nil:
+		return "convert"
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == mimeGeoJSON:
+		return "text"
+	}
+	return ""
+}
+
+// previewURL is the url of the preview of doc, "" if it has none
+func previewURL(r *http.Request, doc *docsdb.Doc) string {
+	if previewKind(doc) == "" {
+		return ""
+	}
+	return publicURL(r, routes["docsID"]+doc.ID+"/"+previewRoute)
+}
+
+// startPreview starts the job of login making the preview of doc it has uploaded,
+// the preview of the file doc had before is dropped at once
+func startPreview(login string, doc *docsdb.Doc) {
+	err := store.Remove(previewName(doc.ID))
+	if err != nil {
+		log.Printf("preview %s: %v", doc.ID, err)
+	}
+	if previewKind(doc) == "" {
+		return
+	}
+	j, err := newJob(previewRoute, login)
+	if err != nil {
+		log.Printf("preview %s: %v", doc.ID, err)
+		return
+	}
+	go func() {
+		err := makePreview(context.Background(), doc)
+		if err != nil {
+			log.Printf("preview %s: %v", doc.ID, err)
+		}
+		j.finish(doc.ID, err)
+	}()
+}
+
+// makePreview draws the preview of doc as png of previewSide at most into store
+func makePreview(ctx context.Context, doc *docsdb.Doc) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, convertTimeout)
+	defer cancel()
+	var dc *gg.Context
+	switch previewKind(doc) {
+	case "image":
+		dc, err = previewImage(ctx, doc.Name)
+	case "convert":
+		dc, err = previewConverted(ctx, doc)
+	case "text":
+		dc, err = previewText(ctx, doc)
+	default:
+		return fmt.Errorf("%s has no preview", embedType(doc))
+	}
+	if err != nil {
+		return
+	}
+	name := previewName(doc.ID)
+	_, span := startSpan(ctx, "storage.write", attribute.String("file.path", name))
+	defer func() { endSpan(span, err) }()
+	f, err := store.Create(name)
+	if err != nil {
+		return
+	}
+	err = dc.EncodePNG(f)
+	if err != nil {
+		f.Close()
+		store.Remove(name)
+		return
+	}
+	return f.Close()
+}
+
+// previewImage resizes the picture of the file of name, see previewFit
+func previewImage(ctx context.Context, name string) (dc *gg.Context, err error) {
+	f, err := openFile(ctx, name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return
+	}
+	return previewFit(m), nil
+}
+
+// previewConverted resizes what the converter of doc to image/png draws
+func previewConverted(ctx context.Context, doc *docsdb.Doc) (dc *gg.Context, err error) {
+	stored, err := contentName(ctx, doc.Name)
+	if err != nil {
+		return
+	}
+	srcPath, err := store.Path(stored)
+	if err != nil {
+		return
+	}
+	dir, err := ioutil.TempDir("", previewRoute)
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	f, err := runConverter(ctx, config.Convert.Commands[embedType(doc)+">image/png"], srcPath, dir, ".png")
+	if err != nil {
+		return
+	}
+	name := f.Name()
+	f.Close()
+	m, err := gg.LoadPNG(name)
+	if err != nil {
+		return
+	}
+	return previewFit(m), nil
+}
+
+// previewFit draws m scaled down to fit previewSide, a smaller one is drawn as it is
+func previewFit(m image.Image) *gg.Context {
+	size := m.Bounds().Size()
+	scale := math.Min(1, float64(previewSide)/math.Max(float64(size.X), float64(size.Y)))
+	width, height := math.Max(1, math.Round(float64(size.X)*scale)), math.Max(1, math.Round(float64(size.Y)*scale))
+	dc := gg.NewContext(int(width), int(height))
+	dc.Scale(scale, scale)
+	dc.DrawImage(m, -m.Bounds().Min.X, -m.Bounds().Min.Y)
+	return dc
+}
+
+// previewText draws up to previewTextMax bytes of the text of doc in black on white, the lines wrapped,
+// what is not UTF-8 is not drawn
+func previewText(ctx context.Context, doc *docsdb.Doc) (dc *gg.Context, err error) {
+	b := doc.JSON
+	if doc.File {
+		var f *os.File
+		f, err = openFile(ctx, doc.Name)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		b, err = io.ReadAll(io.LimitReader(f, previewTextMax))
+		if err != nil {
+			return
+		}
+	} else if len(b) > previewTextMax {
+		b = b[:previewTextMax]
+	}
+	// the limit may cut the last character
+	for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	var text string
+	if utf8.Valid(b) {
+		text = strings.ReplaceAll(string(b), "\t", "    ")
+	}
+	dc = gg.NewContext(previewSide, previewSide)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	dc.SetRGB(0, 0, 0)
+	dc.SetFontFace(truetype.NewFace(regularFont, &truetype.Options{Size: previewFont}))
+	dc.DrawStringWrapped(text, previewMargin, previewMargin, 0, 0, previewSide-2*previewMargin, 1.2, gg.AlignLeft)
+	return
+}
+
+// previewHandler serves GET /docs/{id}/preview, the png of the document made at its upload
+// or at the first request if it has no preview yet
+func previewHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	doc, err := docAccess(r, id, false)
+	if err != nil {
+		return
+	}
+	if previewKind(doc) == "" {
+		errorHandler(statusInvalidParameters, "the document has no preview", &err)
+		return
+	}
+	name := previewName(doc.ID)
+	_, err = store.Stat(name)
+	if os.IsNotExist(err) {
+		err = makePreview(r.Context(), doc)
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	f, err := store.Open(name)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", fmt.Sprint(fi.Size()))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if r.Method == "GET" {
+		_, err = io.Copy(w, f)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+	}
+	return
+}
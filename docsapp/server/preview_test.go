@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+func TestListingLinksThePreviews(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	token := signIn(t, "previewlogin")
+	f, err := store.Create("previewlogin/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewGray(image.Rect(0, 0, 640, 320)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "previewlogin/a.png", Mime: "image/png", File: true, Grant: []string{"previewlogin"}},
+		{ID: "2", Name: "previewlogin/b.zip", Mime: "application/zip", File: true, Grant: []string{"previewlogin"}},
+	} {
+		if err = myDB.CreateDocument(ctx, d, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?token="+token, nil))
+	docs, _ := model.Data["docs"].([]interface{})
+	if model.Error != nil || len(docs) != 2 {
+		t.Fatalf("the listing is %+v", model)
+	}
+	urls := map[string]interface{}{}
+	for _, v := range docs {
+		d := v.(map[string]interface{})
+		urls[d["id"].(string)] = d["preview_url"]
+	}
+	if u, _ := urls["1"].(string); u != "http://example.com"+routes["docsID"]+"1/"+previewRoute {
+		t.Errorf("the preview url of the picture is %v", urls["1"])
+	}
+	if urls["2"] != nil {
+		t.Errorf("the archive has the preview url %v", urls["2"])
+	}
+
+	w := httptest.NewRecorder()
+	makeHandler(routes["docsID"]+"{id}", docsIDHandler)(w, httptest.NewRequest("GET", routes["docsID"]+"1/"+previewRoute+"?token="+token, nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("the preview is %d %s %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if _, err = store.Stat(previewName("1")); err != nil {
+		t.Errorf("the preview is not kept: %v", err)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+"2/"+previewRoute+"?token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("the preview of the archive is %+v", model.Error)
+	}
+}
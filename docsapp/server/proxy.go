@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cleanBasePath makes the base_path of config.json either empty or /a/b without the trailing slash
+func cleanBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// withBasePath strips the base path off the requests so the routes are served under it.
+// A request without the base path is served as is, the proxy may have stripped it already
+func withBasePath(next http.Handler) http.Handler {
+	if config.BasePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := strings.TrimPrefix(r.URL.Path, config.BasePath); p != r.URL.Path && (p == "" || p[0] == '/') {
+			if p == "" {
+				p = "/"
+			}
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = p
+			r2.URL.RawPath = ""
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// firstForwarded is the value set by the proxy nearest to the client
+func firstForwarded(r *http.Request, header string) string {
+	return strings.TrimSpace(strings.Split(r.Header.Get(header), ",")[0])
+}
+
+// publicURL is the absolute URL of the route as the client sees it.
+// Behind a trusted proxy X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix are taken over
+// the scheme, the host and the base path of the request
+func publicURL(r *http.Request, route string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	prefix := config.BasePath
+	if fromTrustedProxy(r) {
+		if v := firstForwarded(r, "X-Forwarded-Proto"); v == "http" || v == "https" {
+			scheme = v
+		}
+		if v := firstForwarded(r, "X-Forwarded-Host"); v != "" {
+			host = v
+		}
+		if v := firstForwarded(r, "X-Forwarded-Prefix"); v != "" {
+			prefix = cleanBasePath(v)
+		}
+	}
+	return scheme + "://" + host + prefix + route
+}
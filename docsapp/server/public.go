@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+// publicDocsHandler lists the public documents of the tenant, the default one if there is none, without a token.
+// The unlisted documents are not there, they are read by the ones knowing their id
+func publicDocsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	filter, err := listFilter(r)
+	if err != nil {
+		return
+	}
+	filter.Tenant = r.Form.Get(tenantQuery)
+	if filter.Tenant == "" {
+		filter.Tenant = docsdb.DefaultTenant
+	}
+	return sendListing(w, r, filter)
+}
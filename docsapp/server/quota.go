@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	dayPeriod   = "2006-01-02"
+	monthPeriod = "2006-01"
+)
+
+// quotaLimits are the requests a user makes and the bytes of the answers to them a day and a month, 0 is no limit
+type quotaLimits struct {
+	DailyRequests   int64 `json:"daily_requests"`
+	MonthlyRequests int64 `json:"monthly_requests"`
+	DailyBytes      int64 `json:"daily_bytes"`
+	MonthlyBytes    int64 `json:"monthly_bytes"`
+}
+
+// quotaConfig is the "quotas" of config.json, Default is of the users Users doesn't list.
+// The days and the months are of UTC
+type quotaConfig struct {
+	Default quotaLimits            `json:"default"`
+	Users   map[string]quotaLimits `json:"users"`
+}
+
+// quotaOf is the quota of login
+func quotaOf(login string) quotaLimits {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if q, ok := config.Quotas.Users[login]; ok {
+		return q
+	}
+	return config.Quotas.Default
+}
+
+type meterKey struct{}
+
+// meter counts the bytes of the answer of a request, login is of the token the request was signed in with
+type meter struct {
+	http.ResponseWriter
+	login string
+	bytes int64
+}
+
+func (m *meter) Write(b []byte) (n int, err error) {
+	n, err = m.ResponseWriter.Write(b)
+	m.bytes += int64(n)
+	return
+}
+
+func (m *meter) Flush() {
+	if f, ok := m.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withMeter counts the answer of the request of ctx with w
+func withMeter(ctx context.Context, w http.ResponseWriter) (context.Context, *meter) {
+	m := &meter{ResponseWriter: w}
+	return context.WithValue(ctx, meterKey{}, m), m
+}
+
+// periodsOf are the day and the month of t with the times they end at
+func periodsOf(t time.Time) (day, month string, dayReset, monthReset time.Time) {
+	t = t.UTC()
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return t.Format(dayPeriod), t.Format(monthPeriod), dayStart.AddDate(0, 0, 1), monthStart.AddDate(0, 1, 0)
+}
+
+// checkQuota is called by getLogin once login is known: the request is counted for login
+// and refused with statusTooManyRequests if a quota of login is used up.
+// X-RateLimit-Limit, -Remaining and -Reset tell the requests left in the tightest period and when it ends
+// in unix seconds, Retry-After tells the seconds until a used up quota is renewed
+func checkQuota(ctx context.Context, login string) (err error) {
+	m, ok := ctx.Value(meterKey{}).(*meter)
+	if !ok || m.login != "" {
+		return
+	}
+	m.login = login
+	q := quotaOf(login)
+	if q == (quotaLimits{}) {
+		return
+	}
+	day, month, dayReset, monthReset := periodsOf(time.Now())
+	d, err := myDB.GetUsage(ctx, login, day)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	mo, err := myDB.GetUsage(ctx, login, month)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	limit, remaining, reset := int64(-1), int64(-1), time.Time{}
+	for _, p := range []struct {
+		limit, used int64
+		reset       time.Time
+	}{{q.DailyRequests, d.Requests, dayReset}, {q.MonthlyRequests, mo.Requests, monthReset}} {
+		if p.limit > 0 && (remaining < 0 || p.limit-p.used < remaining) {
+			limit, remaining, reset = p.limit, p.limit-p.used, p.reset
+		}
+	}
+	h := m.Header()
+	if limit > 0 {
+		if remaining < 0 {
+			remaining = 0
+		}
+		h.Set("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+		h.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+	var used string
+	switch {
+	case q.DailyRequests > 0 && d.Requests >= q.DailyRequests:
+		used, reset = "the daily requests", dayReset
+	case q.MonthlyRequests > 0 && mo.Requests >= q.MonthlyRequests:
+		used, reset = "the monthly requests", monthReset
+	case q.DailyBytes > 0 && d.Bytes >= q.DailyBytes:
+		used, reset = "the daily bytes", dayReset
+	case q.MonthlyBytes > 0 && mo.Bytes >= q.MonthlyBytes:
+		used, reset = "the monthly bytes", monthReset
+	default:
+		return
+	}
+	h.Set("Retry-After", strconv.FormatInt(int64(time.Until(reset)/time.Second)+1, 10))
+	errorHandler(statusTooManyRequests, fmt.Sprintf("the quota of %s is used up until %s", used, reset.Format(timeFormat)), &err)
+	return
+}
+
+// recordUsage adds the request of m and the bytes of its answer to the usage of the user who made it
+func recordUsage(ctx context.Context, m *meter) {
+	if m.login == "" {
+		return
+	}
+	day, month, _, _ := periodsOf(time.Now())
+	for _, period := range []string{day, month} {
+		err := myDB.AddUsage(ctx, m.login, &docsdb.Usage{Period: period, Requests: 1, Bytes: m.bytes})
+		if err != nil {
+			log.Printf("%+v", errors.Wrapf(err, "usage of %s", m.login))
+		}
+	}
+}
+
+// usageHandler answers GET /me/usage with the usage of the user of the token this day and this month
+// and the quota, the requests to it are not counted
+func usageHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "POST", "PUT", "DELETE", "HEAD", "CONNECT", "OPTIONS", "TRACE", "PATCH":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	day, month, _, _ := periodsOf(time.Now())
+	d, err := myDB.GetUsage(r.Context(), login, day)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	mo, err := myDB.GetUsage(r.Context(), login, month)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	return sendJSON(w, &outModel{Response: map[string]interface{}{"login": login, "day": d, "month": mo, "quota": quotaOf(login)}})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestQuotaRefusesTheRequestsOverIt(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "quotalogin")
+	config.Quotas = quotaConfig{Default: quotaLimits{DailyRequests: 2}}
+	defer func() { config.Quotas = quotaConfig{} }()
+	list := routes["docs"] + "?" + url.Values{tokenQuery: {token}}.Encode()
+	for i := 0; i < 2; i++ {
+		if model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", list, nil)); model.Error != nil && model.Error.Code == statusTooManyRequests {
+			t.Fatalf("request %d: %+v", i+1, model.Error)
+		}
+	}
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("GET", list, nil))
+	if w.Code != statusTooManyRequests || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("the third request got %d with %v remaining, want %d with 0", w.Code, w.Header().Get("X-RateLimit-Remaining"), statusTooManyRequests)
+	}
+	model := do(t, routes["meUsage"], usageHandler, httptest.NewRequest("GET", routes["meUsage"]+"?"+url.Values{tokenQuery: {token}}.Encode(), nil))
+	if day := model.Response["day"].(map[string]interface{}); model.Error != nil || day["requests"] != float64(2) {
+		t.Errorf("the usage is %+v, want 2 requests today", model)
+	}
+}
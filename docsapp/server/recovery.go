@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/satori/go.uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDRe is of the request ids taken from the clients and the proxies, the others are replaced
+var requestIDRe = regexp.MustCompile(`^[\w.-]{1,64}$`)
+
+// panics counts the panics of the handlers for the docsapp_panics_total metric
+var panics int64
+
+// panicWriter tells whether the answer has begun so a panic after it is not answered twice
+type panicWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (p *panicWriter) WriteHeader(status int) {
+	p.wrote = true
+	p.ResponseWriter.WriteHeader(status)
+}
+
+func (p *panicWriter) Write(b []byte) (int, error) {
+	p.wrote = true
+	return p.ResponseWriter.Write(b)
+}
+
+func (p *panicWriter) Flush() {
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requestID is the X-Request-ID of r if it is sane, a new one otherwise
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); requestIDRe.MatchString(id) {
+		return id
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "-"
+	}
+	return id.String()
+}
+
+// recoverPanics answers every request with its X-Request-ID and a panic of next with 500 and the id,
+// the panic is logged with the stack and counted. http.ErrAbortHandler is let through, it is no failure
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+		pw := &panicWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			atomic.AddInt64(&panics, 1)
+			log.Printf("panic: %v\nrequest %s: %s %s\n%s", v, id, r.Method, r.URL.Path, debug.Stack())
+			if pw.wrote {
+				return
+			}
+			var out http.ResponseWriter = w
+			if prefersXML(r) {
+				out = &xmlWriter{w}
+			}
+			model := &outModel{Banner: maintenanceBanner(), Error: &errorModel{Code: statusNotExpected, Text: statusText[statusNotExpected], RequestID: id}}
+			body, err := marshalModel(out, model)
+			if err != nil {
+				http.Error(w, statusText[statusNotExpected], statusNotExpected)
+				return
+			}
+			w.Header().Set("Content-Type", contentTypeOf(out))
+			w.WriteHeader(statusNotExpected)
+			w.Write(body)
+		}()
+		next.ServeHTTP(pw, r)
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPanicIsAnsweredWithTheRequestID(t *testing.T) {
+	before := panics
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	r := httptest.NewRequest("GET", "/docs", nil)
+	r.Header.Set(requestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != statusNotExpected || w.Header().Get(requestIDHeader) != "req-1" {
+		t.Fatalf("got %d with the id %q, want %d with req-1", w.Code, w.Header().Get(requestIDHeader), statusNotExpected)
+	}
+	model := &outModel{}
+	err := json.Unmarshal(w.Body.Bytes(), model)
+	if err != nil || model.Error == nil || model.Error.RequestID != "req-1" {
+		t.Errorf("the answer is %q, %v, want the error of req-1", w.Body.String(), err)
+	}
+	if panics != before+1 {
+		t.Errorf("%d panics counted, want %d", panics, before+1)
+	}
+}
+
+func TestRequestIDOfTheClientIsChecked(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(requestIDHeader, "bad id\n")
+	if id := requestID(r); id == "bad id\n" || id == "" {
+		t.Errorf("the id is %q, want a new one", id)
+	}
+}
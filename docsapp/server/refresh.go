@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	refreshTokenQuery     = "refresh_token"
+	refreshExpiresAtQuery = "refresh_expires_at"
+	// defaultRefreshTTL is how long the refresh tokens live without sessions.refresh_ttl
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var refreshTTL = defaultRefreshTTL
+
+// refreshHash is the hash of a refresh token kept in the database, the tokens themselves are not
+func refreshHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueRefreshToken makes a refresh token of login exchanged for the access tokens of scopes.
+// The token rotated from another one is of its family, a new family is started if family is empty
+func issueRefreshToken(ctx context.Context, login, family string, scopes []string) (token, expiresAt string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return
+	}
+	if family == "" {
+		var v4 uuid.UUID
+		v4, err = uuid.NewV4()
+		if err != nil {
+			return
+		}
+		family = v4.String()
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	expiresAt = time.Now().Add(refreshTTL).Format(timeFormat)
+	err = myDB.AddRefreshToken(ctx, &docsdb.RefreshToken{Hash: refreshHash(token), Login: login, Family: family,
+		Scopes: strings.Join(scopes, " "), ExpiresAt: expiresAt})
+	return
+}
+
+// refreshHandler exchanges the refresh token of POST /auth/refresh refresh_token=... for a new access token
+// and a new refresh token, the one used is not exchanged again. A refresh token used twice has leaked,
+// the tokens rotated from the same sign-in are revoked then
+func refreshHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "POST":
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	refresh := r.PostForm.Get(refreshTokenQuery)
+	if refresh == "" {
+		errorHandler(statusNotAuthorized, "", &err)
+		return
+	}
+	old, err := myDB.UseRefreshToken(r.Context(), refreshHash(refresh))
+	if err == errNoRows {
+		errorHandler(statusNotAuthorized, tokenInvalidText, &err)
+		return
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if old.Used {
+		if _, e := myDB.DeleteRefreshTokens(r.Context(), old.Login, old.Family); e != nil {
+			log.Printf("the refresh tokens of %s reused are not revoked: %v", old.Login, e)
+		}
+		errorHandler(statusNotAuthorized, tokenInvalidText, &err)
+		return
+	}
+	if old.ExpiresAt <= time.Now().Format(timeFormat) {
+		errorHandler(statusNotAuthorized, tokenExpiredText, &err)
+		return
+	}
+	admin, err := myDB.IsAdmin(r.Context(), old.Login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	var scopes []string
+	for _, v := range strings.Fields(old.Scopes) {
+		if v != scopeAdmin || admin {
+			scopes = append(scopes, v)
+		}
+	}
+	token, c, err := issueToken(old.Login, admin, scopes)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	refresh, refreshExpiresAt, err := issueRefreshToken(r.Context(), old.Login, old.Family, scopes)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{tokenQuery: token, scopeQuery: scopes, expiresAtQuery: expiresAtOf(c),
+		refreshTokenQuery: refresh, refreshExpiresAtQuery: refreshExpiresAt}
+	return sendJSON(w, model)
+}
+
+// revokeRefreshToken revokes the refresh token of login with the others rotated from the same sign-in,
+// the refresh tokens of the other logins and the unknown ones are left alone
+func revokeRefreshToken(ctx context.Context, login, refresh string) (err error) {
+	old, err := myDB.UseRefreshToken(ctx, refreshHash(refresh))
+	if err == errNoRows || err == nil && old.Login != login {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	_, err = myDB.DeleteRefreshTokens(ctx, login, old.Family)
+	return
+}
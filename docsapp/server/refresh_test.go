@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestRefreshTokensRotate(t *testing.T) {
+	useDB(t, inmem.New())
+	values := url.Values{loginQuery: {"refreshlogin"}, passwordQuery: {"password1"}, scopeQuery: {scopeDocsRead}}
+	do(t, routes["register"], registerHandler, form("POST", routes["register"], values))
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	first, _ := model.Response[refreshTokenQuery].(string)
+	if model.Error != nil || first == "" || model.Response[refreshExpiresAtQuery] == nil {
+		t.Fatalf("the sign in is %+v", model)
+	}
+	refresh := func(token string) *outModel {
+		return do(t, routes["authRefresh"], refreshHandler, form("POST", routes["authRefresh"], url.Values{refreshTokenQuery: {token}}))
+	}
+
+	model = refresh(first)
+	second, _ := model.Response[refreshTokenQuery].(string)
+	access, _ := model.Response[tokenQuery].(string)
+	if model.Error != nil || second == "" || second == first || model.Response[expiresAtQuery] == nil {
+		t.Fatalf("the refresh is %+v", model)
+	}
+	c, err := checkToken(access)
+	if err != nil || c.Login != "refreshlogin" || len(c.Scopes) != 1 || c.Scopes[0] != scopeDocsRead {
+		t.Errorf("the refreshed token is %+v, %v", c, err)
+	}
+	model = do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?token="+access, nil))
+	if model.Error != nil {
+		t.Errorf("the refreshed token gets %+v", model.Error)
+	}
+
+	// the reuse of a rotated token revokes the ones rotated from it
+	if model = refresh(first); model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("a used refresh token gets %+v", model)
+	}
+	if model = refresh(second); model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("the refresh token after a reused one gets %+v", model)
+	}
+	if model = refresh("unknown"); model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("an unknown refresh token gets %+v", model)
+	}
+
+	// the logout of all the sessions revokes the refresh tokens too
+	model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	token, _ := model.Response[tokenQuery].(string)
+	third, _ := model.Response[refreshTokenQuery].(string)
+	model = do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+logoutAll+"?"+tokenQuery+"="+url.QueryEscape(token), nil))
+	if model.Error != nil {
+		t.Fatalf("the logout is %+v", model.Error)
+	}
+	if model = refresh(third); model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("the refresh token of a logged out user gets %+v", model)
+	}
+}
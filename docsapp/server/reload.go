@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// configLock guards the parts of config reloadConfig changes: the access lists, the quotas, the meta limits,
+// the embed headers, the brands, the super admins and, under its own lock, the maintenance.
+// The rest of config.json is read at start only
+var configLock sync.RWMutex
+
+// readConfig decodes config.json
+func readConfig() (c *configuration, err error) {
+	file, err := os.Open(configName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	c = &configuration{DB: dbConfig{ForeignKeys: true}}
+	err = json.NewDecoder(file).Decode(c)
+	return
+}
+
+// reloadConfig reads config.json again and applies what may change while the server runs,
+// nothing is applied if the file is wrong
+func reloadConfig() (err error) {
+	c, err := readConfig()
+	if err != nil {
+		return
+	}
+	err = initAccess(c.Access)
+	if err != nil {
+		return
+	}
+	configLock.Lock()
+	config.Access = c.Access
+	config.Quotas = c.Quotas
+	config.MetaLimits = c.MetaLimits
+	config.Embed = c.Embed
+	config.About = c.About
+	config.SuperAdmins = c.SuperAdmins
+	config.Maintenance = c.Maintenance
+	configLock.Unlock()
+	setMaintenance(c.Maintenance)
+	log.Print("config.json is reloaded")
+	return
+}
+
+// reloadOnHangup reloads config.json on every SIGHUP
+func reloadOnHangup() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		err := reloadConfig()
+		if err != nil {
+			log.Printf("config.json is not reloaded: %v", err)
+		}
+	}
+}
+
+// reloadHandler reloads config.json on POST /admin/reload for the admins
+func reloadHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "POST":
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	admin, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if !admin {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	err = reloadConfig()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "config.json is not reloaded: "+err.Error(), &err)
+		return
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{"reloaded": true}
+	return sendJSON(w, model)
+}
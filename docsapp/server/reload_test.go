@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestReloadResetsTheQuotas(t *testing.T) {
+	useDB(t, inmem.New())
+	values := url.Values{loginQuery: {"reloadadmin"}, passwordQuery: {"password1"}, tokenQuery: {config.AdminToken}}
+	model := do(t, routes["register"], registerHandler, form("POST", routes["register"], values))
+	if model.Error != nil {
+		t.Fatalf("register the admin: %+v", model.Error)
+	}
+	model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], url.Values{loginQuery: {"reloadadmin"}, passwordQuery: {"password1"}}))
+	if model.Error != nil {
+		t.Fatalf("auth the admin: %+v", model.Error)
+	}
+	admin := model.Response[tokenQuery].(string)
+	user := signIn(t, "reloaduser")
+	model = do(t, routes["adminReload"], reloadHandler, form("POST", routes["adminReload"], url.Values{tokenQuery: {user}}))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a user reloads: %+v, want %d", model.Error, statusAccessDenied)
+	}
+	config.Quotas = quotaConfig{Default: quotaLimits{DailyRequests: 1000}}
+	defer func() { config.Quotas = quotaConfig{} }()
+	model = do(t, routes["adminReload"], reloadHandler, form("POST", routes["adminReload"], url.Values{tokenQuery: {admin}}))
+	if model.Error != nil || model.Response["reloaded"] != true {
+		t.Fatalf("the admin reloads: %v, %+v", model.Response, model.Error)
+	}
+	if q := quotaOf("reloaduser"); q != (quotaLimits{}) {
+		t.Errorf("the quota after the reload is %+v, want the one of config.json", q)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/paulmach/go.geojson"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+const (
+	mimeGeoJSON = "application/geo+json"
+	renderRoute = "render"
+	widthQuery  = "width"
+	heightQuery = "height"
+	styleQuery  = "style"
+	themeQuery  = "theme"
+
+	stylesPath    = "styles"
+	fontsPath     = "fonts"
+	renderWidth   = 1366
+	renderHeight  = 1024
+	maxRenderSide = 4096
+	// renderBackground is of the styles without a background
+	renderBackground = "FFF"
+	// the label bounds start from the greatest longitude and latitude
+	geoMaxX = 180
+	geoMaxY = 90
+)
+
+var (
+	renderFonts *render.Fonts
+	// regularFont is the font of the labels without a font of fonts and of the text previews
+	regularFont *truetype.Font
+	styleNameRe = regexp.MustCompile(`^[\w-]+$`)
+	// renderLayer draws the documents rendered without a style
+	renderLayer = render.Layer{ID: "document", Color: "#000", FontSize: 12, LineWidth: 1, Fill: render.PolygonFill{State: true, Color: "#CCC"}}
+)
+
+func init() {
+	var err error
+	regularFont, err = truetype.Parse(goregular.TTF)
+	if err != nil {
+		log.Fatal(err)
+	}
+	renderFonts = render.NewFonts(fontsPath, regularFont)
+}
+
+// renderSide reads the width or the height of the picture
+func renderSide(value string, def int) (side int, err error) {
+	if value == "" {
+		return def, nil
+	}
+	side, err = strconv.Atoi(value)
+	if err != nil || side < 1 || side > maxRenderSide {
+		errorHandler(statusInvalidParameters, "width and height are from 1 to "+strconv.Itoa(maxRenderSide), &err)
+	}
+	return
+}
+
+// renderStyle returns the first layer of styles/<name>.json in the theme and the background of the theme,
+// the default layer without a name
+func renderStyle(name, theme string) (layer render.Layer, background string, err error) {
+	if name == "" {
+		if theme != "" {
+			errorHandler(statusInvalidParameters, "a theme is of a style", &err)
+			return
+		}
+		return renderLayer, renderBackground, nil
+	}
+	if !styleNameRe.MatchString(name) {
+		errorHandler(statusInvalidParameters, "wrong style", &err)
+		return
+	}
+	f, err := os.Open(filepath.Join(stylesPath, name+".json"))
+	if os.IsNotExist(err) {
+		errorHandler(statusInvalidParameters, "there is no style "+name, &err)
+		return
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	defer f.Close()
+	style, err := render.LoadStyle(f, theme)
+	if _, ok := err.(*render.UnknownThemeError); ok {
+		errorHandler(statusInvalidParameters, err.Error(), &err)
+		return
+	}
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if len(style.Layer) == 0 {
+		errorHandler(statusInvalidParameters, "style "+name+" has no layers", &err)
+		return
+	}
+	background = style.Background
+	if background == "" {
+		background = renderBackground
+	}
+	return style.Layer[0], background, nil
+}
+
+// renderDocument draws the geojson file of doc as png, the data is fitted into the picture
+func renderDocument(w http.ResponseWriter, r *http.Request, doc *docsdb.Doc) (err error) {
+	mediaType, _, _ := mime.ParseMediaType(doc.Mime)
+	if !doc.File || mediaType != mimeGeoJSON {
+		errorHandler(statusInvalidParameters, "only "+mimeGeoJSON+" documents can be rendered", &err)
+		return
+	}
+	width, err := renderSide(r.Form.Get(widthQuery), renderWidth)
+	if err != nil {
+		return
+	}
+	height, err := renderSide(r.Form.Get(heightQuery), renderHeight)
+	if err != nil {
+		return
+	}
+	layer, background, err := renderStyle(r.Form.Get(styleQuery), r.Form.Get(themeQuery))
+	if err != nil {
+		return
+	}
+	_, span := startSpan(r.Context(), "storage.read", attribute.String("file.path", doc.Name))
+	var data []byte
+	f, err := openFile(r.Context(), doc.Name)
+	if err == nil {
+		data, err = io.ReadAll(f)
+		f.Close()
+	}
+	endSpan(span, err)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		errorHandler(statusInvalidParameters, "the document is not a feature collection", &err)
+		return
+	}
+	d, err := render.Prepare(fc, geoMaxX, geoMaxY)
+	if err != nil {
+		errorHandler(statusInvalidParameters, err.Error(), &err)
+		return
+	}
+	rd := &render.Renderer{Width: width, Height: height, Background: background, PointRadius: 3, Fonts: renderFonts}
+	rd.Fit(d.Bounds())
+	dc, err := rd.Draw(d, layer, render.View{Scale: 1})
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	err = dc.EncodePNG(w)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+	}
+	return
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const contentTypeSchema = "application/schema+json"
+
+// metaSchemaJSON is the JSON Schema of the meta of the uploads served at /schemas/meta.json.
+// The keys the server sets itself are readOnly, they are taken and ignored so a document read may be sent back
+const metaSchemaJSON = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "meta",
+	"description": "The meta part of the uploads to /docs and /docs/{id}",
+	"type": "object",
+	"properties": {
+		"id": {"type": "string", "readOnly": true},
+		"name": {"type": "string"},
+		"mime": {"type": "string"},
+		"file": {"type": "boolean"},
+		"public": {"type": "boolean"},
+		"created": {"type": "string", "description": "like 2006-01-02 15:04:05, the time of the upload by default"},
+		"grant": {"type": "array", "items": {"type": "string"}},
+		"json": {"type": "string", "contentEncoding": "base64"},
+		"tenant": {"type": "string", "readOnly": true},
+		"visibility": {"type": "string", "enum": ["", "private", "unlisted", "public"]},
+		"groups": {"type": "array", "items": {"type": "string"}},
+		"expires_at": {"type": "string", "description": "like 2006-01-02 15:04:05, the document never expires without it"},
+		"owner": {"type": "string", "readOnly": true},
+		"size": {"type": "integer", "readOnly": true},
+		"hash": {"type": "string", "readOnly": true},
+		"version": {"type": "integer", "readOnly": true},
+		"preview_url": {"type": "string", "readOnly": true}
+	}
+}`
+
+// jsonSchema is the part of JSON Schema validate knows: type, properties, items and enum
+type jsonSchema struct {
+	Type       string                 `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	Enum       []string               `json:"enum"`
+}
+
+var metaSchema = mustSchema(metaSchemaJSON)
+
+// mustSchema parses the schema s, it panics if s is wrong
+func mustSchema(s string) *jsonSchema {
+	schema := &jsonSchema{}
+	err := json.Unmarshal([]byte(s), schema)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// validate checks v decoded from JSON against s, the errors are prefixed with the JSON Pointer of their values
+// under ptr, like "/grant/3: not a string"
+func (s *jsonSchema) validate(ptr string, v interface{}) (errs []string) {
+	fail := func(format string, args ...interface{}) []string {
+		at := ptr
+		if at == "" {
+			at = "/"
+		}
+		return append(errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fail("not an object")
+		}
+		for key, p := range s.Properties {
+			if value, ok := m[key]; ok {
+				errs = append(errs, p.validate(ptr+"/"+escapePointer(key), value)...)
+			}
+		}
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return fail("not an array")
+		}
+		if s.Items != nil {
+			for i, item := range a {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s/%d", ptr, i), item)...)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fail("not a string")
+		}
+		if len(s.Enum) > 0 && !inStrings(str, s.Enum) {
+			return fail("not one of %q", s.Enum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fail("not a boolean")
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			return fail("not an integer")
+		}
+	}
+	return
+}
+
+// escapePointer escapes key as a reference token of a JSON Pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// inStrings reports whether s is one of values
+func inStrings(s string, values []string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMeta checks the meta of an upload against metaSchema, the errors are answered with 400,
+// all of them sorted by the pointers of the wrong values
+func validateMeta(meta []byte) (err error) {
+	var v interface{}
+	if json.Unmarshal(meta, &v) != nil {
+		errorHandler(statusInvalidParameters, "meta is not JSON", &err)
+		return
+	}
+	errs := metaSchema.validate("", v)
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		errorHandler(statusInvalidParameters, strings.Join(errs, "; "), &err)
+	}
+	return
+}
+
+// schemaHandler serves the JSON Schema of the meta of the uploads on GET /schemas/meta.json for the clients to validate with
+func schemaHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeSchema)
+	_, err = w.Write([]byte(metaSchemaJSON))
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+	}
+	return
+}
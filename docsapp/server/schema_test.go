@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetaIsValidatedAgainstTheSchema(t *testing.T) {
+	for meta, want := range map[string]string{
+		`{"name":"notes","grant":["ann"],"visibility":"unlisted","size":3}`: "",
+		`{"name":"notes","unknown":{"kept":true}}`:                          "",
+		`[]`:                                       "/: not an object",
+		`{"name":`:                                 "meta is not JSON",
+		`{"grant":["ann","bob",null,3]}`:           "/grant/2: not a string; /grant/3: not a string",
+		`{"file":"yes","grant":"ann"}`:             "/file: not a boolean; /grant: not an array",
+		`{"visibility":"secret","version":1.5}`:    `/version: not an integer; /visibility: not one of ["" "private" "unlisted" "public"]`,
+		`{"groups":[{"name":"team"}],"name":true}`: "/groups/0: not a string; /name: not a string",
+	} {
+		err := validateMeta([]byte(meta))
+		if want == "" {
+			if err != nil {
+				t.Errorf("%s fails with %v", meta, err)
+			}
+			continue
+		}
+		se, ok := err.(*statusError)
+		if !ok || se.Code != statusInvalidParameters || se.Text != statusText[statusInvalidParameters]+": "+want {
+			t.Errorf("%s fails with %v, want 400 %s", meta, err, want)
+		}
+	}
+}
+
+func TestEscapePointer(t *testing.T) {
+	if got := escapePointer("a/b~c"); got != "a~1b~0c" {
+		t.Errorf("a/b~c is escaped as %s", got)
+	}
+}
+
+func TestSchemaIsServed(t *testing.T) {
+	w := httptest.NewRecorder()
+	makeHandler(routes["metaSchema"], schemaHandler)(w, httptest.NewRequest("GET", routes["metaSchema"], nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != contentTypeSchema {
+		t.Fatalf("the schema is answered with %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil || schema["type"] != "object" {
+		t.Errorf("the schema is %s, %v", w.Body, err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// the scopes of the tokens, what the requests signed in with them may do
+const (
+	scopeDocsRead  = "docs:read"
+	scopeDocsWrite = "docs:write"
+	scopeAdmin     = "admin"
+	scopeQuery     = "scope"
+)
+
+var (
+	allScopes  = []string{scopeDocsRead, scopeDocsWrite, scopeAdmin}
+	userScopes = []string{scopeDocsRead, scopeDocsWrite}
+)
+
+type scopeKey struct{}
+
+// tokenScope is the scope the route of a request needs, the header of its answer and the scopes, the login
+// and the admin flag of its token once getLogin has read it
+type tokenScope struct {
+	need   string
+	header http.Header
+	scopes []string
+	login  string
+	admin  bool
+}
+
+// routeScope is the scope the requests of the route need: admin for the tenants, the maintenance and /admin,
+// docs:read for the safe methods and docs:write for the others
+func routeScope(name, method string) string {
+	switch name {
+	case routes["tenants"], routes["tenantsName"] + "{name}", routes["maintenance"], routes["adminReload"],
+		routes["adminUsers"] + "{login}", routes["adminAudit"]:
+		return scopeAdmin
+	}
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return scopeDocsRead
+	}
+	return scopeDocsWrite
+}
+
+// withScope makes the token of the request of ctx need the scope, a sliding session sets the new token in header.
+// makeHandler calls it for every route
+func withScope(ctx context.Context, need string, header http.Header) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &tokenScope{need: need, header: header})
+}
+
+// parseScopes reads the scopes separated by spaces or commas, all of them if s is empty.
+// A non-admin gets no admin scope
+func parseScopes(s string, admin bool) (scopes []string, err error) {
+	requested := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(requested) == 0 {
+		requested = userScopes
+		if admin {
+			requested = allScopes
+		}
+	}
+	seen := make(map[string]bool, len(requested))
+	for _, v := range requested {
+		if !scopeIn(allScopes, v) {
+			errorHandler(statusInvalidParameters, "possible scopes: "+strings.Join(allScopes, ", "), &err)
+			return
+		}
+		if v == scopeAdmin && !admin {
+			errorHandler(statusAccessDenied, "the scope "+scopeAdmin+" is of the admins", &err)
+			return
+		}
+		if !seen[v] {
+			seen[v] = true
+			scopes = append(scopes, v)
+		}
+	}
+	return
+}
+
+// checkScope is called by getLogin once the claims of the token are checked: it is refused if it has not the scope
+// the route needs, its scopes are kept for hasScope, the login for signedIn and the admin flag for isAdmin
+func checkScope(ctx context.Context, c *tokenClaims) (err error) {
+	s, ok := ctx.Value(scopeKey{}).(*tokenScope)
+	if !ok {
+		return
+	}
+	s.scopes, s.login, s.admin = c.Scopes, c.Login, c.Admin
+	slideSession(s.header, c)
+	if !scopeIn(s.scopes, s.need) {
+		errorHandler(statusAccessDenied, "the token has no scope "+s.need, &err)
+	}
+	return
+}
+
+// hasScope reports whether the token of the request of r has the scope.
+// The requests not served by makeHandler are not limited by the scopes
+func hasScope(r *http.Request, scope string) bool {
+	s, ok := r.Context().Value(scopeKey{}).(*tokenScope)
+	return !ok || scopeIn(s.scopes, scope)
+}
+
+// signedIn is the login of the token of the request of r once getLogin has read it
+func signedIn(r *http.Request) string {
+	if s, ok := r.Context().Value(scopeKey{}).(*tokenScope); ok {
+		return s.login
+	}
+	return ""
+}
+
+// scopeIn reports whether scopes has scope
+func scopeIn(scopes []string, scope string) bool {
+	for _, v := range scopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
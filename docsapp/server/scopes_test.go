@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestReadOnlyTokenDoesntDelete(t *testing.T) {
+	useDB(t, inmem.New())
+	signIn(t, "scopelogin")
+	values := url.Values{loginQuery: {"scopelogin"}, passwordQuery: {"password1"}, scopeQuery: {scopeDocsRead}}
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	if model.Error != nil {
+		t.Fatalf("auth: %+v", model.Error)
+	}
+	token := model.Response[tokenQuery].(string)
+	err := myDB.CreateDocument(httptest.NewRequest("GET", "/", nil).Context(), &docsdb.Doc{ID: "1", Name: "notes", Grant: []string{"scopelogin"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model = do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?token="+token, nil))
+	if model.Error != nil {
+		t.Errorf("listing: %+v", model.Error)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("DELETE", routes["docsID"]+"1?token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("deleting: %+v, want %d", model.Error, statusAccessDenied)
+	}
+	values[scopeQuery] = []string{scopeAdmin}
+	model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("the admin scope of a user: %+v, want %d", model.Error, statusAccessDenied)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	searchQuery  = "q"
+	contentQuery = "content"
+	// indexMaxSize is the number of the first bytes of a file its content is searched in
+	indexMaxSize = 1 << 20
+)
+
+// indexedTypes are the media types of the files whose content is indexed, indexedExts the extensions
+// of the ones without a known type
+var (
+	indexedTypes = map[string]bool{"text/plain": true, "text/markdown": true, "text/csv": true, "application/json": true}
+	indexedExts  = map[string]bool{".txt": true, ".md": true, ".csv": true, ".json": true}
+)
+
+// indexable reports whether the content of the file of doc is searched
+func indexable(doc *docsdb.Doc) bool {
+	if !doc.File {
+		return false
+	}
+	if t, _, err := mime.ParseMediaType(doc.Mime); err == nil && indexedTypes[t] {
+		return true
+	}
+	return indexedExts[strings.ToLower(filepath.Ext(doc.Name))]
+}
+
+// indexContent starts the job of login indexing the content of the file of doc it has uploaded,
+// the content of the other documents is dropped at once
+func indexContent(ctx context.Context, login string, doc *docsdb.Doc) {
+	if !indexable(doc) {
+		err := myDB.IndexContent(ctx, doc.ID, "")
+		if err != nil {
+			log.Printf("index %s: %v", doc.ID, err)
+		}
+		return
+	}
+	j, err := newJob("index", login)
+	if err != nil {
+		log.Printf("index %s: %v", doc.ID, err)
+		return
+	}
+	go func() {
+		err := indexDocument(context.Background(), doc)
+		if err != nil {
+			log.Printf("index %s: %v", doc.ID, err)
+		}
+		j.finish(doc.ID, err)
+	}()
+}
+
+// indexDocument reads up to indexMaxSize bytes of the text of the file of doc into its content,
+// the files which are not UTF-8 have none
+func indexDocument(ctx context.Context, doc *docsdb.Doc) (err error) {
+	f, err := openFile(ctx, doc.Name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, indexMaxSize))
+	if err != nil {
+		return
+	}
+	// the limit may cut the last character
+	for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	var content string
+	if utf8.Valid(b) {
+		content = string(b)
+	}
+	return myDB.IndexContent(ctx, doc.ID, content)
+}
+
+// searchHandler finds the documents of the login of the token whose name has q on GET /docs/search?q=...
+// and the ones whose file has it with content=true, a full-text query like `report AND 2019` then,
+// answering the snippets of the files with the matched words marked. The filters of the listings narrow it
+func searchHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	query := strings.TrimSpace(r.Form.Get(searchQuery))
+	if query == "" {
+		errorHandler(statusInvalidParameters, searchQuery+" is what is searched", &err)
+		return
+	}
+	var content bool
+	if v := r.Form.Get(contentQuery); v != "" {
+		content, err = strconv.ParseBool(v)
+		if err != nil {
+			errorHandler(statusInvalidParameters, contentQuery+" is true or false", &err)
+			return
+		}
+	}
+	filter, err := listFilter(r)
+	if err != nil {
+		return
+	}
+	filter.Login = login
+	hits, err := myDB.SearchDocuments(r.Context(), filter, query, content)
+	if err != nil {
+		if strings.Contains(err.Error(), "MATCH") || strings.Contains(err.Error(), "fts") {
+			errorHandler(statusInvalidParameters, "the query is not understood, it is words with AND, OR, NOT and * at their ends", &err)
+			return
+		}
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if hits == nil {
+		hits = make([]*docsdb.Hit, 0)
+	}
+	model := &outModel{}
+	model.Data = map[string]interface{}{"docs": hits}
+	return sendJSON(w, model)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestIndexable(t *testing.T) {
+	for _, c := range []struct {
+		doc  docsdb.Doc
+		want bool
+	}{
+		{docsdb.Doc{Name: "a.pdf", Mime: "text/plain; charset=utf-8", File: true}, true},
+		{docsdb.Doc{Name: "notes.MD", Mime: "application/octet-stream", File: true}, true},
+		{docsdb.Doc{Name: "a.png", Mime: "image/png", File: true}, false},
+		{docsdb.Doc{Name: "a.txt", Mime: "text/plain"}, false},
+	} {
+		if got := indexable(&c.doc); got != c.want {
+			t.Errorf("%s of %s is indexed: %v, want %v", c.doc.Name, c.doc.Mime, got, c.want)
+		}
+	}
+}
+
+func TestSearchByContent(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "searchlogin")
+	ctx := context.Background()
+	for id, name := range map[string]string{"1": "report.txt", "2": "notes.md"} {
+		err := myDB.CreateDocument(ctx, &docsdb.Doc{ID: id, Name: name, File: true, Grant: []string{"searchlogin"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := myDB.IndexContent(ctx, "2", "the sales of the year went up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := do(t, routes["search"], searchHandler, httptest.NewRequest("GET", routes["search"]+"?q=report&token="+token, nil))
+	if docs, _ := model.Data["docs"].([]interface{}); model.Error != nil || len(docs) != 1 {
+		t.Errorf("the search by name is %v, %+v, want report.txt", model.Data, model.Error)
+	}
+	model = do(t, routes["search"], searchHandler, httptest.NewRequest("GET", routes["search"]+"?q=sales&content=true&limit=-1&token="+token, nil))
+	docs, _ := model.Data["docs"].([]interface{})
+	if model.Error != nil || len(docs) != 1 {
+		t.Fatalf("the search by content is %v, %+v, want notes.md", model.Data, model.Error)
+	}
+	hit := docs[0].(map[string]interface{})
+	if hit["id"] != "2" || !strings.Contains(hit["snippet"].(string), "<b>sales</b>") {
+		t.Errorf("the hit is %v, want 2 with sales marked", hit)
+	}
+	model = do(t, routes["search"], searchHandler, httptest.NewRequest("GET", routes["search"]+"?content=true&token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("a search of nothing gets %+v, want %d", model.Error, statusInvalidParameters)
+	}
+}
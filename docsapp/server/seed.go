@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	// seedPassword is the password of every seeded user
+	seedPassword = "seedpass1"
+	// seedMinSize and seedMaxSize bound the files of the seeded documents, the sizes are spread logarithmically
+	seedMinSize = 100
+	seedMaxSize = 256 << 10
+)
+
+var (
+	seedUsers = flag.Int("seed-users", 0, "add that many users seeduser001, seeduser002... with the password "+seedPassword+" at start")
+	seedDocs  = flag.Int("seed-docs", 0, "add that many documents of the seeded users at start")
+	seedValue = flag.Int64("seed", 1, "the seed of the seeded users and documents, the same one makes the same data")
+	// seedEpoch is the time the seeded documents are created before, so the same seed makes the same dates
+	seedEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	seedWords = strings.Fields("the report of sales went up in the year while costs fell and the team planned new offices near the river " +
+		"budget forecast meeting notes draft final review quarter revenue customer contract invoice summary")
+)
+
+// seedKind is a kind of the files of the seeded documents
+type seedKind struct {
+	ext   string
+	mime  string
+	write func(w *bufio.Writer, rnd *rand.Rand, size int)
+}
+
+var seedKinds = []seedKind{
+	{".txt", "text/plain; charset=utf-8", seedText},
+	{".md", "text/markdown; charset=utf-8", seedText},
+	{".csv", "text/csv; charset=utf-8", seedCSV},
+	{".json", "application/json", seedJSON},
+	{".bin", "application/octet-stream", seedBinary},
+}
+
+// seedDoc is a seeded document with what its file is made of
+type seedDoc struct {
+	doc   docsdb.Doc
+	kind  seedKind
+	size  int
+	seed  int64
+	owner string
+}
+
+// seedPlan makes users and docs documents of them from seed, the same arguments make the same plan.
+// The documents are of every kind, size and visibility, some of them are granted to another user too
+func seedPlan(seed int64, users, docs int) (logins []string, plan []seedDoc) {
+	rnd := rand.New(rand.NewSource(seed))
+	for i := 1; i <= users; i++ {
+		logins = append(logins, fmt.Sprintf("seeduser%03d", i))
+	}
+	if users == 0 {
+		return
+	}
+	visibilities := []string{docsdb.VisibilityPrivate, docsdb.VisibilityUnlisted, docsdb.VisibilityPublic}
+	for i := 1; i <= docs; i++ {
+		d := seedDoc{kind: seedKinds[rnd.Intn(len(seedKinds))], owner: logins[rnd.Intn(users)], seed: rnd.Int63()}
+		d.size = int(seedMinSize * math.Exp(rnd.Float64()*math.Log(seedMaxSize/seedMinSize)))
+		name := fmt.Sprintf("%s-%04d%s", seedWords[rnd.Intn(len(seedWords))], i, d.kind.ext)
+		d.doc = docsdb.Doc{
+			Name:       name,
+			Owner:      d.owner,
+			Mime:       d.kind.mime,
+			File:       true,
+			Visibility: visibilities[rnd.Intn(len(visibilities))],
+			Created:    seedEpoch.Add(-time.Duration(rnd.Int63n(int64(365 * 24 * time.Hour)))).Format(timeFormat),
+			Grant:      []string{d.owner},
+			Tenant:     docsdb.DefaultTenant,
+		}
+		if other := logins[rnd.Intn(users)]; other != d.owner && rnd.Intn(4) == 0 {
+			d.doc.Grant = append(d.doc.Grant, other)
+		}
+		plan = append(plan, d)
+	}
+	return
+}
+
+// content writes the file of d
+func (d *seedDoc) content(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	d.kind.write(bw, rand.New(rand.NewSource(d.seed)), d.size)
+	return bw.Flush()
+}
+
+func seedText(w *bufio.Writer, rnd *rand.Rand, size int) {
+	for n := 0; n < size; {
+		word := seedWords[rnd.Intn(len(seedWords))]
+		sep := " "
+		if rnd.Intn(12) == 0 {
+			sep = "\n"
+		}
+		k, _ := w.WriteString(word + sep)
+		n += k
+	}
+}
+
+func seedCSV(w *bufio.Writer, rnd *rand.Rand, size int) {
+	n, _ := w.WriteString("id,word,amount\n")
+	for i := 1; n < size; i++ {
+		k, _ := fmt.Fprintf(w, "%d,%s,%.2f\n", i, seedWords[rnd.Intn(len(seedWords))], rnd.Float64()*1000)
+		n += k
+	}
+}
+
+func seedJSON(w *bufio.Writer, rnd *rand.Rand, size int) {
+	n, _ := w.WriteString("[")
+	for i := 1; n < size; i++ {
+		if i > 1 {
+			w.WriteString(",")
+			n++
+		}
+		k, _ := fmt.Fprintf(w, `{"id":%d,"word":%q,"amount":%d}`, i, seedWords[rnd.Intn(len(seedWords))], rnd.Intn(1000))
+		n += k
+	}
+	w.WriteString("]")
+}
+
+func seedBinary(w *bufio.Writer, rnd *rand.Rand, size int) {
+	for i := 0; i < size; i++ {
+		w.WriteByte(byte(rnd.Intn(256)))
+	}
+}
+
+// seedData adds the users and the documents of the plan of seed with their files, the ones there are already
+// are left as they are, so the same seed may be given at every start
+func seedData(ctx context.Context, seed int64, users, docs int) (err error) {
+	logins, plan := seedPlan(seed, users, docs)
+	var added, skipped int
+	hash, err := hashPassword(seedPassword)
+	if err != nil {
+		return
+	}
+	for _, login := range logins {
+		err = myDB.AddUser(ctx, &docsdb.User{Login: login, Password: hash, Tenant: docsdb.DefaultTenant})
+		if err != nil && !strings.Contains(err.Error(), "UNIQUE") {
+			return fmt.Errorf("seed %s: %v", login, err)
+		}
+	}
+	for i := range plan {
+		d := &plan[i]
+		// the id is of the owner and the name of the plan, the documents seeded already are skipped before their files are written
+		d.doc.ID = seededID(d.owner + "/" + d.doc.Name)
+		_, err = myDB.GetDocument(ctx, d.doc.ID)
+		if err == nil {
+			skipped++
+			continue
+		}
+		if err != errNoRows {
+			return fmt.Errorf("seed %s: %v", d.doc.Name, err)
+		}
+		pr, pw := io.Pipe()
+		go func() { pw.CloseWithError(d.content(pw)) }()
+		d.doc.Name, _, err = saveFile(ctx, d.owner, d.doc.Name, pr)
+		pr.Close()
+		if err != nil {
+			return fmt.Errorf("seed %s: %v", d.doc.Name, err)
+		}
+		err = myDB.CreateDocument(ctx, &d.doc, nil)
+		if err != nil {
+			return fmt.Errorf("seed %s: %v", d.doc.Name, err)
+		}
+		indexContent(ctx, d.owner, &d.doc)
+		added++
+	}
+	log.Printf("seed %d: %d users, %d documents added, %d there already", seed, len(logins), added, skipped)
+	return nil
+}
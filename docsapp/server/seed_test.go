@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSeedPlanIsReproduced(t *testing.T) {
+	logins, plan := seedPlan(7, 3, 20)
+	logins2, plan2 := seedPlan(7, 3, 20)
+	if len(logins) != 3 || len(plan) != 20 || !reflect.DeepEqual(logins, logins2) {
+		t.Fatalf("the plan is %d users %v and %d documents", len(logins), logins, len(plan))
+	}
+	for i := range plan {
+		if !reflect.DeepEqual(plan[i].doc, plan2[i].doc) || plan[i].size != plan2[i].size {
+			t.Errorf("document %d is %+v once and %+v again", i, plan[i].doc, plan2[i].doc)
+		}
+		var a, b bytes.Buffer
+		if plan[i].content(&a) != nil || plan[i].content(&b) != nil || !bytes.Equal(a.Bytes(), b.Bytes()) || a.Len() < plan[i].size {
+			t.Errorf("the file of %s is %d bytes once and %d again, want %d", plan[i].doc.Name, a.Len(), b.Len(), plan[i].size)
+		}
+	}
+	if _, other := seedPlan(8, 3, 20); reflect.DeepEqual(plan[0].doc, other[0].doc) {
+		t.Errorf("another seed makes the same %+v", plan[0].doc)
+	}
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -17,21 +25,32 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/storage"
 	"github.com/satori/go.uuid"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
-	statusOk                  = 200
 	statusInvalidParameters   = 400
 	statusNotAuthorized       = 401
 	statusAccessDenied        = 403
 	statusInvalidMethod       = 405
+	statusConflict            = 409
+	statusGone                = 410
+	statusUnsupportedMedia    = 415
+	statusUnprocessable       = 422
+	statusTooManyRequests     = 429
 	statusNotExpected         = 500
 	statusUnimplementedMethod = 501
+	statusUnavailable         = 503
 
 	loginQuery    = "login"
 	passwordQuery = "password"
@@ -42,141 +61,398 @@ const (
 	keyQuery      = "key"
 	valueQuery    = "value"
 	limitQuery    = "limit"
+	sharedQuery   = "shared"
 
 	timeFormat         = "2006-01-02 15:04:05"
-	dbPath             = `database\sqliteDocs.db`
+	dbPath             = "database/sqliteDocs.db"
 	dataPath           = "data"
-	host               = "localhost:8080"
+	defaultHost        = "localhost:8080"
 	serverLogs         = "server.log"
 	contentTypeJSON    = "application/json; charset=utf-8"
 	configName         = "config.json"
 	maxMB              = 32 << 20
 	filterLimitDefault = 3
-	fileNameLength     = 8
-	idNameLength       = 6
+	// authFailureTime is the least time a failed sign-in is answered in
+	authFailureTime = 250 * time.Millisecond
+	// unknownLoginPassword is the password of unknownLoginHash
+	unknownLoginPassword = "\x00unknown login"
+	fileNameLength       = 8
 )
 
 var (
-	errNoRows    = sql.ErrNoRows
-	errCustomNil = errors.New("it will be ignored in the end but not before")
-	clientError  *errorModel
-	statusText   = map[int]string{
+	errNoRows  = sql.ErrNoRows
+	statusText = map[int]string{
 		statusInvalidParameters:   "Invalid parameters",
 		statusNotAuthorized:       "Not authorized",
 		statusAccessDenied:        "Access denied",
 		statusInvalidMethod:       "Invalid request method",
+		statusConflict:            "Conflict",
+		statusGone:                "Gone",
+		statusUnsupportedMedia:    "Unsupported media type",
+		statusUnprocessable:       "Unprocessable request",
+		statusTooManyRequests:     "Too many requests",
 		statusNotExpected:         "Not expected trouble",
 		statusUnimplementedMethod: "The request method is not implemented",
-		statusOk:                  ""}
-	db                   *sql.DB
-	myDB                 docsdb.ISQL
-	routes               = map[string]string{"index": "/", "docs": "/docs", "docsID": "/docs/", "register": "/register", "auth": "/auth", "logout": "/auth/"}
-	config               *configuration
-	possibleFilterColumn = []string{"id", "name", "mime", "file", "public", "created", "json"}
+		statusUnavailable:         "Service unavailable"}
+	db     *sql.DB
+	myDB   docsdb.ISQL
+	routes = map[string]string{"index": "/", "docs": "/docs", "docsID": "/docs/", "register": "/register", "auth": "/auth", "logout": "/auth/", "embed": "/embed/", "metrics": "/metrics", "files": "/files/", "maintenance": "/maintenance", "tenants": "/tenants", "tenantsName": "/tenants/", "about": "/about", "publicDocs": "/public/docs", "fetch": "/docs/fetch", "jobs": "/jobs/", "meUsage": "/me/usage", "events": "/events", "groups": "/groups", "groupsName": "/groups/", "search": "/docs/search", "adminReload": "/admin/reload", "me": "/me", "meDeletion": "/me/deletion", "adminUsers": "/admin/users/", "adminAudit": "/admin/audit", "meTakeout": "/me/takeout", "authRefresh": "/auth/refresh", "metaSchema": "/schemas/meta.json"}
+	config *configuration
+	// store keeps the files of the documents
+	store                = storage.Dir(dataPath)
+	possibleFilterColumn = []string{"id", "name", "mime", "file", "public", "visibility", "created", "json", "owner", "size", "hash", "version"}
 )
 
 type configuration struct {
 	AdminToken string `json:"token"`
+	// MaxScanRows is the number of documents over which filters on mime, file and json are rejected
+	MaxScanRows int           `json:"max_scan_rows"`
+	Tracing     tracingConfig `json:"tracing"`
+	Access      accessConfig  `json:"access"`
+	// BasePath is the path prefix the routes are served under behind a reverse proxy, e.g. /docsapp
+	BasePath string `json:"base_path"`
+	// MetaLimits are the greatest sizes in bytes of the values of the custom keys, "*" is of the keys not listed
+	MetaLimits  map[string]int    `json:"meta_limits"`
+	Embed       embedConfig       `json:"embed"`
+	DB          dbConfig          `json:"db"`
+	SignedURLs  signedURLConfig   `json:"signed_urls"`
+	Offload     offloadConfig     `json:"offload"`
+	Maintenance maintenanceConfig `json:"maintenance"`
+	// SuperAdmins are the logins managing the tenants at /tenants
+	SuperAdmins []string      `json:"super_admins"`
+	About       aboutConfig   `json:"about"`
+	Fetch       fetchConfig   `json:"fetch"`
+	Convert     convertConfig `json:"convert"`
+	// IdempotencyTTL is how long the answers to the requests with an Idempotency-Key are kept, like "24h"
+	IdempotencyTTL string         `json:"idempotency_ttl"`
+	Quotas         quotaConfig    `json:"quotas"`
+	Expiry         expiryConfig   `json:"expiry"`
+	Deletion       deletionConfig `json:"deletion"`
+	Sessions       sessionsConfig `json:"sessions"`
+	JWT            jwtConfig      `json:"jwt"`
+	Hooks          hooksConfig    `json:"hooks"`
+	IDs            idConfig       `json:"ids"`
+	TLS            tlsConfig      `json:"tls"`
+	// Addr is the host:port the server listens on, DataDir the directory of the files,
+	// the flags -addr and -data and the environment are over them
+	Addr    string `json:"addr"`
+	DataDir string `json:"data_dir"`
 }
 
+// outModel is the envelope of the answers, in JSON or in XML for the clients preferring it
 type outModel struct {
-	Error    *errorModel            `json:"error,omitempty"`
-	Response map[string]interface{} `json:"response,omitempty"`
-	Data     map[string]interface{} `json:"data,omitempty"`
+	XMLName xml.Name `json:"-" xml:"envelope"`
+	// Banner is the message of the maintenance
+	Banner   string      `json:"banner,omitempty" xml:"banner,omitempty"`
+	Error    *errorModel `json:"error,omitempty" xml:"error,omitempty"`
+	Response fields      `json:"response,omitempty" xml:"response,omitempty"`
+	Data     fields      `json:"data,omitempty" xml:"data,omitempty"`
 }
 
 type errorModel struct {
-	Code int    `json:"code"`
-	Text string `json:"text"`
+	Code int    `json:"code" xml:"code"`
+	Text string `json:"text" xml:"text"`
+	// RequestID is the X-Request-ID of the request a panic has failed, for the log to be searched by
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
 }
 
+// setupErr is why config.json is not read at start, main fails with it unless -embedded makes one
+var setupErr error
+
 func init() {
-	myDB = &docsdb.Handler{}
-	err := myDB.Init("sqlite3", dbPath)
+	setupErr = setup()
+	if setupErr != nil && !os.IsNotExist(setupErr) {
+		log.Fatal(setupErr)
+	}
+}
+
+// setup reads config.json of the working directory with everything it configures
+func setup() (err error) {
+	config, err = readConfig()
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
-	file, err := os.Open(configName)
+	config.BasePath = cleanBasePath(config.BasePath)
+	err = initAccess(config.Access)
 	if err != nil {
-		log.Fatal(err)
+		return
 	}
-	config = &configuration{}
-	err = json.NewDecoder(file).Decode(config)
+	err = initSignedURLs(config.SignedURLs)
 	if err != nil {
-		log.Fatal(err)
+		return
+	}
+	err = initOffload(config.Offload)
+	if err != nil {
+		return
+	}
+	setMaintenance(config.Maintenance)
+	err = initFetch(config.Fetch)
+	if err != nil {
+		return
+	}
+	err = initConvert(config.Convert)
+	if err != nil {
+		return
+	}
+	err = initExpiry(config.Expiry)
+	if err != nil {
+		return
+	}
+	err = initDeletion(config.Deletion)
+	if err != nil {
+		return
 	}
-	clientError = &errorModel{Code: 0}
+	err = initSessions(config.Sessions)
+	if err != nil {
+		return
+	}
+	err = initJWT(config.JWT)
+	if err != nil {
+		return
+	}
+	err = initHooks(config.Hooks)
+	if err != nil {
+		return
+	}
+	err = initIDs(config.IDs)
+	if err != nil {
+		return
+	}
+	err = initTLS(config.TLS)
+	if err != nil {
+		return
+	}
+	if config.IdempotencyTTL != "" {
+		idempotencyTTL, err = time.ParseDuration(config.IdempotencyTTL)
+		if err != nil {
+			return
+		}
+	}
+	return
 }
 
 func main() {
-	http.HandleFunc(routes["register"], makeHandler(registerHandler))
-	http.HandleFunc(routes["auth"], makeHandler(authHandler))
-	http.HandleFunc(routes["docs"], makeHandler(docsHandler))
-	http.HandleFunc(routes["docsID"], makeHandler(docsIDHandler))
-	http.HandleFunc(routes["logout"], makeHandler(logoutHandler))
-	defer myDB.Disconnect()
-	err := http.ListenAndServe(host, nil)
-	log.Panic(err)
+	flag.Parse()
+	if *embedded {
+		err := RunEmbedded(*embeddedDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if setupErr != nil {
+		log.Fatal(setupErr)
+	}
+	err := initLocations(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *migrateStorage || *verifyStorage {
+		err = runStorageCommand()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	err = serve()
+	if err != nil {
+		log.Panic(err)
+	}
 }
 
-// errCustomNil is used for letting someHandler to know that an error was occured
-// but it is not to be logged to the server
+// serve serves the API on listenAddr until it fails or is stopped by a signal,
+// the database is closed after the last request and job then
+func serve() (err error) {
+	shutdownTracing, err := initTracing(config.Tracing)
+	if err != nil {
+		return
+	}
+	defer shutdownTracing(context.Background())
+	err = openDB(config.DB, *demo)
+	if err != nil {
+		return
+	}
+	err = loadRevocations(context.Background())
+	if err != nil {
+		return
+	}
+	if *seedUsers > 0 || *seedDocs > 0 {
+		err = seedData(context.Background(), *seedValue, *seedUsers, *seedDocs)
+		if err != nil {
+			return
+		}
+	}
+	http.HandleFunc(routes["register"], makeHandler(routes["register"], registerHandler))
+	http.HandleFunc(routes["auth"], makeHandler(routes["auth"], authHandler))
+	http.HandleFunc(routes["docs"], makeHandler(routes["docs"], docsHandler))
+	http.HandleFunc(routes["docsID"], makeHandler(routes["docsID"]+"{id}", docsIDHandler))
+	http.HandleFunc(routes["logout"], makeHandler(routes["logout"]+"{token}", logoutHandler))
+	http.HandleFunc(routes["authRefresh"], makeHandler(routes["authRefresh"], refreshHandler))
+	http.HandleFunc(routes["embed"], makeHandler(routes["embed"]+"{id}", embedHandler))
+	http.HandleFunc(routes["metrics"], makeHandler(routes["metrics"], metricsHandler))
+	http.HandleFunc(routes["files"], makeHandler(routes["files"]+"{id}", filesHandler))
+	http.HandleFunc(routes["maintenance"], makeHandler(routes["maintenance"], maintenanceHandler))
+	http.HandleFunc(routes["tenants"], makeHandler(routes["tenants"], tenantsHandler))
+	http.HandleFunc(routes["tenantsName"], makeHandler(routes["tenantsName"]+"{name}", tenantsHandler))
+	http.HandleFunc(routes["about"], makeHandler(routes["about"], aboutHandler))
+	http.HandleFunc(routes["publicDocs"], makeHandler(routes["publicDocs"], publicDocsHandler))
+	http.HandleFunc(routes["fetch"], makeHandler(routes["fetch"], fetchHandler))
+	http.HandleFunc(routes["jobs"], makeHandler(routes["jobs"]+"{id}", jobsHandler))
+	http.HandleFunc(routes["meUsage"], makeHandler(routes["meUsage"], usageHandler))
+	http.HandleFunc(routes["events"], makeHandler(routes["events"], eventsHandler))
+	http.HandleFunc(routes["groups"], makeHandler(routes["groups"], groupsHandler))
+	http.HandleFunc(routes["groupsName"], makeHandler(routes["groupsName"]+"{name}", groupsHandler))
+	http.HandleFunc(routes["search"], makeHandler(routes["search"], searchHandler))
+	http.HandleFunc(routes["adminReload"], makeHandler(routes["adminReload"], reloadHandler))
+	http.HandleFunc(routes["me"], makeHandler(routes["me"], meHandler))
+	http.HandleFunc(routes["meDeletion"], makeHandler(routes["meDeletion"], meDeletionHandler))
+	http.HandleFunc(routes["adminUsers"], makeHandler(routes["adminUsers"]+"{login}", adminUsersHandler))
+	http.HandleFunc(routes["adminAudit"], makeHandler(routes["adminAudit"], auditHandler))
+	http.HandleFunc(routes["meTakeout"], makeHandler(routes["meTakeout"], takeoutHandler))
+	http.HandleFunc(routes["metaSchema"], makeHandler(routes["metaSchema"], schemaHandler))
+	defer myDB.Disconnect()
+	go reloadOnHangup()
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return
+	}
+	startLoop(purgeLoop)
+	startLoop(outboxLoop)
+	listenHTTP(config.TLS.HTTPAddr)
+	srv := &http.Server{Handler: recoverPanics(restrict(withBasePath(idempotent(http.DefaultServeMux)))), TLSConfig: serverTLS}
+	return serveUntilStopped(srv, l)
+}
 
-func makeHandler(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+// makeHandler traces the requests of the route and counts them in the metrics, name is the span name
+// along with the method and the route label of the metrics.
+// A handler answers by itself when it succeeds, a HEAD one sets the headers only and the status is 200
+// unless it writes another one. When it fails it calls errorHandler with a status of 400 and over,
+// the error is answered here then.
+// The requests signed in with a token are counted against the quota of the user but the ones of /me/usage,
+// the token is to have the scope routeScope tells
+func makeHandler(name string, handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := handler(w, r)
-		if err != nil && err != errCustomNil {
+		start := time.Now()
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+name, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.method", r.Method), attribute.String("http.target", r.URL.Path)))
+		if d, ok := routeTimeouts[name]; ok {
+			ctx = docsdb.WithQueryTimeout(ctx, d)
+		}
+		ctx = withScope(ctx, routeScope(name, r.Method), w.Header())
+		var m *meter
+		if name != routes["meUsage"] {
+			ctx, m = withMeter(ctx, w)
+			w = m
+		}
+		if prefersXML(r) {
+			w = &xmlWriter{w}
+		}
+		r = r.WithContext(ctx)
+		var err error
+		if blockedByMaintenance(r, name) {
+			errorHandler(statusUnavailable, maintenanceBanner(), &err)
+		} else {
+			err = handler(w, r)
+		}
+		se, failed := err.(*statusError)
+		if failed && se.cause != nil {
+			log.Printf("%+v", se.cause)
+		} else if err != nil && !failed {
 			log.Printf("%+v", err)
 		}
-		if clientError.Code != 0 {
+		code := http.StatusOK
+		if failed {
+			code = se.Code
+		}
+		span.SetAttributes(attribute.Int("http.status_code", code))
+		endSpan(span, err)
+		observeRequest(name, r.Method, code, time.Since(start))
+		if failed {
 			if r.Method == "HEAD" {
-				w.Header().Set("Content-Type", contentTypeJSON)
-				w.WriteHeader(clientError.Code)
+				w.Header().Set("Content-Type", contentTypeOf(w))
+				w.WriteHeader(se.Code)
 			} else {
-				responseError(w)
+				if se.Code == statusTooManyRequests {
+					// the clients and the proxies back off on the status itself
+					w.Header().Set("Content-Type", contentTypeOf(w))
+					w.WriteHeader(se.Code)
+				}
+				responseError(w, &se.errorModel)
 			}
 		}
-		clientError.Code = 0
-		clientError.Text = ""
+		if m != nil && code != statusTooManyRequests {
+			recordUsage(ctx, m)
+		}
 	}
 }
 
 /* #region Auxiliary functions *********************************************************************************** */
+
+// statusError is the error a handler fails with once errorHandler has made it the answer of its request,
+// it travels back to makeHandler in the returned error so no request sees the status of another one
+type statusError struct {
+	errorModel
+	// cause is the error of the server behind a status of 500, logged with its stack, nil for the errors of the client
+	cause error
+}
+
+func (e *statusError) Error() string {
+	if e.cause != nil {
+		return e.cause.Error()
+	}
+	return e.Text
+}
+
+// isClientError tells if err is answered to the client and not to be logged to the server
+func isClientError(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.cause == nil
+}
+
 func errorHandler(code int, text string, err *error) {
-	var ok bool
-	clientError.Text, ok = statusText[code]
+	if code < statusInvalidParameters {
+		*err = errors.Errorf("status %d is not an error", code)
+		code, text = statusNotExpected, ""
+	}
+	if code == statusNotExpected && (*err == docsdb.ErrUnavailable || *err == docsdb.ErrTimeout) {
+		code, text = statusUnavailable, (*err).Error()
+	}
+	status, ok := statusText[code]
 	if !ok {
 		errorHandler(statusNotExpected, "", err)
 		return
 	}
-	clientError.Code = code
 	if text != "" {
-		clientError.Text += ": " + text
+		status += ": " + text
 	}
+	se := &statusError{errorModel: errorModel{Code: code, Text: status}}
 	if code == statusNotExpected {
-		*err = errors.WithStack(*err)
-	} else {
-		*err = errCustomNil
+		se.cause = errors.WithStack(*err)
+		if se.cause == nil {
+			se.cause = errors.New(status)
+		}
 	}
+	*err = se
 }
 
-func responseError(w http.ResponseWriter) {
-	model := &outModel{}
-	model.Error = clientError
-	err := sendJSON(w, model)
+func responseError(w http.ResponseWriter, e *errorModel) {
+	err := sendJSON(w, &outModel{Error: e})
 	if err != nil {
-		http.Error(w, clientError.Text, clientError.Code)
+		http.Error(w, e.Text, e.Code)
 	}
 }
 
+// sendJSON answers the model as JSON or as XML if the client prefers it
 func sendJSON(w http.ResponseWriter, model *outModel) (err error) {
-	modelJSON, err := json.Marshal(model)
+	model.Banner = maintenanceBanner()
+	body, err := marshalModel(w, model)
 	if err != nil {
 		errorHandler(statusNotExpected, "", &err)
 		return
 	}
-	w.Header().Set("Content-Type", contentTypeJSON)
-	_, err = w.Write(modelJSON)
+	w.Header().Set("Content-Type", contentTypeOf(w))
+	_, err = w.Write(body)
 	if err != nil {
 		errorHandler(statusNotExpected, "", &err)
 		return
@@ -184,6 +460,113 @@ func sendJSON(w http.ResponseWriter, model *outModel) (err error) {
 	return
 }
 
+// etagOf is the strong ETag of an answer, the same listing has the same one until a document of it changes
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether If-None-Match of r has etag, the weak tags compare as the strong ones
+func notModified(r *http.Request, etag string) bool {
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// listFilter reads the filter of a listing: the column with its value, the custom keys, the limit
+// and the cursor of the previous page. The expired documents are not listed
+func listFilter(r *http.Request) (filter *docsdb.Filter, err error) {
+	filter = &docsdb.Filter{
+		Column: r.FormValue(keyQuery),
+		Value:  r.FormValue(valueQuery),
+		After:  r.FormValue(afterQuery),
+		Now:    time.Now().Format(timeFormat)}
+	filter.Meta, err = metaFilter(r)
+	if err != nil {
+		return
+	}
+	limit := r.FormValue(limitQuery)
+	if filter.Column != "" {
+		var isColumnGood bool
+		for _, v := range possibleFilterColumn {
+			if strings.EqualFold(filter.Column, v) {
+				isColumnGood = true
+			}
+		}
+		if !isColumnGood {
+			errorHandler(statusInvalidParameters, "possible variants of column: "+strings.Join(possibleFilterColumn, ", "), &err)
+			return
+		}
+	}
+	if filter.After != "" {
+		_, _, err = docsdb.ParseCursor(filter.After)
+		if err != nil {
+			errorHandler(statusInvalidParameters, afterQuery+" is the next of the previous page", &err)
+			return
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(limit)
+	if filter.Limit == 0 {
+		filter.Limit = filterLimitDefault
+	}
+	return
+}
+
+// sendListing answers the documents of filter, exported in the format if there is one,
+// with the ETag of the answer and 304 if the client has it already.
+// A full page comes with next, the cursor the following page is asked after with
+func sendListing(w http.ResponseWriter, r *http.Request, filter *docsdb.Filter) (err error) {
+	if format := r.FormValue(formatQuery); format != "" {
+		return exportDocuments(w, r, filter, format)
+	}
+	var docs []*docsdb.Doc
+	docs, err = myDB.GetDocumentsList(r.Context(), filter)
+	if err == docsdb.ErrFilterTooExpensive {
+		errorHandler(statusInvalidParameters, "filters on mime, file, json, size and version are not served for so many documents, filter by id, name, public, visibility, created, owner or hash", &err)
+		return
+	}
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	s := make([]*docsdb.Doc, 0)
+	for _, v := range docs {
+		v.PreviewURL = previewURL(r, v)
+		s = append(s, v)
+	}
+	model := &outModel{Banner: maintenanceBanner()}
+	model.Data = map[string]interface{}{"docs": s}
+	if filter.Limit > 0 && len(docs) == filter.Limit {
+		model.Data["next"] = docs[len(docs)-1].Cursor
+	}
+	var modelJSON []byte
+	modelJSON, err = marshalModel(w, model)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	etag := etagOf(modelJSON)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeOf(w))
+	if r.Method == "GET" {
+		_, err = w.Write(modelJSON)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+		}
+	} else {
+		w.Header().Set("Content-Length", fmt.Sprint(len(modelJSON)))
+	}
+	return
+}
+
 func validateUserCredentials(r *http.Request, user *docsdb.User) (err error) {
 	reg := regexp.MustCompile(`^[\w]{8,}$`)
 	if !reg.MatchString(user.Login) {
@@ -204,27 +587,112 @@ func validateUserCredentials(r *http.Request, user *docsdb.User) (err error) {
 	return
 }
 
+// doesPasswordMatch compares the passwords in a time that depends on neither of them:
+// their digests are compared in constant time. The passwords kept before the hashing are compared by it
 func doesPasswordMatch(password1 string, password2 string) bool {
-	return password1 == password2
+	sum1, sum2 := sha256.Sum256([]byte(password1)), sha256.Sum256([]byte(password2))
+	return subtle.ConstantTimeCompare(sum1[:], sum2[:]) == 1
 }
 
-func getLogin(token string) (login string, err error) {
+// authFailed answers the failed sign-in started at start with the same error whatever has failed,
+// not before authFailureTime has passed so an unknown login takes as long as a wrong password
+func authFailed(start time.Time, err *error) {
+	time.Sleep(time.Until(start.Add(authFailureTime)))
+	errorHandler(statusNotAuthorized, "Invalid login or password", err)
+}
+
+// requestToken is the token of r: the bearer of Authorization or the token parameter
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.FormValue(tokenQuery)
+}
+
+func getLogin(ctx context.Context, token string) (login string, err error) {
 	if token == "" {
 		errorHandler(statusNotAuthorized, "", &err)
 		return
 	}
-	login, err = myDB.GetLogin(token)
+	c, err := checkToken(token)
+	if err != nil {
+		errorHandler(statusNotAuthorized, err.Error(), &err)
+		return
+	}
+	err = checkScope(ctx, c)
+	if err != nil {
+		return
+	}
+	login = c.Login
+	err = checkQuota(ctx, login)
+	return
+}
+
+// docAccess finds the document with id for the user of the token of r,
+// the granted users, the members of its granted groups and admins of its tenant change it and the public and the unlisted ones are read by the tenant.
+// The expired documents are answered with 410
+func docAccess(r *http.Request, id string, change bool) (doc *docsdb.Doc, err error) {
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	var login string
+	login, err = getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	if !validID(id) {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	doc, err = myDB.GetDocument(r.Context(), id)
 	if err != nil && err != errNoRows {
 		errorHandler(statusNotExpected, "", &err)
 		return
 	}
-	if login == "" {
-		errorHandler(statusNotAuthorized, "", &err)
+	if doc == nil {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	tenant, err := userTenant(r, login)
+	if err != nil {
+		return
+	}
+	if doc.Tenant != tenant {
+		doc = nil
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	if expired(doc) {
+		doc = nil
+		errorHandler(statusGone, "the document has expired", &err)
+		return
+	}
+	granted, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	for _, v := range doc.Grant {
+		if v == login {
+			granted = true
+		}
+	}
+	if !granted {
+		granted, err = inGroups(r, login, doc.Groups)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+	}
+	if !granted && (change || doc.Visibility == docsdb.VisibilityPrivate) {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
 	}
 	return
 }
 
-func readMultipartFile(r *http.Request, fpath string) (filename string, err error) {
+func readMultipartFile(r *http.Request, login string) (filename string, err error) {
 	var file multipart.File
 	var handler *multipart.FileHeader
 	file, handler, err = r.FormFile(fileQuery)
@@ -233,29 +701,59 @@ func readMultipartFile(r *http.Request, fpath string) (filename string, err erro
 		return
 	}
 	defer file.Close()
-	name, err := uuid.FromString(handler.Filename)
+	var n int64
+	filename, n, err = saveFile(r.Context(), login, handler.Filename, file)
 	if err != nil {
-		name = uuid.NewV3(uuid.NamespaceOID, handler.Filename)
+		errorHandler(statusNotExpected, "", &err)
+		return
 	}
-	path := filepath.Join(fpath, name.String()) + filepath.Ext(handler.Filename)
-	os.MkdirAll(filepath.Dir(path), os.ModeDir)
-	var f *os.File
-	f, err = os.Create(path)
+	uploadBytes.observe("", float64(n))
+	return
+}
+
+// saveFile keeps src as a new file of login named by a random uuid with the extension of the original name,
+// filename is the name of the file, see putFile. Nothing is left of the file if src fails
+func saveFile(ctx context.Context, login, original string, src io.Reader) (filename string, n int64, err error) {
+	name, err := uuid.NewV4()
 	if err != nil {
-		errorHandler(statusNotExpected, "", &err)
 		return
 	}
-	defer f.Close()
-	_, err = io.Copy(f, file)
+	path := storage.Join(login, name.String()+filepath.Ext(original))
+	_, span := startSpan(ctx, "storage.write", attribute.String("file.path", path))
+	defer func() { endSpan(span, err) }()
+	n, err = putFile(ctx, path, src)
+	span.SetAttributes(attribute.Int64("file.size", n))
 	if err != nil {
-		errorHandler(statusNotExpected, "", &err)
 		return
 	}
-	filename = filepath.Clean(strings.TrimLeft(path, dataPath))
+	filename = path
+	return
+}
+
+// uploadBody limits the body of an upload by maxMB. A body of Content-Encoding gzip is decompressed
+// and it is the decompressed one that is limited, so a small body doesn't unpack into a huge one
+func uploadBody(w http.ResponseWriter, r *http.Request) (err error) {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(http.MaxBytesReader(w, r.Body, maxMB))
+		if err != nil {
+			errorHandler(statusInvalidParameters, "the body is not gzip", &err)
+			return
+		}
+		r.Body = zr
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+	default:
+		errorHandler(statusUnsupportedMedia, "the body is to be gzip or not encoded", &err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxMB)
 	return
 }
 
-func readMulitpart(r *http.Request) (metaModel *docsdb.Doc, modelJSON []byte, err error) {
+func readMulitpart(r *http.Request) (metaModel *docsdb.Doc, modelJSON []byte, login string, err error) {
 	err = r.ParseMultipartForm(maxMB)
 	if err != nil {
 		errorHandler(statusInvalidParameters, "Memory limit size was overloaded", &err)
@@ -264,15 +762,27 @@ func readMulitpart(r *http.Request) (metaModel *docsdb.Doc, modelJSON []byte, er
 	meta := r.Form.Get(metaQuery)
 	token := r.Form.Get(tokenQuery)
 	JSON := r.Form.Get(jsonQuery)
-	var login string
-	login, err = getLogin(token)
+	login, err = getLogin(r.Context(), token)
+	if err != nil {
+		return
+	}
+	err = validateMeta([]byte(meta))
 	if err != nil {
 		return
 	}
 	metaModel = &docsdb.Doc{Created: time.Now().Format(timeFormat)}
 	err = json.Unmarshal([]byte(meta), metaModel)
 	if err != nil {
-		errorHandler(statusNotExpected, "", &err)
+		// the values the schema takes but a Doc doesn't, like json not in base64
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	if !docsdb.ValidVisibility(metaModel.Visibility) {
+		errorHandler(statusInvalidParameters, "visibility is private, unlisted or public", &err)
+		return
+	}
+	err = validExpiry(metaModel.ExpiresAt)
+	if err != nil {
 		return
 	}
 	model := &outModel{}
@@ -282,7 +792,7 @@ func readMulitpart(r *http.Request) (metaModel *docsdb.Doc, modelJSON []byte, er
 	}
 	if metaModel.File {
 		var name string
-		name, err = readMultipartFile(r, filepath.Join(dataPath, login))
+		name, err = readMultipartFile(r, login)
 		if err != nil {
 			return
 		}
@@ -298,6 +808,11 @@ func readMulitpart(r *http.Request) (metaModel *docsdb.Doc, modelJSON []byte, er
 	if !selfGranted {
 		metaModel.Grant = append(metaModel.Grant, login)
 	}
+	metaModel.Owner = login
+	metaModel.Tenant, err = userTenant(r, login)
+	if err != nil {
+		return
+	}
 	modelJSON, err = json.Marshal(model)
 	if err != nil {
 		errorHandler(statusNotExpected, "", &err)
@@ -318,31 +833,57 @@ func registerHandler(w http.ResponseWriter, r *http.Request) (err error) {
 		}
 		login := r.PostForm.Get(loginQuery)
 		password := r.PostForm.Get(passwordQuery)
-		user := &docsdb.User{Login: login, Password: password}
+		user := &docsdb.User{Login: login, Password: password, Tenant: r.PostForm.Get(tenantQuery)}
 		err = validateUserCredentials(r, user)
 		if err != nil {
 			return
 		}
+		if user.Tenant == "" {
+			user.Tenant = docsdb.DefaultTenant
+		}
+		if user.Tenant != docsdb.DefaultTenant {
+			err = placeInTenant(r, user.Tenant)
+			if err != nil {
+				return
+			}
+		}
 		token := r.PostForm.Get(tokenQuery)
+		if token == config.AdminToken && !adminAccess.permits(clientIP(r)) {
+			errorHandler(statusAccessDenied, "admins are not registered from your address", &err)
+			return
+		}
 		if token != config.AdminToken {
 			user.AdminRights = false
 		} else {
 			user.AdminRights = true
 		}
-		err = myDB.AddUser(user)
+		user.Password, err = hashPassword(user.Password)
+		if err == bcrypt.ErrPasswordTooLong {
+			errorHandler(statusInvalidParameters, "Invalid password: maximum length: 72 bytes", &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		err = myDB.AddUser(r.Context(), user)
 		if err != nil {
 			if strings.Contains(err.Error(), "UNIQUE") {
 				errorHandler(statusInvalidParameters, "user "+user.Login+" already exists", &err)
 				return
 			}
+			if strings.Contains(err.Error(), "NOT NULL") {
+				errorHandler(statusInvalidParameters, "there is no tenant "+user.Tenant, &err)
+				return
+			}
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
 		model := &outModel{}
 		if user.AdminRights {
-			model.Response = map[string]interface{}{loginQuery: user.Login, "message": "here's my man!"}
+			model.Response = map[string]interface{}{loginQuery: user.Login, tenantQuery: user.Tenant, "message": "here's my man!"}
 		} else {
-			model.Response = map[string]interface{}{loginQuery: user.Login}
+			model.Response = map[string]interface{}{loginQuery: user.Login, tenantQuery: user.Tenant}
 		}
 		err = sendJSON(w, model)
 		if err != nil {
@@ -359,6 +900,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) (err error) {
 func authHandler(w http.ResponseWriter, r *http.Request) (err error) {
 	switch r.Method {
 	case "POST":
+		start := time.Now()
 		err = r.ParseForm()
 		if err != nil {
 			errorHandler(statusInvalidParameters, "", &err)
@@ -371,38 +913,56 @@ func authHandler(w http.ResponseWriter, r *http.Request) (err error) {
 		if err != nil {
 			return
 		}
-		password, err = myDB.GetPassword(user.Login)
+		password, err = myDB.GetPassword(r.Context(), user.Login)
 		if err != nil && err != errNoRows {
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		if password == "" {
-			errorHandler(statusNotAuthorized, "Invalid login", &err)
+		known := password != ""
+		if !known {
+			// the unknown logins are compared too, to take as long as the known ones
+			password = unknownLoginHash
+		}
+		match, rehash := checkPassword(password, user.Password)
+		if !match || !known {
+			authFailed(start, &err)
+			return
+		}
+		if rehash {
+			rehashPassword(r.Context(), user.Login, user.Password)
+		}
+		user.AdminRights, err = myDB.IsAdmin(r.Context(), user.Login)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		if !doesPasswordMatch(user.Password, password) {
-			errorHandler(statusNotAuthorized, "Wrong password", &err)
+		var scopes []string
+		scopes, err = parseScopes(r.PostForm.Get(scopeQuery), user.AdminRights)
+		if err != nil {
 			return
 		}
-		var v4 uuid.UUID
-		v4, err = uuid.NewV4()
+		var c *tokenClaims
+		user.Token, c, err = issueToken(user.Login, user.AdminRights, scopes)
 		if err != nil {
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		user.Token = v4.String()
-		err = myDB.UpdateToken(user.Login, user.Token)
+		var refresh, refreshExpiresAt string
+		refresh, refreshExpiresAt, err = issueRefreshToken(r.Context(), user.Login, "", scopes)
 		if err != nil {
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
 		model := &outModel{}
-		model.Response = map[string]interface{}{tokenQuery: user.Token}
+		model.Response = map[string]interface{}{tokenQuery: user.Token, scopeQuery: scopes, expiresAtQuery: expiresAtOf(c),
+			refreshTokenQuery: refresh, refreshExpiresAtQuery: refreshExpiresAt}
 		err = sendJSON(w, model)
 		if err != nil {
 			return
 		}
-	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+	case "DELETE":
+		err = revokeToken(w, r, requestToken(r))
+	case "GET", "HEAD", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
 		errorHandler(statusUnimplementedMethod, "", &err)
 	default:
 		errorHandler(statusInvalidMethod, "", &err)
@@ -420,36 +980,26 @@ func docsHandler(w http.ResponseWriter, r *http.Request) (err error) {
 		}
 		token := r.Form.Get(tokenQuery)
 		var login string
-		login, err = getLogin(token)
+		login, err = getLogin(r.Context(), token)
 		if err != nil {
 			return
 		}
-		filter := &docsdb.Filter{
-			Login:  r.FormValue(loginQuery),
-			Column: r.FormValue(keyQuery),
-			Value:  r.FormValue(valueQuery)}
-		limit := r.FormValue(limitQuery)
-		if filter.Column != "" {
-			var isColumnGood bool
-			for _, v := range possibleFilterColumn {
-				if strings.EqualFold(filter.Column, v) {
-					isColumnGood = true
-				}
-			}
-			if !isColumnGood {
-				errorHandler(statusInvalidParameters, "possible variants of column: "+strings.Join(possibleFilterColumn, ", "), &err)
-				return
-			}
+		var filter *docsdb.Filter
+		filter, err = listFilter(r)
+		if err != nil {
+			return
 		}
-		filter.Limit, _ = strconv.Atoi(limit)
-		if filter.Limit == 0 {
-			filter.Limit = filterLimitDefault
+		filter.Shared = r.FormValue(sharedQuery)
+		if filter.Shared != "" && filter.Shared != docsdb.SharedByMe && filter.Shared != docsdb.SharedWithMe {
+			errorHandler(statusInvalidParameters, sharedQuery+" is "+docsdb.SharedByMe+" or "+docsdb.SharedWithMe, &err)
+			return
 		}
+		filter.Login = r.FormValue(loginQuery)
 		if filter.Login == "" {
 			filter.Login = login
 		} else if filter.Login != login {
 			var admin bool
-			admin, err = myDB.IsAdmin(login)
+			admin, err = isAdmin(r, login)
 			if err != nil {
 				errorHandler(statusInvalidParameters, "", &err)
 				return
@@ -458,57 +1008,44 @@ func docsHandler(w http.ResponseWriter, r *http.Request) (err error) {
 				errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
 				return
 			}
+			err = sameTenant(r, login, filter.Login)
+			if err != nil {
+				return
+			}
 		}
-		var docs []*docsdb.Doc
-		docs, err = myDB.GetDocumentsList(filter)
-		if err != nil && err != errNoRows {
-			errorHandler(statusNotExpected, "", &err)
+		return sendListing(w, r, filter)
+	case "POST":
+		var meta *docsdb.Doc
+		var modelJSON []byte
+		var u *upload
+		u, err = trackUpload(r)
+		if err != nil {
 			return
 		}
-		if docs == nil {
-			errorHandler(statusOk, "there are no enquiring documents in our database", &err)
+		defer func() { u.finish(meta, err) }()
+		err = uploadBody(w, r)
+		if err != nil {
 			return
 		}
-		s := make([]*docsdb.Doc, 0)
-		for _, v := range docs {
-			s = append(s, v)
-		}
-		model := &outModel{}
-		model.Data = map[string]interface{}{"docs": s}
-		var modelJSON []byte
-		modelJSON, err = json.Marshal(model)
+		var login string
+		meta, modelJSON, login, err = readMulitpart(r)
 		if err != nil {
-			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		w.Header().Set("Content-Type", contentTypeJSON)
-		if r.Method == "GET" {
-			_, err = w.Write(modelJSON)
-			if err != nil {
-				errorHandler(statusNotExpected, "", &err)
-			}
-		} else {
-			w.Header().Set("Content-Length", fmt.Sprint(len(modelJSON)))
-			errorHandler(statusOk, "", &err)
-		}
-	case "POST":
-		var meta *docsdb.Doc
-		var modelJSON []byte
-		r.Body = http.MaxBytesReader(w, r.Body, maxMB)
-		meta, modelJSON, err = readMulitpart(r)
+		u.processing(r.Context(), r.Form.Get(tokenQuery))
+		meta.ID, err = newID()
 		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		var v3 uuid.UUID
-		v3 = uuid.NewV3(uuid.NamespaceURL, meta.Name)
-		meta.ID = v3.String()
-		if len(meta.ID) > idNameLength {
-			meta.ID = meta.ID[:idNameLength]
-		}
-		err = myDB.CreateDocument(meta, modelJSON)
+		err = myDB.CreateDocument(withOutbox(r.Context(), hookCreated, login), meta, modelJSON)
 		if err != nil {
+			if meta.File {
+				// the name of the file is new, it is of no other document
+				removeFile(r.Context(), meta.Name)
+			}
 			if err == errNoRows {
-				errorHandler(statusInvalidParameters, "some granted users you enumerated don't exist", &err)
+				errorHandler(statusInvalidParameters, "some granted users or groups you enumerated don't exist", &err)
 				return
 			}
 			if strings.Contains(err.Error(), "UNIQUE") {
@@ -518,8 +1055,19 @@ func docsHandler(w http.ResponseWriter, r *http.Request) (err error) {
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		w.Header().Set("Content-Type", contentTypeJSON)
-		_, err = w.Write(modelJSON)
+		indexContent(r.Context(), login, meta)
+		startPreview(login, meta)
+		startOutbox()
+		recordActivity(r, meta.ID, activityCreated, meta.Name)
+		w.Header().Set("Location", publicURL(r, routes["docsID"]+meta.ID))
+		var body []byte
+		body, err = remarshalModel(w, modelJSON)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeOf(w))
+		_, err = w.Write(body)
 		if err != nil {
 			errorHandler(statusNotExpected, "", &err)
 			return
@@ -534,26 +1082,60 @@ func docsHandler(w http.ResponseWriter, r *http.Request) (err error) {
 
 func docsIDHandler(w http.ResponseWriter, r *http.Request) (err error) {
 	id := path.Base(r.URL.Path)
+	var action, key string
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, routes["docsID"]), "/"), "/")
+	if len(parts) == 2 || len(parts) == 3 {
+		id, action = parts[0], parts[1]
+	}
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+	if len(parts) == 3 && parts[0] == uploadsRoute && parts[2] == progressRoute {
+		return uploadProgressHandler(w, r, parts[1])
+	}
 	if id == routes["docs"] {
 		errorHandler(statusInvalidParameters, "id is missing or it is `docs` - offensive and inappropriate value", &err)
 		return
 	}
+	if !validID(id) {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	if action == metaRoute {
+		return metaHandler(w, r, id, key)
+	}
+	if action == linksRoute && len(parts) == 2 {
+		return linksHandler(w, r, id)
+	}
+	if action == signedURLRoute && len(parts) == 2 {
+		return signedURLHandler(w, r, id)
+	}
+	if action == convertRoute && len(parts) == 2 {
+		return convertHandler(w, r, id)
+	}
+	if action == expiryRoute && len(parts) == 2 {
+		return expiryHandler(w, r, id)
+	}
+	if action == activityRoute && len(parts) == 2 {
+		return activityHandler(w, r, id)
+	}
+	if action == previewRoute && len(parts) == 2 {
+		return previewHandler(w, r, id)
+	}
+	if len(parts) > 2 || action != "" && (action != renderRoute || r.Method != "GET") {
+		errorHandler(statusInvalidParameters, "only GET {id}/"+renderRoute+", GET {id}/"+signedURLRoute+", POST {id}/"+convertRoute+", {id}/"+expiryRoute+", GET {id}/"+activityRoute+", GET {id}/"+previewRoute+", GET "+uploadsRoute+"/{id}/"+progressRoute+", {id}/"+metaRoute+" and {id}/"+linksRoute+" are served under "+routes["docsID"], &err)
+		return
+	}
 	switch r.Method {
 	case "GET", "HEAD", "DELETE":
-		err = r.ParseForm()
-		if err != nil {
-			errorHandler(statusInvalidParameters, "", &err)
-			return
-		}
-		token := r.Form.Get(tokenQuery)
-		var login string
-		login, err = getLogin(token)
+		var doc *docsdb.Doc
+		doc, err = docAccess(r, id, r.Method == "DELETE")
 		if err != nil {
 			return
 		}
 		switch r.Method {
 		case "DELETE":
-			err = myDB.DeleteDocument(id)
+			err = myDB.DeleteDocument(r.Context(), doc.ID)
 			if err != nil {
 				if err == errNoRows {
 					errorHandler(statusInvalidParameters, "wrong id", &err)
@@ -569,74 +1151,51 @@ func docsIDHandler(w http.ResponseWriter, r *http.Request) (err error) {
 				return
 			}
 		case "GET", "HEAD":
-			var doc *docsdb.Doc
-			doc, err = myDB.GetDocument(id)
-			if err != nil && err != errNoRows {
-				errorHandler(statusNotExpected, "", &err)
-				return
-			}
-			if doc == nil {
-				errorHandler(statusInvalidParameters, "wrong id", &err)
-				return
-			}
-			var admin bool
-			admin, err = myDB.IsAdmin(login)
-			if err != nil {
-				errorHandler(statusNotExpected, "", &err)
-				return
-			}
-			if !admin {
-				if !doc.Public {
-					var isGranted bool
-					for _, v := range doc.Grant {
-						if v == login {
-							isGranted = true
-						}
-					}
-					if !isGranted {
-						errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
-						return
-					}
-				}
-			}
-			var f *os.File
-			f, err = os.Open(filepath.Join(dataPath, doc.Name))
-			if err != nil {
-				errorHandler(statusNotExpected, "", &err)
-				return
-			}
-			var fi os.FileInfo
-			fi, err = f.Stat()
-			if err != nil {
-				errorHandler(statusNotExpected, "", &err)
-				return
-			}
-			w.Header().Set("Content-Disposition", "attachment; filename="+doc.Name)
-			w.Header().Set("Content-Type", doc.Mime)
-			w.Header().Set("ContentLength", fmt.Sprint(fi.Size()))
-			if r.Method == "GET" {
-				_, err = io.Copy(w, f)
-				if err != nil {
-					errorHandler(statusNotExpected, "", &err)
-					return
-				}
-			} else {
-				errorHandler(statusOk, "", &err)
+			if action == renderRoute {
+				return renderDocument(w, r, doc)
 			}
+			return sendDocumentFile(w, r, doc, "")
 		}
 	case "PUT":
 		var metaModel *docsdb.Doc
 		var modelJSON []byte
-		r.Body = http.MaxBytesReader(w, r.Body, maxMB)
-		metaModel, modelJSON, err = readMulitpart(r)
+		var u *upload
+		u, err = trackUpload(r)
 		if err != nil {
 			return
 		}
+		defer func() { u.finish(metaModel, err) }()
+		err = uploadBody(w, r)
+		if err != nil {
+			return
+		}
+		var login string
+		metaModel, modelJSON, login, err = readMulitpart(r)
+		if err != nil {
+			return
+		}
+		u.processing(r.Context(), r.Form.Get(tokenQuery))
 		metaModel.ID = id
-		err = myDB.UpdateDocument(metaModel, modelJSON)
+		var current *docsdb.Doc
+		current, err = myDB.GetDocument(r.Context(), id)
+		if err != nil && err != errNoRows {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		if current != nil {
+			_, err = docAccess(r, id, true)
+			if err != nil {
+				return
+			}
+		}
+		err = myDB.UpdateDocument(withOutbox(r.Context(), hookUpdated, login), metaModel, modelJSON)
+		if err == nil && current != nil && current.File && metaModel.File && current.Name != metaModel.Name {
+			// the new file has a name of its own, the one it replaces is of no document now
+			removeFile(r.Context(), current.Name)
+		}
 		if err != nil {
 			if err == errNoRows {
-				errorHandler(statusInvalidParameters, "id or grant are incorect", &err)
+				errorHandler(statusInvalidParameters, "id, grant or groups are incorrect", &err)
 				return
 			}
 			if strings.Contains(err.Error(), "UNIQUE") {
@@ -646,8 +1205,18 @@ func docsIDHandler(w http.ResponseWriter, r *http.Request) (err error) {
 			errorHandler(statusNotExpected, "", &err)
 			return
 		}
-		w.Header().Set("Content-Type", contentTypeJSON)
-		_, err = w.Write(modelJSON)
+		indexContent(r.Context(), login, metaModel)
+		startPreview(login, metaModel)
+		startOutbox()
+		recordUpdate(r, current, metaModel)
+		var body []byte
+		body, err = remarshalModel(w, modelJSON)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeOf(w))
+		_, err = w.Write(body)
 		if err != nil {
 			errorHandler(statusNotExpected, "", &err)
 			return
@@ -668,18 +1237,11 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) (err error) {
 	}
 	switch r.Method {
 	case "DELETE":
-		err = myDB.ClearToken(token)
-		if err != nil {
-			errorHandler(statusNotExpected, "", &err)
-			return
-		}
-		model := &outModel{}
-		model.Response = map[string]interface{}{token: true}
-		model.Response[token] = true
-		err = sendJSON(w, model)
-		if err != nil {
+		if token == logoutAll {
+			err = revokeLogin(w, r)
 			return
 		}
+		err = revokeToken(w, r, token)
 	case "GET", "HEAD", "POST", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
 		errorHandler(statusUnimplementedMethod, "", &err)
 	default:
@@ -687,3 +1249,58 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) (err error) {
 	}
 	return
 }
+
+// logoutAll is the last element of DELETE /auth/all, the path revoking every session of the user
+const logoutAll = "all"
+
+// revokeToken revokes token until it expires and answers {token: true}, an invalid token is answered with 401.
+// The refresh token of the session is revoked too if refresh_token tells it
+func revokeToken(w http.ResponseWriter, r *http.Request, token string) (err error) {
+	c, err := checkToken(token)
+	if err != nil {
+		errorHandler(statusNotAuthorized, "the token is unknown or revoked already", &err)
+		return
+	}
+	revoked, err := revokeClaims(r.Context(), c)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if refresh := r.FormValue(refreshTokenQuery); refresh != "" {
+		err = revokeRefreshToken(r.Context(), c.Login, refresh)
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+	}
+	if !revoked {
+		errorHandler(statusNotAuthorized, "the token is unknown or revoked already", &err)
+		return
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{token: true}
+	return sendJSON(w, model)
+}
+
+// revokeLogin revokes every token of the user of the token of r and answers {login: true}.
+// The scope and the quota of the token are not checked, any session of the user logs all of them out
+func revokeLogin(w http.ResponseWriter, r *http.Request) (err error) {
+	token := requestToken(r)
+	if token == "" {
+		errorHandler(statusNotAuthorized, "", &err)
+		return
+	}
+	login := tokenLogin(token)
+	if login == "" {
+		errorHandler(statusNotAuthorized, "the token is unknown or revoked already", &err)
+		return
+	}
+	err = revokeLoginTokens(r.Context(), login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	model := &outModel{}
+	model.Response = map[string]interface{}{login: true}
+	return sendJSON(w, model)
+}
@@ -1,10 +1,170 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
 )
 
+// do serves the request by the handler of the route as main does and decodes the answer
+func do(t *testing.T, route string, handler func(http.ResponseWriter, *http.Request) error, r *http.Request) *outModel {
+	t.Helper()
+	w := httptest.NewRecorder()
+	makeHandler(route, handler)(w, r)
+	model := &outModel{}
+	err := json.Unmarshal(w.Body.Bytes(), model)
+	if err != nil {
+		t.Fatalf("%s %s: %v in %q", r.Method, r.URL, err, w.Body.String())
+	}
+	return model
+}
+
+func form(method, target string, values url.Values) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// signIn registers login and answers its token
+// useDB makes db the myDB of the test t once the deliveries and the jobs of the tests before it have ended,
+// they are waited for at the end of t too: they read myDB after the uploads have been answered
+func useDB(t *testing.T, db docsdb.ISQL) {
+	running.Wait()
+	t.Cleanup(running.Wait)
+	myDB = db
+}
+
+func signIn(t *testing.T, login string) string {
+	t.Helper()
+	values := url.Values{loginQuery: {login}, passwordQuery: {"password1"}}
+	model := do(t, routes["register"], registerHandler, form("POST", routes["register"], values))
+	if model.Error != nil {
+		t.Fatalf("register %s: %+v", login, model.Error)
+	}
+	model = do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	if model.Error != nil {
+		t.Fatalf("auth %s: %+v", login, model.Error)
+	}
+	return model.Response[tokenQuery].(string)
+}
+
+func TestDocumentsAreSeenByTheGrantedOnly(t *testing.T) {
+	useDB(t, inmem.New())
+	owner := signIn(t, "ownerlogin")
+	stranger := signIn(t, "strangerlogin")
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField(tokenQuery, owner)
+	mw.WriteField(metaQuery, `{"name":"notes","mime":"text/plain","created":"2019-01-01 00:00:00"}`)
+	mw.Close()
+	r := httptest.NewRequest("POST", routes["docs"], body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, r)
+	docs, err := myDB.GetDocumentsList(r.Context(), &docsdb.Filter{Login: "ownerlogin", Limit: -1})
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("the documents of the owner are %v, %v after %q", docs, err, w.Body.String())
+	}
+	id := docs[0].ID
+	model := do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+id+"/links?token="+owner, nil))
+	if model.Error != nil {
+		t.Errorf("the owner gets %+v", model.Error)
+	}
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+id+"/links?token="+stranger, nil))
+	if model.Error == nil || model.Error.Code != statusAccessDenied {
+		t.Errorf("a stranger gets %+v, want %d", model.Error, statusAccessDenied)
+	}
+}
+
+func TestGzipUploadIsDecompressed(t *testing.T) {
+	useDB(t, inmem.New())
+	owner := signIn(t, "gziplogin")
+	body := &bytes.Buffer{}
+	zw := gzip.NewWriter(body)
+	mw := multipart.NewWriter(zw)
+	mw.WriteField(tokenQuery, owner)
+	mw.WriteField(metaQuery, `{"name":"packed","mime":"text/plain","created":"2019-01-01 00:00:00"}`)
+	mw.Close()
+	zw.Close()
+	r := httptest.NewRequest("POST", routes["docs"], body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, r)
+	docs, err := myDB.GetDocumentsList(r.Context(), &docsdb.Filter{Login: "gziplogin", Limit: -1})
+	if err != nil || len(docs) != 1 || docs[0].Name != "packed" {
+		t.Fatalf("the documents are %v, %v after %q", docs, err, w.Body.String())
+	}
+}
+
+func TestHeadOfAnEmptyListingIsOk(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "headlogin")
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("HEAD", routes["docs"]+"?token="+token, nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("ETag") == "" {
+		t.Errorf("HEAD got %d with %q and ETag %q, want 200 with no body and an ETag", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+}
+
+func TestConcurrentErrorsKeepTheirStatus(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "concurrentlogin")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("GET", routes["docs"], nil))
+			if !strings.Contains(w.Body.String(), `"code":401`) {
+				t.Errorf("GET without a token got %q, want 401", w.Body.String())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("GET", routes["docs"]+"?token="+token, nil))
+			if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"error"`) {
+				t.Errorf("GET with a token got %d with %q, want 200", w.Code, w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAuthFailuresLookAlike(t *testing.T) {
+	useDB(t, inmem.New())
+	signIn(t, "knownlogin")
+	var texts []string
+	for _, login := range []string{"knownlogin", "unknownlogin"} {
+		values := url.Values{loginQuery: {login}, passwordQuery: {"password2"}}
+		start := time.Now()
+		model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+		if model.Error == nil || model.Error.Code != statusNotAuthorized {
+			t.Fatalf("%s: %+v, want %d", login, model.Error, statusNotAuthorized)
+		}
+		if d := time.Since(start); d < authFailureTime {
+			t.Errorf("%s failed in %v, want %v at least", login, d, authFailureTime)
+		}
+		texts = append(texts, model.Error.Text)
+	}
+	if texts[0] != texts[1] {
+		t.Errorf("a wrong password is %q and an unknown login is %q", texts[0], texts[1])
+	}
+}
+
 func BenchmarkGetDocsHandler(b *testing.B) {
 	b.StopTimer()
 	client := &http.Client{}
@@ -18,3 +178,126 @@ func BenchmarkGetDocsHandler(b *testing.B) {
 		client.Do(req)
 	}
 }
+
+func TestLogout(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "logoutlogin")
+	auth := func() string {
+		values := url.Values{loginQuery: {"logoutlogin"}, passwordQuery: {"password1"}}
+		model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+		if model.Error != nil {
+			t.Fatalf("auth: %+v", model.Error)
+		}
+		return model.Response[tokenQuery].(string)
+	}
+	model := do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+token, nil))
+	if model.Error != nil || model.Response[token] != true {
+		t.Fatalf("the logout is %+v", model)
+	}
+	model = do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+token, nil))
+	if model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("the second logout is %+v", model)
+	}
+	model = do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+"unknown", nil))
+	if model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("the logout of an unknown token is %+v", model)
+	}
+
+	token = auth()
+	r := httptest.NewRequest("DELETE", routes["auth"], nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	model = do(t, routes["auth"], authHandler, r)
+	if model.Error != nil || model.Response[token] != true {
+		t.Fatalf("the logout of the header token is %+v", model)
+	}
+	if tokenLogin(token) != "" {
+		t.Error("the header token is still known")
+	}
+
+	token = auth()
+	model = do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+logoutAll+"?"+tokenQuery+"="+url.QueryEscape(token), nil))
+	if model.Error != nil || model.Response["logoutlogin"] != true {
+		t.Fatalf("the logout of all the sessions is %+v", model)
+	}
+	model = do(t, routes["logout"], logoutHandler, httptest.NewRequest("DELETE", routes["logout"]+logoutAll+"?"+tokenQuery+"="+url.QueryEscape(token), nil))
+	if model.Error == nil || model.Error.Code != statusNotAuthorized {
+		t.Errorf("the logout of all the sessions of a revoked token is %+v", model)
+	}
+}
+
+func TestSharedListings(t *testing.T) {
+	useDB(t, inmem.New())
+	ann := signIn(t, "sharerlogin")
+	bob := signIn(t, "shareelogin")
+	ctx := httptest.NewRequest("GET", "/", nil).Context()
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "kept", Owner: "sharerlogin", Grant: []string{"sharerlogin"}},
+		{ID: "2", Name: "given", Owner: "sharerlogin", Grant: []string{"sharerlogin", "shareelogin"}},
+		{ID: "3", Name: "taken", Owner: "shareelogin", Grant: []string{"shareelogin", "sharerlogin"}},
+	} {
+		if err := myDB.CreateDocument(ctx, d, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(token, shared string) string {
+		model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?limit=-1&shared="+shared+"&token="+token, nil))
+		if model.Error != nil {
+			t.Fatalf("shared=%s gets %+v", shared, model.Error)
+		}
+		var ids []string
+		docs, _ := model.Data["docs"].([]interface{})
+		for _, v := range docs {
+			ids = append(ids, v.(map[string]interface{})["id"].(string))
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := list(ann, docsdb.SharedByMe); got != "2" {
+		t.Errorf("the documents shared by the sharer are %s, want 2", got)
+	}
+	if got := list(ann, docsdb.SharedWithMe); got != "3" {
+		t.Errorf("the documents shared with the sharer are %s, want 3", got)
+	}
+	if got := list(bob, docsdb.SharedWithMe); got != "2" {
+		t.Errorf("the documents shared with the sharee are %s, want 2", got)
+	}
+	model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?shared=everyone&token="+ann, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("an unknown shared gets %+v", model.Error)
+	}
+}
+
+func TestListingPagesFollowNext(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "pagerlogin")
+	ctx := httptest.NewRequest("GET", "/", nil).Context()
+	for _, id := range []string{"1", "2", "3"} {
+		d := &docsdb.Doc{ID: id, Name: "page", Created: "2019-01-01 00:00:00", Grant: []string{"pagerlogin"}}
+		if err := myDB.CreateDocument(ctx, d, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ids []string
+	after := ""
+	for i := 0; i < 3; i++ {
+		model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?limit=2&after="+after+"&token="+token, nil))
+		if model.Error != nil {
+			t.Fatalf("the page after %q gets %+v", after, model.Error)
+		}
+		docs, _ := model.Data["docs"].([]interface{})
+		for _, v := range docs {
+			ids = append(ids, v.(map[string]interface{})["id"].(string))
+		}
+		next, _ := model.Data["next"].(string)
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	if got := strings.Join(ids, ","); got != "1,2,3" {
+		t.Errorf("the pages list %s, want 1,2,3", got)
+	}
+	model := do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?after=nowhere&token="+token, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("an invalid after gets %+v", model.Error)
+	}
+}
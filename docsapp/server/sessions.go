@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// the texts of 401 telling the clients whether to sign in again or to give up the token
+	tokenExpiredText = "the token has expired"
+	tokenInvalidText = "the token is invalid"
+	// tokenHeader and tokenExpiresHeader carry the token a sliding session is moved ahead with
+	tokenHeader        = "X-Token"
+	tokenExpiresHeader = "X-Token-Expires"
+)
+
+// sessionsConfig is the "sessions" of config.json: TTL is how long a token lives, like "24h", defaultTokenTTL
+// without it. With Sliding a token used past the half of its life is answered with a new one in X-Token,
+// the clients keep using the one they have until they pick it. RefreshTTL is how long a refresh token lives,
+// defaultRefreshTTL without it
+type sessionsConfig struct {
+	TTL        string `json:"ttl"`
+	Sliding    bool   `json:"sliding"`
+	RefreshTTL string `json:"refresh_ttl"`
+}
+
+var (
+	sessionTTL     time.Duration
+	sessionSliding bool
+)
+
+// initSessions reads the sessions of config.json
+func initSessions(c sessionsConfig) (err error) {
+	sessionTTL, sessionSliding = 0, c.Sliding
+	if c.TTL != "" {
+		sessionTTL, err = time.ParseDuration(c.TTL)
+		if err != nil {
+			return
+		}
+	}
+	refreshTTL = defaultRefreshTTL
+	if c.RefreshTTL != "" {
+		refreshTTL, err = time.ParseDuration(c.RefreshTTL)
+	}
+	return
+}
+
+// slideSession sets X-Token of header to a new token like the one of c once it has lived the half of its life.
+// The request goes on with the token it has if the new one is not made
+func slideSession(header http.Header, c *tokenClaims) {
+	if !sessionSliding || header == nil || time.Until(time.Unix(c.ExpiresAt, 0)) > tokenTTL()/2 {
+		return
+	}
+	token, next, err := issueToken(c.Login, c.Admin, c.Scopes)
+	if err != nil {
+		return
+	}
+	header.Set(tokenHeader, token)
+	header.Set(tokenExpiresHeader, expiresAtOf(next))
+}
+
+// purgeTokens forgets the revoked tokens which have expired, they are refused anyway, and the expired refresh tokens,
+// and reads the revocations of the other instances
+func purgeTokens(ctx context.Context) (n int64, err error) {
+	now := time.Now().Format(timeFormat)
+	n, err = myDB.ClearRevokedTokens(ctx, now)
+	if err != nil {
+		return
+	}
+	refreshed, err := myDB.ClearRefreshTokens(ctx, now)
+	if err != nil {
+		return
+	}
+	return n + refreshed, loadRevocations(ctx)
+}
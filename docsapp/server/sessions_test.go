@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestExpiredTokensAreToldFromInvalidOnes(t *testing.T) {
+	useDB(t, inmem.New())
+	defer initSessions(sessionsConfig{})
+	if err := initSessions(sessionsConfig{TTL: "1h", Sliding: true}); err != nil {
+		t.Fatal(err)
+	}
+	list := func(token string) *outModel {
+		return do(t, routes["docs"], docsHandler, httptest.NewRequest("GET", routes["docs"]+"?token="+token, nil))
+	}
+	values := url.Values{loginQuery: {"sessionlogin"}, passwordQuery: {"password1"}}
+	do(t, routes["register"], registerHandler, form("POST", routes["register"], values))
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], values))
+	token, _ := model.Response[tokenQuery].(string)
+	if model.Error != nil || model.Response[expiresAtQuery] == nil {
+		t.Fatalf("the sign in is %+v", model)
+	}
+	c, err := parseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sliding session gets a new token past the half of its life
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("GET", routes["docs"]+"?token="+token, nil))
+	if w.Header().Get(tokenHeader) != "" {
+		t.Errorf("a new token gets %s", tokenHeader)
+	}
+	c.ExpiresAt = time.Now().Add(sessionTTL / 4).Unix()
+	old, err := signToken(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, httptest.NewRequest("GET", routes["docs"]+"?token="+old, nil))
+	next, err := parseToken(w.Header().Get(tokenHeader))
+	if err != nil || next.Login != c.Login || next.ExpiresAt <= c.ExpiresAt || w.Header().Get(tokenExpiresHeader) != expiresAtOf(next) {
+		t.Errorf("the token of a sliding session is %+v, %v", next, err)
+	}
+
+	c.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	expired, err := signToken(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model = list(expired); model.Error == nil || model.Error.Code != statusNotAuthorized || !strings.HasSuffix(model.Error.Text, tokenExpiredText) {
+		t.Errorf("an expired token gets %+v", model.Error)
+	}
+	if model = list("unknown"); model.Error == nil || model.Error.Code != statusNotAuthorized || !strings.HasSuffix(model.Error.Text, tokenInvalidText) {
+		t.Errorf("an unknown token gets %+v", model.Error)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// shutdownTimeout is the time the requests, the jobs and the hooks have to finish after SIGINT or SIGTERM
+const shutdownTimeout = 30 * time.Second
+
+var (
+	// running are the jobs and the hooks going on after their requests, the shutdown waits for them
+	running sync.WaitGroup
+	// loops are the loops startLoop has started, the shutdown waits for them to return before the database is disconnected
+	loops sync.WaitGroup
+	// stopping is closed at the shutdown for the feeds of /events and the loops to end, they never go idle by themselves
+	stopping = make(chan struct{})
+	stopOnce sync.Once
+)
+
+// stop closes stopping once
+func stop() {
+	stopOnce.Do(func() { close(stopping) })
+}
+
+// stopped reports whether the shutdown has begun
+func stopped() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// nextTick waits for the next tick of ticker, it is false once the shutdown has begun
+// even if the tick has come at the same time
+func nextTick(ticker *time.Ticker) bool {
+	select {
+	case <-stopping:
+		return false
+	case <-ticker.C:
+		return !stopped()
+	}
+}
+
+// startLoop runs loop, which returns once stopping is closed, for the shutdown to wait for it
+func startLoop(loop func()) {
+	loops.Add(1)
+	go func() {
+		defer loops.Done()
+		loop()
+	}()
+}
+
+// serveUntilStopped serves srv on l, on HTTPS if it has a TLSConfig, until SIGINT or SIGTERM, then it stops taking requests
+// and waits for the ones in flight, the jobs, the hooks and the loops to finish within shutdownTimeout,
+// so no file of an upload is left on disk without its document. The loops are stopped if srv fails too
+func serveUntilStopped(srv *http.Server, l net.Listener) (err error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	srv.RegisterOnShutdown(stop)
+	failed := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			failed <- srv.ServeTLS(l, "", "")
+			return
+		}
+		failed <- srv.Serve(l)
+	}()
+	select {
+	case err = <-failed:
+		stop()
+		waitStopped()
+		return errors.WithStack(err)
+	case s := <-signals:
+		log.Printf("%v: shutting down", s)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		return errors.Wrap(err, "the requests are left unfinished")
+	}
+	return waitRunning(ctx)
+}
+
+// waitStopped waits within shutdownTimeout for the jobs, the hooks and the loops once srv has failed,
+// for the database not to be disconnected under them
+func waitStopped() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := waitRunning(ctx)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// waitRunning waits for the running jobs, hooks and loops until ctx is done
+func waitRunning(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		loops.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "the jobs are left unfinished")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownFinishesTheRequestsInFlight(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan bool), make(chan bool)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		w.Write([]byte("done"))
+	})}
+	stopped := make(chan error, 1)
+	go func() { stopped <- serveUntilStopped(srv, l) }()
+	answered := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			answered <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		answered <- string(body)
+	}()
+	<-started
+	j, err := newJob("shutdown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err = <-stopped:
+		t.Fatalf("the server stopped with %v before its request", err)
+	default:
+	}
+	close(release)
+	if got := <-answered; got != "done" {
+		t.Errorf("the request in flight got %q, want done", got)
+	}
+	j.finish("", nil)
+	if err = <-stopped; err != nil {
+		t.Errorf("the shutdown failed with %v", err)
+	}
+	select {
+	case <-stopping:
+	default:
+		t.Error("the feeds are not stopped")
+	}
+}
+
+func TestLoopsReturnAtTheShutdown(t *testing.T) {
+	startLoop(purgeLoop)
+	startLoop(outboxLoop)
+	stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := waitRunning(ctx); err != nil {
+		t.Errorf("the loops are running after the shutdown: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	takeoutRoute = "takeout"
+	// takeoutMetaKey marks the archives of the takeouts, the later takeouts leave them out
+	takeoutMetaKey = "takeout"
+	// takeoutTTL is how long an archive is kept and its signed url is valid
+	takeoutTTL = 24 * time.Hour
+	// takeoutFiles is the directory of the files of the documents in an archive
+	takeoutFiles = "files"
+)
+
+// takeoutDoc is a document in documents.json of an archive with its keys, links and activity,
+// Path is where its file is in the archive
+type takeoutDoc struct {
+	*docsdb.Doc
+	JSON     string             `json:"json,omitempty"`
+	Path     string             `json:"path,omitempty"`
+	Meta     []*docsdb.Meta     `json:"meta,omitempty"`
+	Links    []*docsdb.Link     `json:"links,omitempty"`
+	Activity []*docsdb.Activity `json:"activity,omitempty"`
+}
+
+// takeoutAccount is account.json of an archive
+type takeoutAccount struct {
+	Login  string   `json:"login"`
+	Tenant string   `json:"tenant"`
+	Groups []string `json:"groups"`
+}
+
+// takeoutHandler starts the archive of everything of the login of the token on POST /me/takeout:
+// account.json, documents.json with the keys, links and activity of the documents granted to it,
+// their files in files/ and audit.json with the audit log of the account. The job followed at /jobs/{id}
+// and in the feed at /events ends with the signed url the archive is downloaded by until it expires
+func takeoutHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "POST":
+	case "GET", "HEAD", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	tenant, err := userTenant(r, login)
+	if err != nil {
+		return
+	}
+	j, err := newJob(takeoutRoute, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	files := publicURL(r, routes["files"])
+	go func() {
+		ctx := context.Background()
+		docID, err := buildTakeout(ctx, j, login, tenant)
+		if err != nil {
+			log.Printf("the takeout of %s: %+v", login, err)
+		} else {
+			expires := time.Now().Add(takeoutTTL).Unix()
+			q := url.Values{expiresQuery: {strconv.FormatInt(expires, 10)}, signatureQuery: {signDownload(docID, expires)}}
+			j.setURL(files + docID + "?" + q.Encode())
+			recordAudit(ctx, login, login, auditTakeout, docID)
+		}
+		j.finish(docID, err)
+	}()
+	status := publicURL(r, routes["jobs"]+j.ID)
+	w.Header().Set("Location", status)
+	model := &outModel{}
+	model.Response = map[string]interface{}{"job": j.ID, "status": status}
+	return sendJSON(w, model)
+}
+
+// buildTakeout writes the archive of login into the file of a new private document of it expiring in takeoutTTL
+func buildTakeout(ctx context.Context, j *job, login, tenant string) (docID string, err error) {
+	now := time.Now()
+	groups, err := myDB.GetUserGroups(ctx, login)
+	if err != nil {
+		return
+	}
+	docs, total, err := takeoutDocs(ctx, login, groups, now)
+	if err != nil {
+		return
+	}
+	audit, err := takeoutAudit(ctx, login)
+	if err != nil {
+		return
+	}
+	account := &takeoutAccount{Login: login, Tenant: tenant, Groups: groups}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTakeout(ctx, pw, j, total, account, docs, audit))
+	}()
+	doc := &docsdb.Doc{Grant: []string{login}, Owner: login, Tenant: tenant, Mime: "application/zip", File: true,
+		Visibility: docsdb.VisibilityPrivate, Created: now.Format(timeFormat), ExpiresAt: now.Add(takeoutTTL).Format(timeFormat)}
+	doc.Name, _, err = saveFile(ctx, login, takeoutRoute+"-"+j.ID+".zip", pr)
+	pr.Close()
+	if err != nil {
+		return
+	}
+	doc.ID, err = newID()
+	if err == nil {
+		err = myDB.CreateDocument(ctx, doc, nil)
+	}
+	if err != nil {
+		removeFile(ctx, doc.Name)
+		return
+	}
+	err = myDB.SetMeta(ctx, doc.ID, &docsdb.Meta{Key: takeoutMetaKey, Type: docsdb.MetaString, Value: j.ID})
+	return doc.ID, errors.WithStack(err)
+}
+
+// takeoutDocs finds the documents granted to login or its groups but the archives of the takeouts,
+// total is the size of their files
+func takeoutDocs(ctx context.Context, login string, groups []string, now time.Time) (docs []*takeoutDoc, total int64, err error) {
+	listed, err := myDB.GetDocumentsList(ctx, &docsdb.Filter{Login: login, Limit: -1, Now: now.Format(timeFormat)})
+	if err != nil && err != errNoRows {
+		return
+	}
+	for _, v := range listed {
+		var d *docsdb.Doc
+		d, err = myDB.GetDocument(ctx, v.ID)
+		if err == errNoRows {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if !grantedTo(d, login, groups) {
+			continue
+		}
+		e := &takeoutDoc{Doc: d, JSON: string(d.JSON)}
+		e.Meta, err = myDB.GetMeta(ctx, d.ID)
+		if err != nil {
+			return
+		}
+		if hasMeta(e.Meta, takeoutMetaKey) {
+			continue
+		}
+		e.Links, err = myDB.GetLinks(ctx, d.ID)
+		if err != nil {
+			return
+		}
+		e.Activity, err = myDB.GetActivity(ctx, d.ID, 0, -1)
+		if err != nil {
+			return
+		}
+		if d.File {
+			e.Path = path.Join(takeoutFiles, d.ID+path.Ext(d.Name))
+			fi, err := statFile(ctx, d.Name)
+			if err != nil {
+				return nil, 0, errors.WithStack(err)
+			}
+			total += fi.Size()
+		}
+		docs = append(docs, e)
+	}
+	return docs, total, nil
+}
+
+// takeoutAudit finds the entries of the audit log of the account of login or done by it
+func takeoutAudit(ctx context.Context, login string) (audit []*docsdb.Audit, err error) {
+	all, err := myDB.GetAudit(ctx, 0, -1)
+	if err != nil {
+		return
+	}
+	audit = make([]*docsdb.Audit, 0)
+	for _, a := range all {
+		if a.Login == login || a.Actor == login {
+			audit = append(audit, a)
+		}
+	}
+	return
+}
+
+// writeTakeout writes the archive to w, the job gets the progress of the files of total bytes
+func writeTakeout(ctx context.Context, w io.Writer, j *job, total int64, account *takeoutAccount, docs []*takeoutDoc, audit []*docsdb.Audit) (err error) {
+	zw := zip.NewWriter(w)
+	for _, v := range []struct {
+		name  string
+		value interface{}
+	}{{"account.json", account}, {"documents.json", docs}, {"audit.json", audit}} {
+		var f io.Writer
+		f, err = zw.Create(v.name)
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(v.value)
+		if err != nil {
+			return
+		}
+	}
+	var done int64
+	for _, d := range docs {
+		if d.Path == "" {
+			continue
+		}
+		var n int64
+		n, err = copyToZip(ctx, zw, d.Path, d.Name)
+		if err != nil {
+			return
+		}
+		done += n
+		j.progress(done, total)
+	}
+	return zw.Close()
+}
+
+// copyToZip copies the stored file name into the archive as entry
+func copyToZip(ctx context.Context, zw *zip.Writer, entry, name string) (n int64, err error) {
+	f, err := zw.Create(entry)
+	if err != nil {
+		return
+	}
+	src, err := openFile(ctx, name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	return io.Copy(f, src)
+}
+
+// grantedTo reports whether d is granted to login or one of its groups
+func grantedTo(d *docsdb.Doc, login string, groups []string) bool {
+	for _, v := range d.Grant {
+		if v == login {
+			return true
+		}
+	}
+	for _, v := range d.Groups {
+		for _, g := range groups {
+			if v == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasMeta reports whether meta has key
+func hasMeta(meta []*docsdb.Meta, key string) bool {
+	for _, m := range meta {
+		if m.Key == key {
+			return true
+		}
+	}
+	return false
+}
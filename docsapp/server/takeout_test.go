@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+	"github.com/rav1L/docsapp/server/modules/storage"
+)
+
+// waitJob waits for the job with id to finish and answers it
+func waitJob(t *testing.T, id string) job {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		jobs.Lock()
+		j := *jobs.m[id]
+		jobs.Unlock()
+		if j.State != jobRunning {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the job %s is still running", id)
+	return job{}
+}
+
+func TestTakeoutArchivesTheDocumentsOfTheUser(t *testing.T) {
+	useDB(t, inmem.New())
+	defer func(s storage.Dir) { store = s }(store)
+	store = storage.Dir(t.TempDir())
+	ctx := context.Background()
+	token := signIn(t, "takeoutlogin")
+	signIn(t, "otherlogin")
+	f, err := store.Create("takeoutlogin/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("the text of a"))
+	f.Close()
+	for _, d := range []*docsdb.Doc{
+		{ID: "1", Name: "takeoutlogin/a.txt", File: true, Grant: []string{"takeoutlogin"}},
+		{ID: "2", Name: "notes", JSON: []byte(`{"a":1}`), Grant: []string{"takeoutlogin", "otherlogin"}},
+		{ID: "3", Name: "of another", Visibility: docsdb.VisibilityPublic, Grant: []string{"otherlogin"}},
+	} {
+		if err = myDB.CreateDocument(ctx, d, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recordAudit(ctx, "takeoutlogin", "takeoutlogin", auditDeletionRequested, "")
+	recordAudit(ctx, "otherlogin", "otherlogin", auditDeletionRequested, "")
+
+	model := do(t, routes["meTakeout"], takeoutHandler, form("POST", routes["meTakeout"], url.Values{tokenQuery: {token}}))
+	if model.Error != nil {
+		t.Fatalf("the takeout is %+v", model.Error)
+	}
+	j := waitJob(t, model.Response["job"].(string))
+	if j.State != jobDone || j.Doc == "" || j.URL == "" {
+		t.Fatalf("the job is %+v", j)
+	}
+	u, err := url.Parse(j.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	makeHandler(routes["files"]+"{id}", filesHandler)(w, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if w.Code != 200 {
+		t.Fatalf("the signed url answers %d %s", w.Code, w.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string][]byte)
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[zf.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	if string(entries["files/1.txt"]) != "the text of a" {
+		t.Errorf("the file of 1 is %q in %v", entries["files/1.txt"], zr.File)
+	}
+	var docs []struct {
+		ID   string `json:"id"`
+		JSON string `json:"json"`
+		Path string `json:"path"`
+	}
+	if err = json.Unmarshal(entries["documents.json"], &docs); err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]string)
+	for _, d := range docs {
+		byID[d.ID] = d.Path + d.JSON
+	}
+	if len(docs) != 2 || byID["1"] != "files/1.txt" || byID["2"] != `{"a":1}` {
+		t.Errorf("documents.json is %s, want 1 and 2", entries["documents.json"])
+	}
+	var audit []*docsdb.Audit
+	if err = json.Unmarshal(entries["audit.json"], &audit); err != nil {
+		t.Fatal(err)
+	}
+	if len(audit) != 1 || audit[0].Login != "takeoutlogin" {
+		t.Errorf("audit.json is %s, want the entry of takeoutlogin", entries["audit.json"])
+	}
+
+	model = do(t, routes["meTakeout"], takeoutHandler, form("POST", routes["meTakeout"], url.Values{tokenQuery: {token}}))
+	next := waitJob(t, model.Response["job"].(string))
+	doc, err := myDB.GetDocument(ctx, next.Doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := openFile(ctx, doc.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, _ := ioutil.ReadAll(rc)
+	zr, err = zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, zf := range zr.File {
+		if zf.Name == "files/"+j.Doc+".zip" {
+			t.Errorf("a takeout has the archive of the previous one")
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	tenantQuery = "tenant"
+	nameQuery   = "name"
+)
+
+var tenantName = regexp.MustCompile(`^[\w-]{1,64}$`)
+
+// userTenant finds the tenant of login
+func userTenant(r *http.Request, login string) (tenant string, err error) {
+	tenant, err = myDB.GetUserTenant(r.Context(), login)
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if tenant == "" {
+		errorHandler(statusNotAuthorized, "", &err)
+	}
+	return
+}
+
+// sameTenant refuses the admins looking at the documents of a user of another tenant
+func sameTenant(r *http.Request, login, other string) (err error) {
+	tenant, err := userTenant(r, login)
+	if err != nil {
+		return
+	}
+	otherTenant, err := myDB.GetUserTenant(r.Context(), other)
+	if err != nil && err != errNoRows {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	if otherTenant != tenant {
+		errorHandler(statusInvalidParameters, "there is no user "+other, &err)
+	}
+	return
+}
+
+// isSuperAdmin reports whether login is one of the super_admins of config.json calling from the admin addresses
+// with a token of the admin scope
+func isSuperAdmin(r *http.Request, login string) bool {
+	if !adminAccess.permits(clientIP(r)) || !hasScope(r, scopeAdmin) {
+		return false
+	}
+	configLock.RLock()
+	defer configLock.RUnlock()
+	for _, v := range config.SuperAdmins {
+		if v == login {
+			return true
+		}
+	}
+	return false
+}
+
+// placeInTenant refuses registering a user in tenant but to the super admins and the admins of tenant,
+// signed in with the bearer of Authorization: the tenant of the form is anyone's to name, and the admin token
+// of the form only makes the user an admin
+func placeInTenant(r *http.Request, tenant string) (err error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		errorHandler(statusAccessDenied, "only the admins of the tenant register users in it", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		return
+	}
+	if isSuperAdmin(r, login) {
+		return nil
+	}
+	admin, err := isAdmin(r, login)
+	if err != nil {
+		errorHandler(statusNotExpected, "", &err)
+		return
+	}
+	own, err := userTenant(r, login)
+	if err != nil {
+		return
+	}
+	if !admin || own != tenant {
+		errorHandler(statusAccessDenied, "only the admins of the tenant register users in it", &err)
+	}
+	return
+}
+
+// tenantsHandler lists the tenants on GET /tenants, creates one on POST /tenants name=...
+// and deletes an empty one on DELETE /tenants/{name}, for the super admins only
+func tenantsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	switch r.Method {
+	case "GET", "POST", "DELETE":
+	case "HEAD", "PUT", "PATCH", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	if !isSuperAdmin(r, login) {
+		errorHandler(statusAccessDenied, "YOU SHALL NOT PASS", &err)
+		return
+	}
+	model := &outModel{}
+	switch r.Method {
+	case "GET":
+		var tenants []*docsdb.Tenant
+		tenants, err = myDB.GetTenants(r.Context())
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Data = map[string]interface{}{"tenants": tenants}
+	case "POST":
+		t := &docsdb.Tenant{Name: r.PostForm.Get(nameQuery), Created: time.Now().Format(timeFormat)}
+		if !tenantName.MatchString(t.Name) {
+			errorHandler(statusInvalidParameters, "the name of a tenant is up to 64 letters, digits, _ and -", &err)
+			return
+		}
+		err = myDB.AddTenant(r.Context(), t)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				errorHandler(statusInvalidParameters, "tenant "+t.Name+" already exists", &err)
+				return
+			}
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{t.Name: true}
+	case "DELETE":
+		name := path.Base(r.URL.Path)
+		if name == path.Base(routes["tenants"]) {
+			errorHandler(statusInvalidParameters, "the tenant is /tenants/{name}", &err)
+			return
+		}
+		err = myDB.DeleteTenant(r.Context(), name)
+		if err == docsdb.ErrTenantNotEmpty {
+			errorHandler(statusInvalidParameters, "tenant "+name+" has users or documents or is the default one", &err)
+			return
+		}
+		if err == errNoRows {
+			errorHandler(statusInvalidParameters, "there is no tenant "+name, &err)
+			return
+		}
+		if err != nil {
+			errorHandler(statusNotExpected, "", &err)
+			return
+		}
+		model.Response = map[string]interface{}{name: true}
+	}
+	return sendJSON(w, model)
+}
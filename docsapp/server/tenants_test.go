@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestUsersAreRegisteredInATenantByItsAdmins(t *testing.T) {
+	useDB(t, inmem.New())
+	ctx := context.Background()
+	if err := myDB.AddTenant(ctx, &docsdb.Tenant{Name: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashPassword("password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = myDB.AddUser(ctx, &docsdb.User{Login: "acmeadmin", Password: hash, AdminRights: true, Tenant: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	model := do(t, routes["auth"], authHandler, form("POST", routes["auth"], url.Values{loginQuery: {"acmeadmin"}, passwordQuery: {"password1"}}))
+	admin, _ := model.Response[tokenQuery].(string)
+	stranger := signIn(t, "acmestranger")
+	register := func(login, bearer string) *outModel {
+		r := form("POST", routes["register"], url.Values{loginQuery: {login}, passwordQuery: {"password1"}, tenantQuery: {"acme"}})
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		return do(t, routes["register"], registerHandler, r)
+	}
+	for login, bearer := range map[string]string{"acmeintruder": "", "acmeguest": stranger} {
+		if model = register(login, bearer); model.Error == nil || model.Error.Code != statusAccessDenied {
+			t.Errorf("%s is registered in the tenant by %q: %+v", login, bearer, model)
+		}
+	}
+	if model = register("acmenewcomer", admin); model.Error != nil || model.Response[tenantQuery] != "acme" {
+		t.Errorf("the admin of the tenant registers %+v", model)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertCacheDefault is the directory the certificates of Let's Encrypt are kept in without tls.autocert_cache
+const autocertCacheDefault = "autocert"
+
+// tlsConfig is the "tls" of config.json, the server listens on HTTPS with it: with the certificate
+// of CertFile and KeyFile, or with the ones Let's Encrypt issues for AutocertHosts, kept in AutocertCache.
+// HTTPAddr, like ":80", is listened on HTTP too for the challenges of Let's Encrypt and to redirect to HTTPS,
+// the certificates of Let's Encrypt need it on port 80
+type tlsConfig struct {
+	CertFile      string   `json:"cert_file"`
+	KeyFile       string   `json:"key_file"`
+	AutocertHosts []string `json:"autocert_hosts"`
+	AutocertCache string   `json:"autocert_cache"`
+	AutocertEmail string   `json:"autocert_email"`
+	HTTPAddr      string   `json:"http_addr"`
+}
+
+var (
+	// serverTLS is the TLS of the server, nil if it serves HTTP
+	serverTLS *tls.Config
+	// httpHandler answers on tls.http_addr
+	httpHandler http.Handler
+)
+
+// initTLS reads the tls of config.json, the certificate files are to exist
+func initTLS(c tlsConfig) (err error) {
+	serverTLS, httpHandler = nil, nil
+	files := c.CertFile != "" || c.KeyFile != ""
+	switch {
+	case files && len(c.AutocertHosts) > 0:
+		return errors.New("tls has either cert_file and key_file or autocert_hosts")
+	case files:
+		if c.CertFile == "" || c.KeyFile == "" {
+			return errors.New("tls.cert_file and tls.key_file go together")
+		}
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return errors.Wrap(err, "tls")
+		}
+		serverTLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		httpHandler = http.HandlerFunc(redirectHTTPS)
+	case len(c.AutocertHosts) > 0:
+		cache := c.AutocertCache
+		if cache == "" {
+			cache = autocertCacheDefault
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertHosts...),
+			Cache:      autocert.DirCache(cache),
+			Email:      c.AutocertEmail,
+		}
+		serverTLS = m.TLSConfig()
+		serverTLS.MinVersion = tls.VersionTLS12
+		httpHandler = m.HTTPHandler(nil)
+	default:
+		if c.HTTPAddr != "" {
+			return errors.New("tls.http_addr is of the HTTPS servers")
+		}
+	}
+	return
+}
+
+// listenHTTP serves httpHandler on addr for the life of the process, the server of HTTPS is the one stopped by signals
+func listenHTTP(addr string) {
+	if addr == "" || httpHandler == nil {
+		return
+	}
+	go func() {
+		log.Printf("tls.http_addr %s: %v", addr, http.ListenAndServe(addr, httpHandler))
+	}()
+}
+
+// redirectHTTPS sends the clients of HTTP to the same url on HTTPS, on the port of listenAddr
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	name := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		name = h
+	}
+	if _, port, err := net.SplitHostPort(listenAddr); err == nil && port != "443" {
+		name = net.JoinHostPort(name, port)
+	}
+	http.Redirect(w, r, "https://"+name+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
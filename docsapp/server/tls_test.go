@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate of localhost and its key into dir
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "localhost"},
+		DNSNames: []string{"localhost"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestTLSConfig(t *testing.T) {
+	defer initTLS(tlsConfig{})
+	certFile, keyFile := writeCert(t, t.TempDir())
+	err := initTLS(tlsConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil || serverTLS == nil || len(serverTLS.Certificates) != 1 {
+		t.Fatalf("the certificate files make %+v, %v", serverTLS, err)
+	}
+	err = initTLS(tlsConfig{AutocertHosts: []string{"docs.example.com"}})
+	if err != nil || serverTLS == nil || serverTLS.GetCertificate == nil {
+		t.Errorf("autocert makes %+v, %v", serverTLS, err)
+	}
+	for _, c := range []tlsConfig{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, AutocertHosts: []string{"docs.example.com"}},
+		{CertFile: filepath.Join(t.TempDir(), "none.pem"), KeyFile: keyFile},
+		{HTTPAddr: ":80"},
+	} {
+		if err = initTLS(c); err == nil {
+			t.Errorf("%+v is taken", c)
+		}
+	}
+	if err = initTLS(tlsConfig{}); err != nil || serverTLS != nil {
+		t.Errorf("no tls makes %+v, %v", serverTLS, err)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	w := httptest.NewRecorder()
+	redirectHTTPS(w, httptest.NewRequest("GET", "http://docs.example.com/docs?limit=1", nil))
+	if got, want := w.Header().Get("Location"), "https://docs.example.com:8080/docs?limit=1"; got != want {
+		t.Errorf("the redirect is to %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb"
+)
+
+const (
+	uploadsRoute   = "uploads"
+	progressRoute  = "progress"
+	uploadIDHeader = "Upload-ID"
+	// uploadTTL is how long a finished upload is kept for its progress to be read
+	uploadTTL = time.Hour
+)
+
+// the states of an upload before it is jobDone or jobFailed
+const (
+	uploadReceiving  = "receiving"
+	uploadProcessing = "processing"
+)
+
+// upload is the progress of the POST /docs or PUT /docs/{id} of a client sending an Upload-ID,
+// it is read at /docs/uploads/{id}/progress and pushed to /events of its login.
+// Received and Total are the bytes of the body as it is sent, Total and Percent are -1 if it is not known.
+// The login is known before the body is received if the token is in the query, otherwise once the form is read
+type upload struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Received  int64  `json:"received"`
+	Total     int64  `json:"total"`
+	Percent   int64  `json:"percent"`
+	Doc       string `json:"doc,omitempty"`
+	Error     string `json:"error,omitempty"`
+	login     string
+	published int64
+	updated   time.Time
+}
+
+var uploads = struct {
+	sync.Mutex
+	m map[string]*upload
+}{m: make(map[string]*upload)}
+
+// uploadReader counts the bytes of the body of the upload
+type uploadReader struct {
+	io.ReadCloser
+	upload *upload
+}
+
+func (u *uploadReader) Read(b []byte) (n int, err error) {
+	n, err = u.ReadCloser.Read(b)
+	u.upload.receive(int64(n))
+	return
+}
+
+// trackUpload registers the upload of r if it has an Upload-ID, a UUID the client makes, and counts its body.
+// u is nil otherwise, its methods do nothing then
+func trackUpload(r *http.Request) (u *upload, err error) {
+	id := r.Header.Get(uploadIDHeader)
+	if id == "" {
+		return
+	}
+	_, err = uuid.FromString(id)
+	if err != nil {
+		errorHandler(statusInvalidParameters, uploadIDHeader+" is to be a UUID", &err)
+		return
+	}
+	var login string
+	if token := r.URL.Query().Get(tokenQuery); token != "" {
+		login = tokenLogin(token)
+	}
+	now := time.Now()
+	u = &upload{ID: id, State: uploadReceiving, Total: r.ContentLength, Percent: -1, login: login, updated: now}
+	if u.Total > 0 {
+		u.Percent = 0
+	} else {
+		u.Total = -1
+	}
+	uploads.Lock()
+	defer uploads.Unlock()
+	for k, v := range uploads.m {
+		if (v.State == jobDone || v.State == jobFailed) && now.Sub(v.updated) > uploadTTL {
+			delete(uploads.m, k)
+		}
+	}
+	if v, ok := uploads.m[id]; ok && v.State != jobDone && v.State != jobFailed {
+		u = nil
+		errorHandler(statusConflict, "the upload "+id+" is going on", &err)
+		return
+	}
+	uploads.m[id] = u
+	r.Body = &uploadReader{ReadCloser: r.Body, upload: u}
+	return
+}
+
+// publishLocked pushes the upload to the feeds of its login, uploads is locked
+func (u *upload) publishLocked() {
+	u.published = u.Received
+	publish(u.login, event{Type: "upload", Data: *u})
+}
+
+// receive adds n bytes received
+func (u *upload) receive(n int64) {
+	uploads.Lock()
+	defer uploads.Unlock()
+	u.Received += n
+	u.updated = time.Now()
+	if u.Total > 0 {
+		u.Percent = u.Received * 100 / u.Total
+		if u.Percent > 100 {
+			u.Percent = 100
+		}
+	}
+	if progressStep(u.Received, u.published, u.Total) {
+		u.publishLocked()
+	}
+}
+
+// processing tells the body is read and the document of login is being made
+func (u *upload) processing(ctx context.Context, token string) {
+	if u == nil {
+		return
+	}
+	login := tokenLogin(token)
+	uploads.Lock()
+	defer uploads.Unlock()
+	if u.login == "" {
+		u.login = login
+	}
+	u.State, u.updated = uploadProcessing, time.Now()
+	u.publishLocked()
+}
+
+// finish ends the upload with the document it has made or the error it has failed with,
+// the one told to the client if it is a client error
+func (u *upload) finish(doc *docsdb.Doc, err error) {
+	if u == nil {
+		return
+	}
+	uploads.Lock()
+	defer uploads.Unlock()
+	u.updated = time.Now()
+	if err != nil {
+		u.State, u.Error = jobFailed, err.Error()
+		if se, ok := err.(*statusError); ok {
+			u.Error = se.Text
+		}
+	} else {
+		u.State, u.Doc = jobDone, doc.ID
+		if u.Total < 0 {
+			u.Total, u.Percent = u.Received, 100
+		}
+	}
+	u.publishLocked()
+}
+
+// uploadProgressHandler shows the progress of the upload with id on GET /docs/uploads/{id}/progress
+// to the login of the upload, to any login while it is not known yet
+func uploadProgressHandler(w http.ResponseWriter, r *http.Request, id string) (err error) {
+	switch r.Method {
+	case "GET":
+	case "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "TRACE", "CONNECT":
+		errorHandler(statusUnimplementedMethod, "", &err)
+		return
+	default:
+		errorHandler(statusInvalidMethod, "", &err)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		errorHandler(statusInvalidParameters, "", &err)
+		return
+	}
+	login, err := getLogin(r.Context(), r.Form.Get(tokenQuery))
+	if err != nil {
+		return
+	}
+	uploads.Lock()
+	u, ok := uploads.m[id]
+	var progress upload
+	if ok {
+		progress = *u
+	}
+	uploads.Unlock()
+	if !ok || progress.login != "" && progress.login != login {
+		errorHandler(statusInvalidParameters, "wrong id", &err)
+		return
+	}
+	model := &outModel{}
+	model.Data = map[string]interface{}{"upload": progress}
+	return sendJSON(w, model)
+}
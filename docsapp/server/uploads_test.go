@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rav1L/docsapp/server/modules/docsdb/inmem"
+)
+
+func TestUploadProgressIsPushedAndRead(t *testing.T) {
+	useDB(t, inmem.New())
+	token := signIn(t, "uploadlogin")
+	feed := subscribe("uploadlogin")
+	defer unsubscribe("uploadlogin", feed)
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField(metaQuery, `{"name":"progress","mime":"text/plain","created":"2019-01-01 00:00:00"}`)
+	mw.Close()
+	size := int64(body.Len())
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	r := httptest.NewRequest("POST", routes["docs"]+"?token="+token, body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set(uploadIDHeader, id)
+	w := httptest.NewRecorder()
+	makeHandler(routes["docs"], docsHandler)(w, r)
+	var states []string
+	for len(feed) > 0 {
+		e := <-feed
+		u := e.Data.(upload)
+		if e.Type != "upload" || u.ID != id {
+			t.Errorf("the feed got %+v", e)
+		}
+		states = append(states, u.State)
+	}
+	if len(states) < 3 || states[0] != uploadReceiving || states[len(states)-2] != uploadProcessing || states[len(states)-1] != jobDone {
+		t.Errorf("the feed got the states %v, want receiving, processing and done", states)
+	}
+	model := do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+uploadsRoute+"/"+id+"/"+progressRoute+"?token="+token, nil))
+	if model.Error != nil {
+		t.Fatalf("the progress is %+v after %q", model.Error, w.Body.String())
+	}
+	u := model.Data["upload"].(map[string]interface{})
+	if u["state"] != jobDone || u["received"] != float64(size) || u["percent"] != float64(100) || u["doc"] == "" {
+		t.Errorf("the progress is %v, want done with %d bytes", u, size)
+	}
+	stranger := signIn(t, "strangeruploadlogin")
+	model = do(t, routes["docsID"]+"{id}", docsIDHandler, httptest.NewRequest("GET", routes["docsID"]+uploadsRoute+"/"+id+"/"+progressRoute+"?token="+stranger, nil))
+	if model.Error == nil || model.Error.Code != statusInvalidParameters {
+		t.Errorf("a stranger gets %+v, want %d", model.Error, statusInvalidParameters)
+	}
+}
+
+func TestProgressStep(t *testing.T) {
+	for _, c := range []struct {
+		done, last, total int64
+		want              bool
+	}{
+		{5, 0, 1000, false},
+		{10, 0, 1000, true},
+		{1000, 995, 1000, true},
+		{progressBytes - 1, 0, -1, false},
+		{progressBytes, 0, -1, true},
+	} {
+		if got := progressStep(c.done, c.last, c.total); got != c.want {
+			t.Errorf("progressStep(%d, %d, %d) = %v, want %v", c.done, c.last, c.total, got, c.want)
+		}
+	}
+}
@@ -66,13 +66,15 @@ func main() {
 	var err error
 	fc, err := prepareData()
 	if err != nil {
-		log.Printf("%+v", err)
-		return
+		log.Fatalf("%+v", err)
+	}
+	err = draw(fc)
+	if err != nil {
+		log.Fatalf("%+v", err)
 	}
-	draw(fc)
 }
 
-func draw(fc *geojson.FeatureCollection) {
+func draw(fc *geojson.FeatureCollection) (err error) {
 	dc := initContext(width, height, backgroundHex)
 	var vLayer layer
 	drawLineString := func(coords [][]float64) {
@@ -150,12 +152,20 @@ func draw(fc *geojson.FeatureCollection) {
 	dc.SetLineWidth(vLayer.LineWidth)
 	dc.SetHexColor(vLayer.Color)
 	dc.StrokePreserve()
-	dc.SavePNG(path)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		errorHandler(&err, "result directory")
+		return
+	}
+	err = dc.SavePNG(path)
+	if err != nil {
+		errorHandler(&err, "saving "+path)
+	}
+	return
 }
 
 func errorHandler(err *error, msg string) {
-	log.Println(msg)
-	*err = errors.WithStack(*err)
+	*err = errors.Wrap(*err, msg)
 }
 
 func prepareData() (fc *geojson.FeatureCollection, err error) {
@@ -168,24 +178,24 @@ func prepareData() (fc *geojson.FeatureCollection, err error) {
 	var geoData []byte
 	geoData, err = ioutil.ReadAll(geoFile)
 	if err != nil {
-		errorHandler(&err, "data failed to be read from geo file")
+		errorHandler(&err, "data failed to be read from geo file "+geoName)
 		return
 	}
 	fc, err = geojson.UnmarshalFeatureCollection(geoData)
 	if err != nil {
-		errorHandler(&err, "it failed to unmarshal featureCollection")
+		errorHandler(&err, "it failed to unmarshal featureCollection of "+geoName)
 		return
 	}
 	styleFile, err := os.Open(filepath.Join(stylePath, styleName))
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style file failed to open")
 		return
 	}
 	defer styleFile.Close()
 	style = &styleModel{}
 	err = json.NewDecoder(styleFile).Decode(style)
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style "+styleName+" failed to be decoded")
 		return
 	}
 	return
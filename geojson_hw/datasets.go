@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+)
+
+const (
+	geojsonExt     = ".geojson"
+	maxDatasetSize = 32 << 20
+	datasetFile    = "file"
+	datasetName    = "name"
+)
+
+var datasetNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type datasetModel struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// validDatasetName keeps the names of the datasets inside the data directory
+func validDatasetName(name string) bool {
+	return datasetNameRe.MatchString(name)
+}
+
+func datasetsHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	var out outModel
+	code := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+		out.Data, err = listDatasets()
+	case http.MethodPost:
+		out.Data, err = uploadDataset(w, r)
+		code = http.StatusCreated
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		err = errors.Wrap(errMethod, r.Method)
+	}
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(out)
+}
+
+// listDatasets lists the geojson files of the data directory by name
+func listDatasets() (datasets []datasetModel, err error) {
+	datasets = []datasetModel{}
+	infos, err := ioutil.ReadDir(dataPath)
+	if os.IsNotExist(err) {
+		return datasets, nil
+	}
+	if err != nil {
+		errorHandler(&err, "data directory")
+		return
+	}
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), geojsonExt)
+		if info.IsDir() || filepath.Ext(info.Name()) != geojsonExt || !validDatasetName(name) {
+			continue
+		}
+		datasets = append(datasets, datasetModel{Name: name, Size: info.Size(), Modified: info.ModTime()})
+	}
+	sort.Slice(datasets, func(i, j int) bool { return datasets[i].Name < datasets[j].Name })
+	return
+}
+
+// uploadDataset stores the file of the multipart form as data/<name>.geojson,
+// the name is the one of the form or of the file and an existing dataset is not replaced
+func uploadDataset(w http.ResponseWriter, r *http.Request) (dataset *datasetModel, err error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDatasetSize)
+	file, header, err := r.FormFile(datasetFile)
+	if err != nil {
+		return nil, errors.Wrapf(errBadRequest, "%s: %v", datasetFile, err)
+	}
+	defer file.Close()
+	name := r.FormValue(datasetName)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(header.Filename), geojsonExt)
+	}
+	if !validDatasetName(name) {
+		return nil, errors.Wrapf(errBadRequest, "%s %q is not a valid name", datasetName, name)
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrapf(errBadRequest, "%s: %v", datasetFile, err)
+	}
+	_, err = geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		return nil, errors.Wrapf(errBadRequest, "%s is not a feature collection: %v", name, err)
+	}
+
+	err = os.MkdirAll(dataPath, 0755)
+	if err != nil {
+		errorHandler(&err, "data directory")
+		return
+	}
+	path := filepath.Join(dataPath, name+geojsonExt)
+	tmp, err := ioutil.TempFile(dataPath, name+"*.tmp")
+	if err != nil {
+		errorHandler(&err, "dataset "+name)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		errorHandler(&err, "dataset "+name)
+		return
+	}
+	// Link fails if the dataset exists, so two uploads of one name can't replace each other
+	err = os.Link(tmp.Name(), path)
+	if os.IsExist(err) {
+		return nil, errors.Wrapf(errConflict, "dataset %s already exists", name)
+	}
+	if err != nil {
+		errorHandler(&err, "dataset "+name)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		errorHandler(&err, "dataset "+name)
+		return
+	}
+	return &datasetModel{Name: name, Size: info.Size(), Modified: info.ModTime()}, nil
+}
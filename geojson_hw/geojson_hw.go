@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,11 +19,8 @@ import (
 )
 
 var (
-	resultName string
-	style      *styleModel
-	font       *truetype.Font
-	scales     = make(map[int]point, 10)
-	translates = make(map[int]point, 10)
+	style *styleModel
+	font  *truetype.Font
 )
 
 const (
@@ -39,15 +37,21 @@ const (
 	stylePath     = "./style"
 	resultPath    = "./result"
 	styleName     = "style.json"
-	fileServer    = "http://localhost:8100/"
-	minIndex      = 0
-	maxIndex      = 3
-	pointRadius   = 5.0
+	// mapOrigin is the origin of the file server the map page is served by, the only one calling
+	// the handlers with the session cookie
+	mapOrigin   = "http://localhost:8100"
+	fileServer  = mapOrigin + "/"
+	minIndex    = 0
+	maxIndex    = 3
+	pointRadius = 5.0
+	// zoomScale is the zoom of every order over the previous one
+	zoomScale = 2.5
 
 	clientxQuery = "clientx"
 	clientyQuery = "clienty"
 	orderQuery   = "order"
 	zoominQuery  = "zoomin"
+	datasetQuery = "dataset"
 )
 
 type layer struct {
@@ -74,110 +78,209 @@ type point struct {
 	Y float64
 }
 
+type errorModel struct {
+	Code int    `json:"code"`
+	Text string `json:"text"`
+}
+
+type outModel struct {
+	Error *errorModel `json:"error"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// the causes of the errors answered with their own status, the others are the errors of the server
+var (
+	errBadRequest = errors.New("bad request")
+	errNotFound   = errors.New("not found")
+	errConflict   = errors.New("conflict")
+	errMethod     = errors.New("method not allowed")
+)
+
+var errorCodes = map[error]int{
+	errBadRequest: http.StatusBadRequest,
+	errNotFound:   http.StatusNotFound,
+	errConflict:   http.StatusConflict,
+	errMethod:     http.StatusMethodNotAllowed,
+}
+
 func init() {
 	err := initStyle()
 	if err != nil {
-		log.Printf("%+v", err)
-		return
+		log.Fatalf("%+v", err)
 	}
 	font, err = truetype.Parse(goregular.TTF)
 	if err != nil {
-		return
+		log.Fatalf("%+v", errors.Wrap(err, "default font"))
 	}
 }
 
 func main() {
 	http.HandleFunc("/zoom", makeHandler(zoomHandler))
 	http.HandleFunc("/drag", makeHandler(dragHandler))
+	http.HandleFunc("/datasets", makeHandler(datasetsHandler))
+	http.HandleFunc("/reset", makeHandler(resetHandler))
+	go sweepSessions(sessionSweep)
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
+// makeHandler lets the map page of the file server call the handlers with the session cookie:
+// mapOrigin is allowed with its credentials, the other origins get no CORS headers so their pages
+// can't read the answers, the requests without an origin are of any origin
 func makeHandler(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Add("Vary", "Origin")
+			if origin == mapOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
 		err := handler(w, r)
 		if err != nil {
-			log.Printf("%+v", err)
+			if _, ok := errorCodes[errors.Cause(err)]; ok {
+				log.Printf("invalid request: method=%s path=%s query=%q remote=%s error=%q", r.Method, r.URL.Path, r.URL.RawQuery, r.RemoteAddr, err.Error())
+			} else {
+				log.Printf("%+v", err)
+			}
+			writeError(w, err)
 		}
 	}
 }
 
+// writeError answers the errors caused by the request with their codes and 500 with all the other,
+// the details of the latter stay in the log
+func writeError(w http.ResponseWriter, err error) {
+	e := &errorModel{Code: http.StatusInternalServerError, Text: "the request failed to be served"}
+	if code, ok := errorCodes[errors.Cause(err)]; ok {
+		e = &errorModel{Code: code, Text: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	json.NewEncoder(w).Encode(outModel{Error: e})
+}
+
+// formNumber reads the required number parameter name, NaN and the infinities are not numbers
+func formNumber(r *http.Request, name string) (v float64, err error) {
+	s := r.Form.Get(name)
+	if s == "" {
+		return 0, errors.Wrap(errBadRequest, name+" is missing")
+	}
+	v, err = strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, errors.Wrapf(errBadRequest, "%s %q is not a number", name, s)
+	}
+	return
+}
+
+// parseParams reads the order, the click point and the optional dataset of the request.
+// The point is in the units of the canvas, from 0 to xn and yn for a zoom, a drag moves by -xn..xn and -yn..yn
+func parseParams(r *http.Request, drag bool) (index int, p point, dataset string, err error) {
+	err = r.ParseForm()
+	if err != nil {
+		return 0, p, "", errors.Wrap(errBadRequest, err.Error())
+	}
+	if r.Form.Get(orderQuery) == "" {
+		return 0, p, "", errors.Wrap(errBadRequest, orderQuery+" is missing")
+	}
+	order, err := strconv.Atoi(r.Form.Get(orderQuery))
+	if err != nil {
+		return 0, p, "", errors.Wrapf(errBadRequest, "%s %q is not a number", orderQuery, r.Form.Get(orderQuery))
+	}
+	index = order - 1
+	last := maxIndex
+	if len(style.Layer) <= last {
+		last = len(style.Layer) - 1
+	}
+	if index < minIndex || index > last {
+		return 0, p, "", errors.Wrapf(errBadRequest, "%s %d is out of range %d..%d", orderQuery, order, minIndex+1, last+1)
+	}
+	p.X, err = formNumber(r, clientxQuery)
+	if err != nil {
+		return 0, p, "", err
+	}
+	p.Y, err = formNumber(r, clientyQuery)
+	if err != nil {
+		return 0, p, "", err
+	}
+	lowX, lowY := 0.0, 0.0
+	if drag {
+		lowX, lowY = -xn, -yn
+	}
+	if p.X < lowX || p.X > xn || p.Y < lowY || p.Y > yn {
+		return 0, p, "", errors.Wrapf(errBadRequest, "the point %g, %g is out of %g..%d, %g..%d", p.X, p.Y, lowX, xn, lowY, yn)
+	}
+	dataset = r.Form.Get(datasetQuery)
+	if dataset != "" && !validDatasetName(dataset) {
+		return 0, p, "", errors.Wrapf(errBadRequest, "%s %q is not a valid name", datasetQuery, dataset)
+	}
+	return
+}
+
 func zoomHandler(w http.ResponseWriter, r *http.Request) (err error) {
-	var answer string
-	err = func() (err error) {
-		err = r.ParseForm()
-		if err != nil {
-			return
-		}
-		order, err := strconv.Atoi(r.Form.Get(orderQuery))
-		if err != nil {
-			return
-		}
-		clientX, err := strconv.ParseFloat(r.Form.Get(clientxQuery), 64)
-		if err != nil {
-			return
-		}
-		clientY, err := strconv.ParseFloat(r.Form.Get(clientyQuery), 64)
-		if err != nil {
-			return
-		}
-		index := order - 1
-		if index > 0 {
-			p := point{clientX, clientY}
-			translates[index] = point{0, 0}
-			scales[index] = p
-		}
-		answer = fmt.Sprintf("%s%s.png", fileServer, getLevelID(index))
-		err = draw(index)
+	index, p, dataset, err := parseParams(r, false)
+	if err != nil {
 		return
-	}()
+	}
+	s, err := sessionOf(w, r)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
-	w.Write([]byte(answer))
+	if index > 0 {
+		s.mu.Lock()
+		_, zoomed := s.scales[index-1]
+		if index > 1 && !zoomed {
+			s.mu.Unlock()
+			return errors.Wrapf(errConflict, "%s %d is zoomed to from %d", orderQuery, index+1, index)
+		}
+		s.translates[index] = point{0, 0}
+		s.scales[index] = p
+		s.mu.Unlock()
+	}
+	err = draw(index, dataset, s)
+	if err != nil {
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("%s%s.png", fileServer, resultID(index, dataset, s))))
 	return
 }
 
 func dragHandler(w http.ResponseWriter, r *http.Request) (err error) {
-	var answer string
-	err = func() (err error) {
-		err = r.ParseForm()
-		if err != nil {
-			return
-		}
-		order, err := strconv.Atoi(r.Form.Get(orderQuery))
-		if err != nil {
-			return
-		}
-		clientX, err := strconv.ParseFloat(r.Form.Get(clientxQuery), 64)
-		if err != nil {
-			return
-		}
-		clientY, err := strconv.ParseFloat(r.Form.Get(clientyQuery), 64)
-		if err != nil {
-			return
-		}
-		index := order - 1
-		if index > 0 {
-			p := point{clientX, clientY}
-			val := translates[index]
-			p.X += val.X
-			p.Y += val.Y
-			translates[index] = p
-		}
-		answer = "OK"
-		err = draw(index)
+	index, p, dataset, err := parseParams(r, true)
+	if err != nil {
 		return
-	}()
+	}
+	s, err := sessionOf(w, r)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
 	}
-	w.Write([]byte(answer))
+	if index > 0 {
+		s.mu.Lock()
+		if _, zoomed := s.scales[index]; !zoomed {
+			s.mu.Unlock()
+			return errors.Wrapf(errConflict, "%s %d is not zoomed to", orderQuery, index+1)
+		}
+		val := s.translates[index]
+		s.translates[index] = clampTranslate(point{p.X + val.X, p.Y + val.Y}, index)
+		s.mu.Unlock()
+	}
+	err = draw(index, dataset, s)
+	if err != nil {
+		return
+	}
+	w.Write([]byte("OK"))
 	return
 }
 
+// clampTranslate keeps the offset of the order index+1 such that the map is not dragged out of the canvas
+func clampTranslate(t point, index int) point {
+	limit := zoomScale * float64(index)
+	t.X = math.Max(-xn*limit, math.Min(xn*limit, t.X))
+	t.Y = math.Max(-yn*limit, math.Min(yn*limit, t.Y))
+	return t
+}
+
 func min(x, y float64) float64 {
 	if x < 0 || y < 0 {
 		return max(x, y)
@@ -194,16 +297,17 @@ func max(x, y float64) float64 {
 	return y
 }
 
-func draw(index int) (err error) {
-	fc, err := dataToFeatureCollection(index)
+// draw renders the dataset with the style of the layer index in the view of the session,
+// the data of the layer itself without a dataset
+func draw(index int, dataset string, s *session) (err error) {
+	fc, err := dataToFeatureCollection(index, dataset)
 	if err != nil {
-		errorHandler(&err, "something went wrong at draw 1")
 		return
 	}
-
-	resultName = filepath.Join(resultPath, style.Layer[index].ID+".png")
+	scales, translates := s.view()
+	resultName := filepath.Join(resultPath, resultID(index, dataset, s)+".png")
 	face := truetype.NewFace(font, &truetype.Options{Size: style.Layer[index].FontSize})
-	scale := 2.5
+	scale := zoomScale
 	mapLayer := style.Layer[index]
 	var minX, minY, maxX, maxY float64
 	resetMinMax := func() {
@@ -269,8 +373,16 @@ func draw(index int) (err error) {
 		dc.DrawStringWrapped(name, xOffset, yOffset, 0.5, 0.5, maxX-minX, 1, gg.AlignCenter)
 		dc.Pop()
 	}
-	for _, f := range fc.Features {
+	for i, f := range fc.Features {
 		g := f.Geometry
+		if g == nil {
+			continue
+		}
+		err = checkCoordinates(g)
+		if err != nil {
+			errorHandler(&err, fmt.Sprintf("%s feature %d", mapLayer.ID, i))
+			return
+		}
 		nameProp, hasName := f.Properties["name"]
 		if g.IsMultiPolygon() {
 			coords := g.MultiPolygon
@@ -319,36 +431,84 @@ func draw(index int) (err error) {
 			continue
 		}
 	}
-	dc.SavePNG(resultName)
+	err = os.MkdirAll(resultPath, 0755)
+	if err != nil {
+		errorHandler(&err, "result directory")
+		return
+	}
+	err = dc.SavePNG(resultName)
+	if err != nil {
+		errorHandler(&err, "saving "+resultName)
+	}
 	return
 }
 
+// checkCoordinates makes sure every position of g has x and y, draw indexes them unchecked
+func checkCoordinates(g *geojson.Geometry) error {
+	var positions [][]float64
+	switch {
+	case g.IsPoint():
+		positions = [][]float64{g.Point}
+	case g.IsMultiPoint():
+		positions = g.MultiPoint
+	case g.IsLineString():
+		positions = g.LineString
+	case g.IsMultiLineString():
+		for _, l := range g.MultiLineString {
+			positions = append(positions, l...)
+		}
+	case g.IsPolygon():
+		for _, ring := range g.Polygon {
+			positions = append(positions, ring...)
+		}
+	case g.IsMultiPolygon():
+		for _, polygon := range g.MultiPolygon {
+			for _, ring := range polygon {
+				positions = append(positions, ring...)
+			}
+		}
+	}
+	for i, p := range positions {
+		if len(p) < 2 {
+			return errors.Errorf("coordinate %d has %d values, 2 are expected", i, len(p))
+		}
+	}
+	return nil
+}
+
+// errorHandler adds msg to the error, it is logged once with the whole context by makeHandler
 func errorHandler(err *error, msg string) {
-	log.Println(msg)
-	*err = errors.WithStack(*err)
+	*err = errors.Wrap(*err, msg)
 }
 
 func initStyle() (err error) {
 	styleFile, err := os.Open(filepath.Join(stylePath, styleName))
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style file failed to open")
 		return
 	}
 	defer styleFile.Close()
 	style = &styleModel{}
 	err = json.NewDecoder(styleFile).Decode(style)
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style "+styleName+" failed to be decoded")
 		return
 	}
 	return
 }
 
-func dataToFeatureCollection(index int) (fc *geojson.FeatureCollection, err error) {
+func dataToFeatureCollection(index int, dataset string) (fc *geojson.FeatureCollection, err error) {
 	if index < minIndex || index > maxIndex {
 		index = minIndex
 	}
-	geoFile, err := os.Open(filepath.Join(dataPath, style.Layer[index].ID+".geojson"))
+	name := style.Layer[index].ID + geojsonExt
+	if dataset != "" {
+		name = dataset + geojsonExt
+	}
+	geoFile, err := os.Open(filepath.Join(dataPath, name))
+	if os.IsNotExist(err) && dataset != "" {
+		return nil, errors.Wrapf(errNotFound, "dataset %s", dataset)
+	}
 	if err != nil {
 		errorHandler(&err, "geo file failed to open")
 		return
@@ -357,12 +517,12 @@ func dataToFeatureCollection(index int) (fc *geojson.FeatureCollection, err erro
 	var geoData []byte
 	geoData, err = ioutil.ReadAll(geoFile)
 	if err != nil {
-		errorHandler(&err, "data failed to be read from geo file")
+		errorHandler(&err, "data failed to be read from geo file "+name)
 		return
 	}
 	fc, err = geojson.UnmarshalFeatureCollection(geoData)
 	if err != nil {
-		errorHandler(&err, "it failed to unmarshal featureCollection ")
+		errorHandler(&err, "it failed to unmarshal featureCollection of "+name)
 	}
 	return
 }
@@ -382,6 +542,14 @@ func applyStyle(dc *gg.Context, mapLayer *layer) {
 	dc.SetLineWidth(mapLayer.LineWidth)
 }
 
+// resultID names the png of the dataset drawn with the layer index for the session
+func resultID(index int, dataset string, s *session) string {
+	if dataset != "" {
+		return dataset + "_" + getLevelID(index) + "_" + s.id
+	}
+	return getLevelID(index) + "_" + s.id
+}
+
 func getLevelID(index int) string {
 	if index >= minIndex && index <= maxIndex {
 		return style.Layer[index].ID
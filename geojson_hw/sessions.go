@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sessionCookie = "session"
+	// sessionTTL is how long a view is kept after the last request of its session
+	sessionTTL   = 30 * time.Minute
+	sessionSweep = time.Minute
+)
+
+// session is the view of one user: the zoom point and the offset of every layer order,
+// the pictures of the session are named by its id so the users don't draw over each other
+type session struct {
+	id         string
+	mu         sync.Mutex
+	scales     map[int]point
+	translates map[int]point
+	expires    time.Time
+}
+
+var sessions = struct {
+	sync.Mutex
+	m map[string]*session
+}{m: make(map[string]*session)}
+
+func newSession() (s *session, err error) {
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &session{id: hex.EncodeToString(b), scales: make(map[int]point), translates: make(map[int]point)}, nil
+}
+
+// sessionOf finds the session of the cookie of r, a new one is made and set as the cookie
+// if there is none or it has expired. Every request prolongs the session by sessionTTL
+func sessionOf(w http.ResponseWriter, r *http.Request) (s *session, err error) {
+	now := time.Now()
+	sessions.Lock()
+	defer sessions.Unlock()
+	if c, cerr := r.Cookie(sessionCookie); cerr == nil {
+		s = sessions.m[c.Value]
+	}
+	if s == nil || now.After(s.expires) {
+		s, err = newSession()
+		if err != nil {
+			return
+		}
+		sessions.m[s.id] = s
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: s.id, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	}
+	s.expires = now.Add(sessionTTL)
+	return
+}
+
+// view copies the zoom points and the offsets of s, draw reads them while other requests change s
+func (s *session) view() (scales, translates map[int]point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scales = make(map[int]point, len(s.scales))
+	translates = make(map[int]point, len(s.translates))
+	for k, v := range s.scales {
+		scales[k] = v
+	}
+	for k, v := range s.translates {
+		translates[k] = v
+	}
+	return
+}
+
+// removePictures removes the pictures drawn for s
+func (s *session) removePictures() {
+	names, _ := filepath.Glob(filepath.Join(resultPath, "*_"+s.id+".png"))
+	for _, name := range names {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("%+v", errors.WithStack(err))
+		}
+	}
+}
+
+// sweepSessions drops the expired sessions with their pictures every period
+func sweepSessions(period time.Duration) {
+	for now := range time.Tick(period) {
+		var expired []*session
+		sessions.Lock()
+		for id, s := range sessions.m {
+			if now.After(s.expires) {
+				delete(sessions.m, id)
+				expired = append(expired, s)
+			}
+		}
+		sessions.Unlock()
+		for _, s := range expired {
+			s.removePictures()
+		}
+	}
+}
+
+// resetHandler clears the view of the session on POST /reset, the map is drawn from the start again
+func resetHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		return errors.Wrap(errMethod, r.Method)
+	}
+	s, err := sessionOf(w, r)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.scales = make(map[int]point)
+	s.translates = make(map[int]point)
+	s.mu.Unlock()
+	s.removePictures()
+	w.Write([]byte("OK"))
+	return
+}
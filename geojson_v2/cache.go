@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/geojson_v2/modules/proj"
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+// cacheExt is the extension of the binary cache of a geojson file, it lies next to the file
+const cacheExt = ".gds"
+
+func cachePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + cacheExt
+}
+
+// newer tells whether the file at path exists and was modified after the one at than
+func newer(path, than string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	thanInfo, err := os.Stat(than)
+	return err == nil && info.ModTime().After(thanInfo.ModTime())
+}
+
+// readCache maps the cache file to the memory, the dataset reads its coordinates from the mapping,
+// which stays until the process exits. quantum and crs are the -quantize and the -crs it was made with
+func readCache(path string) (d *render.Dataset, quantum float64, crs string, err error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, 0, "", errors.WithStack(err)
+	}
+	return render.ReadBinary(data)
+}
+
+// cacheCommand prepares -geo once and writes it to <geo>.gds, which render and tilegen read instead
+// of the geojson while it is newer than the file. The data is reprojected and quantized on the way,
+// the cache keeps -crs and -quantize and is not read with other ones
+func cacheCommand() (err error) {
+	projection, err = proj.Parse(crs)
+	if err != nil {
+		errorHandler(&err, "crs")
+		return
+	}
+	quantum, err = quantizeStep(1 / math.Max(scaleX, scaleY))
+	if err != nil {
+		return
+	}
+	fc, err := dataToFeatureCollection()
+	if err != nil {
+		return
+	}
+	d, err := render.Prepare(fc, xn, yn)
+	if err != nil {
+		errorHandler(&err, geoName)
+		return
+	}
+	path := cachePath(filepath.Join(dataPath, geoName))
+	f, err := os.Create(path)
+	if err != nil {
+		errorHandler(&err, "cache file")
+		return
+	}
+	err = d.WriteBinary(f, quantum, crs)
+	if err != nil {
+		f.Close()
+		errorHandler(&err, "writing "+path)
+		return
+	}
+	err = f.Close()
+	if err != nil {
+		errorHandler(&err, "writing "+path)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: written to %s, %s\n", geoName, path, byteSize(info.Size()))
+	return
+}
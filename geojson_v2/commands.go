@@ -0,0 +1,536 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/geojson_v2/modules/proj"
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+// command is a subcommand of geojson_v2, flags registers the flags it reads on its own flag set.
+// A command with arg takes one positional argument, argName is the one of the usage
+type command struct {
+	summary string
+	flags   func(fs *flag.FlagSet)
+	arg     *string
+	argName string
+	run     func() error
+}
+
+var commandCase = map[string]command{
+	"render": {
+		summary: "draws the -layers of the style or its third layer with the data of -geo into the picture -res",
+		flags:   func(fs *flag.FlagSet) { dataFlags(fs); styleFlags(fs); layersFlag(fs); drawFlags(fs); viewFlags(fs) },
+		run:     renderCommand,
+	},
+	"tilegen": {
+		summary: "renders the tiles of the zoom levels -minzoom..-maxzoom into a z/x/y.png directory or an .mbtiles file",
+		flags:   func(fs *flag.FlagSet) { dataFlags(fs); styleFlags(fs); layersFlag(fs); drawFlags(fs); tilesFlags(fs) },
+		run:     tilegen,
+	},
+	"serve": {
+		summary: "serves the tiles of the .mbtiles file -out as /tiles/z/x/y.png and its metadata as /metadata",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&tilesOut, "out", "./tiles.mbtiles", ".mbtiles file the tiles are served from")
+			fs.StringVar(&addr, "addr", ":8100", "address the tiles are served on")
+		},
+		run: serve,
+	},
+	"diff": {
+		summary: "draws the features of -compare added to, removed from and changed against -geo",
+		flags: func(fs *flag.FlagSet) {
+			dataFlags(fs)
+			styleFlags(fs)
+			drawFlags(fs)
+			viewFlags(fs)
+			fs.StringVar(&compareName, "compare", "", "geojson file of the data directory compared with -geo")
+			fs.StringVar(&diffKey, "key", "name", "property the features are matched by")
+		},
+		run: diff,
+	},
+	"inspect": {
+		summary: "prints the features by geometry, the properties with their types and samples, the bounds and the sizes of a geojson file, -geo of the data directory without it",
+		flags: func(fs *flag.FlagSet) {
+			dataFlags(fs)
+			fs.IntVar(&samples, "samples", 3, "number of the distinct values printed of every property")
+		},
+		arg:     &inspectPath,
+		argName: "[file.geojson]",
+		run:     inspect,
+	},
+	"validate-style": {
+		summary: "checks the layers of -style with each of its themes, it fails if there is a problem",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&styleName, "style", "style.json", "style file of the style directory")
+		},
+		run: validateStyle,
+	},
+	"simplify": {
+		summary: "drops the points of the lines and the polygons of -geo closer than -tolerance to the shape and writes it in WGS84 to -out",
+		flags: func(fs *flag.FlagSet) {
+			dataFlags(fs)
+			fs.Float64Var(&tolerance, "tolerance", 0.01, "distance in degrees a point is dropped within")
+			fs.StringVar(&reducedOut, "out", "", "geojson file of the data directory the result is written to, - is stdout, <geo>.simplified.geojson if it is not set")
+		},
+		run: simplify,
+	},
+	"cache": {
+		summary: "prepares -geo once into the binary <geo>" + cacheExt + " next to it, render and tilegen map it instead of reading the geojson while it is newer",
+		flags: func(fs *flag.FlagSet) {
+			dataFlags(fs)
+			fs.StringVar(&quantizeGrid, "quantize", "", "step in degrees the coordinates are rounded to, render and tilegen use the cache with the same -quantize only; auto is half a pixel of the picture of -s 1")
+		},
+		run: cacheCommand,
+	},
+	"quantize": {
+		summary: "rounds the coordinates of -geo to the multiples of -step, drops the points falling on the point before them and writes it in WGS84 to -out",
+		flags: func(fs *flag.FlagSet) {
+			dataFlags(fs)
+			fs.Float64Var(&quantizeStepFlag, "step", 0.001, "grid in degrees the coordinates are rounded to")
+			fs.StringVar(&reducedOut, "out", "", "geojson file of the data directory the result is written to, - is stdout, <geo>.quantized.geojson if it is not set")
+		},
+		run: quantizeCommand,
+	},
+}
+
+var (
+	tolerance        float64
+	reducedOut       string
+	inspectPath      string
+	samples          int
+	quantizeGrid     string
+	quantizeStepFlag float64
+)
+
+// runCommand parses the flags of the command args[0] and runs it, flag.ErrHelp is returned for -h and --help
+func runCommand(args []string) (err error) {
+	names := make([]string, 0, len(commandCase))
+	for name := range commandCase {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprintf(os.Stderr, "usage: geojson_v2 <command> [flags]\n\ncommands:\n")
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commandCase[name].summary)
+		}
+		fmt.Fprintf(os.Stderr, "\ngeojson_v2 <command> --help prints the flags of the command\n")
+		if len(args) == 0 {
+			return errors.New("no command")
+		}
+		return flag.ErrHelp
+	}
+	c, ok := commandCase[args[0]]
+	if !ok {
+		return errors.Errorf("unknown command %q, possible variants: %s", args[0], strings.Join(names, ", "))
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: geojson_v2 %s [flags] %s\n\n%s\n\nflags:\n", args[0], c.argName, c.summary)
+		fs.PrintDefaults()
+	}
+	c.flags(fs)
+	rest := args[1:]
+	if c.arg != nil && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		*c.arg, rest = rest[0], rest[1:]
+	}
+	err = fs.Parse(rest)
+	if err != nil {
+		return
+	}
+	switch {
+	case c.arg != nil && fs.NArg() == 1 && *c.arg == "":
+		*c.arg = fs.Arg(0)
+	case c.arg != nil && fs.NArg() > 0:
+		return errors.Errorf("%s takes one argument %s, got %q", args[0], c.argName, fs.Args())
+	case fs.NArg() > 0:
+		return errors.Errorf("%s takes no arguments, got %q", args[0], fs.Args())
+	}
+	return c.run()
+}
+
+// dataFlags are the geojson file a command reads and its crs
+func dataFlags(fs *flag.FlagSet) {
+	fs.StringVar(&geoName, "geo", "admin_level_4.geojson", "geojson file of the data directory")
+	fs.StringVar(&crs, "crs", "", "EPSG code of the data, e.g. EPSG:32633 or EPSG:3857, it is reprojected to WGS84 on load; the crs of the style or of the file without it")
+}
+
+// styleFlags are the style the layers are drawn with and the fonts of their labels
+func styleFlags(fs *flag.FlagSet) {
+	fs.StringVar(&styleName, "style", "style.json", "style file of the style directory")
+	fs.StringVar(&theme, "theme", "", "theme of the style file the layers are drawn with, e.g. light or dark, none is the style itself")
+	fs.StringVar(&fontDir, "font-dir", "./fonts", "directory of .ttf and .otf files the font-family of the style layers is looked for in")
+}
+
+func layersFlag(fs *flag.FlagSet) {
+	fs.StringVar(&layerIDs, "layers", "", "comma separated ids of the style layers to compose, the data of each is read from <id>.geojson")
+}
+
+// drawFlags are the overlays and the mask drawn with the layers, the precision of the data and the number of the drawing workers
+func drawFlags(fs *flag.FlagSet) {
+	fs.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of layers or tiles drawn at the same time")
+	fs.Float64Var(&graticule, "graticule", 0, "step in degrees of the meridians and parallels drawn over the map, 0 is none")
+	fs.BoolVar(&bbox, "bbox", false, "draw the bounding box of the data over the map")
+	fs.StringVar(&clipName, "clip", "", "geojson file of the data directory whose polygons all the layers are clipped to, e.g. a country outline")
+	fs.StringVar(&quantizeGrid, "quantize", "", "step in degrees the coordinates are rounded to on load, the points falling on the point before them dropped; auto is half a pixel of the picture or of the tiles of -maxzoom at the equator")
+}
+
+// viewFlags are the picture a command draws and the zoom and the offset it is drawn with
+func viewFlags(fs *flag.FlagSet) {
+	fs.StringVar(&resultName, "res", "admin_level_4.png", "result file")
+	fs.Float64Var(&zoomX, "zx", 0, "zoom x")
+	fs.Float64Var(&zoomY, "zy", 0, "zoom y")
+	fs.Float64Var(&deltaX, "dx", 0, "offset x")
+	fs.Float64Var(&deltaY, "dy", 0, "offset y")
+	fs.Float64Var(&scale, "s", 1, "scale coefficient")
+}
+
+func tilesFlags(fs *flag.FlagSet) {
+	fs.IntVar(&minZoom, "minzoom", 0, "the first zoom level")
+	fs.IntVar(&maxZoom, "maxzoom", 5, "the last zoom level")
+	fs.StringVar(&tilesOut, "out", "./tiles", "directory the tiles are written to as z/x/y.png or .mbtiles file they are written to")
+	fs.StringVar(&attribution, "attribution", "", "attribution of the data written to the .mbtiles metadata")
+	fs.BoolVar(&force, "force", false, "render the tiles which already exist instead of resuming")
+}
+
+// inspect prints what a geojson file holds, so a style can be made for it without opening the file:
+// the features by geometry, the properties with their types and samples, the bounds in WGS84
+// after the reprojection and the sizes of the file and of its coordinates
+func inspect() (err error) {
+	projection, err = proj.Parse(crs)
+	if err != nil {
+		errorHandler(&err, "crs")
+		return
+	}
+	path, name := filepath.Join(dataPath, geoName), geoName
+	if inspectPath != "" {
+		path, name = inspectPath, inspectPath
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		errorHandler(&err, name)
+		return
+	}
+	fc, err := readGeoFile(path, name)
+	if err != nil {
+		return
+	}
+	fileCRS := proj.CRSOf(fc)
+	if fileCRS == "" {
+		fileCRS = "none"
+	}
+	d, err := render.Prepare(fc, xn, yn)
+	if err != nil {
+		errorHandler(&err, name)
+		return
+	}
+	geometries := make(map[string]int)
+	properties := make(map[string]*propertyStats)
+	var points, most int
+	var mostName string
+	for i, f := range fc.Features {
+		n := 0
+		if f.Geometry == nil {
+			geometries["none"]++
+		} else {
+			geometries[string(f.Geometry.Type)]++
+			n = geometryPoints(f.Geometry)
+		}
+		points += n
+		if n > most {
+			most, mostName = n, featureLabel(f, i)
+		}
+		for k, v := range f.Properties {
+			p, ok := properties[k]
+			if !ok {
+				p = &propertyStats{types: make(map[string]int), min: math.Inf(1), max: math.Inf(-1)}
+				properties[k] = p
+			}
+			p.add(v)
+		}
+	}
+	fmt.Printf("file: %s, %s\ncrs of the file: %s\nfeatures: %d\n", name, byteSize(info.Size()), fileCRS, len(fc.Features))
+	for _, k := range sortedKeys(geometries) {
+		fmt.Printf("  %s: %d\n", k, geometries[k])
+	}
+	fmt.Printf("points: %d, %s of coordinates drawn\n", points, byteSize(int64(points)*coordSize))
+	if points > 0 {
+		fmt.Printf("  %.1f a feature, the most %d in %s\n", float64(points)/float64(len(fc.Features)), most, mostName)
+		b := d.Bounds()
+		fmt.Printf("bounds: %g, %g .. %g, %g\n", b.MinX, b.MinY, b.MaxX, b.MaxY)
+	}
+	fmt.Printf("properties (features having them: types, samples):\n")
+	keys := make(map[string]int, len(properties))
+	for k, p := range properties {
+		keys[k] = p.count
+	}
+	for _, k := range sortedKeys(keys) {
+		fmt.Printf("  %s: %s\n", k, properties[k])
+	}
+	return
+}
+
+// coordSize is the size of a point of the prepared data, two float64
+const coordSize = 16
+
+// propertyStats are the values of a property over the features: the count of every JSON type,
+// the range of the numbers and the first distinct values up to -samples
+type propertyStats struct {
+	count   int
+	types   map[string]int
+	min     float64
+	max     float64
+	samples []string
+}
+
+func (p *propertyStats) add(v interface{}) {
+	p.count++
+	t := "object"
+	switch x := v.(type) {
+	case nil:
+		t = "null"
+	case string:
+		t = "string"
+	case bool:
+		t = "boolean"
+	case float64:
+		t = "number"
+		p.min = math.Min(p.min, x)
+		p.max = math.Max(p.max, x)
+	case []interface{}:
+		t = "array"
+	}
+	p.types[t]++
+	if len(p.samples) >= samples {
+		return
+	}
+	b, _ := json.Marshal(v)
+	s := []rune(string(b))
+	if len(s) > sampleLength {
+		s = append(s[:sampleLength], '…')
+	}
+	for _, seen := range p.samples {
+		if seen == string(s) {
+			return
+		}
+	}
+	p.samples = append(p.samples, string(s))
+}
+
+// sampleLength is the length a sample is cut to
+const sampleLength = 40
+
+func (p *propertyStats) String() string {
+	var types []string
+	for _, t := range sortedKeys(p.types) {
+		kind := fmt.Sprintf("%s %d", t, p.types[t])
+		if t == "number" {
+			kind += fmt.Sprintf(" (%g .. %g)", p.min, p.max)
+		}
+		types = append(types, kind)
+	}
+	s := fmt.Sprintf("%d: %s", p.count, strings.Join(types, ", "))
+	if len(p.samples) > 0 {
+		s += "; " + strings.Join(p.samples, ", ")
+	}
+	return s
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// featureLabel is the id, the name or the number of the feature
+func featureLabel(f *geojson.Feature, i int) string {
+	if f.ID != nil {
+		return fmt.Sprint(f.ID)
+	}
+	if name, ok := f.Properties["name"]; ok {
+		return fmt.Sprint(name)
+	}
+	return fmt.Sprintf("feature %d", i)
+}
+
+// byteSize prints n in B, KB, MB or GB
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB"} {
+		if v < unit {
+			break
+		}
+		v, suffix = v/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", v, suffix)
+}
+
+func geometryPoints(g *geojson.Geometry) (n int) {
+	switch {
+	case g.IsPoint():
+		n = 1
+	case g.IsMultiPoint():
+		n = len(g.MultiPoint)
+	case g.IsLineString():
+		n = len(g.LineString)
+	case g.IsMultiLineString():
+		for _, line := range g.MultiLineString {
+			n += len(line)
+		}
+	case g.IsPolygon():
+		for _, ring := range g.Polygon {
+			n += len(ring)
+		}
+	case g.IsMultiPolygon():
+		for _, polygon := range g.MultiPolygon {
+			for _, ring := range polygon {
+				n += len(ring)
+			}
+		}
+	case g.IsCollection():
+		for _, c := range g.Geometries {
+			n += geometryPoints(c)
+		}
+	}
+	return
+}
+
+// validateStyle loads -style by itself and with each of its themes and prints the problems of every one
+func validateStyle() (err error) {
+	data, err := ioutil.ReadFile(filepath.Join(stylePath, styleName))
+	if err != nil {
+		errorHandler(&err, "style file failed to be read")
+		return
+	}
+	themes, err := render.Themes(strings.NewReader(string(data)))
+	if err != nil {
+		errorHandler(&err, "style "+styleName+" failed to be decoded")
+		return
+	}
+	var count int
+	for _, t := range append([]string{""}, themes...) {
+		name := styleName
+		if t != "" {
+			name += " theme " + t
+		}
+		var s *render.Style
+		s, err = render.LoadStyle(strings.NewReader(string(data)), t)
+		if err != nil {
+			errorHandler(&err, name+" failed to be decoded")
+			return
+		}
+		problems := s.Validate()
+		if s.CRS != "" {
+			if _, e := proj.Parse(s.CRS); e != nil {
+				problems = append(problems, errors.Wrap(e, "crs"))
+			}
+		}
+		for _, p := range problems {
+			fmt.Printf("%s: %v\n", name, p)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		return errors.Errorf("style %s has %d problems", styleName, count)
+	}
+	fmt.Printf("%s is valid with %d themes\n", styleName, len(themes))
+	return
+}
+
+// simplify writes -geo with its lines and rings simplified
+func simplify() (err error) {
+	if tolerance <= 0 {
+		return errors.Errorf("-tolerance is to be positive, got %g", tolerance)
+	}
+	return writeReduced("simplified", func(fc *geojson.FeatureCollection) int {
+		return render.Simplify(fc, tolerance)
+	})
+}
+
+// quantizeCommand writes -geo with its coordinates rounded to -step
+func quantizeCommand() (err error) {
+	if quantizeStepFlag <= 0 {
+		return errors.Errorf("-step is to be positive, got %g", quantizeStepFlag)
+	}
+	return writeReduced("quantized", func(fc *geojson.FeatureCollection) int {
+		return render.Quantize(fc, quantizeStepFlag)
+	})
+}
+
+// writeReduced writes -geo reduced by reduce to -out, <geo>.<suffix>.geojson if it is not set.
+// The coordinates are in WGS84 as they are reprojected on load
+func writeReduced(suffix string, reduce func(fc *geojson.FeatureCollection) int) (err error) {
+	projection, err = proj.Parse(crs)
+	if err != nil {
+		errorHandler(&err, "crs")
+		return
+	}
+	fc, err := dataToFeatureCollection()
+	if err != nil {
+		return
+	}
+	before := 0
+	for _, f := range fc.Features {
+		if f.Geometry != nil {
+			before += geometryPoints(f.Geometry)
+		}
+	}
+	dropped := reduce(fc)
+	// the coordinates are not in the crs of the file anymore
+	fc.CRS = nil
+	data, err := json.Marshal(fc)
+	if err != nil {
+		errorHandler(&err, suffix+" "+geoName)
+		return
+	}
+	if reducedOut == "-" {
+		_, err = os.Stdout.Write(data)
+		return errors.WithStack(err)
+	}
+	out := reducedOut
+	if out == "" {
+		out = strings.TrimSuffix(geoName, filepath.Ext(geoName)) + "." + suffix + ".geojson"
+	}
+	err = ioutil.WriteFile(filepath.Join(dataPath, out), data, 0644)
+	if err != nil {
+		errorHandler(&err, "saving "+out)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d of %d points dropped, written to %s\n", geoName, dropped, before, out)
+	return
+}
+
+// quantizeStep is the grid of -quantize in degrees: 0 without it, half of pixel for auto or the step it gives
+func quantizeStep(pixel float64) (float64, error) {
+	switch quantizeGrid {
+	case "":
+		return 0, nil
+	case "auto":
+		return pixel / 2, nil
+	}
+	step, err := strconv.ParseFloat(quantizeGrid, 64)
+	if err != nil || step <= 0 {
+		return 0, errors.Errorf("-quantize is auto or a positive step in degrees, got %q", quantizeGrid)
+	}
+	return step, nil
+}
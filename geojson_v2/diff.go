@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+// the layers of the diff, the style overrides them by their ids
+var (
+	diffUnchanged = render.Layer{ID: "diff-unchanged", Order: 0, Color: "#666", LineWidth: 1, FontSize: 12, Fill: render.PolygonFill{State: true, Color: "#DDD8"}}
+	diffRemoved   = render.Layer{ID: "diff-removed", Order: 1, Color: "#D00", LineWidth: 2, FontSize: 12, Fill: render.PolygonFill{State: true, Color: "#F448"}}
+	diffAdded     = render.Layer{ID: "diff-added", Order: 2, Color: "#0A0", LineWidth: 2, FontSize: 12, Fill: render.PolygonFill{State: true, Color: "#4F48"}}
+	diffChanged   = render.Layer{ID: "diff-changed", Order: 3, Color: "#CA0", LineWidth: 2, FontSize: 12, Fill: render.PolygonFill{State: true, Color: "#FF48"}}
+)
+
+// diffSets are the features of the new dataset sorted by what happened to them,
+// removed are the ones of the old dataset the new one doesn't have
+type diffSets struct {
+	unchanged *geojson.FeatureCollection
+	removed   *geojson.FeatureCollection
+	added     *geojson.FeatureCollection
+	changed   *geojson.FeatureCollection
+}
+
+// diff renders the changes of -compare against -geo: the features are matched by -key,
+// the added ones are green, the removed ones red and the ones of another geometry yellow
+func diff() (err error) {
+	if compareName == "" {
+		return errors.New("diff needs the new dataset in -compare")
+	}
+	err = initRender(picturePixel())
+	if err != nil {
+		return
+	}
+	before, err := readFeatureCollection(geoName)
+	if err != nil {
+		return
+	}
+	after, err := readFeatureCollection(compareName)
+	if err != nil {
+		return
+	}
+	sets, err := diffFeatures(before, after, diffKey)
+	if err != nil {
+		return
+	}
+	log.Printf("%s -> %s: %d unchanged, %d removed, %d added, %d changed", geoName, compareName,
+		len(sets.unchanged.Features), len(sets.removed.Features), len(sets.added.Features), len(sets.changed.Features))
+	var renderJobs []render.Job
+	for _, set := range []struct {
+		fc    *geojson.FeatureCollection
+		layer render.Layer
+	}{{sets.unchanged, diffUnchanged}, {sets.removed, diffRemoved}, {sets.added, diffAdded}, {sets.changed, diffChanged}} {
+		var d *render.Dataset
+		d, err = render.Prepare(set.fc, xn, yn)
+		if err != nil {
+			errorHandler(&err, set.layer.ID)
+			return
+		}
+		renderJobs = append(renderJobs, render.Job{Data: d, Layer: render.OverlayLayer(style, set.layer)})
+	}
+	renderJobs = append(renderJobs, overlayJobs(renderJobs)...)
+	resultName = filepath.Join(resultPath, resultName)
+	dc, err := newRenderer().DrawParallel(renderJobs, render.View{ZoomX: zoomX, ZoomY: zoomY, DeltaX: deltaX, DeltaY: deltaY, Scale: scale}, jobs)
+	if err != nil {
+		return
+	}
+	return savePNG(dc, resultName)
+}
+
+// diffFeatures matches the features of before and after by the property key,
+// the features without it are added or removed as there is nothing to match them with
+// and so are all but the last of the features of before with the same key
+func diffFeatures(before, after *geojson.FeatureCollection, key string) (sets *diffSets, err error) {
+	sets = &diffSets{
+		unchanged: geojson.NewFeatureCollection(),
+		removed:   geojson.NewFeatureCollection(),
+		added:     geojson.NewFeatureCollection(),
+		changed:   geojson.NewFeatureCollection(),
+	}
+	old := make(map[string]*geojson.Feature, len(before.Features))
+	for _, f := range before.Features {
+		k, ok := f.Properties[key]
+		if !ok {
+			sets.removed.AddFeature(f)
+			continue
+		}
+		if dup, ok := old[fmt.Sprint(k)]; ok {
+			sets.removed.AddFeature(dup)
+		}
+		old[fmt.Sprint(k)] = f
+	}
+	for _, f := range after.Features {
+		k, ok := f.Properties[key]
+		if !ok {
+			sets.added.AddFeature(f)
+			continue
+		}
+		o, ok := old[fmt.Sprint(k)]
+		if !ok {
+			sets.added.AddFeature(f)
+			continue
+		}
+		delete(old, fmt.Sprint(k))
+		var same bool
+		same, err = sameGeometry(o.Geometry, f.Geometry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "feature %s=%v", key, k)
+		}
+		if same {
+			sets.unchanged.AddFeature(f)
+		} else {
+			sets.changed.AddFeature(f)
+		}
+	}
+	for _, f := range before.Features {
+		if k, ok := f.Properties[key]; ok && old[fmt.Sprint(k)] == f {
+			sets.removed.AddFeature(f)
+		}
+	}
+	return
+}
+
+// sameGeometry compares the geometries as geojson, the coordinates are to be the same exactly
+func sameGeometry(a, b *geojson.Geometry) (same bool, err error) {
+	if a == nil || b == nil {
+		return a == b, nil
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return
+	}
+	return bytes.Equal(ja, jb), nil
+}
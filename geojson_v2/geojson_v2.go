@@ -5,27 +5,52 @@ import (
 	"flag"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fogleman/gg"
 	"github.com/golang/freetype/truetype"
 	"github.com/paulmach/go.geojson"
 	"github.com/pkg/errors"
 	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/rav1L/geojson_v2/modules/proj"
+	"github.com/rav1L/geojson_v2/modules/render"
+	"github.com/rav1L/geojson_v2/modules/tiles"
 )
 
 var (
-	geoName    string
-	styleName  string
-	resultName string
-	style      *styleModel
-	font       *truetype.Font
-	zoomX      float64
-	zoomY      float64
-	deltaX     float64
-	deltaY     float64
-	scale      float64
+	geoName     string
+	styleName   string
+	theme       string
+	crs         string
+	projection  proj.Projection
+	clipName    string
+	compareName string
+	diffKey     string
+	clipMask    *render.Dataset
+	quantum     float64
+	resultName  string
+	style       *render.Style
+	font        *truetype.Font
+	zoomX       float64
+	zoomY       float64
+	deltaX      float64
+	deltaY      float64
+	scale       float64
+	layerIDs    string
+	jobs        int
+	minZoom     int
+	maxZoom     int
+	tilesOut    string
+	force       bool
+	fontDir     string
+	graticule   float64
+	bbox        bool
+	attribution string
+	addr        string
 )
 
 const (
@@ -42,220 +67,377 @@ const (
 	stylePath     = "./style"
 	resultPath    = "./result"
 	pointRadius   = 5.0
+	mbtilesExt    = ".mbtiles"
 )
 
-type layer struct {
-	ID        string      `json:"id"`
-	Level     string      `json:"level"`
-	Order     int         `json:"order,string"`
-	Color     string      `json:"color"`
-	FontSize  float64     `json:"font-size,string"`
-	LineWidth float64     `json:"line-width,string"`
-	Fill      polygonFill `json:"fill"`
-}
-
-type polygonFill struct {
-	State bool   `json:"state,string"`
-	Color string `json:"color,omitempty"`
+func main() {
+	log.SetFlags(0)
+	err := runCommand(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
 }
 
-type styleModel struct {
-	Layer []layer `json:"layer"`
+// initRender reads the style, the default font and the mask the drawing commands need,
+// pixel is the size in degrees of a pixel they draw, the data is quantized to by -quantize auto
+func initRender(pixel float64) (err error) {
+	err = initStyle()
+	if err != nil {
+		return
+	}
+	quantum, err = quantizeStep(pixel)
+	if err != nil {
+		return
+	}
+	font, err = truetype.Parse(goregular.TTF)
+	if err != nil {
+		return errors.Wrap(err, "default font")
+	}
+	return initClip()
 }
 
-type point struct {
-	X float64
-	Y float64
+// renderCommand draws the -layers or the third layer of the style with the data of -geo into one picture
+func renderCommand() (err error) {
+	err = initRender(picturePixel())
+	if err != nil {
+		return
+	}
+	switch {
+	case layerIDs != "":
+		return drawLayers(strings.Split(layerIDs, ","), zoomX, zoomY, deltaX, deltaY)
+	case len(style.Layer) < 3:
+		return errors.Errorf("style %s has %d layers, the third one is drawn without -layers", styleName, len(style.Layer))
+	}
+	return draw(style.Layer[2], zoomX, zoomY, deltaX, deltaY)
 }
 
-func init() {
-	flag.StringVar(&geoName, "geo", "admin_level_4.geojson", "geojson file")
-	flag.StringVar(&styleName, "style", "style.json", "style file")
-	flag.StringVar(&resultName, "res", "admin_level_4.png", "result file")
-	flag.Float64Var(&zoomX, "zx", 0, "zoom x")
-	flag.Float64Var(&zoomY, "zy", 0, "zoom y")
-	flag.Float64Var(&deltaX, "dx", 0, "offset x")
-	flag.Float64Var(&deltaY, "dy", 0, "offset x")
-	flag.Float64Var(&scale, "s", 1, "scale coefficient")
-	err := initStyle()
+func draw(mapLayer render.Layer, zoomX, zoomY, deltaX, deltaY float64) (err error) {
+	d, err := loadDataset(geoName)
 	if err != nil {
-		log.Printf("%+v", err)
 		return
 	}
-	font, err = truetype.Parse(goregular.TTF)
+	resultName = filepath.Join(resultPath, resultName)
+	r := newRenderer()
+	renderJobs := []render.Job{{Data: d, Layer: mapLayer}}
+	legends, err := classifyJobs(renderJobs, legendPath(resultName))
 	if err != nil {
 		return
 	}
+	dc, err := r.Draw(d, renderJobs[0].Layer, render.View{ZoomX: zoomX, ZoomY: zoomY, DeltaX: deltaX, DeltaY: deltaY, Scale: scale})
+	if err != nil {
+		errorHandler(&err, "layer "+mapLayer.ID)
+		return
+	}
+	for _, job := range overlayJobs(renderJobs) {
+		err = r.DrawLayer(dc, job.Data, job.Layer)
+		if err != nil {
+			errorHandler(&err, "layer "+job.Layer.ID)
+			return
+		}
+	}
+	err = r.DrawLegend(dc, legends)
+	if err != nil {
+		errorHandler(&err, "legend")
+		return
+	}
+	return savePNG(dc, resultName)
 }
 
-func main() {
-	flag.Parse()
-	draw(style.Layer[2], zoomX, zoomY, deltaX, deltaY)
+// picturePixel is the size in degrees of a pixel of the picture of -s, the finer of the two axes
+func picturePixel() float64 {
+	return 1 / (math.Max(scaleX, scaleY) * scale)
 }
 
-func min(x, y float64) float64 {
-	if x < 0 || y < 0 {
-		return max(x, y)
-	}
-	if x <= y {
-		return x
+// savePNG creates the directory of the result if there is none
+func savePNG(dc *gg.Context, path string) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		errorHandler(&err, "result directory")
+		return
 	}
-	return y
-}
-func max(x, y float64) float64 {
-	if x >= y {
-		return x
+	err = dc.SavePNG(path)
+	if err != nil {
+		errorHandler(&err, "saving "+path)
 	}
-	return y
+	return
 }
 
-func draw(mapLayer layer, zoomX, zoomY, deltaX, deltaY float64) (err error) {
-	fc, err := dataToFeatureCollection()
+// drawLayers composes the layers drawn in parallel into one picture
+func drawLayers(ids []string, zoomX, zoomY, deltaX, deltaY float64) (err error) {
+	renderJobs, err := layerJobs(ids)
 	if err != nil {
-		errorHandler(&err, "something went wrong at draw 1")
 		return
 	}
 	resultName = filepath.Join(resultPath, resultName)
+	legends, err := classifyJobs(renderJobs, legendPath(resultName))
+	if err != nil {
+		return
+	}
+	renderJobs = append(renderJobs, overlayJobs(renderJobs)...)
+	r := newRenderer()
+	dc, err := r.DrawParallel(renderJobs, render.View{ZoomX: zoomX, ZoomY: zoomY, DeltaX: deltaX, DeltaY: deltaY, Scale: scale}, jobs)
+	if err != nil {
+		return
+	}
+	err = r.DrawLegend(dc, legends)
+	if err != nil {
+		errorHandler(&err, "legend")
+		return
+	}
+	return savePNG(dc, resultName)
+}
 
-	face := truetype.NewFace(font, &truetype.Options{Size: mapLayer.FontSize})
-	var minX, minY, maxX, maxY float64
-	resetMinMax := func() {
-		minX = xn
-		minY = yn
-		maxX = 0
-		maxY = 0
-	}
-	resetMinMax()
-
-	dc := initContext(width, height, backgroundHex)
-	dc.SetFontFace(face)
-	dc.ScaleAbout(scale, scale, zoomX, zoomY)
-	dc.Translate(deltaX/scale, deltaY/scale)
-
-	fillAndStroke := func() {
-		dc.SetFillRuleWinding()
-		if mapLayer.Fill.State {
-			dc.SetHexColor(mapLayer.Fill.Color)
-		} else {
-			dc.SetHexColor("FFF")
+// layerJobs reads the data of every layer from <id>.geojson
+func layerJobs(ids []string) (renderJobs []render.Job, err error) {
+	for _, id := range ids {
+		var mapLayer *render.Layer
+		for i := range style.Layer {
+			if style.Layer[i].ID == id {
+				mapLayer = &style.Layer[i]
+				break
+			}
 		}
-		dc.FillPreserve()
-		dc.SetLineWidth(mapLayer.LineWidth * 2)
-		dc.SetHexColor("#FFF")
-		dc.StrokePreserve()
-		dc.SetLineWidth(mapLayer.LineWidth)
-		dc.SetHexColor(mapLayer.Color)
-		dc.Stroke()
-	}
-	drawLineString := func(coords [][]float64) {
-		for _, coord := range coords {
-			x := coord[0]
-			y := coord[1]
-			dc.LineTo(x, y)
+		if mapLayer == nil {
+			err = errors.Errorf("there is no layer %q in the style", id)
+			return
 		}
-		dc.Stroke()
-	}
-	drawPolygon := func(coords [][][]float64) {
-		for _, polygon := range coords {
-			for _, coord := range polygon {
-				x := coord[0]
-				y := coord[1]
-				minX = min(x, minX)
-				maxX = max(x, maxX)
-				minY = min(y, minY)
-				maxY = max(y, maxY)
-				dc.LineTo(x, y)
-			}
-			dc.NewSubPath()
+		var d *render.Dataset
+		d, err = loadDataset(id + ".geojson")
+		if err != nil {
+			return
 		}
-		fillAndStroke()
-	}
-	drawString := func(name string) {
-		xOffset, yOffset := dc.TransformPoint((minX + (maxX-minX)/2), (minY + (maxY-minY)/2))
-		dc.Push()
-		dc.Identity()
-		dc.SetHexColor("FFF")
-		dc.DrawStringWrapped(name, xOffset, yOffset, 0.5, 0.5, maxX-minX, 1, gg.AlignCenter)
-		dc.Pop()
-	}
-	for _, f := range fc.Features {
-		g := f.Geometry
-		nameProp, hasName := f.Properties["name"]
-		applyStyle(dc, &mapLayer)
-		if g.IsMultiPolygon() {
-			coords := g.MultiPolygon
-			for _, polygon := range coords {
-				drawPolygon(polygon)
-			}
-			if hasName {
-				name := nameProp.(string)
-				drawString(name)
-			}
-			resetMinMax()
-			continue
+		renderJobs = append(renderJobs, render.Job{Data: d, Layer: *mapLayer})
+	}
+	return
+}
+
+// tilegen renders the tiles of the layers given by -layers or of the -geo file,
+// the tiles already written are skipped unless -force is set
+func tilegen() (err error) {
+	err = initRender(360 / (render.TileSize * math.Exp2(float64(maxZoom))))
+	if err != nil {
+		return
+	}
+	var renderJobs []render.Job
+	if layerIDs != "" {
+		renderJobs, err = layerJobs(strings.Split(layerIDs, ","))
+		if err != nil {
+			return
 		}
-		if g.IsPolygon() {
-			coords := g.Polygon
-			drawPolygon(coords)
-			if hasName {
-				name := nameProp.(string)
-				drawString(name)
-			}
-			resetMinMax()
-			continue
+	} else {
+		if len(style.Layer) < 3 {
+			return errors.Errorf("style %s has %d layers, the third one is drawn without -layers", styleName, len(style.Layer))
 		}
-		if g.IsPoint() {
-			coord := g.Point
-			dc.DrawPoint(coord[0], coord[1], pointRadius)
-			continue
+		var d *render.Dataset
+		d, err = loadDataset(geoName)
+		if err != nil {
+			return
 		}
-		if g.IsMultiPoint() {
-			coords := g.MultiPoint
-			for _, coord := range coords {
-				dc.DrawPoint(coord[0], coord[1], pointRadius)
-			}
-			continue
+		renderJobs = []render.Job{{Data: d, Layer: style.Layer[2]}}
+	}
+	_, err = classifyJobs(renderJobs, legendPath(tilesOut))
+	if err != nil {
+		return
+	}
+	renderJobs = append(renderJobs, overlayJobs(renderJobs)...)
+	for i := range renderJobs {
+		renderJobs[i].Data = renderJobs[i].Data.Mercator()
+	}
+	var w tiles.Writer
+	if filepath.Ext(tilesOut) == mbtilesExt {
+		w, err = tiles.OpenMBTiles(tilesOut)
+		if err != nil {
+			return errors.WithStack(err)
 		}
-		if g.IsLineString() {
-			coords := g.LineString
-			drawLineString(coords)
-			continue
+	} else {
+		w = &tiles.DirWriter{Dir: tilesOut}
+	}
+	defer w.Close()
+	r := newRenderer()
+	if r.Clip != nil {
+		r.Clip = r.Clip.Mercator()
+	}
+	return tiles.Generate(r, renderJobs, w, tiles.Options{
+		MinZoom:     minZoom,
+		MaxZoom:     maxZoom,
+		Workers:     jobs,
+		Force:       force,
+		Progress:    os.Stderr,
+		Name:        strings.TrimSuffix(filepath.Base(tilesOut), mbtilesExt),
+		Attribution: attribution,
+	})
+}
+
+// classifyJobs fixes the breaks of the choropleth layers of jobs, so all the tiles of a layer are drawn
+// with the same ones, and writes the legends to the JSON file at path
+func classifyJobs(renderJobs []render.Job, path string) (legends []*render.Legend, err error) {
+	for i := range renderJobs {
+		var legend *render.Legend
+		legend, err = render.Classify(renderJobs[i].Data, renderJobs[i].Layer)
+		if err != nil {
+			return
 		}
-		if g.IsMultiLineString() {
-			coords := g.MultiLineString
-			for _, lineString := range coords {
-				drawLineString(lineString)
-			}
+		if legend == nil {
 			continue
 		}
+		c := *renderJobs[i].Layer.Choropleth
+		c.Breaks = legend.Breaks
+		renderJobs[i].Layer.Choropleth = &c
+		legends = append(legends, legend)
+	}
+	if len(legends) == 0 {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		errorHandler(&err, "legend directory")
+		return
+	}
+	data, err := json.MarshalIndent(legends, "", "    ")
+	if err != nil {
+		errorHandler(&err, "legend")
+		return
+	}
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		errorHandler(&err, "saving "+path)
 	}
-	dc.SavePNG(resultName)
 	return
 }
 
+// legendPath is the sidecar of the picture or the tiles at path, <name>.legend.json
+func legendPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".legend.json"
+}
+
+// overlayJobs returns the graticule and the bounding box of the data of jobs if they are asked for
+func overlayJobs(jobs []render.Job) (overlays []render.Job) {
+	if len(jobs) == 0 || (graticule <= 0 && !bbox) {
+		return
+	}
+	b := jobs[0].Data.Bounds()
+	for _, job := range jobs[1:] {
+		b = b.Union(job.Data.Bounds())
+	}
+	if graticule > 0 {
+		overlays = append(overlays, render.Job{Data: render.Graticule(b, graticule, xn, yn), Layer: render.OverlayLayer(style, render.GraticuleLayer)})
+	}
+	if bbox {
+		overlays = append(overlays, render.Job{Data: render.BoundingBox(b, xn, yn), Layer: render.OverlayLayer(style, render.BoundsLayer)})
+	}
+	return
+}
+
+// newRenderer draws on the background of the style, backgroundHex if it has none
+func newRenderer() *render.Renderer {
+	background := backgroundHex
+	if style.Background != "" {
+		background = style.Background
+	}
+	return &render.Renderer{
+		Width:       width,
+		Height:      height,
+		ScaleX:      scaleX,
+		ScaleY:      scaleY,
+		X0:          x0,
+		Y0:          y0,
+		Background:  background,
+		PointRadius: pointRadius,
+		Fonts:       render.NewFonts(fontDir, font),
+		Clip:        clipMask,
+	}
+}
+
+// initClip reads the mask of -clip
+func initClip() (err error) {
+	if clipName == "" {
+		return
+	}
+	fc, err := readFeatureCollection(clipName)
+	if err != nil {
+		return
+	}
+	clipMask, err = render.PrepareClip(fc, xn, yn)
+	if err != nil {
+		errorHandler(&err, clipName)
+	}
+	return
+}
+
+// errorHandler adds msg to the error, it is logged once with the whole context by the caller
 func errorHandler(err *error, msg string) {
-	log.Println(msg)
-	*err = errors.WithStack(*err)
+	*err = errors.Wrap(*err, msg)
 }
 
 func initStyle() (err error) {
 	styleFile, err := os.Open(filepath.Join(stylePath, styleName))
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style file failed to open")
 		return
 	}
 	defer styleFile.Close()
-	style = &styleModel{}
-	err = json.NewDecoder(styleFile).Decode(style)
+	style, err = render.LoadStyle(styleFile, theme)
 	if err != nil {
-		errorHandler(&err, "something went wrong")
+		errorHandler(&err, "style "+styleName+" failed to be decoded")
 		return
 	}
+	if crs == "" {
+		crs = style.CRS
+	}
+	projection, err = proj.Parse(crs)
+	if err != nil {
+		errorHandler(&err, "crs")
+	}
 	return
 }
 
 func dataToFeatureCollection() (fc *geojson.FeatureCollection, err error) {
-	geoFile, err := os.Open(filepath.Join(dataPath, geoName))
+	return readFeatureCollection(geoName)
+}
+
+// loadDataset prepares the geojson file name of the data directory or reads its binary cache instead
+// if the cache is newer than the file, is quantized as -quantize asks and is reprojected from the crs
+// of -crs or of the style, "" being the one of the file for both
+func loadDataset(name string) (d *render.Dataset, err error) {
+	path := filepath.Join(dataPath, name)
+	cache := cachePath(path)
+	if newer(cache, path) {
+		var q float64
+		var c string
+		d, q, c, err = readCache(cache)
+		switch {
+		case err != nil:
+			log.Printf("the cache %s is not read: %v", cache, err)
+		case q != quantum:
+			log.Printf("the cache %s is quantized to %g, not to %g of -quantize, %s is read", cache, q, quantum, name)
+		case c != crs:
+			log.Printf("the cache %s is reprojected from crs %q, not from %q, %s is read", cache, c, crs, name)
+		default:
+			return d, nil
+		}
+	}
+	fc, err := readFeatureCollection(name)
+	if err != nil {
+		return
+	}
+	d, err = render.Prepare(fc, xn, yn)
+	if err != nil {
+		errorHandler(&err, name)
+	}
+	return
+}
+
+// readFeatureCollection reads the geojson file name of the data directory reprojected to WGS84
+func readFeatureCollection(name string) (fc *geojson.FeatureCollection, err error) {
+	return readGeoFile(filepath.Join(dataPath, name), name)
+}
+
+// readGeoFile reads the geojson file at path, name is the one of the errors
+func readGeoFile(path, name string) (fc *geojson.FeatureCollection, err error) {
+	geoFile, err := os.Open(path)
 	if err != nil {
 		errorHandler(&err, "geo file failed to open")
 		return
@@ -264,27 +446,25 @@ func dataToFeatureCollection() (fc *geojson.FeatureCollection, err error) {
 	var geoData []byte
 	geoData, err = ioutil.ReadAll(geoFile)
 	if err != nil {
-		errorHandler(&err, "data failed to be read from geo file")
+		errorHandler(&err, "data failed to be read from geo file "+name)
 		return
 	}
 	fc, err = geojson.UnmarshalFeatureCollection(geoData)
 	if err != nil {
-		errorHandler(&err, "it failed to unmarshal featureCollection ")
+		errorHandler(&err, "it failed to unmarshal featureCollection of "+name)
+		return
+	}
+	p := projection
+	if crs == "" {
+		p, err = proj.Parse(proj.CRSOf(fc))
+		if err != nil {
+			errorHandler(&err, "crs of "+name)
+			return
+		}
+	}
+	proj.Reproject(fc, p)
+	if quantum > 0 {
+		render.Quantize(fc, quantum)
 	}
 	return
 }
-
-func initContext(width int, height int, hex string) (dc *gg.Context) {
-	dc = gg.NewContext(width, height)
-	dc.InvertY()
-	dc.SetHexColor(hex)
-	dc.Clear()
-	dc.Scale(scaleX, scaleY)
-	dc.Translate(x0, y0)
-	return
-}
-
-func applyStyle(dc *gg.Context, mapLayer *layer) {
-	dc.SetHexColor(mapLayer.Color)
-	dc.SetLineWidth(mapLayer.LineWidth)
-}
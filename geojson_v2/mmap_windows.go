@@ -0,0 +1,10 @@
+package main
+
+import (
+	"io/ioutil"
+)
+
+// mapFile reads the whole file at path, the files are not mapped on windows
+func mapFile(path string) (data []byte, err error) {
+	return ioutil.ReadFile(path)
+}
@@ -0,0 +1,162 @@
+// Package proj reprojects the coordinates of the common projected systems to WGS84
+// longitudes and latitudes, the ones the renders are made of. It knows EPSG:4326 and its aliases,
+// Web Mercator EPSG:3857 and the UTM zones of WGS84, EPSG:326NN in the north and EPSG:327NN in the south
+package proj
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+)
+
+// the ellipsoid of WGS84
+const (
+	semiMajor  = 6378137.0
+	flattening = 1 / 298.257223563
+	utmScale   = 0.9996
+	utmEasting = 500000.0
+	// utmSouthNorthing is the false northing of the southern zones
+	utmSouthNorthing = 10000000.0
+)
+
+// Projection turns the projected coordinates into a longitude and a latitude in degrees
+type Projection interface {
+	Inverse(x, y float64) (lon, lat float64)
+}
+
+// Parse finds the projection of a crs given as "EPSG:32633", "32633" or "urn:ogc:def:crs:EPSG::32633".
+// The projection of WGS84 itself is nil, there is nothing to reproject then
+func Parse(crs string) (p Projection, err error) {
+	s := strings.ToUpper(strings.TrimSpace(crs))
+	switch s {
+	case "", "WGS84", "CRS84", "URN:OGC:DEF:CRS:OGC:1.3:CRS84":
+		return nil, nil
+	}
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, errors.Errorf("crs %q is not an EPSG code", crs)
+	}
+	switch {
+	case code == 4326 || code == 4258:
+		return nil, nil
+	case code == 3857 || code == 3785 || code == 900913:
+		return webMercator{}, nil
+	case code > 32600 && code <= 32660:
+		return utm{zone: code - 32600}, nil
+	case code > 32700 && code <= 32760:
+		return utm{zone: code - 32700, south: true}, nil
+	}
+	return nil, errors.Errorf("crs %q is not supported, possible variants: EPSG:4326, EPSG:3857, EPSG:326NN and EPSG:327NN", crs)
+}
+
+type webMercator struct{}
+
+func (webMercator) Inverse(x, y float64) (lon, lat float64) {
+	lon = x / semiMajor * 180 / math.Pi
+	lat = (2*math.Atan(math.Exp(y/semiMajor)) - math.Pi/2) * 180 / math.Pi
+	return
+}
+
+// utm is a zone of the Universal Transverse Mercator, the inverse is the series of Snyder
+type utm struct {
+	zone  int
+	south bool
+}
+
+func (u utm) Inverse(x, y float64) (lon, lat float64) {
+	e2 := flattening * (2 - flattening)
+	ep2 := e2 / (1 - e2)
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	x -= utmEasting
+	if u.south {
+		y -= utmSouthNorthing
+	}
+	mu := y / utmScale / (semiMajor * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	phi := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := semiMajor / math.Sqrt(1-e2*sin*sin)
+	t := tan * tan
+	c := ep2 * cos * cos
+	r := semiMajor * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := x / (n * utmScale)
+	lat = phi - (n*tan/r)*(d*d/2-
+		(5+3*t+10*c-4*c*c-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t+298*c+45*t*t-252*ep2-3*c*c)*math.Pow(d, 6)/720)
+	lon = (d - (1+2*t+c)*math.Pow(d, 3)/6 +
+		(5-2*c+28*t-3*c*c+8*ep2+24*t*t)*math.Pow(d, 5)/120) / cos
+	lon = lon*180/math.Pi + float64(u.zone-1)*6 - 180 + 3
+	lat = lat * 180 / math.Pi
+	return
+}
+
+// Reproject replaces the coordinates of the features of fc by the longitudes and the latitudes of p,
+// the bounding boxes of the old coordinates are dropped
+func Reproject(fc *geojson.FeatureCollection, p Projection) {
+	if p == nil {
+		return
+	}
+	fc.BoundingBox = nil
+	for _, f := range fc.Features {
+		f.BoundingBox = nil
+		reprojectGeometry(f.Geometry, p)
+	}
+}
+
+// CRSOf is the name of the crs member of fc, which RFC 7946 dropped but the older exports still write:
+// {"type": "name", "properties": {"name": "EPSG:32633"}}
+func CRSOf(fc *geojson.FeatureCollection) string {
+	props, _ := fc.CRS["properties"].(map[string]interface{})
+	name, _ := props["name"].(string)
+	return name
+}
+
+func reprojectGeometry(g *geojson.Geometry, p Projection) {
+	if g == nil {
+		return
+	}
+	point := func(c []float64) {
+		if len(c) >= 2 {
+			c[0], c[1] = p.Inverse(c[0], c[1])
+		}
+	}
+	points := func(cs [][]float64) {
+		for _, c := range cs {
+			point(c)
+		}
+	}
+	switch g.Type {
+	case geojson.GeometryPoint:
+		point(g.Point)
+	case geojson.GeometryMultiPoint:
+		points(g.MultiPoint)
+	case geojson.GeometryLineString:
+		points(g.LineString)
+	case geojson.GeometryMultiLineString:
+		for _, l := range g.MultiLineString {
+			points(l)
+		}
+	case geojson.GeometryPolygon:
+		for _, ring := range g.Polygon {
+			points(ring)
+		}
+	case geojson.GeometryMultiPolygon:
+		for _, polygon := range g.MultiPolygon {
+			for _, ring := range polygon {
+				points(ring)
+			}
+		}
+	case geojson.GeometryCollection:
+		for _, child := range g.Geometries {
+			reprojectGeometry(child, p)
+		}
+	}
+}
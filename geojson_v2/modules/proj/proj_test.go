@@ -0,0 +1,35 @@
+package proj
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInverse(t *testing.T) {
+	tests := []struct {
+		crs      string
+		x, y     float64
+		lon, lat float64
+	}{
+		{"EPSG:32631", 452482.53, 5411717.18, 2.3522, 48.8566},
+		{"urn:ogc:def:crs:EPSG::32756", 334368.63, 6250948.35, 151.2093, -33.8688},
+		{"3857", 20037508.34, 0, 180, 0},
+		{"EPSG:3857", 0, 7361866.11, 0, 55},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.crs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lon, lat := p.Inverse(tt.x, tt.y)
+		if math.Abs(lon-tt.lon) > 1e-5 || math.Abs(lat-tt.lat) > 1e-5 {
+			t.Errorf("%s %g %g is %g %g, want %g %g", tt.crs, tt.x, tt.y, lon, lat, tt.lon, tt.lat)
+		}
+	}
+	if p, err := Parse("EPSG:4326"); p != nil || err != nil {
+		t.Errorf("EPSG:4326 is %v, %v, want nothing to reproject", p, err)
+	}
+	if _, err := Parse("EPSG:2154"); err == nil {
+		t.Error("EPSG:2154 is parsed")
+	}
+}
@@ -0,0 +1,213 @@
+package render
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"unsafe"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+)
+
+// the binary format of a prepared dataset, little endian:
+// the header of binaryHeader bytes, the crs the data was reprojected from padded to 8 bytes,
+// the coordinates as float64 after it, so a mapped file is read in place,
+// then every feature: its geometry type, its name, the bounds of its label, its extent, its polygons and parts
+// and its properties as JSON
+const (
+	binaryMagic   = "GJDS"
+	binaryVersion = 3
+	binaryHeader  = 64
+)
+
+var byteOrder = binary.LittleEndian
+
+// WriteBinary writes d in the binary format ReadBinary reads, quantum is the grid the data was quantized to,
+// 0 if it was not, and crs the one it was reprojected from, so the ones reading it know whether it is the data they want
+func (d *Dataset) WriteBinary(w io.Writer, quantum float64, crs string) (err error) {
+	bw := bufio.NewWriter(w)
+	header := make([]byte, binaryHeader)
+	copy(header, binaryMagic)
+	byteOrder.PutUint32(header[4:], binaryVersion)
+	for i, v := range []float64{quantum, d.bounds.MinX, d.bounds.MinY, d.bounds.MaxX, d.bounds.MaxY} {
+		byteOrder.PutUint64(header[8+8*i:], math.Float64bits(v))
+	}
+	byteOrder.PutUint64(header[48:], uint64(len(d.coords)))
+	byteOrder.PutUint64(header[56:], uint64(len(d.features)))
+	bw.Write(header)
+	writeBytes(bw, []byte(crs))
+	bw.Write(make([]byte, padding(4+len(crs))))
+	b := make([]byte, 8)
+	for _, c := range d.coords {
+		byteOrder.PutUint64(b, math.Float64bits(c))
+		bw.Write(b)
+	}
+	for i := range d.features {
+		ft := &d.features[i]
+		var props []byte
+		props, err = json.Marshal(ft.properties)
+		if err != nil {
+			return errors.Wrapf(err, "properties of feature %d", i)
+		}
+		writeBytes(bw, []byte(ft.geometry))
+		writeBytes(bw, []byte(ft.name))
+		hasName := uint32(0)
+		if ft.hasName {
+			hasName = 1
+		}
+		binary.Write(bw, byteOrder, hasName)
+		binary.Write(bw, byteOrder, [4]float64{ft.minX, ft.minY, ft.maxX, ft.maxY})
+		binary.Write(bw, byteOrder, [4]float64{ft.extent.MinX, ft.extent.MinY, ft.extent.MaxX, ft.extent.MaxY})
+		binary.Write(bw, byteOrder, uint32(len(ft.polygons)))
+		for _, rings := range ft.polygons {
+			writeParts(bw, rings)
+		}
+		writeParts(bw, ft.parts)
+		writeBytes(bw, props)
+	}
+	return errors.WithStack(bw.Flush())
+}
+
+// padding is the number of the bytes aligning n bytes to 8
+func padding(n int) int {
+	return (8 - n%8) % 8
+}
+
+func writeBytes(w io.Writer, b []byte) {
+	binary.Write(w, byteOrder, uint32(len(b)))
+	w.Write(b)
+}
+
+func writeParts(w io.Writer, parts []part) {
+	binary.Write(w, byteOrder, uint32(len(parts)))
+	for _, p := range parts {
+		binary.Write(w, byteOrder, [2]uint64{uint64(p.start), uint64(p.end)})
+	}
+}
+
+// ReadBinary reads the dataset written by WriteBinary, the grid it was quantized to and the crs it was reprojected from.
+// The coordinates are not copied on little endian machines if data is 8 byte aligned as a mapped file is,
+// so data is not to be changed or unmapped while the dataset is in use
+func ReadBinary(data []byte) (d *Dataset, quantum float64, crs string, err error) {
+	if len(data) < binaryHeader || string(data[:4]) != binaryMagic {
+		return nil, 0, "", errors.New("not a binary dataset")
+	}
+	if v := byteOrder.Uint32(data[4:]); v != binaryVersion {
+		return nil, 0, "", errors.Errorf("binary dataset of version %d, %d is read", v, binaryVersion)
+	}
+	f := func(off int) float64 { return math.Float64frombits(byteOrder.Uint64(data[off:])) }
+	quantum = f(8)
+	d = &Dataset{bounds: Bounds{MinX: f(16), MinY: f(24), MaxX: f(32), MaxY: f(40)}}
+	nCoords := byteOrder.Uint64(data[48:])
+	nFeatures := byteOrder.Uint64(data[56:])
+	r := &binaryReader{data: data, off: binaryHeader}
+	crs = string(r.bytes())
+	r.next(padding(r.off))
+	if r.err != nil || nCoords > uint64(len(data)-r.off)/8 || nFeatures > uint64(len(data)) {
+		return nil, 0, "", errors.New("binary dataset is cut")
+	}
+	d.coords = coordsOf(data[r.off : r.off+8*int(nCoords)])
+	r.off += 8 * int(nCoords)
+	d.features = make([]feature, 0, nFeatures)
+	for i := uint64(0); i < nFeatures && r.err == nil; i++ {
+		ft := feature{geometry: geojson.GeometryType(r.bytes()), name: string(r.bytes())}
+		ft.hasName = r.uint32() == 1
+		ft.minX, ft.minY, ft.maxX, ft.maxY = r.float64(), r.float64(), r.float64(), r.float64()
+		ft.extent = Bounds{MinX: r.float64(), MinY: r.float64(), MaxX: r.float64(), MaxY: r.float64()}
+		n := r.uint32()
+		for j := uint32(0); j < n && r.err == nil; j++ {
+			ft.polygons = append(ft.polygons, r.parts(len(d.coords)))
+		}
+		ft.parts = r.parts(len(d.coords))
+		props := r.bytes()
+		if r.err == nil {
+			err = json.Unmarshal(props, &ft.properties)
+			if err != nil {
+				return nil, 0, "", errors.Wrapf(err, "properties of feature %d", i)
+			}
+		}
+		d.features = append(d.features, ft)
+	}
+	if r.err != nil {
+		return nil, 0, "", r.err
+	}
+	return
+}
+
+// coordsOf is b as float64 in place if it can be, a copy otherwise
+func coordsOf(b []byte) []float64 {
+	n := len(b) / 8
+	if n == 0 {
+		return nil
+	}
+	one := uint16(1)
+	littleEndian := *(*byte)(unsafe.Pointer(&one)) == 1
+	if littleEndian && uintptr(unsafe.Pointer(&b[0]))%8 == 0 {
+		return unsafe.Slice((*float64)(unsafe.Pointer(&b[0])), n)
+	}
+	coords := make([]float64, n)
+	for i := range coords {
+		coords[i] = math.Float64frombits(byteOrder.Uint64(b[8*i:]))
+	}
+	return coords
+}
+
+// binaryReader reads the features, the first error stops it and the rest it reads is zero
+type binaryReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.data) {
+		if r.err == nil {
+			r.err = errors.New("binary dataset is cut")
+		}
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *binaryReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return byteOrder.Uint32(b)
+}
+
+func (r *binaryReader) float64() float64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(byteOrder.Uint64(b))
+}
+
+func (r *binaryReader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+// parts reads the parts checking they lie in the coords
+func (r *binaryReader) parts(coords int) (parts []part) {
+	n := r.uint32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		b := r.next(16)
+		if b == nil {
+			return nil
+		}
+		p := part{start: int(byteOrder.Uint64(b)), end: int(byteOrder.Uint64(b[8:]))}
+		if p.start < 0 || p.start > p.end || p.end > coords {
+			r.err = errors.Errorf("part %d..%d out of the %d coordinates", p.start, p.end, coords)
+			return nil
+		}
+		parts = append(parts, p)
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadBinaryReadsWhatWriteBinaryWrites(t *testing.T) {
+	d := &Dataset{
+		coords: []float64{0, 0, 1, 0, 1, 1, 0, 0, 5, 5, 6, 6},
+		features: []feature{
+			{geometry: "Polygon", polygons: [][]part{{{0, 8}}}, name: "square", hasName: true, properties: map[string]interface{}{"name": "square", "pop": 3.0}, minX: 0, minY: 0, maxX: 1, maxY: 1, extent: Bounds{MaxX: 1, MaxY: 1}},
+			{geometry: "LineString", parts: []part{{8, 12}}, properties: map[string]interface{}{}, extent: Bounds{MinX: 5, MinY: 5, MaxX: 6, MaxY: 6}},
+		},
+		bounds: Bounds{MinX: 0, MinY: 0, MaxX: 6, MaxY: 6},
+	}
+	var b bytes.Buffer
+	err := d.WriteBinary(&b, 0.5, "EPSG:3857")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, quantum, crs, err := ReadBinary(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quantum != 0.5 || crs != "EPSG:3857" {
+		t.Errorf("quantum is %g and crs %q, want 0.5 and EPSG:3857", quantum, crs)
+	}
+	if !reflect.DeepEqual(read, d) {
+		t.Errorf("read %+v, want %+v", read, d)
+	}
+	_, _, _, err = ReadBinary(b.Bytes()[:b.Len()-3])
+	if err == nil {
+		t.Error("a cut dataset is read")
+	}
+}
@@ -0,0 +1,314 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/pkg/errors"
+)
+
+// the class break methods of a choropleth
+const (
+	Quantile      = "quantile"
+	EqualInterval = "equal-interval"
+	Jenks         = "jenks"
+)
+
+// the defaults of a choropleth without them
+const (
+	defaultClasses = 5
+	// jenksMaxValues is the number of the values Jenks works on, more are sampled evenly
+	// as its cost grows with the square of them
+	jenksMaxValues = 2000
+	legendFontSize = 14
+	legendSwatch   = 18
+	legendMargin   = 10
+)
+
+var defaultRamp = []string{"#FFFFCC", "#800026"}
+
+// Choropleth fills the polygons of a layer by the class of their numeric Property.
+// Without Breaks they are computed over the data by Method, quantile if it is not set,
+// the values from Breaks[i] up to Breaks[i+1] are of the class i. The colors of the classes
+// go evenly along Ramp, which is light yellow to dark red if it is not set
+type Choropleth struct {
+	Property string    `json:"property"`
+	Method   string    `json:"method,omitempty"`
+	Classes  int       `json:"classes,string,omitempty"`
+	Ramp     []string  `json:"ramp,omitempty"`
+	Breaks   []float64 `json:"breaks,omitempty"`
+}
+
+// Legend is a choropleth layer with its breaks and the colors of its classes,
+// it is written next to the picture so the same breaks can be put into the style again
+type Legend struct {
+	Layer    string    `json:"layer"`
+	Property string    `json:"property"`
+	Method   string    `json:"method"`
+	Breaks   []float64 `json:"breaks"`
+	Colors   []string  `json:"colors"`
+}
+
+// Classify computes the breaks of mapLayer over d unless the style gives them,
+// legend is nil if mapLayer is not a choropleth
+func Classify(d *Dataset, mapLayer Layer) (legend *Legend, err error) {
+	c := mapLayer.Choropleth
+	if c == nil || c.Property == "" {
+		return
+	}
+	method := c.Method
+	if method == "" {
+		method = Quantile
+	}
+	classes := c.Classes
+	if classes == 0 {
+		classes = defaultClasses
+	}
+	if classes < 1 {
+		return nil, errors.Errorf("layer %s: %d classes", mapLayer.ID, classes)
+	}
+	breaks := c.Breaks
+	if len(breaks) == 0 {
+		values := d.values(c.Property)
+		if len(values) == 0 {
+			return nil, errors.Errorf("layer %s: no feature has the number %s", mapLayer.ID, c.Property)
+		}
+		sort.Float64s(values)
+		switch method {
+		case Quantile:
+			breaks = quantileBreaks(values, classes)
+		case EqualInterval:
+			breaks = equalIntervalBreaks(values, classes)
+		case Jenks:
+			breaks = jenksBreaks(values, classes)
+		default:
+			return nil, errors.Errorf("layer %s: unknown method %q, possible variants: %s, %s, %s", mapLayer.ID, method, Quantile, EqualInterval, Jenks)
+		}
+	}
+	colors, err := rampColors(c.Ramp, len(breaks)-1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "layer %s", mapLayer.ID)
+	}
+	return &Legend{Layer: mapLayer.ID, Property: c.Property, Method: method, Breaks: breaks, Colors: colors}, nil
+}
+
+// values are the numbers of the property of the features, the numeric strings are numbers too
+func (d *Dataset) values(property string) (values []float64) {
+	for i := range d.features {
+		if v, ok := d.features[i].number(property); ok {
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+func (ft *feature) number(property string) (float64, bool) {
+	switch v := ft.properties[property].(type) {
+	case float64:
+		return v, !math.IsNaN(v)
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil && !math.IsNaN(f)
+	}
+	return 0, false
+}
+
+// classOf is the class of v, the values out of the breaks are of the first or the last one
+func classOf(breaks []float64, v float64) int {
+	return sort.Search(len(breaks)-2, func(i int) bool { return breaks[i+1] > v })
+}
+
+// quantileBreaks puts the same number of the sorted values into every class
+func quantileBreaks(sorted []float64, classes int) []float64 {
+	breaks := make([]float64, classes+1)
+	for i := 0; i < classes; i++ {
+		breaks[i] = sorted[i*len(sorted)/classes]
+	}
+	breaks[classes] = sorted[len(sorted)-1]
+	return breaks
+}
+
+// equalIntervalBreaks splits the range of the sorted values into the classes of the same width
+func equalIntervalBreaks(sorted []float64, classes int) []float64 {
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	breaks := make([]float64, classes+1)
+	for i := range breaks {
+		breaks[i] = lo + (hi-lo)*float64(i)/float64(classes)
+	}
+	breaks[classes] = hi
+	return breaks
+}
+
+// jenksBreaks finds the natural breaks of Fisher and Jenks: the classes
+// with the least sum of the squared deviations from their means
+func jenksBreaks(sorted []float64, classes int) []float64 {
+	if len(sorted) > jenksMaxValues {
+		sample := make([]float64, jenksMaxValues)
+		for i := range sample {
+			sample[i] = sorted[i*(len(sorted)-1)/(jenksMaxValues-1)]
+		}
+		sorted = sample
+	}
+	n := len(sorted)
+	if classes > n {
+		classes = n
+	}
+	// lower[l][j] is the 1-based index of the first value of the last class
+	// of the best j classes of the first l values, cost[l][j] is their deviation
+	lower := make([][]int, n+1)
+	cost := make([][]float64, n+1)
+	for l := range lower {
+		lower[l] = make([]int, classes+1)
+		cost[l] = make([]float64, classes+1)
+		for j := 1; j <= classes; j++ {
+			if l > 1 {
+				cost[l][j] = math.Inf(1)
+			} else if l == 1 {
+				lower[l][j] = 1
+			}
+		}
+	}
+	for l := 2; l <= n; l++ {
+		var sum, sumSq, w float64
+		var variance float64
+		for m := 1; m <= l; m++ {
+			first := l - m + 1
+			v := sorted[first-1]
+			w++
+			sum += v
+			sumSq += v * v
+			variance = sumSq - sum*sum/w
+			if first > 1 {
+				for j := 2; j <= classes; j++ {
+					if c := variance + cost[first-1][j-1]; cost[l][j] >= c {
+						lower[l][j] = first
+						cost[l][j] = c
+					}
+				}
+			}
+		}
+		lower[l][1] = 1
+		cost[l][1] = variance
+	}
+	breaks := make([]float64, classes+1)
+	breaks[classes] = sorted[n-1]
+	l := n
+	for j := classes; j >= 1; j-- {
+		first := lower[l][j]
+		breaks[j-1] = sorted[first-1]
+		l = first - 1
+	}
+	breaks[0] = sorted[0]
+	return breaks
+}
+
+// rampColors are n colors going evenly along the ramp as #RRGGBBAA
+func rampColors(ramp []string, n int) (colors []string, err error) {
+	if len(ramp) == 0 {
+		ramp = defaultRamp
+	}
+	stops := make([][4]float64, len(ramp))
+	for i, hex := range ramp {
+		stops[i], err = parseHex(hex)
+		if err != nil {
+			return
+		}
+	}
+	colors = make([]string, n)
+	for i := range colors {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1) * float64(len(stops)-1)
+		}
+		k := int(t)
+		if k >= len(stops)-1 {
+			k, t = len(stops)-1, float64(len(stops)-1)
+		}
+		a, b := stops[k], stops[k]
+		if k+1 < len(stops) {
+			b = stops[k+1]
+		}
+		f := t - float64(k)
+		colors[i] = "#"
+		for c := 0; c < 4; c++ {
+			colors[i] += fmt.Sprintf("%02X", int(math.Round(a[c]+(b[c]-a[c])*f)))
+		}
+	}
+	return
+}
+
+// parseHex parses the colors of the style: RGB, RGBA, RRGGBB and RRGGBBAA with or without #
+func parseHex(hex string) (c [4]float64, err error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) == 3 || len(s) == 4 {
+		long := make([]byte, 0, 2*len(s))
+		for i := 0; i < len(s); i++ {
+			long = append(long, s[i], s[i])
+		}
+		s = string(long)
+	}
+	if len(s) == 6 {
+		s += "FF"
+	}
+	if len(s) != 8 {
+		return c, errors.Errorf("wrong color %q", hex)
+	}
+	for i := range c {
+		var v uint64
+		v, err = strconv.ParseUint(s[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return c, errors.Errorf("wrong color %q", hex)
+		}
+		c[i] = float64(v)
+	}
+	return
+}
+
+// DrawLegend draws the classes of the legends at the bottom left corner of the canvas
+func (r *Renderer) DrawLegend(dc *gg.Context, legends []*Legend) (err error) {
+	if len(legends) == 0 {
+		return
+	}
+	l, err := newLabeler(r.Fonts, &Layer{FontSize: legendFontSize})
+	if err != nil {
+		return
+	}
+	dc.Push()
+	defer dc.Pop()
+	dc.Identity()
+	rows := 0
+	for _, legend := range legends {
+		rows += 1 + len(legend.Colors)
+	}
+	y := float64(r.Height) - legendMargin - float64(rows)*(legendSwatch+4)
+	for _, legend := range legends {
+		title := legend.Layer + ": " + legend.Property
+		_, err = l.apply(dc, title)
+		if err != nil {
+			return
+		}
+		dc.SetHexColor("#000")
+		dc.DrawStringAnchored(title, legendMargin, y+legendSwatch/2, 0, 0.5)
+		y += legendSwatch + 4
+		for i, color := range legend.Colors {
+			dc.DrawRectangle(legendMargin, y, legendSwatch, legendSwatch)
+			dc.SetHexColor(color)
+			dc.FillPreserve()
+			dc.SetHexColor("#000")
+			dc.SetLineWidth(1)
+			dc.Stroke()
+			text := fmt.Sprintf("%g - %g", legend.Breaks[i], legend.Breaks[i+1])
+			_, err = l.apply(dc, text)
+			if err != nil {
+				return
+			}
+			dc.DrawStringAnchored(text, legendMargin+legendSwatch+6, y+legendSwatch/2, 0, 0.5)
+			y += legendSwatch + 4
+		}
+	}
+	return
+}
@@ -0,0 +1,40 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBreaks(t *testing.T) {
+	clustered := []float64{1, 2, 3, 10, 11, 12, 20, 21, 22}
+	tests := []struct {
+		name   string
+		breaks []float64
+		want   []float64
+	}{
+		{Quantile, quantileBreaks([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 5), []float64{1, 3, 5, 7, 9, 10}},
+		{EqualInterval, equalIntervalBreaks([]float64{0, 3, 10}, 4), []float64{0, 2.5, 5, 7.5, 10}},
+		{Jenks, jenksBreaks(clustered, 3), []float64{1, 10, 20, 22}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.breaks, tt.want) {
+			t.Errorf("%s breaks are %v, want %v", tt.name, tt.breaks, tt.want)
+		}
+	}
+	breaks := []float64{1, 10, 20, 22}
+	for v, want := range map[float64]int{0: 0, 1: 0, 9.9: 0, 10: 1, 20: 2, 22: 2, 30: 2} {
+		if c := classOf(breaks, v); c != want {
+			t.Errorf("%g is of the class %d, want %d", v, c, want)
+		}
+	}
+}
+
+func TestRampColors(t *testing.T) {
+	colors, err := rampColors([]string{"#000", "#FFFFFF80"}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"#000000FF", "#808080C0", "#FFFFFF80"}; !reflect.DeepEqual(colors, want) {
+		t.Errorf("the colors are %v, want %v", colors, want)
+	}
+}
@@ -0,0 +1,588 @@
+package render
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+)
+
+// PrepareClip prepares the mask of Renderer.Clip, fc is to have polygons
+func PrepareClip(fc *geojson.FeatureCollection, xn, yn float64) (d *Dataset, err error) {
+	d, err = Prepare(fc, xn, yn)
+	if err != nil {
+		return
+	}
+	for i := range d.features {
+		if len(d.features[i].polygons) > 0 {
+			return
+		}
+	}
+	return nil, errors.New("the clip has no polygons")
+}
+
+// maskNudge is the part of the size of a mask it is moved by, so the borders the data shares with it,
+// e.g. the regions of a country clipped by its outline, cross it instead of running along its edges
+const maskNudge = 1e-9
+
+// maxMaskCells is the number of the cells of a side of the grid of the edges of a mask at most
+const maxMaskCells = 512
+
+type point struct {
+	x float64
+	y float64
+}
+
+// edge is the edge of a mask from the vertex i of the ring to the next one
+type edge struct {
+	ring int
+	i    int
+}
+
+// mask is the polygons of a clip as the even-odd rings, without the closing points,
+// with their edges in the cells of a grid over its bounds
+type mask struct {
+	of         *Dataset
+	rings      [][]point
+	ringBounds []Bounds
+	edges      []edge
+	bounds     Bounds
+	cols       int
+	rows       int
+	cellW      float64
+	cellH      float64
+	cells      [][]int32
+}
+
+// clipEntry is a dataset clipped once for all the draws of a renderer
+type clipEntry struct {
+	once sync.Once
+	d    *Dataset
+}
+
+// clipped is d cut by the polygons of r.Clip, every dataset is cut once and drawn from then on
+// as it is, the mask is made again if r.Clip is another one
+func (r *Renderer) clipped(d *Dataset) *Dataset {
+	r.clipMu.Lock()
+	if r.mask == nil || r.mask.of != r.Clip {
+		r.mask = newMask(r.Clip)
+		r.clips = make(map[*Dataset]*clipEntry)
+	}
+	m := r.mask
+	e := r.clips[d]
+	if e == nil {
+		e = &clipEntry{}
+		r.clips[d] = e
+	}
+	r.clipMu.Unlock()
+	e.once.Do(func() { e.d = m.clip(d) })
+	return e.d
+}
+
+func newMask(d *Dataset) *mask {
+	m := &mask{of: d, bounds: Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}}
+	for i := range d.features {
+		for _, polygon := range d.features[i].polygons {
+			for _, p := range polygon {
+				ring := d.ring(p)
+				if len(ring) < 3 {
+					continue
+				}
+				b := boundsOf(ring)
+				m.bounds = m.bounds.Union(b)
+				m.rings = append(m.rings, ring)
+				m.ringBounds = append(m.ringBounds, b)
+			}
+		}
+	}
+	nudge := maskNudge * math.Max(m.bounds.MaxX-m.bounds.MinX, m.bounds.MaxY-m.bounds.MinY)
+	dx, dy := nudge, nudge*(math.Sqrt(5)-1)/2
+	m.bounds = Bounds{MinX: m.bounds.MinX + dx, MinY: m.bounds.MinY + dy, MaxX: m.bounds.MaxX + dx, MaxY: m.bounds.MaxY + dy}
+	for r, ring := range m.rings {
+		for i := range ring {
+			ring[i].x += dx
+			ring[i].y += dy
+			m.edges = append(m.edges, edge{ring: r, i: i})
+		}
+		b := &m.ringBounds[r]
+		b.MinX, b.MinY, b.MaxX, b.MaxY = b.MinX+dx, b.MinY+dy, b.MaxX+dx, b.MaxY+dy
+	}
+	n := int(math.Sqrt(float64(len(m.edges)) / 2))
+	m.cols = clampInt(n, 1, maxMaskCells)
+	m.rows = m.cols
+	m.cellW = cellSize(m.bounds.MaxX-m.bounds.MinX, m.cols)
+	m.cellH = cellSize(m.bounds.MaxY-m.bounds.MinY, m.rows)
+	m.cells = make([][]int32, m.cols*m.rows)
+	for e := range m.edges {
+		a, b := m.ends(e)
+		c0, r0 := m.cell(math.Min(a.x, b.x), math.Min(a.y, b.y))
+		c1, r1 := m.cell(math.Max(a.x, b.x), math.Max(a.y, b.y))
+		for row := r0; row <= r1; row++ {
+			for col := c0; col <= c1; col++ {
+				m.cells[row*m.cols+col] = append(m.cells[row*m.cols+col], int32(e))
+			}
+		}
+	}
+	return m
+}
+
+func cellSize(side float64, n int) float64 {
+	if side <= 0 {
+		return 1
+	}
+	return side / float64(n)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// ring is the points of the ring p of d without its closing point
+func (d *Dataset) ring(p part) []point {
+	ring := d.points(p)
+	if n := len(ring); n > 1 && ring[0] == ring[n-1] {
+		ring = ring[:n-1]
+	}
+	return ring
+}
+
+func (d *Dataset) points(p part) []point {
+	coords := d.coords[p.start:p.end]
+	points := make([]point, 0, len(coords)/2)
+	for j := 0; j < len(coords); j += 2 {
+		points = append(points, point{coords[j], coords[j+1]})
+	}
+	return points
+}
+
+func boundsOf(points []point) Bounds {
+	b := Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, p := range points {
+		b.MinX = math.Min(p.x, b.MinX)
+		b.MaxX = math.Max(p.x, b.MaxX)
+		b.MinY = math.Min(p.y, b.MinY)
+		b.MaxY = math.Max(p.y, b.MaxY)
+	}
+	return b
+}
+
+func (b Bounds) intersects(o Bounds) bool {
+	return b.MinX <= o.MaxX && o.MinX <= b.MaxX && b.MinY <= o.MaxY && o.MinY <= b.MaxY
+}
+
+// ends are the points of the edge e
+func (m *mask) ends(e int) (a, b point) {
+	ring := m.rings[m.edges[e].ring]
+	i := m.edges[e].i
+	return ring[i], ring[(i+1)%len(ring)]
+}
+
+// cell is the column and the row of the cell of x, y, the points out of the bounds are in the cells at the edges
+func (m *mask) cell(x, y float64) (col, row int) {
+	col = clampInt(int((x-m.bounds.MinX)/m.cellW), 0, m.cols-1)
+	row = clampInt(int((y-m.bounds.MinY)/m.cellH), 0, m.rows-1)
+	return
+}
+
+// clipping is the state of cutting one dataset by a mask, seen marks the edges
+// already found by the query of the stamp
+type clipping struct {
+	m     *mask
+	seen  []int32
+	stamp int32
+}
+
+// each calls fn with every edge of the mask whose cells the rectangle touches, once
+func (c *clipping) each(b Bounds, fn func(e int)) {
+	m := c.m
+	if !b.intersects(m.bounds) {
+		return
+	}
+	c.stamp++
+	c0, r0 := m.cell(b.MinX, b.MinY)
+	c1, r1 := m.cell(b.MaxX, b.MaxY)
+	for row := r0; row <= r1; row++ {
+		for col := c0; col <= c1; col++ {
+			for _, e := range m.cells[row*m.cols+col] {
+				if c.seen[e] != c.stamp {
+					c.seen[e] = c.stamp
+					fn(int(e))
+				}
+			}
+		}
+	}
+}
+
+// inside tells whether p is in the mask by the even-odd rule
+func (c *clipping) inside(p point) (in bool) {
+	m := c.m
+	c.each(Bounds{MinX: p.x, MinY: p.y, MaxX: m.bounds.MaxX, MaxY: p.y}, func(e int) {
+		a, b := m.ends(e)
+		if crossesRay(p, a, b) {
+			in = !in
+		}
+	})
+	return
+}
+
+// crossesRay tells whether the edge a, b crosses the ray from p to the east
+func crossesRay(p, a, b point) bool {
+	return (a.y > p.y) != (b.y > p.y) && p.x < a.x+(p.y-a.y)*(b.x-a.x)/(b.y-a.y)
+}
+
+// insideRings tells whether p is in the rings by the even-odd rule
+func insideRings(rings [][]point, p point) (in bool) {
+	for _, ring := range rings {
+		if insideRing(ring, p) {
+			in = !in
+		}
+	}
+	return
+}
+
+func insideRing(ring []point, p point) (in bool) {
+	for i := range ring {
+		if crossesRay(p, ring[i], ring[(i+1)%len(ring)]) {
+			in = !in
+		}
+	}
+	return
+}
+
+// cross calls fn with the points the segment p, q crosses the edges of the mask at, t and u are
+// where the crossing is on the segment and on the edge e from 0 at their starts to 1 at their ends,
+// both exclusive of the ends so a crossing at a vertex is found once
+func (c *clipping) cross(p, q point, fn func(x point, t float64, e int, u float64)) {
+	m := c.m
+	c.each(boundsOf([]point{p, q}), func(e int) {
+		a, b := m.ends(e)
+		rx, ry := q.x-p.x, q.y-p.y
+		sx, sy := b.x-a.x, b.y-a.y
+		den := rx*sy - ry*sx
+		if den == 0 {
+			return
+		}
+		ax, ay := a.x-p.x, a.y-p.y
+		t := (ax*sy - ay*sx) / den
+		u := (ax*ry - ay*rx) / den
+		if t >= 0 && t < 1 && u >= 0 && u < 1 {
+			fn(point{p.x + t*rx, p.y + t*ry}, t, e, u)
+		}
+	})
+}
+
+// position is a crossing on a ring of the polygon or of the mask: the edge from the vertex edge,
+// alpha along it, pos in the crossings of the ring ordered along it and entry if the ring enters
+// the other one there going forward
+type position struct {
+	ring  int
+	edge  int
+	alpha float64
+	pos   int
+	entry bool
+}
+
+// crossing is a point a ring of the polygon crosses a ring of the mask at, at[0] is its position
+// on the polygon and at[1] the one on the mask
+type crossing struct {
+	x       point
+	at      [2]position
+	visited bool
+}
+
+// clipPolygon cuts the even-odd rings of a polygon by the mask with the Greiner–Hormann algorithm
+// taken to the many rings of both. The rings crossing nothing are kept whole if they are in the other one.
+// cut tells whether the polygon has lost anything
+func (c *clipping) clipPolygon(rings [][]point) (out [][]point, cut bool) {
+	m := c.m
+	b := Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, ring := range rings {
+		b = b.Union(boundsOf(ring))
+	}
+	if !b.intersects(m.bounds) {
+		return nil, true
+	}
+	var cs []crossing
+	for r, ring := range rings {
+		for k := range ring {
+			c.cross(ring[k], ring[(k+1)%len(ring)], func(x point, t float64, e int, u float64) {
+				cs = append(cs, crossing{x: x, at: [2]position{
+					{ring: r, edge: k, alpha: t},
+					{ring: m.edges[e].ring, edge: m.edges[e].i, alpha: u},
+				}})
+			})
+		}
+	}
+	orders := [2]map[int][]int{orderCrossings(cs, 0), orderCrossings(cs, 1)}
+	for r, ring := range rings {
+		order, crossed := orders[0][r]
+		in := c.inside(ring[0])
+		if !crossed {
+			if in {
+				out = append(out, ring)
+			} else {
+				cut = true
+			}
+			continue
+		}
+		for _, i := range order {
+			cs[i].at[0].entry = !in
+			in = !in
+		}
+	}
+	for r, ring := range m.rings {
+		order, crossed := orders[1][r]
+		if !crossed && !m.ringBounds[r].intersects(b) {
+			continue
+		}
+		in := insideRings(rings, ring[0])
+		if !crossed {
+			if in {
+				out = append(out, append([]point(nil), ring...))
+				cut = true
+			}
+			continue
+		}
+		for _, i := range order {
+			cs[i].at[1].entry = !in
+			in = !in
+		}
+	}
+	for i := range cs {
+		if cs[i].visited {
+			continue
+		}
+		cut = true
+		var ring []point
+		cur, side := i, 0
+		for n := 0; !cs[cur].visited && n <= len(cs); n++ {
+			x := &cs[cur]
+			x.visited = true
+			ring = append(ring, x.x)
+			at := x.at[side]
+			points := m.rings[at.ring]
+			if side == 0 {
+				points = rings[at.ring]
+			}
+			ring, cur = walk(ring, points, cs, side, orders[side][at.ring], at.pos, at.entry)
+			side = 1 - side
+		}
+		if len(ring) >= 3 {
+			out = append(out, ring)
+		}
+	}
+	orient(out)
+	return
+}
+
+// orderCrossings orders the crossings of every ring of the side along it and sets their pos
+func orderCrossings(cs []crossing, side int) map[int][]int {
+	orders := make(map[int][]int)
+	for i := range cs {
+		r := cs[i].at[side].ring
+		orders[r] = append(orders[r], i)
+	}
+	for _, order := range orders {
+		sort.Slice(order, func(i, j int) bool {
+			a, b := &cs[order[i]].at[side], &cs[order[j]].at[side]
+			return a.edge < b.edge || a.edge == b.edge && a.alpha < b.alpha
+		})
+		for pos, i := range order {
+			cs[i].at[side].pos = pos
+		}
+	}
+	return orders
+}
+
+// walk appends the vertices of ring from the crossing at pos of order to the next one going forward
+// or to the previous one going backward and answers that crossing
+func walk(out []point, ring []point, cs []crossing, side int, order []int, pos int, forward bool) ([]point, int) {
+	n := len(ring)
+	from := cs[order[pos]].at[side]
+	if forward {
+		next := order[(pos+1)%len(order)]
+		to := cs[next].at[side]
+		steps := (to.edge - from.edge + n) % n
+		if steps == 0 && to.alpha <= from.alpha {
+			steps = n
+		}
+		for j := 1; j <= steps; j++ {
+			out = append(out, ring[(from.edge+j)%n])
+		}
+		return out, next
+	}
+	next := order[(pos-1+len(order))%len(order)]
+	to := cs[next].at[side]
+	steps := (from.edge - to.edge + n) % n
+	if steps == 0 && to.alpha >= from.alpha {
+		steps = n
+	}
+	for j := 0; j < steps; j++ {
+		out = append(out, ring[(from.edge-j+n)%n])
+	}
+	return out, next
+}
+
+// orient turns the rings so the nonzero winding the polygons are filled with fills them as even-odd:
+// the rings in an even number of the others go counterclockwise and the rest clockwise
+func orient(rings [][]point) {
+	for i, ring := range rings {
+		depth := 0
+		for j, other := range rings {
+			if j != i && insideRing(other, ring[0]) {
+				depth++
+			}
+		}
+		if (area(ring) > 0) != (depth%2 == 0) {
+			for l, r := 0, len(ring)-1; l < r; l, r = l+1, r-1 {
+				ring[l], ring[r] = ring[r], ring[l]
+			}
+		}
+	}
+}
+
+// area is the signed area of the ring, positive if it goes counterclockwise
+func area(ring []point) (a float64) {
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		a += p.x*q.y - q.x*p.y
+	}
+	return a / 2
+}
+
+// clipLine cuts a line string by the mask into the parts of it in the mask
+func (c *clipping) clipLine(line []point) (parts [][]point) {
+	if len(line) == 0 {
+		return
+	}
+	in := c.inside(line[0])
+	var cur []point
+	if in {
+		cur = []point{line[0]}
+	}
+	type crossed struct {
+		x point
+		t float64
+	}
+	var xs []crossed
+	for k := 0; k+1 < len(line); k++ {
+		xs = xs[:0]
+		c.cross(line[k], line[k+1], func(x point, t float64, e int, u float64) {
+			xs = append(xs, crossed{x, t})
+		})
+		sort.Slice(xs, func(i, j int) bool { return xs[i].t < xs[j].t })
+		for _, x := range xs {
+			if in {
+				parts = append(parts, append(cur, x.x))
+				cur = nil
+			} else {
+				cur = []point{x.x}
+			}
+			in = !in
+		}
+		if in {
+			cur = append(cur, line[k+1])
+		}
+	}
+	if in && len(cur) >= 2 {
+		parts = append(parts, cur)
+	}
+	return
+}
+
+// clip cuts the geometry of d by the mask: the polygons to their parts in it, the lines
+// to their pieces in it and the points out of it are dropped, as are the features left with nothing.
+// The labels of the polygons cut are centered on what is left of them
+func (m *mask) clip(d *Dataset) *Dataset {
+	c := &clipping{m: m, seen: make([]int32, len(m.edges))}
+	out := &Dataset{features: make([]feature, 0, len(d.features)), bounds: d.bounds}
+	for i := range d.features {
+		ft := d.features[i]
+		switch ft.geometry {
+		case geojson.GeometryMultiPolygon, geojson.GeometryPolygon:
+			polygons := ft.polygons
+			ft.polygons = nil
+			var cut bool
+			var kept [][]point
+			for _, polygon := range polygons {
+				rings := make([][]point, 0, len(polygon))
+				for _, p := range polygon {
+					if ring := d.ring(p); len(ring) >= 3 {
+						rings = append(rings, ring)
+					}
+				}
+				clipped, polygonCut := c.clipPolygon(rings)
+				cut = cut || polygonCut
+				if len(clipped) > 0 {
+					ft.polygons = append(ft.polygons, out.addRings(clipped))
+					kept = append(kept, clipped...)
+				}
+			}
+			if len(ft.polygons) == 0 {
+				continue
+			}
+			if cut {
+				var all []point
+				for _, ring := range kept {
+					all = append(all, ring...)
+				}
+				b := boundsOf(all)
+				ft.minX, ft.minY, ft.maxX, ft.maxY = b.MinX, b.MinY, b.MaxX, b.MaxY
+			}
+		case geojson.GeometryPoint, geojson.GeometryMultiPoint:
+			var in []point
+			for _, p := range d.points(ft.parts[0]) {
+				if c.inside(p) {
+					in = append(in, p)
+				}
+			}
+			if len(in) == 0 {
+				continue
+			}
+			ft.parts = []part{out.addPoints(in, false)}
+		case geojson.GeometryLineString, geojson.GeometryMultiLineString:
+			parts := ft.parts
+			ft.parts = nil
+			for _, p := range parts {
+				for _, line := range c.clipLine(d.points(p)) {
+					ft.parts = append(ft.parts, out.addPoints(line, false))
+				}
+			}
+			if len(ft.parts) == 0 {
+				continue
+			}
+		}
+		ft.extent = out.extentOf(&ft)
+		out.features = append(out.features, ft)
+	}
+	return out
+}
+
+func (d *Dataset) addRings(rings [][]point) []part {
+	parts := make([]part, 0, len(rings))
+	for _, ring := range rings {
+		parts = append(parts, d.addPoints(ring, true))
+	}
+	return parts
+}
+
+// addPoints appends the points to the coordinates, closed repeats the first one at the end
+func (d *Dataset) addPoints(points []point, closed bool) part {
+	p := part{start: len(d.coords)}
+	for _, q := range points {
+		d.coords = append(d.coords, q.x, q.y)
+	}
+	if closed && len(points) > 0 {
+		d.coords = append(d.coords, points[0].x, points[0].y)
+	}
+	p.end = len(d.coords)
+	return p
+}
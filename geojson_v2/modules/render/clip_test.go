@@ -0,0 +1,114 @@
+package render
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/go.geojson"
+)
+
+// uMask is a 6x4 rectangle with a notch of 2x3 cut into its top, so it is not convex
+var uMask = [][][]float64{{{0, 0}, {6, 0}, {6, 4}, {4, 4}, {4, 1}, {2, 1}, {2, 4}, {0, 4}, {0, 0}}}
+
+func square(x0, y0, x1, y1 float64) [][]float64 {
+	return [][]float64{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}, {x0, y0}}
+}
+
+// clipBy cuts a dataset of the features by a mask of the polygon
+func clipBy(t *testing.T, polygon [][][]float64, features ...*geojson.Feature) *Dataset {
+	fc := geojson.NewFeatureCollection()
+	fc.AddFeature(geojson.NewPolygonFeature(polygon))
+	clip, err := PrepareClip(fc, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc = geojson.NewFeatureCollection()
+	for _, f := range features {
+		fc.AddFeature(f)
+	}
+	d, err := Prepare(fc, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Renderer{Clip: clip}
+	return r.clipped(d)
+}
+
+// polygonArea is the area the nonzero winding fills of the polygons of ft, their rings do not overlap
+func polygonArea(d *Dataset, ft *feature) (a float64) {
+	for _, polygon := range ft.polygons {
+		for _, p := range polygon {
+			a += area(d.ring(p))
+		}
+	}
+	return
+}
+
+func TestClipCutsThePolygons(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		mask    [][][]float64
+		polygon [][][]float64
+		rings   int
+		area    float64
+	}{
+		{"overlap", [][][]float64{square(2, 2, 6, 6)}, [][][]float64{square(0, 0, 4, 4)}, 1, 4},
+		{"concave mask", uMask, [][][]float64{square(-1, 2, 7, 3)}, 2, 4},
+		{"hole of the mask", [][][]float64{square(0, 0, 10, 10), square(4, 4, 6, 6)}, [][][]float64{square(3, 3, 7, 7)}, 2, 12},
+		{"hole of the polygon", [][][]float64{square(0, 0, 10, 10)}, [][][]float64{square(-2, -2, 5, 5), square(1, 1, 2, 2)}, 2, 24},
+		{"borders shared with the mask", [][][]float64{square(0, 0, 10, 10)}, [][][]float64{square(0, 0, 5, 5)}, 1, 25},
+		{"mask in the polygon", [][][]float64{square(2, 2, 3, 3)}, [][][]float64{square(0, 0, 5, 5)}, 1, 1},
+	} {
+		d := clipBy(t, c.mask, geojson.NewPolygonFeature(c.polygon))
+		if len(d.features) != 1 {
+			t.Errorf("%s: %d features are left, want 1", c.name, len(d.features))
+			continue
+		}
+		ft := &d.features[0]
+		var rings int
+		for _, polygon := range ft.polygons {
+			rings += len(polygon)
+		}
+		if rings != c.rings {
+			t.Errorf("%s: %d rings, want %d", c.name, rings, c.rings)
+		}
+		if a := polygonArea(d, ft); math.Abs(a-c.area) > 1e-6 {
+			t.Errorf("%s: the area is %g, want %g", c.name, a, c.area)
+		}
+	}
+}
+
+func TestClipDropsTheFeaturesOutOfTheMask(t *testing.T) {
+	d := clipBy(t, uMask,
+		geojson.NewPolygonFeature([][][]float64{square(2.5, 2, 3.5, 3)}),
+		geojson.NewPolygonFeature([][][]float64{square(10, 10, 11, 11)}),
+		geojson.NewLineStringFeature([][]float64{{2.5, 2}, {3.5, 3}}),
+		geojson.NewPointFeature([]float64{3, 3}),
+	)
+	if len(d.features) != 0 {
+		t.Errorf("%d features are left in the notch and out of the mask", len(d.features))
+	}
+}
+
+func TestClipCutsTheLines(t *testing.T) {
+	d := clipBy(t, uMask,
+		geojson.NewLineStringFeature([][]float64{{-1, 2}, {7, 2}}),
+		geojson.NewMultiPointFeature([]float64{1, 1}, []float64{3, 3}, []float64{5, 2}, []float64{8, 8}),
+	)
+	if len(d.features) != 2 {
+		t.Fatalf("%d features are left, want 2", len(d.features))
+	}
+	line := &d.features[0]
+	if len(line.parts) != 2 {
+		t.Fatalf("the line is cut into %d parts, want 2", len(line.parts))
+	}
+	for i, want := range [][2]float64{{0, 2}, {4, 6}} {
+		points := d.points(line.parts[i])
+		if len(points) != 2 || math.Abs(points[0].x-want[0]) > 1e-6 || math.Abs(points[1].x-want[1]) > 1e-6 {
+			t.Errorf("part %d is %v, want from x %g to %g", i, points, want[0], want[1])
+		}
+	}
+	if points := d.points(d.features[1].parts[0]); len(points) != 2 {
+		t.Errorf("the points %v are left, want (1 1) and (5 2)", points)
+	}
+}
@@ -0,0 +1,203 @@
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// typeface is a loaded font file, TrueType outlines are drawn by freetype
+// and OpenType (CFF) ones by x/image/font/opentype
+type typeface struct {
+	ttf *truetype.Font
+	otf *opentype.Font
+}
+
+func (t *typeface) face(size float64) (font.Face, error) {
+	if t.ttf != nil {
+		return truetype.NewFace(t.ttf, &truetype.Options{Size: size}), nil
+	}
+	return opentype.NewFace(t.otf, &opentype.FaceOptions{Size: size, DPI: 72})
+}
+
+// covers reports whether the font has glyphs for every letter of s
+func (t *typeface) covers(s string) bool {
+	var buf sfnt.Buffer
+	for _, r := range s {
+		if r == ' ' || r == '\n' {
+			continue
+		}
+		if t.ttf != nil {
+			if t.ttf.Index(r) == 0 {
+				return false
+			}
+			continue
+		}
+		i, err := t.otf.GlyphIndex(&buf, r)
+		if err != nil || i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Fonts resolves font families of the style to the font files of a directory,
+// the files are parsed once and shared by all the renders
+type Fonts struct {
+	dir      string
+	fallback *typeface
+	mu       sync.Mutex
+	files    map[string]string
+	loaded   map[string]*typeface
+}
+
+// NewFonts creates Fonts over the directory dir, fallback ends every chain
+func NewFonts(dir string, fallback *truetype.Font) *Fonts {
+	f := &Fonts{dir: dir, loaded: make(map[string]*typeface)}
+	if fallback != nil {
+		f.fallback = &typeface{ttf: fallback}
+	}
+	return f
+}
+
+// normalizeFamily makes "Noto Sans" match NotoSans.ttf, noto_sans.otf and so on
+func normalizeFamily(s string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(s))
+}
+
+// index lists the font files of the directory, a missing directory means no fonts but the fallback
+func (f *Fonts) index() (err error) {
+	if f.files != nil {
+		return
+	}
+	f.files = make(map[string]string)
+	infos, err := ioutil.ReadDir(f.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "font directory %s", f.dir)
+	}
+	for _, info := range infos {
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		if info.IsDir() || (ext != ".ttf" && ext != ".otf") {
+			continue
+		}
+		f.files[normalizeFamily(strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())))] = filepath.Join(f.dir, info.Name())
+	}
+	return
+}
+
+// load returns the typeface of the family, nil if there is no such file
+func (f *Fonts) load(family string) (t *typeface, err error) {
+	key := normalizeFamily(family)
+	if t, ok := f.loaded[key]; ok {
+		return t, nil
+	}
+	path, ok := f.files[key]
+	if !ok {
+		path, ok = f.files[key+"regular"]
+	}
+	if !ok {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "font %s", path)
+	}
+	t = &typeface{}
+	if strings.EqualFold(filepath.Ext(path), ".ttf") {
+		t.ttf, err = truetype.Parse(b)
+	} else {
+		t.otf, err = opentype.Parse(b)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "font %s", path)
+	}
+	f.loaded[key] = t
+	return
+}
+
+// chain resolves the comma separated families, the families without files are skipped
+func (f *Fonts) chain(families string) (chain []*typeface, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err = f.index()
+	if err != nil {
+		return
+	}
+	for _, family := range strings.Split(families, ",") {
+		family = strings.TrimSpace(family)
+		if family == "" {
+			continue
+		}
+		var t *typeface
+		t, err = f.load(family)
+		if err != nil {
+			return
+		}
+		if t != nil {
+			chain = append(chain, t)
+		}
+	}
+	if f.fallback != nil {
+		chain = append(chain, f.fallback)
+	}
+	return
+}
+
+// labeler sets the face of the first font of the chain able to draw a label,
+// faces are created once per draw
+type labeler struct {
+	chain   []*typeface
+	faces   []font.Face
+	size    float64
+	current int
+}
+
+func newLabeler(fonts *Fonts, mapLayer *Layer) (l *labeler, err error) {
+	l = &labeler{size: mapLayer.FontSize, current: -1}
+	if fonts != nil {
+		l.chain, err = fonts.chain(mapLayer.FontFamily)
+		if err != nil {
+			return
+		}
+	}
+	l.faces = make([]font.Face, len(l.chain))
+	return
+}
+
+// apply sets the face for name, it is false if there are no fonts at all
+func (l *labeler) apply(dc *gg.Context, name string) (ok bool, err error) {
+	if len(l.chain) == 0 {
+		return false, nil
+	}
+	i := len(l.chain) - 1
+	for j, t := range l.chain[:i] {
+		if t.covers(name) {
+			i = j
+			break
+		}
+	}
+	if i == l.current {
+		return true, nil
+	}
+	if l.faces[i] == nil {
+		l.faces[i], err = l.chain[i].face(l.size)
+		if err != nil {
+			return
+		}
+	}
+	dc.SetFontFace(l.faces[i])
+	l.current = i
+	return true, nil
+}
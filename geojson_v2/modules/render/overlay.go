@@ -0,0 +1,96 @@
+package render
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/paulmach/go.geojson"
+)
+
+// the ids of the style layers the overlays are drawn with if the style has them
+const (
+	GraticuleID = "graticule"
+	BoundsID    = "bbox"
+)
+
+// GraticuleLayer is the style of the graticule when the style file has none
+var GraticuleLayer = Layer{ID: GraticuleID, Order: math.MaxInt32 - 1, Color: "#FFF8", LineWidth: 1, FontSize: 12, LineLabels: true}
+
+// BoundsLayer is the style of the bounding box when the style file has none
+var BoundsLayer = Layer{ID: BoundsID, Order: math.MaxInt32, Color: "#F0F", LineWidth: 2}
+
+// Graticule makes meridians and parallels every step degrees covering b, named by their degrees.
+// Every line is split into step/gratSegments pieces so it bends properly when projected
+func Graticule(b Bounds, step float64, xn, yn float64) *Dataset {
+	fc := geojson.NewFeatureCollection()
+	if step <= 0 {
+		return prepareOverlay(fc, xn, yn)
+	}
+	minX := math.Floor(b.MinX/step) * step
+	minY := math.Floor(b.MinY/step) * step
+	maxX := math.Ceil(b.MaxX/step) * step
+	maxY := math.Ceil(b.MaxY/step) * step
+	line := func(x0, y0, x1, y1 float64) [][]float64 {
+		n := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))/step) * gratSegments
+		if n < 1 {
+			n = 1
+		}
+		coords := make([][]float64, 0, n+1)
+		for i := 0; i <= n; i++ {
+			t := float64(i) / float64(n)
+			coords = append(coords, []float64{x0 + (x1-x0)*t, y0 + (y1-y0)*t})
+		}
+		return coords
+	}
+	for x := minX; x <= maxX; x += step {
+		f := geojson.NewLineStringFeature(line(x, minY, x, maxY))
+		f.Properties["name"] = degrees(x, "E", "W")
+		fc.AddFeature(f)
+	}
+	for y := minY; y <= maxY; y += step {
+		f := geojson.NewLineStringFeature(line(minX, y, maxX, y))
+		f.Properties["name"] = degrees(y, "N", "S")
+		fc.AddFeature(f)
+	}
+	return prepareOverlay(fc, xn, yn)
+}
+
+const gratSegments = 8
+
+func degrees(v float64, positive, negative string) string {
+	suffix := positive
+	if v < 0 {
+		suffix = negative
+		v = -v
+	} else if v == 0 {
+		suffix = ""
+	}
+	return fmt.Sprintf("%g°%s", v, suffix)
+}
+
+// BoundingBox makes the outline of b
+func BoundingBox(b Bounds, xn, yn float64) *Dataset {
+	fc := geojson.NewFeatureCollection()
+	fc.AddFeature(geojson.NewLineStringFeature([][]float64{
+		{b.MinX, b.MinY}, {b.MaxX, b.MinY}, {b.MaxX, b.MaxY}, {b.MinX, b.MaxY}, {b.MinX, b.MinY},
+	}))
+	return prepareOverlay(fc, xn, yn)
+}
+
+// prepareOverlay prepares the features built here, their coordinates are always valid
+func prepareOverlay(fc *geojson.FeatureCollection, xn, yn float64) *Dataset {
+	d, _ := Prepare(fc, xn, yn)
+	return d
+}
+
+// OverlayLayer returns the layer of the style with the id or def if there is none
+func OverlayLayer(style *Style, def Layer) Layer {
+	if style != nil {
+		for _, l := range style.Layer {
+			if l.ID == def.ID {
+				return l
+			}
+		}
+	}
+	return def
+}
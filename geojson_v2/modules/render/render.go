@@ -0,0 +1,702 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
+)
+
+// Layer is the style of one map layer
+type Layer struct {
+	ID        string      `json:"id"`
+	Level     string      `json:"level"`
+	Order     int         `json:"order,string"`
+	Color     string      `json:"color"`
+	FontSize  float64     `json:"font-size,string"`
+	LineWidth float64     `json:"line-width,string"`
+	Fill      PolygonFill `json:"fill"`
+	// FontFamily is a comma separated chain of families, a label is drawn
+	// by the first of them having all its letters
+	FontFamily string `json:"font-family,omitempty"`
+	// LineLabels draws the names of line strings at their first points
+	LineLabels bool `json:"line-labels,string,omitempty"`
+	// Choropleth fills the polygons by a numeric property instead of Fill
+	Choropleth *Choropleth `json:"choropleth,omitempty"`
+}
+
+// PolygonFill is the fill of polygons of a layer
+type PolygonFill struct {
+	State bool   `json:"state,string"`
+	Color string `json:"color,omitempty"`
+}
+
+// Style is the model of style.json with its inheritance resolved by LoadStyle,
+// Background is the color of the canvas if the style has one and CRS is the EPSG code of the data,
+// which is reprojected to WGS84 on load
+type Style struct {
+	Background string  `json:"background,omitempty"`
+	CRS        string  `json:"crs,omitempty"`
+	Layer      []Layer `json:"layer"`
+}
+
+// View is the zoom and the offset the map is drawn with
+type View struct {
+	ZoomX  float64
+	ZoomY  float64
+	DeltaX float64
+	DeltaY float64
+	Scale  float64
+}
+
+// Renderer draws prepared datasets on a canvas of the fixed size
+type Renderer struct {
+	Width       int
+	Height      int
+	ScaleX      float64
+	ScaleY      float64
+	X0          float64
+	Y0          float64
+	Background  string
+	PointRadius float64
+	Fonts       *Fonts
+	// Clip cuts the geometry of all the layers to its polygons, it is in the coordinates of the datasets
+	// and is projected by Mercator for the tiles too. nil draws everything
+	Clip *Dataset
+
+	// clips are the datasets drawn cut by mask, the one of Clip
+	clipMu sync.Mutex
+	mask   *mask
+	clips  map[*Dataset]*clipEntry
+}
+
+// part is a ring of a polygon, a line string or a set of points,
+// start and end are the offsets of its first and after-last point in Dataset.coords
+type part struct {
+	start int
+	end   int
+}
+
+type feature struct {
+	geometry geojson.GeometryType
+	// polygons holds the rings of every polygon, parts holds lines or points
+	polygons [][]part
+	parts    []part
+	name     string
+	hasName  bool
+	// properties are the ones of the geojson feature, choropleths read them
+	properties map[string]interface{}
+	// minX, minY, maxX and maxY are the bounds of the label
+	minX float64
+	minY float64
+	maxX float64
+	maxY float64
+	// extent is the rectangle all the coordinates of the feature lie in
+	extent Bounds
+}
+
+// Dataset is a feature collection flattened for drawing: the coordinates of all the features
+// lie in one slice and the bounds of the labelled features are computed once,
+// so repeated draws of the same data (zoom, tiles, layers) cost only the drawing itself
+type Dataset struct {
+	coords   []float64
+	features []feature
+	bounds   Bounds
+}
+
+// Bounds is the rectangle all the coordinates of a dataset lie in
+type Bounds struct {
+	MinX float64
+	MinY float64
+	MaxX float64
+	MaxY float64
+}
+
+// TileSize is the side of a tile in pixels
+const TileSize = 256
+
+// Prepare flattens fc, xn and yn are the initial minimums of the label bounds
+func Prepare(fc *geojson.FeatureCollection, xn, yn float64) (d *Dataset, err error) {
+	d = &Dataset{features: make([]feature, 0, len(fc.Features))}
+	var n int
+	for _, f := range fc.Features {
+		n += countPoints(f.Geometry)
+	}
+	d.coords = make([]float64, 0, 2*n)
+	d.bounds = Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for i, f := range fc.Features {
+		g := f.Geometry
+		if g == nil {
+			continue
+		}
+		ft := feature{geometry: g.Type, minX: xn, minY: yn, properties: f.Properties}
+		nameProp, hasName := f.Properties["name"]
+		ft.name, ft.hasName = nameProp.(string)
+		ft.hasName = ft.hasName && hasName
+		switch {
+		case g.IsMultiPolygon():
+			ft.polygons = make([][]part, 0, len(g.MultiPolygon))
+			for _, polygon := range g.MultiPolygon {
+				var rings []part
+				rings, err = d.addPolygon(&ft, polygon)
+				if err != nil {
+					break
+				}
+				ft.polygons = append(ft.polygons, rings)
+			}
+		case g.IsPolygon():
+			var rings []part
+			rings, err = d.addPolygon(&ft, g.Polygon)
+			ft.polygons = [][]part{rings}
+		case g.IsPoint():
+			ft.parts, err = d.addParts(nil, [][]float64{g.Point})
+		case g.IsMultiPoint():
+			ft.parts, err = d.addParts(nil, g.MultiPoint)
+		case g.IsLineString():
+			ft.parts, err = d.addParts(nil, g.LineString)
+		case g.IsMultiLineString():
+			ft.parts = make([]part, 0, len(g.MultiLineString))
+			for _, lineString := range g.MultiLineString {
+				var p part
+				p, err = d.addPart(nil, lineString)
+				if err != nil {
+					break
+				}
+				ft.parts = append(ft.parts, p)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "feature %d (%s)", i, featureName(f))
+		}
+		ft.extent = d.extentOf(&ft)
+		d.features = append(d.features, ft)
+	}
+	return
+}
+
+// featureName is the id or the name of f for error messages
+func featureName(f *geojson.Feature) string {
+	if f.ID != nil {
+		return fmt.Sprint(f.ID)
+	}
+	if name, ok := f.Properties["name"]; ok {
+		return fmt.Sprint(name)
+	}
+	return "unnamed"
+}
+
+func countPoints(g *geojson.Geometry) (n int) {
+	if g == nil {
+		return
+	}
+	switch {
+	case g.IsMultiPolygon():
+		for _, polygon := range g.MultiPolygon {
+			for _, ring := range polygon {
+				n += len(ring)
+			}
+		}
+	case g.IsPolygon():
+		for _, ring := range g.Polygon {
+			n += len(ring)
+		}
+	case g.IsPoint():
+		n = 1
+	case g.IsMultiPoint():
+		n = len(g.MultiPoint)
+	case g.IsLineString():
+		n = len(g.LineString)
+	case g.IsMultiLineString():
+		for _, lineString := range g.MultiLineString {
+			n += len(lineString)
+		}
+	}
+	return
+}
+
+func (d *Dataset) addPolygon(ft *feature, polygon [][][]float64) (rings []part, err error) {
+	rings = make([]part, 0, len(polygon))
+	for _, ring := range polygon {
+		var p part
+		p, err = d.addPart(ft, ring)
+		if err != nil {
+			return
+		}
+		rings = append(rings, p)
+	}
+	return
+}
+
+func (d *Dataset) addParts(ft *feature, coords [][]float64) (parts []part, err error) {
+	p, err := d.addPart(ft, coords)
+	if err != nil {
+		return
+	}
+	return []part{p}, nil
+}
+
+// addPart copies the coordinates, the bounds of ft are extended if it is not nil
+func (d *Dataset) addPart(ft *feature, coords [][]float64) (p part, err error) {
+	p = part{start: len(d.coords)}
+	for i, coord := range coords {
+		if len(coord) < 2 {
+			return p, errors.Errorf("coordinate %d has %d values, 2 are expected", i, len(coord))
+		}
+		if math.IsNaN(coord[0]) || math.IsNaN(coord[1]) || math.IsInf(coord[0], 0) || math.IsInf(coord[1], 0) {
+			return p, errors.Errorf("coordinate %d is not a number: %v", i, coord)
+		}
+		x := coord[0]
+		y := coord[1]
+		if ft != nil {
+			ft.minX = min(x, ft.minX)
+			ft.maxX = max(x, ft.maxX)
+			ft.minY = min(y, ft.minY)
+			ft.maxY = max(y, ft.maxY)
+		}
+		d.bounds.MinX = math.Min(x, d.bounds.MinX)
+		d.bounds.MaxX = math.Max(x, d.bounds.MaxX)
+		d.bounds.MinY = math.Min(y, d.bounds.MinY)
+		d.bounds.MaxY = math.Max(y, d.bounds.MaxY)
+		d.coords = append(d.coords, x, y)
+	}
+	p.end = len(d.coords)
+	return
+}
+
+// extentOf is the rectangle the coordinates of the polygons and the parts of ft lie in
+func (d *Dataset) extentOf(ft *feature) Bounds {
+	b := Bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	extend := func(p part) {
+		for j := p.start; j < p.end; j += 2 {
+			b.MinX = math.Min(d.coords[j], b.MinX)
+			b.MaxX = math.Max(d.coords[j], b.MaxX)
+			b.MinY = math.Min(d.coords[j+1], b.MinY)
+			b.MaxY = math.Max(d.coords[j+1], b.MaxY)
+		}
+	}
+	for _, polygon := range ft.polygons {
+		for _, p := range polygon {
+			extend(p)
+		}
+	}
+	for _, p := range ft.parts {
+		extend(p)
+	}
+	return b
+}
+
+// Union returns the rectangle containing both b and o
+func (b Bounds) Union(o Bounds) Bounds {
+	return Bounds{
+		MinX: math.Min(b.MinX, o.MinX),
+		MinY: math.Min(b.MinY, o.MinY),
+		MaxX: math.Max(b.MaxX, o.MaxX),
+		MaxY: math.Max(b.MaxY, o.MaxY),
+	}
+}
+
+// Bounds returns the rectangle all the coordinates of d lie in
+func (d *Dataset) Bounds() Bounds {
+	return d.bounds
+}
+
+// Mercator returns a copy of d with longitudes and latitudes projected by Web Mercator
+// to the unit square, x grows to the east and y grows to the south as in tile numbers.
+// The bounds stay in degrees, the extents of the features are projected
+func (d *Dataset) Mercator() *Dataset {
+	m := &Dataset{coords: make([]float64, len(d.coords)), features: make([]feature, len(d.features)), bounds: d.bounds}
+	for i := 0; i < len(d.coords); i += 2 {
+		m.coords[i], m.coords[i+1] = MercatorXY(d.coords[i], d.coords[i+1])
+	}
+	for i, ft := range d.features {
+		if ft.hasName {
+			ft.minX, ft.minY = MercatorXY(ft.minX, ft.minY)
+			ft.maxX, ft.maxY = MercatorXY(ft.maxX, ft.maxY)
+			ft.minY, ft.maxY = ft.maxY, ft.minY
+		}
+		ft.extent = m.extentOf(&ft)
+		m.features[i] = ft
+	}
+	return m
+}
+
+// MercatorXY projects a longitude and a latitude to the unit square
+func MercatorXY(lon, lat float64) (x, y float64) {
+	lat = math.Max(math.Min(lat, 85.0511), -85.0511) * math.Pi / 180
+	x = (lon + 180) / 360
+	y = (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2
+	return
+}
+
+func min(x, y float64) float64 {
+	if x < 0 || y < 0 {
+		return max(x, y)
+	}
+	if x <= y {
+		return x
+	}
+	return y
+}
+
+func max(x, y float64) float64 {
+	if x >= y {
+		return x
+	}
+	return y
+}
+
+// NewContext creates the canvas with the background and the base transformation
+func (r *Renderer) NewContext() (dc *gg.Context) {
+	dc = r.newTransparentContext()
+	dc.SetHexColor(r.Background)
+	dc.Clear()
+	return
+}
+
+// Fit sets the scale and the origin of r so b fills the canvas keeping its proportions,
+// fitMargin of the canvas is left empty around it
+func (r *Renderer) Fit(b Bounds) {
+	w, h := b.MaxX-b.MinX, b.MaxY-b.MinY
+	s := 1.0
+	switch {
+	case w > 0 && h > 0:
+		s = math.Min(float64(r.Width)/w, float64(r.Height)/h)
+	case w > 0:
+		s = float64(r.Width) / w
+	case h > 0:
+		s = float64(r.Height) / h
+	}
+	s *= 1 - 2*fitMargin
+	r.ScaleX, r.ScaleY = s, s
+	r.X0 = -b.MinX + (float64(r.Width)/s-w)/2
+	r.Y0 = -b.MinY + (float64(r.Height)/s-h)/2
+}
+
+const fitMargin = 0.05
+
+func (r *Renderer) newTransparentContext() (dc *gg.Context) {
+	dc = gg.NewContext(r.Width, r.Height)
+	dc.InvertY()
+	dc.Scale(r.ScaleX, r.ScaleY)
+	dc.Translate(r.X0, r.Y0)
+	return
+}
+
+// setView applies the zoom and the offset of v
+func (r *Renderer) setView(dc *gg.Context, v View) {
+	dc.ScaleAbout(v.Scale, v.Scale, v.ZoomX, v.ZoomY)
+	dc.Translate(v.DeltaX/v.Scale, v.DeltaY/v.Scale)
+}
+
+// Draw draws d with the style of mapLayer on a new canvas
+func (r *Renderer) Draw(d *Dataset, mapLayer Layer, v View) (dc *gg.Context, err error) {
+	dc = r.NewContext()
+	r.setView(dc, v)
+	err = r.drawLayer(dc, d, mapLayer, nil)
+	return
+}
+
+// DrawTile draws the layers of jobs one by one on the tile z/x/y,
+// the datasets of the jobs must be projected by Mercator. The features whose extents
+// are farther than cullMargin from the tile are skipped
+func (r *Renderer) DrawTile(jobs []Job, z, x, y int) (dc *gg.Context, err error) {
+	dc = gg.NewContext(TileSize, TileSize)
+	dc.SetHexColor(r.Background)
+	dc.Clear()
+	n := math.Exp2(float64(z))
+	dc.Scale(TileSize*n, TileSize*n)
+	dc.Translate(-float64(x)/n, -float64(y)/n)
+	views := &screens{cull: tileCull(z, x, y)}
+	for _, job := range sortJobs(jobs) {
+		err = r.drawLayer(dc, job.Data, job.Layer, views)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// tileCull is the rectangle of the tile z/x/y in the unit square of Mercator widened by cullMargin
+func tileCull(z, x, y int) *Bounds {
+	n := math.Exp2(float64(z))
+	pad := cullMargin / (TileSize * n)
+	return &Bounds{
+		MinX: float64(x)/n - pad,
+		MinY: float64(y)/n - pad,
+		MaxX: float64(x+1)/n + pad,
+		MaxY: float64(y+1)/n + pad,
+	}
+}
+
+// sortJobs returns the jobs in the order of their layers
+func sortJobs(jobs []Job) []Job {
+	sorted := make([]Job, len(jobs))
+	copy(sorted, jobs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Layer.Order < sorted[j].Layer.Order
+	})
+	return sorted
+}
+
+// Job is a layer to be drawn by DrawParallel
+type Job struct {
+	Data  *Dataset
+	Layer Layer
+}
+
+// DrawParallel draws every job on its own transparent canvas by the given number of workers
+// and then composes the canvases on the background in the order of the layers
+func (r *Renderer) DrawParallel(jobs []Job, v View, workers int) (dc *gg.Context, err error) {
+	if workers < 1 {
+		workers = 1
+	}
+	images := make([]image.Image, len(jobs))
+	errs := make([]error, len(jobs))
+	indexes := make(chan int)
+	views := &screens{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				ldc := r.newTransparentContext()
+				r.setView(ldc, v)
+				errs[i] = r.drawLayer(ldc, jobs[i].Data, jobs[i].Layer, views)
+				images[i] = ldc.Image()
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+
+	order := make([]int, len(jobs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return jobs[order[i]].Layer.Order < jobs[order[j]].Layer.Order
+	})
+	dc = gg.NewContext(r.Width, r.Height)
+	dc.SetHexColor(r.Background)
+	dc.Clear()
+	for _, i := range order {
+		dc.DrawImage(images[i], 0, 0)
+	}
+	return
+}
+
+// DrawLayer draws d with the style of mapLayer on the existing canvas
+func (r *Renderer) DrawLayer(dc *gg.Context, d *Dataset, mapLayer Layer) (err error) {
+	return r.drawLayer(dc, d, mapLayer, nil)
+}
+
+// drawLayer draws d in the pixels of its screen in the view of dc, views keeps the screens
+// of the datasets of the layers drawn in the same view, nil makes the screen for this layer only
+func (r *Renderer) drawLayer(dc *gg.Context, d *Dataset, mapLayer Layer, views *screens) (err error) {
+	l, err := newLabeler(r.Fonts, &mapLayer)
+	if err != nil {
+		return
+	}
+	legend, err := Classify(d, mapLayer)
+	if err != nil {
+		return
+	}
+	if r.Clip != nil {
+		d = r.clipped(d)
+	}
+	s := views.of(d, dc)
+	dc.Push()
+	defer dc.Pop()
+	dc.Identity()
+	applyStyle(dc, &mapLayer)
+	for _, i := range s.drawn {
+		ft := &d.features[i]
+		switch ft.geometry {
+		case geojson.GeometryMultiPolygon, geojson.GeometryPolygon:
+			fill := mapLayer.Fill
+			if legend != nil {
+				if v, ok := ft.number(legend.Property); ok {
+					fill = PolygonFill{State: true, Color: legend.Colors[classOf(legend.Breaks, v)]}
+				}
+			}
+			for _, polygon := range ft.polygons {
+				for _, ring := range polygon {
+					s.lineTo(dc, ring)
+					dc.NewSubPath()
+				}
+				fillAndStroke(dc, &mapLayer, fill)
+			}
+			if ft.hasName {
+				_, err = l.apply(dc, ft.name)
+				if err != nil {
+					return
+				}
+				s.drawString(dc, ft)
+			}
+		case geojson.GeometryPoint, geojson.GeometryMultiPoint:
+			p := ft.parts[0]
+			for j := p.start; j < p.end; j += 2 {
+				dc.DrawPoint(s.coords[j], s.coords[j+1], r.PointRadius)
+			}
+		case geojson.GeometryLineString, geojson.GeometryMultiLineString:
+			for _, p := range ft.parts {
+				s.lineTo(dc, p)
+				dc.Stroke()
+			}
+			if mapLayer.LineLabels && ft.hasName && len(ft.parts) > 0 && ft.parts[0].end > ft.parts[0].start {
+				_, err = l.apply(dc, ft.name)
+				if err != nil {
+					return
+				}
+				dc.DrawStringAnchored(ft.name, s.coords[ft.parts[0].start], s.coords[ft.parts[0].start+1], 0, 0)
+			}
+		}
+	}
+	return
+}
+
+// affine is the transformation of a canvas from the coordinates of the data to its pixels
+type affine struct {
+	xx float64
+	yx float64
+	xy float64
+	yy float64
+	x0 float64
+	y0 float64
+}
+
+// transformOf is the current transformation of dc
+func transformOf(dc *gg.Context) affine {
+	x0, y0 := dc.TransformPoint(0, 0)
+	x1, y1 := dc.TransformPoint(1, 0)
+	x2, y2 := dc.TransformPoint(0, 1)
+	return affine{xx: x1 - x0, yx: y1 - y0, xy: x2 - x0, yy: y2 - y0, x0: x0, y0: y0}
+}
+
+func (m affine) apply(x, y float64) (float64, float64) {
+	return m.xx*x + m.xy*y + m.x0, m.yx*x + m.yy*y + m.y0
+}
+
+// screen is a dataset in the pixels of a view: its coordinates are transformed once
+// for all the layers of it drawn in the view, they are drawn with the identity then
+type screen struct {
+	m      affine
+	coords []float64
+	// drawn are the indexes of the features to draw, the coordinates of the others are not transformed
+	drawn []int
+}
+
+// newScreen transforms the features of d by m, the ones out of cull are left out unless it is nil
+func newScreen(d *Dataset, m affine, cull *Bounds) *screen {
+	s := &screen{m: m, coords: make([]float64, len(d.coords)), drawn: make([]int, 0, len(d.features))}
+	apply := func(p part) {
+		for j := p.start; j < p.end; j += 2 {
+			s.coords[j], s.coords[j+1] = m.apply(d.coords[j], d.coords[j+1])
+		}
+	}
+	for i := range d.features {
+		ft := &d.features[i]
+		if cull != nil && !ft.extent.intersects(*cull) {
+			continue
+		}
+		s.drawn = append(s.drawn, i)
+		for _, polygon := range ft.polygons {
+			for _, p := range polygon {
+				apply(p)
+			}
+		}
+		for _, p := range ft.parts {
+			apply(p)
+		}
+	}
+	return s
+}
+
+// cullMargin is how far in pixels out of a tile a feature is still drawn on it,
+// so its strokes, its points and its label reaching into the tile are not cut at the edge
+const cullMargin = TileSize
+
+// screens are the screens of the datasets drawn in one view, each is made once
+// by the first of the layers drawing it. The features out of cull are not drawn if it is not nil
+type screens struct {
+	mu   sync.Mutex
+	m    map[*Dataset]*screenEntry
+	cull *Bounds
+}
+
+type screenEntry struct {
+	once sync.Once
+	s    *screen
+}
+
+// of is the screen of d in the view of dc, nil screens make a new one
+func (views *screens) of(d *Dataset, dc *gg.Context) *screen {
+	if views == nil {
+		return newScreen(d, transformOf(dc), nil)
+	}
+	views.mu.Lock()
+	if views.m == nil {
+		views.m = make(map[*Dataset]*screenEntry)
+	}
+	e := views.m[d]
+	if e == nil {
+		e = &screenEntry{}
+		views.m[d] = e
+	}
+	views.mu.Unlock()
+	e.once.Do(func() { e.s = newScreen(d, transformOf(dc), views.cull) })
+	return e.s
+}
+
+func (s *screen) lineTo(dc *gg.Context, p part) {
+	coords := s.coords[p.start:p.end]
+	for j := 0; j < len(coords); j += 2 {
+		dc.LineTo(coords[j], coords[j+1])
+	}
+}
+
+func fillAndStroke(dc *gg.Context, mapLayer *Layer, fill PolygonFill) {
+	dc.SetFillRuleWinding()
+	if fill.State {
+		dc.SetHexColor(fill.Color)
+	} else {
+		dc.SetHexColor("FFF")
+	}
+	dc.FillPreserve()
+	dc.SetLineWidth(mapLayer.LineWidth * 2)
+	dc.SetHexColor("#FFF")
+	dc.StrokePreserve()
+	dc.SetLineWidth(mapLayer.LineWidth)
+	dc.SetHexColor(mapLayer.Color)
+	dc.Stroke()
+}
+
+// drawString draws the name of ft in the middle of its bounds, which are in the coordinates of the data
+func (s *screen) drawString(dc *gg.Context, ft *feature) {
+	xOffset, yOffset := s.m.apply((ft.minX + (ft.maxX-ft.minX)/2), (ft.minY + (ft.maxY-ft.minY)/2))
+	dc.Push()
+	dc.SetHexColor("FFF")
+	dc.DrawStringWrapped(ft.name, xOffset, yOffset, 0.5, 0.5, ft.maxX-ft.minX, 1, gg.AlignCenter)
+	dc.Pop()
+}
+
+func applyStyle(dc *gg.Context, mapLayer *Layer) {
+	dc.SetHexColor(mapLayer.Color)
+	dc.SetLineWidth(mapLayer.LineWidth)
+}
@@ -0,0 +1,220 @@
+package render
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/paulmach/go.geojson"
+)
+
+const (
+	benchWidth  = 1366
+	benchHeight = 1024
+	benchScaleX = 7
+	benchScaleY = 10
+	benchXn     = benchWidth / benchScaleX
+	benchYn     = benchHeight / benchScaleY
+)
+
+var benchLayer = Layer{ID: "bench", Color: "#000", FontSize: 10, LineWidth: 1, Fill: PolygonFill{State: true, Color: "#0F0A"}}
+
+func newBenchRenderer() *Renderer {
+	return &Renderer{Width: benchWidth, Height: benchHeight, ScaleX: benchScaleX, ScaleY: benchScaleY, Background: "888", PointRadius: 1}
+}
+
+// syntheticPolygons makes n named squares scattered over the canvas
+func syntheticPolygons(n int) *geojson.FeatureCollection {
+	rnd := rand.New(rand.NewSource(1))
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < n; i++ {
+		x := rnd.Float64() * benchXn
+		y := rnd.Float64() * benchYn
+		f := geojson.NewPolygonFeature([][][]float64{{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}, {x, y}}})
+		f.Properties["name"] = fmt.Sprint(i)
+		fc.AddFeature(f)
+	}
+	return fc
+}
+
+func syntheticPoints(n int) *geojson.FeatureCollection {
+	rnd := rand.New(rand.NewSource(1))
+	fc := geojson.NewFeatureCollection()
+	for i := 0; i < n; i++ {
+		fc.AddFeature(geojson.NewPointFeature([]float64{rnd.Float64() * benchXn, rnd.Float64() * benchYn}))
+	}
+	return fc
+}
+
+func benchmarkDraw(b *testing.B, fc *geojson.FeatureCollection) {
+	r := newBenchRenderer()
+	d, err := Prepare(fc, benchXn, benchYn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Draw(d, benchLayer, View{Scale: 1})
+	}
+}
+
+// drawFeatureCollection is the draw of geojson_v2 before the render package, the baseline of the benchmarks:
+// it walks the geojson features with the closures made per draw and transforms every point at LineTo
+func drawFeatureCollection(r *Renderer, fc *geojson.FeatureCollection, mapLayer Layer, v View) *gg.Context {
+	var minX, minY, maxX, maxY float64
+	resetMinMax := func() {
+		minX = benchXn
+		minY = benchYn
+		maxX = 0
+		maxY = 0
+	}
+	resetMinMax()
+	dc := r.NewContext()
+	r.setView(dc, v)
+	drawLineString := func(coords [][]float64) {
+		for _, coord := range coords {
+			dc.LineTo(coord[0], coord[1])
+		}
+		dc.Stroke()
+	}
+	drawPolygon := func(coords [][][]float64) {
+		for _, polygon := range coords {
+			for _, coord := range polygon {
+				x := coord[0]
+				y := coord[1]
+				minX = min(x, minX)
+				maxX = max(x, maxX)
+				minY = min(y, minY)
+				maxY = max(y, maxY)
+				dc.LineTo(x, y)
+			}
+			dc.NewSubPath()
+		}
+		fillAndStroke(dc, &mapLayer, mapLayer.Fill)
+	}
+	drawString := func(name string) {
+		xOffset, yOffset := dc.TransformPoint((minX + (maxX-minX)/2), (minY + (maxY-minY)/2))
+		dc.Push()
+		dc.Identity()
+		dc.SetHexColor("FFF")
+		dc.DrawStringWrapped(name, xOffset, yOffset, 0.5, 0.5, maxX-minX, 1, gg.AlignCenter)
+		dc.Pop()
+	}
+	for _, f := range fc.Features {
+		g := f.Geometry
+		nameProp, hasName := f.Properties["name"]
+		applyStyle(dc, &mapLayer)
+		switch {
+		case g.IsMultiPolygon():
+			for _, polygon := range g.MultiPolygon {
+				drawPolygon(polygon)
+			}
+			if hasName {
+				drawString(nameProp.(string))
+			}
+			resetMinMax()
+		case g.IsPolygon():
+			drawPolygon(g.Polygon)
+			if hasName {
+				drawString(nameProp.(string))
+			}
+			resetMinMax()
+		case g.IsPoint():
+			dc.DrawPoint(g.Point[0], g.Point[1], r.PointRadius)
+		case g.IsMultiPoint():
+			for _, coord := range g.MultiPoint {
+				dc.DrawPoint(coord[0], coord[1], r.PointRadius)
+			}
+		case g.IsLineString():
+			drawLineString(g.LineString)
+		case g.IsMultiLineString():
+			for _, lineString := range g.MultiLineString {
+				drawLineString(lineString)
+			}
+		}
+	}
+	return dc
+}
+
+func benchmarkDrawFeatureCollection(b *testing.B, fc *geojson.FeatureCollection) {
+	r := newBenchRenderer()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		drawFeatureCollection(r, fc, benchLayer, View{Scale: 1})
+	}
+}
+
+func BenchmarkPrepare10kPolygons(b *testing.B) {
+	fc := syntheticPolygons(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Prepare(fc, benchXn, benchYn)
+	}
+}
+
+func BenchmarkDraw10kPolygons(b *testing.B) {
+	benchmarkDraw(b, syntheticPolygons(10000))
+}
+
+func BenchmarkDrawFeatureCollection10kPolygons(b *testing.B) {
+	benchmarkDrawFeatureCollection(b, syntheticPolygons(10000))
+}
+
+func BenchmarkDraw100kPoints(b *testing.B) {
+	benchmarkDraw(b, syntheticPoints(100000))
+}
+
+func BenchmarkDrawFeatureCollection100kPoints(b *testing.B) {
+	benchmarkDrawFeatureCollection(b, syntheticPoints(100000))
+}
+
+func BenchmarkDrawParallel4x10kPolygons(b *testing.B) {
+	r := newBenchRenderer()
+	d, err := Prepare(syntheticPolygons(10000), benchXn, benchYn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	jobs := make([]Job, 4)
+	for i := range jobs {
+		jobs[i] = Job{Data: d, Layer: benchLayer}
+		jobs[i].Layer.Order = i
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.DrawParallel(jobs, View{Scale: 1}, runtime.NumCPU())
+	}
+}
+
+func TestDrawTileSkipsTheFeaturesOutOfTheTile(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.AddFeature(geojson.NewPointFeature([]float64{100, 30}))
+	fc.AddFeature(geojson.NewPointFeature([]float64{-100, -30}))
+	fc.AddFeature(geojson.NewPointFeature([]float64{122.5, 30}))
+	fc.AddFeature(geojson.NewLineStringFeature([][]float64{{40, 30}, {170, 30}}))
+	fc.AddFeature(geojson.NewPolygonFeature([][][]float64{square(-50, -60, -40, -50)}))
+	d, err := Prepare(fc, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = d.Mercator()
+	const z, n = 4, 16
+	mx, my := MercatorXY(100, 30)
+	s := newScreen(d, affine{xx: 1, yy: 1}, tileCull(z, int(mx*n), int(my*n)))
+	// the point of the next tile is in the margin, the line crosses the tile with no point in it
+	if want := []int{0, 2, 3}; !reflect.DeepEqual(s.drawn, want) {
+		t.Errorf("the features %v are drawn, want %v", s.drawn, want)
+	}
+	if x, y := s.coords[0], s.coords[1]; x != mx || y != my {
+		t.Errorf("the point is at %g %g on the screen, want %g %g", x, y, mx, my)
+	}
+	if all := newScreen(d, affine{xx: 1, yy: 1}, nil); len(all.drawn) != len(d.features) {
+		t.Errorf("%d features of %d are drawn out of the tiles", len(all.drawn), len(d.features))
+	}
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"math"
+
+	"github.com/paulmach/go.geojson"
+)
+
+// Simplify drops the points of the lines and the rings of fc lying closer than tolerance
+// to the line between the points kept around them (Douglas-Peucker), in place.
+// A ring keeps at least 4 points and a line 2, the points of Point and MultiPoint are kept all.
+// It returns the number of the points dropped
+func Simplify(fc *geojson.FeatureCollection, tolerance float64) (dropped int) {
+	for _, f := range fc.Features {
+		dropped += reduceGeometry(f.Geometry, false, func(coords [][]float64) [][]float64 {
+			return douglasPeucker(coords, tolerance)
+		})
+	}
+	return
+}
+
+// Quantize rounds the coordinates of fc to the multiples of step in place and drops the points
+// falling on the point before them, so the data is no more precise than the picture it is drawn to.
+// The rings keep at least 4 points and the lines 2 as with Simplify. It returns the number of the points dropped
+func Quantize(fc *geojson.FeatureCollection, step float64) (dropped int) {
+	for _, f := range fc.Features {
+		dropped += reduceGeometry(f.Geometry, true, func(coords [][]float64) [][]float64 {
+			return quantize(coords, step)
+		})
+	}
+	return
+}
+
+// reduceGeometry sets every line and ring of g and its points if points is set to what reduce makes of it
+// unless it has too few points left, it returns the number of the points dropped
+func reduceGeometry(g *geojson.Geometry, points bool, reduce func(coords [][]float64) [][]float64) (dropped int) {
+	if g == nil {
+		return
+	}
+	line := func(coords [][]float64, least int) [][]float64 {
+		kept := reduce(coords)
+		if len(kept) < least {
+			return coords
+		}
+		dropped += len(coords) - len(kept)
+		return kept
+	}
+	switch {
+	case g.IsPoint() && points:
+		g.Point = line([][]float64{g.Point}, 1)[0]
+	case g.IsMultiPoint() && points:
+		g.MultiPoint = line(g.MultiPoint, 1)
+	case g.IsMultiPolygon():
+		for _, polygon := range g.MultiPolygon {
+			for i := range polygon {
+				polygon[i] = line(polygon[i], 4)
+			}
+		}
+	case g.IsPolygon():
+		for i := range g.Polygon {
+			g.Polygon[i] = line(g.Polygon[i], 4)
+		}
+	case g.IsLineString():
+		g.LineString = line(g.LineString, 2)
+	case g.IsMultiLineString():
+		for i := range g.MultiLineString {
+			g.MultiLineString[i] = line(g.MultiLineString[i], 2)
+		}
+	case g.IsCollection():
+		for _, c := range g.Geometries {
+			dropped += reduceGeometry(c, points, reduce)
+		}
+	}
+	return
+}
+
+// quantize rounds coords in place and returns them without the points equal to the point before them
+func quantize(coords [][]float64, step float64) [][]float64 {
+	kept := make([][]float64, 0, len(coords))
+	for _, c := range coords {
+		if len(c) < 2 {
+			kept = append(kept, c)
+			continue
+		}
+		c[0] = math.Round(c[0]/step) * step
+		c[1] = math.Round(c[1]/step) * step
+		if n := len(kept); n > 0 && len(kept[n-1]) >= 2 && kept[n-1][0] == c[0] && kept[n-1][1] == c[1] {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// douglasPeucker keeps the ends of coords and every point farther than tolerance
+// from the segment between the points kept before and after it
+func douglasPeucker(coords [][]float64, tolerance float64) [][]float64 {
+	if len(coords) < 3 {
+		return coords
+	}
+	keep := make([]bool, len(coords))
+	keep[0], keep[len(coords)-1] = true, true
+	stack := [][2]int{{0, len(coords) - 1}}
+	for len(stack) > 0 {
+		first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		farthest, distance := 0, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(coords[i], coords[first], coords[last]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if farthest > 0 {
+			keep[farthest] = true
+			stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+	kept := make([][]float64, 0, len(coords))
+	for i, c := range coords {
+		if keep[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// segmentDistance is the distance of p from the segment ab, the distance from a if they are the same point as the ends of a ring
+func segmentDistance(p, a, b []float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l))
+	}
+	return math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+}
@@ -0,0 +1,30 @@
+package render
+
+import (
+	"testing"
+)
+
+func TestDouglasPeuckerDropsThePointsCloserThanTheTolerance(t *testing.T) {
+	line := douglasPeucker([][]float64{{0, 0}, {1, 0.01}, {2, 0}, {2, 2}}, 0.1)
+	if len(line) != 3 || line[1][0] != 2 {
+		t.Errorf("the line is %v, want the point at 1 dropped", line)
+	}
+	ring := douglasPeucker([][]float64{{0, 0}, {1, 0.01}, {2, 0}, {2, 2}, {0, 2}, {0, 0}}, 0.1)
+	if len(ring) != 5 || ring[1][0] != 2 {
+		t.Errorf("the ring is %v, want the point at 1 dropped", ring)
+	}
+}
+
+func TestDouglasPeuckerKeepsTheEnds(t *testing.T) {
+	ring := douglasPeucker([][]float64{{0, 0}, {0.01, 0}, {0.01, 0.01}, {0, 0.01}, {0, 0}}, 1)
+	if len(ring) != 2 || ring[0][0] != 0 || ring[1][0] != 0 {
+		t.Errorf("the ring is %v, want its ends only", ring)
+	}
+}
+
+func TestQuantizeRoundsAndDropsTheRepeatedPoints(t *testing.T) {
+	line := quantize([][]float64{{0.01, 0.02}, {0.04, -0.01}, {0.26, 0.1}, {0.5, 0.49}}, 0.25)
+	if len(line) != 3 || line[1][0] != 0.25 || line[1][1] != 0 || line[2][0] != 0.5 || line[2][1] != 0.5 {
+		t.Errorf("the line is %v, want 0,0 0.25,0 0.5,0.5", line)
+	}
+}
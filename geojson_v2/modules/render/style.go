@@ -0,0 +1,205 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// styleFile is style.json before the inheritance: the layers are what they set over base
+// and a theme sets its background, its base over the one of the file and its layers over the layers of the same id
+type styleFile struct {
+	Background string                   `json:"background"`
+	CRS        string                   `json:"crs"`
+	Base       map[string]interface{}   `json:"base"`
+	Layer      []map[string]interface{} `json:"layer"`
+	Themes     map[string]styleTheme    `json:"themes"`
+}
+
+type styleTheme struct {
+	Background string                   `json:"background"`
+	Base       map[string]interface{}   `json:"base"`
+	Layer      []map[string]interface{} `json:"layer"`
+}
+
+// UnknownThemeError is the error of LoadStyle for a theme the style doesn't have, Themes are the ones it has
+type UnknownThemeError struct {
+	Theme  string
+	Themes []string
+}
+
+func (e *UnknownThemeError) Error() string {
+	return fmt.Sprintf("there is no theme %q, the style has %s", e.Theme, strings.Join(e.Themes, ", "))
+}
+
+// LoadStyle decodes style.json with the theme, none if it is "", and the background of the theme.
+// Every layer is the base with what the layer sets over it, "fill" is merged by its keys too.
+// A theme is the same: its base goes over the base and its layers over the ones of the same id,
+// the layers of ids the file doesn't have are added
+func LoadStyle(r io.Reader, theme string) (style *Style, err error) {
+	f := &styleFile{}
+	err = json.NewDecoder(r).Decode(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	style = &Style{Background: f.Background, CRS: f.CRS}
+	base := f.Base
+	layers := f.Layer
+	if theme != "" {
+		t, ok := f.Themes[theme]
+		if !ok {
+			return nil, &UnknownThemeError{Theme: theme, Themes: f.themes()}
+		}
+		if t.Background != "" {
+			style.Background = t.Background
+		}
+		base = merge(base, t.Base)
+		layers = overrideLayers(layers, t.Layer)
+	}
+	style.Layer = make([]Layer, len(layers))
+	for i, l := range layers {
+		err = remarshal(merge(base, l), &style.Layer[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "layer %v", l["id"])
+		}
+	}
+	return
+}
+
+// Themes returns the names of the themes of style.json, sorted
+func Themes(r io.Reader) (themes []string, err error) {
+	f := &styleFile{}
+	err = json.NewDecoder(r).Decode(f)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return f.themes(), nil
+}
+
+func (f *styleFile) themes() (themes []string) {
+	for name := range f.Themes {
+		themes = append(themes, name)
+	}
+	sort.Strings(themes)
+	return
+}
+
+// Validate returns the problems of the style LoadStyle lets through and the drawing fails on or draws nothing with:
+// layers without an id or with the id of another layer, wrong colors, negative widths and sizes
+// and choropleths with no property, an unknown method or breaks which don't go up
+func (s *Style) Validate() (problems []error) {
+	if s.Background != "" {
+		if _, err := parseHex(s.Background); err != nil {
+			problems = append(problems, errors.Wrap(err, "background"))
+		}
+	}
+	ids := make(map[string]bool, len(s.Layer))
+	for i, l := range s.Layer {
+		if l.ID == "" {
+			problems = append(problems, errors.Errorf("layer %d has no id", i))
+		} else if ids[l.ID] {
+			problems = append(problems, errors.Errorf("layer %s is not the only one of its id", l.ID))
+		}
+		ids[l.ID] = true
+		problem := func(err error) {
+			problems = append(problems, errors.Wrapf(err, "layer %s", l.ID))
+		}
+		if _, err := parseHex(l.Color); err != nil {
+			problem(err)
+		}
+		if l.Fill.State {
+			if _, err := parseHex(l.Fill.Color); err != nil {
+				problem(errors.Wrap(err, "fill"))
+			}
+		}
+		if l.LineWidth < 0 {
+			problem(errors.Errorf("line-width %g is negative", l.LineWidth))
+		}
+		if l.FontSize < 0 {
+			problem(errors.Errorf("font-size %g is negative", l.FontSize))
+		}
+		if l.Choropleth != nil {
+			for _, err := range l.Choropleth.validate() {
+				problem(errors.Wrap(err, "choropleth"))
+			}
+		}
+	}
+	return
+}
+
+func (c *Choropleth) validate() (problems []error) {
+	if c.Property == "" {
+		problems = append(problems, errors.New("no property"))
+	}
+	switch c.Method {
+	case "", Quantile, EqualInterval, Jenks:
+	default:
+		problems = append(problems, errors.Errorf("unknown method %q, possible variants: %s, %s, %s", c.Method, Quantile, EqualInterval, Jenks))
+	}
+	if c.Classes < 0 {
+		problems = append(problems, errors.Errorf("%d classes", c.Classes))
+	}
+	for _, hex := range c.Ramp {
+		if _, err := parseHex(hex); err != nil {
+			problems = append(problems, errors.Wrap(err, "ramp"))
+		}
+	}
+	if len(c.Breaks) == 1 {
+		problems = append(problems, errors.New("one break makes no class"))
+	}
+	for i := 1; i < len(c.Breaks); i++ {
+		if c.Breaks[i] <= c.Breaks[i-1] {
+			problems = append(problems, errors.Errorf("break %g goes after %g", c.Breaks[i], c.Breaks[i-1]))
+			break
+		}
+	}
+	return
+}
+
+// overrideLayers sets the layers of over over the layers of the same id, the others are added
+func overrideLayers(layers, over []map[string]interface{}) []map[string]interface{} {
+	out := append([]map[string]interface{}(nil), layers...)
+	for _, o := range over {
+		found := false
+		for i, l := range out {
+			if l["id"] == o["id"] {
+				out[i] = merge(l, o)
+				found = true
+			}
+		}
+		if !found {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// merge is a copy of base with the keys of over set over it, the objects are merged by their keys
+func merge(base, over map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		b, bok := out[k].(map[string]interface{})
+		o, ook := v.(map[string]interface{})
+		if bok && ook {
+			out[k] = merge(b, o)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func remarshal(v interface{}, to interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
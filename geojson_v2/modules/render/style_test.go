@@ -0,0 +1,54 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+const themedStyle = `{
+	"base": {"line-width": "2", "color": "#000", "fill": {"state": "true", "color": "#0F0A"}},
+	"layer": [{"id": "a", "color": "#F00"}, {"id": "b", "fill": {"state": "false"}}],
+	"themes": {"dark": {"background": "222", "base": {"line-width": "3"}, "layer": [{"id": "a", "fill": {"color": "#333"}}]}}
+}`
+
+func TestLoadStyleInheritsTheBaseAndTheTheme(t *testing.T) {
+	style, err := LoadStyle(strings.NewReader(themedStyle), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := style.Layer[0], style.Layer[1]
+	if a.Color != "#F00" || a.LineWidth != 2 || !a.Fill.State || a.Fill.Color != "#0F0A" {
+		t.Errorf("layer a is %+v, want the base with its color", a)
+	}
+	if b.Color != "#000" || b.Fill.State || b.Fill.Color != "#0F0A" {
+		t.Errorf("layer b is %+v, want the base with the fill off", b)
+	}
+	style, err = LoadStyle(strings.NewReader(themedStyle), "dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = style.Layer[0]
+	if style.Background != "222" || a.Color != "#F00" || a.LineWidth != 3 || !a.Fill.State || a.Fill.Color != "#333" {
+		t.Errorf("dark is %q with layer a %+v, want the theme over the style", style.Background, a)
+	}
+	_, err = LoadStyle(strings.NewReader(themedStyle), "sepia")
+	if err == nil {
+		t.Error("an unknown theme is loaded")
+	}
+}
+
+func TestValidateFindsTheProblemsOfTheLayers(t *testing.T) {
+	style := &Style{Background: "zzz", Layer: []Layer{
+		{ID: "a", Color: "#000"},
+		{ID: "a", Color: "#000", LineWidth: -1},
+		{Color: "#00"},
+		{ID: "c", Color: "#000", Choropleth: &Choropleth{Property: "p", Method: "median", Breaks: []float64{2, 1}}},
+	}}
+	problems := style.Validate()
+	if len(problems) != 7 {
+		t.Errorf("the problems are %v, want the background, the id a twice, the width, no id, the color and the method and the breaks of c", problems)
+	}
+	if problems := (&Style{Layer: []Layer{{ID: "a", Color: "#000", Fill: PolygonFill{State: true, Color: "#0F0A"}}}}).Validate(); len(problems) != 0 {
+		t.Errorf("a valid style has the problems %v", problems)
+	}
+}
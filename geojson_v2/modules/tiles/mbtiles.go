@@ -0,0 +1,140 @@
+package tiles
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+// Metadata is the part of the MBTiles metadata table known to the generator
+type Metadata struct {
+	Name        string
+	Attribution string
+	Bounds      render.Bounds
+	MinZoom     int
+	MaxZoom     int
+}
+
+// metadataWriter is implemented by writers which store Metadata along with the tiles
+type metadataWriter interface {
+	WriteMetadata(m Metadata) error
+}
+
+// MBTiles stores tiles in an MBTiles 1.3 sqlite file and reads them back
+type MBTiles struct {
+	db *sql.DB
+	mu sync.Mutex
+}
+
+// OpenMBTiles opens the file creating it and its tables if needed
+func OpenMBTiles(path string) (m *MBTiles, err error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return
+	}
+	// sqlite has one writer anyway, more connections only bring SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		`CREATE TABLE IF NOT EXISTS metadata (name TEXT, value TEXT)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS name ON metadata (name)`,
+		`CREATE TABLE IF NOT EXISTS tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS tile_index ON tiles (zoom_level, tile_column, tile_row)`,
+	} {
+		_, err = db.Exec(q)
+		if err != nil {
+			db.Close()
+			return
+		}
+	}
+	return &MBTiles{db: db}, nil
+}
+
+// tmsRow converts the XYZ row to the TMS one MBTiles keeps, they count from the opposite edges
+func tmsRow(t Tile) int {
+	return (1 << uint(t.Z)) - 1 - t.Y
+}
+
+// Has implements Writer
+func (m *MBTiles) Has(t Tile) (has bool, err error) {
+	err = m.db.QueryRow(`SELECT 1 FROM tiles WHERE zoom_level=? AND tile_column=? AND tile_row=?`, t.Z, t.X, tmsRow(t)).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Write implements Writer
+func (m *MBTiles) Write(t Tile, png []byte) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = m.db.Exec(`INSERT OR REPLACE INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`,
+		t.Z, t.X, tmsRow(t), png)
+	return
+}
+
+// WriteMetadata fills the metadata table, the existing values are replaced
+func (m *MBTiles) WriteMetadata(md Metadata) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := map[string]string{
+		"name":        md.Name,
+		"format":      "png",
+		"type":        "baselayer",
+		"version":     "1.0",
+		"attribution": md.Attribution,
+		"bounds":      fmt.Sprintf("%f,%f,%f,%f", md.Bounds.MinX, md.Bounds.MinY, md.Bounds.MaxX, md.Bounds.MaxY),
+		"minzoom":     strconv.Itoa(md.MinZoom),
+		"maxzoom":     strconv.Itoa(md.MaxZoom),
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	for k, v := range values {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO metadata (name, value) VALUES (?, ?)`, k, v)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// Tile returns the png of the tile or nil if there is no such tile
+func (m *MBTiles) Tile(t Tile) (png []byte, err error) {
+	err = m.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level=? AND tile_column=? AND tile_row=?`, t.Z, t.X, tmsRow(t)).Scan(&png)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return
+}
+
+// Metadata returns the whole metadata table
+func (m *MBTiles) Metadata() (md map[string]string, err error) {
+	rows, err := m.db.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	md = make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		err = rows.Scan(&k, &v)
+		if err != nil {
+			return
+		}
+		md[k] = v
+	}
+	err = rows.Err()
+	return
+}
+
+// Close implements Writer
+func (m *MBTiles) Close() error {
+	return m.db.Close()
+}
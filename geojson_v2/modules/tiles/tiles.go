@@ -0,0 +1,231 @@
+package tiles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+// Tile is the address of a tile in the XYZ scheme
+type Tile struct {
+	Z int
+	X int
+	Y int
+}
+
+func (t Tile) String() string {
+	return fmt.Sprintf("%d/%d/%d", t.Z, t.X, t.Y)
+}
+
+// Writer stores rendered tiles
+type Writer interface {
+	// Has reports whether the tile is already stored, it is used to resume a stopped generation
+	Has(t Tile) (bool, error)
+	Write(t Tile, png []byte) error
+	Close() error
+}
+
+// Range returns all the tiles of the zoom z covering the bounds given in degrees
+func Range(b render.Bounds, z int) (tiles []Tile) {
+	n := int(math.Exp2(float64(z)))
+	minX, maxY := tileXY(b.MinX, b.MinY, n)
+	maxX, minY := tileXY(b.MaxX, b.MaxY, n)
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			tiles = append(tiles, Tile{Z: z, X: x, Y: y})
+		}
+	}
+	return
+}
+
+func tileXY(lon, lat float64, n int) (x, y int) {
+	mx, my := render.MercatorXY(lon, lat)
+	x = clamp(int(mx*float64(n)), 0, n-1)
+	y = clamp(int(my*float64(n)), 0, n-1)
+	return
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// Options of Generate
+type Options struct {
+	MinZoom int
+	MaxZoom int
+	Workers int
+	// Force renders the tiles the writer already has
+	Force bool
+	// Progress receives a line on the state of the generation every second, nil is quiet
+	Progress io.Writer
+	// Name and Attribution go to the metadata if the writer keeps it
+	Name        string
+	Attribution string
+}
+
+// Generate renders the pyramid of tiles from MinZoom to MaxZoom covering the datasets of jobs,
+// which are to be projected by Mercator, and passes them to w
+func Generate(r *render.Renderer, jobs []render.Job, w Writer, o Options) (err error) {
+	if len(jobs) == 0 {
+		return errors.New("nothing to render")
+	}
+	b := jobs[0].Data.Bounds()
+	for _, job := range jobs[1:] {
+		b = b.Union(job.Data.Bounds())
+	}
+	var all []Tile
+	for z := o.MinZoom; z <= o.MaxZoom; z++ {
+		all = append(all, Range(b, z)...)
+	}
+	if o.Workers < 1 {
+		o.Workers = 1
+	}
+	if mw, ok := w.(metadataWriter); ok {
+		err = mw.WriteMetadata(Metadata{Name: o.Name, Attribution: o.Attribution, Bounds: b, MinZoom: o.MinZoom, MaxZoom: o.MaxZoom})
+		if err != nil {
+			return errors.Wrap(err, "metadata")
+		}
+	}
+
+	var done, skipped int64
+	stop := make(chan struct{})
+	if o.Progress != nil {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					fmt.Fprintf(o.Progress, "%d/%d tiles, %d skipped\n", atomic.LoadInt64(&done), len(all), atomic.LoadInt64(&skipped))
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	tileCh := make(chan Tile)
+	errCh := make(chan error, o.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < o.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tileCh {
+				err := renderTile(r, jobs, w, t, o.Force)
+				if err == errSkipped {
+					atomic.AddInt64(&skipped, 1)
+				} else if err != nil {
+					errCh <- err
+					return
+				}
+				atomic.AddInt64(&done, 1)
+			}
+		}()
+	}
+loop:
+	for _, t := range all {
+		select {
+		case tileCh <- t:
+		case err = <-errCh:
+			break loop
+		}
+	}
+	close(tileCh)
+	wg.Wait()
+	close(stop)
+	if err == nil {
+		select {
+		case err = <-errCh:
+		default:
+		}
+	}
+	if o.Progress != nil {
+		fmt.Fprintf(o.Progress, "%d/%d tiles, %d skipped\n", done, len(all), skipped)
+	}
+	return
+}
+
+var errSkipped = errors.New("the tile is already rendered")
+
+func renderTile(r *render.Renderer, jobs []render.Job, w Writer, t Tile, force bool) (err error) {
+	if !force {
+		var has bool
+		has, err = w.Has(t)
+		if err != nil {
+			return errors.Wrapf(err, "tile %s", t)
+		}
+		if has {
+			return errSkipped
+		}
+	}
+	dc, err := r.DrawTile(jobs, t.Z, t.X, t.Y)
+	if err != nil {
+		return errors.Wrapf(err, "tile %s", t)
+	}
+	buf := new(bytes.Buffer)
+	err = dc.EncodePNG(buf)
+	if err != nil {
+		return errors.Wrapf(err, "tile %s", t)
+	}
+	err = w.Write(t, buf.Bytes())
+	if err != nil {
+		return errors.Wrapf(err, "tile %s", t)
+	}
+	return
+}
+
+// DirWriter stores tiles as dir/z/x/y.png
+type DirWriter struct {
+	Dir string
+}
+
+func (w *DirWriter) path(t Tile) string {
+	return filepath.Join(w.Dir, fmt.Sprint(t.Z), fmt.Sprint(t.X), fmt.Sprint(t.Y)+".png")
+}
+
+// Has implements Writer
+func (w *DirWriter) Has(t Tile) (bool, error) {
+	_, err := os.Stat(w.path(t))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Write implements Writer, the tile is written to a temporary file first
+// so a stopped generation never leaves a broken tile to be resumed over
+func (w *DirWriter) Write(t Tile, png []byte) (err error) {
+	p := w.path(t)
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(p+".tmp", png, 0644)
+	if err != nil {
+		return
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// Close implements Writer
+func (w *DirWriter) Close() error {
+	return nil
+}
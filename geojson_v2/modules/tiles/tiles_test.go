@@ -0,0 +1,91 @@
+package tiles
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/paulmach/go.geojson"
+
+	"github.com/rav1L/geojson_v2/modules/render"
+)
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		b     render.Bounds
+		z     int
+		tiles []Tile
+	}{
+		{render.Bounds{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}, 0, []Tile{{0, 0, 0}}},
+		{render.Bounds{MinX: -180, MinY: -90, MaxX: 180, MaxY: 90}, 1, []Tile{{1, 0, 0}, {1, 0, 1}, {1, 1, 0}, {1, 1, 1}}},
+		{render.Bounds{MinX: -10, MinY: 10, MaxX: -5, MaxY: 20}, 1, []Tile{{1, 0, 0}}},
+		{render.Bounds{MinX: 100, MinY: 30, MaxX: 100, MaxY: 30}, 4, []Tile{{4, 12, 6}}},
+		{render.Bounds{MinX: -10, MinY: -10, MaxX: 10, MaxY: 10}, 2, []Tile{{2, 1, 1}, {2, 1, 2}, {2, 2, 1}, {2, 2, 2}}},
+	}
+	for _, tt := range tests {
+		if tiles := Range(tt.b, tt.z); !reflect.DeepEqual(tiles, tt.tiles) {
+			t.Errorf("%+v at zoom %d is %v, want %v", tt.b, tt.z, tiles, tt.tiles)
+		}
+	}
+}
+
+// memWriter keeps the tiles written to it, stored are the ones it has before
+type memWriter struct {
+	mu      sync.Mutex
+	stored  map[Tile]bool
+	written []Tile
+}
+
+func (w *memWriter) Has(t Tile) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stored[t], nil
+}
+
+func (w *memWriter) Write(t Tile, png []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stored[t] = true
+	w.written = append(w.written, t)
+	return nil
+}
+
+func (w *memWriter) Close() error {
+	return nil
+}
+
+func (w *memWriter) sorted() []Tile {
+	sort.Slice(w.written, func(i, j int) bool { return w.written[i].String() < w.written[j].String() })
+	return w.written
+}
+
+func TestGenerateResumes(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.AddFeature(geojson.NewPolygonFeature([][][]float64{{{-10, -10}, {10, -10}, {10, 10}, {-10, 10}, {-10, -10}}}))
+	d, err := render.Prepare(fc, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []render.Job{{Data: d.Mercator(), Layer: render.Layer{ID: "square", Color: "#000", LineWidth: 1}}}
+	o := Options{MinZoom: 0, MaxZoom: 1, Workers: 2}
+
+	w := &memWriter{stored: map[Tile]bool{{0, 0, 0}: true, {1, 1, 0}: true}}
+	err = Generate(&render.Renderer{Background: "FFF"}, jobs, w, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Tile{{1, 0, 0}, {1, 0, 1}, {1, 1, 1}}; !reflect.DeepEqual(w.sorted(), want) {
+		t.Errorf("the tiles %v are rendered, want the ones not stored %v", w.written, want)
+	}
+
+	w.written = nil
+	o.Force = true
+	err = Generate(&render.Renderer{Background: "FFF"}, jobs, w, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Tile{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {1, 1, 0}, {1, 1, 1}}; !reflect.DeepEqual(w.sorted(), want) {
+		t.Errorf("the tiles %v are rendered by Force, want all of %v", w.written, want)
+	}
+}
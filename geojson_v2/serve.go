@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/rav1L/geojson_v2/modules/tiles"
+)
+
+// serve serves the tiles of the -out .mbtiles file as /tiles/z/x/y.png and its metadata as /metadata
+func serve() (err error) {
+	if filepath.Ext(tilesOut) != mbtilesExt {
+		return errors.Errorf("serve needs an %s file in -out, got %q", mbtilesExt, tilesOut)
+	}
+	mb, err := tiles.OpenMBTiles(tilesOut)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer mb.Close()
+	http.HandleFunc("/tiles/", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := parseTile(strings.TrimPrefix(r.URL.Path, "/tiles/"))
+		if !ok {
+			writeError(w, http.StatusBadRequest, "the tile address is z/x/y.png")
+			return
+		}
+		png, err := mb.Tile(t)
+		if err != nil {
+			log.Printf("%+v", errors.Wrapf(err, "tile %s", t))
+			writeError(w, http.StatusInternalServerError, "the tile failed to be read")
+			return
+		}
+		if png == nil {
+			writeError(w, http.StatusNotFound, "there is no tile "+t.String())
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(png)
+	})
+	http.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		md, err := mb.Metadata()
+		if err != nil {
+			log.Printf("%+v", errors.Wrap(err, "metadata"))
+			writeError(w, http.StatusInternalServerError, "the metadata failed to be read")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(md)
+	})
+	log.Printf("serving %s on %s", tilesOut, addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+type errorModel struct {
+	Code int    `json:"code"`
+	Text string `json:"text"`
+}
+
+// writeError answers {"error":{"code","text"}}, the details of server errors go to the log only
+func writeError(w http.ResponseWriter, code int, text string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error errorModel `json:"error"`
+	}{errorModel{Code: code, Text: text}})
+}
+
+// parseTile parses z/x/y.png
+func parseTile(p string) (t tiles.Tile, ok bool) {
+	parts := strings.Split(strings.TrimSuffix(p, ".png"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	var err error
+	values := make([]int, 3)
+	for i, part := range parts {
+		values[i], err = strconv.Atoi(part)
+		if err != nil || values[i] < 0 {
+			return
+		}
+	}
+	t = tiles.Tile{Z: values[0], X: values[1], Y: values[2]}
+	n := 1 << uint(t.Z)
+	return t, t.Z < 32 && t.X < n && t.Y < n
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rav1L/szip/modules/szip"
+)
+
+// rcName is the configuration file of a project, it is looked for in the working directory
+const rcName = ".sziprc"
+
+// rcConfig is .sziprc, a JSON object of the defaults of the flags of the project.
+// The flags given on the command line go over it
+type rcConfig struct {
+	Cert        string   `json:"cert"`
+	Pkey        string   `json:"pkey"`
+	Path        string   `json:"path"`
+	TSA         string   `json:"tsa"`
+	TSARoots    string   `json:"tsa_roots"`
+	Digest      string   `json:"digest"`
+	Compression string   `json:"compression"`
+	Include     []string `json:"include"`
+	Exclude     []string `json:"exclude"`
+	Jobs        int      `json:"jobs"`
+}
+
+// the compression methods of the files
+const (
+	compressDeflate = "deflate"
+	compressStore   = "store"
+)
+
+// loadConfig sets the flags not given on the command line to the values of the file at path,
+// which may be missing unless it was given by -config
+func loadConfig(path string, given bool) (err error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !given {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	var c rcConfig
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return fmt.Errorf("%s is broken: %v", path, err)
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range map[string]string{
+		"cert":        c.Cert,
+		"pkey":        c.Pkey,
+		"path":        c.Path,
+		"tsa":         c.TSA,
+		"tsa-roots":   c.TSARoots,
+		"digest":      c.Digest,
+		"compression": c.Compression,
+		"include":     strings.Join(c.Include, ","),
+		"exclude":     strings.Join(c.Exclude, ","),
+	} {
+		if value != "" && !set[name] {
+			flag.Set(name, value)
+		}
+	}
+	if c.Jobs > 0 && !set["jobs"] {
+		flag.Set("jobs", strconv.Itoa(c.Jobs))
+	}
+	return checkConfig()
+}
+
+// checkConfig checks the values of the flags whichever they came from
+func checkConfig() (err error) {
+	switch compression {
+	case compressDeflate, compressStore:
+	default:
+		return fmt.Errorf("unknown compression %q, possible variants: %s, %s", compression, compressDeflate, compressStore)
+	}
+	if _, err = szip.NewHash(digest); err != nil {
+		return
+	}
+	for _, p := range append(splitPatterns(include), splitPatterns(exclude)...) {
+		if _, err = path.Match(p, ""); err != nil {
+			return fmt.Errorf("pattern %q: %v", p, err)
+		}
+	}
+	return loadTimestampRoots()
+}
+
+// loadTimestampRoots sets the roots of the time-stamp authorities to the certificates of -tsa-roots if it is set
+func loadTimestampRoots() (err error) {
+	if tsaRoots == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(tsaRoots)
+	if err != nil {
+		return
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return fmt.Errorf("%s has no certificates", tsaRoots)
+	}
+	szip.TimestampRoots = roots
+	return
+}
+
+func splitPatterns(s string) (patterns []string) {
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return
+}
+
+// selected tells whether the file or the directory fpath, slash separated, goes to the archive:
+// it matches no pattern of -exclude and a file matches one of -include if there are any.
+// A pattern matches the whole path or the name
+func selected(fpath string, dir bool) bool {
+	matches := func(patterns string) bool {
+		for _, p := range splitPatterns(patterns) {
+			if ok, _ := path.Match(p, fpath); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, path.Base(fpath)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(exclude) {
+		return false
+	}
+	return dir || include == "" || matches(include)
+}
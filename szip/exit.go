@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// the exit codes of szip, the scripts tell the failures apart by them
+const (
+	exitOK = 0
+	// exitFailure is any failure of no other class
+	exitFailure = 1
+	// exitUsage is a wrong mode, flag or .sziprc
+	exitUsage = 2
+	// exitSignature is an archive failing to be signed or its signature or -hash failing to be verified
+	exitSignature = 3
+	// exitIntegrity is a file not matching its record or a manifest not matching the archive
+	exitIntegrity = 4
+	// exitIO is a file failing to be read or written
+	exitIO = 5
+)
+
+// exitError is an error of the class of code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withCode classes err by code, nil stays nil
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode is the code of the class of err, the errors of the files are exitIO unless they are classed
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return exitIO
+	}
+	return exitFailure
+}
@@ -0,0 +1,66 @@
+package szip
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// the digest algorithms of the records
+const (
+	DigestSHA1   = "sha1"
+	DigestSHA256 = "sha256"
+)
+
+// Digest is the hash of a file of the archive, the zero Digest is none and is not checked
+type Digest struct {
+	Algorithm string
+	Sum       string
+}
+
+// NewHash returns the hash of the algorithm
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case DigestSHA1:
+		return sha1.New(), nil
+	case DigestSHA256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("unknown digest %q, possible variants: %s, %s", algorithm, DigestSHA1, DigestSHA256)
+}
+
+// Digest is the sha256 of the record if it has one, its sha1 otherwise
+func (r Record) Digest() Digest {
+	if r.SHA256 != "" {
+		return Digest{DigestSHA256, strings.ToLower(r.SHA256)}
+	}
+	if r.SHA1 != "" {
+		return Digest{DigestSHA1, strings.ToLower(r.SHA1)}
+	}
+	return Digest{}
+}
+
+// SetDigest sets the sum of the algorithm of d to the record
+func (r *Record) SetDigest(d Digest) {
+	switch d.Algorithm {
+	case DigestSHA1:
+		r.SHA1 = d.Sum
+	case DigestSHA256:
+		r.SHA256 = d.Sum
+	}
+}
+
+// Matches tells whether h, which is to be of the algorithm of d, sums to d
+func (d Digest) Matches(h hash.Hash) bool {
+	return fmt.Sprintf("%x", h.Sum(nil)) == d.Sum
+}
+
+// Hash returns the hash of the algorithm of d, a zero Digest has none
+func (d Digest) Hash() (hash.Hash, error) {
+	if d.Algorithm == "" {
+		return sha1.New(), nil
+	}
+	return NewHash(d.Algorithm)
+}
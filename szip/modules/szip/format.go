@@ -0,0 +1,174 @@
+// Package szip reads and writes the signed .szp archives: a zip and its meta.xml manifest
+// in a PKCS#7 signed container
+package szip
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The signed content of an .szp file is one of the formats:
+//
+//	FormatV1: meta length (4 bytes LE) | deflated meta.xml | zip
+//	FormatV2: "SZIP" | version (2 bytes LE) | meta length (4 bytes LE) | deflated meta.xml | zip
+//
+// FormatV1 has no header, it is told apart by the magic: "SZIP" read as the meta length of FormatV1
+// would be over a gigabyte of meta. New archives are written in FormatCurrent.
+const (
+	FormatV1      = 1
+	FormatV2      = 2
+	FormatCurrent = FormatV2
+
+	magicSize   = 4
+	versionSize = 2
+	sizeSize    = 4
+)
+
+// MetaName is the name of the manifest
+const MetaName = "meta.xml"
+
+var formatMagic = []byte("SZIP")
+
+// Record is the manifest entry of a file of the archive, it has the hash of the digest
+// the archive was made with, the one of sha1 or sha256
+type Record struct {
+	XMLName          xml.Name  `xml:"meta"`
+	Name             string    `xml:"name"`
+	UncompressedSize uint64    `xml:"size>original_size"`
+	ModTime          time.Time `xml:"mod_time"`
+	SHA1             string    `xml:"sha1_hash,omitempty"`
+	SHA256           string    `xml:"sha256_hash,omitempty"`
+}
+
+// WriteContainer compresses meta and writes it with z in FormatCurrent
+func WriteContainer(w io.Writer, meta []byte, z []byte) (err error) {
+	meta, err = compressData(meta)
+	if err != nil {
+		return
+	}
+	header := make([]byte, magicSize+versionSize+sizeSize)
+	copy(header, formatMagic)
+	binary.LittleEndian.PutUint16(header[magicSize:], FormatCurrent)
+	binary.LittleEndian.PutUint32(header[magicSize+versionSize:], uint32(len(meta)))
+	_, err = w.Write(header)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(meta)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(z)
+	return
+}
+
+// ParseContainer detects the format of the signed content and splits it into the uncompressed meta and the zip
+func ParseContainer(data []byte) (version int, meta []byte, z []byte, err error) {
+	version = FormatV1
+	if bytes.HasPrefix(data, formatMagic) {
+		if len(data) < magicSize+versionSize {
+			return 0, nil, nil, errors.New("the archive header is truncated")
+		}
+		version = int(binary.LittleEndian.Uint16(data[magicSize:]))
+		data = data[magicSize+versionSize:]
+	}
+	switch version {
+	case FormatV1, FormatV2:
+	default:
+		return 0, nil, nil, fmt.Errorf("the archive format v%d is not supported, the latest known is v%d", version, FormatCurrent)
+	}
+	if len(data) < sizeSize {
+		return 0, nil, nil, errors.New("the archive header is truncated")
+	}
+	metaEnd := sizeSize + int(binary.LittleEndian.Uint32(data[:sizeSize]))
+	if metaEnd > len(data) {
+		return 0, nil, nil, errors.New("the meta size exceeds the archive")
+	}
+	meta, err = uncompressData(data[sizeSize:metaEnd])
+	if err != nil {
+		return
+	}
+	z = data[metaEnd:]
+	return
+}
+
+// ReadMeta decodes the records of meta.xml
+func ReadMeta(meta []byte) (records []Record, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(meta))
+	for {
+		var v Record
+		err = dec.Decode(&v)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s is broken: %v", MetaName, err)
+		}
+		records = append(records, v)
+	}
+}
+
+// CheckManifest compares the records with the files of the zip, extra are the files without records
+// and missing are the records without files
+func CheckManifest(records []Record, files []*zip.File) (extra []string, missing []string) {
+	recorded := make(map[string]bool, len(records))
+	for _, v := range records {
+		recorded[strings.ToLower(v.Name)] = false
+	}
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		if _, ok := recorded[name]; !ok {
+			extra = append(extra, f.Name)
+			continue
+		}
+		recorded[name] = true
+	}
+	for _, v := range records {
+		if !recorded[strings.ToLower(v.Name)] {
+			missing = append(missing, v.Name)
+		}
+	}
+	return
+}
+
+func compressData(data []byte) (newData []byte, err error) {
+	nbuf := new(bytes.Buffer)
+	w, err := flate.NewWriter(nbuf, -1)
+	if err != nil {
+		return
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return
+	}
+	err = w.Close()
+	if err != nil {
+		return
+	}
+	return nbuf.Bytes(), err
+}
+
+func uncompressData(data []byte) (newData []byte, err error) {
+	rc := flate.NewReader(bytes.NewReader(data))
+	nbuf := new(bytes.Buffer)
+	_, err = io.Copy(nbuf, rc)
+	if err != nil {
+		return
+	}
+	err = rc.Close()
+	if err != nil {
+		return
+	}
+	return nbuf.Bytes(), err
+}
@@ -0,0 +1,51 @@
+package szip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseContainer(t *testing.T) {
+	meta, err := compressData([]byte("<meta></meta>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := []byte("zip")
+	v2 := new(bytes.Buffer)
+	err = WriteContainer(v2, []byte("<meta></meta>"), z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := make([]byte, sizeSize)
+	binary.LittleEndian.PutUint32(v1, uint32(len(meta)))
+	v1 = append(append(v1, meta...), z...)
+	v9 := append(append([]byte{}, formatMagic...), 9, 0)
+	for _, c := range []struct {
+		name    string
+		data    []byte
+		version int
+		fail    bool
+	}{
+		{"v1", v1, FormatV1, false},
+		{"v2", v2.Bytes(), FormatV2, false},
+		{"unknown version", append(v9, v2.Bytes()[magicSize+versionSize:]...), 0, true},
+		{"truncated", v2.Bytes()[:magicSize+1], 0, true},
+		{"meta overflow", v1[:sizeSize+1], 0, true},
+	} {
+		version, m, rest, err := ParseContainer(c.data)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: no error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if version != c.version || string(m) != "<meta></meta>" || !bytes.Equal(rest, z) {
+			t.Errorf("%s: got v%d %q %q", c.name, version, m, rest)
+		}
+	}
+}
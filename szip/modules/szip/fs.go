@@ -0,0 +1,115 @@
+package szip
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+)
+
+// ErrHashMismatch is returned by the reads of a file whose content does not match its record
+var ErrHashMismatch = errors.New("the hash does not match the record")
+
+// ErrUntrustedSigner is returned by Open for an archive signed by none of the trusted certificates
+var ErrUntrustedSigner = errors.New("the archive is signed by an untrusted certificate")
+
+// archiveFS is a verified archive, the files are checked against their records as they are read
+type archiveFS struct {
+	zr     *zip.Reader
+	hashes map[string]Digest
+}
+
+// Open reads the .szp file at path, verifies its signature, its timestamp and its manifest
+// and presents the files as a read-only fs.FS with the signature. The signer must be one of trusted,
+// Verify alone accepts any certificate. The hash of a file is checked when
+// the file is read to its end, the read returning io.EOF fails with ErrHashMismatch instead
+func Open(path string, trusted []*x509.Certificate) (fs.FS, *Signature, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := Verify(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !signedBy(s, trusted) {
+		return nil, nil, ErrUntrustedSigner
+	}
+	_, meta, z, err := ParseContainer(s.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := ReadMeta(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		return nil, nil, err
+	}
+	extra, missing := CheckManifest(records, zr.File)
+	if len(extra) > 0 || len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%s does not match the archive: %d files without records, %d records without files", MetaName, len(extra), len(missing))
+	}
+	a := &archiveFS{zr: zr, hashes: make(map[string]Digest, len(records))}
+	for _, v := range records {
+		a.hashes[strings.ToLower(v.Name)] = v.Digest()
+	}
+	return a, s, nil
+}
+
+// signedBy reports whether the signer of s is one of trusted
+func signedBy(s *Signature, trusted []*x509.Certificate) bool {
+	for _, c := range trusted {
+		if c != nil && s.Signer.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open implements fs.FS
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	f, err := a.zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	d := a.hashes[strings.ToLower(name)]
+	h, err := d.Hash()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &verifiedFile{File: f, name: name, d: d, h: h}, nil
+}
+
+// verifiedFile hashes what is read and compares it with d at the end of the file
+type verifiedFile struct {
+	fs.File
+	name string
+	d    Digest
+	h    hash.Hash
+}
+
+func (f *verifiedFile) Read(p []byte) (n int, err error) {
+	n, err = f.File.Read(p)
+	f.h.Write(p[:n])
+	if err == io.EOF && !f.d.Matches(f.h) {
+		return n, &fs.PathError{Op: "read", Path: f.name, Err: ErrHashMismatch}
+	}
+	return
+}
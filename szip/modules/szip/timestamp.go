@@ -0,0 +1,238 @@
+package szip
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/fullsailor/pkcs7"
+)
+
+// TimestampBlock is the type of the PEM block following the signature in an .szp file,
+// it holds the RFC 3161 timestamp token of the DER of the signature
+const TimestampBlock = "RFC3161 TIMESTAMP"
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+// TimestampClient is used to ask the time-stamp authority
+var TimestampClient = &http.Client{Timeout: 30 * time.Second}
+
+// TimestampRoots are the roots the certificates of the time-stamp authorities are verified against,
+// the roots of the system if it is nil
+var TimestampRoots *x509.CertPool
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString asn1.RawValue  `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       asn1.RawValue `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+}
+
+func imprint(signed []byte) messageImprint {
+	h := sha256.Sum256(signed)
+	return messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: h[:]}
+}
+
+// RequestTimestamp asks the time-stamp authority at url for a token on signed
+func RequestTimestamp(url string, signed []byte) (token []byte, err error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return
+	}
+	req, err := asn1.Marshal(timeStampReq{Version: 1, MessageImprint: imprint(signed), Nonce: nonce, CertReq: true})
+	if err != nil {
+		return
+	}
+	resp, err := TimestampClient.Post(url, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the time-stamp authority answered %s", resp.Status)
+	}
+	var tsr timeStampResp
+	_, err = asn1.Unmarshal(body, &tsr)
+	if err != nil {
+		return nil, fmt.Errorf("the time-stamp response is broken: %v", err)
+	}
+	// 0 is granted and 1 is granted with modifications
+	if tsr.Status.Status > 1 {
+		return nil, fmt.Errorf("the time-stamp authority refused the request with status %d", tsr.Status.Status)
+	}
+	token = tsr.TimeStampToken.FullBytes
+	info, err := parseToken(token)
+	if err != nil {
+		return
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("the time-stamp token answers another request")
+	}
+	_, err = checkToken(info, signed)
+	return
+}
+
+func parseToken(token []byte) (info *tstInfo, err error) {
+	p7, err := pkcs7.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("the time-stamp token is broken: %v", err)
+	}
+	err = p7.Verify()
+	if err != nil {
+		return nil, fmt.Errorf("the time-stamp token is not verified: %v", err)
+	}
+	info = &tstInfo{}
+	_, err = asn1.Unmarshal(p7.Content, info)
+	if err != nil {
+		return nil, fmt.Errorf("the time-stamp token is broken: %v", err)
+	}
+	err = verifyAuthority(p7, info.GenTime)
+	if err != nil {
+		return nil, fmt.Errorf("the time-stamp authority is not trusted: %v", err)
+	}
+	return
+}
+
+// verifyAuthority checks the signer of the token is a time-stamp authority whose certificate
+// chains to TimestampRoots at genTime, the certificates of the token are the intermediates.
+// Verify only checks the token against the certificate it holds, anyone could sign one
+func verifyAuthority(p7 *pkcs7.PKCS7, genTime time.Time) (err error) {
+	signer := p7.GetOnlySigner()
+	if signer == nil {
+		return errors.New("the time-stamp token must have one signer")
+	}
+	// a certificate without the extended key usages is good for any of them, the authority must name it
+	timeStamping := false
+	for _, usage := range signer.ExtKeyUsage {
+		timeStamping = timeStamping || usage == x509.ExtKeyUsageTimeStamping
+	}
+	if !timeStamping {
+		return errors.New("the certificate of the signer is not for time stamping")
+	}
+	roots := TimestampRoots
+	if roots == nil {
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			return
+		}
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range p7.Certificates {
+		intermediates.AddCert(c)
+	}
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   genTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	return
+}
+
+func checkToken(info *tstInfo, signed []byte) (genTime time.Time, err error) {
+	want := imprint(signed)
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, want.HashedMessage) {
+		return genTime, errors.New("the time-stamp token is not on this signature")
+	}
+	return info.GenTime, nil
+}
+
+// VerifyTimestamp verifies the token on signed and the authority that issued it against TimestampRoots,
+// and returns the time it was issued at
+func VerifyTimestamp(token, signed []byte) (genTime time.Time, err error) {
+	info, err := parseToken(token)
+	if err != nil {
+		return
+	}
+	return checkToken(info, signed)
+}
+
+// Signature is the verified signature of an .szp file
+type Signature struct {
+	// Content is the signed container
+	Content []byte
+	Signer  *x509.Certificate
+	// Timestamp is the time of the trusted timestamp, zero if the archive has none
+	Timestamp time.Time
+}
+
+// Expired reports whether the certificate of the signer is not valid now
+// and there is no timestamp proving the archive was signed while it was
+func (s *Signature) Expired() bool {
+	now := time.Now()
+	return s.Timestamp.IsZero() && (now.Before(s.Signer.NotBefore) || now.After(s.Signer.NotAfter))
+}
+
+// Verify verifies the signature of the .szp data and its timestamp if there is one.
+// A timestamp must be within the validity of the certificate of the signer
+func Verify(data []byte) (s *Signature, err error) {
+	p, rest := pem.Decode(data)
+	if p == nil {
+		return nil, errors.New("failed to parse PEM block")
+	}
+	p7, err := pkcs7.Parse(p.Bytes)
+	if err != nil {
+		return
+	}
+	err = p7.Verify()
+	if err != nil {
+		return
+	}
+	s = &Signature{Content: p7.Content, Signer: p7.GetOnlySigner()}
+	if s.Signer == nil {
+		return nil, errors.New("the archive must have one signer")
+	}
+	tp, _ := pem.Decode(rest)
+	if tp == nil || tp.Type != TimestampBlock {
+		return
+	}
+	s.Timestamp, err = VerifyTimestamp(tp.Bytes, p.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if s.Timestamp.Before(s.Signer.NotBefore) || s.Timestamp.After(s.Signer.NotAfter) {
+		return nil, fmt.Errorf("the archive was timestamped at %s when the certificate was not valid", s.Timestamp.Format(time.RFC3339))
+	}
+	return
+}
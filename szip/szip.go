@@ -3,10 +3,8 @@ package main
 import (
 	"archive/zip"
 	"bytes"
-	"compress/flate"
 	"crypto/sha1"
 	"crypto/x509"
-	"encoding/binary"
 	"encoding/pem"
 	"encoding/xml"
 	"errors"
@@ -17,33 +15,42 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fullsailor/pkcs7"
+
+	"github.com/rav1L/szip/modules/szip"
 )
 
 var (
-	mode      string
-	hash      string
-	cert      string
-	pkey      string
-	dataPath  string
-	modesEnum = []string{"z", "x", "i"}
-	enc       *xml.Encoder
-	metaBuf   = new(bytes.Buffer)
+	mode        string
+	hash        string
+	cert        string
+	pkey        string
+	dataPath    string
+	lenient     bool
+	tsaURL      string
+	tsaRoots    string
+	entry       string
+	outPath     string
+	jobs        int
+	digest      string
+	compression string
+	include     string
+	exclude     string
+	configRC    string
+	modesEnum   = []string{"z", "x", "i", "a"}
+	enc         *xml.Encoder
+	metaBuf     = new(bytes.Buffer)
 )
 
-const zName = "szip"
-const metaName = "meta.xml"
+// msgOut takes the diagnostics, stdout takes the results only, so a file extracted to stdout is not mixed with them
+var msgOut io.Writer = os.Stderr
 
-type metaStruct struct {
-	XMLName          xml.Name  `xml:"meta"`
-	Name             string    `xml:"name"`
-	UncompressedSize uint64    `xml:"size>original_size"`
-	ModTime          time.Time `xml:"mod_time"`
-	SHA1             string    `xml:"sha1_hash"`
-}
+const zName = "szip"
 
 func init() {
 	flag.StringVar(&mode, "mode", "required", "mode")
@@ -51,15 +58,38 @@ func init() {
 	flag.StringVar(&cert, "cert", "./my.crt", "certificate path")
 	flag.StringVar(&pkey, "pkey", "./my.key", "private key path")
 	flag.StringVar(&dataPath, "path", "./data/", "read/write files path")
+	flag.BoolVar(&lenient, "lenient", false, "extract files which have no record in meta.xml")
+	flag.StringVar(&tsaURL, "tsa", "", "RFC 3161 time-stamp authority url, the signature is timestamped if it is set")
+	flag.StringVar(&tsaRoots, "tsa-roots", "", "PEM file of the roots the time-stamp authorities are verified against (default: the roots of the system)")
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of files -x extracts and verifies at the same time")
+	flag.StringVar(&entry, "file", "", "path inside the archive of the only file -x extracts")
+	flag.StringVar(&outPath, "o", "", "where -x -file writes the file, - is stdout (default: its path under -path)")
+	flag.StringVar(&digest, "digest", szip.DigestSHA1, "digest of the records of the files added, sha1 or sha256")
+	flag.StringVar(&compression, "compression", compressDeflate, "compression of the files added, deflate or store")
+	flag.StringVar(&include, "include", "", "comma separated patterns of the files of -path added, all without it; a pattern matches the path or the name")
+	flag.StringVar(&exclude, "exclude", "", "comma separated patterns of the files and the directories of -path not added")
+	flag.StringVar(&configRC, "config", rcName, "JSON file of the defaults of the flags, the flags given go over it")
 }
 
 func main() {
+	log.SetFlags(0)
+	log.SetPrefix(zName + ": ")
 	flag.Parse()
-	execute(mode)
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		given = given || f.Name == "config"
+	})
+	err := withCode(exitUsage, loadConfig(configRC, given))
+	if err == nil {
+		err = execute(mode)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	os.Exit(exitCode(err))
 }
 
-func execute(mode string) {
-	var err error
+func execute(mode string) (err error) {
 	switch mode {
 	case modesEnum[0]:
 		err = zipFunc(filepath.Clean(zName))
@@ -67,10 +97,12 @@ func execute(mode string) {
 		err = extract(filepath.Clean(zName))
 	case modesEnum[2]:
 		err = info(filepath.Clean(zName))
+	case modesEnum[3]:
+		err = appendFiles(filepath.Clean(zName))
 	default:
-		err = errors.New("mode can be only -z, -x or -i")
+		err = withCode(exitUsage, errors.New("mode can be only -z, -x, -i or -a"))
 	}
-	log.Fatal(err)
+	return
 }
 
 func addData(zPath string, w *zip.Writer) (err error) {
@@ -84,6 +116,9 @@ func addData(zPath string, w *zip.Writer) (err error) {
 		return
 	}
 	for _, file := range dirinfo {
+		if !selected(filepath.ToSlash(filepath.Join(zPath, file.Name())), file.IsDir()) {
+			continue
+		}
 		if file.IsDir() {
 			newFolder := filepath.ToSlash(filepath.Join(zPath, file.Name())) + "/"
 			_, err = w.Create(newFolder)
@@ -92,54 +127,193 @@ func addData(zPath string, w *zip.Writer) (err error) {
 			}
 			addData(newFolder, w)
 		} else {
-			f, err := os.Open(filepath.Join(dataPath, zPath, file.Name()))
-			if err != nil {
-				return err
-			}
-			info, err := f.Stat()
-			if err != nil {
-				return err
-			}
-			header, err := zip.FileInfoHeader(info)
-			if err != nil {
-				return err
-			}
-			fpath := filepath.Join(zPath, file.Name())
-			header.Name = fpath
-			header.Method = zip.Deflate
-			writer, err := w.CreateHeader(header)
+			// zip names are slash separated whatever the system is
+			err = addFile(filepath.ToSlash(filepath.Join(zPath, file.Name())), w)
 			if err != nil {
-				return err
-			}
-			_, err = io.Copy(writer, f)
-			if err != nil {
-				return err
+				return
 			}
-			v := &metaStruct{
-				Name:             fpath,
-				UncompressedSize: header.UncompressedSize64,
-				ModTime:          header.ModTime(),
+		}
+	}
+	return
+}
+
+// addFile compresses the file fpath of dataPath into w and encodes its record
+func addFile(fpath string, w *zip.Writer) (err error) {
+	f, err := os.Open(filepath.Join(dataPath, filepath.FromSlash(fpath)))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return
+	}
+	header.Name = fpath
+	header.Method = zip.Deflate
+	if compression == compressStore {
+		header.Method = zip.Store
+	}
+	writer, err := w.CreateHeader(header)
+	if err != nil {
+		return
+	}
+	h, err := szip.NewHash(digest)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(writer, io.TeeReader(f, h))
+	if err != nil {
+		return
+	}
+	v := &szip.Record{
+		Name:             fpath,
+		UncompressedSize: header.UncompressedSize64,
+		ModTime:          header.ModTime(),
+	}
+	v.SetDigest(szip.Digest{Algorithm: digest, Sum: fmt.Sprintf("%x", h.Sum(nil))})
+	return enc.Encode(v)
+}
+
+// appendFiles adds the files of dataPath the archive doesn't have or has with another content to name.szp.
+// The entries kept are copied as they are without being compressed again, the ones of the files
+// changed are replaced, then the manifest is written again and the archive is signed again
+func appendFiles(name string) (err error) {
+	sig, err := verifySign(name + ".szp")
+	if err != nil {
+		return
+	}
+	_, meta, z, err := szip.ParseContainer(sig.Content)
+	if err != nil {
+		return
+	}
+	records, err := szip.ReadMeta(meta)
+	if err != nil {
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		return
+	}
+	_, missing := szip.CheckManifest(records, zr.File)
+	if len(missing) > 0 {
+		return withCode(exitIntegrity, fmt.Errorf("%s lists files the archive does not have: %s", szip.MetaName, strings.Join(missing, ", ")))
+	}
+	recorded := make(map[string]szip.Record, len(records))
+	for _, v := range records {
+		recorded[strings.ToLower(v.Name)] = v
+	}
+	entries := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		entries[strings.ToLower(f.Name)] = true
+	}
+	var dirs, added []string
+	replaced := make(map[string]bool)
+	err = filepath.Walk(filepath.Clean(dataPath), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Clean(dataPath), path)
+		if err != nil || rel == "." {
+			return err
+		}
+		fpath := filepath.ToSlash(rel)
+		if !selected(fpath, fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
 			}
-			h := sha1.New()
-			_, err = f.Seek(0, 0)
-			if err != nil {
-				return err
+			return nil
+		}
+		if fi.IsDir() {
+			if !entries[strings.ToLower(fpath+"/")] {
+				dirs = append(dirs, fpath+"/")
 			}
-			_, err = io.Copy(h, f)
-			if err != nil {
+			return nil
+		}
+		v, ok := recorded[strings.ToLower(fpath)]
+		if ok {
+			same, err := sameContent(path, v.Digest())
+			if err != nil || same {
 				return err
 			}
-			f.Close()
-			v.SHA1 = fmt.Sprintf("%x", h.Sum(nil))
-			err = enc.Encode(v)
+			replaced[strings.ToLower(fpath)] = true
+		}
+		added = append(added, fpath)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if len(added) == 0 && len(dirs) == 0 {
+		fmt.Println("The archive has all the files of " + dataPath)
+		return
+	}
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	enc = xml.NewEncoder(metaBuf)
+	enc.Indent("  ", "    ")
+	var kept int
+	for _, f := range zr.File {
+		if replaced[strings.ToLower(f.Name)] {
+			continue
+		}
+		err = w.Copy(f)
+		if err != nil {
+			return
+		}
+		if v, ok := recorded[strings.ToLower(f.Name)]; ok {
+			err = enc.Encode(&v)
 			if err != nil {
-				return err
+				return
 			}
+			kept++
+		}
+	}
+	for _, dir := range dirs {
+		_, err = w.Create(dir)
+		if err != nil {
+			return
+		}
+	}
+	for _, fpath := range added {
+		err = addFile(fpath, w)
+		if err != nil {
+			return
 		}
 	}
+	err = w.Close()
+	if err != nil {
+		return
+	}
+	err = writeSZP(name, buf.Bytes())
+	if err != nil {
+		return
+	}
+	fmt.Printf("%d files appended, %d of them replacing the ones of another content, %d files kept\n", len(added), len(replaced), kept)
 	return
 }
 
+// sameContent tells whether the file at path sums to d
+func sameContent(path string, d szip.Digest) (same bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h, err := d.Hash()
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return
+	}
+	return d.Matches(h), nil
+}
+
 func zipFunc(name string) (err error) {
 	fz, err := os.Create(name + ".zip")
 	if err != nil {
@@ -163,11 +337,6 @@ func zipFunc(name string) (err error) {
 
 func createSZP(name string) (err error) {
 	zname := name + ".zip"
-	szpname := name + ".szp"
-	meta, err := compressData(metaBuf.Bytes())
-	if err != nil {
-		return
-	}
 	fz, err := os.Open(zname)
 	if err != nil {
 		return
@@ -176,67 +345,63 @@ func createSZP(name string) (err error) {
 	if err != nil {
 		return
 	}
-	szp, err := os.Create(szpname)
+	fz.Close()
+	err = writeSZP(name, z)
 	if err != nil {
 		return
 	}
-	defer szp.Close()
+	err = os.Remove(zname)
+	return
+}
+
+// writeSZP signs the zip z with the manifest of metaBuf and timestamps it into name.szp
+func writeSZP(name string, z []byte) (err error) {
 	buf := new(bytes.Buffer)
-	size := make([]byte, 4)
-	binary.LittleEndian.PutUint32(size, uint32(len(meta)))
-	_, err = buf.Write(size)
+	err = szip.WriteContainer(buf, metaBuf.Bytes(), z)
 	if err != nil {
 		return
 	}
-	_, err = buf.Write(meta)
+	d, err := signData(buf.Bytes(), filepath.Clean(cert), filepath.Clean(pkey))
 	if err != nil {
-		return
+		return withCode(exitSignature, err)
 	}
-	_, err = buf.Write(z)
-	if err != nil {
-		return
+	if tsaURL != "" {
+		d, err = timestamp(d)
+		if err != nil {
+			return withCode(exitSignature, err)
+		}
 	}
-	d, err := signData(buf.Bytes(), filepath.Clean(cert), filepath.Clean(pkey))
+	// the file is created once it is signed, so an archive appended to is not lost if the signing fails
+	szp, err := os.Create(name + ".szp")
 	if err != nil {
 		return
 	}
+	defer szp.Close()
 	_, err = szp.Write(d)
-	if err != nil {
-		return
-	}
-	fz.Close()
-	err = os.Remove(zname)
 	return
 }
 
-func readSZP(data []byte) (meta []byte, z []byte, err error) {
-	p, _ := pem.Decode(data)
-	if p == nil {
-		return nil, nil, errors.New("failed to parse PEM block")
-	}
-	p7, err := pkcs7.Parse(p.Bytes)
-	if err != nil {
-		return
-	}
-	data = p7.Content
-	initialSize := 4
-	size := data[:initialSize]
-	metaEnd := initialSize + int(binary.LittleEndian.Uint32(size))
-	meta = data[initialSize:metaEnd]
-	meta, err = uncompressData(meta)
+// timestamp appends the timestamp token of the signature to the signed data
+func timestamp(signed []byte) (data []byte, err error) {
+	p, _ := pem.Decode(signed)
+	token, err := szip.RequestTimestamp(tsaURL, p.Bytes)
 	if err != nil {
 		return
 	}
-	z = data[metaEnd:]
-	return
+	fmt.Fprintln(msgOut, "The sign has been timestamped by "+tsaURL)
+	return append(signed, pem.EncodeToMemory(&pem.Block{Type: szip.TimestampBlock, Bytes: token})...), nil
 }
 
+// extract verifies the archive and extracts all its files, the only one of -file if it is set
 func extract(name string) (err error) {
-	szp, err := verifySign(name + ".szp")
+	if entry != "" {
+		return extractEntry(name)
+	}
+	sig, err := verifySign(name + ".szp")
 	if err != nil {
 		return
 	}
-	meta, z, err := readSZP(szp)
+	_, meta, z, err := szip.ParseContainer(sig.Content)
 	if err != nil {
 		return
 	}
@@ -253,75 +418,231 @@ func extract(name string) (err error) {
 	if err != nil {
 		return
 	}
-	buf := new(bytes.Buffer)
-	_, err = buf.Write(meta)
+	defer zr.Close()
+	metaUnion, err := szip.ReadMeta(meta)
 	if err != nil {
 		return
 	}
-	dec := xml.NewDecoder(buf)
-	var metaUnion []metaStruct
-	for {
-		var v metaStruct
-		err = dec.Decode(&v)
-		if err == io.EOF {
-			break
-		}
-		metaUnion = append(metaUnion, v)
+	extra, missing := szip.CheckManifest(metaUnion, zr.File)
+	if len(missing) > 0 {
+		return withCode(exitIntegrity, fmt.Errorf("%s lists files the archive does not have: %s", szip.MetaName, strings.Join(missing, ", ")))
+	}
+	if len(extra) > 0 && !lenient {
+		return withCode(exitIntegrity, fmt.Errorf("files without a record in %s (-lenient extracts them): %s", szip.MetaName, strings.Join(extra, ", ")))
+	}
+	hashes := make(map[string]szip.Digest, len(metaUnion))
+	for _, v := range metaUnion {
+		hashes[strings.ToLower(v.Name)] = v.Digest()
 	}
 	os.MkdirAll(filepath.Clean(dataPath), os.FileMode('d'))
+	var files []*zip.File
 	for _, f := range zr.File {
-		if !f.FileInfo().IsDir() {
-			h := sha1.New()
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			_, err = io.Copy(h, rc)
-			if err != nil {
-				return err
-			}
-			for _, v := range metaUnion {
-				if !strings.EqualFold(v.Name, f.Name) {
-					continue
-				}
-				if !strings.EqualFold(v.SHA1, fmt.Sprintf("%x", h.Sum(nil))) {
-					return errors.New("Hash of " + f.Name + " does not match")
-				}
-				break
-			}
-			file, err := os.Create(filepath.Join(dataPath, f.Name))
-			if err != nil {
-				return err
-			}
-			rc, err = f.Open()
-			if err != nil {
-				return err
-			}
-			_, err = io.Copy(file, rc)
-			if err != nil {
-				return err
-			}
-			file.Close()
-			rc.Close()
-		} else {
+		if f.FileInfo().IsDir() {
 			os.MkdirAll(filepath.Join(dataPath, f.Name), os.FileMode('d'))
+			continue
 		}
+		files = append(files, f)
+	}
+	results := extractFiles(files, hashes)
+	var verified, unverified int
+	var failed []string
+	code := exitOK
+	for i, f := range files {
+		switch _, ok := hashes[strings.ToLower(f.Name)]; {
+		case results[i] != nil:
+			failed = append(failed, results[i].Error())
+			// a mismatch goes over the other failures as the archive is not to be trusted
+			if c := exitCode(results[i]); code != exitIntegrity {
+				code = c
+			}
+		case ok:
+			verified++
+		default:
+			unverified++
+		}
+	}
+	fmt.Printf("%d files extracted and verified", verified)
+	if unverified > 0 {
+		fmt.Printf(", %d files have no hash in %s", unverified, szip.MetaName)
+	}
+	fmt.Println()
+	if len(failed) > 0 {
+		return withCode(code, fmt.Errorf("%d files failed to be extracted:\n%s", len(failed), strings.Join(failed, "\n")))
 	}
 	zr.Close()
 	err = os.Remove(name + ".zip")
 	return
 }
 
+// extractFiles extracts the files by -jobs workers, each one hashing the files it writes,
+// the error of files[i] is errs[i]
+func extractFiles(files []*zip.File, hashes map[string]szip.Digest) (errs []error) {
+	errs = make([]error, len(files))
+	workers := jobs
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = extractFile(files[i], hashes[strings.ToLower(files[i].Name)])
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return
+}
+
+// extractEntry extracts the file -file only to -o checking the hash of its record, the rest of the archive
+// is not read. The file is read to the memory and checked before it is written to stdout
+func extractEntry(name string) (err error) {
+	sig, err := verifySign(name + ".szp")
+	if err != nil {
+		return
+	}
+	_, meta, z, err := szip.ParseContainer(sig.Content)
+	if err != nil {
+		return
+	}
+	records, err := szip.ReadMeta(meta)
+	if err != nil {
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		return
+	}
+	var f *zip.File
+	for _, zf := range zr.File {
+		if strings.EqualFold(zf.Name, entry) && !zf.FileInfo().IsDir() {
+			f = zf
+			break
+		}
+	}
+	if f == nil {
+		return withCode(exitUsage, fmt.Errorf("the archive has no file %s", entry))
+	}
+	var d szip.Digest
+	for _, v := range records {
+		if strings.EqualFold(v.Name, f.Name) {
+			d = v.Digest()
+			break
+		}
+	}
+	if d.Sum == "" && !lenient {
+		return withCode(exitIntegrity, fmt.Errorf("%s has no record in %s (-lenient extracts it)", f.Name, szip.MetaName))
+	}
+	if outPath != "-" {
+		path := outPath
+		if path == "" {
+			path = filepath.Join(dataPath, f.Name)
+		}
+		err = os.MkdirAll(filepath.Dir(path), os.FileMode('d'))
+		if err != nil {
+			return
+		}
+		err = extractFileTo(f, d, path)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(msgOut, f.Name+" extracted to "+path)
+		return
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return
+	}
+	if d.Sum != "" {
+		h, err := d.Hash()
+		if err != nil {
+			return err
+		}
+		h.Write(data)
+		if !d.Matches(h) {
+			return withCode(exitIntegrity, errors.New("Hash of "+f.Name+" does not match"))
+		}
+	}
+	_, err = os.Stdout.Write(data)
+	return
+}
+
+// extractFile writes f to dataPath hashing it on the way, the file is removed if its hash is not d.
+// A zero d is not checked
+func extractFile(f *zip.File, d szip.Digest) (err error) {
+	return extractFileTo(f, d, filepath.Join(dataPath, f.Name))
+}
+
+// extractFileTo writes f to path as extractFile does
+func extractFileTo(f *zip.File, d szip.Digest, path string) (err error) {
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	h, err := d.Hash()
+	if err != nil {
+		return
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(file, io.TeeReader(rc, h))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && d.Sum != "" && !d.Matches(h) {
+		err = withCode(exitIntegrity, errors.New("Hash of "+f.Name+" does not match"))
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
+
 func info(name string) (err error) {
-	szp, err := verifySign(name + ".szp")
+	sig, err := verifySign(name + ".szp")
 	if err != nil {
 		return
 	}
-	meta, _, err := readSZP(szp)
+	version, meta, z, err := szip.ParseContainer(sig.Content)
 	if err != nil {
 		return
 	}
+	fmt.Printf("Format: v%d\n", version)
 	fmt.Printf("%s", meta)
+	records, err := szip.ReadMeta(meta)
+	if err != nil {
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		return
+	}
+	extra, missing := szip.CheckManifest(records, zr.File)
+	fmt.Println()
+	if len(extra) == 0 && len(missing) == 0 {
+		fmt.Printf("Every file of the archive has a record in %s\n", szip.MetaName)
+	}
+	for _, name := range extra {
+		fmt.Printf("No record in %s: %s\n", szip.MetaName, name)
+	}
+	for _, name := range missing {
+		fmt.Printf("Missing from the archive: %s\n", name)
+	}
 	return
 }
 
@@ -384,7 +705,7 @@ func signData(data []byte, cPath string, keyPath string) (sign []byte, err error
 	return buf.Bytes(), err
 }
 
-func verifySign(name string) (data []byte, err error) {
+func verifySign(name string) (sig *szip.Signature, err error) {
 	fszp, err := os.Open(name)
 	if err != nil {
 		return
@@ -394,67 +715,23 @@ func verifySign(name string) (data []byte, err error) {
 	if err != nil {
 		return
 	}
-	p, _ := pem.Decode(szp)
-	if p == nil {
-		return nil, errors.New("failed to parse PEM block")
-	}
-	p7, err := pkcs7.Parse(p.Bytes)
-	if err != nil {
-		return
-	}
 	if hash != "" {
 		h := sha1.Sum(szp)
 		if strings.EqualFold(fmt.Sprintf("%x", h), hash) {
-			fmt.Println("Hash of the certificate matches the specified")
+			fmt.Fprintln(msgOut, "Hash of the certificate matches the specified")
 		} else {
-			return nil, errors.New("Hash of the certificate does not match the specified")
+			return nil, withCode(exitSignature, errors.New("Hash of the certificate does not match the specified"))
 		}
 	}
-	err = p7.Verify()
+	sig, err = szip.Verify(szp)
 	if err != nil {
-		return
+		return nil, withCode(exitSignature, err)
 	}
-	fmt.Println("The sign has been successfully verified")
-	return szp, err
-}
-
-func compressData(data []byte) (newData []byte, err error) {
-	buf := new(bytes.Buffer)
-	_, err = buf.Write(data)
-	if err != nil {
-		return
-	}
-	nbuf := new(bytes.Buffer)
-	w, err := flate.NewWriter(nbuf, -1)
-	if err != nil {
-		return
+	fmt.Fprintln(msgOut, "The sign has been successfully verified")
+	if !sig.Timestamp.IsZero() {
+		fmt.Fprintln(msgOut, "The sign has been timestamped at "+sig.Timestamp.Format(time.RFC3339)+", the certificate was valid then")
+	} else if sig.Expired() {
+		fmt.Fprintln(msgOut, "Warning: the certificate is not valid now and the archive has no timestamp")
 	}
-	_, err = w.Write(buf.Bytes())
-	if err != nil {
-		return
-	}
-	err = w.Close()
-	if err != nil {
-		return
-	}
-	return nbuf.Bytes(), err
-}
-
-func uncompressData(data []byte) (newData []byte, err error) {
-	buf := new(bytes.Buffer)
-	_, err = buf.Write(data)
-	if err != nil {
-		return
-	}
-	rc := flate.NewReader(buf)
-	nbuf := new(bytes.Buffer)
-	_, err = io.Copy(nbuf, rc)
-	if err != nil {
-		return
-	}
-	err = rc.Close()
-	if err != nil {
-		return
-	}
-	return nbuf.Bytes(), err
+	return
 }
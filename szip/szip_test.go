@@ -1,9 +1,93 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/rav1L/szip/modules/szip"
 )
 
 func TestSignData(t *testing.T) {
 
 }
+
+func TestExtractFilesReportsEveryMismatch(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	hashes := make(map[string]szip.Digest)
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		content := []byte(name)
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+		hashes[name] = szip.Digest{Algorithm: szip.DigestSHA1, Sum: fmt.Sprintf("%x", sha1.Sum(content))}
+	}
+	hashes["file3.txt"] = szip.Digest{Algorithm: szip.DigestSHA1, Sum: "bad"}
+	hashes["file17.txt"] = szip.Digest{Algorithm: szip.DigestSHA256, Sum: "bad"}
+	w.Close()
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPath, jobs = t.TempDir(), 4
+	errs := extractFiles(zr.File, hashes)
+	for i, f := range zr.File {
+		bad := f.Name == "file3.txt" || f.Name == "file17.txt"
+		if bad != (errs[i] != nil) {
+			t.Errorf("%s: error %v", f.Name, errs[i])
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dataPath, f.Name))
+		if bad != (err != nil) || (!bad && string(data) != f.Name) {
+			t.Errorf("%s is extracted as %q, %v", f.Name, data, err)
+		}
+	}
+}
+
+func TestSelectedMatchesThePathOrTheName(t *testing.T) {
+	include, exclude = "*.txt, conf/*.json", "tmp,*.bak.txt"
+	for _, c := range []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"a.txt", false, true},
+		{"deep/b.txt", false, true},
+		{"conf/app.json", false, true},
+		{"app.json", false, false},
+		{"old.bak.txt", false, false},
+		{"tmp", true, false},
+		{"src", true, true},
+	} {
+		if got := selected(c.path, c.dir); got != c.want {
+			t.Errorf("%s is selected %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestExitCodeOfTheClasses(t *testing.T) {
+	_, open := os.Open(filepath.Join(t.TempDir(), "none.szp"))
+	for _, c := range []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("any"), exitFailure},
+		{open, exitIO},
+		{fmt.Errorf("extracting: %w", withCode(exitIntegrity, errors.New("mismatch"))), exitIntegrity},
+		{withCode(exitSignature, open), exitSignature},
+	} {
+		if got := exitCode(c.err); got != c.want {
+			t.Errorf("%v exits with %d, want %d", c.err, got, c.want)
+		}
+	}
+}